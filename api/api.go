@@ -0,0 +1,82 @@
+// Package api is the stable surface of descartes for the code embedding it,
+// for e.g. the custom sources and sinks registered to the JobFactory. The
+// other packages may change with any release, this one follows semantic
+// versioning by Version: within a major version the types here are neither
+// removed nor changed, the interfaces don't gain methods, new capabilities
+// come as new optional interfaces like CancelableDataReader. The types are
+// aliases of their base counterparts, so the values flow between the two
+// without conversion
+package api
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"time"
+)
+
+// Version of the API, bumped by the rules in the package doc
+const Version = "1.1.0"
+
+type BaseConfig = base.BaseConfig
+
+// Data is a batch of records, MetaInfo describes where they come from
+type Data = base.Data
+
+// DataReader collects the records of a source and writes them to its
+// DataWriter, one collection cycle per IndexData call
+type DataReader = base.DataReader
+
+// CancelableDataReader is optionally implemented by the DataReaders whose
+// collection cycle in progress can be aborted
+type CancelableDataReader = base.CancelableDataReader
+
+// DataWriter writes Data to a sink, see base.DataWriter for the semantics
+// of WriteDataContext
+type DataWriter = base.DataWriter
+
+// Checkpointer persists the progress of the DataReaders by their key info
+type Checkpointer = base.Checkpointer
+
+type JobParam = base.JobParam
+type JobFunc = base.JobFunc
+
+// Job is scheduled every Interval nano seconds, Callback runs its JobFunc
+type Job = base.Job
+
+// JobCreationHandler creates the Job of a task config for the app it is
+// registered for, nil if the task is invalid, see
+// services.JobFactory.RegisterJobCreationHandler
+type JobCreationHandler = func(config BaseConfig) Job
+
+// Lifecycle keeps the Start/Stop state of the custom sources and sinks, so
+// that they follow the contract of the builtin ones: started once, stopped
+// once, the duplicate calls are no-ops
+type Lifecycle = base.Lifecycle
+
+// Component is a DataReader, DataWriter or Checkpointer adapted by
+// NewComponent, whose Start and Stop return the Lifecycle errors
+type Component = base.Component
+
+var (
+	ErrAlreadyStarted = base.ErrAlreadyStarted
+	ErrAlreadyStopped = base.ErrAlreadyStopped
+	ErrNotStarted     = base.ErrNotStarted
+)
+
+// ErrSkipped is returned by IndexData when a cycle collects nothing on
+// purpose, such cycles are not recorded as job runs
+var ErrSkipped = base.ErrSkipped
+
+func NewData(metaInfo map[string]string, rawData [][]byte) *Data {
+	return base.NewData(metaInfo, rawData)
+}
+
+// NewJob returns a Job calling f with config every interval nano seconds
+// from now
+func NewJob(f JobFunc, interval int64, config BaseConfig) Job {
+	return base.NewJob(f, time.Now().UnixNano(), interval, config)
+}
+
+// NewComponent adapts a DataReader, DataWriter or Checkpointer to Component
+func NewComponent(name string, startable base.Startable) Component {
+	return base.NewComponent(name, startable)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var (
+	_ DataWriter   = &base.StdoutDataWriter{}
+	_ Checkpointer = &base.NullCheckpointer{}
+	_ Job          = &base.BaseJob{}
+)
+
+// The method sets of the interfaces of Version 1, changing them breaks the
+// embedding code and requires a new major version
+var stableMethods = map[string]string{
+	"DataReader":           "IndexData,ReadData,Start,Stop",
+	"CancelableDataReader": "Cancel",
+	"DataWriter":           "Start,Stop,WriteData,WriteDataAsync,WriteDataContext,WriteDataSync",
+	"Checkpointer":         "DeleteCheckpoint,GetCheckpoint,Start,Stop,WriteCheckpoint",
+	"Job": "Callback,ExpirationTime,Id,Interval,Less,ResetFunc,SetIntialExpirationTime,Start,Stop," +
+		"String,UpdateExpirationTime",
+}
+
+func TestStableInterfaces(t *testing.T) {
+	interfaces := map[string]reflect.Type{
+		"DataReader":           reflect.TypeOf((*DataReader)(nil)).Elem(),
+		"CancelableDataReader": reflect.TypeOf((*CancelableDataReader)(nil)).Elem(),
+		"DataWriter":           reflect.TypeOf((*DataWriter)(nil)).Elem(),
+		"Checkpointer":         reflect.TypeOf((*Checkpointer)(nil)).Elem(),
+		"Job":                  reflect.TypeOf((*Job)(nil)).Elem(),
+	}
+
+	for name, typ := range interfaces {
+		var methods []string
+		for i := 0; i < typ.NumMethod(); i++ {
+			methods = append(methods, typ.Method(i).Name)
+		}
+		sort.Strings(methods)
+
+		if got := strings.Join(methods, ","); got != stableMethods[name] {
+			t.Errorf("The methods of %s changed to %s from %s, bump the major Version", name, got, stableMethods[name])
+		}
+	}
+}
+
+func TestNewJob(t *testing.T) {
+	var got BaseConfig
+	config := BaseConfig{base.Metric: "incident"}
+	job := NewJob(func(params JobParam) error {
+		got = params.(BaseConfig)
+		return nil
+	}, 1000, config)
+
+	job.Callback()
+	if job.Interval() != 1000 || got[base.Metric] != "incident" {
+		t.Errorf("Expect the job called with its config, got interval=%d, config=%v", job.Interval(), got)
+	}
+}
+
+func TestNewComponent(t *testing.T) {
+	component := NewComponent("stdout", &base.StdoutDataWriter{})
+	if err := component.Start(); err != nil {
+		t.Errorf("Expect no error, got %s", err)
+	}
+
+	if err := component.Start(); err != ErrAlreadyStarted {
+		t.Errorf("Expect ErrAlreadyStarted, got %v", err)
+	}
+
+	if err := component.Stop(); err != nil || component.Status() != base.LifecycleStopped {
+		t.Errorf("Expect stopped, got %s, error=%v", component.Status(), err)
+	}
+}
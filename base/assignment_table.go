@@ -0,0 +1,130 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	AssignmentRoot = Root + "/assignments"
+
+	defaultReconcileInterval = 30 * time.Second
+)
+
+// Assignment is the collector host a task is desired to run on. Assigned is
+// when Host was assigned, Confirmed when Host last reported the task running
+// in its heartbeats, Resent when the task was last sent to Host again
+// because Host didn't report it
+type Assignment struct {
+	TaskConfigKey string
+	App           string
+	Host          string
+	Assigned      int64 // nano seconds since epoch
+	Confirmed     int64 `json:",omitempty"` // 0 if never reported
+	Resent        int64 `json:",omitempty"`
+}
+
+// Confirm records that Host reported the task running at now
+func (assignment *Assignment) Confirm(now time.Time) {
+	assignment.Confirmed = now.UnixNano()
+}
+
+// Overdue returns true if Host has not reported the task within grace since
+// it was assigned, confirmed or resent last
+func (assignment *Assignment) Overdue(grace time.Duration, now time.Time) bool {
+	last := assignment.Assigned
+	if assignment.Confirmed > last {
+		last = assignment.Confirmed
+	}
+	if assignment.Resent > last {
+		last = assignment.Resent
+	}
+	return now.Sub(time.Unix(0, last)) > grace
+}
+
+// AssignmentTable keeps the desired Assignments of the tasks in ZooKeeper,
+// one persistent node per task under AssignmentRoot, so a scheduler taking
+// the leader role over carries on with the placement of the last one
+type AssignmentTable struct {
+	client *ZooKeeperClient
+}
+
+func NewAssignmentTable(client *ZooKeeperClient) *AssignmentTable {
+	return &AssignmentTable{
+		client: client,
+	}
+}
+
+func assignmentNode(taskKey string) string {
+	return AssignmentRoot + "/" + url.QueryEscape(taskKey)
+}
+
+// Put creates or replaces the assignment of its task
+func (table *AssignmentTable) Put(assignment *Assignment) error {
+	content, err := json.Marshal(assignment)
+	if err != nil {
+		return err
+	}
+
+	node := assignmentNode(assignment.TaskConfigKey)
+	if err := table.client.CreateNode(node, content, false, true); err != nil {
+		return err
+	}
+	return table.client.SetNode(node, content)
+}
+
+// List returns the assignments of all tasks, the malformed ones are skipped
+func (table *AssignmentTable) List() ([]*Assignment, error) {
+	children, err := table.client.Children(AssignmentRoot)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		glog.Errorf("Failed to list task assignments, error=%s", err)
+		return nil, err
+	}
+
+	return decodeAssignments(children, func(child string) ([]byte, error) {
+		return table.client.GetNode(AssignmentRoot+"/"+child, false)
+	})
+}
+
+// decodeAssignments returns the assignments of the children, whose content
+// is got by get. The children deleted since they were listed are skipped
+func decodeAssignments(children []string, get func(child string) ([]byte, error)) ([]*Assignment, error) {
+	var assignments []*Assignment
+	for _, child := range children {
+		content, err := get(child)
+		if err == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		assignment := &Assignment{}
+		if err := json.Unmarshal(content, assignment); err != nil || assignment.TaskConfigKey == "" {
+			glog.Warningf("Skip the malformed assignment=%s", child)
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+// Delete drops the assignment of the task of taskKey
+func (table *AssignmentTable) Delete(taskKey string) error {
+	return table.client.DeleteNode(assignmentNode(taskKey), true)
+}
+
+// GetReconcileInterval returns ReconcileInterval in seconds in the config,
+// default to 30
+func GetReconcileInterval(config BaseConfig) time.Duration {
+	seconds, err := strconv.Atoi(config[ReconcileInterval])
+	if err != nil || seconds <= 0 {
+		return defaultReconcileInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,59 @@
+package base
+
+import (
+	"errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"testing"
+	"time"
+)
+
+func TestAssignmentOverdue(t *testing.T) {
+	start := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	assignment := &Assignment{TaskConfigKey: "incident", Host: "collector1", Assigned: start.UnixNano()}
+	if assignment.Overdue(time.Minute, start.Add(30*time.Second)) {
+		t.Errorf("Expect a new assignment not overdue within grace")
+	}
+
+	if !assignment.Overdue(time.Minute, start.Add(2*time.Minute)) {
+		t.Errorf("Expect an assignment never reported overdue after grace")
+	}
+
+	assignment.Confirm(start.Add(90 * time.Second))
+	if assignment.Overdue(time.Minute, start.Add(2*time.Minute)) {
+		t.Errorf("Expect a confirmed assignment not overdue")
+	}
+
+	assignment.Resent = start.Add(5 * time.Minute).UnixNano()
+	if assignment.Overdue(time.Minute, start.Add(5*time.Minute+30*time.Second)) {
+		t.Errorf("Expect a resent assignment not overdue within grace")
+	}
+
+	if interval := GetReconcileInterval(BaseConfig{ReconcileInterval: "x"}); interval != 30*time.Second {
+		t.Errorf("Expect ReconcileInterval defaults to 30s, got %s", interval)
+	}
+}
+
+func TestDecodeAssignments(t *testing.T) {
+	nodes := map[string][]byte{
+		"incident":  []byte(`{"TaskConfigKey":"incident","Host":"collector1"}`),
+		"malformed": []byte(`{`),
+		"problem":   []byte(`{"TaskConfigKey":"problem","Host":"collector2"}`),
+	}
+	get := func(child string) ([]byte, error) {
+		if content, ok := nodes[child]; ok {
+			return content, nil
+		}
+		return nil, zk.ErrNoNode
+	}
+
+	// change was deleted after being listed
+	assignments, err := decodeAssignments([]string{"incident", "change", "malformed", "problem"}, get)
+	if err != nil || len(assignments) != 2 || assignments[0].Host != "collector1" || assignments[1].Host != "collector2" {
+		t.Errorf("Expect the deleted and the malformed assignments skipped, got %v, error=%v", assignments, err)
+	}
+
+	failure := errors.New("connection closed")
+	if _, err := decodeAssignments([]string{"incident"}, func(string) ([]byte, error) { return nil, failure }); err != failure {
+		t.Errorf("Expect the other errors returned, got %v", err)
+	}
+}
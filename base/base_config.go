@@ -2,9 +2,15 @@ package base
 
 type BaseConfig map[string]string
 
+// Data
+// Records optionally carries RawData parsed as JSON objects, so that
+// transforms don't re-unmarshal the same RawData again and again. Records are
+// not serialized along with Data, the final sink calls Serialize once to
+// turn them back into RawData
 type Data struct {
 	MetaInfo map[string]string
 	RawData  [][]byte
+	Records  []map[string]interface{} `json:"-"`
 }
 
 func NewData(metaInfo map[string]string, rawData [][]byte) *Data {
@@ -13,3 +19,75 @@ func NewData(metaInfo map[string]string, rawData [][]byte) *Data {
 		RawData:  rawData,
 	}
 }
+
+// NewRecordData creates Data with parsed records only, RawData is filled
+// by Serialize
+func NewRecordData(metaInfo map[string]string, records []map[string]interface{}) *Data {
+	return &Data{
+		MetaInfo: metaInfo,
+		Records:  records,
+	}
+}
+
+// Len returns the number of records
+func (data *Data) Len() int {
+	if data.RawData == nil {
+		return len(data.Records)
+	}
+	return len(data.RawData)
+}
+
+// ParseRecords returns Records, RawData is parsed on the first call by the
+// Format in MetaInfo Serialization, JSON by default
+func (data *Data) ParseRecords() ([]map[string]interface{}, error) {
+	if data.Records != nil || data.RawData == nil {
+		return data.Records, nil
+	}
+
+	format, err := dataFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]map[string]interface{}, 0, len(data.RawData))
+	for _, rawData := range data.RawData {
+		record, err := format.Decode(rawData)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	data.Records = records
+	return records, nil
+}
+
+// SetRecords replaces the records, RawData is stale and dropped. Transforms
+// which modify the records in place shall call it as well
+func (data *Data) SetRecords(records []map[string]interface{}) {
+	data.Records = records
+	data.RawData = nil
+}
+
+// Serialize fills RawData from Records in the Format of MetaInfo
+// Serialization if RawData is stale
+func (data *Data) Serialize() error {
+	if data.RawData != nil || data.Records == nil {
+		return nil
+	}
+
+	format, err := dataFormat(data)
+	if err != nil {
+		return err
+	}
+
+	rawData := make([][]byte, 0, len(data.Records))
+	for _, record := range data.Records {
+		raw, err := format.Encode(record)
+		if err != nil {
+			return err
+		}
+		rawData = append(rawData, raw)
+	}
+	data.RawData = rawData
+	return nil
+}
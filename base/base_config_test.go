@@ -0,0 +1,34 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestDataRecords(t *testing.T) {
+	data := NewData(nil, [][]byte{[]byte(`{"number":"INC1","state":"open"}`), []byte(`{"number":"INC2"}`)})
+	records, err := data.ParseRecords()
+	if err != nil || len(records) != 2 || records[0]["number"] != "INC1" {
+		t.Errorf("Failed to parse records, got=%v, error=%v", records, err)
+		return
+	}
+
+	// Parsed once
+	data.RawData[0] = []byte("garbage")
+	if again, _ := data.ParseRecords(); again[0]["number"] != "INC1" {
+		t.Errorf("Expect cached records, got=%v", again)
+	}
+
+	records[1]["state"] = "closed"
+	data.SetRecords(records)
+	if data.RawData != nil || data.Len() != 2 {
+		t.Errorf("Expect stale RawData dropped, got=%s, len=%d", data.RawData, data.Len())
+	}
+
+	if err := data.Serialize(); err != nil || string(data.RawData[1]) != `{"number":"INC2","state":"closed"}` {
+		t.Errorf("Failed to serialize records, got=%s, error=%v", data.RawData, err)
+	}
+
+	if _, err := NewData(nil, [][]byte{[]byte("k=v")}).ParseRecords(); err == nil {
+		t.Errorf("Expect error for non-JSON raw data")
+	}
+}
@@ -0,0 +1,237 @@
+package base
+
+import (
+	"context"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchFlushInterval = time.Second
+)
+
+// BatchingDataWriter amortizes the writes of the wrapped DataWriter by
+// merging the data written asynchronously into batches. A writer shared by
+// several sources, for e.g. the tables of CompositeMetrics, gets data of
+// different MetaInfo, which a batch can't attribute to its records, so the
+// data are batched by their MetaInfo, the per batch BatchSeq and RecordSeq
+// aside. A batch keeps the sequence numbers of its first data, the records
+// of a task are written in order so RecordSeq+i still numbers them.
+// A batch is flushed once it has BatchMaxRecords records, every
+// BatchFlushInterval and on Stop. The sync writes flush the batch of their
+// MetaInfo along with their data, so they are not reordered before the
+// data written asynchronously. WriteData and WriteDataContext honor
+// SyncWrite like the sinks
+type BatchingDataWriter struct {
+	DataWriter
+	maxRecords int
+	interval   time.Duration
+	syncWrite  bool             // SyncWrite "0" like the sinks
+	batches    map[string]*Data // batch key indexed
+	order      []string         // batch keys in the order they were created
+	done       chan struct{}
+	stopped    sync.WaitGroup
+	lockGuard  sync.Mutex
+}
+
+// NewBatchingDataWriter
+// @config: contains BatchMaxRecords, writer is returned as is if it is not
+// positive, and BatchFlushInterval, for e.g. "500ms", 1s by default
+func NewBatchingDataWriter(writer DataWriter, config BaseConfig) DataWriter {
+	maxRecords, _ := strconv.Atoi(config[BatchMaxRecords])
+	if maxRecords <= 0 {
+		return writer
+	}
+
+	interval := defaultBatchFlushInterval
+	if config[BatchFlushInterval] != "" {
+		d, err := time.ParseDuration(config[BatchFlushInterval])
+		if err != nil || d <= 0 {
+			glog.Errorf("Invalid %s=%s, flush every %s", BatchFlushInterval, config[BatchFlushInterval], interval)
+		} else {
+			interval = d
+		}
+	}
+
+	return &BatchingDataWriter{
+		DataWriter: writer,
+		maxRecords: maxRecords,
+		interval:   interval,
+		syncWrite:  config[SyncWrite] == "0",
+		batches:    make(map[string]*Data),
+	}
+}
+
+func (writer *BatchingDataWriter) Start() {
+	writer.DataWriter.Start()
+
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+	if writer.done != nil {
+		return
+	}
+
+	writer.done = make(chan struct{})
+	writer.stopped.Add(1)
+	go writer.flushPeriodically(writer.done)
+}
+
+// Stop flushes the batches before the wrapped writer is stopped
+func (writer *BatchingDataWriter) Stop() {
+	writer.lockGuard.Lock()
+	done := writer.done
+	writer.done = nil
+	writer.lockGuard.Unlock()
+
+	if done != nil {
+		close(done)
+		writer.stopped.Wait()
+	}
+	writer.flush()
+	writer.DataWriter.Stop()
+}
+
+func (writer *BatchingDataWriter) flushPeriodically(done chan struct{}) {
+	defer writer.stopped.Done()
+
+	ticker := time.NewTicker(writer.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			writer.flush()
+		case <-done:
+			return
+		}
+	}
+}
+
+// flush writes all batches in the order they were created
+func (writer *BatchingDataWriter) flush() {
+	writer.lockGuard.Lock()
+	batches := make([]*Data, 0, len(writer.order))
+	for _, key := range writer.order {
+		batches = append(batches, writer.batches[key])
+	}
+	writer.batches = make(map[string]*Data)
+	writer.order = writer.order[:0]
+	writer.lockGuard.Unlock()
+
+	for _, batch := range batches {
+		if err := writer.DataWriter.WriteData(batch); err != nil {
+			glog.Errorf("Failed to flush a batch of %d records of %s, error=%s", batch.Len(), batch.MetaInfo[Metric], err)
+		}
+	}
+}
+
+// batchKey returns MetaInfo in "k=v" format sorted by k, BatchSeq and
+// RecordSeq aside
+func batchKey(metaInfo map[string]string) string {
+	parts := make([]string, 0, len(metaInfo))
+	for k, v := range metaInfo {
+		if k != BatchSeq && k != RecordSeq {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x00")
+}
+
+// add appends data to its batch, and returns the batch if it is full or
+// take is true, it is then removed
+func (writer *BatchingDataWriter) add(data *Data, take bool) *Data {
+	key := batchKey(data.MetaInfo)
+
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+
+	batch, ok := writer.batches[key]
+	if !ok {
+		metaInfo := make(map[string]string, len(data.MetaInfo))
+		for k, v := range data.MetaInfo {
+			metaInfo[k] = v
+		}
+		// The caller may reuse RawData, it is copied
+		batch = NewData(metaInfo, make([][]byte, 0, len(data.RawData)))
+	}
+	batch.RawData = append(batch.RawData, data.RawData...)
+
+	if !take && len(batch.RawData) < writer.maxRecords {
+		if !ok {
+			writer.batches[key] = batch
+			writer.order = append(writer.order, key)
+		}
+		return nil
+	}
+
+	if ok {
+		delete(writer.batches, key)
+		for i, k := range writer.order {
+			if k == key {
+				writer.order = append(writer.order[:i], writer.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return batch
+}
+
+func (writer *BatchingDataWriter) WriteData(data *Data) error {
+	if writer.syncWrite {
+		return writer.WriteDataSync(data)
+	}
+	return writer.writeAsync(data, writer.DataWriter.WriteData)
+}
+
+func (writer *BatchingDataWriter) WriteDataAsync(data *Data) error {
+	return writer.writeAsync(data, writer.DataWriter.WriteDataAsync)
+}
+
+func (writer *BatchingDataWriter) writeAsync(data *Data, write func(data *Data) error) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+
+	if batch := writer.add(data, false); batch != nil {
+		return write(batch)
+	}
+	return nil
+}
+
+func (writer *BatchingDataWriter) WriteDataSync(data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataSync(writer.add(data, true))
+}
+
+func (writer *BatchingDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	write := func(batch *Data) error {
+		return writer.DataWriter.WriteDataContext(ctx, batch)
+	}
+
+	if !writer.syncWrite {
+		return writer.writeAsync(data, write)
+	}
+
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return write(writer.add(data, true))
+}
+
+// Pending returns the number of records waiting in the batches
+func (writer *BatchingDataWriter) Pending() int {
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+
+	pending := 0
+	for _, batch := range writer.batches {
+		pending += len(batch.RawData)
+	}
+	return pending
+}
@@ -0,0 +1,43 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestBatchingDataWriter(t *testing.T) {
+	if writer := NewBatchingDataWriter(nil, BaseConfig{}); writer != nil {
+		t.Errorf("Expect the writer as is without BatchMaxRecords")
+	}
+
+	recorder := &recordingDataWriter{}
+	writer := NewBatchingDataWriter(recorder, BaseConfig{BatchMaxRecords: "3", BatchFlushInterval: "1h"})
+
+	incident := func(seq string, record string) *Data {
+		return NewData(map[string]string{Metric: "incident", BatchSeq: seq, RecordSeq: seq}, [][]byte{[]byte(record)})
+	}
+	problem := NewData(map[string]string{Metric: "problem", BatchSeq: "1", RecordSeq: "1"}, [][]byte{[]byte("p1")})
+
+	writer.WriteData(incident("1", "i1"))
+	writer.WriteData(problem)
+	writer.WriteData(incident("2", "i2"))
+	if len(recorder.data) != 0 || writer.(*BatchingDataWriter).Pending() != 3 {
+		t.Fatalf("Expect the records batched, got %d writes", len(recorder.data))
+	}
+
+	// The incident batch is full
+	writer.WriteData(incident("3", "i3"))
+	if len(recorder.data) != 1 {
+		t.Fatalf("Expect the full batch written, got %d writes", len(recorder.data))
+	}
+
+	batch := recorder.data[0]
+	if batch.MetaInfo[Metric] != "incident" || batch.MetaInfo[RecordSeq] != "1" || len(batch.RawData) != 3 ||
+		string(batch.RawData[2]) != "i3" {
+		t.Errorf("Expect the incident records in one batch with the sequence of the first, got %+v", batch)
+	}
+
+	writer.Stop()
+	if len(recorder.data) != 2 || recorder.data[1].MetaInfo[Metric] != "problem" || len(recorder.data[1].RawData) != 1 {
+		t.Errorf("Expect the problem batch flushed on stop, got %d writes", len(recorder.data))
+	}
+}
@@ -0,0 +1,82 @@
+package base
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// BloomFilter is a compact set of strings with false positives at the rate
+// it is sized for and no false negatives. It is marshalled to JSON as is, so
+// it can be kept in a checkpoint
+type BloomFilter struct {
+	M    uint32 // bits
+	K    uint32 // hashes per key
+	Bits []byte
+}
+
+// NewBloomFilter
+// @n: the number of keys expected, the false positive rate grows beyond it
+// @falsePositiveRate: in (0, 1)
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n <= 0 {
+		n = 1
+	}
+
+	m := uint32(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		M:    m,
+		K:    k,
+		Bits: make([]byte, (m+7)/8),
+	}
+}
+
+// hashes returns the two hashes of key which derive the K bit positions
+func (filter *BloomFilter) hashes(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+func (filter *BloomFilter) Add(key string) {
+	h1, h2 := filter.hashes(key)
+	for i := uint32(0); i < filter.K; i++ {
+		bit := (h1 + i*h2) % filter.M
+		filter.Bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test returns true if key may have been added, false if it has not
+func (filter *BloomFilter) Test(key string) bool {
+	if filter.M == 0 || len(filter.Bits) < int((filter.M+7)/8) {
+		return false
+	}
+
+	h1, h2 := filter.hashes(key)
+	for i := uint32(0); i < filter.K; i++ {
+		bit := (h1 + i*h2) % filter.M
+		if filter.Bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (filter *BloomFilter) Clone() *BloomFilter {
+	bits := make([]byte, len(filter.Bits))
+	copy(bits, filter.Bits)
+	return &BloomFilter{
+		M:    filter.M,
+		K:    filter.K,
+		Bits: bits,
+	}
+}
@@ -0,0 +1,50 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("added%d", i))
+	}
+
+	data, err := json.Marshal(filter)
+	if err != nil {
+		t.Fatalf("Failed to marshal filter, error=%s", err)
+	}
+
+	var restored BloomFilter
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal filter, error=%s", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !restored.Test(fmt.Sprintf("added%d", i)) {
+			t.Fatalf("Expect no false negative, key=added%d", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if restored.Test(fmt.Sprintf("other%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("Expect about 1%% false positives, got %d of 10000", falsePositives)
+	}
+
+	clone := filter.Clone()
+	clone.Bits[0] ^= 0xff
+	if clone.Bits[0] == filter.Bits[0] {
+		t.Errorf("Expect the clone independent of the filter")
+	}
+
+	if (&BloomFilter{}).Test("x") {
+		t.Errorf("Expect the empty filter contains nothing")
+	}
+}
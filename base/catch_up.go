@@ -0,0 +1,36 @@
+package base
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// Topic of the sources which start or stop catching up, see
+	// CatchUp.Event
+	CatchUpTopic = "CatchUp"
+)
+
+// CatchUp is a source which started catching up because it lags behind by
+// more than CatchUpLag, collecting RecordCount records per request until the
+// lag is cleared, or which stopped then
+type CatchUp struct {
+	Key         string
+	ServerURL   string
+	Metric      string
+	CatchingUp  bool
+	Lag         time.Duration
+	RecordCount int // per request from then on
+}
+
+// Event returns the change as a CatchUpTopic event, Lag in seconds
+func (catchUp *CatchUp) Event() BaseConfig {
+	return BaseConfig{
+		Key:           catchUp.Key,
+		ServerURL:     catchUp.ServerURL,
+		Metric:        catchUp.Metric,
+		"CatchingUp":  strconv.FormatBool(catchUp.CatchingUp),
+		"Lag":         strconv.FormatInt(int64(catchUp.Lag/time.Second), 10),
+		"RecordCount": strconv.Itoa(catchUp.RecordCount),
+	}
+}
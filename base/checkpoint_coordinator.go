@@ -0,0 +1,169 @@
+package base
+
+import (
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+)
+
+const (
+	maxPendingCheckpoints = 1024
+)
+
+type pendingCheckpoint struct {
+	seq     int64
+	keyInfo map[string]string
+	value   []byte
+}
+
+// CheckpointCoordinator advances a checkpoint shared by several sinks only
+// after a quorum of them have acknowledged the data written before it.
+// Each sink reports its high-water mark, which is the sequence number of the
+// last data it has written. Failed sinks are excluded from the quorum, and at
+// most maxPendingCheckpoints checkpoints are queued, the oldest ones are
+// dropped since a later checkpoint covers them
+type CheckpointCoordinator struct {
+	checkpoint Checkpointer
+	quorum     int
+	marks      map[string]int64 // sink name indexed
+	failed     map[string]bool  // sink name indexed
+	pendings   []pendingCheckpoint
+	lockGuard  sync.Mutex
+}
+
+// NewCheckpointCoordinator
+// @sinks: names of the sinks which acknowledge
+// @quorum: number of sinks which shall acknowledge before the checkpoint is
+// advanced, all sinks if it is not positive or bigger than len(sinks)
+func NewCheckpointCoordinator(checkpoint Checkpointer, sinks []string, quorum int) *CheckpointCoordinator {
+	if quorum <= 0 || quorum > len(sinks) {
+		quorum = len(sinks)
+	}
+
+	marks := make(map[string]int64, len(sinks))
+	for _, sink := range sinks {
+		marks[sink] = 0
+	}
+
+	return &CheckpointCoordinator{
+		checkpoint: checkpoint,
+		quorum:     quorum,
+		marks:      marks,
+		failed:     make(map[string]bool),
+	}
+}
+
+// Propose queues a checkpoint which covers the data up to seq. It is
+// written through once a quorum of sinks have acknowledged seq
+func (coord *CheckpointCoordinator) Propose(keyInfo map[string]string, value []byte, seq int64) error {
+	coord.lockGuard.Lock()
+	defer coord.lockGuard.Unlock()
+
+	coord.pendings = append(coord.pendings, pendingCheckpoint{seq, keyInfo, value})
+	if n := len(coord.pendings) - maxPendingCheckpoints; n > 0 {
+		glog.Warningf("Checkpoint is stalled at seq=%d, drop %d pending checkpoints, high-water marks=%v",
+			coord.watermark(), n, coord.marks)
+		coord.pendings = coord.pendings[n:]
+	}
+	return coord.commit()
+}
+
+// Ack records that sink has written all of its data up to seq
+func (coord *CheckpointCoordinator) Ack(sink string, seq int64) error {
+	coord.lockGuard.Lock()
+	defer coord.lockGuard.Unlock()
+
+	if mark, ok := coord.marks[sink]; !ok || seq <= mark {
+		return nil
+	}
+	coord.marks[sink] = seq
+	return coord.commit()
+}
+
+// Fail excludes sink from the quorum, it doesn't acknowledge any more
+func (coord *CheckpointCoordinator) Fail(sink string) error {
+	coord.lockGuard.Lock()
+	defer coord.lockGuard.Unlock()
+
+	if _, ok := coord.marks[sink]; !ok || coord.failed[sink] {
+		return nil
+	}
+	coord.failed[sink] = true
+	glog.Warningf("Sink=%s is excluded from checkpoint quorum, %d of %d sinks left",
+		sink, len(coord.marks)-len(coord.failed), len(coord.marks))
+	return coord.commit()
+}
+
+// HighWaterMarks returns a copy of the per sink high-water marks
+func (coord *CheckpointCoordinator) HighWaterMarks() map[string]int64 {
+	coord.lockGuard.Lock()
+	defer coord.lockGuard.Unlock()
+
+	marks := make(map[string]int64, len(coord.marks))
+	for sink, mark := range coord.marks {
+		marks[sink] = mark
+	}
+	return marks
+}
+
+// watermark returns the highest seq which a quorum of the sinks which have
+// not failed have reached
+func (coord *CheckpointCoordinator) watermark() int64 {
+	marks := make([]int64, 0, len(coord.marks))
+	for sink, mark := range coord.marks {
+		if !coord.failed[sink] {
+			marks = append(marks, mark)
+		}
+	}
+
+	if len(marks) == 0 {
+		return 0
+	}
+
+	quorum := coord.quorum
+	if quorum > len(marks) {
+		quorum = len(marks)
+	}
+	sort.Sort(sort.Reverse(int64Slice(marks)))
+	return marks[quorum-1]
+}
+
+// commit writes the latest pending checkpoint which is covered by
+// the watermark, and drops the older ones
+func (coord *CheckpointCoordinator) commit() error {
+	watermark := coord.watermark()
+	idx := -1
+	for i, pending := range coord.pendings {
+		if pending.seq > watermark {
+			break
+		}
+		idx = i
+	}
+
+	if idx < 0 {
+		return nil
+	}
+
+	pending := coord.pendings[idx]
+	err := coord.checkpoint.WriteCheckpoint(pending.keyInfo, pending.value)
+	if err != nil {
+		glog.Errorf("Failed to write coordinated checkpoint at seq=%d, error=%s", pending.seq, err)
+		return err
+	}
+	coord.pendings = coord.pendings[idx+1:]
+	return nil
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int {
+	return len(s)
+}
+
+func (s int64Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s int64Slice) Less(i, j int) bool {
+	return s[i] < s[j]
+}
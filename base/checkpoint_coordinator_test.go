@@ -0,0 +1,72 @@
+package base
+
+import (
+	"testing"
+)
+
+type recordingCheckpointer struct {
+	NullCheckpointer
+	values []string
+}
+
+func (ck *recordingCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	ck.values = append(ck.values, string(value))
+	return nil
+}
+
+func TestCheckpointCoordinator(t *testing.T) {
+	ck := &recordingCheckpointer{}
+	coord := NewCheckpointCoordinator(ck, []string{"splunk", "s3", "kafka"}, 2)
+	keyInfo := map[string]string{Key: "/topic/0"}
+
+	coord.Propose(keyInfo, []byte("ckpt1"), 1)
+	coord.Propose(keyInfo, []byte("ckpt3"), 3)
+	if len(ck.values) != 0 {
+		t.Errorf("Checkpoint should not advance before acknowledgement, got=%s", ck.values)
+	}
+
+	coord.Ack("splunk", 3)
+	if len(ck.values) != 0 {
+		t.Errorf("Checkpoint should not advance before a quorum acknowledges, got=%s", ck.values)
+	}
+
+	coord.Ack("s3", 2)
+	if len(ck.values) != 1 || ck.values[0] != "ckpt1" {
+		t.Errorf("Expect ckpt1 committed by the slowest sink in quorum, got=%s", ck.values)
+	}
+
+	coord.Ack("kafka", 3)
+	if len(ck.values) != 2 || ck.values[1] != "ckpt3" {
+		t.Errorf("Expect ckpt3 committed, got=%s", ck.values)
+	}
+
+	coord.Ack("unknown", 10)
+	if marks := coord.HighWaterMarks(); len(marks) != 3 || marks["s3"] != 2 {
+		t.Errorf("Unexpected high-water marks=%v", marks)
+	}
+}
+
+func TestCheckpointCoordinatorFailedSink(t *testing.T) {
+	ck := &recordingCheckpointer{}
+	coord := NewCheckpointCoordinator(ck, []string{"splunk", "s3"}, 0)
+	keyInfo := map[string]string{Key: "/topic/0"}
+
+	for seq := int64(1); seq <= maxPendingCheckpoints+10; seq++ {
+		coord.Propose(keyInfo, []byte("ckpt"), seq)
+		coord.Ack("splunk", seq)
+	}
+
+	if len(ck.values) != 0 {
+		t.Errorf("Checkpoint should not advance before all sinks acknowledge, got=%d", len(ck.values))
+	}
+
+	if len(coord.pendings) != maxPendingCheckpoints {
+		t.Errorf("Expect pending checkpoints capped at %d, got %d", maxPendingCheckpoints, len(coord.pendings))
+	}
+
+	coord.Fail("s3")
+	if len(ck.values) != 1 || len(coord.pendings) != 0 {
+		t.Errorf("Expect the latest checkpoint committed once s3 is excluded, got=%d pendings=%d",
+			len(ck.values), len(coord.pendings))
+	}
+}
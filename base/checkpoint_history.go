@@ -0,0 +1,309 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CheckpointTransition actions
+	CheckpointWritten    = "write"
+	CheckpointDeleted    = "delete"
+	CheckpointRolledBack = "rollback"
+
+	checkpointHistoryPartition = time.Hour
+	defaultCheckpointRetention = 24 // partitions
+	// Transitions kept per checkpoint and partition, the oldest are dropped
+	checkpointHistoryPartitionSize = 120
+)
+
+// ErrCheckpointHistoryNotFound is returned when rolling back to a time before
+// the history of the checkpoint
+var ErrCheckpointHistoryNotFound = errors.New("no checkpoint history")
+
+// CheckpointTransition is a change of a checkpoint, Value is the checkpoint
+// after the change
+type CheckpointTransition struct {
+	Key           string // Key of the checkpoint, CheckpointKey if it is not set
+	TaskConfigKey string
+	Time          int64 // nano seconds since epoch
+	Action        string
+	Value         string
+}
+
+// CheckpointHistory keeps the transitions of the checkpoints written by the
+// HistoryCheckpointers of the process in hourly partitions, the last
+// CheckpointRetention of them are kept. With a MetadataStore, the
+// partitions survive restarts
+type CheckpointHistory struct {
+	retention  int
+	partitions map[string]map[int64][]CheckpointTransition // checkpoint key, partition start indexed
+	tasks      map[string]string                           // checkpoint key indexed TaskConfigKey
+	keyInfos   map[string]map[string]string                // checkpoint key indexed, to roll back
+	writers    map[string]Checkpointer                     // checkpoint key indexed, to roll back
+	store      *MetadataStore
+	lockGuard  sync.Mutex
+}
+
+// NewCheckpointHistory
+// @config: CheckpointRetention in hours, 24 by default
+func NewCheckpointHistory(config BaseConfig) *CheckpointHistory {
+	retention, err := strconv.Atoi(config[CheckpointRetention])
+	if err != nil || retention <= 0 {
+		retention = defaultCheckpointRetention
+	}
+
+	return &CheckpointHistory{
+		retention:  retention,
+		partitions: make(map[string]map[int64][]CheckpointTransition),
+		tasks:      make(map[string]string),
+		keyInfos:   make(map[string]map[string]string),
+		writers:    make(map[string]Checkpointer),
+	}
+}
+
+// SetStore persists the partitions in the MetadataCheckpoints bucket of
+// store and loads those persisted before
+func (history *CheckpointHistory) SetStore(store *MetadataStore) {
+	history.lockGuard.Lock()
+	defer history.lockGuard.Unlock()
+
+	history.store = store
+	err := store.ForEach(MetadataCheckpoints, func(key string, value []byte) error {
+		var transitions []CheckpointTransition
+		if err := json.Unmarshal(value, &transitions); err != nil || len(transitions) == 0 {
+			glog.Errorf("Unexpected checkpoint history=%s in metadata store", key)
+			return nil
+		}
+
+		partition := history.partitionOf(transitions[0].Key)
+		partition[partitionStart(transitions[0].Time)] = transitions
+		history.tasks[transitions[0].Key] = transitions[0].TaskConfigKey
+		return nil
+	})
+
+	if err != nil {
+		glog.Errorf("Failed to load checkpoint history from metadata store, error=%s", err)
+	}
+	history.expire(time.Now())
+}
+
+// Record appends a transition of checkpoint ck with keyInfo
+func (history *CheckpointHistory) Record(ck Checkpointer, keyInfo map[string]string, action string, value []byte) {
+	transition := CheckpointTransition{
+		Key:           historyKey(keyInfo),
+		TaskConfigKey: keyInfo[TaskConfigKey],
+		Time:          time.Now().UnixNano(),
+		Action:        action,
+		Value:         string(value),
+	}
+
+	history.lockGuard.Lock()
+	defer history.lockGuard.Unlock()
+
+	history.tasks[transition.Key] = transition.TaskConfigKey
+	history.keyInfos[transition.Key] = keyInfo
+	history.writers[transition.Key] = ck
+
+	partition := history.partitionOf(transition.Key)
+	start := partitionStart(transition.Time)
+	transitions := append(partition[start], transition)
+	if len(transitions) > checkpointHistoryPartitionSize {
+		transitions = transitions[len(transitions)-checkpointHistoryPartitionSize:]
+	}
+	partition[start] = transitions
+
+	if history.store != nil {
+		history.persist(transition.Key, start, transitions)
+	}
+
+	// A partition started
+	if len(transitions) == 1 {
+		history.expire(time.Now())
+	}
+}
+
+// Transitions returns the transitions of the checkpoint key in [from, to),
+// oldest first. A zero to is now
+func (history *CheckpointHistory) Transitions(key string, from, to time.Time) []CheckpointTransition {
+	if to.IsZero() {
+		to = time.Now().Add(time.Nanosecond)
+	}
+
+	history.lockGuard.Lock()
+	defer history.lockGuard.Unlock()
+
+	var res []CheckpointTransition
+	for _, transitions := range history.partitions[key] {
+		for _, transition := range transitions {
+			if transition.Time >= from.UnixNano() && transition.Time < to.UnixNano() {
+				res = append(res, transition)
+			}
+		}
+	}
+	sort.Sort(checkpointTransitionSorter(res))
+	return res
+}
+
+// Keys returns the checkpoint keys with history, of task if it is not empty
+func (history *CheckpointHistory) Keys(task string) []string {
+	history.lockGuard.Lock()
+	defer history.lockGuard.Unlock()
+
+	var keys []string
+	for key := range history.partitions {
+		if task == "" || history.tasks[key] == task {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Task returns the TaskConfigKey of the checkpoint key
+func (history *CheckpointHistory) Task(key string) string {
+	history.lockGuard.Lock()
+	defer history.lockGuard.Unlock()
+	return history.tasks[key]
+}
+
+// Rollback writes the checkpoint of key as it was at the time at, through
+// the checkpointer which wrote it last in the process. The reader of the
+// checkpoint shall be stopped before, otherwise it overwrites the rollback
+// with its state
+func (history *CheckpointHistory) Rollback(key string, at time.Time) (*CheckpointTransition, error) {
+	var target *CheckpointTransition
+	for _, transition := range history.Transitions(key, time.Time{}, at.Add(time.Nanosecond)) {
+		t := transition
+		target = &t
+	}
+
+	if target == nil || target.Action == CheckpointDeleted {
+		return nil, fmt.Errorf("%w, key=%s has no checkpoint at %s", ErrCheckpointHistoryNotFound, key, at.Format(time.RFC3339))
+	}
+
+	history.lockGuard.Lock()
+	ck, keyInfo := history.writers[key], history.keyInfos[key]
+	history.lockGuard.Unlock()
+	if ck == nil {
+		return nil, fmt.Errorf("%w, key=%s is not written by this process", ErrCheckpointHistoryNotFound, key)
+	}
+
+	if err := ck.WriteCheckpoint(keyInfo, []byte(target.Value)); err != nil {
+		return nil, err
+	}
+	glog.Warningf("Audit: rolled back checkpoint key=%s to %s", key, time.Unix(0, target.Time).Format(time.RFC3339Nano))
+	history.Record(ck, keyInfo, CheckpointRolledBack, []byte(target.Value))
+	return target, nil
+}
+
+// partitionOf shall be called with lockGuard held
+func (history *CheckpointHistory) partitionOf(key string) map[int64][]CheckpointTransition {
+	partition, ok := history.partitions[key]
+	if !ok {
+		partition = make(map[int64][]CheckpointTransition)
+		history.partitions[key] = partition
+	}
+	return partition
+}
+
+// expire drops the partitions beyond the retention, shall be called with
+// lockGuard held
+func (history *CheckpointHistory) expire(now time.Time) {
+	oldest := partitionStart(now.UnixNano()) - int64(history.retention-1)*int64(checkpointHistoryPartition)
+	for key, partition := range history.partitions {
+		for start := range partition {
+			if start >= oldest {
+				continue
+			}
+
+			delete(partition, start)
+			if history.store != nil {
+				history.store.Delete(MetadataCheckpoints, partitionStoreKey(key, start))
+			}
+		}
+
+		if len(partition) == 0 {
+			delete(history.partitions, key)
+			delete(history.tasks, key)
+		}
+	}
+}
+
+func (history *CheckpointHistory) persist(key string, start int64, transitions []CheckpointTransition) {
+	value, err := json.Marshal(transitions)
+	if err != nil {
+		glog.Errorf("Failed to marshal checkpoint history of key=%s, error=%s", key, err)
+		return
+	}
+
+	if err := history.store.Put(MetadataCheckpoints, partitionStoreKey(key, start), value); err != nil {
+		glog.Errorf("Failed to persist checkpoint history of key=%s, error=%s", key, err)
+	}
+}
+
+func partitionStart(t int64) int64 {
+	return t - t%int64(checkpointHistoryPartition)
+}
+
+func partitionStoreKey(key string, start int64) string {
+	return key + "|" + strconv.FormatInt(start, 10)
+}
+
+func historyKey(keyInfo map[string]string) string {
+	if keyInfo[Key] != "" {
+		return keyInfo[Key]
+	}
+	return strings.TrimSpace(keyInfo[CheckpointKey])
+}
+
+// HistoryCheckpointer records the checkpoint transitions of the wrapped
+// Checkpointer in a CheckpointHistory
+type HistoryCheckpointer struct {
+	Checkpointer
+	history *CheckpointHistory
+}
+
+func NewHistoryCheckpointer(checkpoint Checkpointer, history *CheckpointHistory) *HistoryCheckpointer {
+	return &HistoryCheckpointer{
+		Checkpointer: checkpoint,
+		history:      history,
+	}
+}
+
+func (ck *HistoryCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	if err := ck.Checkpointer.WriteCheckpoint(keyInfo, value); err != nil {
+		return err
+	}
+	ck.history.Record(ck.Checkpointer, keyInfo, CheckpointWritten, value)
+	return nil
+}
+
+func (ck *HistoryCheckpointer) DeleteCheckpoint(keyInfo map[string]string) error {
+	if err := ck.Checkpointer.DeleteCheckpoint(keyInfo); err != nil {
+		return err
+	}
+	ck.history.Record(ck.Checkpointer, keyInfo, CheckpointDeleted, nil)
+	return nil
+}
+
+type checkpointTransitionSorter []CheckpointTransition
+
+func (transitions checkpointTransitionSorter) Len() int {
+	return len(transitions)
+}
+
+func (transitions checkpointTransitionSorter) Swap(i, j int) {
+	transitions[i], transitions[j] = transitions[j], transitions[i]
+}
+
+func (transitions checkpointTransitionSorter) Less(i, j int) bool {
+	return transitions[i].Time < transitions[j].Time
+}
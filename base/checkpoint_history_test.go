@@ -0,0 +1,52 @@
+package base
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckpointHistory(t *testing.T) {
+	history := NewCheckpointHistory(BaseConfig{CheckpointRetention: "2"})
+	inner := &recordingCheckpointer{}
+	ck := NewHistoryCheckpointer(inner, history)
+	keyInfo := map[string]string{Key: "/snow/incident", TaskConfigKey: "snow_incident"}
+
+	ck.WriteCheckpoint(keyInfo, []byte("ckpt1"))
+	time.Sleep(time.Millisecond)
+	middle := time.Now()
+	ck.WriteCheckpoint(keyInfo, []byte("ckpt2"))
+
+	transitions := history.Transitions("/snow/incident", time.Time{}, time.Time{})
+	if len(transitions) != 2 || transitions[0].Value != "ckpt1" || transitions[1].Action != CheckpointWritten {
+		t.Fatalf("Expect 2 transitions, got %+v", transitions)
+	}
+
+	if keys := history.Keys("snow_incident"); len(keys) != 1 || keys[0] != "/snow/incident" || history.Task(keys[0]) != "snow_incident" {
+		t.Errorf("Unexpected keys=%s", keys)
+	}
+
+	if keys := history.Keys("other"); len(keys) != 0 {
+		t.Errorf("Expect no keys of the other task, got %s", keys)
+	}
+
+	transition, err := history.Rollback("/snow/incident", middle)
+	if err != nil || transition.Value != "ckpt1" || inner.values[len(inner.values)-1] != "ckpt1" {
+		t.Fatalf("Expect rolled back to ckpt1, transition=%+v, error=%v", transition, err)
+	}
+
+	transitions = history.Transitions("/snow/incident", middle, time.Time{})
+	if len(transitions) != 2 || transitions[1].Action != CheckpointRolledBack {
+		t.Errorf("Expect the rollback recorded, got %+v", transitions)
+	}
+
+	if _, err := history.Rollback("/snow/incident", time.Now().Add(-time.Hour)); !errors.Is(err, ErrCheckpointHistoryNotFound) {
+		t.Errorf("Expect no history before the first checkpoint, error=%v", err)
+	}
+
+	// The partitions beyond the retention are dropped
+	history.expire(time.Now().Add(3 * time.Hour))
+	if keys := history.Keys(""); len(keys) != 0 {
+		t.Errorf("Expect the history expired, got %s", keys)
+	}
+}
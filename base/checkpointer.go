@@ -32,3 +32,23 @@ func (checkpoint *NullCheckpointer) WriteCheckpoint(keyInfo map[string]string, v
 func (checkpoint *NullCheckpointer) DeleteCheckpoint(keyInfo map[string]string) error {
 	return nil
 }
+
+// ReadOnlyCheckpointer reads the checkpoints of the wrapped Checkpointer but
+// never changes them, for e.g. to preview a task from where it is
+type ReadOnlyCheckpointer struct {
+	Checkpointer
+}
+
+func NewReadOnlyCheckpointer(checkpoint Checkpointer) *ReadOnlyCheckpointer {
+	return &ReadOnlyCheckpointer{
+		Checkpointer: checkpoint,
+	}
+}
+
+func (checkpoint *ReadOnlyCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	return nil
+}
+
+func (checkpoint *ReadOnlyCheckpointer) DeleteCheckpoint(keyInfo map[string]string) error {
+	return nil
+}
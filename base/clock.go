@@ -0,0 +1,174 @@
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the schedulers, tickers and rate limiters,
+// so that their behavior can be tested deterministically with a FakeClock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (ticker systemTicker) C() <-chan time.Time {
+	return ticker.Ticker.C
+}
+
+type fakeTimer struct {
+	when   time.Time
+	period time.Duration // fires repeatedly if positive
+	c      chan time.Time
+}
+
+// FakeClock only moves when it is advanced. Timers and tickers fire in
+// Advance, the ticks are dropped if the receiver is behind like time.Ticker
+type FakeClock struct {
+	now       time.Time
+	timers    []*fakeTimer
+	lockGuard sync.Mutex
+	cond      *sync.Cond
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.cond = sync.NewCond(&clock.lockGuard)
+	return clock
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.lockGuard.Lock()
+	defer clock.lockGuard.Unlock()
+	return clock.now
+}
+
+func (clock *FakeClock) After(d time.Duration) <-chan time.Time {
+	return clock.addTimer(d, 0).c
+}
+
+func (clock *FakeClock) Sleep(d time.Duration) {
+	<-clock.After(d)
+}
+
+func (clock *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return &fakeTicker{clock, clock.addTimer(d, d)}
+}
+
+// Advance moves the clock forward by d and fires the timers due
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.lockGuard.Lock()
+	defer clock.lockGuard.Unlock()
+
+	clock.now = clock.now.Add(d)
+	var pendings []*fakeTimer
+	for _, timer := range clock.timers {
+		if timer.when.After(clock.now) {
+			pendings = append(pendings, timer)
+			continue
+		}
+
+		select {
+		case timer.c <- timer.when:
+		default:
+		}
+
+		if timer.period > 0 {
+			for !timer.when.After(clock.now) {
+				timer.when = timer.when.Add(timer.period)
+			}
+			pendings = append(pendings, timer)
+		}
+	}
+	clock.timers = pendings
+}
+
+// BlockUntil blocks until at least n timers and tickers are pending, for
+// e.g. a goroutine under test is waiting on After before it is advanced
+func (clock *FakeClock) BlockUntil(n int) {
+	clock.lockGuard.Lock()
+	defer clock.lockGuard.Unlock()
+
+	for len(clock.timers) < n {
+		clock.cond.Wait()
+	}
+}
+
+func (clock *FakeClock) addTimer(d, period time.Duration) *fakeTimer {
+	clock.lockGuard.Lock()
+	defer clock.lockGuard.Unlock()
+
+	timer := &fakeTimer{
+		when:   clock.now.Add(d),
+		period: period,
+		c:      make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		timer.c <- clock.now
+		return timer
+	}
+	clock.timers = append(clock.timers, timer)
+	clock.cond.Broadcast()
+	return timer
+}
+
+func (clock *FakeClock) removeTimer(timer *fakeTimer) {
+	clock.lockGuard.Lock()
+	defer clock.lockGuard.Unlock()
+
+	for i, t := range clock.timers {
+		if t == timer {
+			clock.timers = append(clock.timers[:i], clock.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	timer *fakeTimer
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time {
+	return ticker.timer.c
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.clock.removeTimer(ticker.timer)
+}
@@ -0,0 +1,33 @@
+package base
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultClockSkewThreshold = 30 * time.Second
+)
+
+// ClockSkew estimates how far the server clock is ahead of the local clock
+// by the Date header of a response. The local time is taken at the middle
+// of the request, the result is accurate to about 1 second
+func ClockSkew(dateHeader string, requestStart, responseEnd time.Time) (time.Duration, error) {
+	serverTime, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return 0, err
+	}
+
+	localTime := requestStart.Add(responseEnd.Sub(requestStart) / 2)
+	return serverTime.Sub(localTime), nil
+}
+
+// GetClockSkewThreshold returns ClockSkewThreshold in seconds, default to 30
+func GetClockSkewThreshold(config BaseConfig) time.Duration {
+	seconds, err := strconv.Atoi(config[ClockSkewThreshold])
+	if err != nil || seconds <= 0 {
+		return defaultClockSkewThreshold
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,31 @@
+package base
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	start := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Second)
+	server := start.Add(time.Minute).Format(http.TimeFormat)
+
+	skew, err := ClockSkew(server, start, end)
+	if err != nil || skew != 59*time.Second {
+		t.Errorf("Expect skew=59s, got skew=%s, error=%v", skew, err)
+	}
+
+	skew, _ = ClockSkew(start.Add(-time.Minute).Format(http.TimeFormat), start, end)
+	if skew != -61*time.Second {
+		t.Errorf("Expect skew=-61s, got=%s", skew)
+	}
+
+	if _, err := ClockSkew("yesterday", start, end); err == nil {
+		t.Errorf("Expect error for invalid Date header")
+	}
+
+	if GetClockSkewThreshold(BaseConfig{}) != defaultClockSkewThreshold {
+		t.Errorf("Expect default threshold")
+	}
+}
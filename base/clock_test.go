@@ -0,0 +1,93 @@
+package base
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	after := clock.After(time.Second)
+	ticker := clock.NewTicker(time.Minute)
+	select {
+	case <-after:
+		t.Errorf("Timer fired before the clock is advanced")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	if now := <-after; !now.Equal(start.Add(time.Second)) {
+		t.Errorf("Expect timer fired at %s, got %s", start.Add(time.Second), now)
+	}
+
+	// Ticks are dropped when the receiver is behind
+	clock.Advance(3 * time.Minute)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expect the first tick at %s, got %s", start.Add(time.Minute), tick)
+	}
+	select {
+	case <-ticker.C():
+		t.Errorf("Expect the ticks dropped")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("Expect tick at %s, got %s", start.Add(4*time.Minute), tick)
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Errorf("Stopped ticker fired")
+	default:
+	}
+
+	done := make(chan bool)
+	go func() {
+		clock.Sleep(time.Second)
+		done <- true
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-done
+}
+
+func TestSchedulerFakeClock(t *testing.T) {
+	// TestJob expects the job ids to start from 1
+	defer atomic.StoreInt64(&jobId, atomic.LoadInt64(&jobId))
+
+	clock := NewFakeClock(time.Now())
+	calls := make(chan int64, 10)
+	job := NewJob(func(params JobParam) error {
+		calls <- clock.Now().UnixNano()
+		return nil
+	}, 0, int64(time.Minute), nil)
+
+	// Jobs are added before Start so that no timer of the empty scheduler is
+	// pending when the clock is advanced
+	start := clock.Now()
+	sched := NewScheduler()
+	sched.SetClock(clock)
+	sched.AddJobs([]Job{job})
+	sched.Start()
+	defer sched.Stop()
+
+	// Due jobs are strictly before now
+	clock.Advance(time.Nanosecond)
+	if when := <-calls; when != start.Add(time.Nanosecond).UnixNano() {
+		t.Errorf("Expect the job called right after it is added, got %d", when-start.UnixNano())
+	}
+
+	for i := 1; i <= 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		if when := <-calls; when != start.Add(time.Duration(i)*time.Minute+time.Nanosecond).UnixNano() {
+			t.Errorf("Expect the job called every minute, got %d at %d", when-start.UnixNano(), i)
+		}
+	}
+}
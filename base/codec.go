@@ -0,0 +1,196 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+)
+
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// Codec compresses the data written to sinks, for e.g. the Kafka message values.
+// Implementations shall be safe for concurrent use
+type Codec interface {
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// CodecFactory creates a Codec with the Compression* configs
+type CodecFactory func(config BaseConfig) (Codec, error)
+
+var (
+	codecFactories = map[string]CodecFactory{
+		CodecNone: newNoneCodec,
+		CodecGzip: newGzipCodec,
+		CodecZstd: newZstdCodec,
+	}
+	codecMutex sync.RWMutex
+)
+
+// RegisterCodec makes a codec available by name in NewCodec
+func RegisterCodec(name string, factory CodecFactory) {
+	codecMutex.Lock()
+	codecFactories[name] = factory
+	codecMutex.Unlock()
+}
+
+// NewCodec
+// @config: contains Compression ("none", "gzip" or "zstd", default none),
+// CompressionLevel and CompressionDict which is the path of a zstd dictionary
+func NewCodec(config BaseConfig) (Codec, error) {
+	name := config[Compression]
+	if name == "" {
+		name = CodecNone
+	}
+
+	codecMutex.RLock()
+	factory, ok := codecFactories[name]
+	codecMutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unsupported compression codec=%s", name))
+	}
+	return factory(config)
+}
+
+// getCompressionLevel returns CompressionLevel, defaultLevel if it is not set
+func getCompressionLevel(config BaseConfig, defaultLevel int) (int, error) {
+	if config[CompressionLevel] == "" {
+		return defaultLevel, nil
+	}
+	return strconv.Atoi(config[CompressionLevel])
+}
+
+type noneCodec struct {
+}
+
+func newNoneCodec(config BaseConfig) (Codec, error) {
+	return noneCodec{}, nil
+}
+
+func (codec noneCodec) Name() string {
+	return CodecNone
+}
+
+func (codec noneCodec) Encode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (codec noneCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type gzipCodec struct {
+	level int
+}
+
+func newGzipCodec(config BaseConfig) (Codec, error) {
+	level, err := getCompressionLevel(config, gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the level up front instead of on every Encode
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+	return &gzipCodec{level: level}, nil
+}
+
+func (codec *gzipCodec) Name() string {
+	return CodecGzip
+}
+
+func (codec *gzipCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, _ := gzip.NewWriterLevel(&buf, codec.level)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (codec *gzipCodec) Decode(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectCodec returns the codec data was compressed with by its magic bytes,
+// CodecNone if it is not compressed by a known codec
+func DetectCodec(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CodecGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return CodecZstd
+	}
+	return CodecNone
+}
+
+// autoCodec decodes the data with the codec detected by DetectCodec, so that
+// the topics written by producers of different Compression can be read
+type autoCodec struct {
+	Codec  // of Compression, which encodes
+	codecs map[string]Codec
+}
+
+// NewAutoCodec returns the Codec of Compression whose Decode detects the
+// codec of the data. The zstd data is decoded with CompressionDict, if any
+// @config: see NewCodec
+func NewAutoCodec(config BaseConfig) (Codec, error) {
+	codec, err := NewCodec(config)
+	if err != nil {
+		return nil, err
+	}
+
+	auto := &autoCodec{
+		Codec:  codec,
+		codecs: map[string]Codec{codec.Name(): codec},
+	}
+
+	decodeConfig := BaseConfig{CompressionDict: config[CompressionDict]}
+	for _, name := range []string{CodecGzip, CodecZstd} {
+		if _, ok := auto.codecs[name]; ok {
+			continue
+		}
+
+		decodeConfig[Compression] = name
+		if auto.codecs[name], err = NewCodec(decodeConfig); err != nil {
+			return nil, err
+		}
+	}
+	return auto, nil
+}
+
+func (codec *autoCodec) Decode(data []byte) ([]byte, error) {
+	name := DetectCodec(data)
+	if name == CodecNone {
+		// Compressed by a codec registered by RegisterCodec or not at all
+		if decoded, err := codec.Codec.Decode(data); err == nil {
+			return decoded, nil
+		}
+		return data, nil
+	}
+	return codec.codecs[name].Decode(data)
+}
@@ -0,0 +1,61 @@
+package base
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	data := bytes.Repeat([]byte(`sys_id="abc",number="INC0010001",state="open",`), 100)
+	for _, name := range []string{"", CodecNone, CodecGzip, CodecZstd} {
+		codec, err := NewCodec(BaseConfig{Compression: name})
+		if err != nil {
+			t.Errorf("Failed to create codec=%s, error=%s", name, err)
+			continue
+		}
+
+		encoded, err := codec.Encode(data)
+		if err != nil {
+			t.Errorf("Failed to encode with codec=%s, error=%s", codec.Name(), err)
+			continue
+		}
+
+		decoded, err := codec.Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Codec=%s doesn't roundtrip, error=%v", codec.Name(), err)
+		}
+	}
+
+	if _, err := NewCodec(BaseConfig{Compression: "lz5"}); err == nil {
+		t.Errorf("Expect error for unsupported codec")
+	}
+
+	if _, err := NewCodec(BaseConfig{Compression: CodecGzip, CompressionLevel: "42"}); err == nil {
+		t.Errorf("Expect error for invalid gzip level")
+	}
+}
+
+func TestAutoCodec(t *testing.T) {
+	data := []byte(`{"MetaInfo":{},"RawData":[]}`)
+	codec, err := NewAutoCodec(BaseConfig{Compression: CodecGzip})
+	if err != nil {
+		t.Fatalf("Failed to create auto codec, error=%s", err)
+	}
+
+	if codec.Name() != CodecGzip {
+		t.Errorf("Expect encoding with gzip, got %s", codec.Name())
+	}
+
+	for _, name := range []string{CodecNone, CodecGzip, CodecZstd} {
+		producer, _ := NewCodec(BaseConfig{Compression: name})
+		encoded, _ := producer.Encode(data)
+		if detected := DetectCodec(encoded); detected != name {
+			t.Errorf("Expect codec=%s detected, got %s", name, detected)
+		}
+
+		decoded, err := codec.Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Expect the data of codec=%s decoded, got %s, error=%v", name, decoded, err)
+		}
+	}
+}
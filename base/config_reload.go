@@ -0,0 +1,59 @@
+package base
+
+import (
+	"flag"
+	"strconv"
+)
+
+// ReloadableConfigs are the global configs which can be changed without
+// restarting the collectors or interrupting the running jobs
+var ReloadableConfigs = []string{
+	DisabledApps,
+	EnabledApps,
+	HeartbeatInterval,
+	HeartbeatMode,
+	JobRateLimit,
+	LogLevel,
+	MaxConcurrentJobs,
+}
+
+const (
+	HeartbeatModeAll       = "all"
+	HeartbeatModeKafka     = "kafka"
+	HeartbeatModeZooKeeper = "zookeeper"
+)
+
+// DiffConfig returns the keys whose values differ in newConfig and
+// oldConfig, with their new values. A removed key has "" as its new value
+// @keys: only these keys are compared
+func DiffConfig(oldConfig, newConfig BaseConfig, keys []string) BaseConfig {
+	diff := make(BaseConfig)
+	for _, key := range keys {
+		if oldConfig[key] != newConfig[key] {
+			diff[key] = newConfig[key]
+		}
+	}
+	return diff
+}
+
+// SetLogLevel changes the glog verbosity at runtime
+func SetLogLevel(level string) error {
+	if level == "" {
+		level = "0"
+	}
+
+	if _, err := strconv.Atoi(level); err != nil {
+		return err
+	}
+	return flag.Set("v", level)
+}
+
+// GetHeartbeatMode returns where the collectors heartbeat through,
+// default to both ZooKeeper and Kafka
+func GetHeartbeatMode(config BaseConfig) string {
+	switch config[HeartbeatMode] {
+	case HeartbeatModeKafka, HeartbeatModeZooKeeper:
+		return config[HeartbeatMode]
+	}
+	return HeartbeatModeAll
+}
@@ -0,0 +1,34 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestDiffConfig(t *testing.T) {
+	oldConfig := BaseConfig{LogLevel: "1", MaxConcurrentJobs: "10", KafkaBrokers: "a"}
+	newConfig := BaseConfig{LogLevel: "2", JobRateLimit: "5", KafkaBrokers: "b"}
+
+	diff := DiffConfig(oldConfig, newConfig, ReloadableConfigs)
+	expected := BaseConfig{LogLevel: "2", MaxConcurrentJobs: "", JobRateLimit: "5"}
+	if len(diff) != len(expected) {
+		t.Errorf("Expect diff=%s, got=%s", expected, diff)
+	}
+
+	for k, v := range expected {
+		if got, ok := diff[k]; !ok || got != v {
+			t.Errorf("Expect %s=%s in diff, got=%s", k, v, diff)
+		}
+	}
+
+	bus := NewEventBus()
+	events := bus.Subscribe(ConfigReloadTopic)
+	bus.Publish(ConfigReloadTopic, diff)
+	if event := <-events; event[LogLevel] != "2" {
+		t.Errorf("Expect the diff to be delivered through the bus, got=%s", event)
+	}
+
+	bus.Close()
+	if _, ok := <-events; ok {
+		t.Errorf("Expect the subscriber channel to be closed")
+	}
+}
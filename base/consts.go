@@ -1,45 +1,178 @@
 package base
 
 const (
+	AlertDedupeWindow      = "AlertDedupeWindow"
+	AlertPagerDutyKey      = "AlertPagerDutyKey"
+	AlertPagerDutyURL      = "AlertPagerDutyURL"
+	AlertRateLimit         = "AlertRateLimit"
+	AlertSlackWebhook      = "AlertSlackWebhook"
+	AlertWebhook           = "AlertWebhook"
 	App                    = "App"
+	ArchiveAfterDays       = "ArchiveAfterDays"
+	ArchivePurgeDays       = "ArchivePurgeDays"
+	BatchFlushInterval     = "BatchFlushInterval"
+	BatchMaxRecords        = "BatchMaxRecords"
+	BatchSeq               = "BatchSeq"
+	BootstrapFromTopic     = "BootstrapFromTopic"
 	Broadcast              = "Broadcast"
+	BytesWritten           = "BytesWritten"
 	CassandraKeyspace      = "CassandraKeyspace"
 	CassandraSeeds         = "CassandraSeeds"
+	CatchUpInterval        = "CatchUpInterval"
+	CatchUpJobs            = "CatchUpJobs"
+	CatchUpLag             = "CatchUpLag"
+	CatchUpRecordCount     = "CatchUpRecordCount"
 	CheckpointMethod       = "CheckpointMethod"
 	CheckpointDir          = "CheckpointDir"
 	CheckpointKey          = "CheckpointKey"
 	CheckpointNamespace    = "CheckpointNamespace"
 	CheckpointPartition    = "CheckpointPartition"
+	CheckpointQuorum       = "CheckpointQuorum"
+	CheckpointRetention    = "CheckpointRetention"
 	CheckpointTable        = "CheckpointTable"
 	CheckpointTopic        = "CheckpointTopic"
+	CheckpointVersions     = "CheckpointVersions"
+	ClockSkewCompensate    = "ClockSkewCompensate"
+	ClockSkewThreshold     = "ClockSkewThreshold"
+	Compression            = "Compression"
+	CompressionDict        = "CompressionDict"
+	CompressionLevel       = "CompressionLevel"
+	CompositeBufferSize    = "CompositeBufferSize"
+	CompositeMetrics       = "CompositeMetrics"
+	ConfigErrorJobs        = "ConfigErrorJobs"
+	ContractViolations     = "ContractViolations"
+	ControlKafkaBrokers    = "ControlKafkaBrokers"
 	CpuCount               = "CpuCount"
+	DedupeFilter           = "DedupeFilter"
+	DegradedJobs           = "DegradedJobs"
+	DisabledApps           = "DisabledApps"
+	Domain                 = "Domain"
+	DomainField            = "DomainField"
+	Domains                = "Domains"
+	DryRun                 = "DryRun"
+	DumpDir                = "DumpDir"
+	DryRunSample           = "DryRunSample"
+	EnabledApps            = "EnabledApps"
+	EncryptionKeyFile      = "EncryptionKeyFile"
+	EncryptionKeyID        = "EncryptionKeyID"
+	EndpointProbeInterval  = "EndpointProbeInterval"
+	ExpectedFields         = "ExpectedFields"
+	FailedSinks            = "FailedSinks"
+	FailoverBrokers        = "FailoverBrokers"
+	FailoverProbeInterval  = "FailoverProbeInterval"
+	FailoverThreshold      = "FailoverThreshold"
+	FieldOrder             = "FieldOrder"
 	FlushFrequency         = "FlushFreqency"
+	FlushTimeout           = "FlushTimeout"
+	ForwardBrokers         = "ForwardBrokers"
+	ForwardLagThreshold    = "ForwardLagThreshold"
+	ForwardTopics          = "ForwardTopics"
+	HealthThreshold        = "HealthThreshold"
 	Heartbeat              = "Heartbeat"
+	HeartbeatInterval      = "HeartbeatInterval"
+	HeartbeatMaxMissed     = "HeartbeatMaxMissed"
+	HeartbeatMode          = "HeartbeatMode"
+	HeartbeatSuspicion     = "HeartbeatSuspicion"
 	Host                   = "Host"
+	HTTPGzip               = "HTTPGzip"
+	HTTPMaxRequests        = "HTTPMaxRequests"
+	HTTPProtocols          = "HTTPProtocols"
+	HTTPTransport          = "HTTPTransport"
+	HTTPVersion            = "HTTPVersion"
 	HostRegex              = "Host_regex"
+	IPFamily               = "IPFamily"
 	Index                  = "Index"
+	InflightBytes          = "InflightBytes"
+	InflightHighBytes      = "InflightHighBytes"
+	InflightLowBytes       = "InflightLowBytes"
+	InstanceHealth         = "InstanceHealth"
 	Interval               = "Interval"
+	JobHistoryTopic        = "JobHistoryTopic"
+	JobRateLimit           = "JobRateLimit"
 	KafkaApp               = "kafka"
 	KafkaBrokers           = "KafkaBrokers"
 	KafkaConsumerGroup     = "KafkaConsumerGroup"
+	KafkaKeyField          = "KafkaKeyField"
+	KafkaMetadataRefresh   = "KafkaMetadataRefresh"
+	KafkaOffsetReset       = "KafkaOffsetReset"
 	KafkaPartition         = "KafkaPartition"
+	KafkaRetryDelays       = "KafkaRetryDelays"
+	KafkaSASLPassword      = "KafkaSASLPassword"
+	KafkaSASLUser          = "KafkaSASLUser"
+	KafkaTLS               = "KafkaTLS"
+	KafkaTLSCAFile         = "KafkaTLSCAFile"
+	KafkaTLSCertFile       = "KafkaTLSCertFile"
+	KafkaTLSKeyFile        = "KafkaTLSKeyFile"
+	KafkaTLSServerName     = "KafkaTLSServerName"
+	KafkaTLSSkipVerify     = "KafkaTLSSkipVerify"
 	KafkaTopic             = "KafkaTopic"
 	KafkaZooKeepers        = "KafkaZooKeepers"
 	Key                    = "Key"
+	Labels                 = "Labels"
+	LogLevel               = "LogLevel"
 	LongRun                = "LongRun"
+	MaxConcurrentJobs      = "MaxConcurrentJobs"
 	MemAlloc               = "MemAlloc"
+	MetadataStorePath      = "MetadataStorePath"
 	Metric                 = "Metric"
+	MgmtListenAddress      = "MgmtListenAddress"
+	MgmtTokensFile         = "MgmtTokensFile"
+	NodeHealth             = "NodeHealth"
+	OutputTemplate         = "OutputTemplate"
 	Password               = "Password"
+	PlacementConstraints   = "PlacementConstraints"
 	Platform               = "Platform"
+	Priority               = "Priority"
 	ProxyPassword          = "ProxyPassword"
 	ProxyURL               = "ProxyURL"
 	ProxyUsername          = "ProxyUsername"
+	QuotaDaily             = "QuotaDaily"
+	QuotaHourly            = "QuotaHourly"
+	QuotaWarnRatio         = "QuotaWarnRatio"
+	ReconcileInterval      = "ReconcileInterval"
+	RecordSeq              = "RecordSeq"
+	RecordsWritten         = "RecordsWritten"
 	RequireAcks            = "RequiredAcks"
+	ResumeFrom             = "ResumeFrom"
+	ResumePolicy           = "ResumePolicy"
+	RetryAt                = "RetryAt"
+	RetryAttempt           = "RetryAttempt"
+	RetryOrigin            = "RetryOrigin"
+	RunningJobs            = "RunningJobs"
+	SaturatedSinks         = "SaturatedSinks"
+	ScheduleCatchUp        = "ScheduleCatchUp"
+	ScheduleTimezone       = "ScheduleTimezone"
+	ScheduleWindows        = "ScheduleWindows"
+	SeqEpoch               = "SeqEpoch"
+	Serialization          = "Serialization"
+	ServerNodes            = "ServerNodes"
 	ServerURL              = "ServerURL"
+	ShapedWrites           = "ShapedWrites"
+	ShapingDelay           = "ShapingDelay"
+	SinkAckTimeout         = "SinkAckTimeout"
+	SinkByteRate           = "SinkByteRate"
+	SinkDropped            = "SinkDropped"
+	SinkLatencies          = "SinkLatencies"
+	SinkOldestAge          = "SinkOldestAge"
+	SinkQueueDepth         = "SinkQueueDepth"
+	SinkRecordRate         = "SinkRecordRate"
+	SinkSaturationTime     = "SinkSaturationTime"
+	SLOMaxLag              = "SLOMaxLag"
+	SLOMaxRecordBytes      = "SLOMaxRecordBytes"
+	SLOMinSuccessRate      = "SLOMinSuccessRate"
+	SLOMinThroughput       = "SLOMinThroughput"
+	SortFields             = "SortFields"
 	Source                 = "Source"
+	SourceCommand          = "SourceCommand"
+	SourceTimeout          = "SourceTimeout"
+	SubprocessApp          = "subprocess"
 	Sourcetype             = "Sourcetype"
 	Splunk                 = "Splunk"
+	SpoolDir               = "SpoolDir"
+	StopTimeout            = "StopTimeout"
+	StreamThreshold        = "StreamThreshold"
 	AWSS3                  = "AWSS3"
+	Blackhole              = "Blackhole"
 	SyncWrite              = "SyncWrite"
 	SysMemAlloc            = "SysMemAlloc"
 	TaskConfig             = "_TaskConfigs_"
@@ -48,16 +181,31 @@ const (
 	TaskConfigKey          = "TaskConfigKey"
 	TaskConfigNew          = "TaskConfigNew"
 	TaskConfigUpdate       = "TaskConfigUpdate"
+	TaskInflightHighBytes  = "TaskInflightHighBytes"
+	TaskInflightLowBytes   = "TaskInflightLowBytes"
+	TaskPlacement          = "TaskPlacement"
+	TaskSchemaVersion      = "TaskSchemaVersion"
 	TaskStats              = "TaskStats"
 	Taskname               = "Taskname"
 	Tasks                  = "_Tasks_"
 	TargetSystem           = "TargetSystem"
 	TargetSystemType       = "TargetSystemType"
 	Timestamp              = "Timestamp"
+	TLSCAFile              = "TLSCAFile"
+	TLSCertFile            = "TLSCertFile"
+	TLSKeyFile             = "TLSKeyFile"
+	TLSMinVersion          = "TLSMinVersion"
+	TLSServerName          = "TLSServerName"
+	TLSSkipVerify          = "TLSSkipVerify"
+	TSDBToken              = "TSDBToken"
+	TSDBType               = "TSDBType"
+	TSDBURL                = "TSDBURL"
 	TotoalMemAlloc         = "TotalMemAlloc"
+	UnhealthyJobs          = "UnhealthyJobs"
 	UseOffsetNewest        = "UseOffsetNewest"
 	UseOffsetOldest        = "UseOffsetOldest"
 	Username               = "Username"
+	WriteTimeout           = "WriteTimeout"
 	ZooKeeperRoot          = "ZooKeeperRoot"
 	ZooKeeperElectionRoot  = "ZooKeeperElectionRoot"
 	ZooKeeperHeartbeatRoot = "ZooKeeperHeartbeatRoot"
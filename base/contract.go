@@ -0,0 +1,96 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Topic of the data missing the ExpectedFields of their task, see
+	// ContractViolation.Event
+	ContractViolationTopic = "ContractViolation"
+)
+
+// ContractViolation is a batch of records of a task which miss some of the
+// ExpectedFields, for e.g. when an ACL or view change on the instance strips
+// them from the responses
+type ContractViolation struct {
+	Key      string // TaskConfigKey
+	Metric   string
+	Records  int            // records in the batch
+	Violated int            // records missing any of the fields
+	Missing  map[string]int // number of records missing each field
+}
+
+// Event returns the violation as a ContractViolationTopic event, Missing is
+// "field=n" joined by ";"
+func (violation *ContractViolation) Event() BaseConfig {
+	var missing []string
+	for field, n := range violation.Missing {
+		missing = append(missing, fmt.Sprintf("%s=%d", field, n))
+	}
+	sort.Strings(missing)
+
+	return BaseConfig{
+		TaskConfigKey: violation.Key,
+		Metric:        violation.Metric,
+		"Records":     strconv.Itoa(violation.Records),
+		"Violated":    strconv.Itoa(violation.Violated),
+		"Missing":     strings.Join(missing, ";"),
+	}
+}
+
+// NewContractCheck returns the Transform which checks that the records have
+// the ExpectedFields of config, "," separated, for e.g.
+// "sys_id,number,sys_updated_on". A field is missing if it is absent, null or
+// empty. The data is written regardless, the batches missing fields are
+// handed to onViolation. Returns nil if ExpectedFields is not set
+func NewContractCheck(config BaseConfig, onViolation func(violation *ContractViolation)) Transform {
+	var fields []string
+	for _, field := range strings.Split(config[ExpectedFields], ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	key, metric := config[TaskConfigKey], config[Metric]
+	return func(data *Data) (*Data, error) {
+		records, err := data.ParseRecords()
+		if err != nil {
+			// Not in a known format, the sink reports it if it matters
+			return data, nil
+		}
+
+		violation := &ContractViolation{
+			Key:     key,
+			Metric:  metric,
+			Records: len(records),
+			Missing: make(map[string]int),
+		}
+
+		for _, record := range records {
+			violated := false
+			for _, field := range fields {
+				if value, ok := record[field]; !ok || value == nil || value == "" {
+					violation.Missing[field]++
+					violated = true
+				}
+			}
+
+			if violated {
+				violation.Violated++
+			}
+		}
+
+		if violation.Violated > 0 {
+			onViolation(violation)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,48 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestContractCheck(t *testing.T) {
+	if NewContractCheck(BaseConfig{}, nil) != nil {
+		t.Errorf("Expect no check without ExpectedFields")
+	}
+
+	var violations []*ContractViolation
+	config := BaseConfig{ExpectedFields: "sys_id, number,sys_updated_on", TaskConfigKey: "snow/incident", Metric: "incident"}
+	check := NewContractCheck(config, func(violation *ContractViolation) {
+		violations = append(violations, violation)
+	})
+
+	data := NewData(nil, [][]byte{
+		[]byte(`{"sys_id":"1","number":"INC1","sys_updated_on":"2015-06-01 08:00:00"}`),
+		[]byte(`{"sys_id":"2","number":"","sys_updated_on":"2015-06-01 08:00:01"}`),
+		[]byte(`{"sys_id":"3","sys_updated_on":null}`),
+	})
+
+	res, err := check(data)
+	if res != data || err != nil {
+		t.Errorf("Expect the data written regardless, error=%v", err)
+	}
+
+	if len(violations) != 1 {
+		t.Fatalf("Expect 1 violation, got %d", len(violations))
+	}
+
+	violation := violations[0]
+	if violation.Records != 3 || violation.Violated != 2 || violation.Missing["number"] != 2 ||
+		violation.Missing["sys_updated_on"] != 1 || violation.Missing["sys_id"] != 0 {
+		t.Errorf("Unexpected violation=%+v", violation)
+	}
+
+	event := violation.Event()
+	if event["Missing"] != "number=2;sys_updated_on=1" || event[TaskConfigKey] != "snow/incident" {
+		t.Errorf("Unexpected violation event=%s", event)
+	}
+
+	check(NewData(nil, [][]byte{[]byte(`{"sys_id":"4","number":"INC4","sys_updated_on":"2015-06-01 08:00:02"}`)}))
+	if len(violations) != 1 {
+		t.Errorf("Expect no violation of the complete records, got %d", len(violations))
+	}
+}
@@ -0,0 +1,70 @@
+package base
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// CountingDataWriter counts the records and bytes which are successfully
+// written through the wrapped DataWriter. Counting the bytes needs RawData,
+// so data is serialized before it is handed over, the wrappers in between,
+// for e.g. SequencingDataWriter which writes a copy of data, and the sink
+// then reuse RawData instead of serializing again
+type CountingDataWriter struct {
+	DataWriter
+	records int64
+	bytes   int64
+}
+
+func NewCountingDataWriter(writer DataWriter) *CountingDataWriter {
+	return &CountingDataWriter{
+		DataWriter: writer,
+	}
+}
+
+func (writer *CountingDataWriter) WriteData(data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return writer.count(data, writer.DataWriter.WriteData(data))
+}
+
+func (writer *CountingDataWriter) WriteDataSync(data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return writer.count(data, writer.DataWriter.WriteDataSync(data))
+}
+
+func (writer *CountingDataWriter) WriteDataAsync(data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return writer.count(data, writer.DataWriter.WriteDataAsync(data))
+}
+
+func (writer *CountingDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+	return writer.count(data, writer.DataWriter.WriteDataContext(ctx, data))
+}
+
+// Stats returns the total records and bytes written so far
+func (writer *CountingDataWriter) Stats() (int64, int64) {
+	return atomic.LoadInt64(&writer.records), atomic.LoadInt64(&writer.bytes)
+}
+
+func (writer *CountingDataWriter) count(data *Data, err error) error {
+	if err != nil {
+		return err
+	}
+
+	var n int64
+	for _, rawData := range data.RawData {
+		n += int64(len(rawData))
+	}
+	atomic.AddInt64(&writer.records, int64(len(data.RawData)))
+	atomic.AddInt64(&writer.bytes, n)
+	return nil
+}
@@ -0,0 +1,41 @@
+package base
+
+import (
+	"strconv"
+)
+
+const (
+	// Topic of the credentials of the sources which are rejected or accepted
+	// again, see CredentialHealth.Event
+	CredentialHealthTopic = "CredentialHealth"
+
+	PrimaryCredential   = "primary"
+	SecondaryCredential = "secondary"
+)
+
+// CredentialHealth is the health of the Credential ("primary" or
+// "secondary") of a source which changed. Active is the credential used by
+// the source since then, for e.g. the secondary one while the primary
+// password is being rotated
+type CredentialHealth struct {
+	Key        string
+	ServerURL  string
+	Username   string
+	Credential string
+	Active     string
+	Healthy    bool
+	Status     string
+}
+
+// Event returns the health as a CredentialHealthTopic event
+func (health *CredentialHealth) Event() BaseConfig {
+	return BaseConfig{
+		Key:          health.Key,
+		ServerURL:    health.ServerURL,
+		Username:     health.Username,
+		"Credential": health.Credential,
+		"Active":     health.Active,
+		"Healthy":    strconv.FormatBool(health.Healthy),
+		"Status":     health.Status,
+	}
+}
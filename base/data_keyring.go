@@ -0,0 +1,107 @@
+package base
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"io/ioutil"
+)
+
+// DataKeyring encrypts the data at rest with AES-GCM. The keys are loaded
+// from EncryptionKeyFile, a JSON object of key ID to base64 encoded 16, 24
+// or 32 byte key, for e.g. {"2024-01": "..."}, provisioned by the secrets
+// backend. EncryptionKeyID is the key sealing the new data, the others still
+// open the data sealed before. To rotate, add the new key to the file and
+// point EncryptionKeyID to it, the retired keys may be removed when no data
+// sealed by them is left
+type DataKeyring struct {
+	current string
+	ciphers map[string]cipher.AEAD // key ID indexed
+}
+
+// NewDataKeyring returns nil without an error if EncryptionKeyFile is not
+// configured, the data is kept in plain text then
+// @config: EncryptionKeyFile, EncryptionKeyID
+func NewDataKeyring(config BaseConfig) (*DataKeyring, error) {
+	if config[EncryptionKeyFile] == "" {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(config[EncryptionKeyFile])
+	if err != nil {
+		glog.Errorf("Failed to read %s=%s, error=%s", EncryptionKeyFile, config[EncryptionKeyFile], err)
+		return nil, err
+	}
+
+	var keys map[string]string
+	err = json.Unmarshal(content, &keys)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s=%s, error=%s", EncryptionKeyFile, config[EncryptionKeyFile], err)
+		return nil, err
+	}
+
+	keyring := &DataKeyring{
+		current: config[EncryptionKeyID],
+		ciphers: make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid key=%s in %s, error=%s", id, config[EncryptionKeyFile], err))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid key=%s in %s, error=%s", id, config[EncryptionKeyFile], err))
+		}
+
+		keyring.ciphers[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := keyring.ciphers[keyring.current]; !ok {
+		return nil, errors.New(fmt.Sprintf("%s=%s is not found in %s", EncryptionKeyID, keyring.current, config[EncryptionKeyFile]))
+	}
+	return keyring, nil
+}
+
+// KeyID returns the ID of the key sealing the new data
+func (keyring *DataKeyring) KeyID() string {
+	return keyring.current
+}
+
+// Seal encrypts plaintext with the current key and returns the key ID to be
+// recorded along with the sealed data for Open
+func (keyring *DataKeyring) Seal(plaintext []byte) (string, []byte, error) {
+	aead := keyring.ciphers[keyring.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	// The nonce is prefixed to the ciphertext
+	return keyring.current, aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts the data sealed by keyID
+func (keyring *DataKeyring) Open(keyID string, sealed []byte) ([]byte, error) {
+	aead, ok := keyring.ciphers[keyID]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Key=%s is not found, it may have been removed on rotation", keyID))
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("Sealed data is truncated")
+	}
+
+	nonce := sealed[:aead.NonceSize()]
+	return aead.Open(nil, nonce, sealed[aead.NonceSize():], nil)
+}
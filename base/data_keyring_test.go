@@ -0,0 +1,58 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring, err := NewDataKeyring(BaseConfig{})
+	if keyring != nil || err != nil {
+		t.Errorf("Expect no keyring without %s, got error=%v", EncryptionKeyFile, err)
+	}
+
+	keyFile := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(keyFile, []byte(`{"k1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}`), 0600)
+	keyring, err = NewDataKeyring(BaseConfig{EncryptionKeyFile: keyFile, EncryptionKeyID: "k1"})
+	if err != nil {
+		t.Fatalf("Failed to load keyring, error=%s", err)
+	}
+
+	keyID, sealed, err := keyring.Seal([]byte("a=b"))
+	if err != nil || keyID != "k1" || string(sealed) == "a=b" {
+		t.Errorf("Expect data sealed by k1, got key=%s, error=%v", keyID, err)
+	}
+
+	// Rotation, k1 still opens the data sealed before
+	ioutil.WriteFile(keyFile, []byte(`{"k1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "k2": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}`), 0600)
+	rotated, err := NewDataKeyring(BaseConfig{EncryptionKeyFile: keyFile, EncryptionKeyID: "k2"})
+	if err != nil || rotated.KeyID() != "k2" {
+		t.Fatalf("Failed to load rotated keyring, error=%v", err)
+	}
+
+	plaintext, err := rotated.Open(keyID, sealed)
+	if err != nil || string(plaintext) != "a=b" {
+		t.Errorf("Expect a=b opened by k1, got %s, error=%v", plaintext, err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err = rotated.Open(keyID, sealed); err == nil {
+		t.Errorf("Expect error for tampered data")
+	}
+
+	if _, err = rotated.Open("k0", sealed); err == nil {
+		t.Errorf("Expect error for unknown key")
+	}
+
+	if _, err = NewDataKeyring(BaseConfig{EncryptionKeyFile: keyFile, EncryptionKeyID: "k3"}); err == nil {
+		t.Errorf("Expect error for missing %s", EncryptionKeyID)
+	}
+}
@@ -1,8 +1,31 @@
 package base
 
+import (
+	"errors"
+)
+
+// ErrSkipped is returned by IndexData when the cycle collects nothing on
+// purpose, for e.g. the last cycle has not been done or it is out of the
+// schedule windows. Such cycles are not recorded as job runs
+var ErrSkipped = errors.New("collection cycle skipped")
+
 type DataReader interface {
 	Start()
 	Stop()
 	ReadData() ([]byte, error)
 	IndexData() error
 }
+
+// CancelableDataReader is implemented by the DataReaders whose collection
+// cycle in progress can be aborted before they are stopped, so the shutdown
+// doesn't wait for it
+type CancelableDataReader interface {
+	Cancel()
+}
+
+// CatchUpDataReader is implemented by the DataReaders which collect more
+// records per request while they lag behind their source, see CatchUpLag.
+// Their jobs run every CatchUpInterval then
+type CatchUpDataReader interface {
+	CatchingUp() bool
+}
@@ -1,15 +1,54 @@
 package base
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
 )
 
+const (
+	defaultWriteTimeout = 120 * time.Second
+)
+
+// DataWriter
+// WriteDataContext returns ctx.Err() when the context is done before the
+// data is accepted by the writer. The data may still be delivered later, so
+// callers shall treat it as a failure of the current collection cycle and
+// not advance their checkpoint, the next cycle will then re-collect the data
 type DataWriter interface {
 	Start()
 	Stop()
 	WriteData(data *Data) error // can be sync or async
 	WriteDataSync(data *Data) error
 	WriteDataAsync(data *Data) error
+	WriteDataContext(ctx context.Context, data *Data) error
+}
+
+// WriteDataTimeout writes data through writer with a deadline
+// @timeout: no deadline if it is not positive
+func WriteDataTimeout(writer DataWriter, data *Data, timeout time.Duration) error {
+	if timeout <= 0 {
+		return writer.WriteDataContext(context.Background(), data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return writer.WriteDataContext(ctx, data)
+}
+
+// GetWriteTimeout returns the write deadline configured by WriteTimeout in
+// seconds, "0" disables the deadline
+func GetWriteTimeout(config BaseConfig) time.Duration {
+	if config[WriteTimeout] == "" {
+		return defaultWriteTimeout
+	}
+
+	timeout, err := strconv.ParseInt(config[WriteTimeout], 10, 64)
+	if err != nil {
+		return defaultWriteTimeout
+	}
+	return time.Duration(timeout) * time.Second
 }
 
 type StdoutDataWriter struct {
@@ -33,9 +72,55 @@ func (d *StdoutDataWriter) WriteDataAsync(data *Data) error {
 	return d.doWriteData(data)
 }
 
+func (d *StdoutDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	return d.doWriteData(data)
+}
+
 func (d *StdoutDataWriter) doWriteData(data *Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+
 	for i := 0; i < len(data.RawData); i++ {
 		fmt.Println(string(data.RawData[i]))
 	}
 	return nil
 }
+
+// QueuedDataWriter is implemented by the DataWriters which queue the data
+// before it is delivered
+type QueuedDataWriter interface {
+	QueueDepth() int
+}
+
+// QueueDepth returns the number of data queued by writer or the writer it
+// wraps, -1 if writer doesn't queue
+func QueueDepth(writer DataWriter) int {
+	for writer != nil {
+		if queued, ok := writer.(QueuedDataWriter); ok {
+			return queued.QueueDepth()
+		}
+		writer = unwrapDataWriter(writer)
+	}
+	return -1
+}
+
+// unwrapDataWriter returns the writer wrapped by writer, nil if it doesn't
+// wrap any
+func unwrapDataWriter(writer DataWriter) DataWriter {
+	switch w := writer.(type) {
+	case *CountingDataWriter:
+		return w.DataWriter
+	case *SequencingDataWriter:
+		return w.DataWriter
+	case *ThrottledDataWriter:
+		return w.DataWriter
+	case *FaultyDataWriter:
+		return w.DataWriter
+	case *BatchingDataWriter:
+		return w.DataWriter
+	case *TransformingDataWriter:
+		return w.DataWriter
+	}
+	return nil
+}
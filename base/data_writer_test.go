@@ -0,0 +1,94 @@
+package base
+
+import (
+	"testing"
+)
+
+type queuedWriter struct {
+	DataWriter
+	depth int
+}
+
+func (writer *queuedWriter) QueueDepth() int {
+	return writer.depth
+}
+
+func TestQueueDepth(t *testing.T) {
+	sink := &queuedWriter{depth: 7}
+	config := BaseConfig{SinkRecordRate: "10"}
+	writer := NewCountingDataWriter(NewSequencingDataWriter(NewThrottledDataWriter(sink, config), "task"))
+	if depth := QueueDepth(writer); depth != 7 {
+		t.Errorf("Expect queue depth of the wrapped sink, got %d", depth)
+	}
+
+	if depth := QueueDepth(NewCountingDataWriter(nil)); depth != -1 {
+		t.Errorf("Expect -1 for unknown queue depth, got %d", depth)
+	}
+}
+
+type recordingWriter struct {
+	DataWriter
+	written []*Data
+}
+
+func (writer *recordingWriter) WriteData(data *Data) error {
+	writer.written = append(writer.written, data)
+	return nil
+}
+
+func TestCountingDataWriterSerialize(t *testing.T) {
+	sink := &recordingWriter{}
+	writer := NewCountingDataWriter(NewSequencingDataWriter(sink, "task"))
+
+	records := []map[string]interface{}{{"number": "INC1"}, {"number": "INC2"}}
+	if err := writer.WriteData(NewRecordData(nil, records)); err != nil {
+		t.Errorf("Failed to write data, error=%s", err)
+	}
+
+	// Serialized once before the copy made by SequencingDataWriter
+	if len(sink.written) != 1 || len(sink.written[0].RawData) != 2 {
+		t.Errorf("Expect the sink to get serialized data, got %v", sink.written)
+	}
+
+	if n, bytes := writer.Stats(); n != 2 || bytes != int64(len(`{"number":"INC1"}`)*2) {
+		t.Errorf("Expect 2 records of 34 bytes counted, got %d and %d", n, bytes)
+	}
+
+	bad := []map[string]interface{}{{"value": make(chan int)}}
+	if err := writer.WriteData(NewRecordData(nil, bad)); err == nil {
+		t.Errorf("Expect error for records which can't be serialized")
+	}
+
+	if n, _ := writer.Stats(); n != 2 || len(sink.written) != 1 {
+		t.Errorf("Expect the data which can't be serialized neither written nor counted")
+	}
+}
+
+func TestTransformingDataWriter(t *testing.T) {
+	sink := &recordingWriter{}
+	if writer := NewTransformingDataWriter(sink); writer != sink {
+		t.Errorf("Expect the writer as is without transforms")
+	}
+
+	tag := func(data *Data) (*Data, error) {
+		data.MetaInfo["Region"] = "dc2"
+		return data, nil
+	}
+	dropEmpty := func(data *Data) (*Data, error) {
+		if data.Len() == 0 {
+			return nil, nil
+		}
+		return data, nil
+	}
+
+	writer := NewTransformingDataWriter(sink, dropEmpty, tag)
+	writer.WriteData(NewData(map[string]string{}, nil))
+	writer.WriteData(NewData(map[string]string{}, [][]byte{[]byte("k=v")}))
+	if len(sink.written) != 1 || sink.written[0].MetaInfo["Region"] != "dc2" {
+		t.Errorf("Expect the empty data dropped and the other tagged, got %v", sink.written)
+	}
+
+	if depth := QueueDepth(NewTransformingDataWriter(&queuedWriter{depth: 3}, tag)); depth != 3 {
+		t.Errorf("Expect queue depth of the wrapped sink, got %d", depth)
+	}
+}
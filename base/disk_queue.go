@@ -0,0 +1,236 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	diskQueueItemSuffix = ".item"
+	diskQueueTempSuffix = ".tmp"
+)
+
+// DiskQueue is a durable Queue of one file per item in a directory. An item
+// is synced to disk before Enqueue returns and removed by Ack, the items
+// left are redelivered in order when the directory is opened again. With a
+// DataKeyring, the items are encrypted and record the ID of their key.
+// A directory shall be opened by one DiskQueue at a time
+type DiskQueue struct {
+	state   *queueState
+	dir     string
+	keyring *DataKeyring
+}
+
+// sealedItem is an envelope encrypted by the key of KeyID
+type sealedItem struct {
+	KeyID  string
+	Sealed []byte
+}
+
+// NewDiskQueue opens the queue in dir, which is created if it doesn't exist
+// @keyring: nil to keep the items in plain text. The items encrypted before
+// can only be dequeued with their keys
+func NewDiskQueue(dir string, keyring *DataKeyring) (*DiskQueue, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		glog.Errorf("Failed to create queue directory=%s, error=%s", dir, err)
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		glog.Errorf("Failed to list queue directory=%s, error=%s", dir, err)
+		return nil, err
+	}
+
+	queue := &DiskQueue{
+		state:   newQueueState(),
+		dir:     dir,
+		keyring: keyring,
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasSuffix(name, diskQueueTempSuffix) {
+			// Not enqueued, the writer crashed before the rename
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		if !strings.HasSuffix(name, diskQueueItemSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, diskQueueItemSuffix), 10, 64)
+		if err != nil {
+			glog.Warningf("Skip unexpected file=%s in queue directory=%s", name, dir)
+			continue
+		}
+		queue.state.pending = append(queue.state.pending, id)
+		if id >= queue.state.nextID {
+			queue.state.nextID = id + 1
+		}
+	}
+	sort.Slice(queue.state.pending, func(i, j int) bool { return queue.state.pending[i] < queue.state.pending[j] })
+
+	if len(queue.state.pending) > 0 {
+		glog.Infof("Opened queue directory=%s with %d items", dir, len(queue.state.pending))
+	}
+	return queue, nil
+}
+
+func (queue *DiskQueue) itemFile(id uint64) string {
+	// Zero padded so the names sort in order too
+	return filepath.Join(queue.dir, fmt.Sprintf("%020d%s", id, diskQueueItemSuffix))
+}
+
+// Enqueue never blocks, the queue is bounded by the disk space only
+func (queue *DiskQueue) Enqueue(ctx context.Context, data *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	payload, err := EncodeEnvelope(data)
+	if err != nil {
+		return err
+	}
+
+	if queue.keyring != nil {
+		keyID, sealed, err := queue.keyring.Seal(payload)
+		if err != nil {
+			return err
+		}
+
+		payload, err = json.Marshal(&sealedItem{KeyID: keyID, Sealed: sealed})
+		if err != nil {
+			return err
+		}
+	}
+
+	state := queue.state
+	state.mutex.Lock()
+	if state.closed {
+		state.mutex.Unlock()
+		return ErrQueueClosed
+	}
+	id := state.nextID
+	state.nextID++
+	state.mutex.Unlock()
+
+	// Written aside and renamed, so a crash never leaves a partial item
+	fileName := queue.itemFile(id)
+	err = writeFileSync(fileName+diskQueueTempSuffix, payload)
+	if err == nil {
+		err = os.Rename(fileName+diskQueueTempSuffix, fileName)
+	}
+
+	if err != nil {
+		os.Remove(fileName + diskQueueTempSuffix)
+		glog.Errorf("Failed to write queue item=%s, error=%s", fileName, err)
+		return err
+	}
+
+	state.mutex.Lock()
+	state.pending = append(state.pending, id)
+	// Concurrent Enqueues may finish out of order
+	sort.Slice(state.pending, func(i, j int) bool { return state.pending[i] < state.pending[j] })
+	state.broadcast()
+	state.mutex.Unlock()
+	return nil
+}
+
+func writeFileSync(fileName string, content []byte) error {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Dequeue returns an error for the item which can't be read or decrypted,
+// it is put back to the queue, for e.g. until its key is provided
+func (queue *DiskQueue) Dequeue(ctx context.Context) (*QueueItem, error) {
+	id, err := queue.state.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := queue.readItem(id)
+	if err != nil {
+		glog.Errorf("Failed to read queue item=%s, error=%s", queue.itemFile(id), err)
+		queue.state.settle(id, true)
+		return nil, err
+	}
+	return &QueueItem{ID: id, Data: data}, nil
+}
+
+func (queue *DiskQueue) readItem(id uint64) (*Data, error) {
+	payload, err := ioutil.ReadFile(queue.itemFile(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed sealedItem
+	if err := json.Unmarshal(payload, &sealed); err == nil && sealed.KeyID != "" {
+		if queue.keyring == nil {
+			return nil, errors.New(fmt.Sprintf("Item is encrypted by key=%s but %s is not configured", sealed.KeyID, EncryptionKeyFile))
+		}
+
+		payload, err = queue.keyring.Open(sealed.KeyID, sealed.Sealed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return DecodeEnvelope(payload)
+}
+
+func (queue *DiskQueue) Ack(item *QueueItem) error {
+	if !queue.state.settle(item.ID, false) {
+		return errors.New("Item is not in flight")
+	}
+
+	err := os.Remove(queue.itemFile(item.ID))
+	if err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Failed to remove acknowledged queue item=%s, error=%s", queue.itemFile(item.ID), err)
+		return err
+	}
+	return nil
+}
+
+func (queue *DiskQueue) Nack(item *QueueItem) error {
+	if !queue.state.settle(item.ID, true) {
+		return errors.New("Item is not in flight")
+	}
+	return nil
+}
+
+func (queue *DiskQueue) Len() int {
+	return queue.state.len()
+}
+
+// Close keeps the items which are not acknowledged for the next open
+func (queue *DiskQueue) Close() error {
+	queue.state.mutex.Lock()
+	queue.state.closed = true
+	queue.state.broadcast()
+	queue.state.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,191 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEndpointProbeInterval = 60 * time.Second
+	// Weight of the latest request in the moving averages
+	endpointHealthAlpha = 0.2
+	// Latency equivalent of a failed request in the scores
+	endpointErrorPenalty = 10 * time.Second
+)
+
+var (
+	// endpointHealths are shared by the selectors of the process, the tasks
+	// of an instance measure its nodes together, endpoint indexed
+	endpointHealths      = make(map[string]*EndpointHealth)
+	endpointHealthsMutex sync.Mutex
+)
+
+// EndpointHealth is the moving average latency and error rate of the requests
+// to an endpoint
+type EndpointHealth struct {
+	Endpoint  string
+	Latency   time.Duration
+	ErrorRate float64
+	Requests  int64
+	Errors    int64
+}
+
+func (health *EndpointHealth) score() time.Duration {
+	return health.Latency + time.Duration(health.ErrorRate*float64(endpointErrorPenalty))
+}
+
+// EndpointHealthStats returns the health of the endpoints measured by the
+// process in "endpoint=latency_ms/error_rate" format, for e.g.
+// "https://node1.service-now.com=120/0.05"
+func EndpointHealthStats() []string {
+	endpointHealthsMutex.Lock()
+	defer endpointHealthsMutex.Unlock()
+
+	stats := make([]string, 0, len(endpointHealths))
+	for endpoint, health := range endpointHealths {
+		stats = append(stats, fmt.Sprintf("%s=%d/%.2f", endpoint, health.Latency.Nanoseconds()/int64(time.Millisecond), health.ErrorRate))
+	}
+	sort.Strings(stats)
+	return stats
+}
+
+// EndpointSelector picks the healthiest of equivalent endpoints, for e.g. the
+// nodes behind the load balancer of an instance, by the moving average
+// latency and error rate of the requests. The other endpoints only get
+// requests while they are not measured, so every EndpointProbeInterval one
+// request goes to the endpoint measured least recently to keep the
+// measurements up to date
+type EndpointSelector struct {
+	endpoints     []string
+	probeInterval time.Duration
+	lastProbe     time.Time
+	probed        map[string]time.Time // endpoint indexed
+	mutex         sync.Mutex
+}
+
+// NewEndpointSelector
+// @endpoints: "," separated equivalent endpoints
+// @config: EndpointProbeInterval in seconds, 60 by default
+func NewEndpointSelector(endpoints string, config BaseConfig) (*EndpointSelector, error) {
+	var urls []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+		if endpoint != "" {
+			urls = append(urls, endpoint)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, errors.New("No endpoint to select from")
+	}
+
+	probeInterval := defaultEndpointProbeInterval
+	if config[EndpointProbeInterval] != "" {
+		n, err := strconv.Atoi(config[EndpointProbeInterval])
+		if err != nil || n <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s, expect a positive integer", EndpointProbeInterval, config[EndpointProbeInterval]))
+		}
+		probeInterval = time.Duration(n) * time.Second
+	}
+
+	return &EndpointSelector{
+		endpoints:     urls,
+		probeInterval: probeInterval,
+		lastProbe:     time.Now(),
+		probed:        make(map[string]time.Time),
+	}, nil
+}
+
+// Select returns the endpoint for the next request
+func (selector *EndpointSelector) Select() string {
+	selector.mutex.Lock()
+	defer selector.mutex.Unlock()
+
+	now := time.Now()
+	selected := selector.endpoints[0]
+
+	endpointHealthsMutex.Lock()
+	var best time.Duration
+	for i, endpoint := range selector.endpoints {
+		health, ok := endpointHealths[endpoint]
+		if !ok {
+			// Unmeasured endpoints are tried first
+			endpointHealthsMutex.Unlock()
+			selector.probed[endpoint] = now
+			return endpoint
+		}
+
+		if i == 0 || health.score() < best {
+			selected, best = endpoint, health.score()
+		}
+	}
+	endpointHealthsMutex.Unlock()
+
+	if len(selector.endpoints) > 1 && now.Sub(selector.lastProbe) >= selector.probeInterval {
+		selector.lastProbe = now
+		probe := ""
+		for _, endpoint := range selector.endpoints {
+			if endpoint != selected && (probe == "" || selector.probed[endpoint].Before(selector.probed[probe])) {
+				probe = endpoint
+			}
+		}
+		selected = probe
+	}
+	selector.probed[selected] = now
+	return selected
+}
+
+// Observe records the outcome of a request to url, which starts with one of
+// the endpoints. failed is true for the failures of the endpoint, for e.g.
+// the connection errors and 5xx, rather than of the request
+func (selector *EndpointSelector) Observe(url string, latency time.Duration, failed bool) {
+	for _, endpoint := range selector.endpoints {
+		if !strings.HasPrefix(url, endpoint) || (len(url) > len(endpoint) && url[len(endpoint)] != '/') {
+			continue
+		}
+
+		endpointHealthsMutex.Lock()
+		defer endpointHealthsMutex.Unlock()
+
+		errorRate := 0.0
+		if failed {
+			errorRate = 1
+		}
+
+		health, ok := endpointHealths[endpoint]
+		if !ok {
+			health = &EndpointHealth{Endpoint: endpoint, Latency: latency, ErrorRate: errorRate}
+			endpointHealths[endpoint] = health
+		} else {
+			health.Latency = time.Duration(endpointHealthAlpha*float64(latency) + (1-endpointHealthAlpha)*float64(health.Latency))
+			health.ErrorRate = endpointHealthAlpha*errorRate + (1-endpointHealthAlpha)*health.ErrorRate
+		}
+
+		health.Requests++
+		if failed {
+			health.Errors++
+			glog.V(1).Infof("Request to endpoint=%s failed, error rate=%.2f", endpoint, health.ErrorRate)
+		}
+		return
+	}
+}
+
+// Health returns the health of the endpoints measured so far
+func (selector *EndpointSelector) Health() []EndpointHealth {
+	endpointHealthsMutex.Lock()
+	defer endpointHealthsMutex.Unlock()
+
+	var healths []EndpointHealth
+	for _, endpoint := range selector.endpoints {
+		if health, ok := endpointHealths[endpoint]; ok {
+			healths = append(healths, *health)
+		}
+	}
+	return healths
+}
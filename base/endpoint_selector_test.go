@@ -0,0 +1,62 @@
+package base
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpointSelector(t *testing.T) {
+	selector, err := NewEndpointSelector("https://node1.selector.test/, https://node2.selector.test", BaseConfig{EndpointProbeInterval: "3600"})
+	if err != nil {
+		t.Fatalf("Failed to create selector, error=%s", err)
+	}
+
+	// Unmeasured nodes first
+	if endpoint := selector.Select(); endpoint != "https://node1.selector.test" {
+		t.Errorf("Expect node1 selected, got %s", endpoint)
+	}
+	selector.Observe("https://node1.selector.test/incident.do?JSONv2", 100*time.Millisecond, false)
+
+	if endpoint := selector.Select(); endpoint != "https://node2.selector.test" {
+		t.Errorf("Expect node2 selected, got %s", endpoint)
+	}
+	selector.Observe("https://node2.selector.test/incident.do?JSONv2", 50*time.Millisecond, false)
+
+	if endpoint := selector.Select(); endpoint != "https://node2.selector.test" {
+		t.Errorf("Expect the faster node2 selected, got %s", endpoint)
+	}
+
+	// Failures outweigh the latency
+	selector.Observe("https://node2.selector.test/incident.do?JSONv2", 50*time.Millisecond, true)
+	if endpoint := selector.Select(); endpoint != "https://node1.selector.test" {
+		t.Errorf("Expect node1 selected after node2 failed, got %s", endpoint)
+	}
+
+	// The node which is not in use is probed
+	selector.lastProbe = time.Now().Add(-2 * time.Hour)
+	if endpoint := selector.Select(); endpoint != "https://node2.selector.test" {
+		t.Errorf("Expect node2 probed, got %s", endpoint)
+	}
+
+	// Not one of the nodes
+	selector.Observe("https://node10.selector.test/incident.do", time.Second, true)
+	healths := selector.Health()
+	if len(healths) != 2 || healths[1].Requests != 2 || healths[1].Errors != 1 {
+		t.Errorf("Unexpected health=%+v", healths)
+	}
+
+	found := false
+	for _, stat := range EndpointHealthStats() {
+		if strings.HasPrefix(stat, "https://node1.selector.test=100/0.00") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expect node1 in stats, got %s", EndpointHealthStats())
+	}
+
+	if _, err := NewEndpointSelector(" , ", BaseConfig{}); err == nil {
+		t.Errorf("Expect error without endpoints")
+	}
+}
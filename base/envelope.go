@@ -0,0 +1,92 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	EnvelopeVersion = "1"
+)
+
+// Envelope is the stable wire format of Data in Kafka, so that the whole
+// MetaInfo, for e.g. ServerURL, Metric and the sequence numbers, survives
+// source -> Kafka -> reader -> sink hops between descartes instances.
+// Envelopes without Version are the plain JSON of Data written by the
+// earlier releases, which have the same layout
+type Envelope struct {
+	Version  string `json:",omitempty"`
+	MetaInfo map[string]string
+	RawData  [][]byte
+}
+
+// EncodeEnvelope serializes data and marshals it in an Envelope
+func EncodeEnvelope(data *Data) ([]byte, error) {
+	if err := data.Serialize(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&Envelope{
+		Version:  EnvelopeVersion,
+		MetaInfo: data.MetaInfo,
+		RawData:  data.RawData,
+	})
+}
+
+// DecodeEnvelope unmarshals an Envelope into Data, which owns its MetaInfo
+// so that the readers may change it before writing the data on
+func DecodeEnvelope(payload []byte) (*Data, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Version != "" && envelope.Version != EnvelopeVersion {
+		return nil, errors.New(fmt.Sprintf("Unsupported envelope version=%s", envelope.Version))
+	}
+
+	if envelope.MetaInfo == nil {
+		envelope.MetaInfo = make(map[string]string)
+	}
+	return NewData(envelope.MetaInfo, envelope.RawData), nil
+}
+
+// DecodeMessage decodes the payload of a message written by any producer:
+// an Envelope or the plain JSON of Data, see DecodeEnvelope, or a raw JSON
+// record or array of records, which become the RawData of Data in JSON
+// Serialization
+func DecodeMessage(payload []byte) (*Data, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 {
+		return nil, errors.New("Empty message payload")
+	}
+
+	switch trimmed[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return nil, err
+		}
+
+		// Both the Envelope and Data carry RawData
+		if _, ok := fields["RawData"]; ok {
+			return DecodeEnvelope(trimmed)
+		}
+		return NewData(map[string]string{Serialization: FormatJSON}, [][]byte{trimmed}), nil
+
+	case '[':
+		var records []json.RawMessage
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, err
+		}
+
+		rawData := make([][]byte, 0, len(records))
+		for _, record := range records {
+			rawData = append(rawData, []byte(record))
+		}
+		return NewData(map[string]string{Serialization: FormatJSON}, rawData), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unrecognized message payload starting with %q", trimmed[0]))
+}
@@ -0,0 +1,84 @@
+package base
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	metaInfo := map[string]string{
+		ServerURL:     "https://acme.service-now.com",
+		Metric:        "incident",
+		TaskConfigKey: "task",
+		RecordSeq:     "11",
+	}
+	records := []map[string]interface{}{{"number": "INC1"}, {"number": "INC2"}}
+
+	payload, err := EncodeEnvelope(NewRecordData(metaInfo, records))
+	if err != nil {
+		t.Fatalf("Failed to encode envelope, error=%s", err)
+	}
+
+	data, err := DecodeEnvelope(payload)
+	if err != nil {
+		t.Fatalf("Failed to decode envelope, error=%s", err)
+	}
+
+	if len(data.MetaInfo) != len(metaInfo) {
+		t.Errorf("Expect MetaInfo=%v, got %v", metaInfo, data.MetaInfo)
+	}
+	for k, v := range metaInfo {
+		if data.MetaInfo[k] != v {
+			t.Errorf("Expect %s=%s, got %s", k, v, data.MetaInfo[k])
+		}
+	}
+
+	if len(data.RawData) != 2 || string(data.RawData[1]) != `{"number":"INC2"}` {
+		t.Errorf("Expect the serialized records, got %s", data.RawData)
+	}
+
+	// Written by the earlier releases
+	legacy, _ := json.Marshal(NewData(map[string]string{Host: "collector1"}, [][]byte{[]byte("k=v")}))
+	data, err = DecodeEnvelope(legacy)
+	if err != nil || data.MetaInfo[Host] != "collector1" || string(data.RawData[0]) != "k=v" {
+		t.Errorf("Expect the legacy format decoded, got %v, error=%v", data, err)
+	}
+
+	data, err = DecodeEnvelope([]byte(`{"RawData": null}`))
+	if err != nil || data.MetaInfo == nil {
+		t.Errorf("Expect writable MetaInfo, got %v, error=%v", data, err)
+	}
+
+	if _, err = DecodeEnvelope([]byte(`{"Version": "2"}`)); err == nil {
+		t.Errorf("Expect error for unsupported envelope version")
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	payload, _ := EncodeEnvelope(NewData(map[string]string{Metric: "incident"}, [][]byte{[]byte("k=v")}))
+	data, err := DecodeMessage(payload)
+	if err != nil || data.MetaInfo[Metric] != "incident" || string(data.RawData[0]) != "k=v" {
+		t.Errorf("Expect the envelope decoded, got %v, error=%v", data, err)
+	}
+
+	data, err = DecodeMessage([]byte(` {"number": "INC1"}`))
+	if err != nil || data.MetaInfo[Serialization] != FormatJSON || len(data.RawData) != 1 {
+		t.Fatalf("Expect the raw JSON record decoded, got %v, error=%v", data, err)
+	}
+
+	records, err := data.ParseRecords()
+	if err != nil || records[0]["number"] != "INC1" {
+		t.Errorf("Expect record INC1, got %v, error=%v", records, err)
+	}
+
+	data, err = DecodeMessage([]byte(`[{"number": "INC1"}, {"number": "INC2"}]`))
+	if err != nil || len(data.RawData) != 2 || string(data.RawData[1]) != `{"number": "INC2"}` {
+		t.Errorf("Expect the raw JSON records decoded, got %v, error=%v", data, err)
+	}
+
+	for _, bad := range []string{"", "k=v", `{"number": `} {
+		if _, err := DecodeMessage([]byte(bad)); err == nil {
+			t.Errorf("Expect error for payload %q", bad)
+		}
+	}
+}
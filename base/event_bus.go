@@ -0,0 +1,76 @@
+package base
+
+import (
+	"github.com/golang/glog"
+	"sync"
+)
+
+const (
+	// Topic of the changed global configs, see DiffConfig
+	ConfigReloadTopic = "ConfigReload"
+	// Topic of the failed job runs, see JobRun.Event
+	JobFailureTopic = "JobFailure"
+	// Topic of the data skipped by the readers, see OffsetGap.Event and
+	// TimeGap.Event
+	DataGapTopic = "DataGap"
+
+	eventBusBuffer = 16
+)
+
+// EventBus delivers in-process events to the subscribers of a topic. Publish
+// never blocks, the event is dropped for a subscriber whose buffer is full
+type EventBus struct {
+	subscribers map[string][]chan BaseConfig // topic indexed
+	closed      bool
+	lockGuard   sync.Mutex
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string][]chan BaseConfig),
+	}
+}
+
+// Subscribe returns a channel which receives the events of topic. The
+// channel is closed when the bus is closed
+func (bus *EventBus) Subscribe(topic string) <-chan BaseConfig {
+	eventChan := make(chan BaseConfig, eventBusBuffer)
+	bus.lockGuard.Lock()
+	defer bus.lockGuard.Unlock()
+
+	if bus.closed {
+		close(eventChan)
+		return eventChan
+	}
+	bus.subscribers[topic] = append(bus.subscribers[topic], eventChan)
+	return eventChan
+}
+
+func (bus *EventBus) Publish(topic string, event BaseConfig) {
+	bus.lockGuard.Lock()
+	defer bus.lockGuard.Unlock()
+
+	for _, eventChan := range bus.subscribers[topic] {
+		select {
+		case eventChan <- event:
+		default:
+			glog.Warningf("Event subscriber of topic=%s is slow, drop event=%s", topic, event)
+		}
+	}
+}
+
+func (bus *EventBus) Close() {
+	bus.lockGuard.Lock()
+	defer bus.lockGuard.Unlock()
+
+	if bus.closed {
+		return
+	}
+	bus.closed = true
+
+	for _, subscribers := range bus.subscribers {
+		for _, eventChan := range subscribers {
+			close(eventChan)
+		}
+	}
+}
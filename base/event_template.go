@@ -0,0 +1,164 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// Fields of the EventTemplates besides the MetaInfo of the data and the
+	// sink configs
+	TemplateRecord       = "Record"       // the record as it is
+	TemplateRecordString = "RecordString" // the record as JSON string content
+	TemplateHost         = "Host"         // the host name of the collector
+	TemplateEndpoint     = "Endpoint"     // ServerURL of the data
+)
+
+// templateSecretSuffixes are the suffixes of the sink configs which can't be
+// referenced by the templates, the events would leak them
+var templateSecretSuffixes = []string{"Password", "Secret", "Token"}
+
+type templateSegment struct {
+	literal []byte
+	field   string // empty for the literals
+}
+
+// EventTemplate wraps each record in an envelope, for e.g.
+// `{"source":"{{.Endpoint}}","host":"{{.Host}}","event":{{.Record}}}`.
+// The template is parsed once, "{{.Field}}" is replaced with the MetaInfo
+// of the data or else the sink config named Field, escaped as JSON string
+// content. Record is inserted as it is, so it shall be in a format valid
+// in the envelope, RecordString escaped like the other fields
+type EventTemplate struct {
+	segments []templateSegment
+	config   BaseConfig
+	host     string
+}
+
+// NewEventTemplate
+// @text: the template, "{{" and "}}" are not escapable
+// @config: the configs of the sink, referenced by the fields not in MetaInfo
+func NewEventTemplate(text string, config BaseConfig) (*EventTemplate, error) {
+	var segments []templateSegment
+	rest := text
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			segments = append(segments, templateSegment{literal: []byte(rest)})
+			break
+		}
+
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, errors.New(fmt.Sprintf("Unclosed {{ in event template=%s", text))
+		}
+		end += start
+
+		field := strings.TrimSpace(rest[start+2 : end])
+		if !strings.HasPrefix(field, ".") || len(field) == 1 || strings.ContainsAny(field[1:], " .{}") {
+			return nil, errors.New(fmt.Sprintf("Invalid field=%s in event template, expect {{.Field}}", field))
+		}
+		field = field[1:]
+
+		for _, suffix := range templateSecretSuffixes {
+			if strings.HasSuffix(field, suffix) {
+				return nil, errors.New(fmt.Sprintf("Secret field=%s can't be referenced by event template", field))
+			}
+		}
+
+		if start > 0 {
+			segments = append(segments, templateSegment{literal: []byte(rest[:start])})
+		}
+		segments = append(segments, templateSegment{field: field})
+		rest = rest[end+2:]
+	}
+
+	host, _ := os.Hostname()
+	return &EventTemplate{
+		segments: segments,
+		config:   config,
+		host:     host,
+	}, nil
+}
+
+// Render returns the records of data wrapped in the template, joined by "\n".
+// The fields are resolved once for all of the records
+// @records: the records of data in the format of the sink
+func (tmpl *EventTemplate) Render(data *Data, records [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(records) * (tmpl.size() + 256))
+	tmpl.RenderTo(&buf, data, records)
+	return buf.Bytes()
+}
+
+// RenderTo writes what Render returns to w record by record
+func (tmpl *EventTemplate) RenderTo(w io.Writer, data *Data, records [][]byte) error {
+	values := make([][]byte, len(tmpl.segments))
+	for i, segment := range tmpl.segments {
+		if segment.field != "" && segment.field != TemplateRecord && segment.field != TemplateRecordString {
+			values[i] = escapeJSONString(tmpl.lookup(data, segment.field))
+		}
+	}
+
+	for n, record := range records {
+		if n > 0 {
+			if _, err := w.Write([]byte{'\n'}); err != nil {
+				return err
+			}
+		}
+
+		for i, segment := range tmpl.segments {
+			var err error
+			switch segment.field {
+			case "":
+				_, err = w.Write(segment.literal)
+			case TemplateRecord:
+				_, err = w.Write(record)
+			case TemplateRecordString:
+				_, err = w.Write(escapeJSONString(string(record)))
+			default:
+				_, err = w.Write(values[i])
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// size returns the size of the literals
+func (tmpl *EventTemplate) size() int {
+	size := 0
+	for _, segment := range tmpl.segments {
+		size += len(segment.literal)
+	}
+	return size
+}
+
+func (tmpl *EventTemplate) lookup(data *Data, field string) string {
+	if value, ok := data.MetaInfo[field]; ok {
+		return value
+	}
+
+	switch field {
+	case TemplateHost:
+		return tmpl.host
+	case TemplateEndpoint:
+		return data.MetaInfo[ServerURL]
+	}
+	return tmpl.config[field]
+}
+
+// escapeJSONString returns value escaped as the content of a JSON string,
+// without the quotes
+func escapeJSONString(value string) []byte {
+	quoted, _ := json.Marshal(value)
+	return quoted[1 : len(quoted)-1]
+}
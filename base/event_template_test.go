@@ -0,0 +1,36 @@
+package base
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEventTemplate(t *testing.T) {
+	config := BaseConfig{Index: "main", Password: "secret"}
+	tmpl, err := NewEventTemplate(`{"source":"{{.Endpoint}}","host":"{{.Host}}","index":"{{ .Index }}","event":{{.Record}}}`, config)
+	if err != nil {
+		t.Fatalf("Failed to parse template, error=%s", err)
+	}
+
+	data := NewData(map[string]string{ServerURL: `https://x.service-now.com/"a"`}, nil)
+	host, _ := os.Hostname()
+	rendered := string(tmpl.Render(data, [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}))
+	expected := `{"source":"https://x.service-now.com/\"a\"","host":"` + host + `","index":"main","event":{"a":1}}` + "\n" +
+		`{"source":"https://x.service-now.com/\"a\"","host":"` + host + `","index":"main","event":{"b":2}}`
+	if rendered != expected {
+		t.Errorf("Expect %s, got %s", expected, rendered)
+	}
+
+	// ES bulk action lines
+	tmpl, _ = NewEventTemplate("{\"index\":{\"_index\":\"{{.Index}}\"}}\n{\"message\":\"{{.RecordString}}\"}", config)
+	rendered = string(tmpl.Render(data, [][]byte{[]byte(`a="1"`)}))
+	if rendered != "{\"index\":{\"_index\":\"main\"}}\n{\"message\":\"a=\\\"1\\\"\"}" {
+		t.Errorf("Unexpected bulk rendering=%s", rendered)
+	}
+
+	for _, text := range []string{"{{.Password}}", "{{.Index", "{{Index}}", "{{.}}", "{{.a.b}}"} {
+		if _, err := NewEventTemplate(text, config); err == nil {
+			t.Errorf("Expect template=%s rejected", text)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package base
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type NodeStatus int32
+
+const (
+	NodeAlive NodeStatus = iota
+	NodeSuspected
+	NodeDead
+)
+
+const (
+	defaultHeartbeatInterval  = 30 * time.Second
+	defaultHeartbeatMaxMissed = 2
+)
+
+func (status NodeStatus) String() string {
+	switch status {
+	case NodeAlive:
+		return "Alive"
+	case NodeSuspected:
+		return "Suspected"
+	case NodeDead:
+		return "Dead"
+	}
+	return "Unknown"
+}
+
+// FailureDetector is a missed-N heartbeat failure detector. A node is
+// suspected after missing maxMissed heartbeats and is dead when no heartbeat
+// arrives within the suspicion timeout after that
+type FailureDetector struct {
+	interval  time.Duration
+	maxMissed int
+	suspicion time.Duration
+	lastBeats map[string]int64 // node indexed, nano seconds since epoch
+	lockGuard sync.RWMutex
+}
+
+func NewFailureDetector(interval time.Duration, maxMissed int, suspicion time.Duration) *FailureDetector {
+	return &FailureDetector{
+		interval:  interval,
+		maxMissed: maxMissed,
+		suspicion: suspicion,
+		lastBeats: make(map[string]int64),
+	}
+}
+
+// NewFailureDetectorFromConfig
+// @config: contains HeartbeatInterval, HeartbeatSuspicion in seconds
+// and HeartbeatMaxMissed. Default to 30 seconds, 1 interval and 2 beats
+func NewFailureDetectorFromConfig(config BaseConfig) *FailureDetector {
+	interval := GetHeartbeatInterval(config)
+	maxMissed, err := strconv.Atoi(config[HeartbeatMaxMissed])
+	if err != nil || maxMissed <= 0 {
+		maxMissed = defaultHeartbeatMaxMissed
+	}
+
+	suspicion := interval
+	if timeout, err := strconv.Atoi(config[HeartbeatSuspicion]); err == nil && timeout >= 0 {
+		suspicion = time.Duration(timeout) * time.Second
+	}
+	return NewFailureDetector(interval, maxMissed, suspicion)
+}
+
+// GetHeartbeatInterval returns HeartbeatInterval in the config, default to
+// 30 seconds
+func GetHeartbeatInterval(config BaseConfig) time.Duration {
+	interval, err := strconv.Atoi(config[HeartbeatInterval])
+	if err != nil || interval <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+func (detector *FailureDetector) Interval() time.Duration {
+	return detector.interval
+}
+
+// Heartbeat records the heartbeat of the node
+// @when: nano seconds since epoch
+func (detector *FailureDetector) Heartbeat(node string, when int64) {
+	detector.lockGuard.Lock()
+	if when > detector.lastBeats[node] {
+		detector.lastBeats[node] = when
+	}
+	detector.lockGuard.Unlock()
+}
+
+func (detector *FailureDetector) Remove(node string) {
+	detector.lockGuard.Lock()
+	delete(detector.lastBeats, node)
+	detector.lockGuard.Unlock()
+}
+
+// Status returns the status of the node at now (nano seconds since epoch).
+// A node which has never sent a heartbeat is considered alive
+func (detector *FailureDetector) Status(node string, now int64) NodeStatus {
+	detector.lockGuard.RLock()
+	lastBeat, ok := detector.lastBeats[node]
+	detector.lockGuard.RUnlock()
+
+	if !ok {
+		return NodeAlive
+	}
+
+	suspectAfter := int64(detector.interval) * int64(detector.maxMissed)
+	elapsed := now - lastBeat
+	if elapsed <= suspectAfter {
+		return NodeAlive
+	} else if elapsed <= suspectAfter+int64(detector.suspicion) {
+		return NodeSuspected
+	}
+	return NodeDead
+}
@@ -0,0 +1,42 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureDetector(t *testing.T) {
+	detector := NewFailureDetectorFromConfig(BaseConfig{
+		HeartbeatInterval:  "10",
+		HeartbeatMaxMissed: "3",
+		HeartbeatSuspicion: "5",
+	})
+
+	node := "host1!snow"
+	now := time.Now().UnixNano()
+	if status := detector.Status(node, now); status != NodeAlive {
+		t.Errorf("Unknown node should be alive, got %s", status)
+	}
+
+	detector.Heartbeat(node, now)
+	detector.Heartbeat(node, now-int64(time.Minute))
+
+	cases := map[time.Duration]NodeStatus{
+		29 * time.Second: NodeAlive,
+		30 * time.Second: NodeAlive,
+		31 * time.Second: NodeSuspected,
+		35 * time.Second: NodeSuspected,
+		36 * time.Second: NodeDead,
+	}
+
+	for elapsed, expected := range cases {
+		if status := detector.Status(node, now+int64(elapsed)); status != expected {
+			t.Errorf("Expect %s after %s, got %s", expected, elapsed, status)
+		}
+	}
+
+	detector.Remove(node)
+	if status := detector.Status(node, now+int64(time.Hour)); status != NodeAlive {
+		t.Errorf("Removed node should be alive, got %s", status)
+	}
+}
@@ -0,0 +1,222 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	FaultInjection           = "FaultInjection"
+	FaultHTTPErrorRate       = "FaultHTTPErrorRate"
+	FaultHTTPDelayRate       = "FaultHTTPDelayRate"
+	FaultHTTPDelay           = "FaultHTTPDelay"
+	FaultWriteErrorRate      = "FaultWriteErrorRate"
+	FaultCheckpointErrorRate = "FaultCheckpointErrorRate"
+)
+
+// ErrInjectedFault is the failure made up by the fault injection
+var ErrInjectedFault = errors.New("injected fault")
+
+var injectedFaults int64
+
+// InjectedFaults returns the number of faults injected by the process
+func InjectedFaults() int64 {
+	return atomic.LoadInt64(&injectedFaults)
+}
+
+// FaultInjector fails or slows down the operations at random for resilience
+// testing in staging, for e.g. of the retries, the spool and the failover.
+// It only takes effect when FaultInjection is "1", the rates are the
+// probabilities in [0, 1] of an operation being affected:
+// FaultHTTPErrorRate of the HTTP requests answered by 502 Bad Gateway,
+// FaultHTTPDelayRate of them delayed by FaultHTTPDelay, for e.g. "30s",
+// FaultWriteErrorRate of the writes to Kafka failed,
+// FaultCheckpointErrorRate of the checkpoint writes failed
+type FaultInjector struct {
+	httpErrorRate       float64
+	httpDelayRate       float64
+	httpDelay           time.Duration
+	writeErrorRate      float64
+	checkpointErrorRate float64
+	random              *rand.Rand
+	lockGuard           sync.Mutex
+}
+
+// NewFaultInjector returns nil if FaultInjection is not "1"
+func NewFaultInjector(config BaseConfig) *FaultInjector {
+	if config[FaultInjection] != "1" {
+		return nil
+	}
+
+	rate := func(key string) float64 {
+		r, err := strconv.ParseFloat(config[key], 64)
+		if config[key] != "" && (err != nil || r < 0 || r > 1) {
+			glog.Errorf("Invalid %s=%s, expect a rate in [0, 1], no fault is injected", key, config[key])
+			return 0
+		}
+		return r
+	}
+
+	injector := &FaultInjector{
+		httpErrorRate:       rate(FaultHTTPErrorRate),
+		httpDelayRate:       rate(FaultHTTPDelayRate),
+		writeErrorRate:      rate(FaultWriteErrorRate),
+		checkpointErrorRate: rate(FaultCheckpointErrorRate),
+		random:              rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if config[FaultHTTPDelay] != "" {
+		delay, err := time.ParseDuration(config[FaultHTTPDelay])
+		if err != nil || delay < 0 {
+			glog.Errorf("Invalid %s=%s, no delay is injected", FaultHTTPDelay, config[FaultHTTPDelay])
+		} else {
+			injector.httpDelay = delay
+		}
+	}
+
+	glog.Warningf("Fault injection is enabled, not for production use")
+	return injector
+}
+
+// hit returns true with the probability rate, and counts it as a fault
+func (injector *FaultInjector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	injector.lockGuard.Lock()
+	hit := injector.random.Float64() < rate
+	injector.lockGuard.Unlock()
+
+	if hit {
+		atomic.AddInt64(&injectedFaults, 1)
+	}
+	return hit
+}
+
+// WrapTransport returns next injecting the HTTP faults, next as is if there
+// is none to inject
+func (injector *FaultInjector) WrapTransport(next http.RoundTripper) http.RoundTripper {
+	if injector == nil || (injector.httpErrorRate <= 0 && (injector.httpDelayRate <= 0 || injector.httpDelay <= 0)) {
+		return next
+	}
+	return &faultyRoundTripper{next: next, injector: injector}
+}
+
+// WrapDataWriter returns writer failing FaultWriteErrorRate of the writes,
+// writer as is if there is no fault to inject
+func (injector *FaultInjector) WrapDataWriter(writer DataWriter) DataWriter {
+	if injector == nil || injector.writeErrorRate <= 0 || writer == nil {
+		return writer
+	}
+	return &FaultyDataWriter{DataWriter: writer, injector: injector}
+}
+
+// WrapCheckpointer returns checkpoint failing FaultCheckpointErrorRate of
+// the checkpoint writes, checkpoint as is if there is no fault to inject
+func (injector *FaultInjector) WrapCheckpointer(checkpoint Checkpointer) Checkpointer {
+	if injector == nil || injector.checkpointErrorRate <= 0 || checkpoint == nil {
+		return checkpoint
+	}
+	return &FaultyCheckpointer{Checkpointer: checkpoint, injector: injector}
+}
+
+type faultyRoundTripper struct {
+	next     http.RoundTripper
+	injector *FaultInjector
+}
+
+func (rt *faultyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.injector.httpDelay > 0 && rt.injector.hit(rt.injector.httpDelayRate) {
+		select {
+		case <-time.After(rt.injector.httpDelay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if rt.injector.hit(rt.injector.httpErrorRate) {
+		glog.Warningf("Inject HTTP error for %s", req.URL.Host)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			Status:     "502 Bad Gateway",
+			StatusCode: http.StatusBadGateway,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(ErrInjectedFault.Error()))),
+			Request:    req,
+		}, nil
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// FaultyDataWriter fails some of the writes of the wrapped DataWriter before
+// they reach it, see FaultInjector
+type FaultyDataWriter struct {
+	DataWriter
+	injector *FaultInjector
+}
+
+func (writer *FaultyDataWriter) fail() error {
+	if writer.injector.hit(writer.injector.writeErrorRate) {
+		glog.Warningf("Inject write error")
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+func (writer *FaultyDataWriter) WriteData(data *Data) error {
+	if err := writer.fail(); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteData(data)
+}
+
+func (writer *FaultyDataWriter) WriteDataSync(data *Data) error {
+	if err := writer.fail(); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataSync(data)
+}
+
+func (writer *FaultyDataWriter) WriteDataAsync(data *Data) error {
+	if err := writer.fail(); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataAsync(data)
+}
+
+func (writer *FaultyDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	if err := writer.fail(); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataContext(ctx, data)
+}
+
+// FaultyCheckpointer fails some of the checkpoint writes of the wrapped
+// Checkpointer, the reads are not affected, see FaultInjector
+type FaultyCheckpointer struct {
+	Checkpointer
+	injector *FaultInjector
+}
+
+func (checkpoint *FaultyCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	if checkpoint.injector.hit(checkpoint.injector.checkpointErrorRate) {
+		glog.Warningf("Inject checkpoint write error for key=%s", keyInfo[Key])
+		return ErrInjectedFault
+	}
+	return checkpoint.Checkpointer.WriteCheckpoint(keyInfo, value)
+}
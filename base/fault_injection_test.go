@@ -0,0 +1,61 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFaultInjector(t *testing.T) {
+	if injector := NewFaultInjector(BaseConfig{FaultWriteErrorRate: "1"}); injector != nil {
+		t.Errorf("Expect no fault injected without %s", FaultInjection)
+	}
+
+	writer := &StdoutDataWriter{}
+	if w := NewFaultInjector(BaseConfig{FaultInjection: "1"}).WrapDataWriter(writer); w != writer {
+		t.Errorf("Expect the writer as is without fault to inject")
+	}
+
+	config := BaseConfig{
+		FaultInjection:           "1",
+		FaultHTTPErrorRate:       "1",
+		FaultWriteErrorRate:      "1",
+		FaultCheckpointErrorRate: "1",
+	}
+	injector := NewFaultInjector(config)
+	faults := InjectedFaults()
+
+	if err := injector.WrapDataWriter(writer).WriteData(NewData(nil, nil)); err != ErrInjectedFault {
+		t.Errorf("Expect the write failed, got error=%v", err)
+	}
+
+	ck := injector.WrapCheckpointer(NewNullCheckpointer())
+	if err := ck.WriteCheckpoint(BaseConfig{Key: "/snow/incident"}, []byte("{}")); err != ErrInjectedFault {
+		t.Errorf("Expect the checkpoint write failed, got error=%v", err)
+	}
+
+	if _, err := ck.GetCheckpoint(BaseConfig{Key: "/snow/incident"}); err != nil {
+		t.Errorf("Expect the checkpoint reads not affected, got error=%v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(config, 0)
+	if err != nil {
+		t.Fatalf("Failed to create http client, error=%s", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expect a made up response, got error=%s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expect 502 injected, got %s", resp.Status)
+	}
+
+	if n := InjectedFaults() - faults; n != 3 {
+		t.Errorf("Expect 3 faults injected, got %d", n)
+	}
+}
@@ -0,0 +1,227 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatKV     = "kv"
+	// Schema based formats, they are not built in. Builds which provide
+	// them register the factories under these names with RegisterFormat
+	FormatAvro     = "avro"
+	FormatProtobuf = "protobuf"
+	FormatMsgpack  = "msgpack"
+)
+
+// Format serializes the records of Data. The sources record the Format of
+// RawData in MetaInfo Serialization, JSON if it is missing, so the sinks and
+// transforms can parse it and the sinks can convert it to their own Format.
+// Implementations shall be safe for concurrent use
+type Format interface {
+	Name() string
+	Encode(record map[string]interface{}) ([]byte, error)
+	Decode(raw []byte) (map[string]interface{}, error)
+	// Join frames the encoded records into one payload
+	Join(raws [][]byte) []byte
+}
+
+// FormatFactory creates a Format with the SortFields and FieldOrder configs
+type FormatFactory func(config BaseConfig) (Format, error)
+
+var (
+	formatFactories = map[string]FormatFactory{
+		FormatJSON:   newJSONFormat,
+		FormatNDJSON: newNDJSONFormat,
+		FormatKV:     newKVFormat,
+	}
+	formatMutex sync.RWMutex
+)
+
+// RegisterFormat makes a format available by name in NewFormat
+func RegisterFormat(name string, factory FormatFactory) {
+	formatMutex.Lock()
+	formatFactories[name] = factory
+	formatMutex.Unlock()
+}
+
+// NewFormat
+// @config: contains Serialization ("json", "ndjson", "kv" or a registered
+// format) and the field order configs of NewRecordEncoder
+// @defaultName: used if Serialization is not set
+func NewFormat(config BaseConfig, defaultName string) (Format, error) {
+	name := config[Serialization]
+	if name == "" {
+		name = defaultName
+	}
+
+	formatMutex.RLock()
+	factory, ok := formatFactories[name]
+	formatMutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unsupported serialization format=%s", name))
+	}
+	return factory(config)
+}
+
+// dataFormat returns the Format of the RawData of data
+func dataFormat(data *Data) (Format, error) {
+	return NewFormat(BaseConfig{Serialization: data.MetaInfo[Serialization]}, FormatJSON)
+}
+
+// EncodeData returns the records of data in format as one payload. RawData is
+// re-encoded only if it is in a different format
+func EncodeData(data *Data, format Format) ([]byte, error) {
+	raws, err := EncodeRecords(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return format.Join(raws), nil
+}
+
+// EncodeRecords returns the records of data in format, RawData as it is if it
+// is in format already
+func EncodeRecords(data *Data, format Format) ([][]byte, error) {
+	from, err := dataFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = data.Serialize(); err != nil {
+		return nil, err
+	}
+
+	if from.Name() == format.Name() {
+		return data.RawData, nil
+	}
+
+	records, err := data.ParseRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	raws := make([][]byte, 0, len(records))
+	for _, record := range records {
+		raw, err := format.Encode(record)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, raw)
+	}
+	return raws, nil
+}
+
+// jsonFormat joins the records as a JSON array
+type jsonFormat struct {
+	encoder *RecordEncoder
+}
+
+func newJSONFormat(config BaseConfig) (Format, error) {
+	return &jsonFormat{encoder: NewRecordEncoder(config)}, nil
+}
+
+func (format *jsonFormat) Name() string {
+	return FormatJSON
+}
+
+func (format *jsonFormat) Encode(record map[string]interface{}) ([]byte, error) {
+	return format.encoder.EncodeJSON(record)
+}
+
+func (format *jsonFormat) Decode(raw []byte) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (format *jsonFormat) Join(raws [][]byte) []byte {
+	return append(append([]byte{'['}, bytes.Join(raws, []byte{','})...), ']')
+}
+
+// ndjsonFormat joins the records one JSON object per line
+type ndjsonFormat struct {
+	jsonFormat
+}
+
+func newNDJSONFormat(config BaseConfig) (Format, error) {
+	return &ndjsonFormat{jsonFormat{encoder: NewRecordEncoder(config)}}, nil
+}
+
+func (format *ndjsonFormat) Name() string {
+	return FormatNDJSON
+}
+
+func (format *ndjsonFormat) Join(raws [][]byte) []byte {
+	return joinLines(raws)
+}
+
+// kvFormat encodes the records as k1="v1",k2="v2" one per line, the values
+// are decoded as strings
+type kvFormat struct {
+	encoder *RecordEncoder
+}
+
+func newKVFormat(config BaseConfig) (Format, error) {
+	return &kvFormat{encoder: NewRecordEncoder(config)}, nil
+}
+
+func (format *kvFormat) Name() string {
+	return FormatKV
+}
+
+func (format *kvFormat) Encode(record map[string]interface{}) ([]byte, error) {
+	return format.encoder.EncodeKV(record), nil
+}
+
+func (format *kvFormat) Decode(raw []byte) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+	s := string(raw)
+	for len(s) > 0 {
+		eq := strings.Index(s, `="`)
+		if eq <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid k=\"v\" record=%s", raw))
+		}
+		key := s[:eq]
+		s = s[eq+2:]
+
+		// The values are not escaped, a value ends at the quote followed by
+		// the next field separator or the end of the record
+		end := strings.Index(s, `",`)
+		if end < 0 {
+			if !strings.HasSuffix(s, `"`) {
+				return nil, errors.New(fmt.Sprintf("Invalid k=\"v\" record=%s", raw))
+			}
+			end = len(s) - 1
+		}
+		record[key] = s[:end]
+		s = s[end+1:]
+		s = strings.TrimPrefix(s, ",")
+	}
+	return record, nil
+}
+
+func (format *kvFormat) Join(raws [][]byte) []byte {
+	return joinLines(raws)
+}
+
+func joinLines(raws [][]byte) []byte {
+	size := 0
+	for _, raw := range raws {
+		size += len(raw) + 1
+	}
+
+	buf := make([]byte, 0, size)
+	for _, raw := range raws {
+		buf = append(buf, raw...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
@@ -0,0 +1,55 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	if _, err := NewFormat(BaseConfig{Serialization: FormatAvro}, FormatJSON); err == nil {
+		t.Errorf("Expect error for unregistered format=%s", FormatAvro)
+	}
+
+	kv, err := NewFormat(BaseConfig{SortFields: "1"}, FormatKV)
+	if err != nil || kv.Name() != FormatKV {
+		t.Fatalf("Expect kv format by default, got error=%v", err)
+	}
+
+	raw, _ := kv.Encode(map[string]interface{}{"number": "INC1", "short_description": "a, \"b\""})
+	if string(raw) != `number="INC1",short_description="a, "b""` {
+		t.Errorf("Unexpected kv record=%s", raw)
+	}
+
+	record, err := kv.Decode(raw)
+	if err != nil || record["number"] != "INC1" || record["short_description"] != `a, "b"` {
+		t.Errorf("Unexpected decoded record=%v, error=%v", record, err)
+	}
+
+	if _, err = kv.Decode([]byte("k=v")); err == nil {
+		t.Errorf("Expect error for invalid kv record")
+	}
+
+	// kv data converted to the JSON array of a sink
+	data := NewData(map[string]string{Serialization: FormatKV}, [][]byte{raw})
+	jsonFormat, _ := NewFormat(BaseConfig{Serialization: FormatJSON}, "")
+	payload, err := EncodeData(data, jsonFormat)
+	if err != nil || string(payload) != `[{"number":"INC1","short_description":"a, \"b\""}]` {
+		t.Errorf("Unexpected json payload=%s, error=%v", payload, err)
+	}
+
+	// The same format is joined as it is
+	payload, err = EncodeData(NewData(map[string]string{Serialization: FormatKV}, [][]byte{raw, raw}), kv)
+	if err != nil || string(payload) != string(raw)+"\n"+string(raw)+"\n" {
+		t.Errorf("Unexpected kv payload=%s, error=%v", payload, err)
+	}
+
+	ndjson, _ := NewFormat(BaseConfig{Serialization: FormatNDJSON}, "")
+	payload, err = EncodeData(NewRecordData(nil, []map[string]interface{}{{"a": "1"}, {"b": "2"}}), ndjson)
+	if err != nil || string(payload) != "{\"a\":\"1\"}\n{\"b\":\"2\"}\n" {
+		t.Errorf("Unexpected ndjson payload=%s, error=%v", payload, err)
+	}
+
+	RegisterFormat(FormatMsgpack, newNDJSONFormat)
+	if _, err = NewFormat(BaseConfig{Serialization: FormatMsgpack}, ""); err != nil {
+		t.Errorf("Expect registered format, got error=%s", err)
+	}
+}
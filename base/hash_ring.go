@@ -0,0 +1,148 @@
+package base
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultVirtualNodes = 128
+)
+
+// HashRing places keys on nodes by consistent hashing, so that only the keys
+// owned by a joining or leaving node move to another node
+type HashRing struct {
+	virtualNodes int
+	hashes       []uint32
+	owners       map[uint32]string
+	nodes        map[string]bool
+	lockGuard    sync.RWMutex
+}
+
+// NewHashRing
+// @virtualNodes: number of points each node takes on the ring, use the
+// default if it is not positive
+func NewHashRing(virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+
+	return &HashRing{
+		virtualNodes: virtualNodes,
+		owners:       make(map[uint32]string),
+		nodes:        make(map[string]bool),
+	}
+}
+
+func (ring *HashRing) AddNode(node string) {
+	ring.lockGuard.Lock()
+	defer ring.lockGuard.Unlock()
+
+	if ring.nodes[node] {
+		return
+	}
+	ring.nodes[node] = true
+	ring.rebuild()
+}
+
+func (ring *HashRing) RemoveNode(node string) {
+	ring.lockGuard.Lock()
+	defer ring.lockGuard.Unlock()
+
+	if !ring.nodes[node] {
+		return
+	}
+	delete(ring.nodes, node)
+	ring.rebuild()
+}
+
+// SetNodes replaces the ring members with nodes
+// @Return: true if the membership changed
+func (ring *HashRing) SetNodes(nodes []string) bool {
+	ring.lockGuard.Lock()
+	defer ring.lockGuard.Unlock()
+
+	changed := false
+	newNodes := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if !ring.nodes[node] {
+			changed = true
+		}
+		newNodes[node] = true
+	}
+	// nodes may contain duplicates
+	changed = changed || len(newNodes) != len(ring.nodes)
+
+	if !changed {
+		return false
+	}
+	ring.nodes = newNodes
+	ring.rebuild()
+	return true
+}
+
+func (ring *HashRing) Nodes() []string {
+	ring.lockGuard.RLock()
+	defer ring.lockGuard.RUnlock()
+
+	nodes := make([]string, 0, len(ring.nodes))
+	for node := range ring.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// GetNode returns the node which owns the key, "" if the ring is empty
+func (ring *HashRing) GetNode(key string) string {
+	ring.lockGuard.RLock()
+	defer ring.lockGuard.RUnlock()
+
+	if len(ring.hashes) == 0 {
+		return ""
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= h
+	})
+
+	if idx == len(ring.hashes) {
+		idx = 0
+	}
+	return ring.owners[ring.hashes[idx]]
+}
+
+func (ring *HashRing) rebuild() {
+	ring.hashes = make([]uint32, 0, len(ring.nodes)*ring.virtualNodes)
+	ring.owners = make(map[uint32]string, len(ring.nodes)*ring.virtualNodes)
+	for node := range ring.nodes {
+		for i := 0; i < ring.virtualNodes; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + node))
+			// On collision, keep the owner stable regardless of map order
+			if owner, ok := ring.owners[h]; ok && owner < node {
+				continue
+			} else if !ok {
+				ring.hashes = append(ring.hashes, h)
+			}
+			ring.owners[h] = node
+		}
+	}
+	sort.Sort(uint32Slice(ring.hashes))
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int {
+	return len(s)
+}
+
+func (s uint32Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s uint32Slice) Less(i, j int) bool {
+	return s[i] < s[j]
+}
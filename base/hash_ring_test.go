@@ -0,0 +1,55 @@
+package base
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing(0)
+	if node := ring.GetNode("key"); node != "" {
+		t.Errorf("Empty ring should own nothing, got node=%s", node)
+	}
+
+	hosts := []string{"host1", "host2", "host3", "host4"}
+	ring.SetNodes(hosts)
+	if ring.SetNodes([]string{"host4", "host3", "host2", "host1"}) {
+		t.Errorf("Same members in different order should not change the ring")
+	}
+	if ring.SetNodes([]string{"host4", "host3", "host2", "host1", "host1"}) {
+		t.Errorf("Duplicate members should not change the ring")
+	}
+
+	n := 10000
+	placements := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("task_%d", i)
+		placements[key] = ring.GetNode(key)
+		if placements[key] != ring.GetNode(key) {
+			t.Errorf("Placement of key=%s is not deterministic", key)
+		}
+	}
+
+	ring.AddNode("host5")
+	moved := 0
+	for key, node := range placements {
+		newNode := ring.GetNode(key)
+		if newNode != node {
+			if newNode != "host5" {
+				t.Errorf("Key=%s moved from %s to %s instead of the new node", key, node, newNode)
+			}
+			moved++
+		}
+	}
+
+	if moved == 0 || moved > n/2 {
+		t.Errorf("Expect a minimal subset of keys to move, got %d of %d", moved, n)
+	}
+
+	ring.RemoveNode("host5")
+	for key, node := range placements {
+		if ring.GetNode(key) != node {
+			t.Errorf("Key=%s should be placed back on %s", key, node)
+		}
+	}
+}
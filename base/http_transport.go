@@ -0,0 +1,234 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HTTPVersion11          = "1.1"
+	defaultHTTPMaxRequests = 4
+)
+
+var (
+	httpProtocols      = make(map[string]string) // endpoint host indexed
+	httpProtocolsMutex sync.RWMutex
+
+	// httpSemaphores bound the concurrent requests per endpoint across all
+	// of the clients, endpoint host indexed
+	httpSemaphores      = make(map[string]chan struct{})
+	httpSemaphoresMutex sync.Mutex
+)
+
+// NewHTTPTransport returns a transport with the TLS options in config. HTTP/2
+// is negotiated when the server supports it
+// @config: HTTPVersion "1.1" forces HTTP/1.1 for middleboxes which break
+// HTTP/2, see NewTLSConfig for the TLS options
+func NewHTTPTransport(config BaseConfig) (*http.Transport, error) {
+	tlsConfig, err := NewTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DialContext:       countingDialContext(NewDialContext(config)),
+		TLSClientConfig:   tlsConfig,
+		ForceAttemptHTTP2: true,
+	}
+
+	if config[HTTPVersion] == HTTPVersion11 {
+		tr.ForceAttemptHTTP2 = false
+		// A non-nil empty map disables HTTP/2
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	return tr, nil
+}
+
+// NewHTTPClient returns a client on NewHTTPTransport which records the
+// negotiated protocol and the connection stats per endpoint, see
+// NegotiatedProtocols and HTTPTransportStatsOf
+// @config: HTTPGzip "1" compresses the request bodies with gzip.
+// HTTPMaxRequests caps the concurrent requests to one endpoint, default 4,
+// shared by all of the clients in the process whatever the job concurrency
+// is. The first client requesting an endpoint decides its cap
+func NewHTTPClient(config BaseConfig, timeout time.Duration) (*http.Client, error) {
+	tr, err := NewHTTPTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRequests := defaultHTTPMaxRequests
+	if config[HTTPMaxRequests] != "" {
+		maxRequests, err = strconv.Atoi(config[HTTPMaxRequests])
+		if err != nil || maxRequests <= 0 {
+			glog.Errorf("Invalid %s=%s, expect a positive number", HTTPMaxRequests, config[HTTPMaxRequests])
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s", HTTPMaxRequests, config[HTTPMaxRequests]))
+		}
+	}
+
+	// The injected faults take the slots of the endpoints like the real ones
+	rt := &httpRoundTripper{next: NewFaultInjector(config).WrapTransport(tr), gzip: config[HTTPGzip] == "1", maxRequests: maxRequests}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   timeout,
+	}, nil
+}
+
+// NegotiatedProtocols returns the last negotiated protocol of the endpoints in
+// "host=proto" format, for e.g. "splunk:8089=HTTP/2.0"
+func NegotiatedProtocols() []string {
+	httpProtocolsMutex.RLock()
+	defer httpProtocolsMutex.RUnlock()
+
+	protocols := make([]string, 0, len(httpProtocols))
+	for host, proto := range httpProtocols {
+		protocols = append(protocols, host+"="+proto)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+type httpRoundTripper struct {
+	next        http.RoundTripper
+	gzip        bool
+	maxRequests int
+}
+
+func (rt *httpRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.gzip && req.Body != nil && req.Header.Get("Content-Encoding") == "" {
+		var err error
+		req, err = gzipRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A request holds its slot until the response body is closed, since the
+	// endpoint is still busy serving it until then
+	sem := getHTTPSemaphore(req.URL.Host, rt.maxRequests)
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	req, done := traceHTTPRequest(req)
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		done()
+		<-sem
+		return resp, err
+	}
+
+	httpProtocolsMutex.Lock()
+	httpProtocols[req.URL.Host] = resp.Proto
+	httpProtocolsMutex.Unlock()
+	resp.Body = &releasingBody{ReadCloser: resp.Body, sem: sem, done: done}
+	return resp, err
+}
+
+func getHTTPSemaphore(host string, maxRequests int) chan struct{} {
+	httpSemaphoresMutex.Lock()
+	defer httpSemaphoresMutex.Unlock()
+
+	sem, ok := httpSemaphores[host]
+	if !ok {
+		if maxRequests <= 0 {
+			maxRequests = defaultHTTPMaxRequests
+		}
+		sem = make(chan struct{}, maxRequests)
+		httpSemaphores[host] = sem
+	}
+	return sem
+}
+
+// releasingBody gives back the request slot of the endpoint and the
+// connection once closed
+type releasingBody struct {
+	io.ReadCloser
+	sem  chan struct{}
+	done func()
+	once sync.Once
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() {
+		body.done()
+		<-body.sem
+	})
+	return err
+}
+
+// gzipRequest returns a copy of req with gzip compressed body. The streamed
+// bodies, of unknown length, are compressed while they are sent
+func gzipRequest(req *http.Request) (*http.Request, error) {
+	if req.ContentLength < 0 {
+		return gzipStreamRequest(req), nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(body)
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	compressed := buf.Bytes()
+
+	gzipped := req.Clone(req.Context())
+	gzipped.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	gzipped.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	gzipped.ContentLength = int64(len(compressed))
+	gzipped.Header.Set("Content-Encoding", "gzip")
+	gzipped.Header.Del("Content-Length")
+	return gzipped, nil
+}
+
+func gzipStreamRequest(req *http.Request) *http.Request {
+	compress := func(body io.ReadCloser) io.ReadCloser {
+		return NewStreamBody(func(w io.Writer) error {
+			defer body.Close()
+			writer := gzip.NewWriter(w)
+			if _, err := io.Copy(writer, body); err != nil {
+				return err
+			}
+			return writer.Close()
+		})
+	}
+
+	gzipped := req.Clone(req.Context())
+	gzipped.Body = compress(req.Body)
+	if req.GetBody != nil {
+		gzipped.GetBody = func() (io.ReadCloser, error) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return compress(body), nil
+		}
+	}
+	gzipped.Header.Set("Content-Encoding", "gzip")
+	gzipped.Header.Del("Content-Length")
+	return gzipped
+}
@@ -0,0 +1,269 @@
+package base
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Weight of the latest request in the moving average timings
+	httpTimingAlpha = 0.2
+)
+
+var (
+	// httpTransportStats are shared by the transports of the process,
+	// destination "host:port" indexed
+	httpTransportStats      = make(map[string]*httpHostStats)
+	httpTransportStatsMutex sync.Mutex
+)
+
+// HTTPTransportStats is the connection pool of the HTTP transports to a
+// destination host, with the moving averages of the request phases: the
+// DNS lookups, the TCP connects and the TLS handshakes of the new
+// connections are network side, the time to the first response byte is
+// mostly instance side. InUse counts the requests on the connections, HTTP/2
+// multiplexes several of them on one connection. Through a proxy the
+// connections are the ones to the proxy
+type HTTPTransportStats struct {
+	Host          string
+	Open          int64
+	InUse         int64
+	Idle          int64
+	Requests      int64
+	Reused        int64
+	DNSTime       time.Duration
+	ConnectTime   time.Duration
+	HandshakeTime time.Duration
+	FirstByteTime time.Duration
+}
+
+type httpHostStats struct {
+	open     int64
+	inUse    int64
+	requests int64
+	reused   int64
+	timings  [4]time.Duration // dns, connect, handshake and first byte
+	mutex    sync.Mutex
+}
+
+const (
+	dnsTiming = iota
+	connectTiming
+	handshakeTiming
+	firstByteTiming
+)
+
+func getHTTPHostStats(host string) *httpHostStats {
+	httpTransportStatsMutex.Lock()
+	defer httpTransportStatsMutex.Unlock()
+
+	stats, ok := httpTransportStats[host]
+	if !ok {
+		stats = &httpHostStats{}
+		httpTransportStats[host] = stats
+	}
+	return stats
+}
+
+func (stats *httpHostStats) observe(timing int, d time.Duration) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	if stats.timings[timing] == 0 {
+		stats.timings[timing] = d
+	} else {
+		stats.timings[timing] = time.Duration(httpTimingAlpha*float64(d) + (1-httpTimingAlpha)*float64(stats.timings[timing]))
+	}
+}
+
+// HTTPTransportStatsOf returns the stats of the destination hosts requested
+// by the process, ordered by host
+func HTTPTransportStatsOf() []HTTPTransportStats {
+	httpTransportStatsMutex.Lock()
+	hosts := make(map[string]*httpHostStats, len(httpTransportStats))
+	for host, stats := range httpTransportStats {
+		hosts[host] = stats
+	}
+	httpTransportStatsMutex.Unlock()
+
+	res := make([]HTTPTransportStats, 0, len(hosts))
+	for host, stats := range hosts {
+		snapshot := HTTPTransportStats{
+			Host:     host,
+			Open:     atomic.LoadInt64(&stats.open),
+			InUse:    atomic.LoadInt64(&stats.inUse),
+			Requests: atomic.LoadInt64(&stats.requests),
+			Reused:   atomic.LoadInt64(&stats.reused),
+		}
+		if snapshot.Open > snapshot.InUse {
+			snapshot.Idle = snapshot.Open - snapshot.InUse
+		}
+
+		stats.mutex.Lock()
+		snapshot.DNSTime = stats.timings[dnsTiming]
+		snapshot.ConnectTime = stats.timings[connectTiming]
+		snapshot.HandshakeTime = stats.timings[handshakeTiming]
+		snapshot.FirstByteTime = stats.timings[firstByteTiming]
+		stats.mutex.Unlock()
+		res = append(res, snapshot)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Host < res[j].Host })
+	return res
+}
+
+// FormatHTTPTransportStats returns the stats in heartbeat format,
+// "host=open/in_use/idle/dns_ms/connect_ms/handshake_ms/first_byte_ms"
+// joined by ";", for e.g. "acme.service-now.com:443=4/1/3/12/30/85/640"
+func FormatHTTPTransportStats(stats []HTTPTransportStats) string {
+	ms := func(d time.Duration) int64 {
+		return d.Nanoseconds() / int64(time.Millisecond)
+	}
+
+	parts := make([]string, 0, len(stats))
+	for _, s := range stats {
+		parts = append(parts, fmt.Sprintf("%s=%d/%d/%d/%d/%d/%d/%d", s.Host, s.Open, s.InUse, s.Idle,
+			ms(s.DNSTime), ms(s.ConnectTime), ms(s.HandshakeTime), ms(s.FirstByteTime)))
+	}
+	return strings.Join(parts, ";")
+}
+
+// ParseHTTPTransportStats parses the HTTPTransport stats of a heartbeat, the
+// malformed parts are ignored
+func ParseHTTPTransportStats(stats string) []HTTPTransportStats {
+	var res []HTTPTransportStats
+	for _, part := range strings.Split(stats, ";") {
+		sep := strings.LastIndex(part, "=")
+		if sep <= 0 {
+			continue
+		}
+
+		s := HTTPTransportStats{Host: part[:sep]}
+		var dns, connect, handshake, firstByte int64
+		_, err := fmt.Sscanf(part[sep+1:], "%d/%d/%d/%d/%d/%d/%d", &s.Open, &s.InUse, &s.Idle, &dns, &connect, &handshake, &firstByte)
+		if err != nil {
+			continue
+		}
+		s.DNSTime = time.Duration(dns) * time.Millisecond
+		s.ConnectTime = time.Duration(connect) * time.Millisecond
+		s.HandshakeTime = time.Duration(handshake) * time.Millisecond
+		s.FirstByteTime = time.Duration(firstByte) * time.Millisecond
+		res = append(res, s)
+	}
+	return res
+}
+
+// httpDestination returns the "host:port" of the request URL, as it is
+// dialed
+func httpDestination(req *http.Request) string {
+	if req.URL.Port() != "" {
+		return req.URL.Host
+	}
+
+	if req.URL.Scheme == "https" {
+		return net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	return net.JoinHostPort(req.URL.Hostname(), "80")
+}
+
+// traceHTTPRequest returns req traced into the stats of its destination. The
+// request holds its connection until done is called
+func traceHTTPRequest(req *http.Request) (traced *http.Request, done func()) {
+	stats := getHTTPHostStats(httpDestination(req))
+	atomic.AddInt64(&stats.requests, 1)
+
+	var mutex sync.Mutex
+	var dnsStart, connectStart, handshakeStart, wroteRequest time.Time
+	var gotConn int32
+	since := func(start *time.Time) (time.Duration, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if start.IsZero() {
+			return 0, false
+		}
+		return time.Since(*start), true
+	}
+	mark := func(start *time.Time) {
+		mutex.Lock()
+		*start = time.Now()
+		mutex.Unlock()
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if d, ok := since(&dnsStart); ok {
+				stats.observe(dnsTiming, d)
+			}
+		},
+		ConnectStart: func(string, string) { mark(&connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if d, ok := since(&connectStart); ok && err == nil {
+				stats.observe(connectTiming, d)
+			}
+		},
+		TLSHandshakeStart: func() { mark(&handshakeStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if d, ok := since(&handshakeStart); ok && err == nil {
+				stats.observe(handshakeTiming, d)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if atomic.CompareAndSwapInt32(&gotConn, 0, 1) {
+				atomic.AddInt64(&stats.inUse, 1)
+			}
+			if info.Reused {
+				atomic.AddInt64(&stats.reused, 1)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { mark(&wroteRequest) },
+		GotFirstResponseByte: func() {
+			if d, ok := since(&wroteRequest); ok {
+				stats.observe(firstByteTiming, d)
+			}
+		},
+	}
+
+	done = func() {
+		if atomic.CompareAndSwapInt32(&gotConn, 1, 2) {
+			atomic.AddInt64(&stats.inUse, -1)
+		}
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), done
+}
+
+// countingDialContext counts the connections dialed by dial which are open
+// in the stats of their destination
+func countingDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return conn, err
+		}
+
+		stats := getHTTPHostStats(addr)
+		atomic.AddInt64(&stats.open, 1)
+		return &countedConn{Conn: conn, stats: stats}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	stats  *httpHostStats
+	closed int32
+}
+
+func (conn *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&conn.closed, 0, 1) {
+		atomic.AddInt64(&conn.stats.open, -1)
+	}
+	return conn.Conn.Close()
+}
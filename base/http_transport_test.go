@@ -0,0 +1,162 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body, _ = ioutil.ReadAll(reader)
+		}
+		w.Write([]byte(req.Proto + " " + string(body)))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	cases := map[string]BaseConfig{
+		"HTTP/2.0 data": BaseConfig{TLSSkipVerify: "1"},
+		"HTTP/1.1 data": BaseConfig{TLSSkipVerify: "1", HTTPVersion: HTTPVersion11, HTTPGzip: "1"},
+	}
+
+	for expected, config := range cases {
+		client, err := NewHTTPClient(config, 10*time.Second)
+		if err != nil {
+			t.Errorf("Failed to create HTTP client, error=%s", err)
+			continue
+		}
+
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("data"))
+		if err != nil {
+			t.Errorf("Failed to post, error=%s", err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != expected {
+			t.Errorf("Expect response=%s, got=%s", expected, body)
+		}
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		protocols := strings.Join(NegotiatedProtocols(), ";")
+		if !strings.Contains(protocols, host+"="+strings.Fields(expected)[0]) {
+			t.Errorf("Expect negotiated protocol recorded for %s, got=%s", host, protocols)
+		}
+	}
+}
+
+func TestHTTPMaxRequests(t *testing.T) {
+	var current, max int32
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&current, -1)
+	}))
+	defer server.Close()
+
+	if _, err := NewHTTPClient(BaseConfig{HTTPMaxRequests: "0"}, time.Second); err == nil {
+		t.Errorf("Expect error for invalid %s", HTTPMaxRequests)
+	}
+
+	// The cap is shared by the clients of the same endpoint
+	n := 5
+	done := make(chan error, n)
+	for i := 0; i < n; i++ {
+		client, err := NewHTTPClient(BaseConfig{HTTPMaxRequests: "2"}, 10*time.Second)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP client, error=%s", err)
+		}
+
+		go func() {
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		time.Sleep(50 * time.Millisecond)
+		release <- true
+		if err := <-done; err != nil {
+			t.Errorf("Failed to get, error=%s", err)
+		}
+	}
+
+	if max := atomic.LoadInt32(&max); max != 2 {
+		t.Errorf("Expect at most 2 concurrent requests, got %d", max)
+	}
+}
+
+func TestHTTPTransportStats(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(BaseConfig{TLSSkipVerify: "1", HTTPVersion: HTTPVersion11}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client, error=%s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Failed to get, error=%s", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	var stats *HTTPTransportStats
+	all := HTTPTransportStatsOf()
+	for i := range all {
+		if all[i].Host == host {
+			stats = &all[i]
+		}
+	}
+
+	if stats == nil {
+		t.Fatalf("Expect the stats of %s, got=%v", host, all)
+	}
+
+	if stats.Requests != 3 || stats.Reused != 2 || stats.Open != 1 || stats.InUse != 0 || stats.Idle != 1 {
+		t.Errorf("Expect 3 requests on one idle connection, got=%+v", stats)
+	}
+
+	if stats.HandshakeTime <= 0 || stats.FirstByteTime < 20*time.Millisecond {
+		t.Errorf("Expect the handshake and the first byte timed, got=%+v", stats)
+	}
+
+	formatted := FormatHTTPTransportStats([]HTTPTransportStats{*stats})
+	parsed := ParseHTTPTransportStats(formatted + ";malformed=1/2")
+	if len(parsed) != 1 || parsed[0].Host != host || parsed[0].Idle != 1 || parsed[0].FirstByteTime < 20*time.Millisecond {
+		t.Errorf("Expect the stats parsed back from %s, got=%+v", formatted, parsed)
+	}
+}
@@ -0,0 +1,132 @@
+package base
+
+import (
+	"github.com/golang/glog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// The bytes of the data buffered by the sinks of the process, written
+	// asynchronously and not acknowledged yet
+	inflightTotal      int64
+	inflightTasks      = make(map[string]int64) // TaskConfigKey indexed
+	inflightTasksMutex sync.Mutex
+)
+
+// AddInflightBytes accounts n bytes of task buffered by a sink, a negative n
+// releases them once they are written or dropped
+func AddInflightBytes(task string, n int64) {
+	atomic.AddInt64(&inflightTotal, n)
+
+	inflightTasksMutex.Lock()
+	inflightTasks[task] += n
+	if inflightTasks[task] <= 0 {
+		delete(inflightTasks, task)
+	}
+	inflightTasksMutex.Unlock()
+}
+
+// InflightBytesOf returns the bytes buffered of all of the tasks if task is
+// empty, of task otherwise
+func InflightBytesOf(task string) int64 {
+	if task == "" {
+		return atomic.LoadInt64(&inflightTotal)
+	}
+
+	inflightTasksMutex.Lock()
+	defer inflightTasksMutex.Unlock()
+	return inflightTasks[task]
+}
+
+type watermark struct {
+	high   int64 // disabled if not positive
+	low    int64
+	paused bool
+}
+
+// admit returns false from the time inflight exceeds the high watermark
+// until it drains below the low one
+func (mark *watermark) admit(inflight int64) (admitted, changed bool) {
+	if mark.high <= 0 {
+		return true, false
+	}
+
+	paused := mark.paused
+	if inflight > mark.high {
+		mark.paused = true
+	} else if inflight < mark.low {
+		mark.paused = false
+	}
+	return !mark.paused, paused != mark.paused
+}
+
+// InflightWatermark pauses the new collection cycles while the sinks buffer
+// too much data, for e.g. when they slow down, so the collector doesn't run
+// out of memory. The cycles of a task are paused on its own watermarks too
+type InflightWatermark struct {
+	global    watermark
+	tasks     map[string]*watermark // TaskConfigKey indexed
+	lockGuard sync.Mutex
+}
+
+// NewInflightWatermark
+// @config: InflightHighBytes, disabled by default, and InflightLowBytes, 80%
+// of the high watermark by default
+func NewInflightWatermark(config BaseConfig) *InflightWatermark {
+	return &InflightWatermark{
+		global: newWatermark(config[InflightHighBytes], config[InflightLowBytes]),
+		tasks:  make(map[string]*watermark),
+	}
+}
+
+func newWatermark(high, low string) watermark {
+	mark := watermark{}
+	mark.high, _ = strconv.ParseInt(high, 10, 64)
+	mark.low, _ = strconv.ParseInt(low, 10, 64)
+	if mark.low <= 0 || mark.low >= mark.high {
+		mark.low = mark.high / 5 * 4
+	}
+	return mark
+}
+
+// Admit returns true if a new cycle of task can be started
+// @task: TaskInflightHighBytes and TaskInflightLowBytes are its watermarks,
+// in the same way as the InflightHighBytes and InflightLowBytes of all tasks
+func (wm *InflightWatermark) Admit(task BaseConfig) bool {
+	key := task[TaskConfigKey]
+
+	wm.lockGuard.Lock()
+	defer wm.lockGuard.Unlock()
+
+	total := InflightBytesOf("")
+	admitted, changed := wm.global.admit(total)
+	if changed && admitted {
+		glog.Infof("Inflight bytes=%d drained below low watermark=%d, resume new collection cycles", total, wm.global.low)
+	} else if changed {
+		glog.Warningf("Alert: inflight bytes=%d above high watermark=%d, pause new collection cycles", total, wm.global.high)
+	}
+
+	if task[TaskInflightHighBytes] == "" {
+		delete(wm.tasks, key)
+		return admitted
+	}
+
+	// The watermarks of the task may be changed by an updated task
+	configured := newWatermark(task[TaskInflightHighBytes], task[TaskInflightLowBytes])
+	mark, ok := wm.tasks[key]
+	if !ok || mark.high != configured.high || mark.low != configured.low {
+		mark = &configured
+		wm.tasks[key] = mark
+	}
+
+	inflight := InflightBytesOf(key)
+	taskAdmitted, changed := mark.admit(inflight)
+	if changed && taskAdmitted {
+		glog.Infof("Inflight bytes=%d of task=%s drained below low watermark=%d", inflight, key, mark.low)
+	} else if changed {
+		glog.Warningf("Inflight bytes=%d of task=%s above high watermark=%d, pause its collection cycles", inflight, key, mark.high)
+	}
+	return admitted && taskAdmitted
+}
@@ -0,0 +1,52 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestInflightWatermark(t *testing.T) {
+	wm := NewInflightWatermark(BaseConfig{InflightHighBytes: "1000"})
+	if wm.global.low != 800 {
+		t.Errorf("Expect low watermark=800 by default, got=%d", wm.global.low)
+	}
+
+	task := BaseConfig{TaskConfigKey: "inflight_task", TaskInflightHighBytes: "100", TaskInflightLowBytes: "50"}
+	other := BaseConfig{TaskConfigKey: "inflight_other"}
+	defer AddInflightBytes(task[TaskConfigKey], -InflightBytesOf(task[TaskConfigKey]))
+	defer AddInflightBytes(other[TaskConfigKey], -InflightBytesOf(other[TaskConfigKey]))
+
+	AddInflightBytes(task[TaskConfigKey], 150)
+	if wm.Admit(task) || !wm.Admit(other) {
+		t.Errorf("Expect only the task above its high watermark paused")
+	}
+
+	// Hysteresis, still paused between the watermarks
+	AddInflightBytes(task[TaskConfigKey], -80)
+	if wm.Admit(task) {
+		t.Errorf("Expect the task paused until it drains below its low watermark")
+	}
+
+	AddInflightBytes(task[TaskConfigKey], -30)
+	if !wm.Admit(task) {
+		t.Errorf("Expect the task resumed below its low watermark")
+	}
+
+	AddInflightBytes(other[TaskConfigKey], 1000)
+	if wm.Admit(task) || wm.Admit(other) {
+		t.Errorf("Expect all of the tasks paused above the global high watermark")
+	}
+
+	AddInflightBytes(other[TaskConfigKey], -200)
+	if wm.Admit(other) {
+		t.Errorf("Expect the tasks paused until the total drains below the global low watermark")
+	}
+
+	AddInflightBytes(other[TaskConfigKey], -100)
+	if !wm.Admit(other) || InflightBytesOf(other[TaskConfigKey]) != 700 {
+		t.Errorf("Expect the tasks resumed below the global low watermark, inflight=%d", InflightBytesOf(other[TaskConfigKey]))
+	}
+
+	if !NewInflightWatermark(BaseConfig{}).Admit(other) {
+		t.Errorf("Expect the watermark disabled by default")
+	}
+}
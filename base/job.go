@@ -2,7 +2,9 @@ package base
 
 import (
 	"fmt"
+	"github.com/golang/glog"
 	"github.com/petar/GoLLRB/llrb"
+	"runtime/debug"
 	"strconv"
 	"sync/atomic"
 )
@@ -85,7 +87,14 @@ func (job *BaseJob) Id() string {
 }
 
 func (job *BaseJob) Interval() int64 {
-	return job.interval
+	return atomic.LoadInt64(&job.interval)
+}
+
+// SetInterval changes the interval of the job from the run after the next
+// one on, the next run is already scheduled
+// @interval: in nano seconds
+func (job *BaseJob) SetInterval(interval int64) {
+	atomic.StoreInt64(&job.interval, interval)
 }
 
 func (job *BaseJob) ExpirationTime() int64 {
@@ -93,7 +102,7 @@ func (job *BaseJob) ExpirationTime() int64 {
 }
 
 func (job *BaseJob) UpdateExpirationTime() int64 {
-	job.when += job.interval
+	job.when += job.Interval()
 	return job.when
 }
 
@@ -110,5 +119,29 @@ func (job *BaseJob) Stop() {
 }
 
 func (job *BaseJob) Callback() {
-	job.f(job.params)
+	CallSafely(job.id, func() error {
+		return job.f(job.params)
+	})
+}
+
+// PanicError is returned by CallSafely when the call panicked
+type PanicError struct {
+	Value interface{}
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// CallSafely calls f and converts a panic in it to a *PanicError, so that
+// one misbehaving job doesn't take down the whole process
+// @name: identifies the job in the log
+func CallSafely(name string, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Errorf("Recovered from panic in job=%s, panic=%v, stack=%s", name, r, debug.Stack())
+			err = &PanicError{Value: r}
+		}
+	}()
+	return f()
 }
@@ -0,0 +1,163 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Error classes of the failed runs, see ErrorClass
+	ErrorClassConfig  = "config"
+	ErrorClassTimeout = "timeout"
+	ErrorClassNetwork = "network"
+	ErrorClassServer  = "server"
+	ErrorClassOther   = "other"
+
+	// The runs a score is computed from, latest first
+	jobHealthWindow = 20
+	// DefaultHealthThreshold is the instance health below which the
+	// scheduler avoids a collector, see HealthThreshold
+	DefaultHealthThreshold = 50
+)
+
+// JobHealth scores a job from 0 to 100 by its recent runs. The failures on
+// configuration errors don't reflect the collector and don't lower the
+// score, the lag beyond 2 intervals of the job since the last success does
+type JobHealth struct {
+	Key          string
+	Instance     string // ServerURL of the task
+	Score        int
+	SuccessRatio float64
+	Lag          time.Duration // since the end of the last successful run
+	ErrorClasses map[string]int
+}
+
+// ErrorClass returns the class of the error of a failed run
+func ErrorClass(err string) string {
+	lower := strings.ToLower(err)
+	switch {
+	case strings.HasPrefix(lower, "configuration error"):
+		return ErrorClassConfig
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded"):
+		return ErrorClassTimeout
+	case strings.Contains(lower, "connection refused") || strings.Contains(lower, "connection reset") ||
+		strings.Contains(lower, "no such host") || strings.Contains(lower, "network is unreachable") ||
+		strings.Contains(lower, "tls"):
+		return ErrorClassNetwork
+	case strings.Contains(lower, "status=5"):
+		return ErrorClassServer
+	default:
+		return ErrorClassOther
+	}
+}
+
+// EvaluateJobHealth
+// @runs: the JobHistory of the job, oldest first
+// @interval: of the job, the lag is not scored if it is not positive
+func EvaluateJobHealth(key, instance string, runs []JobRun, interval time.Duration, now time.Time) JobHealth {
+	health := JobHealth{
+		Key:          key,
+		Instance:     instance,
+		Score:        100,
+		SuccessRatio: 1,
+		ErrorClasses: make(map[string]int),
+	}
+
+	if len(runs) > jobHealthWindow {
+		runs = runs[len(runs)-jobHealthWindow:]
+	}
+
+	scored, succeeded := 0, 0
+	var lastSuccess int64
+	for _, run := range runs {
+		if run.Outcome == JobRunSuccess {
+			succeeded++
+			scored++
+			lastSuccess = run.EndTime
+			continue
+		}
+
+		class := ErrorClass(run.Error)
+		health.ErrorClasses[class]++
+		if class != ErrorClassConfig {
+			scored++
+		}
+	}
+
+	if scored > 0 {
+		health.SuccessRatio = float64(succeeded) / float64(scored)
+	}
+
+	score := 100 * health.SuccessRatio
+	if lastSuccess > 0 {
+		health.Lag = now.Sub(time.Unix(0, lastSuccess))
+	}
+
+	if interval > 0 && health.Lag > 2*interval {
+		score *= float64(2*interval) / float64(health.Lag)
+	}
+	health.Score = int(score + 0.5)
+	return health
+}
+
+// AggregateInstanceHealth returns the average score of the jobs of each
+// instance, the jobs without ServerURL are not counted
+func AggregateInstanceHealth(healths []JobHealth) map[string]int {
+	sums := make(map[string]int)
+	counts := make(map[string]int)
+	for _, health := range healths {
+		if health.Instance == "" {
+			continue
+		}
+		sums[health.Instance] += health.Score
+		counts[health.Instance]++
+	}
+
+	res := make(map[string]int, len(sums))
+	for instance, sum := range sums {
+		res[instance] = sum / counts[instance]
+	}
+	return res
+}
+
+// FormatInstanceHealth returns the instance health in heartbeat format,
+// "instance=score" joined by ";" in the order of the instances
+func FormatInstanceHealth(health map[string]int) string {
+	parts := make([]string, 0, len(health))
+	for instance, score := range health {
+		parts = append(parts, fmt.Sprintf("%s=%d", instance, score))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// GetHealthThreshold returns HealthThreshold of config, DefaultHealthThreshold
+// if it is not set or invalid
+func GetHealthThreshold(config BaseConfig) int {
+	threshold, err := strconv.Atoi(config[HealthThreshold])
+	if err != nil || threshold < 0 || threshold > 100 {
+		return DefaultHealthThreshold
+	}
+	return threshold
+}
+
+// ParseInstanceHealth parses the InstanceHealth of a heartbeat, the malformed
+// parts are ignored
+func ParseInstanceHealth(health string) map[string]int {
+	res := make(map[string]int)
+	for _, part := range strings.Split(health, ";") {
+		sep := strings.LastIndex(part, "=")
+		if sep <= 0 {
+			continue
+		}
+
+		var score int
+		if _, err := fmt.Sscanf(part[sep+1:], "%d", &score); err == nil {
+			res[part[:sep]] = score
+		}
+	}
+	return res
+}
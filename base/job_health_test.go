@@ -0,0 +1,66 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobHealth(t *testing.T) {
+	now := time.Now()
+	at := func(ago time.Duration) int64 {
+		return now.Add(-ago).UnixNano()
+	}
+
+	runs := []JobRun{
+		{Key: "a", EndTime: at(4 * time.Minute), Outcome: JobRunSuccess},
+		{Key: "a", EndTime: at(3 * time.Minute), Outcome: JobRunFailure, Error: "configuration error: incident returned status=403"},
+		{Key: "a", EndTime: at(2 * time.Minute), Outcome: JobRunFailure, Error: "dial tcp: connection refused"},
+		{Key: "a", EndTime: at(time.Minute), Outcome: JobRunSuccess},
+	}
+
+	// The configuration error doesn't count
+	health := EvaluateJobHealth("a", "https://x.service-now.com", runs, time.Minute, now)
+	if health.Score != 67 || health.ErrorClasses[ErrorClassConfig] != 1 || health.ErrorClasses[ErrorClassNetwork] != 1 {
+		t.Errorf("Expect score 67 with 1 config and 1 network error, got %+v", health)
+	}
+
+	// Lagging 4 intervals halves the score
+	health = EvaluateJobHealth("a", "https://x.service-now.com", runs[:1], time.Minute, now)
+	if health.Score != 50 {
+		t.Errorf("Expect score 50 for the lag, got %+v", health)
+	}
+
+	if health := EvaluateJobHealth("b", "", nil, time.Minute, now); health.Score != 100 {
+		t.Errorf("Expect the job without runs healthy, got %+v", health)
+	}
+
+	instances := AggregateInstanceHealth([]JobHealth{
+		{Instance: "https://x.service-now.com", Score: 40},
+		{Instance: "https://x.service-now.com", Score: 80},
+		{Instance: "", Score: 0},
+	})
+	formatted := FormatInstanceHealth(instances)
+	if formatted != "https://x.service-now.com=60" {
+		t.Errorf("Unexpected instance health=%s", formatted)
+	}
+
+	parsed := ParseInstanceHealth(formatted + ";bad;=1")
+	if len(parsed) != 1 || parsed["https://x.service-now.com"] != 60 {
+		t.Errorf("Unexpected parsed instance health=%v", parsed)
+	}
+
+	for err, class := range map[string]string{
+		"context deadline exceeded":       ErrorClassTimeout,
+		"incident.do returned status=503": ErrorClassServer,
+		"unexpected end of JSON input":    ErrorClassOther,
+		"lookup x: no such host":          ErrorClassNetwork,
+	} {
+		if ErrorClass(err) != class {
+			t.Errorf("Expect class=%s of error=%s, got %s", class, err, ErrorClass(err))
+		}
+	}
+
+	if GetHealthThreshold(BaseConfig{HealthThreshold: "x"}) != DefaultHealthThreshold {
+		t.Errorf("Expect the default threshold for invalid values")
+	}
+}
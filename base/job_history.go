@@ -0,0 +1,157 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+)
+
+const (
+	JobRunSuccess = "success"
+	JobRunFailure = "failure"
+
+	defaultJobHistorySize = 100
+)
+
+type JobRun struct {
+	Key       string
+	StartTime int64 // nano seconds since epoch
+	EndTime   int64 // nano seconds since epoch
+	Records   int64
+	Bytes     int64
+	Outcome   string
+	Error     string
+}
+
+// Event returns the run as a JobFailureTopic event
+func (run *JobRun) Event() BaseConfig {
+	return BaseConfig{
+		TaskConfigKey: run.Key,
+		"Outcome":     run.Outcome,
+		"Error":       run.Error,
+	}
+}
+
+// JobHistory keeps the last N runs of each job in a ring buffer and
+// optionally publishes every run to a DataWriter (for e.g. a Kafka topic)
+type JobHistory struct {
+	size      int
+	runs      map[string][]JobRun // job key indexed
+	next      map[string]int      // job key indexed, next slot to write
+	records   int64               // of all of the runs recorded
+	bytes     int64
+	writer    DataWriter
+	lockGuard sync.RWMutex
+}
+
+// NewJobHistory
+// @size: max number of runs kept for each job, use the default if it is not
+// positive
+func NewJobHistory(size int) *JobHistory {
+	if size <= 0 {
+		size = defaultJobHistorySize
+	}
+
+	return &JobHistory{
+		size: size,
+		runs: make(map[string][]JobRun),
+		next: make(map[string]int),
+	}
+}
+
+// SetWriter publishes every recorded run through writer in JSON format
+func (history *JobHistory) SetWriter(writer DataWriter) {
+	history.lockGuard.Lock()
+	history.writer = writer
+	history.lockGuard.Unlock()
+}
+
+func (history *JobHistory) Record(run JobRun) {
+	history.lockGuard.Lock()
+	runs := history.runs[run.Key]
+	if len(runs) < history.size {
+		history.runs[run.Key] = append(runs, run)
+	} else {
+		runs[history.next[run.Key]] = run
+	}
+	history.next[run.Key] = (history.next[run.Key] + 1) % history.size
+	history.records += run.Records
+	history.bytes += run.Bytes
+	writer := history.writer
+	history.lockGuard.Unlock()
+
+	if writer != nil {
+		rawData, err := json.Marshal(&run)
+		if err != nil {
+			glog.Errorf("Failed to marshal job run for key=%s, error=%s", run.Key, err)
+			return
+		}
+
+		metaInfo := map[string]string{
+			TaskConfigKey: run.Key,
+		}
+		writer.WriteData(NewData(metaInfo, [][]byte{rawData}))
+	}
+}
+
+// Totals returns the records and bytes written by all of the runs recorded
+// since the start, the dropped runs are counted too
+func (history *JobHistory) Totals() (int64, int64) {
+	history.lockGuard.RLock()
+	defer history.lockGuard.RUnlock()
+	return history.records, history.bytes
+}
+
+// Keys returns all of the job keys which have history
+func (history *JobHistory) Keys() []string {
+	history.lockGuard.RLock()
+	defer history.lockGuard.RUnlock()
+
+	keys := make([]string, 0, len(history.runs))
+	for key := range history.runs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Runs returns the runs of the job in the order of oldest first
+func (history *JobHistory) Runs(key string) []JobRun {
+	history.lockGuard.RLock()
+	defer history.lockGuard.RUnlock()
+
+	runs := history.runs[key]
+	res := make([]JobRun, 0, len(runs))
+	if len(runs) < history.size {
+		return append(res, runs...)
+	}
+
+	start := history.next[key]
+	res = append(res, runs[start:]...)
+	return append(res, runs[:start]...)
+}
+
+// LastSuccess returns the latest successful run of the job, nil if there
+// is none
+func (history *JobHistory) LastSuccess(key string) *JobRun {
+	runs := history.Runs(key)
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Outcome == JobRunSuccess {
+			return &runs[i]
+		}
+	}
+	return nil
+}
+
+// LastErrors returns at most n latest failed runs of the job, latest first
+func (history *JobHistory) LastErrors(key string, n int) []JobRun {
+	var res []JobRun
+	runs := history.Runs(key)
+	for i := len(runs) - 1; i >= 0 && len(res) < n; i-- {
+		if runs[i].Outcome == JobRunFailure {
+			res = append(res, runs[i])
+		}
+	}
+	return res
+}
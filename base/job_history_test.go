@@ -0,0 +1,59 @@
+package base
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestJobHistory(t *testing.T) {
+	history := NewJobHistory(3)
+	key := "snow_incident"
+	if history.LastSuccess(key) != nil {
+		t.Errorf("Expect no successful run for key=%s", key)
+	}
+
+	for i := 1; i <= 5; i++ {
+		run := JobRun{
+			Key:       key,
+			StartTime: int64(i),
+			EndTime:   int64(i),
+			Records:   int64(i),
+			Bytes:     int64(10 * i),
+			Outcome:   JobRunSuccess,
+		}
+
+		if i%2 == 0 {
+			run.Outcome = JobRunFailure
+			run.Error = fmt.Sprintf("error %d", i)
+		}
+		history.Record(run)
+	}
+
+	runs := history.Runs(key)
+	if len(runs) != 3 {
+		t.Errorf("Expect 3 runs kept, got %d", len(runs))
+	}
+
+	if records, bytes := history.Totals(); records != 15 || bytes != 150 {
+		t.Errorf("Expect totals of all of the runs, got records=%d, bytes=%d", records, bytes)
+	}
+
+	for i, run := range runs {
+		if run.StartTime != int64(i+3) {
+			t.Errorf("Expect runs in oldest first order, got %+v", runs)
+		}
+	}
+
+	if last := history.LastSuccess(key); last == nil || last.StartTime != 5 {
+		t.Errorf("Expect last successful run started at 5, got %+v", last)
+	}
+
+	errs := history.LastErrors(key, 10)
+	if len(errs) != 1 || errs[0].Error != "error 4" {
+		t.Errorf("Expect only error 4 is kept, got %+v", errs)
+	}
+
+	if keys := history.Keys(); len(keys) != 1 || keys[0] != key {
+		t.Errorf("Expect keys=[%s], got %s", key, keys)
+	}
+}
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JobLimiter bounds the number of concurrently running job callbacks and
+// the rate they are started at. Both limits can be changed at runtime, the
+// running callbacks are not affected
+type JobLimiter struct {
+	concurrency int     // unlimited if not positive
+	rate        float64 // callbacks per second, unlimited if not positive
+	running     int
+	tokens      float64
+	last        time.Time
+	lockGuard   sync.Mutex
+}
+
+func NewJobLimiter(concurrency int, rate float64) *JobLimiter {
+	limiter := &JobLimiter{last: time.Now()}
+	limiter.SetConcurrency(concurrency)
+	limiter.SetRate(rate)
+	return limiter
+}
+
+// NewJobLimiterFromConfig
+// @config: contains MaxConcurrentJobs and JobRateLimit in callbacks per
+// second, both are unlimited by default
+func NewJobLimiterFromConfig(config BaseConfig) *JobLimiter {
+	concurrency, _ := strconv.Atoi(config[MaxConcurrentJobs])
+	rate, _ := strconv.ParseFloat(config[JobRateLimit], 64)
+	return NewJobLimiter(concurrency, rate)
+}
+
+func (limiter *JobLimiter) SetConcurrency(concurrency int) {
+	limiter.lockGuard.Lock()
+	limiter.concurrency = concurrency
+	limiter.lockGuard.Unlock()
+}
+
+func (limiter *JobLimiter) SetRate(rate float64) {
+	limiter.lockGuard.Lock()
+	limiter.rate = rate
+	limiter.tokens = limiter.burst()
+	limiter.lockGuard.Unlock()
+}
+
+// TryAcquire returns true if a callback can be started now, Release shall
+// be called when it is done
+func (limiter *JobLimiter) TryAcquire() bool {
+	return limiter.tryAcquireAt(time.Now())
+}
+
+func (limiter *JobLimiter) Release() {
+	limiter.lockGuard.Lock()
+	if limiter.running > 0 {
+		limiter.running--
+	}
+	limiter.lockGuard.Unlock()
+}
+
+func (limiter *JobLimiter) tryAcquireAt(now time.Time) bool {
+	limiter.lockGuard.Lock()
+	defer limiter.lockGuard.Unlock()
+
+	if limiter.concurrency > 0 && limiter.running >= limiter.concurrency {
+		return false
+	}
+
+	if limiter.rate > 0 {
+		limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+		if burst := limiter.burst(); limiter.tokens > burst {
+			limiter.tokens = burst
+		}
+		limiter.last = now
+
+		if limiter.tokens < 1 {
+			return false
+		}
+		limiter.tokens--
+	}
+
+	limiter.running++
+	return true
+}
+
+func (limiter *JobLimiter) burst() float64 {
+	if limiter.rate < 1 {
+		return 1
+	}
+	return limiter.rate
+}
@@ -0,0 +1,46 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobLimiterConcurrency(t *testing.T) {
+	limiter := NewJobLimiter(2, 0)
+	if !limiter.TryAcquire() || !limiter.TryAcquire() {
+		t.Errorf("Expect 2 concurrent callbacks to be allowed")
+	}
+
+	if limiter.TryAcquire() {
+		t.Errorf("Expect the 3rd concurrent callback to be rejected")
+	}
+
+	limiter.Release()
+	if !limiter.TryAcquire() {
+		t.Errorf("Expect a callback to be allowed after release")
+	}
+
+	limiter.SetConcurrency(0)
+	for i := 0; i < 10; i++ {
+		if !limiter.TryAcquire() {
+			t.Errorf("Expect unlimited callbacks after reload")
+		}
+	}
+}
+
+func TestJobLimiterRate(t *testing.T) {
+	limiter := NewJobLimiter(0, 2)
+	now := time.Now()
+	limiter.last = now
+	if !limiter.tryAcquireAt(now) || !limiter.tryAcquireAt(now) {
+		t.Errorf("Expect a burst of 2 callbacks to be allowed")
+	}
+
+	if limiter.tryAcquireAt(now) {
+		t.Errorf("Expect the 3rd callback in the same second to be rejected")
+	}
+
+	if !limiter.tryAcquireAt(now.Add(500 * time.Millisecond)) {
+		t.Errorf("Expect a callback to be allowed after the token is refilled")
+	}
+}
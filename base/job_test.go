@@ -50,3 +50,36 @@ func TestJob(t *testing.T) {
 		}
 	}
 }
+
+func TestCallSafely(t *testing.T) {
+	err := CallSafely("panicky", func() error {
+		var m map[string]int
+		m["boom"] = 1
+		return nil
+	})
+
+	if panicErr, ok := err.(*PanicError); !ok || panicErr.Value == nil {
+		t.Errorf("Expect the panic to be converted to PanicError, got=%v", err)
+	}
+
+	called := false
+	job := NewJob(func(params JobParam) error {
+		called = true
+		panic("boom")
+	}, 0, 0, nil)
+
+	// Doesn't propagate the panic
+	job.Callback()
+	if !called {
+		t.Errorf("Expect the job function called")
+	}
+
+	err = CallSafely("boom", func() error { panic("boom") })
+	if err == nil || err.Error() != "panic: boom" {
+		t.Errorf("Expect error=panic: boom, got=%v", err)
+	}
+
+	if err := CallSafely("fine", func() error { return nil }); err != nil {
+		t.Errorf("Expect no error, got=%s", err)
+	}
+}
@@ -1,8 +1,11 @@
 package base
 
 import (
+	"errors"
+	"fmt"
 	"github.com/Shopify/sarama"
 	"github.com/golang/glog"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,18 +18,174 @@ type KafkaClient struct {
 const (
 	maxRetry                 = 10
 	topicOrPartitionNotExist = -10
+
+	defaultMetadataRefreshFrequency = 60 * time.Second
+	defaultKafkaPort                = "9092"
+)
+
+const (
+	// Fail the reader when its checkpointed offset has been deleted by
+	// the retention of the topic
+	OffsetResetFail = "fail"
+	// Resume from the oldest available offset
+	OffsetResetOldest = "oldest"
+	// Resume from the newest offset, skipping what is still available
+	OffsetResetNewest = "newest"
 )
 
+// OffsetGap is the range of offsets a reader skipped when it resumed after
+// its checkpointed offset had expired. From is the checkpointed offset, To
+// the offset resumed from
+type OffsetGap struct {
+	ConsumerGroup string
+	Topic         string
+	Partition     int32
+	From          int64
+	To            int64
+	Policy        string
+}
+
+// Event returns the gap as a DataGapTopic event
+func (gap *OffsetGap) Event() BaseConfig {
+	return BaseConfig{
+		KafkaTopic:       gap.Topic,
+		KafkaPartition:   strconv.FormatInt(int64(gap.Partition), 10),
+		"ConsumerGroup":  gap.ConsumerGroup,
+		"From":           strconv.FormatInt(gap.From, 10),
+		"To":             strconv.FormatInt(gap.To, 10),
+		KafkaOffsetReset: gap.Policy,
+	}
+}
+
+// The configs of a Kafka cluster, the configs of the control cluster are the
+// ones prefixed with ControlKafkaPrefix, for e.g. ControlKafkaBrokers
+var KafkaClusterConfigs = []string{
+	KafkaBrokers, KafkaMetadataRefresh, KafkaSASLUser, KafkaSASLPassword, KafkaTLS, KafkaTLSCAFile,
+	KafkaTLSCertFile, KafkaTLSKeyFile, KafkaTLSServerName, KafkaTLSSkipVerify,
+}
+
+const ControlKafkaPrefix = "Control"
+
+// DataKafkaConfig returns the cluster configs of config, the cluster the data
+// is collected into
+func DataKafkaConfig(config BaseConfig) BaseConfig {
+	res := make(BaseConfig, len(KafkaClusterConfigs))
+	for _, k := range KafkaClusterConfigs {
+		if config[k] != "" {
+			res[k] = config[k]
+		}
+	}
+	return res
+}
+
+// ControlKafkaConfig returns the cluster configs of the control topics, for
+// e.g. Tasks and TaskStats. It is the cluster of ControlKafkaBrokers, so the
+// control cluster can be small and locked down, or the data cluster if it is
+// not configured
+func ControlKafkaConfig(config BaseConfig) BaseConfig {
+	if config[ControlKafkaBrokers] == "" {
+		return DataKafkaConfig(config)
+	}
+
+	res := make(BaseConfig, len(KafkaClusterConfigs))
+	for _, k := range KafkaClusterConfigs {
+		if config[ControlKafkaPrefix+k] != "" {
+			res[k] = config[ControlKafkaPrefix+k]
+		}
+	}
+	return res
+}
+
+// KafkaBrokerList parses the bootstrap brokers which are separated by ";"
+// or ",", for e.g. "host1:9092;[fe80::1]:9092". The port is 9092 if it is
+// missing, invalid brokers are skipped
+func KafkaBrokerList(brokers string) []string {
+	var res []string
+	for _, broker := range strings.FieldsFunc(brokers, func(r rune) bool { return r == ';' || r == ',' }) {
+		if broker = strings.TrimSpace(broker); broker == "" {
+			continue
+		}
+
+		addr, err := NormalizeHostPort(broker, defaultKafkaPort)
+		if err != nil {
+			glog.Errorf("Skip Kafka broker=%s, error=%s", broker, err)
+			continue
+		}
+		res = append(res, addr)
+	}
+	return res
+}
+
+// NewKafkaConfig returns the sarama config shared by clients, producers and
+// consumers. Metadata is refreshed every KafkaMetadataRefresh seconds (60 by
+// default) and on errors, so that leadership moves to live brokers are
+// picked up when a broker is down
+// @brokerConfig: KafkaTLS "1" connects with TLS, KafkaTLSCAFile,
+// KafkaTLSCertFile, KafkaTLSKeyFile, KafkaTLSServerName and
+// KafkaTLSSkipVerify are the options of NewTLSConfig. KafkaSASLUser and
+// KafkaSASLPassword authenticate with SASL/PLAIN, the password may refer to
+// a secret, see ResolveSecret
+func NewKafkaConfig(brokerConfig BaseConfig, clientName string) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	if clientName != "" {
+		config.ClientID = clientName
+	}
+
+	config.Metadata.Retry.Max = maxRetry
+	config.Metadata.Retry.Backoff = time.Second
+	config.Metadata.RefreshFrequency = defaultMetadataRefreshFrequency
+	if freq, err := strconv.Atoi(brokerConfig[KafkaMetadataRefresh]); err == nil && freq > 0 {
+		config.Metadata.RefreshFrequency = time.Duration(freq) * time.Second
+	}
+	config.Producer.Retry.Max = maxRetry
+	config.Producer.Retry.Backoff = time.Second
+
+	if brokerConfig[KafkaTLS] == "1" {
+		tlsConfig, err := NewTLSConfig(BaseConfig{
+			TLSCAFile:     brokerConfig[KafkaTLSCAFile],
+			TLSCertFile:   brokerConfig[KafkaTLSCertFile],
+			TLSKeyFile:    brokerConfig[KafkaTLSKeyFile],
+			TLSServerName: brokerConfig[KafkaTLSServerName],
+			TLSSkipVerify: brokerConfig[KafkaTLSSkipVerify],
+		})
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if brokerConfig[KafkaSASLUser] != "" {
+		password, err := ResolveSecret(brokerConfig[KafkaSASLPassword])
+		if err != nil {
+			return nil, err
+		}
+
+		if brokerConfig[KafkaTLS] != "1" {
+			glog.Warningf("%s is configured without %s, the credentials are sent in clear text", KafkaSASLUser, KafkaTLS)
+		}
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = brokerConfig[KafkaSASLUser]
+		config.Net.SASL.Password = password
+	} else if brokerConfig[KafkaSASLPassword] != "" {
+		return nil, errors.New(fmt.Sprintf("%s is required with %s", KafkaSASLUser, KafkaSASLPassword))
+	}
+	return config, nil
+}
+
 func NewKafkaClient(brokerConfig BaseConfig, clientName string) *KafkaClient {
-	if brokerConfig[KafkaBrokers] == "" {
+	brokers := KafkaBrokerList(brokerConfig[KafkaBrokers])
+	if len(brokers) == 0 {
 		glog.Errorf("broker IP/port is required to create KafkaClient, got=%s", brokerConfig)
 		return nil
 	}
 
-	config := sarama.NewConfig()
-	config.ClientID = clientName
+	config, err := NewKafkaConfig(brokerConfig, clientName)
+	if err != nil {
+		glog.Errorf("Invalid configs of KafkaClient name=%s, error=%s", clientName, err)
+		return nil
+	}
 
-	brokers := strings.Split(brokerConfig[KafkaBrokers], ";")
 	client, err := sarama.NewClient(brokers, config)
 	if err != nil {
 		glog.Errorf("Failed to create KafkaClient name=%s, error=%s", clientName, err)
@@ -40,7 +199,15 @@ func NewKafkaClient(brokerConfig BaseConfig, clientName string) *KafkaClient {
 }
 
 func (client *KafkaClient) BrokerIPs() []string {
-	return strings.Split(client.brokerConfig[KafkaBrokers], ";")
+	return KafkaBrokerList(client.brokerConfig[KafkaBrokers])
+}
+
+// refreshMetadata forces a metadata refresh for the topics, errors are
+// logged only since the caller retries anyway
+func (client *KafkaClient) refreshMetadata(topics ...string) {
+	if err := client.client.RefreshMetadata(topics...); err != nil {
+		glog.Errorf("Failed to refresh metadata for topics=%s, error=%s", topics, err)
+	}
 }
 
 func (client *KafkaClient) TopicPartitions(topic string) (map[string][]int32, error) {
@@ -50,6 +217,11 @@ func (client *KafkaClient) TopicPartitions(topic string) (map[string][]int32, er
 		topics = append(topics, topic)
 	} else {
 		topics, err = client.client.Topics()
+		if err != nil {
+			client.refreshMetadata()
+			topics, err = client.client.Topics()
+		}
+
 		if err != nil {
 			glog.Errorf("Failed to get topics from Kafka, error=%s", err)
 			return nil, err
@@ -63,6 +235,11 @@ func (client *KafkaClient) TopicPartitions(topic string) (map[string][]int32, er
 		}
 
 		partitions, err := client.client.Partitions(topic)
+		if err != nil {
+			client.refreshMetadata(topic)
+			partitions, err = client.client.Partitions(topic)
+		}
+
 		if err != nil {
 			glog.Errorf("Failed to get partitions for topic=%s from Kafka, error=%s", topic, err)
 			continue
@@ -100,6 +277,15 @@ func (client *KafkaClient) GetConsumerOffset(consumerGroup string,
 
 	req.AddPartition(topic, partition)
 	resp, err := coordinator.FetchOffset(&req)
+	if err != nil {
+		// The coordinator may have moved to another broker
+		glog.Warningf("Failed to fetch offset from coordinator for consumer group=%s, error=%s, retry", consumerGroup, err)
+		client.client.RefreshCoordinator(consumerGroup)
+		if coordinator, err = client.client.Coordinator(consumerGroup); err == nil {
+			resp, err = coordinator.FetchOffset(&req)
+		}
+	}
+
 	if err != nil {
 		glog.Errorf("Failed to get offset for consumer group=%s, topic=%s, partition=%d, error=%s", consumerGroup, topic, partition, err)
 		return 0, err
@@ -125,6 +311,14 @@ func (client *KafkaClient) GetProducerOffset(topic string, partition int32) (int
 	ofreq.AddBlock(topic, partition, time.Now().UnixNano(), 10)
 
 	oresp, err := leader.GetAvailableOffsets(ofreq)
+	if err != nil {
+		// The leader may be down, retry once with the refreshed leader
+		client.refreshMetadata(topic)
+		if leader, err = client.Leader(topic, partition); err == nil && leader != nil {
+			oresp, err = leader.GetAvailableOffsets(ofreq)
+		}
+	}
+
 	if err != nil {
 		glog.Errorf("Failed to get the available offset for topic=%s, partition=%d, error=%s", topic, partition, err)
 		return 0, err
@@ -161,6 +355,14 @@ func (client *KafkaClient) GetLastBlock(topic string, partition int32) ([]byte,
 
 	freq.AddBlock(topic, partition, lastOffset, 1024)
 	fresp, err := leader.Fetch(freq)
+	if err != nil {
+		// The leader may be down, retry once with the refreshed leader
+		client.refreshMetadata(topic)
+		if leader, err = client.Leader(topic, partition); err == nil && leader != nil {
+			fresp, err = leader.Fetch(freq)
+		}
+	}
+
 	if err != nil {
 		glog.Errorf("Failed to get data for topic=%s, partition=%d, error=%s", topic, partition, err)
 		return nil, err
@@ -176,6 +378,67 @@ func (client *KafkaClient) GetLastBlock(topic string, partition int32) ([]byte,
 	return nil, nil
 }
 
+// GetLastMessages returns the values of the last count messages of the
+// partition at most, in offset order, nil if the topic or partition doesn't
+// exist
+func (client *KafkaClient) GetLastMessages(topic string, partition int32, count int64) ([][]byte, error) {
+	lastOffset, err := client.GetProducerOffset(topic, partition)
+	if lastOffset == topicOrPartitionNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The messages before the oldest offset are gone with the retention
+	offset := lastOffset - count
+	if oldest, err := client.Client().GetOffset(topic, partition, sarama.OffsetOldest); err == nil && offset < oldest {
+		offset = oldest
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var values [][]byte
+	for offset < lastOffset {
+		leader, err := client.Leader(topic, partition)
+		if err != nil || leader == nil {
+			return nil, err
+		}
+
+		freq := &sarama.FetchRequest{
+			MaxWaitTime: 1000, // millisec
+			MinBytes:    1,
+		}
+		freq.AddBlock(topic, partition, offset, 1024*1024)
+		fresp, err := leader.Fetch(freq)
+		if err != nil {
+			glog.Errorf("Failed to get data for topic=%s, partition=%d, error=%s", topic, partition, err)
+			return nil, err
+		}
+
+		block := fresp.Blocks[topic][partition]
+		if block == nil || block.Err != sarama.ErrNoError {
+			return nil, errors.New(fmt.Sprintf("Failed to fetch topic=%s, partition=%d, offset=%d", topic, partition, offset))
+		}
+
+		fetched := offset
+		for _, msgBlock := range block.MsgSet.Messages {
+			if msgBlock.Offset < offset || msgBlock.Offset >= lastOffset {
+				continue
+			}
+			values = append(values, msgBlock.Msg.Value)
+			offset = msgBlock.Offset + 1
+		}
+
+		if offset == fetched {
+			// Nothing more can be fetched, for e.g. a message above the
+			// fetch size
+			break
+		}
+	}
+	return values, nil
+}
+
 func (client *KafkaClient) Leader(topic string, partition int32) (*sarama.Broker, error) {
 	var leader *sarama.Broker
 	var err error
@@ -190,6 +453,7 @@ func (client *KafkaClient) Leader(topic string, partition int32) (*sarama.Broker
 			}
 
 			time.Sleep(time.Second)
+			client.refreshMetadata(topic)
 		} else {
 			return leader, err
 		}
@@ -4,22 +4,21 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/golang/glog"
 	"strconv"
-	"sync/atomic"
-)
-
-const (
-	started = 1
-	stopped = 0
 )
 
 type KafkaCheckpointer struct {
 	client       *KafkaClient
 	syncProducer sarama.SyncProducer
-	state        int32
+	lifecycle    Lifecycle
 }
 
 func NewKafkaCheckpointer(client *KafkaClient) Checkpointer {
-	syncConfig := sarama.NewConfig()
+	syncConfig, err := NewKafkaConfig(client.brokerConfig, "")
+	if err != nil {
+		glog.Errorf("Invalid Kafka configs for checkpoint, error=%s", err)
+		return nil
+	}
+
 	syncConfig.Producer.Partitioner = sarama.NewManualPartitioner
 	syncProducer, err := sarama.NewSyncProducer(client.BrokerIPs(), syncConfig)
 	if err != nil {
@@ -30,17 +29,19 @@ func NewKafkaCheckpointer(client *KafkaClient) Checkpointer {
 	return &KafkaCheckpointer{
 		client:       client,
 		syncProducer: syncProducer,
-		state:        started,
 	}
 }
 
 func (ck *KafkaCheckpointer) Start() {
+	if ck.lifecycle.Start("KafkaCheckpointer") != nil {
+		return
+	}
 	glog.Infof("KafkaCheckpointer started...")
 }
 
 func (ck *KafkaCheckpointer) Stop() {
-	if !atomic.CompareAndSwapInt32(&ck.state, started, stopped) {
-		glog.Infof("KafkaCheckpointer has already stopped")
+	// The producer is created with the checkpointer, close it even if it is not started
+	if ck.lifecycle.Stop("KafkaCheckpointer") == ErrAlreadyStopped {
 		return
 	}
 
@@ -48,6 +49,10 @@ func (ck *KafkaCheckpointer) Stop() {
 	glog.Infof("KafkaCheckpointer stopped...")
 }
 
+func (ck *KafkaCheckpointer) Status() string {
+	return ck.lifecycle.Status()
+}
+
 func (ck *KafkaCheckpointer) GetCheckpoint(keyInfo map[string]string) ([]byte, error) {
 	partition, _ := strconv.Atoi(keyInfo[CheckpointPartition])
 	data, err := ck.client.GetLastBlock(keyInfo[CheckpointTopic], int32(partition))
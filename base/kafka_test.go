@@ -17,3 +17,65 @@ func TestKafkaClient(t *testing.T) {
 	}
 	fmt.Println(topicPartitions)
 }
+
+func TestKafkaBrokerList(t *testing.T) {
+	brokers := KafkaBrokerList("host1:9092; host2:9092,host3:9092;;")
+	if len(brokers) != 3 || brokers[0] != "host1:9092" || brokers[1] != "host2:9092" || brokers[2] != "host3:9092" {
+		t.Errorf("Failed to parse broker list, got=%s", brokers)
+	}
+
+	brokers = KafkaBrokerList("[fe80::1]:9093,host2,fe80::2:9092:x")
+	if len(brokers) != 2 || brokers[0] != "[fe80::1]:9093" || brokers[1] != "host2:9092" {
+		t.Errorf("Failed to parse IPv6 broker list, got=%s", brokers)
+	}
+}
+
+func TestControlKafkaConfig(t *testing.T) {
+	config := BaseConfig{
+		KafkaBrokers:        "data:9092",
+		KafkaSASLUser:       "collector",
+		KafkaTopic:          "snow",
+		ControlKafkaBrokers: "control:9092",
+		"ControlKafkaTLS":   "1",
+	}
+
+	data := DataKafkaConfig(config)
+	if len(data) != 2 || data[KafkaBrokers] != "data:9092" || data[KafkaSASLUser] != "collector" {
+		t.Errorf("Unexpected data cluster configs=%s", data)
+	}
+
+	control := ControlKafkaConfig(config)
+	if len(control) != 2 || control[KafkaBrokers] != "control:9092" || control[KafkaTLS] != "1" {
+		t.Errorf("Unexpected control cluster configs=%s", control)
+	}
+
+	delete(config, ControlKafkaBrokers)
+	if control = ControlKafkaConfig(config); control[KafkaBrokers] != "data:9092" || control[KafkaTLS] != "" {
+		t.Errorf("Expect the data cluster without %s, got=%s", ControlKafkaBrokers, control)
+	}
+}
+
+func TestKafkaConfigSecurity(t *testing.T) {
+	config, err := NewKafkaConfig(BaseConfig{KafkaTLS: "1", KafkaTLSServerName: "kafka.example.com", KafkaSASLUser: "u", KafkaSASLPassword: "p"}, "")
+	if err != nil || !config.Net.TLS.Enable || config.Net.TLS.Config.ServerName != "kafka.example.com" {
+		t.Errorf("Expect TLS enabled, error=%v", err)
+	}
+
+	if err == nil && (!config.Net.SASL.Enable || config.Net.SASL.User != "u" || config.Net.SASL.Password != "p") {
+		t.Errorf("Expect SASL enabled, got=%+v", config.Net.SASL)
+	}
+
+	if config, err = NewKafkaConfig(BaseConfig{}, ""); err != nil || config.Net.TLS.Enable || config.Net.SASL.Enable {
+		t.Errorf("Expect neither TLS nor SASL by default, error=%v", err)
+	}
+
+	for _, invalid := range []BaseConfig{
+		{KafkaTLS: "1", KafkaTLSCAFile: "not_exist.pem"},
+		{KafkaSASLUser: "u", KafkaSASLPassword: "env:DESCARTES_TEST_MISSING"},
+		{KafkaSASLPassword: "p"},
+	} {
+		if _, err := NewKafkaConfig(invalid, ""); err == nil {
+			t.Errorf("Expect invalid Kafka configs=%s rejected", invalid)
+		}
+	}
+}
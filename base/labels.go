@@ -0,0 +1,34 @@
+package base
+
+import (
+	"strings"
+)
+
+// ParseLabels parses labels in "k1=v1,k2=v2" format
+func ParseLabels(labels string) map[string]string {
+	res := make(map[string]string)
+	for _, kv := range strings.Split(labels, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			res[pair[0]] = ""
+		} else {
+			res[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+		}
+	}
+	return res
+}
+
+// MatchLabels returns true if every constraint is satisfied by labels
+func MatchLabels(labels, constraints map[string]string) bool {
+	for k, v := range constraints {
+		if val, ok := labels[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	labels := ParseLabels("zone=us-east, dc=dc1,,rack")
+	if len(labels) != 3 || labels["zone"] != "us-east" || labels["dc"] != "dc1" {
+		t.Errorf("Failed to parse labels, got=%s", labels)
+	}
+
+	if !MatchLabels(labels, ParseLabels("")) {
+		t.Errorf("Empty constraints should match any labels")
+	}
+
+	if !MatchLabels(labels, ParseLabels("zone=us-east,dc=dc1")) {
+		t.Errorf("Constraints should match labels=%s", labels)
+	}
+
+	if MatchLabels(labels, ParseLabels("zone=us-west")) {
+		t.Errorf("Constraint zone=us-west should not match labels=%s", labels)
+	}
+
+	if MatchLabels(nil, ParseLabels("zone=us-east")) {
+		t.Errorf("Constraint should not match host without labels")
+	}
+}
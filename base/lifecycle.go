@@ -0,0 +1,159 @@
+package base
+
+import (
+	"errors"
+	"github.com/golang/glog"
+	"sync/atomic"
+)
+
+const (
+	LifecycleNew     = "new"
+	LifecycleStarted = "started"
+	LifecycleStopped = "stopped"
+)
+
+const (
+	lifecycleNew int32 = iota
+	lifecycleStarted
+	lifecycleStopped
+)
+
+var (
+	ErrAlreadyStarted = errors.New("already started")
+	ErrAlreadyStopped = errors.New("already stopped")
+	ErrNotStarted     = errors.New("not started")
+)
+
+// Lifecycle is the Start/Stop state of a component, for e.g. a DataReader,
+// a DataWriter or a service: it starts once and stops once, the duplicate
+// calls are logged no-ops, so that the components can be stopped by their
+// owners without tracking who started what. A stopped component is not
+// started again, it has closed its clients by then, and a component stopped
+// before it started is just marked stopped. The Start and Stop of the
+// DataReader, DataWriter and Checkpointer interfaces don't return the
+// Lifecycle errors, NewComponent does. The zero value is a new component
+type Lifecycle struct {
+	state int32
+}
+
+// Start moves the component of name from new to started, returns
+// ErrAlreadyStarted or ErrAlreadyStopped if it is not new, the caller shall
+// not start it again then
+func (lc *Lifecycle) Start(name string) error {
+	if atomic.CompareAndSwapInt32(&lc.state, lifecycleNew, lifecycleStarted) {
+		return nil
+	}
+
+	if atomic.LoadInt32(&lc.state) == lifecycleStarted {
+		glog.Infof("%s already started", name)
+		return ErrAlreadyStarted
+	}
+	glog.Warningf("%s is stopped and can't be started again", name)
+	return ErrAlreadyStopped
+}
+
+// Stop moves the component of name to stopped, returns ErrNotStarted if it
+// was new and ErrAlreadyStopped if it was stopped, the caller shall not tear
+// it down then
+func (lc *Lifecycle) Stop(name string) error {
+	if atomic.CompareAndSwapInt32(&lc.state, lifecycleStarted, lifecycleStopped) {
+		return nil
+	}
+
+	if atomic.CompareAndSwapInt32(&lc.state, lifecycleNew, lifecycleStopped) {
+		glog.Infof("%s stopped before it started", name)
+		return ErrNotStarted
+	}
+	glog.Infof("%s already stopped", name)
+	return ErrAlreadyStopped
+}
+
+// Running returns true between Start and Stop
+func (lc *Lifecycle) Running() bool {
+	return atomic.LoadInt32(&lc.state) == lifecycleStarted
+}
+
+// Stopped returns true once Stop is called
+func (lc *Lifecycle) Stopped() bool {
+	return atomic.LoadInt32(&lc.state) == lifecycleStopped
+}
+
+// Status returns LifecycleNew, LifecycleStarted or LifecycleStopped
+func (lc *Lifecycle) Status() string {
+	switch atomic.LoadInt32(&lc.state) {
+	case lifecycleStarted:
+		return LifecycleStarted
+	case lifecycleStopped:
+		return LifecycleStopped
+	}
+	return LifecycleNew
+}
+
+// Startable is the Start and Stop of the DataReaders, the DataWriters, the
+// Checkpointers and the services
+type Startable interface {
+	Start()
+	Stop()
+}
+
+// StatusReporter is implemented by the components following the Lifecycle
+// contract
+type StatusReporter interface {
+	Status() string
+}
+
+// Component is the Lifecycle contract with the errors returned, for the code
+// composing the components, for e.g. the pipeline builder
+type Component interface {
+	Start() error
+	Stop() error
+	Status() string
+}
+
+type component struct {
+	name      string
+	startable Startable
+	lifecycle Lifecycle
+}
+
+// NewComponent adapts startable to Component. Whatever startable does on
+// the duplicate calls, they return the Lifecycle errors, and its panics are
+// returned as *PanicError, a component whose Start panics is stopped
+// @name: identifies the component in the log
+func NewComponent(name string, startable Startable) Component {
+	return &component{name: name, startable: startable}
+}
+
+func (c *component) Start() error {
+	if err := c.lifecycle.Start(c.name); err != nil {
+		return err
+	}
+
+	err := CallSafely(c.name, func() error {
+		c.startable.Start()
+		return nil
+	})
+	if err != nil {
+		c.lifecycle.Stop(c.name)
+	}
+	return err
+}
+
+func (c *component) Stop() error {
+	if err := c.lifecycle.Stop(c.name); err != nil {
+		return err
+	}
+
+	return CallSafely(c.name, func() error {
+		c.startable.Stop()
+		return nil
+	})
+}
+
+// Status returns the status reported by the component itself if it can
+func (c *component) Status() string {
+	if reporter, ok := c.startable.(StatusReporter); ok {
+		return reporter.Status()
+	}
+	return c.lifecycle.Status()
+}
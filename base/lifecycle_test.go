@@ -0,0 +1,84 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	var lc Lifecycle
+	if lc.Status() != LifecycleNew || lc.Running() || lc.Stopped() {
+		t.Errorf("Expect a new lifecycle, got %s", lc.Status())
+	}
+
+	if err := lc.Start("test"); err != nil || !lc.Running() {
+		t.Errorf("Expect started, got %s, error=%v", lc.Status(), err)
+	}
+
+	if err := lc.Start("test"); err != ErrAlreadyStarted {
+		t.Errorf("Expect ErrAlreadyStarted, got %v", err)
+	}
+
+	if err := lc.Stop("test"); err != nil || !lc.Stopped() {
+		t.Errorf("Expect stopped, got %s, error=%v", lc.Status(), err)
+	}
+
+	if err := lc.Stop("test"); err != ErrAlreadyStopped {
+		t.Errorf("Expect ErrAlreadyStopped, got %v", err)
+	}
+
+	if err := lc.Start("test"); err != ErrAlreadyStopped || lc.Status() != LifecycleStopped {
+		t.Errorf("Expect a stopped lifecycle not restarted, got %s, error=%v", lc.Status(), err)
+	}
+
+	var unstarted Lifecycle
+	if err := unstarted.Stop("test"); err != ErrNotStarted || !unstarted.Stopped() {
+		t.Errorf("Expect ErrNotStarted and stopped, got %s, error=%v", unstarted.Status(), err)
+	}
+}
+
+type countingStartable struct {
+	starts int
+	stops  int
+	panics bool
+}
+
+func (s *countingStartable) Start() {
+	s.starts++
+	if s.panics {
+		panic("boom")
+	}
+}
+
+func (s *countingStartable) Stop() {
+	s.stops++
+}
+
+func TestComponent(t *testing.T) {
+	startable := &countingStartable{}
+	component := NewComponent("counting", startable)
+	if err := component.Start(); err != nil {
+		t.Errorf("Expect no error, got %s", err)
+	}
+
+	if err := component.Start(); err != ErrAlreadyStarted {
+		t.Errorf("Expect ErrAlreadyStarted, got %v", err)
+	}
+
+	if component.Status() != LifecycleStarted {
+		t.Errorf("Expect started, got %s", component.Status())
+	}
+
+	component.Stop()
+	if err := component.Stop(); err != ErrAlreadyStopped {
+		t.Errorf("Expect ErrAlreadyStopped, got %v", err)
+	}
+
+	if startable.starts != 1 || startable.stops != 1 || component.Status() != LifecycleStopped {
+		t.Errorf("Expect started and stopped once, got starts=%d, stops=%d", startable.starts, startable.stops)
+	}
+
+	panicky := NewComponent("panicky", &countingStartable{panics: true})
+	if _, ok := panicky.Start().(*PanicError); !ok || panicky.Status() != LifecycleStopped {
+		t.Errorf("Expect the panic returned and the component stopped, got %s", panicky.Status())
+	}
+}
@@ -0,0 +1,136 @@
+package base
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires int64 // nano seconds since epoch, 0 never expires
+}
+
+// LRUCache is a size bounded cache with TTL for reference lookups, for e.g.
+// resolving the sys_id of users, groups and CIs, so repeated resolutions
+// across collection cycles don't multiply API calls
+type LRUCache struct {
+	size      int
+	ttl       time.Duration
+	entries   map[string]*list.Element
+	lru       *list.List // most recently used at front
+	hits      int64
+	misses    int64
+	clock     Clock
+	lockGuard sync.Mutex
+}
+
+// NewLRUCache
+// @size: max number of entries, the least recently used one is evicted
+// @ttl: entries expire after ttl, never if it is not positive
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &LRUCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		lru:     list.New(),
+		clock:   SystemClock,
+	}
+}
+
+// SetClock replaces the SystemClock which expires the entries
+func (cache *LRUCache) SetClock(clock Clock) {
+	cache.lockGuard.Lock()
+	cache.clock = clock
+	cache.lockGuard.Unlock()
+}
+
+func (cache *LRUCache) Get(key string) (interface{}, bool) {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	elem, ok := cache.entries[key]
+	if !ok {
+		atomic.AddInt64(&cache.misses, 1)
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if entry.expires != 0 && cache.clock.Now().UnixNano() >= entry.expires {
+		cache.removeElement(elem)
+		atomic.AddInt64(&cache.misses, 1)
+		return nil, false
+	}
+
+	cache.lru.MoveToFront(elem)
+	atomic.AddInt64(&cache.hits, 1)
+	return entry.value, true
+}
+
+func (cache *LRUCache) Set(key string, value interface{}) {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	var expires int64
+	if cache.ttl > 0 {
+		expires = cache.clock.Now().Add(cache.ttl).UnixNano()
+	}
+
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		cache.lru.MoveToFront(elem)
+		return
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&lruEntry{key, value, expires})
+	for cache.lru.Len() > cache.size {
+		cache.removeElement(cache.lru.Back())
+	}
+}
+
+// GetOrLoad returns the cached value of key, or loads and caches it. Load
+// errors are not cached
+func (cache *LRUCache) GetOrLoad(key string, load func(key string) (interface{}, error)) (interface{}, error) {
+	if value, ok := cache.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := load(key)
+	if err != nil {
+		return nil, err
+	}
+	cache.Set(key, value)
+	return value, nil
+}
+
+func (cache *LRUCache) Remove(key string) {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	if elem, ok := cache.entries[key]; ok {
+		cache.removeElement(elem)
+	}
+}
+
+func (cache *LRUCache) Len() int {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+	return cache.lru.Len()
+}
+
+// Stats returns the number of hits and misses so far
+func (cache *LRUCache) Stats() (int64, int64) {
+	return atomic.LoadInt64(&cache.hits), atomic.LoadInt64(&cache.misses)
+}
+
+func (cache *LRUCache) removeElement(elem *list.Element) {
+	cache.lru.Remove(elem)
+	delete(cache.entries, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,64 @@
+package base
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2, 0)
+	cache.Set("user1", "Ken")
+	cache.Set("user2", "Tom")
+	cache.Get("user1")
+	cache.Set("user3", "Bob")
+
+	if _, ok := cache.Get("user2"); ok {
+		t.Errorf("Expect the least recently used user2 evicted")
+	}
+
+	if v, ok := cache.Get("user1"); !ok || v != "Ken" {
+		t.Errorf("Expect user1 cached, got=%v", v)
+	}
+
+	if cache.Len() != 2 {
+		t.Errorf("Expect 2 entries, got=%d", cache.Len())
+	}
+
+	loads := 0
+	load := func(key string) (interface{}, error) {
+		loads++
+		if key == "missing" {
+			return nil, errors.New("not found")
+		}
+		return "group:" + key, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if v, err := cache.GetOrLoad("admins", load); err != nil || v != "group:admins" {
+			t.Errorf("Unexpected value=%v, error=%v", v, err)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("Expect 1 load, got=%d", loads)
+	}
+
+	if _, err := cache.GetOrLoad("missing", load); err == nil {
+		t.Errorf("Expect load error")
+	}
+
+	hits, misses := cache.Stats()
+	if hits != 4 || misses != 3 {
+		t.Errorf("Expect 4 hits and 3 misses, got hits=%d, misses=%d", hits, misses)
+	}
+
+	clock := NewFakeClock(time.Now())
+	ttlCache := NewLRUCache(10, 10*time.Millisecond)
+	ttlCache.SetClock(clock)
+	ttlCache.Set("ci1", "web01")
+	clock.Advance(20 * time.Millisecond)
+	if _, ok := ttlCache.Get("ci1"); ok || ttlCache.Len() != 0 {
+		t.Errorf("Expect ci1 expired")
+	}
+}
@@ -0,0 +1,125 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+const (
+	// Buckets of the metadata store
+	MetadataTasks       = "tasks"       // TaskConfigKey => accepted task config
+	MetadataSpool       = "spool"       // spool file => index
+	MetadataDedupe      = "dedupe"      // dedupe cache name => serialized cache
+	MetadataRunHistory  = "run_history" // job key => serialized job runs
+	MetadataCheckpoints = "checkpoints" // checkpoint key|partition => transitions
+
+	defaultMetadataStorePath = "descartes_metadata.db"
+	metadataStoreOpenTimeout = 10 * time.Second
+)
+
+// MetadataStore keeps the collector local durable state in an embedded
+// BoltDB file, so a restarted collector recovers without re-reading the
+// Kafka topics or the ZooKeeper trees. It is not shared between collectors
+type MetadataStore struct {
+	db *bolt.DB
+}
+
+// NewMetadataStore opens or creates the store file, only one process can
+// open it at a time
+// @config: MetadataStorePath, "descartes_metadata.db" by default
+func NewMetadataStore(config BaseConfig) *MetadataStore {
+	path := config[MetadataStorePath]
+	if path == "" {
+		path = defaultMetadataStorePath
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: metadataStoreOpenTimeout})
+	if err != nil {
+		glog.Errorf("Failed to open metadata store=%s, error=%s", path, err)
+		return nil
+	}
+
+	glog.Infof("Opened metadata store=%s", path)
+	return &MetadataStore{
+		db: db,
+	}
+}
+
+func (store *MetadataStore) Close() error {
+	err := store.db.Close()
+	if err != nil {
+		glog.Errorf("Failed to close metadata store=%s, error=%s", store.db.Path(), err)
+	}
+	return err
+}
+
+// Get returns nil if key doesn't exist in bucket
+func (store *MetadataStore) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		// The value is only valid in the transaction
+		if v := b.Get([]byte(key)); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Put creates bucket if it doesn't exist
+func (store *MetadataStore) Put(bucket, key string, value []byte) error {
+	if key == "" {
+		return errors.New(fmt.Sprintf("Empty key in metadata store bucket=%s", bucket))
+	}
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+
+	if err != nil {
+		glog.Errorf("Failed to put key=%s to metadata store bucket=%s, error=%s", key, bucket, err)
+	}
+	return err
+}
+
+func (store *MetadataStore) Delete(bucket, key string) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+
+	if err != nil {
+		glog.Errorf("Failed to delete key=%s from metadata store bucket=%s, error=%s", key, bucket, err)
+	}
+	return err
+}
+
+// ForEach calls f for every key of bucket in key order, stops at the first
+// error of f and returns it
+func (store *MetadataStore) ForEach(bucket string, f func(key string, value []byte) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			return f(string(k), append([]byte(nil), v...))
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata_store")
+	if err != nil {
+		t.Errorf("Failed to create temp dir, error=%s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	config := BaseConfig{
+		MetadataStorePath: filepath.Join(dir, "metadata.db"),
+	}
+
+	store := NewMetadataStore(config)
+	if store == nil {
+		t.Fatalf("Failed to open metadata store")
+	}
+
+	if value, err := store.Get(MetadataTasks, "task1"); value != nil || err != nil {
+		t.Errorf("Expect nil for the missing bucket, got %s, error=%v", value, err)
+	}
+
+	store.Put(MetadataTasks, "task2", []byte("config2"))
+	store.Put(MetadataTasks, "task1", []byte("config1"))
+	store.Put(MetadataTasks, "task3", []byte("config3"))
+	store.Delete(MetadataTasks, "task3")
+
+	if err := store.Put(MetadataTasks, "", []byte("config")); err == nil {
+		t.Errorf("Expect error for empty key")
+	}
+	store.Close()
+
+	// Survives restarts
+	store = NewMetadataStore(config)
+	if store == nil {
+		t.Fatalf("Failed to reopen metadata store")
+	}
+	defer store.Close()
+
+	if value, _ := store.Get(MetadataTasks, "task1"); string(value) != "config1" {
+		t.Errorf("Expect config1, got %s", value)
+	}
+
+	var keys []string
+	store.ForEach(MetadataTasks, func(key string, value []byte) error {
+		keys = append(keys, key+"="+string(value))
+		return nil
+	})
+
+	if len(keys) != 2 || keys[0] != "task1=config1" || keys[1] != "task2=config2" {
+		t.Errorf("Expect task1 and task2 in key order, got %v", keys)
+	}
+}
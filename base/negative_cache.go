@@ -0,0 +1,135 @@
+package base
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRecheckInterval    = time.Minute
+	defaultMaxRecheckInterval = 6 * time.Hour
+)
+
+// ConfigError is a failure which doesn't go away by retrying, for e.g. the
+// table doesn't exist or the account has no permission to read it
+type ConfigError struct {
+	Reason string
+}
+
+func NewConfigError(reason string) error {
+	return &ConfigError{Reason: reason}
+}
+
+func (err *ConfigError) Error() string {
+	return "configuration error: " + err.Reason
+}
+
+func IsConfigError(err error) bool {
+	var configErr *ConfigError
+	return errors.As(err, &configErr)
+}
+
+type NegativeCacheEntry struct {
+	Key       string
+	Error     string
+	Failures  int
+	NextCheck int64 // nano seconds since epoch
+}
+
+// NegativeCache remembers the jobs which keep failing on configuration
+// errors. They are re-checked at escalating intervals instead of failing
+// identically in every cycle
+type NegativeCache struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	entries     map[string]*NegativeCacheEntry // job key indexed
+	lockGuard   sync.Mutex
+}
+
+// NewNegativeCache
+// @interval: wait before the first re-check, doubled for every failed
+// re-check up to maxInterval. Use the defaults if they are not positive
+func NewNegativeCache(interval, maxInterval time.Duration) *NegativeCache {
+	if interval <= 0 {
+		interval = defaultRecheckInterval
+	}
+
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxRecheckInterval
+	}
+
+	return &NegativeCache{
+		interval:    interval,
+		maxInterval: maxInterval,
+		entries:     make(map[string]*NegativeCacheEntry),
+	}
+}
+
+// Allow returns true if the job is not cached or it is time to re-check it
+func (cache *NegativeCache) Allow(key string, now time.Time) bool {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	entry, ok := cache.entries[key]
+	return !ok || now.UnixNano() >= entry.NextCheck
+}
+
+// Fail caches the job with the error and schedules the next re-check
+func (cache *NegativeCache) Fail(key string, err error, now time.Time) {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok {
+		entry = &NegativeCacheEntry{Key: key}
+		cache.entries[key] = entry
+	}
+
+	wait := cache.interval
+	for i := 0; i < entry.Failures && wait < cache.maxInterval; i++ {
+		wait *= 2
+	}
+
+	if wait > cache.maxInterval {
+		wait = cache.maxInterval
+	}
+	entry.Failures++
+	entry.Error = err.Error()
+	entry.NextCheck = now.Add(wait).UnixNano()
+}
+
+// Succeed removes the job from the cache
+func (cache *NegativeCache) Succeed(key string) {
+	cache.lockGuard.Lock()
+	delete(cache.entries, key)
+	cache.lockGuard.Unlock()
+}
+
+// Entries returns the cached jobs sorted by key
+func (cache *NegativeCache) Entries() []NegativeCacheEntry {
+	cache.lockGuard.Lock()
+	defer cache.lockGuard.Unlock()
+
+	entries := make([]NegativeCacheEntry, 0, len(cache.entries))
+	for _, entry := range cache.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Sort(negativeCacheEntries(entries))
+	return entries
+}
+
+type negativeCacheEntries []NegativeCacheEntry
+
+func (s negativeCacheEntries) Len() int {
+	return len(s)
+}
+
+func (s negativeCacheEntries) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s negativeCacheEntries) Less(i, j int) bool {
+	return s[i].Key < s[j].Key
+}
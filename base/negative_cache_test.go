@@ -0,0 +1,39 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	cache := NewNegativeCache(time.Minute, 3*time.Minute)
+	now := time.Now()
+	if !cache.Allow("incident", now) {
+		t.Errorf("Uncached job should be allowed")
+	}
+
+	err := NewConfigError("table incidnet doesn't exist")
+	waits := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for _, wait := range waits {
+		cache.Fail("incident", err, now)
+		if cache.Allow("incident", now.Add(wait-time.Second)) || !cache.Allow("incident", now.Add(wait)) {
+			t.Errorf("Expect the job to be re-checked after %s, got=%+v", wait, cache.Entries())
+		}
+	}
+
+	entries := cache.Entries()
+	if len(entries) != 1 || entries[0].Failures != len(waits) || entries[0].Error != err.Error() {
+		t.Errorf("Unexpected entries=%+v", entries)
+	}
+
+	cache.Succeed("incident")
+	if !cache.Allow("incident", now) || len(cache.Entries()) != 0 {
+		t.Errorf("Expect the job removed from the cache after success")
+	}
+
+	if !IsConfigError(fmt.Errorf("wrapped: %w", err)) || IsConfigError(errors.New("timeout")) {
+		t.Errorf("IsConfigError misclassified errors")
+	}
+}
@@ -0,0 +1,84 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// IPFamily values, both families are used if it is not set
+	IPFamilyV4 = "ipv4"
+	IPFamilyV6 = "ipv6"
+
+	defaultDialTimeout = 30 * time.Second
+)
+
+// NormalizeHostPort returns addr in "host:port" form with the IPv6 literals
+// bracketed, for e.g. "[fe80::1]:9092"
+// @addr: "host", "host:port", "[ipv6]", "[ipv6]:port" or a bare IPv6
+// literal. IPv6 literals with port shall be bracketed
+// @defaultPort: used if addr has no port, an error if it is empty
+func NormalizeHostPort(addr, defaultPort string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", errors.New("Empty address")
+	}
+
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if port == "" {
+			port = defaultPort
+		}
+
+		if host != "" && port != "" {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if host == "" || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", errors.New(fmt.Sprintf("Invalid address=%s, IPv6 literals with port shall be bracketed, for e.g. [::1]:9092", addr))
+	}
+
+	if defaultPort == "" {
+		return "", errors.New(fmt.Sprintf("Port is missing in address=%s", addr))
+	}
+	return net.JoinHostPort(host, defaultPort), nil
+}
+
+// IPNetwork returns network, for e.g. "tcp", restricted to the IPFamily of
+// config, "tcp4" or "tcp6"
+func IPNetwork(config BaseConfig, network string) string {
+	if network != "tcp" && network != "udp" {
+		return network
+	}
+
+	switch config[IPFamily] {
+	case "":
+		return network
+	case IPFamilyV4:
+		return network + "4"
+	case IPFamilyV6:
+		return network + "6"
+	default:
+		glog.Errorf("Unsupported %s=%s, expect %s or %s, use both", IPFamily, config[IPFamily], IPFamilyV4, IPFamilyV6)
+		return network
+	}
+}
+
+// NewDialContext returns a dial function connecting with the IPFamily of
+// config. Dual-stack hostnames try both families otherwise
+func NewDialContext(config BaseConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, IPNetwork(config, network), addr)
+	}
+}
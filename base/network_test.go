@@ -0,0 +1,55 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestNormalizeHostPort(t *testing.T) {
+	cases := map[string]string{
+		"host1":            "host1:9092",
+		"host1:9093":       "host1:9093",
+		"10.0.0.1":         "10.0.0.1:9092",
+		"[fe80::1]:9093":   "[fe80::1]:9093",
+		"[fe80::1]":        "[fe80::1]:9092",
+		"fe80::1":          "[fe80::1]:9092",
+		" ::1 ":            "[::1]:9092",
+		"host1:":           "host1:9092",
+		"[2001:db8::1]:80": "[2001:db8::1]:80",
+	}
+
+	for addr, expected := range cases {
+		res, err := NormalizeHostPort(addr, "9092")
+		if res != expected || err != nil {
+			t.Errorf("Expect %s normalized to %s, got %s, error=%v", addr, expected, res, err)
+		}
+	}
+
+	for _, addr := range []string{"", "host1:9092:1", "[]:9092"} {
+		if res, err := NormalizeHostPort(addr, "9092"); err == nil {
+			t.Errorf("Expect error for address=%q, got %s", addr, res)
+		}
+	}
+
+	if _, err := NormalizeHostPort("host1", ""); err == nil {
+		t.Errorf("Expect error for the missing port")
+	}
+}
+
+func TestIPNetwork(t *testing.T) {
+	cases := map[string]string{
+		"":         "tcp",
+		IPFamilyV4: "tcp4",
+		IPFamilyV6: "tcp6",
+		"ipx":      "tcp",
+	}
+
+	for family, expected := range cases {
+		if network := IPNetwork(BaseConfig{IPFamily: family}, "tcp"); network != expected {
+			t.Errorf("Expect %s for IPFamily=%s, got %s", expected, family, network)
+		}
+	}
+
+	if network := IPNetwork(BaseConfig{IPFamily: IPFamilyV6}, "tcp4"); network != "tcp4" {
+		t.Errorf("Expect explicit network kept, got %s", network)
+	}
+}
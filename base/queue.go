@@ -0,0 +1,202 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrQueueClosed is returned by Dequeue when the queue is closed and
+// drained, and by Enqueue when it is closed
+var ErrQueueClosed = errors.New("queue closed")
+
+// QueueItem is the data dequeued, it shall be acknowledged by Ack once it
+// has been handled, or returned to the queue by Nack
+type QueueItem struct {
+	ID   uint64
+	Data *Data
+}
+
+// Queue buffers data between a producer and a consumer with at-least-once
+// delivery. The items are dequeued in the order they were enqueued, Nack
+// puts an item back before the others. Durable implementations redeliver
+// the items which were not acknowledged when they are opened again.
+// Implementations shall be safe for concurrent use
+type Queue interface {
+	// Enqueue blocks while the queue is full until ctx is done
+	Enqueue(ctx context.Context, data *Data) error
+	// Dequeue blocks until an item is available, ctx is done or the queue is
+	// closed and drained. An available item is returned even if ctx is done
+	Dequeue(ctx context.Context) (*QueueItem, error)
+	Ack(item *QueueItem) error
+	Nack(item *QueueItem) error
+	// Len returns the number of items not acknowledged yet
+	Len() int
+	Close() error
+}
+
+// queueState keeps the order and the delivery of the item IDs of a Queue
+type queueState struct {
+	pending  []uint64 // to be dequeued in order
+	inflight map[uint64]bool
+	nextID   uint64
+	closed   bool
+	notify   chan struct{} // signaled when pending or closed changes
+	mutex    sync.Mutex
+}
+
+func newQueueState() *queueState {
+	return &queueState{
+		inflight: make(map[uint64]bool),
+		nextID:   1,
+		notify:   make(chan struct{}),
+	}
+}
+
+// broadcast wakes up the waiters, it shall be called with mutex held
+func (state *queueState) broadcast() {
+	close(state.notify)
+	state.notify = make(chan struct{})
+}
+
+// next removes the next pending ID and marks it in flight, it waits the
+// same way as Queue.Dequeue
+func (state *queueState) next(ctx context.Context) (uint64, error) {
+	state.mutex.Lock()
+	for {
+		if len(state.pending) > 0 {
+			id := state.pending[0]
+			state.pending = state.pending[1:]
+			state.inflight[id] = true
+			state.mutex.Unlock()
+			return id, nil
+		}
+
+		if state.closed {
+			state.mutex.Unlock()
+			return 0, ErrQueueClosed
+		}
+
+		notify := state.notify
+		state.mutex.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		state.mutex.Lock()
+	}
+}
+
+// settle removes id from the items in flight, false if it is not
+func (state *queueState) settle(id uint64, requeue bool) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if !state.inflight[id] {
+		return false
+	}
+	delete(state.inflight, id)
+
+	if requeue {
+		// The IDs are in the enqueue order
+		state.pending = append(state.pending, id)
+		sort.Slice(state.pending, func(i, j int) bool { return state.pending[i] < state.pending[j] })
+	}
+	state.broadcast()
+	return true
+}
+
+func (state *queueState) len() int {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return len(state.pending) + len(state.inflight)
+}
+
+// MemoryQueue is a Queue in memory, the items are lost on restart
+type MemoryQueue struct {
+	state    *queueState
+	items    map[uint64]*Data
+	capacity int
+}
+
+// NewMemoryQueue
+// @capacity: max number of items not acknowledged, Enqueue blocks beyond it
+func NewMemoryQueue(capacity int) *MemoryQueue {
+	return &MemoryQueue{
+		state:    newQueueState(),
+		items:    make(map[uint64]*Data),
+		capacity: capacity,
+	}
+}
+
+func (queue *MemoryQueue) Enqueue(ctx context.Context, data *Data) error {
+	state := queue.state
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for !state.closed && len(state.pending)+len(state.inflight) >= queue.capacity {
+		notify := state.notify
+		state.mutex.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			state.mutex.Lock()
+			return ctx.Err()
+		}
+		state.mutex.Lock()
+	}
+
+	if state.closed {
+		return ErrQueueClosed
+	}
+
+	id := state.nextID
+	state.nextID++
+	queue.items[id] = data
+	state.pending = append(state.pending, id)
+	state.broadcast()
+	return nil
+}
+
+func (queue *MemoryQueue) Dequeue(ctx context.Context) (*QueueItem, error) {
+	id, err := queue.state.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queue.state.mutex.Lock()
+	defer queue.state.mutex.Unlock()
+	return &QueueItem{ID: id, Data: queue.items[id]}, nil
+}
+
+func (queue *MemoryQueue) Ack(item *QueueItem) error {
+	if !queue.state.settle(item.ID, false) {
+		return errors.New("Item is not in flight")
+	}
+
+	queue.state.mutex.Lock()
+	delete(queue.items, item.ID)
+	queue.state.mutex.Unlock()
+	return nil
+}
+
+func (queue *MemoryQueue) Nack(item *QueueItem) error {
+	if !queue.state.settle(item.ID, true) {
+		return errors.New("Item is not in flight")
+	}
+	return nil
+}
+
+func (queue *MemoryQueue) Len() int {
+	return queue.state.len()
+}
+
+func (queue *MemoryQueue) Close() error {
+	queue.state.mutex.Lock()
+	queue.state.closed = true
+	queue.state.broadcast()
+	queue.state.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,136 @@
+package base
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testQueue(t *testing.T, queue Queue) {
+	for _, record := range []string{"a", "b", "c"} {
+		if err := queue.Enqueue(context.Background(), NewData(nil, [][]byte{[]byte(record)})); err != nil {
+			t.Fatalf("Failed to enqueue, error=%s", err)
+		}
+	}
+
+	ctx := context.Background()
+	first, err := queue.Dequeue(ctx)
+	if err != nil || string(first.Data.RawData[0]) != "a" {
+		t.Fatalf("Expect a dequeued first, got %+v, error=%v", first, err)
+	}
+
+	second, _ := queue.Dequeue(ctx)
+	if err = queue.Nack(first); err != nil {
+		t.Errorf("Failed to nack, error=%s", err)
+	}
+
+	// The nacked item is redelivered before the others
+	again, _ := queue.Dequeue(ctx)
+	if again.ID != first.ID || string(again.Data.RawData[0]) != "a" {
+		t.Errorf("Expect a redelivered, got %s", again.Data.RawData[0])
+	}
+
+	queue.Ack(again)
+	queue.Ack(second)
+	if err = queue.Ack(second); err == nil {
+		t.Errorf("Expect error acknowledging twice")
+	}
+
+	if queue.Len() != 1 {
+		t.Errorf("Expect 1 item left, got %d", queue.Len())
+	}
+
+	third, _ := queue.Dequeue(ctx)
+	if string(third.Data.RawData[0]) != "c" {
+		t.Errorf("Expect c dequeued, got %s", third.Data.RawData[0])
+	}
+	queue.Ack(third)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err = queue.Dequeue(timeout); err != context.DeadlineExceeded {
+		t.Errorf("Expect deadline exceeded on empty queue, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		queue.Enqueue(context.Background(), NewData(nil, [][]byte{[]byte("d")}))
+	}()
+	if item, err := queue.Dequeue(ctx); err != nil || string(item.Data.RawData[0]) != "d" {
+		t.Errorf("Expect blocked Dequeue to get d, got error=%v", err)
+	}
+
+	queue.Close()
+	if _, err = queue.Dequeue(ctx); err != ErrQueueClosed {
+		t.Errorf("Expect ErrQueueClosed, got %v", err)
+	}
+
+	if err = queue.Enqueue(context.Background(), NewData(nil, nil)); err != ErrQueueClosed {
+		t.Errorf("Expect ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	testQueue(t, NewMemoryQueue(10))
+
+	queue := NewMemoryQueue(1)
+	queue.Enqueue(context.Background(), NewData(nil, nil))
+	enqueued := make(chan struct{})
+	go func() {
+		queue.Enqueue(context.Background(), NewData(nil, nil))
+		close(enqueued)
+	}()
+
+	select {
+	case <-enqueued:
+		t.Errorf("Expect Enqueue blocked on full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	item, _ := queue.Dequeue(context.Background())
+	queue.Ack(item)
+	select {
+	case <-enqueued:
+	case <-time.After(time.Second):
+		t.Errorf("Expect Enqueue unblocked by Ack")
+	}
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := NewDiskQueue(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open disk queue, error=%s", err)
+	}
+	testQueue(t, queue)
+
+	// The items not acknowledged are redelivered on reopen, d was dequeued
+	// by testQueue only
+	queue, _ = NewDiskQueue(dir, nil)
+	if item, err := queue.Dequeue(context.Background()); err != nil || string(item.Data.RawData[0]) != "d" {
+		t.Fatalf("Expect d redelivered, got error=%v", err)
+	} else {
+		queue.Ack(item)
+	}
+	queue.Enqueue(context.Background(), NewData(map[string]string{Source: "incident"}, [][]byte{[]byte("e")}))
+	queue.Enqueue(context.Background(), NewData(nil, [][]byte{[]byte("f")}))
+	queue.Dequeue(context.Background())
+	queue.Close()
+
+	queue, _ = NewDiskQueue(dir, nil)
+	if queue.Len() != 2 {
+		t.Fatalf("Expect 2 items redelivered, got %d", queue.Len())
+	}
+
+	item, err := queue.Dequeue(context.Background())
+	if err != nil || string(item.Data.RawData[0]) != "e" || item.Data.MetaInfo[Source] != "incident" {
+		t.Errorf("Expect e redelivered with its MetaInfo, got %+v, error=%v", item, err)
+	}
+}
@@ -0,0 +1,96 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RecordEncoder serializes records in k="v" or JSON format with an optional
+// stable field order, so that diff based consumers see the same layout run
+// to run
+type RecordEncoder struct {
+	sorted bool
+	fields []string // leading fields
+}
+
+// NewRecordEncoder
+// @config: SortFields "1" orders the fields by name, FieldOrder contains ","
+// separated fields which always come first in that order. Without both, the
+// k="v" field order is random as Go map iteration
+func NewRecordEncoder(config BaseConfig) *RecordEncoder {
+	encoder := &RecordEncoder{sorted: config[SortFields] == "1"}
+	for _, field := range strings.Split(config[FieldOrder], ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			encoder.fields = append(encoder.fields, field)
+		}
+	}
+	return encoder
+}
+
+// EncodeKV returns the record as k1="v1",k2="v2"
+func (encoder *RecordEncoder) EncodeKV(record map[string]interface{}) []byte {
+	var buf bytes.Buffer
+	for i, key := range encoder.keys(record, encoder.sorted) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `%s="%s"`, key, record[key])
+	}
+	return buf.Bytes()
+}
+
+// EncodeJSON returns the record as a JSON object. encoding/json always
+// sorts the keys of a map, FieldOrder pins the leading fields
+func (encoder *RecordEncoder) EncodeJSON(record map[string]interface{}) ([]byte, error) {
+	if len(encoder.fields) == 0 {
+		return json.Marshal(record)
+	}
+
+	// The remaining fields are sorted like encoding/json
+	keys := encoder.keys(record, true)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(record[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (encoder *RecordEncoder) keys(record map[string]interface{}, sorted bool) []string {
+	keys := make([]string, 0, len(record))
+	leading := make(map[string]bool, len(encoder.fields))
+	for _, field := range encoder.fields {
+		if _, ok := record[field]; ok && !leading[field] {
+			keys = append(keys, field)
+			leading[field] = true
+		}
+	}
+
+	rest := len(keys)
+	for key := range record {
+		if !leading[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	if sorted {
+		sort.Strings(keys[rest:])
+	}
+	return keys
+}
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestRecordEncoder(t *testing.T) {
+	record := map[string]interface{}{
+		"state":  "open",
+		"number": "INC1",
+		"sys_id": "abc",
+		"active": "true",
+	}
+
+	encoder := NewRecordEncoder(BaseConfig{SortFields: "1"})
+	for i := 0; i < 10; i++ {
+		if kv := string(encoder.EncodeKV(record)); kv != `active="true",number="INC1",state="open",sys_id="abc"` {
+			t.Errorf("Unexpected sorted k=v=%s", kv)
+			break
+		}
+	}
+
+	encoder = NewRecordEncoder(BaseConfig{SortFields: "1", FieldOrder: "sys_id, number, missing"})
+	if kv := string(encoder.EncodeKV(record)); kv != `sys_id="abc",number="INC1",active="true",state="open"` {
+		t.Errorf("Unexpected ordered k=v=%s", kv)
+	}
+
+	js, err := encoder.EncodeJSON(record)
+	if err != nil || string(js) != `{"sys_id":"abc","number":"INC1","active":"true","state":"open"}` {
+		t.Errorf("Unexpected ordered JSON=%s, error=%v", js, err)
+	}
+
+	js, _ = NewRecordEncoder(BaseConfig{}).EncodeJSON(record)
+	if string(js) != `{"active":"true","number":"INC1","state":"open","sys_id":"abc"}` {
+		t.Errorf("Unexpected JSON=%s", js)
+	}
+}
@@ -0,0 +1,272 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Topic of the instances whose requests cross the QuotaWarnRatio or the
+	// quota, or fall back below them, see QuotaWarning.Event
+	QuotaWarningTopic = "QuotaWarning"
+
+	// Priority of the tasks, which throttles them when the quota of their
+	// instance runs out, see RequestQuota.Allow
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+
+	QuotaOK       = "ok"
+	QuotaWarned   = "warning"
+	QuotaExceeded = "exceeded"
+
+	defaultQuotaWarnRatio = 0.8
+	minutesPerHour        = 60
+	minutesPerDay         = 24 * minutesPerHour
+)
+
+// QuotaLimits are the requests an instance accepts per rolling hour and day
+// before it locks the API user out, 0 if unlimited
+type QuotaLimits struct {
+	Hourly    int64
+	Daily     int64
+	WarnRatio float64 // of the limits, where the low priority tasks are throttled
+}
+
+// ParseQuotaLimits returns the "QuotaHourly" and "QuotaDaily" requests of
+// config, and "QuotaWarnRatio", 0.8 by default. Returns nil if neither of
+// the limits is set
+func ParseQuotaLimits(config BaseConfig) (*QuotaLimits, error) {
+	if config[QuotaHourly] == "" && config[QuotaDaily] == "" {
+		return nil, nil
+	}
+
+	limits := &QuotaLimits{WarnRatio: defaultQuotaWarnRatio}
+	for key, limit := range map[string]*int64{QuotaHourly: &limits.Hourly, QuotaDaily: &limits.Daily} {
+		if config[key] == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(config[key], 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s, expect positive requests", key, config[key]))
+		}
+		*limit = n
+	}
+
+	if config[QuotaWarnRatio] != "" {
+		ratio, err := strconv.ParseFloat(config[QuotaWarnRatio], 64)
+		if err != nil || ratio <= 0 || ratio >= 1 {
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s, expect a ratio between 0 and 1", QuotaWarnRatio, config[QuotaWarnRatio]))
+		}
+		limits.WarnRatio = ratio
+	}
+	return limits, nil
+}
+
+// GetPriority returns the Priority of the task of config, PriorityNormal by
+// default
+func GetPriority(config BaseConfig) (string, error) {
+	switch config[Priority] {
+	case "":
+		return PriorityNormal, nil
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return config[Priority], nil
+	}
+	return "", errors.New(fmt.Sprintf("Invalid %s=%s, expect %s, %s or %s", Priority, config[Priority], PriorityHigh, PriorityNormal, PriorityLow))
+}
+
+// QuotaWarning is an instance whose requests crossed the QuotaWarnRatio or
+// the quota, or fell back below them
+type QuotaWarning struct {
+	ServerURL      string
+	Level          string // QuotaOK, QuotaWarned or QuotaExceeded
+	HourlyRequests int64
+	DailyRequests  int64
+	Limits         QuotaLimits
+}
+
+// Event returns the warning as a QuotaWarningTopic event
+func (warning *QuotaWarning) Event() BaseConfig {
+	return BaseConfig{
+		ServerURL:        warning.ServerURL,
+		"Level":          warning.Level,
+		"HourlyRequests": strconv.FormatInt(warning.HourlyRequests, 10),
+		"DailyRequests":  strconv.FormatInt(warning.DailyRequests, 10),
+		QuotaHourly:      strconv.FormatInt(warning.Limits.Hourly, 10),
+		QuotaDaily:       strconv.FormatInt(warning.Limits.Daily, 10),
+	}
+}
+
+// quotaUsage counts the requests of an instance per minute of the last day
+type quotaUsage struct {
+	limits  *QuotaLimits // nil if unlimited
+	counts  [minutesPerDay]int64
+	minutes [minutesPerDay]int64 // the minute each count is of
+	level   string
+}
+
+func (usage *quotaUsage) add(minute int64) {
+	index := minute % minutesPerDay
+	if usage.minutes[index] != minute {
+		usage.minutes[index] = minute
+		usage.counts[index] = 0
+	}
+	usage.counts[index]++
+}
+
+// requests returns the requests of the window minutes till minute
+func (usage *quotaUsage) requests(minute int64, window int64) int64 {
+	var total int64
+	for m := minute - window + 1; m <= minute; m++ {
+		if index := m % minutesPerDay; usage.minutes[index] == m {
+			total += usage.counts[index]
+		}
+	}
+	return total
+}
+
+// RequestQuota tracks the requests to the instances, ServerURL indexed, per
+// rolling hour and day against their QuotaLimits, so that the collection
+// doesn't get the API user locked out. Past the QuotaWarnRatio of a limit the
+// low priority tasks are throttled, past the limit the normal ones too, the
+// high priority ones never are. The requests are those of the readers of the
+// process sharing the RequestQuota, the limits shall leave room for the
+// other clients of the instance
+type RequestQuota struct {
+	instances map[string]*quotaUsage
+	onWarning func(warning *QuotaWarning)
+	mutex     sync.Mutex
+}
+
+func NewRequestQuota() *RequestQuota {
+	return &RequestQuota{
+		instances: make(map[string]*quotaUsage),
+	}
+}
+
+// OnWarning calls handler when the level of an instance changes, it shall be
+// called before the quota is used
+func (quota *RequestQuota) OnWarning(handler func(warning *QuotaWarning)) {
+	quota.onWarning = handler
+}
+
+// SetLimits sets the limits of the instance of serverURL, the tasks of an
+// instance shall agree on them, the last ones set are in effect
+func (quota *RequestQuota) SetLimits(serverURL string, limits *QuotaLimits) {
+	quota.mutex.Lock()
+	quota.usageOf(serverURL).limits = limits
+	quota.mutex.Unlock()
+}
+
+// Record counts a request to the instance of serverURL at now
+func (quota *RequestQuota) Record(serverURL string, now time.Time) {
+	quota.mutex.Lock()
+	usage := quota.usageOf(serverURL)
+	usage.add(now.Unix() / 60)
+	warning := quota.check(serverURL, usage, now)
+	quota.mutex.Unlock()
+
+	quota.notify(warning)
+}
+
+// Allow returns true if a task of priority may request the instance of
+// serverURL at now
+func (quota *RequestQuota) Allow(serverURL, priority string, now time.Time) bool {
+	quota.mutex.Lock()
+	usage := quota.usageOf(serverURL)
+	// The windows roll without requests as well
+	warning := quota.check(serverURL, usage, now)
+	level := usage.level
+	quota.mutex.Unlock()
+
+	quota.notify(warning)
+	switch level {
+	case QuotaExceeded:
+		return priority == PriorityHigh
+	case QuotaWarned:
+		return priority != PriorityLow
+	}
+	return true
+}
+
+// Level returns the level of the instance of serverURL, QuotaOK if it is
+// not tracked
+func (quota *RequestQuota) Level(serverURL string) string {
+	quota.mutex.Lock()
+	defer quota.mutex.Unlock()
+
+	if usage, ok := quota.instances[serverURL]; ok {
+		return usage.level
+	}
+	return QuotaOK
+}
+
+// usageOf shall be called with the mutex held
+func (quota *RequestQuota) usageOf(serverURL string) *quotaUsage {
+	usage, ok := quota.instances[serverURL]
+	if !ok {
+		usage = &quotaUsage{level: QuotaOK}
+		quota.instances[serverURL] = usage
+	}
+	return usage
+}
+
+// check updates the level of usage, returns the warning if it changed. It
+// shall be called with the mutex held
+func (quota *RequestQuota) check(serverURL string, usage *quotaUsage, now time.Time) *QuotaWarning {
+	if usage.limits == nil {
+		return nil
+	}
+
+	minute := now.Unix() / 60
+	hourly, daily := usage.requests(minute, minutesPerHour), usage.requests(minute, minutesPerDay)
+	ratio := 0.0
+	if usage.limits.Hourly > 0 {
+		ratio = float64(hourly) / float64(usage.limits.Hourly)
+	}
+	if usage.limits.Daily > 0 && float64(daily)/float64(usage.limits.Daily) > ratio {
+		ratio = float64(daily) / float64(usage.limits.Daily)
+	}
+
+	level := QuotaOK
+	if ratio >= 1 {
+		level = QuotaExceeded
+	} else if ratio >= usage.limits.WarnRatio {
+		level = QuotaWarned
+	}
+
+	if level == usage.level {
+		return nil
+	}
+	usage.level = level
+
+	switch level {
+	case QuotaOK:
+		glog.Infof("Requests to %s are back below the quota, hourly=%d, daily=%d", serverURL, hourly, daily)
+	case QuotaWarned:
+		glog.Warningf("Alert: requests to %s reached %d%% of the quota, throttle the low priority tasks, hourly=%d/%d, daily=%d/%d",
+			serverURL, int(ratio*100), hourly, usage.limits.Hourly, daily, usage.limits.Daily)
+	case QuotaExceeded:
+		glog.Errorf("Alert: requests to %s exceeded the quota, throttle all but the high priority tasks, hourly=%d/%d, daily=%d/%d",
+			serverURL, hourly, usage.limits.Hourly, daily, usage.limits.Daily)
+	}
+
+	return &QuotaWarning{
+		ServerURL:      serverURL,
+		Level:          level,
+		HourlyRequests: hourly,
+		DailyRequests:  daily,
+		Limits:         *usage.limits,
+	}
+}
+
+func (quota *RequestQuota) notify(warning *QuotaWarning) {
+	if warning != nil && quota.onWarning != nil {
+		quota.onWarning(warning)
+	}
+}
@@ -0,0 +1,74 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestQuota(t *testing.T) {
+	limits, err := ParseQuotaLimits(BaseConfig{QuotaHourly: "10", QuotaDaily: "12"})
+	if err != nil || limits.Hourly != 10 || limits.Daily != 12 || limits.WarnRatio != 0.8 {
+		t.Fatalf("Expect the limits with the default warn ratio, got %+v, error=%v", limits, err)
+	}
+
+	var warnings []*QuotaWarning
+	quota := NewRequestQuota()
+	quota.OnWarning(func(warning *QuotaWarning) {
+		warnings = append(warnings, warning)
+	})
+
+	const instance = "https://acme.service-now.com"
+	quota.SetLimits(instance, limits)
+	now := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		quota.Record(instance, now)
+	}
+
+	if quota.Level(instance) != QuotaWarned || quota.Allow(instance, PriorityLow, now) || !quota.Allow(instance, PriorityNormal, now) {
+		t.Errorf("Expect the low priority tasks throttled at the warn ratio, got level=%s", quota.Level(instance))
+	}
+
+	for i := 0; i < 2; i++ {
+		quota.Record(instance, now)
+	}
+
+	if quota.Allow(instance, PriorityNormal, now) || !quota.Allow(instance, PriorityHigh, now) {
+		t.Errorf("Expect only the high priority tasks allowed past the quota, got level=%s", quota.Level(instance))
+	}
+
+	// The hour rolls, the daily quota is still at its warn ratio
+	later := now.Add(time.Hour + time.Minute)
+	if !quota.Allow(instance, PriorityNormal, later) || quota.Allow(instance, PriorityLow, later) {
+		t.Errorf("Expect the hourly quota rolled, got level=%s", quota.Level(instance))
+	}
+
+	// And the day too
+	if !quota.Allow(instance, PriorityLow, now.Add(24*time.Hour)) {
+		t.Errorf("Expect the daily quota rolled, got level=%s", quota.Level(instance))
+	}
+
+	if len(warnings) != 4 || warnings[0].Level != QuotaWarned || warnings[1].Level != QuotaExceeded ||
+		warnings[2].Level != QuotaWarned || warnings[3].Level != QuotaOK || warnings[1].HourlyRequests != 10 {
+		t.Errorf("Expect the level changes warned, got %+v", warnings)
+	}
+
+	// The instances without limits are never throttled
+	quota.Record("https://other.service-now.com", now)
+	if !quota.Allow("https://other.service-now.com", PriorityLow, now) {
+		t.Errorf("Expect the instance without limits allowed")
+	}
+
+	for _, bad := range []BaseConfig{
+		{QuotaHourly: "-1"},
+		{QuotaDaily: "many"},
+		{QuotaHourly: "10", QuotaWarnRatio: "1.5"},
+	} {
+		if _, err := ParseQuotaLimits(bad); err == nil {
+			t.Errorf("Expect the limits %v rejected", bad)
+		}
+	}
+
+	if _, err := GetPriority(BaseConfig{Priority: "urgent"}); err == nil {
+		t.Errorf("Expect an unknown priority rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ResumePolicy values
+	// Resume from the checkpoint, collecting the whole backlog
+	ResumeFromCheckpoint = "checkpoint"
+	// Skip the backlog, resume from the time the job starts
+	ResumeFromNow = "now"
+	// Skip the records before ResumeFrom
+	ResumeFromTimestamp = "timestamp"
+
+	resumeTimeTemplate = "2006-01-02 15:04:05"
+)
+
+// TimeGap is the range of record times a reader skipped on start by its
+// ResumePolicy. From is the checkpointed time, To the time resumed from.
+// The gaps suspected while collecting have no Policy but a Reason
+type TimeGap struct {
+	Key    string
+	From   string
+	To     string
+	Policy string
+	Reason string
+}
+
+// ResumeBound returns the lower bound of the record times to be collected on
+// start, the zero time if the reader resumes from its checkpoint.
+// "now" is not persisted as a bound, each start skips the backlog again, so
+// ResumePolicy shall be reverted once the backlog has been skipped
+// @config: ResumePolicy, "checkpoint" by default. ResumeFrom in
+// "2006-01-02 15:04:05" UTC format is required by "timestamp"
+// @now: the current time
+func ResumeBound(config BaseConfig, now time.Time) (time.Time, error) {
+	switch config[ResumePolicy] {
+	case "", ResumeFromCheckpoint:
+		return time.Time{}, nil
+	case ResumeFromNow:
+		return now.UTC().Truncate(time.Second), nil
+	case ResumeFromTimestamp:
+		bound, err := time.Parse(resumeTimeTemplate, config[ResumeFrom])
+		if err != nil {
+			return time.Time{}, errors.New(fmt.Sprintf("Invalid %s=%s, expect format %s, error=%s", ResumeFrom, config[ResumeFrom], resumeTimeTemplate, err))
+		}
+		return bound, nil
+	default:
+		return time.Time{}, errors.New(fmt.Sprintf("Unsupported %s=%s, expect %s, %s or %s", ResumePolicy,
+			config[ResumePolicy], ResumeFromCheckpoint, ResumeFromNow, ResumeFromTimestamp))
+	}
+}
+
+// Event returns the gap as a DataGapTopic event
+func (gap *TimeGap) Event() BaseConfig {
+	event := BaseConfig{
+		Key:          gap.Key,
+		"From":       gap.From,
+		"To":         gap.To,
+		ResumePolicy: gap.Policy,
+	}
+	if gap.Reason != "" {
+		event["Reason"] = gap.Reason
+	}
+	return event
+}
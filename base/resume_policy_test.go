@@ -0,0 +1,30 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResumeBound(t *testing.T) {
+	now := time.Date(2015, 6, 1, 8, 0, 0, 500, time.UTC)
+	if bound, err := ResumeBound(BaseConfig{}, now); err != nil || !bound.IsZero() {
+		t.Errorf("Expect no bound by default, got %s, error=%v", bound, err)
+	}
+
+	if bound, err := ResumeBound(BaseConfig{ResumePolicy: ResumeFromNow}, now); err != nil || !bound.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Expect bound=%s, got %s, error=%v", now, bound, err)
+	}
+
+	bound, err := ResumeBound(BaseConfig{ResumePolicy: ResumeFromTimestamp, ResumeFrom: "2015-05-01 00:00:00"}, now)
+	if err != nil || !bound.Equal(time.Date(2015, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expect bound=2015-05-01 00:00:00, got %s, error=%v", bound, err)
+	}
+
+	if _, err = ResumeBound(BaseConfig{ResumePolicy: ResumeFromTimestamp}, now); err == nil {
+		t.Errorf("Expect error without %s", ResumeFrom)
+	}
+
+	if _, err = ResumeBound(BaseConfig{ResumePolicy: "latest"}, now); err == nil {
+		t.Errorf("Expect error for unsupported policy")
+	}
+}
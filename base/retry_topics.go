@@ -0,0 +1,83 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retryTopicInfix = ".retry."
+)
+
+// RetryDelay is one stage of the retry topics, Name is the suffix of the
+// retry topic, for e.g. "5m" of "incidents.retry.5m"
+type RetryDelay struct {
+	Name  string
+	Delay time.Duration
+}
+
+// ParseRetryDelays parses KafkaRetryDelays in "5m,1h" format, the stages
+// are tried in order
+func ParseRetryDelays(delays string) ([]RetryDelay, error) {
+	var res []RetryDelay
+	for _, name := range strings.Split(delays, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		delay, err := time.ParseDuration(name)
+		if err != nil || delay <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid retry delay=%s", name))
+		}
+		res = append(res, RetryDelay{Name: name, Delay: delay})
+	}
+	return res, nil
+}
+
+// RetryTopicOf returns the retry topic of topic for the stage delay
+func RetryTopicOf(topic string, delay RetryDelay) string {
+	return topic + retryTopicInfix + delay.Name
+}
+
+// IsRetryTopic returns true if topic is the retry topic of one of delays
+func IsRetryTopic(topic string, delays []RetryDelay) bool {
+	for _, delay := range delays {
+		if strings.HasSuffix(topic, retryTopicInfix+delay.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRetryData returns a copy of data to be written to the retry topic of
+// the next stage, nil if all of the stages have been tried. The retry
+// MetaInfo, RetryOrigin, RetryAttempt and RetryAt in unix seconds, goes with
+// the envelope since the messages have no headers
+// @topic: the topic data failed to be written to
+func NewRetryData(data *Data, topic string, delays []RetryDelay, now time.Time) (*Data, string) {
+	attempt, _ := strconv.Atoi(data.MetaInfo[RetryAttempt])
+	if attempt >= len(delays) {
+		return nil, ""
+	}
+
+	origin := data.MetaInfo[RetryOrigin]
+	if origin == "" {
+		origin = topic
+	}
+
+	metaInfo := make(map[string]string, len(data.MetaInfo)+3)
+	for k, v := range data.MetaInfo {
+		metaInfo[k] = v
+	}
+	metaInfo[RetryOrigin] = origin
+	metaInfo[RetryAttempt] = strconv.Itoa(attempt + 1)
+	metaInfo[RetryAt] = strconv.FormatInt(now.Add(delays[attempt].Delay).Unix(), 10)
+
+	retry := NewData(metaInfo, data.RawData)
+	retry.Records = data.Records
+	return retry, RetryTopicOf(origin, delays[attempt])
+}
@@ -0,0 +1,43 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryTopics(t *testing.T) {
+	delays, err := ParseRetryDelays("5m, 1h")
+	if err != nil || len(delays) != 2 || delays[1].Delay != time.Hour {
+		t.Fatalf("Failed to parse retry delays, got=%v, error=%v", delays, err)
+	}
+
+	if _, err := ParseRetryDelays("5m,soon"); err == nil {
+		t.Errorf("Expect error for invalid retry delay")
+	}
+
+	if !IsRetryTopic("incidents.retry.1h", delays) || IsRetryTopic("incidents", delays) {
+		t.Errorf("Expect only incidents.retry.1h recognized as retry topic")
+	}
+
+	now := time.Unix(1000, 0)
+	data := NewData(map[string]string{Host: "collector1"}, [][]byte{[]byte("k=v")})
+	retry, topic := NewRetryData(data, "incidents", delays, now)
+	if topic != "incidents.retry.5m" || retry.MetaInfo[RetryOrigin] != "incidents" ||
+		retry.MetaInfo[RetryAttempt] != "1" || retry.MetaInfo[RetryAt] != "1300" {
+		t.Errorf("Expect first retry stage, got topic=%s, MetaInfo=%v", topic, retry.MetaInfo)
+	}
+
+	if data.MetaInfo[RetryAttempt] != "" || retry.MetaInfo[Host] != "collector1" {
+		t.Errorf("Expect MetaInfo copied, got %v and %v", data.MetaInfo, retry.MetaInfo)
+	}
+
+	// Failed again after redelivered to the original topic
+	retry, topic = NewRetryData(retry, "incidents", delays, now)
+	if topic != "incidents.retry.1h" || retry.MetaInfo[RetryAt] != "4600" {
+		t.Errorf("Expect second retry stage, got topic=%s, MetaInfo=%v", topic, retry.MetaInfo)
+	}
+
+	if retry, _ = NewRetryData(retry, "incidents", delays, now); retry != nil {
+		t.Errorf("Expect nil after all of the stages, got %v", retry)
+	}
+}
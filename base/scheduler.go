@@ -5,7 +5,6 @@ import (
 	"github.com/petar/GoLLRB/llrb"
 	"math/rand"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
@@ -13,8 +12,9 @@ type Scheduler struct {
 	jobs       *llrb.LLRB
 	wakeupChan chan int32
 	doneChan   chan bool
-	started    int32
+	lifecycle  Lifecycle
 	maxDelay   int // nano second
+	clock      Clock
 	lockGuard  sync.Mutex
 }
 
@@ -28,12 +28,12 @@ func NewScheduler() *Scheduler {
 		jobs:       llrb.New(),
 		wakeupChan: make(chan int32, 100),
 		doneChan:   make(chan bool, 3),
+		clock:      SystemClock,
 	}
 }
 
 func (sched *Scheduler) Start() {
-	if !atomic.CompareAndSwapInt32(&sched.started, 0, 1) {
-		glog.Infof("Scheduler already started.")
+	if sched.lifecycle.Start("Scheduler") != nil {
 		return
 	}
 	go sched.doJobs()
@@ -41,8 +41,7 @@ func (sched *Scheduler) Start() {
 }
 
 func (sched *Scheduler) Stop() {
-	if !atomic.CompareAndSwapInt32(&sched.started, 1, 0) {
-		glog.Infof("Scheduler already stopped.")
+	if sched.lifecycle.Stop("Scheduler") != nil {
 		return
 	}
 	sched.wakeupChan <- teardownNum
@@ -55,11 +54,15 @@ func (sched *Scheduler) Stop() {
 	glog.Infof("Scheduler stopped...")
 }
 
+func (sched *Scheduler) Status() string {
+	return sched.lifecycle.Status()
+}
+
 func (sched *Scheduler) AddJobs(jobs []Job) {
 	sched.lockGuard.Lock()
 	defer sched.lockGuard.Unlock()
 
-	now := time.Now().UnixNano()
+	now := sched.clock.Now().UnixNano()
 	var r *rand.Rand
 	var d int
 	if sched.maxDelay > 0 {
@@ -106,6 +109,11 @@ func (sched *Scheduler) SetMaxStartDelay(d int) {
 	sched.maxDelay = d
 }
 
+// SetClock replaces the SystemClock, shall be called before Start
+func (sched *Scheduler) SetClock(clock Clock) {
+	sched.clock = clock
+}
+
 func (sched *Scheduler) wakeUp() {
 	sched.wakeupChan <- wakeupNum
 }
@@ -116,7 +124,7 @@ L:
 		sleepTime, jobs := sched.getReadyJobs()
 		sched.executeJobs(jobs)
 		select {
-		case <-time.After(sleepTime):
+		case <-sched.clock.After(sleepTime):
 			continue
 		case v := <-sched.wakeupChan:
 			if v == teardownNum {
@@ -135,7 +143,7 @@ func (sched *Scheduler) getReadyJobs() (sleep_time time.Duration, jobs []Job) {
 	sched.lockGuard.Lock()
 	defer sched.lockGuard.Unlock()
 
-	now := time.Now().UnixNano()
+	now := sched.clock.Now().UnixNano()
 	for sched.jobs.Len() > 0 {
 		job = sched.jobs.Min().(Job)
 		if job.ExpirationTime() < now {
@@ -162,6 +170,7 @@ func (sched *Scheduler) getReadyJobs() (sleep_time time.Duration, jobs []Job) {
 }
 
 func (sched *Scheduler) executeJobs(jobs []Job) {
+	// BaseJob.Callback recovers from the panics of the jobs
 	for _, job := range jobs {
 		job.Callback()
 	}
@@ -0,0 +1,40 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// Prefixes of the config values which refer to a secret provisioned by
+	// the secrets backend instead of carrying it
+	SecretFilePrefix = "file:"
+	SecretEnvPrefix  = "env:"
+)
+
+// ResolveSecret returns the secret value refers to. "file:<path>" is the
+// content of the file without the trailing new line, "env:<name>" is the
+// environment variable, the other values are returned as they are
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretFilePrefix):
+		path := strings.TrimPrefix(value, SecretFilePrefix)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Failed to read secret file=%s, error=%s", path, err))
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.New(fmt.Sprintf("Secret environment variable=%s is not set", name))
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
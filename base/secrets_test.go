@@ -0,0 +1,39 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "api_key")
+	ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600)
+	os.Setenv("DESCARTES_TEST_SECRET", "from-env")
+	defer os.Unsetenv("DESCARTES_TEST_SECRET")
+
+	cases := map[string]string{
+		"plain":                     "plain",
+		"file:" + secretFile:        "s3cret",
+		"env:DESCARTES_TEST_SECRET": "from-env",
+	}
+	for value, expected := range cases {
+		secret, err := ResolveSecret(value)
+		if err != nil || secret != expected {
+			t.Errorf("Expect %s resolved to %s, got=%s, error=%v", value, expected, secret, err)
+		}
+	}
+
+	for _, value := range []string{"file:" + filepath.Join(dir, "missing"), "env:DESCARTES_TEST_MISSING"} {
+		if _, err := ResolveSecret(value); err == nil {
+			t.Errorf("Expect %s failed to resolve", value)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package base
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SequenceGap        = "gap"
+	SequenceOutOfOrder = "out_of_order"
+)
+
+// SequencingDataWriter stamps monotonic per-task sequence numbers into the
+// MetaInfo of each outgoing batch. SeqEpoch identifies the writer instance,
+// BatchSeq numbers the batches and RecordSeq is the sequence number of the
+// first record in the batch, record i of the batch has RecordSeq+i
+type SequencingDataWriter struct {
+	DataWriter
+	taskKey   string
+	epoch     string
+	batchSeq  int64
+	recordSeq int64
+	lockGuard sync.Mutex
+}
+
+func NewSequencingDataWriter(writer DataWriter, taskKey string) *SequencingDataWriter {
+	return &SequencingDataWriter{
+		DataWriter: writer,
+		taskKey:    taskKey,
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+}
+
+func (writer *SequencingDataWriter) WriteData(data *Data) error {
+	return writer.DataWriter.WriteData(writer.stamp(data))
+}
+
+func (writer *SequencingDataWriter) WriteDataSync(data *Data) error {
+	return writer.DataWriter.WriteDataSync(writer.stamp(data))
+}
+
+func (writer *SequencingDataWriter) WriteDataAsync(data *Data) error {
+	return writer.DataWriter.WriteDataAsync(writer.stamp(data))
+}
+
+func (writer *SequencingDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	return writer.DataWriter.WriteDataContext(ctx, writer.stamp(data))
+}
+
+// stamp returns a copy of data with the sequence numbers in its MetaInfo,
+// the MetaInfo of the caller is not modified since it may be reused
+func (writer *SequencingDataWriter) stamp(data *Data) *Data {
+	metaInfo := make(map[string]string, len(data.MetaInfo)+4)
+	for k, v := range data.MetaInfo {
+		metaInfo[k] = v
+	}
+
+	writer.lockGuard.Lock()
+	writer.batchSeq++
+	metaInfo[BatchSeq] = strconv.FormatInt(writer.batchSeq, 10)
+	metaInfo[RecordSeq] = strconv.FormatInt(writer.recordSeq+1, 10)
+	writer.recordSeq += int64(data.Len())
+	writer.lockGuard.Unlock()
+
+	metaInfo[SeqEpoch] = writer.epoch
+	metaInfo[TaskConfigKey] = writer.taskKey
+	return &Data{
+		MetaInfo: metaInfo,
+		RawData:  data.RawData,
+		Records:  data.Records,
+	}
+}
+
+type SequenceAnomaly struct {
+	TaskKey  string
+	Epoch    string
+	Kind     string
+	Expected int64 // expected first record sequence number
+	Got      int64 // actual first record sequence number
+}
+
+type sequenceState struct {
+	epoch      string
+	nextRecord int64
+}
+
+// SequenceVerifier audits the sequence numbers stamped by
+// SequencingDataWriter and reports gaps (loss) and out of order records
+// (reordering or duplicates introduced by retries)
+type SequenceVerifier struct {
+	states    map[string]*sequenceState // task key indexed
+	lockGuard sync.Mutex
+}
+
+func NewSequenceVerifier() *SequenceVerifier {
+	return &SequenceVerifier{
+		states: make(map[string]*sequenceState),
+	}
+}
+
+// Verify checks the batch, data without sequence numbers is ignored
+func (verifier *SequenceVerifier) Verify(data *Data) []SequenceAnomaly {
+	taskKey, epoch := data.MetaInfo[TaskConfigKey], data.MetaInfo[SeqEpoch]
+	first, err := strconv.ParseInt(data.MetaInfo[RecordSeq], 10, 64)
+	if err != nil || epoch == "" {
+		return nil
+	}
+
+	verifier.lockGuard.Lock()
+	defer verifier.lockGuard.Unlock()
+
+	state, ok := verifier.states[taskKey]
+	if !ok || state.epoch != epoch {
+		// A new writer instance restarts the sequence
+		state = &sequenceState{epoch: epoch, nextRecord: first}
+		verifier.states[taskKey] = state
+	}
+
+	var anomalies []SequenceAnomaly
+	if first != state.nextRecord {
+		kind := SequenceGap
+		if first < state.nextRecord {
+			kind = SequenceOutOfOrder
+		}
+		anomalies = append(anomalies, SequenceAnomaly{
+			TaskKey:  taskKey,
+			Epoch:    epoch,
+			Kind:     kind,
+			Expected: state.nextRecord,
+			Got:      first,
+		})
+	}
+
+	if next := first + int64(len(data.RawData)); next > state.nextRecord {
+		state.nextRecord = next
+	}
+	return anomalies
+}
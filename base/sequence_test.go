@@ -0,0 +1,52 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	writer := &recordingDataWriter{}
+	seqWriter := NewSequencingDataWriter(writer, "snow_incident")
+	verifier := NewSequenceVerifier()
+
+	metaInfo := map[string]string{Metric: "incident"}
+	for i := 0; i < 4; i++ {
+		seqWriter.WriteData(NewData(metaInfo, [][]byte{[]byte("a"), []byte("b")}))
+	}
+
+	if len(metaInfo) != 1 {
+		t.Errorf("MetaInfo of the caller should not be modified, got=%s", metaInfo)
+	}
+
+	if len(writer.data) != 4 || writer.data[3].MetaInfo[RecordSeq] != "7" || writer.data[3].MetaInfo[BatchSeq] != "4" {
+		t.Errorf("Unexpected sequence numbers in data=%+v", writer.data)
+	}
+
+	for _, i := range []int{0, 1, 3, 2} {
+		anomalies := verifier.Verify(writer.data[i])
+		switch i {
+		case 3:
+			if len(anomalies) != 1 || anomalies[0].Kind != SequenceGap || anomalies[0].Expected != 5 {
+				t.Errorf("Expect a gap, got=%+v", anomalies)
+			}
+		case 2:
+			if len(anomalies) != 1 || anomalies[0].Kind != SequenceOutOfOrder {
+				t.Errorf("Expect out of order, got=%+v", anomalies)
+			}
+		default:
+			if len(anomalies) != 0 {
+				t.Errorf("Expect no anomaly, got=%+v", anomalies)
+			}
+		}
+	}
+}
+
+type recordingDataWriter struct {
+	StdoutDataWriter
+	data []*Data
+}
+
+func (writer *recordingDataWriter) WriteData(data *Data) error {
+	writer.data = append(writer.data, data)
+	return nil
+}
@@ -0,0 +1,182 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Topic of the sinks which stay saturated longer than
+	// SinkSaturationTime, see SinkSaturation.Event
+	SinkSaturationTopic = "SinkSaturation"
+
+	// A sink is saturated while its buffered data waits this long
+	saturatedBufferAge        = 30 * time.Second
+	defaultSinkSaturationTime = time.Minute
+	defaultFlushTimeout       = 10 * time.Second
+	flushPollInterval         = 50 * time.Millisecond
+)
+
+// SinkStats is the buffering of a sink. OldestAge is the number of seconds
+// the oldest buffered data has been waiting, Dropped is the number of data
+// which failed to be delivered by the sink and were given up
+type SinkStats struct {
+	QueueDepth int
+	Capacity   int // 0 if the buffer is not bounded
+	OldestAge  float64
+	Dropped    int64
+}
+
+// Saturated returns true when the buffer of the sink is at least 90% full,
+// or the oldest buffered data has been waiting 30 seconds or longer
+func (stats SinkStats) Saturated() bool {
+	if stats.Capacity > 0 && stats.QueueDepth*10 >= stats.Capacity*9 {
+		return true
+	}
+	return stats.OldestAge >= saturatedBufferAge.Seconds()
+}
+
+// GetSinkSaturationTime returns SinkSaturationTime in seconds in the config,
+// default to 1 minute
+func GetSinkSaturationTime(config BaseConfig) time.Duration {
+	seconds, err := strconv.Atoi(config[SinkSaturationTime])
+	if err != nil || seconds <= 0 {
+		return defaultSinkSaturationTime
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// BufferedDataWriter is implemented by the DataWriters which track the
+// data they buffer before it is delivered
+type BufferedDataWriter interface {
+	SinkStats() SinkStats
+}
+
+// SinkStatsOf returns the stats of writer or the writer it wraps, false if
+// none of them tracks its buffer
+func SinkStatsOf(writer DataWriter) (SinkStats, bool) {
+	for writer != nil {
+		if buffered, ok := writer.(BufferedDataWriter); ok {
+			return buffered.SinkStats(), true
+		}
+		writer = unwrapDataWriter(writer)
+	}
+	return SinkStats{}, false
+}
+
+// FlushDataWriter waits until the data buffered by writer, or the writer it
+// wraps, are delivered or ctx is done. The writers which don't track their
+// buffer are not waited for
+func FlushDataWriter(ctx context.Context, writer DataWriter) error {
+	for {
+		stats, ok := SinkStatsOf(writer)
+		if !ok || stats.QueueDepth == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New(fmt.Sprintf("%d data not delivered, error=%s", stats.QueueDepth, ctx.Err()))
+		case <-time.After(flushPollInterval):
+		}
+	}
+}
+
+// GetFlushTimeout returns FlushTimeout in seconds in the config, default to
+// 10 seconds
+func GetFlushTimeout(config BaseConfig) time.Duration {
+	seconds, err := strconv.Atoi(config[FlushTimeout])
+	if err != nil || seconds <= 0 {
+		return defaultFlushTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// BufferTracker tracks the data buffered by a sink in the order they are
+// buffered. The data are supposed to be released in the same order, the age
+// of the oldest buffered data is approximate otherwise
+type BufferTracker struct {
+	capacity int
+	buffered []time.Time
+	dropped  int64
+	mutex    sync.Mutex
+}
+
+// @capacity: max number of data buffered, 0 if it is not bounded
+func NewBufferTracker(capacity int) *BufferTracker {
+	return &BufferTracker{
+		capacity: capacity,
+	}
+}
+
+// Buffered tracks a data buffered now
+func (tracker *BufferTracker) Buffered() {
+	tracker.mutex.Lock()
+	tracker.buffered = append(tracker.buffered, time.Now())
+	tracker.mutex.Unlock()
+}
+
+// Unbuffered untracks the data tracked last which failed to be buffered
+func (tracker *BufferTracker) Unbuffered() {
+	tracker.mutex.Lock()
+	if len(tracker.buffered) > 0 {
+		tracker.buffered = tracker.buffered[:len(tracker.buffered)-1]
+	}
+	tracker.mutex.Unlock()
+}
+
+// Released untracks the oldest buffered data, delivered or not
+func (tracker *BufferTracker) Released() {
+	tracker.mutex.Lock()
+	if len(tracker.buffered) > 0 {
+		tracker.buffered = tracker.buffered[1:]
+	}
+	tracker.mutex.Unlock()
+}
+
+// Dropped counts a released data which failed to be delivered
+func (tracker *BufferTracker) Dropped() {
+	tracker.mutex.Lock()
+	tracker.dropped++
+	tracker.mutex.Unlock()
+}
+
+// Stats returns the stats of the buffer at now
+func (tracker *BufferTracker) Stats(now time.Time) SinkStats {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	stats := SinkStats{
+		QueueDepth: len(tracker.buffered),
+		Capacity:   tracker.capacity,
+		Dropped:    tracker.dropped,
+	}
+	if len(tracker.buffered) > 0 && now.After(tracker.buffered[0]) {
+		stats.OldestAge = now.Sub(tracker.buffered[0]).Seconds()
+	}
+	return stats
+}
+
+// SinkSaturation is a sink which has been saturated since Since, Stats is
+// its buffering when the saturation is reported
+type SinkSaturation struct {
+	Key   string
+	Since time.Time
+	Stats SinkStats
+}
+
+// Event returns the saturation as a SinkSaturationTopic event
+func (saturation *SinkSaturation) Event() BaseConfig {
+	return BaseConfig{
+		Key:          saturation.Key,
+		"Since":      saturation.Since.UTC().Format(time.RFC3339),
+		"QueueDepth": strconv.Itoa(saturation.Stats.QueueDepth),
+		"Capacity":   strconv.Itoa(saturation.Stats.Capacity),
+		"OldestAge":  strconv.FormatFloat(saturation.Stats.OldestAge, 'f', 1, 64),
+		"Dropped":    strconv.FormatInt(saturation.Stats.Dropped, 10),
+	}
+}
@@ -0,0 +1,100 @@
+package base
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBufferTracker(t *testing.T) {
+	tracker := NewBufferTracker(10)
+	for i := 0; i < 3; i++ {
+		tracker.Buffered()
+	}
+	tracker.Unbuffered()
+
+	stats := tracker.Stats(time.Now().Add(time.Minute))
+	if stats.QueueDepth != 2 || stats.Capacity != 10 || stats.OldestAge < 59 {
+		t.Errorf("Expect 2 data buffered for a minute, got=%+v", stats)
+	}
+
+	if !stats.Saturated() {
+		t.Errorf("Expect the sink saturated by the age of its data, got=%+v", stats)
+	}
+
+	tracker.Released()
+	tracker.Released()
+	tracker.Dropped()
+	tracker.Released()
+	stats = tracker.Stats(time.Now())
+	if stats.QueueDepth != 0 || stats.OldestAge != 0 || stats.Dropped != 1 || stats.Saturated() {
+		t.Errorf("Expect the buffer drained with 1 drop, got=%+v", stats)
+	}
+}
+
+func TestSinkStatsSaturated(t *testing.T) {
+	cases := map[SinkStats]bool{
+		{QueueDepth: 900, Capacity: 1000}:          true,
+		{QueueDepth: 899, Capacity: 1000}:          false,
+		{QueueDepth: 5000}:                         false,
+		{QueueDepth: 1, OldestAge: 29.9}:           false,
+		{QueueDepth: 1, OldestAge: 30, Dropped: 3}: true,
+	}
+	for stats, expected := range cases {
+		if stats.Saturated() != expected {
+			t.Errorf("Expect saturated=%v for %+v", expected, stats)
+		}
+	}
+
+	tracker := NewBufferTracker(0)
+	for i := 0; i < 7; i++ {
+		tracker.Buffered()
+	}
+	writer := NewCountingDataWriter(&trackedDataWriter{tracker: tracker})
+	if stats, ok := SinkStatsOf(writer); !ok || stats.QueueDepth != 7 {
+		t.Errorf("Expect the stats of the wrapped writer, got=%+v", stats)
+	}
+
+	if _, ok := SinkStatsOf(NewCountingDataWriter(&queuedWriter{})); ok {
+		t.Errorf("Expect no stats for a writer without buffer tracking")
+	}
+}
+
+func TestFlushDataWriter(t *testing.T) {
+	tracker := NewBufferTracker(0)
+	tracker.Buffered()
+	tracker.Buffered()
+	writer := NewCountingDataWriter(&trackedDataWriter{tracker: tracker})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tracker.Released()
+		tracker.Released()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := FlushDataWriter(ctx, writer); err != nil {
+		t.Errorf("Expect the buffered data flushed, error=%s", err)
+	}
+
+	tracker.Buffered()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := FlushDataWriter(ctx, writer); err == nil {
+		t.Errorf("Expect error for the data not delivered before the deadline")
+	}
+
+	if err := FlushDataWriter(ctx, NewCountingDataWriter(&queuedWriter{})); err != nil {
+		t.Errorf("Expect the writers without buffer tracking not waited for, error=%s", err)
+	}
+}
+
+type trackedDataWriter struct {
+	DataWriter
+	tracker *BufferTracker
+}
+
+func (writer *trackedDataWriter) SinkStats() SinkStats {
+	return writer.tracker.Stats(time.Now())
+}
@@ -0,0 +1,159 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// Topic of the SLO breach events, see SLOReport.Event
+	SLOBreachTopic = "SLOBreach"
+
+	SLOObjectiveLag         = "lag"
+	SLOObjectiveSuccessRate = "success_rate"
+	SLOObjectiveThroughput  = "throughput"
+	SLOObjectiveRecordBytes = "record_bytes"
+
+	// BudgetBurn of the objectives without budget which are not met, for
+	// e.g. any failure against the 100 percent success rate
+	exhaustedBudgetBurn = 2
+)
+
+// SLO is the service level objectives of a task, the zero values are not
+// evaluated
+type SLO struct {
+	MaxLag         time.Duration // since the end of the last successful run
+	MinSuccessRate float64       // percent of the successful runs
+	MinThroughput  float64       // records per second over the runs
+	MaxRecordBytes float64       // average bytes per record over the runs
+}
+
+// SLOReport is the state of one objective of a task. BudgetBurn is the
+// ratio of the actual value to the objective in the direction of the breach,
+// for e.g. 0.5 when half of the failures allowed by the success rate happened,
+// it is breached beyond 1
+type SLOReport struct {
+	Key        string
+	Objective  string
+	Target     float64
+	Actual     float64
+	BudgetBurn float64
+	Breached   bool
+}
+
+// ParseSLO returns nil without an error if task has no objectives
+// @task: contains optional SLOMaxLag in seconds, SLOMinSuccessRate in
+// percent, for e.g. "99", SLOMinThroughput in records per second and
+// SLOMaxRecordBytes
+func ParseSLO(task BaseConfig) (*SLO, error) {
+	var slo SLO
+	var values [4]float64
+	configured := false
+	for i, key := range []string{SLOMaxLag, SLOMinSuccessRate, SLOMinThroughput, SLOMaxRecordBytes} {
+		if task[key] == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(task[key], 64)
+		if err != nil || value <= 0 || (key == SLOMinSuccessRate && value > 100) {
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s", key, task[key]))
+		}
+		values[i] = value
+		configured = true
+	}
+
+	if !configured {
+		return nil, nil
+	}
+
+	slo.MaxLag = time.Duration(values[0] * float64(time.Second))
+	slo.MinSuccessRate = values[1]
+	slo.MinThroughput = values[2]
+	slo.MaxRecordBytes = values[3]
+	return &slo, nil
+}
+
+// EvaluateSLO evaluates slo against the runs of task key, oldest first. No
+// report is returned for the objectives the runs don't cover yet
+func EvaluateSLO(key string, slo *SLO, runs []JobRun, now time.Time) []SLOReport {
+	if slo == nil || len(runs) == 0 {
+		return nil
+	}
+
+	var (
+		successes     int
+		records       int64
+		bytes         int64
+		lastSuccessAt int64
+	)
+	for _, run := range runs {
+		if run.Outcome == JobRunSuccess {
+			successes++
+			lastSuccessAt = run.EndTime
+		}
+		records += run.Records
+		bytes += run.Bytes
+	}
+
+	var reports []SLOReport
+	newReport := func(objective string, target, actual, burn float64) {
+		reports = append(reports, SLOReport{
+			Key:        key,
+			Objective:  objective,
+			Target:     target,
+			Actual:     actual,
+			BudgetBurn: burn,
+			Breached:   burn > 1,
+		})
+	}
+
+	if slo.MaxLag > 0 {
+		// The lag is counted from the first run until a run succeeds
+		since := lastSuccessAt
+		if since == 0 {
+			since = runs[0].StartTime
+		}
+		lag := now.Sub(time.Unix(0, since))
+		newReport(SLOObjectiveLag, slo.MaxLag.Seconds(), lag.Seconds(), lag.Seconds()/slo.MaxLag.Seconds())
+	}
+
+	if slo.MinSuccessRate > 0 {
+		rate := float64(successes) * 100 / float64(len(runs))
+		burn := 0.0
+		if slo.MinSuccessRate < 100 {
+			burn = (100 - rate) / (100 - slo.MinSuccessRate)
+		} else if rate < 100 {
+			burn = exhaustedBudgetBurn
+		}
+		newReport(SLOObjectiveSuccessRate, slo.MinSuccessRate, rate, burn)
+	}
+
+	span := time.Duration(runs[len(runs)-1].EndTime - runs[0].StartTime)
+	if slo.MinThroughput > 0 && span > 0 {
+		throughput := float64(records) / span.Seconds()
+		burn := float64(exhaustedBudgetBurn)
+		if throughput > 0 {
+			burn = slo.MinThroughput / throughput
+		}
+		newReport(SLOObjectiveThroughput, slo.MinThroughput, throughput, burn)
+	}
+
+	if slo.MaxRecordBytes > 0 && records > 0 {
+		recordBytes := float64(bytes) / float64(records)
+		newReport(SLOObjectiveRecordBytes, slo.MaxRecordBytes, recordBytes, recordBytes/slo.MaxRecordBytes)
+	}
+	return reports
+}
+
+// Event returns the report as a SLOBreachTopic event
+func (report *SLOReport) Event() BaseConfig {
+	return BaseConfig{
+		TaskConfigKey: report.Key,
+		"Objective":   report.Objective,
+		"Target":      strconv.FormatFloat(report.Target, 'f', -1, 64),
+		"Actual":      strconv.FormatFloat(report.Actual, 'f', 2, 64),
+		"BudgetBurn":  strconv.FormatFloat(report.BudgetBurn, 'f', 2, 64),
+	}
+}
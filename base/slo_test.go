@@ -0,0 +1,67 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSLO(t *testing.T) {
+	if slo, err := ParseSLO(BaseConfig{}); slo != nil || err != nil {
+		t.Errorf("Expect no SLO by default, got %+v, error=%v", slo, err)
+	}
+
+	if _, err := ParseSLO(BaseConfig{SLOMinSuccessRate: "101"}); err == nil {
+		t.Errorf("Expect error for success rate above 100")
+	}
+
+	slo, err := ParseSLO(BaseConfig{
+		SLOMaxLag:         "300",
+		SLOMinSuccessRate: "90",
+		SLOMinThroughput:  "0.5",
+		SLOMaxRecordBytes: "100",
+	})
+	if err != nil || slo.MaxLag != 5*time.Minute {
+		t.Fatalf("Failed to parse SLO, got %+v, error=%v", slo, err)
+	}
+
+	start := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	var runs []JobRun
+	for i := 0; i < 10; i++ {
+		runs = append(runs, JobRun{
+			Key:       "incident",
+			StartTime: start.Add(time.Duration(i) * time.Minute).UnixNano(),
+			EndTime:   start.Add(time.Duration(i)*time.Minute + time.Second).UnixNano(),
+			Records:   30,
+			Bytes:     6000,
+			Outcome:   JobRunSuccess,
+		})
+	}
+	runs[9].Outcome = JobRunFailure
+	runs[8].Outcome = JobRunFailure
+
+	// The last success ended at 08:07:01
+	reports := EvaluateSLO("incident", slo, runs, start.Add(13*time.Minute+time.Second))
+	if len(reports) != 4 {
+		t.Fatalf("Expect 4 reports, got %+v", reports)
+	}
+
+	expected := map[string]bool{
+		SLOObjectiveLag:         true,  // 6 minutes
+		SLOObjectiveSuccessRate: true,  // 80 percent burns 2 times the budget
+		SLOObjectiveThroughput:  false, // 300 records in 541 seconds
+		SLOObjectiveRecordBytes: true,  // 200 bytes per record
+	}
+	for _, report := range reports {
+		if report.Breached != expected[report.Objective] {
+			t.Errorf("Expect breached=%t for objective=%s, got %+v", expected[report.Objective], report.Objective, report)
+		}
+	}
+
+	if reports[1].Objective != SLOObjectiveSuccessRate || reports[1].Actual != 80 || reports[1].BudgetBurn < 1.99 || reports[1].BudgetBurn > 2.01 {
+		t.Errorf("Unexpected success rate report=%+v", reports[1])
+	}
+
+	if EvaluateSLO("incident", slo, nil, start) != nil {
+		t.Errorf("Expect no reports without runs")
+	}
+}
@@ -0,0 +1,87 @@
+package base
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+const streamBufferSize = 64 * 1024
+
+// NewStreamBody returns a request body which is produced by write while it is
+// read, so a large payload is never buffered in memory as a whole. The error
+// of write fails the read of the body and so the request
+func NewStreamBody(write func(w io.Writer) error) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		buf := bufio.NewWriterSize(writer, streamBufferSize)
+		err := write(buf)
+		if err == nil {
+			err = buf.Flush()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+// GetStreamThreshold returns StreamThreshold of config, the payload size in
+// bytes from which the sinks stream the requests. 0 if it is not set or
+// invalid, which disables streaming
+func GetStreamThreshold(config BaseConfig) int {
+	threshold, err := strconv.Atoi(config[StreamThreshold])
+	if err != nil || threshold < 0 {
+		return 0
+	}
+	return threshold
+}
+
+// RawDataSize returns the total size of the RawData of data
+func RawDataSize(data *Data) int {
+	size := 0
+	for _, raw := range data.RawData {
+		size += len(raw)
+	}
+	return size
+}
+
+// WriteRecords writes the encoded records to w framed as format.Join does,
+// without joining them in memory first. The formats which are not built in
+// are joined with Join
+func WriteRecords(w io.Writer, format Format, raws [][]byte) error {
+	switch format.Name() {
+	case FormatJSON:
+		if _, err := w.Write([]byte{'['}); err != nil {
+			return err
+		}
+		for i, raw := range raws {
+			if i > 0 {
+				if _, err := w.Write([]byte{','}); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(raw); err != nil {
+				return err
+			}
+		}
+		_, err := w.Write([]byte{']'})
+		return err
+	case FormatNDJSON, FormatKV:
+		return WriteLines(w, raws)
+	default:
+		_, err := w.Write(format.Join(raws))
+		return err
+	}
+}
+
+// WriteLines writes the records to w one per line
+func WriteLines(w io.Writer, raws [][]byte) error {
+	for _, raw := range raws {
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
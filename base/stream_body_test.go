@@ -0,0 +1,102 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamBody(t *testing.T) {
+	body := NewStreamBody(func(w io.Writer) error {
+		for i := 0; i < 1000; i++ {
+			if _, err := w.Write([]byte("0123456789")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	content, err := ioutil.ReadAll(body)
+	if err != nil || len(content) != 10000 {
+		t.Errorf("Expect 10000 bytes streamed, got=%d, error=%v", len(content), err)
+	}
+
+	failure := errors.New("encode failure")
+	body = NewStreamBody(func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failure
+	})
+	if _, err = ioutil.ReadAll(body); err != failure {
+		t.Errorf("Expect the write error failing the read, got=%v", err)
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	raws := [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}
+	for _, name := range []string{FormatJSON, FormatNDJSON, FormatKV} {
+		format, err := NewFormat(BaseConfig{Serialization: name}, "")
+		if err != nil {
+			t.Fatalf("Failed to create format=%s, error=%s", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteRecords(&buf, format, raws); err != nil {
+			t.Errorf("Failed to write records in format=%s, error=%s", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), format.Join(raws)) {
+			t.Errorf("Expect records framed as Join in format=%s, got=%s", name, buf.Bytes())
+		}
+	}
+
+	if size := RawDataSize(&Data{RawData: raws}); size != 14 {
+		t.Errorf("Expect raw data size=14, got=%d", size)
+	}
+
+	for value, expected := range map[string]int{"": 0, "-1": 0, "x": 0, "1048576": 1048576} {
+		if threshold := GetStreamThreshold(BaseConfig{StreamThreshold: value}); threshold != expected {
+			t.Errorf("Expect stream threshold=%d for %q, got=%d", expected, value, threshold)
+		}
+	}
+}
+
+func TestHTTPStreamGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(reader)
+		w.Write([]byte(strings.Join(req.TransferEncoding, ",") + " " + string(body)))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(BaseConfig{HTTPGzip: "1"}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client, error=%s", err)
+	}
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	req.Body = NewStreamBody(func(w io.Writer) error {
+		_, err := w.Write([]byte("streamed data"))
+		return err
+	})
+	req.ContentLength = -1
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post, error=%s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "chunked streamed data" {
+		t.Errorf("Expect chunked gzip body, got=%s", body)
+	}
+}
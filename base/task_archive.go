@@ -0,0 +1,125 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+	"net/url"
+	"time"
+)
+
+const (
+	TaskArchiveRoot = Root + "/archive"
+)
+
+// TaskProgress tracks when the checkpoint of a task last advanced, and
+// whether the task has been archived for not advancing since long, for e.g.
+// the table was deleted or the instance decommissioned. Checkpoint is the
+// checkpoint value last observed, Since when it was observed first. Task is
+// the config of the archived task, to find its state when it is purged
+type TaskProgress struct {
+	TaskConfigKey string
+	Checkpoint    string
+	Since         int64      // nano seconds since epoch
+	Archived      int64      `json:",omitempty"` // 0 if not archived
+	Purged        int64      `json:",omitempty"` // 0 if the state is kept
+	Task          BaseConfig `json:",omitempty"`
+}
+
+// Observe records checkpoint observed at now, returns false if it hasn't
+// advanced since it was observed last
+func (progress *TaskProgress) Observe(checkpoint string, now time.Time) bool {
+	if progress.Since != 0 && progress.Checkpoint == checkpoint {
+		return false
+	}
+
+	progress.Checkpoint = checkpoint
+	progress.Since = now.UnixNano()
+	return true
+}
+
+// Stale returns how long the checkpoint hasn't advanced at now
+func (progress *TaskProgress) Stale(now time.Time) time.Duration {
+	if progress.Since == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, progress.Since))
+}
+
+// TaskArchive keeps the TaskProgress of the tasks in ZooKeeper, one
+// persistent node per task under TaskArchiveRoot, so the archived tasks stay
+// archived across the restarts and the leader changes of the schedulers
+type TaskArchive struct {
+	client *ZooKeeperClient
+}
+
+func NewTaskArchive(client *ZooKeeperClient) *TaskArchive {
+	return &TaskArchive{
+		client: client,
+	}
+}
+
+func taskArchiveNode(taskKey string) string {
+	return TaskArchiveRoot + "/" + url.QueryEscape(taskKey)
+}
+
+// Get returns the progress of the task of taskKey, nil if it is not tracked
+func (archive *TaskArchive) Get(taskKey string) (*TaskProgress, error) {
+	content, err := archive.client.GetNode(taskArchiveNode(taskKey), true)
+	if err != nil || len(content) == 0 {
+		return nil, err
+	}
+
+	progress := &TaskProgress{}
+	if err := json.Unmarshal(content, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// Put creates or replaces the progress of its task
+func (archive *TaskArchive) Put(progress *TaskProgress) error {
+	content, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	node := taskArchiveNode(progress.TaskConfigKey)
+	if err := archive.client.CreateNode(node, content, false, true); err != nil {
+		return err
+	}
+	return archive.client.SetNode(node, content)
+}
+
+// List returns the progress of all tracked tasks, the malformed ones are
+// skipped
+func (archive *TaskArchive) List() ([]*TaskProgress, error) {
+	children, err := archive.client.Children(TaskArchiveRoot)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		glog.Errorf("Failed to list task archive, error=%s", err)
+		return nil, err
+	}
+
+	var progresses []*TaskProgress
+	for _, child := range children {
+		content, err := archive.client.GetNode(TaskArchiveRoot+"/"+child, true)
+		if err != nil {
+			return nil, err
+		}
+
+		progress := &TaskProgress{}
+		if err := json.Unmarshal(content, progress); err != nil || progress.TaskConfigKey == "" {
+			// Deleted after being listed or malformed
+			continue
+		}
+		progresses = append(progresses, progress)
+	}
+	return progresses, nil
+}
+
+// Delete stops tracking the task of taskKey, it is not archived any more
+func (archive *TaskArchive) Delete(taskKey string) error {
+	return archive.client.DeleteNode(taskArchiveNode(taskKey), true)
+}
@@ -0,0 +1,34 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskProgress(t *testing.T) {
+	start := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	progress := &TaskProgress{TaskConfigKey: "incident"}
+	if !progress.Observe("2015-06-01 00:00:00", start) {
+		t.Errorf("Expect the first checkpoint observed as advanced")
+	}
+
+	if !progress.Observe("", start) {
+		t.Errorf("Expect an empty checkpoint observed as advanced")
+	}
+
+	if progress.Observe("", start.Add(time.Hour)) {
+		t.Errorf("Expect the same checkpoint observed as not advanced")
+	}
+
+	if stale := progress.Stale(start.Add(48 * time.Hour)); stale != 48*time.Hour {
+		t.Errorf("Expect stale for 48h, got %s", stale)
+	}
+
+	if !progress.Observe("2015-06-03 00:00:00", start.Add(48*time.Hour)) {
+		t.Errorf("Expect the new checkpoint observed as advanced")
+	}
+
+	if stale := progress.Stale(start.Add(48 * time.Hour)); stale != 0 {
+		t.Errorf("Expect not stale after the checkpoint advanced, got %s", stale)
+	}
+}
@@ -0,0 +1,97 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrTaskConflict is returned when a TaskConfigKey is already taken by a
+// task with a different definition
+var ErrTaskConflict = errors.New("conflicting task definition")
+
+// The configs identifying what a task collects, the other configs, for e.g.
+// Interval, may change without making it a different task
+var taskIdentityConfigs = []string{App, ServerURL, Username, Metric, KafkaTopic, KafkaPartition}
+
+// NormalizeServerURL lowers the case of the scheme and host and removes the
+// trailing "/", so the spellings of the same endpoint are one task
+func NormalizeServerURL(url string) string {
+	url = strings.TrimRight(strings.TrimSpace(url), "/")
+	sep := strings.Index(url, "://")
+	if sep < 0 {
+		return strings.ToLower(url)
+	}
+
+	end := strings.Index(url[sep+3:], "/")
+	if end < 0 {
+		return strings.ToLower(url)
+	}
+	end += sep + 3
+	return strings.ToLower(url[:end]) + url[end:]
+}
+
+// TaskIdentity returns the identity configs of task in "k=v,k=v" format
+func TaskIdentity(task BaseConfig) string {
+	parts := make([]string, 0, len(taskIdentityConfigs))
+	for _, k := range taskIdentityConfigs {
+		v := task[k]
+		if k == ServerURL {
+			v = NormalizeServerURL(v)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// TaskDefinitions detects the tasks sharing a TaskConfigKey with different
+// identities, which would otherwise reuse the job, cache entry and sequence
+// of each other
+type TaskDefinitions struct {
+	identities map[string]string // TaskConfigKey indexed
+	mutex      sync.Mutex
+}
+
+func NewTaskDefinitions() *TaskDefinitions {
+	return &TaskDefinitions{
+		identities: make(map[string]string),
+	}
+}
+
+// Register returns ErrTaskConflict wrapped with the details if key has been
+// registered with a different identity, the first definition is kept until
+// it is unregistered or replaced. Registering the same definition again is
+// fine
+func (defs *TaskDefinitions) Register(key string, task BaseConfig) error {
+	identity := TaskIdentity(task)
+
+	defs.mutex.Lock()
+	defer defs.mutex.Unlock()
+
+	if existing, ok := defs.identities[key]; ok && existing != identity {
+		return fmt.Errorf("%w, TaskConfigKey=%s is defined by %s, rejected %s", ErrTaskConflict, key, existing, identity)
+	}
+	defs.identities[key] = identity
+	return nil
+}
+
+// Replace registers key with the identity of task whatever it was defined
+// by, for e.g. when the task is updated with another ServerURL. Returns true
+// if the identity changed
+func (defs *TaskDefinitions) Replace(key string, task BaseConfig) bool {
+	identity := TaskIdentity(task)
+
+	defs.mutex.Lock()
+	defer defs.mutex.Unlock()
+
+	existing, ok := defs.identities[key]
+	defs.identities[key] = identity
+	return ok && existing != identity
+}
+
+func (defs *TaskDefinitions) Unregister(key string) {
+	defs.mutex.Lock()
+	delete(defs.identities, key)
+	defs.mutex.Unlock()
+}
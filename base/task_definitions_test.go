@@ -0,0 +1,70 @@
+package base
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeServerURL(t *testing.T) {
+	cases := map[string]string{
+		"https://ACME.service-now.com/":      "https://acme.service-now.com",
+		" https://acme.service-now.com ":     "https://acme.service-now.com",
+		"HTTPS://Acme.service-now.com/Api/X": "https://acme.service-now.com/Api/X",
+		"Acme.service-now.com":               "acme.service-now.com",
+	}
+
+	for url, expected := range cases {
+		if res := NormalizeServerURL(url); res != expected {
+			t.Errorf("Expect %s normalized to %s, got %s", url, expected, res)
+		}
+	}
+}
+
+func TestTaskDefinitions(t *testing.T) {
+	incident := BaseConfig{
+		App:       "snow",
+		ServerURL: "https://acme.service-now.com",
+		Username:  "admin",
+		Metric:    "incident",
+		Interval:  "60",
+	}
+	defs := NewTaskDefinitions()
+	if err := defs.Register("key1", incident); err != nil {
+		t.Errorf("Expect task registered, error=%s", err)
+	}
+
+	// The same task with another Interval and spelling of ServerURL
+	same := BaseConfig{
+		App:       "snow",
+		ServerURL: "https://ACME.service-now.com/",
+		Username:  "admin",
+		Metric:    "incident",
+		Interval:  "300",
+	}
+	if err := defs.Register("key1", same); err != nil {
+		t.Errorf("Expect the same definition accepted, error=%s", err)
+	}
+
+	change := BaseConfig{
+		App:       "snow",
+		ServerURL: "https://acme.service-now.com",
+		Username:  "admin",
+		Metric:    "change_request",
+	}
+	if err := defs.Register("key1", change); !errors.Is(err, ErrTaskConflict) {
+		t.Errorf("Expect ErrTaskConflict, got %v", err)
+	}
+
+	defs.Unregister("key1")
+	if err := defs.Register("key1", change); err != nil {
+		t.Errorf("Expect task registered after unregistered, error=%s", err)
+	}
+
+	if !defs.Replace("key1", incident) || defs.Replace("key1", same) {
+		t.Errorf("Expect only the change of the identity reported")
+	}
+
+	if err := defs.Register("key1", change); !errors.Is(err, ErrTaskConflict) {
+		t.Errorf("Expect the replaced definition kept, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SupportedTaskSchemaVersion is the newest task schema understood by this
+	// collector. Bump it and register the new configs in taskSchemaFeatures
+	// when a task config is added which an older collector would ignore and
+	// collect the task wrongly
+	SupportedTaskSchemaVersion = 2
+
+	// Topic of the tasks rejected by the collector, see TaskNackEvent
+	TaskNackTopic = "TaskNack"
+)
+
+// The reasons of the tasks rejected by the collector, see TaskRejectEvent
+const (
+	TaskRejectInvalid  = "invalid"  // the task config is malformed
+	TaskRejectSchema   = "schema"   // see CheckTaskSchema
+	TaskRejectApp      = "app"      // the app is not registered or disabled
+	TaskRejectConflict = "conflict" // TaskConfigKey is taken by another task
+	TaskRejectCreation = "creation" // the job of the task can't be created
+)
+
+// ErrTaskSchemaUnsupported is returned for the tasks requiring a newer
+// schema than SupportedTaskSchemaVersion
+var ErrTaskSchemaUnsupported = errors.New("unsupported task schema")
+
+// taskSchemaFeatures are the task configs introduced after the first schema,
+// indexed by the config with the schema version introducing it
+var taskSchemaFeatures = map[string]int{
+	Domains:       2,
+	"Endpoint":    2, // snow Scripted REST APIs
+	ResumePolicy:  2,
+	Serialization: 2,
+}
+
+// RequiredTaskSchemaVersion returns the oldest schema version supporting all
+// configs set in task, 1 for the tasks using none of taskSchemaFeatures
+func RequiredTaskSchemaVersion(task BaseConfig) int {
+	required := 1
+	for k, version := range taskSchemaFeatures {
+		if task[k] != "" && version > required {
+			required = version
+		}
+	}
+	return required
+}
+
+// StampTaskSchema sets TaskSchemaVersion of task to the version it requires,
+// so the collectors of an older release accept the tasks which use none of
+// the newer configs during a rolling upgrade. An explicit TaskSchemaVersion
+// higher than required is kept
+func StampTaskSchema(task BaseConfig) {
+	required := RequiredTaskSchemaVersion(task)
+	if n, err := strconv.Atoi(task[TaskSchemaVersion]); err == nil && n > required {
+		return
+	}
+	task[TaskSchemaVersion] = strconv.Itoa(required)
+}
+
+// CheckTaskSchema returns ErrTaskSchemaUnsupported wrapped with the details
+// if task requires a schema newer than SupportedTaskSchemaVersion. The tasks
+// without TaskSchemaVersion are published by the schedulers of the older
+// releases and are checked by the configs they use
+func CheckTaskSchema(task BaseConfig) error {
+	required := RequiredTaskSchemaVersion(task)
+	if task[TaskSchemaVersion] != "" {
+		n, err := strconv.Atoi(task[TaskSchemaVersion])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%w, invalid %s=%s of task=%s", ErrTaskSchemaUnsupported, TaskSchemaVersion, task[TaskSchemaVersion], task[TaskConfigKey])
+		}
+
+		if n > required {
+			required = n
+		}
+	}
+
+	if required > SupportedTaskSchemaVersion {
+		return fmt.Errorf("%w, task=%s requires schema version %d, this collector supports up to %d",
+			ErrTaskSchemaUnsupported, task[TaskConfigKey], required, SupportedTaskSchemaVersion)
+	}
+	return nil
+}
+
+// TaskNackEvent returns the TaskNackTopic event of task rejected by host
+func TaskNackEvent(task BaseConfig, host string, err error) BaseConfig {
+	return BaseConfig{
+		App:               task[App],
+		TaskConfigKey:     task[TaskConfigKey],
+		TaskSchemaVersion: task[TaskSchemaVersion],
+		Host:              host,
+		"Supported":       strconv.Itoa(SupportedTaskSchemaVersion),
+		"Error":           err.Error(),
+	}
+}
+
+// TaskRejectEvent is TaskNackEvent with the reason and where the task
+// collects from, for diagnosing the tasks which are not collected
+// @reason: one of the TaskReject* reasons
+func TaskRejectEvent(task BaseConfig, host string, reason string, err error) BaseConfig {
+	event := TaskNackEvent(task, host, err)
+	event["Reason"] = reason
+	event[Metric] = task[Metric]
+	event[ServerURL] = task[ServerURL]
+	return event
+}
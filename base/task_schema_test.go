@@ -0,0 +1,55 @@
+package base
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTaskSchema(t *testing.T) {
+	task := BaseConfig{App: "snow", TaskConfigKey: "snow/incident"}
+	StampTaskSchema(task)
+	if task[TaskSchemaVersion] != "1" {
+		t.Errorf("Expect schema version 1 for the task without newer configs, got %s", task[TaskSchemaVersion])
+	}
+
+	task[ResumePolicy] = ResumeFromNow
+	StampTaskSchema(task)
+	if task[TaskSchemaVersion] != "2" {
+		t.Errorf("Expect schema version 2 for ResumePolicy, got %s", task[TaskSchemaVersion])
+	}
+
+	if err := CheckTaskSchema(task); err != nil {
+		t.Errorf("Expect task accepted, error=%s", err)
+	}
+
+	// Explicitly required newer schema
+	task[TaskSchemaVersion] = "99"
+	StampTaskSchema(task)
+	err := CheckTaskSchema(task)
+	if task[TaskSchemaVersion] != "99" || !errors.Is(err, ErrTaskSchemaUnsupported) {
+		t.Errorf("Expect the newer schema kept and rejected, version=%s, error=%v", task[TaskSchemaVersion], err)
+	}
+
+	event := TaskNackEvent(task, "host1", err)
+	if event[TaskConfigKey] != "snow/incident" || event[Host] != "host1" || event["Error"] == "" {
+		t.Errorf("Unexpected NACK event=%s", event)
+	}
+
+	event = TaskRejectEvent(task, "host1", TaskRejectSchema, err)
+	if event["Reason"] != TaskRejectSchema || event[TaskConfigKey] != "snow/incident" || event["Error"] == "" {
+		t.Errorf("Unexpected reject event=%s", event)
+	}
+
+	for _, version := range []string{"x", "0"} {
+		task[TaskSchemaVersion] = version
+		if err := CheckTaskSchema(task); !errors.Is(err, ErrTaskSchemaUnsupported) {
+			t.Errorf("Expect invalid version=%s rejected, error=%v", version, err)
+		}
+	}
+
+	// Published by an older scheduler
+	delete(task, TaskSchemaVersion)
+	if err := CheckTaskSchema(task); err != nil {
+		t.Errorf("Expect the task without version accepted, error=%s", err)
+	}
+}
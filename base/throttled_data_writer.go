@@ -0,0 +1,149 @@
+package base
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// process wide shaping stats of all ThrottledDataWriters
+	shapedWrites int64
+	shapingDelay int64 // nano seconds
+)
+
+// ShapingStats returns the number of writes delayed by the ThrottledDataWriters
+// of the process and the total delay
+func ShapingStats() (int64, time.Duration) {
+	return atomic.LoadInt64(&shapedWrites), time.Duration(atomic.LoadInt64(&shapingDelay))
+}
+
+// ThrottledDataWriter shapes the output of the wrapped DataWriter with a leaky
+// bucket on records/sec and/or bytes/sec. Writes exceeding the rate are queued,
+// which means the caller is blocked until the bucket drains, in the order
+// they come in
+type ThrottledDataWriter struct {
+	DataWriter
+	recordRate float64 // unlimited if not positive
+	byteRate   float64 // unlimited if not positive
+	next       time.Time
+	delayed    int64
+	delay      int64 // nano seconds
+	lockGuard  sync.Mutex
+}
+
+// NewThrottledDataWriter
+// @config: contains SinkRecordRate in records/sec and SinkByteRate in
+// bytes/sec, writer is returned as is if neither of them is configured
+func NewThrottledDataWriter(writer DataWriter, config BaseConfig) DataWriter {
+	recordRate, _ := strconv.ParseFloat(config[SinkRecordRate], 64)
+	byteRate, _ := strconv.ParseFloat(config[SinkByteRate], 64)
+	if recordRate <= 0 && byteRate <= 0 {
+		return writer
+	}
+
+	return &ThrottledDataWriter{
+		DataWriter: writer,
+		recordRate: recordRate,
+		byteRate:   byteRate,
+	}
+}
+
+func (writer *ThrottledDataWriter) WriteData(data *Data) error {
+	writer.wait(context.Background(), data)
+	return writer.DataWriter.WriteData(data)
+}
+
+func (writer *ThrottledDataWriter) WriteDataSync(data *Data) error {
+	writer.wait(context.Background(), data)
+	return writer.DataWriter.WriteDataSync(data)
+}
+
+func (writer *ThrottledDataWriter) WriteDataAsync(data *Data) error {
+	writer.wait(context.Background(), data)
+	return writer.DataWriter.WriteDataAsync(data)
+}
+
+func (writer *ThrottledDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	if err := writer.wait(ctx, data); err != nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataContext(ctx, data)
+}
+
+// Stats returns the number of delayed writes and the total delay
+func (writer *ThrottledDataWriter) Stats() (int64, time.Duration) {
+	return atomic.LoadInt64(&writer.delayed), time.Duration(atomic.LoadInt64(&writer.delay))
+}
+
+func (writer *ThrottledDataWriter) wait(ctx context.Context, data *Data) error {
+	start := time.Now()
+	delay, cost := writer.reserve(data, start)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		// The data is not written, give back its share of the bucket so the
+		// retries of the batch are not charged again and again
+		writer.release(cost)
+		err = ctx.Err()
+	}
+
+	waited := time.Since(start)
+	if waited > delay {
+		waited = delay
+	}
+	atomic.AddInt64(&writer.delayed, 1)
+	atomic.AddInt64(&writer.delay, int64(waited))
+	atomic.AddInt64(&shapedWrites, 1)
+	atomic.AddInt64(&shapingDelay, int64(waited))
+	return err
+}
+
+// reserve returns how long the data shall wait before it is written and its
+// cost. The bucket drains at the configured rates, the data is queued after
+// what is already in the bucket
+func (writer *ThrottledDataWriter) reserve(data *Data, now time.Time) (time.Duration, time.Duration) {
+	var cost float64
+	if writer.recordRate > 0 {
+		cost = float64(data.Len()) / writer.recordRate
+	}
+
+	if writer.byteRate > 0 {
+		data.Serialize()
+		var n int
+		for _, rawData := range data.RawData {
+			n += len(rawData)
+		}
+		if byteCost := float64(n) / writer.byteRate; byteCost > cost {
+			cost = byteCost
+		}
+	}
+
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+
+	if writer.next.Before(now) {
+		writer.next = now
+	}
+	delay := writer.next.Sub(now)
+	d := time.Duration(cost * float64(time.Second))
+	writer.next = writer.next.Add(d)
+	return delay, d
+}
+
+// release gives back the cost of a reservation which is not used
+func (writer *ThrottledDataWriter) release(cost time.Duration) {
+	writer.lockGuard.Lock()
+	writer.next = writer.next.Add(-cost)
+	writer.lockGuard.Unlock()
+}
@@ -0,0 +1,59 @@
+package base
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottledDataWriter(t *testing.T) {
+	if writer := NewThrottledDataWriter(nil, BaseConfig{}); writer != nil {
+		t.Errorf("Expect the writer as is without rates configured")
+	}
+
+	config := BaseConfig{
+		SinkRecordRate: "10",
+		SinkByteRate:   "100",
+	}
+	writer := NewThrottledDataWriter(nil, config).(*ThrottledDataWriter)
+
+	now := time.Now()
+	records := NewData(nil, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")})
+	if delay, _ := writer.reserve(records, now); delay != 0 {
+		t.Errorf("Expect the first write goes through, got delay=%s", delay)
+	}
+
+	// 5 records at 10 records/sec
+	if delay, _ := writer.reserve(records, now); delay != 500*time.Millisecond {
+		t.Errorf("Expect 500ms delay on records, got %s", delay)
+	}
+
+	// 5 records at 10 records/sec and 50 bytes at 100 bytes/sec
+	large := NewData(nil, [][]byte{make([]byte, 50)})
+	if delay, _ := writer.reserve(large, now); delay != time.Second {
+		t.Errorf("Expect 1s delay, got %s", delay)
+	}
+
+	// The bucket drained 500ms more than the queued
+	if delay, _ := writer.reserve(records, now.Add(2*time.Second)); delay != 0 {
+		t.Errorf("Expect drained bucket, got delay=%s", delay)
+	}
+
+	// A cancelled wait gives back its reservation and only counts the time
+	// it waited
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next := time.Now().Add(time.Hour)
+	writer.next = next
+	if err := writer.wait(ctx, records); err != context.Canceled {
+		t.Errorf("Expect canceled wait, got %v", err)
+	}
+
+	if !writer.next.Equal(next) {
+		t.Errorf("Expect the bucket unchanged by the cancelled wait, got %s", writer.next.Sub(next))
+	}
+
+	if delayed, delay := writer.Stats(); delayed != 1 || delay > time.Second {
+		t.Errorf("Expect 1 delayed write which barely waited, got %d %s", delayed, delay)
+	}
+}
@@ -0,0 +1,71 @@
+package base
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig builds the TLS options shared by HTTP based sinks
+// @config: contains optional
+// TLSCAFile: PEM CA bundle to verify the server
+// TLSCertFile, TLSKeyFile: PEM client certificate and key for mTLS
+// TLSMinVersion: "1.0", "1.1", "1.2" or "1.3"
+// TLSServerName: SNI and verification name override
+// TLSSkipVerify: "1" not to verify the server certificate, for e.g. self
+// signed certificates in test environments. The server is verified by default
+func NewTLSConfig(config BaseConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config[TLSServerName],
+		InsecureSkipVerify: config[TLSSkipVerify] == "1",
+	}
+
+	if tlsConfig.InsecureSkipVerify {
+		glog.Warningf("%s is enabled, the server certificate is not verified", TLSSkipVerify)
+	}
+
+	if config[TLSCAFile] != "" {
+		pem, err := ioutil.ReadFile(config[TLSCAFile])
+		if err != nil {
+			glog.Errorf("Failed to read CA bundle %s, error=%s", config[TLSCAFile], err)
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			glog.Errorf("No valid certificate found in CA bundle %s", config[TLSCAFile])
+			return nil, errors.New("Invalid CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config[TLSCertFile] != "" || config[TLSKeyFile] != "" {
+		cert, err := tls.LoadX509KeyPair(config[TLSCertFile], config[TLSKeyFile])
+		if err != nil {
+			glog.Errorf("Failed to load client certificate %s and key %s, error=%s", config[TLSCertFile], config[TLSKeyFile], err)
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if config[TLSMinVersion] != "" {
+		version, ok := tlsVersions[config[TLSMinVersion]]
+		if !ok {
+			glog.Errorf("Invalid TLS version=%s", config[TLSMinVersion])
+			return nil, errors.New(fmt.Sprintf("Invalid TLS version=%s", config[TLSMinVersion]))
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,35 @@
+package base
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	tlsConfig, err := NewTLSConfig(BaseConfig{})
+	if err != nil || tlsConfig.InsecureSkipVerify {
+		t.Errorf("Expect verification by default, got error=%v", err)
+	}
+
+	tlsConfig, err = NewTLSConfig(BaseConfig{TLSSkipVerify: "1"})
+	if err != nil || !tlsConfig.InsecureSkipVerify {
+		t.Errorf("Expect no verification with %s, got error=%v", TLSSkipVerify, err)
+	}
+
+	tlsConfig, err = NewTLSConfig(BaseConfig{
+		TLSSkipVerify: "0",
+		TLSMinVersion: "1.2",
+		TLSServerName: "splunk.example.com",
+	})
+	if err != nil || tlsConfig.InsecureSkipVerify || tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.ServerName != "splunk.example.com" {
+		t.Errorf("Unexpected TLS config=%+v, error=%v", tlsConfig, err)
+	}
+
+	if _, err = NewTLSConfig(BaseConfig{TLSMinVersion: "2.0"}); err == nil {
+		t.Errorf("Expect error for invalid TLS version")
+	}
+
+	if _, err = NewTLSConfig(BaseConfig{TLSCAFile: "not_exist.pem"}); err == nil {
+		t.Errorf("Expect error for missing CA bundle")
+	}
+}
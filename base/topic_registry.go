@@ -0,0 +1,137 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	TopicRegistryRoot = Root + "/topics"
+)
+
+// TopicRegistration describes the data a task writes, so the downstream
+// consumers can discover the topics and how to decode their messages: an
+// Envelope of Version Envelope, compressed with Compression, whose RawData
+// is in Serialization
+type TopicRegistration struct {
+	TaskConfigKey string
+	App           string
+	Topic         string
+	Brokers       string
+	ServerURL     string `json:",omitempty"`
+	Metric        string `json:",omitempty"`
+	Envelope      string
+	Serialization string
+	Compression   string
+	Updated       int64
+}
+
+// NewTopicRegistration returns the registration of the output topic of task
+func NewTopicRegistration(task BaseConfig) *TopicRegistration {
+	reg := &TopicRegistration{
+		TaskConfigKey: task[TaskConfigKey],
+		App:           task[App],
+		Topic:         task[KafkaTopic],
+		Brokers:       task[KafkaBrokers],
+		ServerURL:     task[ServerURL],
+		Metric:        task[Metric],
+		Envelope:      EnvelopeVersion,
+		Serialization: task[Serialization],
+		Compression:   task[Compression],
+		Updated:       time.Now().UnixNano(),
+	}
+
+	if reg.Serialization == "" {
+		reg.Serialization = FormatJSON
+	}
+
+	if reg.Compression == "" {
+		reg.Compression = CodecNone
+	}
+	return reg
+}
+
+type topicRegistrations []*TopicRegistration
+
+func (regs topicRegistrations) Len() int {
+	return len(regs)
+}
+
+func (regs topicRegistrations) Swap(i, j int) {
+	regs[i], regs[j] = regs[j], regs[i]
+}
+
+func (regs topicRegistrations) Less(i, j int) bool {
+	if regs[i].Topic != regs[j].Topic {
+		return regs[i].Topic < regs[j].Topic
+	}
+	return regs[i].TaskConfigKey < regs[j].TaskConfigKey
+}
+
+// TopicRegistry maps the tasks to their output topics in ZooKeeper, one
+// persistent node of TopicRegistration per task under TopicRegistryRoot
+type TopicRegistry struct {
+	client *ZooKeeperClient
+}
+
+func NewTopicRegistry(client *ZooKeeperClient) *TopicRegistry {
+	return &TopicRegistry{
+		client: client,
+	}
+}
+
+func topicRegistryNode(taskKey string) string {
+	return TopicRegistryRoot + "/" + url.QueryEscape(taskKey)
+}
+
+// Register creates or replaces the registration of task
+func (registry *TopicRegistry) Register(task BaseConfig) error {
+	content, err := json.Marshal(NewTopicRegistration(task))
+	if err != nil {
+		return err
+	}
+
+	node := topicRegistryNode(task[TaskConfigKey])
+	if err := registry.client.CreateNode(node, content, false, true); err != nil {
+		return err
+	}
+	return registry.client.SetNode(node, content)
+}
+
+// Deregister removes the registration of the task of taskKey
+func (registry *TopicRegistry) Deregister(taskKey string) error {
+	return registry.client.DeleteNode(topicRegistryNode(taskKey), true)
+}
+
+// List returns the registrations sorted by topic, the malformed ones are
+// skipped
+func (registry *TopicRegistry) List() ([]*TopicRegistration, error) {
+	children, err := registry.client.Children(TopicRegistryRoot)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		glog.Errorf("Failed to list topic registrations, error=%s", err)
+		return nil, err
+	}
+
+	var regs topicRegistrations
+	for _, child := range children {
+		content, err := registry.client.GetNode(TopicRegistryRoot+"/"+child, true)
+		if err != nil {
+			return nil, err
+		}
+
+		reg := &TopicRegistration{}
+		if err := json.Unmarshal(content, reg); err != nil || reg.Topic == "" {
+			// Deleted after being listed or malformed
+			continue
+		}
+		regs = append(regs, reg)
+	}
+	sort.Sort(regs)
+	return regs, nil
+}
@@ -0,0 +1,62 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TopicRule maps the Source topic to the Target topic. A Source ending with
+// "*" matches the topics with its prefix, the "*" in Target is replaced by
+// the rest of the matched topic
+type TopicRule struct {
+	Source string
+	Target string
+}
+
+// ParseTopicRules parses rules in "source1=target1,logs_*=dc2_logs_*"
+// format. A rule without target keeps the topic name
+func ParseTopicRules(rules string) ([]TopicRule, error) {
+	var res []TopicRule
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		pair := strings.SplitN(rule, "=", 2)
+		source, target := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[0])
+		if len(pair) == 2 {
+			target = strings.TrimSpace(pair[1])
+		}
+
+		// "*" is only allowed at the end of source
+		if star := strings.Index(source, "*"); source == "" || target == "" || (star >= 0 && star < len(source)-1) {
+			return nil, errors.New(fmt.Sprintf("Invalid topic rule=%s", rule))
+		}
+
+		if strings.Contains(target, "*") && !strings.HasSuffix(source, "*") {
+			return nil, errors.New(fmt.Sprintf("Invalid topic rule=%s, target has * but source doesn't", rule))
+		}
+		res = append(res, TopicRule{Source: source, Target: target})
+	}
+	return res, nil
+}
+
+// MapTopic returns the target topic of the first rule matching topic
+func MapTopic(rules []TopicRule, topic string) (string, bool) {
+	for _, rule := range rules {
+		if !strings.HasSuffix(rule.Source, "*") {
+			if rule.Source == topic {
+				return rule.Target, true
+			}
+			continue
+		}
+
+		prefix := strings.TrimSuffix(rule.Source, "*")
+		if strings.HasPrefix(topic, prefix) {
+			return strings.Replace(rule.Target, "*", topic[len(prefix):], 1), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,35 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestTopicRules(t *testing.T) {
+	rules, err := ParseTopicRules("incidents=dc2_incidents, logs_*=dc2_logs_*, audit_*, raw")
+	if err != nil || len(rules) != 4 {
+		t.Fatalf("Failed to parse topic rules, got=%v, error=%v", rules, err)
+	}
+
+	cases := map[string]string{
+		"incidents":  "dc2_incidents",
+		"logs_snow":  "dc2_logs_snow",
+		"logs_":      "dc2_logs_",
+		"audit_snow": "audit_snow",
+		"raw":        "raw",
+		"raw2":       "",
+		"changes":    "",
+	}
+
+	for topic, expected := range cases {
+		target, ok := MapTopic(rules, topic)
+		if target != expected || ok != (expected != "") {
+			t.Errorf("Expect topic=%s mapped to %q, got %q", topic, expected, target)
+		}
+	}
+
+	for _, invalid := range []string{"=target", "source=", "lo*gs=x", "logs=x_*"} {
+		if _, err := ParseTopicRules(invalid); err == nil {
+			t.Errorf("Expect error for topic rule=%s", invalid)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package base
+
+import (
+	"context"
+)
+
+// Transform changes data before it is written. It returns nil to drop data
+type Transform func(data *Data) (*Data, error)
+
+// TransformingDataWriter applies the transforms in order to the data before
+// it is written through the wrapped DataWriter
+type TransformingDataWriter struct {
+	DataWriter
+	transforms []Transform
+}
+
+// NewTransformingDataWriter returns writer as is without transforms
+func NewTransformingDataWriter(writer DataWriter, transforms ...Transform) DataWriter {
+	if len(transforms) == 0 {
+		return writer
+	}
+
+	return &TransformingDataWriter{
+		DataWriter: writer,
+		transforms: transforms,
+	}
+}
+
+func (writer *TransformingDataWriter) WriteData(data *Data) error {
+	data, err := writer.transform(data)
+	if data == nil {
+		return err
+	}
+	return writer.DataWriter.WriteData(data)
+}
+
+func (writer *TransformingDataWriter) WriteDataSync(data *Data) error {
+	data, err := writer.transform(data)
+	if data == nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataSync(data)
+}
+
+func (writer *TransformingDataWriter) WriteDataAsync(data *Data) error {
+	data, err := writer.transform(data)
+	if data == nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataAsync(data)
+}
+
+func (writer *TransformingDataWriter) WriteDataContext(ctx context.Context, data *Data) error {
+	data, err := writer.transform(data)
+	if data == nil {
+		return err
+	}
+	return writer.DataWriter.WriteDataContext(ctx, data)
+}
+
+// transform returns nil data if it is dropped or on error
+func (writer *TransformingDataWriter) transform(data *Data) (*Data, error) {
+	for _, transform := range writer.transforms {
+		var err error
+		data, err = transform(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if data == nil {
+			return nil, nil
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,205 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"hash/crc32"
+	"strconv"
+	"sync"
+)
+
+const (
+	checkpointEnvelope        = "crc32"
+	defaultCheckpointVersions = 3
+)
+
+// verifiedCheckpoint wraps a checkpoint value with its CRC
+type verifiedCheckpoint struct {
+	Envelope string
+	Seq      int64
+	CRC      uint32
+	Value    []byte
+}
+
+// VerifiedCheckpointer protects the checkpoints of the wrapped Checkpointer
+// with CRC, and keeps the previous N versions under "<key>_v<slot>" keys.
+// When the current checkpoint is corrupted, it falls back to the latest valid
+// version instead of letting the reader restart from the very beginning.
+// Checkpoints written before the envelope was introduced are returned as is
+type VerifiedCheckpointer struct {
+	Checkpointer
+	versions  int
+	seqs      map[string]int64 // checkpoint key indexed
+	lockGuard sync.Mutex
+}
+
+// NewVerifiedCheckpointer
+// @versions: number of previous versions kept, 0 only verifies the current
+// checkpoint
+func NewVerifiedCheckpointer(checkpoint Checkpointer, versions int) *VerifiedCheckpointer {
+	if versions < 0 {
+		versions = 0
+	}
+
+	return &VerifiedCheckpointer{
+		Checkpointer: checkpoint,
+		versions:     versions,
+		seqs:         make(map[string]int64),
+	}
+}
+
+// GetCheckpointVersions returns CheckpointVersions, default to 3
+func GetCheckpointVersions(config BaseConfig) int {
+	versions, err := strconv.Atoi(config[CheckpointVersions])
+	if err != nil || versions < 0 {
+		return defaultCheckpointVersions
+	}
+	return versions
+}
+
+func (ck *VerifiedCheckpointer) GetCheckpoint(keyInfo map[string]string) ([]byte, error) {
+	data, err := ck.Checkpointer.GetCheckpoint(keyInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+
+	current, err := decodeVerifiedCheckpoint(data)
+	if err == nil {
+		if current == nil {
+			// Checkpoint written before the envelope was introduced
+			return data, nil
+		}
+		ck.setSeq(keyInfo, current.Seq)
+		return current.Value, nil
+	}
+
+	glog.Errorf("Checkpoint for key=%s is corrupted, error=%s, fall back to the previous versions",
+		checkpointKey(keyInfo), err)
+
+	var latest *verifiedCheckpoint
+	for slot := 0; slot < ck.versions; slot++ {
+		data, err := ck.Checkpointer.GetCheckpoint(slotKeyInfo(keyInfo, slot))
+		if err != nil || data == nil {
+			continue
+		}
+
+		version, err := decodeVerifiedCheckpoint(data)
+		if err != nil || version == nil {
+			glog.Warningf("Checkpoint version %d for key=%s is invalid, error=%v", slot, checkpointKey(keyInfo), err)
+			continue
+		}
+
+		if latest == nil || version.Seq > latest.Seq {
+			latest = version
+		}
+	}
+
+	if latest == nil {
+		return nil, errors.New(fmt.Sprintf("No valid checkpoint found for key=%s", checkpointKey(keyInfo)))
+	}
+
+	glog.Warningf("Fall back to checkpoint seq=%d for key=%s", latest.Seq, checkpointKey(keyInfo))
+	ck.setSeq(keyInfo, latest.Seq)
+	return latest.Value, nil
+}
+
+// WriteCheckpoint writes the version slot first, then the current checkpoint
+func (ck *VerifiedCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	ck.lockGuard.Lock()
+	key := checkpointKey(keyInfo)
+	ck.seqs[key]++
+	seq := ck.seqs[key]
+	ck.lockGuard.Unlock()
+
+	data, err := json.Marshal(&verifiedCheckpoint{
+		Envelope: checkpointEnvelope,
+		Seq:      seq,
+		CRC:      crc32.ChecksumIEEE(value),
+		Value:    value,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ck.versions > 0 {
+		slot := int(seq % int64(ck.versions))
+		if err := ck.Checkpointer.WriteCheckpoint(slotKeyInfo(keyInfo, slot), data); err != nil {
+			return err
+		}
+	}
+	return ck.Checkpointer.WriteCheckpoint(keyInfo, data)
+}
+
+func (ck *VerifiedCheckpointer) DeleteCheckpoint(keyInfo map[string]string) error {
+	for slot := 0; slot < ck.versions; slot++ {
+		ck.Checkpointer.DeleteCheckpoint(slotKeyInfo(keyInfo, slot))
+	}
+
+	ck.lockGuard.Lock()
+	delete(ck.seqs, checkpointKey(keyInfo))
+	ck.lockGuard.Unlock()
+	return ck.Checkpointer.DeleteCheckpoint(keyInfo)
+}
+
+func (ck *VerifiedCheckpointer) setSeq(keyInfo map[string]string, seq int64) {
+	ck.lockGuard.Lock()
+	key := checkpointKey(keyInfo)
+	if seq > ck.seqs[key] {
+		ck.seqs[key] = seq
+	}
+	ck.lockGuard.Unlock()
+}
+
+// decodeVerifiedCheckpoint returns nil without error if data is not enveloped
+func decodeVerifiedCheckpoint(data []byte) (*verifiedCheckpoint, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if _, ok := fields["Envelope"]; !ok {
+		return nil, nil
+	}
+
+	var ckpt verifiedCheckpoint
+	if err := json.Unmarshal(data, &ckpt); err != nil {
+		return nil, err
+	}
+
+	if ckpt.Envelope != checkpointEnvelope {
+		return nil, errors.New(fmt.Sprintf("Unknown checkpoint envelope=%s", ckpt.Envelope))
+	}
+
+	if crc := crc32.ChecksumIEEE(ckpt.Value); crc != ckpt.CRC {
+		return nil, errors.New(fmt.Sprintf("CRC mismatch, expect=%d, got=%d", ckpt.CRC, crc))
+	}
+	return &ckpt, nil
+}
+
+// checkpointKey is Key or CheckpointKey depending on the Checkpointer
+func checkpointKey(keyInfo map[string]string) string {
+	return keyInfo[Key] + "|" + keyInfo[CheckpointNamespace] + "|" + keyInfo[CheckpointKey]
+}
+
+func slotKeyInfo(keyInfo map[string]string, slot int) map[string]string {
+	slotInfo := make(map[string]string, len(keyInfo))
+	for k, v := range keyInfo {
+		slotInfo[k] = v
+	}
+
+	suffix := fmt.Sprintf("_v%d", slot)
+	if slotInfo[Key] != "" {
+		slotInfo[Key] += suffix
+	}
+
+	if slotInfo[CheckpointKey] != "" {
+		slotInfo[CheckpointKey] += suffix
+	}
+	return slotInfo
+}
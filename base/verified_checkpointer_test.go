@@ -0,0 +1,65 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifiedCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verified_ck")
+	if err != nil {
+		t.Errorf("Failed to create temp dir, error=%s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyInfo := map[string]string{
+		CheckpointDir:       dir,
+		CheckpointNamespace: "snow",
+		CheckpointKey:       "incident",
+	}
+	ckFile := filepath.Join(dir, "snow_incident"+checkpointFilePostfix)
+
+	// Legacy checkpoints are returned as is
+	ioutil.WriteFile(ckFile, []byte(`{"NextRecordTime":"2015-01-01"}`), 0644)
+	ck := NewVerifiedCheckpointer(NewFileCheckpointer(), 2)
+	data, err := ck.GetCheckpoint(keyInfo)
+	if err != nil || string(data) != `{"NextRecordTime":"2015-01-01"}` {
+		t.Errorf("Expect legacy checkpoint, got data=%s, error=%v", data, err)
+	}
+
+	for _, value := range []string{"v1", "v2", "v3"} {
+		if err := ck.WriteCheckpoint(keyInfo, []byte(value)); err != nil {
+			t.Errorf("Failed to write checkpoint, error=%s", err)
+		}
+	}
+
+	data, err = ck.GetCheckpoint(keyInfo)
+	if err != nil || string(data) != "v3" {
+		t.Errorf("Expect checkpoint v3, got data=%s, error=%v", data, err)
+	}
+
+	// Truncated checkpoint falls back to the latest valid version
+	content, _ := ioutil.ReadFile(ckFile)
+	ioutil.WriteFile(ckFile, content[:len(content)/2], 0644)
+	data, err = NewVerifiedCheckpointer(NewFileCheckpointer(), 2).GetCheckpoint(keyInfo)
+	if err != nil || string(data) != "v3" {
+		t.Errorf("Expect fallback to checkpoint v3, got data=%s, error=%v", data, err)
+	}
+
+	// CRC mismatch without any valid version is an error
+	ck = NewVerifiedCheckpointer(NewFileCheckpointer(), 0)
+	ck.WriteCheckpoint(keyInfo, []byte("v4"))
+	content, _ = ioutil.ReadFile(ckFile)
+	ioutil.WriteFile(ckFile, []byte(strings.Replace(string(content), `"djQ="`, `"djU="`, 1)), 0644)
+	if data, err = ck.GetCheckpoint(keyInfo); err == nil {
+		t.Errorf("Expect error for corrupted checkpoint, got data=%s", data)
+	}
+
+	if err := NewVerifiedCheckpointer(NewFileCheckpointer(), 2).DeleteCheckpoint(keyInfo); err != nil {
+		t.Errorf("DeleteCheckpoint should have no error, got=%s", err)
+	}
+}
@@ -0,0 +1,178 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Collect the changes of the skipped period when the window opens again
+	CatchUpCollect = "collect"
+	// Ignore the changes of the skipped period
+	CatchUpSkip = "skip"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type scheduleWindow struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int // minutes since midnight, less than start if overnight
+}
+
+// WorkingHours is a set of weekly collection windows in a timezone
+type WorkingHours struct {
+	windows  []scheduleWindow
+	location *time.Location
+}
+
+// ParseWorkingHours
+// @windows: windows separated by ";", for e.g. "Mon-Fri 09:00-17:00;Sat,Sun 10:00-12:00".
+// The days are optional and default to every day, "22:00-02:00" spans midnight
+// @timezone: IANA timezone like "America/New_York", default to UTC
+func ParseWorkingHours(windows, timezone string) (*WorkingHours, error) {
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hours := &WorkingHours{location: location}
+	for _, spec := range strings.Split(windows, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		window, err := parseScheduleWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		hours.windows = append(hours.windows, window)
+	}
+
+	if len(hours.windows) == 0 {
+		return nil, errors.New(fmt.Sprintf("No schedule window found in %s", windows))
+	}
+	return hours, nil
+}
+
+func parseScheduleWindow(spec string) (scheduleWindow, error) {
+	var window scheduleWindow
+	fields := strings.Fields(spec)
+	timeRange := fields[len(fields)-1]
+	if len(fields) == 1 {
+		for i := range window.days {
+			window.days[i] = true
+		}
+	} else if len(fields) == 2 {
+		for _, dayRange := range strings.Split(fields[0], ",") {
+			days := strings.SplitN(dayRange, "-", 2)
+			first, ok := weekdays[strings.ToLower(days[0])]
+			if !ok {
+				return window, errors.New(fmt.Sprintf("Invalid day=%s in schedule window=%s", days[0], spec))
+			}
+
+			last := first
+			if len(days) == 2 {
+				if last, ok = weekdays[strings.ToLower(days[1])]; !ok {
+					return window, errors.New(fmt.Sprintf("Invalid day=%s in schedule window=%s", days[1], spec))
+				}
+			}
+
+			for d := first; ; d = (d + 1) % 7 {
+				window.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	} else {
+		return window, errors.New(fmt.Sprintf("Invalid schedule window=%s", spec))
+	}
+
+	times := strings.SplitN(timeRange, "-", 2)
+	if len(times) != 2 {
+		return window, errors.New(fmt.Sprintf("Invalid time range in schedule window=%s", spec))
+	}
+
+	var err error
+	if window.start, err = parseMinutes(times[0]); err != nil {
+		return window, err
+	}
+
+	if window.end, err = parseMinutes(times[1]); err != nil {
+		return window, err
+	}
+	return window, nil
+}
+
+// parseMinutes parses "HH:MM" to minutes since midnight, "24:00" is allowed
+func parseMinutes(hhmm string) (int, error) {
+	parts := strings.SplitN(hhmm, ":", 2)
+	if len(parts) != 2 {
+		return 0, errors.New(fmt.Sprintf("Invalid time=%s, expect HH:MM", hhmm))
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, errors.New(fmt.Sprintf("Invalid time=%s", hhmm))
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains returns true if t is in any of the windows
+func (hours *WorkingHours) Contains(t time.Time) bool {
+	_, ok := hours.WindowStart(t)
+	return ok
+}
+
+// WindowStart returns the start time of the window which contains t
+func (hours *WorkingHours) WindowStart(t time.Time) (time.Time, bool) {
+	t = t.In(hours.location)
+	minutes := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, hours.location)
+	yesterday := (t.Weekday() + 6) % 7
+
+	for _, window := range hours.windows {
+		if window.start <= window.end {
+			if window.days[t.Weekday()] && minutes >= window.start && minutes < window.end {
+				return midnight.Add(time.Duration(window.start) * time.Minute), true
+			}
+			continue
+		}
+
+		// overnight window
+		if window.days[t.Weekday()] && minutes >= window.start {
+			return midnight.Add(time.Duration(window.start) * time.Minute), true
+		}
+
+		if window.days[yesterday] && minutes < window.end {
+			return midnight.AddDate(0, 0, -1).Add(time.Duration(window.start) * time.Minute), true
+		}
+	}
+	return time.Time{}, false
+}
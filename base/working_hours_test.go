@@ -0,0 +1,44 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkingHours(t *testing.T) {
+	hours, err := ParseWorkingHours("Mon-Fri 09:00-17:00; Sat,Sun 22:00-02:00", "UTC")
+	if err != nil {
+		t.Errorf("Failed to parse working hours, error=%s", err)
+		return
+	}
+
+	// 2015-06-01 is a Monday
+	cases := map[string]string{
+		"2015-06-01 08:59": "",
+		"2015-06-01 09:00": "2015-06-01 09:00",
+		"2015-06-05 16:59": "2015-06-05 09:00",
+		"2015-06-05 17:00": "",
+		"2015-06-06 12:00": "",
+		"2015-06-06 23:00": "2015-06-06 22:00",
+		"2015-06-07 01:00": "2015-06-06 22:00",
+		"2015-06-08 01:00": "2015-06-07 22:00",
+		"2015-06-08 02:00": "",
+	}
+
+	layout := "2006-01-02 15:04"
+	for now, expected := range cases {
+		ts, _ := time.Parse(layout, now)
+		start, ok := hours.WindowStart(ts)
+		if expected == "" && ok {
+			t.Errorf("%s should be out of the windows, got start=%s", now, start)
+		} else if expected != "" && (!ok || start.Format(layout) != expected) {
+			t.Errorf("%s should be in the window started at %s, got start=%s, ok=%v", now, expected, start, ok)
+		}
+	}
+
+	for _, invalid := range []string{"", "Funday 09:00-17:00", "Mon 9-17", "25:00-26:00"} {
+		if _, err := ParseWorkingHours(invalid, ""); err == nil {
+			t.Errorf("Expect error for invalid windows=%s", invalid)
+		}
+	}
+}
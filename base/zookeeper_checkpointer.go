@@ -6,8 +6,9 @@ import (
 )
 
 type ZooKeeperCheckpointer struct {
-	config   BaseConfig
-	zkClient *ZooKeeperClient
+	config    BaseConfig
+	zkClient  *ZooKeeperClient
+	lifecycle Lifecycle
 }
 
 func NewZooKeeperCheckpointer(config BaseConfig) *ZooKeeperCheckpointer {
@@ -23,13 +24,22 @@ func NewZooKeeperCheckpointer(config BaseConfig) *ZooKeeperCheckpointer {
 }
 
 func (checkpoint *ZooKeeperCheckpointer) Start() {
+	checkpoint.lifecycle.Start("ZooKeeperCheckpointer")
 }
 
-// FIXME, guard the Close
+// Stop closes the client, which is created with the checkpointer, even if it
+// is not started
 func (checkpoint *ZooKeeperCheckpointer) Stop() {
+	if checkpoint.lifecycle.Stop("ZooKeeperCheckpointer") == ErrAlreadyStopped {
+		return
+	}
 	checkpoint.zkClient.Close()
 }
 
+func (checkpoint *ZooKeeperCheckpointer) Status() string {
+	return checkpoint.lifecycle.Status()
+}
+
 // @keyInfo: shall contain a Key which is a node path
 func (checkpoint *ZooKeeperCheckpointer) GetCheckpoint(keyInfo map[string]string) ([]byte, error) {
 	if k, ok := keyInfo[Key]; !ok || k == "" {
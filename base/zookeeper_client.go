@@ -1,13 +1,16 @@
 package base
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
+	"net"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,11 +19,47 @@ const (
 	ElectionRoot    = Root + "/election"
 	HeartbeatRoot   = Root + "/heartbeat"
 	LongRunTaskRoot = Root + "/long_run_tasks"
+
+	defaultZooKeeperPort = "2181"
+)
+
+// ZooKeeperEvent is emitted to subscribers when the session state changes
+type ZooKeeperEvent int32
+
+const (
+	// Connection is lost, the session may still be alive
+	ZooKeeperDisconnected ZooKeeperEvent = iota
+	// Connection is re-established within the same session
+	ZooKeeperReconnected
+	// Session is expired, ephemeral nodes and watches are gone
+	ZooKeeperSessionExpired
+	// A new session is established and ephemeral nodes are re-created.
+	// Subscribers shall re-register their watches
+	ZooKeeperSessionRecovered
 )
 
+func (event ZooKeeperEvent) String() string {
+	switch event {
+	case ZooKeeperDisconnected:
+		return "Disconnected"
+	case ZooKeeperReconnected:
+		return "Reconnected"
+	case ZooKeeperSessionExpired:
+		return "SessionExpired"
+	case ZooKeeperSessionRecovered:
+		return "SessionRecovered"
+	}
+	return "Unknown"
+}
+
 type ZooKeeperClient struct {
-	conn   *zk.Conn
-	config BaseConfig
+	conn             *zk.Conn
+	config           BaseConfig
+	ephemerals       map[string][]byte // node path indexed
+	ephemeralsMutex  sync.Mutex
+	subscribers      []chan ZooKeeperEvent
+	subscribersMutex sync.Mutex
+	closed           bool // guarded by subscribersMutex
 }
 
 func NewZooKeeperClient(serverConfig BaseConfig) *ZooKeeperClient {
@@ -45,18 +84,40 @@ func NewZooKeeperClient(serverConfig BaseConfig) *ZooKeeperClient {
 		serverConfig[ZooKeeperLongRunTask] = LongRunTaskRoot
 	}
 
-	servers := strings.Split(serverConfig[ZooKeeperServers], ";")
+	var servers []string
+	for _, server := range strings.Split(serverConfig[ZooKeeperServers], ";") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+
+		addr, err := NormalizeHostPort(server, defaultZooKeeperPort)
+		if err != nil {
+			glog.Errorf("Invalid ZooKeeper server=%s, error=%s", server, err)
+			return nil
+		}
+		servers = append(servers, addr)
+	}
+
+	// Connects with the IPFamily of serverConfig
+	dialContext := NewDialContext(serverConfig)
+	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return dialContext(ctx, network, address)
+	}
 
-	conn, _, err := zk.Connect(servers, 10*time.Second)
+	conn, sessionEvents, err := zk.ConnectWithDialer(servers, 10*time.Second, dialer)
 	if err != nil {
 		glog.Errorf("Failed to create ZooKeeper Connection, error=%s", err)
 		return nil
 	}
 
 	client := &ZooKeeperClient{
-		conn:   conn,
-		config: serverConfig,
+		conn:       conn,
+		config:     serverConfig,
+		ephemerals: make(map[string][]byte),
 	}
+	go client.monitorSession(sessionEvents)
 
 	go func() {
 		if err != nil {
@@ -148,10 +209,107 @@ func (client *ZooKeeperClient) ChildrenW(parentNode string) (<-chan zk.Event, er
 
 func (client *ZooKeeperClient) Close() {
 	client.conn.Close()
+	client.closeSubscribers()
+}
+
+// Subscribe returns a channel which receives the session state changes.
+// The channel is closed when the client is closed, or right away if the
+// client has already been closed
+func (client *ZooKeeperClient) Subscribe() <-chan ZooKeeperEvent {
+	eventChan := make(chan ZooKeeperEvent, 10)
+	client.subscribersMutex.Lock()
+	if client.closed {
+		close(eventChan)
+	} else {
+		client.subscribers = append(client.subscribers, eventChan)
+	}
+	client.subscribersMutex.Unlock()
+	return eventChan
+}
+
+func (client *ZooKeeperClient) emit(event ZooKeeperEvent) {
+	client.subscribersMutex.Lock()
+	defer client.subscribersMutex.Unlock()
+
+	for _, eventChan := range client.subscribers {
+		select {
+		case eventChan <- event:
+		default:
+			glog.Warningf("ZooKeeper event subscriber is slow, drop event=%s", event)
+		}
+	}
+}
+
+// monitorSession follows the session state. The underlying connection
+// reconnects by itself, after a session expiration the ephemeral nodes
+// created through this client are re-created in the new session
+func (client *ZooKeeperClient) monitorSession(sessionEvents <-chan zk.Event) {
+	expired, disconnected := false, false
+	for event := range sessionEvents {
+		if event.Type != zk.EventSession {
+			continue
+		}
+
+		switch event.State {
+		case zk.StateDisconnected:
+			if !disconnected {
+				disconnected = true
+				glog.Warningf("ZooKeeper connection lost")
+				client.emit(ZooKeeperDisconnected)
+			}
+		case zk.StateExpired:
+			expired = true
+			glog.Warningf("ZooKeeper session expired")
+			client.emit(ZooKeeperSessionExpired)
+		case zk.StateHasSession:
+			if expired {
+				expired, disconnected = false, false
+				client.recreateEphemerals()
+				glog.Infof("ZooKeeper session recovered")
+				client.emit(ZooKeeperSessionRecovered)
+			} else if disconnected {
+				disconnected = false
+				glog.Infof("ZooKeeper connection re-established")
+				client.emit(ZooKeeperReconnected)
+			}
+		}
+	}
+
+	client.closeSubscribers()
+}
+
+func (client *ZooKeeperClient) closeSubscribers() {
+	client.subscribersMutex.Lock()
+	for _, eventChan := range client.subscribers {
+		close(eventChan)
+	}
+	client.subscribers = nil
+	client.closed = true
+	client.subscribersMutex.Unlock()
+}
+
+func (client *ZooKeeperClient) recreateEphemerals() {
+	client.ephemeralsMutex.Lock()
+	ephemerals := make(map[string][]byte, len(client.ephemerals))
+	for node, value := range client.ephemerals {
+		ephemerals[node] = value
+	}
+	client.ephemeralsMutex.Unlock()
+
+	for node, value := range ephemerals {
+		err := client.CreateNode(node, value, true, true)
+		if err != nil {
+			glog.Errorf("Failed to re-create ephemeral node=%s, error=%s", node, err)
+		}
+	}
 }
 
 // DeleteNode deletes the latest version data on the node
 func (client *ZooKeeperClient) DeleteNode(node string, ignoreNotExists bool) error {
+	client.ephemeralsMutex.Lock()
+	delete(client.ephemerals, node)
+	client.ephemeralsMutex.Unlock()
+
 	_, stat, err := client.conn.Get(node)
 	if err != nil {
 		if err == zk.ErrNoNode && ignoreNotExists {
@@ -182,6 +340,11 @@ func (client *ZooKeeperClient) CreateNode(node string, value []byte, ephemeral,
 
 	_, err := client.conn.Create(node, value, flags, zk.WorldACL(zk.PermAll))
 	if err == nil || (err == zk.ErrNodeExists && ignoreExists) {
+		if ephemeral {
+			client.ephemeralsMutex.Lock()
+			client.ephemerals[node] = value
+			client.ephemeralsMutex.Unlock()
+		}
 		return nil
 	}
 	glog.Errorf("Failed to create node=%s, error=%s", node, err)
@@ -209,8 +372,15 @@ func (client *ZooKeeperClient) SetNode(node string, value []byte) error {
 	stat, err = client.conn.Set(node, value, stat.Version)
 	if err != nil {
 		glog.Errorf("Failed to set node=%s, error=%s", node, err)
+		return err
 	}
-	return err
+
+	client.ephemeralsMutex.Lock()
+	if _, ok := client.ephemerals[node]; ok {
+		client.ephemerals[node] = value
+	}
+	client.ephemeralsMutex.Unlock()
+	return nil
 }
 
 // NodeExists check if the node already exists
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/mgmt"
+	"github.com/chenziliang/descartes/services"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(flags *flag.FlagSet, args []string) int
+}
+
+var commands = map[string]command{
+	"collect": {
+		usage: "run the data collector which executes the published tasks",
+		run:   runCollect,
+	},
+	"schedule": {
+		usage: "run the task scheduler, the leader distributes the tasks to the collectors",
+		run:   runSchedule,
+	},
+	"forward": {
+		usage: "relay the ForwardTopics to the ForwardBrokers cluster",
+		run:   runForward,
+	},
+	"retry": {
+		usage: "move the messages of the KafkaRetryDelays retry topics back when they are due",
+		run:   runRetry,
+	},
+	"export-stats": {
+		usage: "write the collector heartbeats of TaskStats to the TSDBURL time-series database",
+		run:   runExportStats,
+	},
+	"validate": {
+		usage: "validate the task files and the pipeline, exit non-zero on failure",
+		run:   runValidate,
+	},
+	"lint": {
+		usage: "statically check the task files for mistakes before they are published",
+		run:   runLint,
+	},
+	"checkpoint": {
+		usage: "inspect or export the checkpoint of a task",
+		run:   runCheckpoint,
+	},
+}
+
+// runCommand runs the subcommand name with its args and returns the exit
+// code of the process
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		printCommands()
+		return 1
+	}
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&globalSettingsFile, "config", globalSettingsFile, "global settings file")
+	// The glog flags, for e.g. -logtostderr, are accepted by every command
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+	// glog complains about logging before flag.Parse otherwise
+	flag.CommandLine.Parse(nil)
+
+	code := cmd.run(flags, args)
+	glog.Flush()
+	return code
+}
+
+func printCommands() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: descartes <command> [flags]\n\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s%s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"descartes <command> -h\" for the flags of a command\n")
+}
+
+// parseCommand parses the flags and loads the global settings, nil on error
+func parseCommand(flags *flag.FlagSet, args []string) base.BaseConfig {
+	flags.Parse(args)
+	globalConfig, err := getGlobalConfig(globalSettingsFile)
+	if err != nil {
+		return nil
+	}
+	return globalConfig
+}
+
+func runCollect(flags *flag.FlagSet, args []string) int {
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	handleDataCollection(globalConfig)
+	return 0
+}
+
+func runSchedule(flags *flag.FlagSet, args []string) int {
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	handleScheduling(globalConfig)
+	return 0
+}
+
+func runForward(flags *flag.FlagSet, args []string) int {
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	handleForwarding(globalConfig)
+	return 0
+}
+
+func runRetry(flags *flag.FlagSet, args []string) int {
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	handleRetries(globalConfig)
+	return 0
+}
+
+func runExportStats(flags *flag.FlagSet, args []string) int {
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	handleStatsExport(globalConfig)
+	return 0
+}
+
+func runValidate(flags *flag.FlagSet, args []string) int {
+	snow_task_file := flags.String("snow_task_file", "snow_tasks.json", "")
+	kafka_task_file := flags.String("kafka_task_file", "kafka_tasks.json", "")
+	task_template_file := flags.String("task_template_file", "", "task templates expanded into one task per table")
+	offline := flags.Bool("offline", false, "only validate the files, skip the pipeline checks")
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	snowTasks, err := getTasks(*snow_task_file)
+	if err != nil {
+		return 1
+	}
+
+	if _, err := getTasks(*kafka_task_file); err != nil {
+		return 1
+	}
+
+	if *task_template_file != "" {
+		templates, err := mgmt.LoadTaskTemplates(*task_template_file)
+		if err != nil {
+			return 1
+		}
+
+		if _, err := mgmt.ExpandTaskTemplates(templates); err != nil {
+			return 1
+		}
+	}
+
+	if *offline {
+		fmt.Println("Task files are valid")
+		return 0
+	}
+
+	var sources []base.BaseConfig
+	for _, tasks := range snowTasks {
+		sources = append(sources, tasks...)
+	}
+
+	report := services.RunSelfTest(globalConfig, sources)
+	content, _ := json.MarshalIndent(report, "", "    ")
+	fmt.Println(string(content))
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+func runLint(flags *flag.FlagSet, args []string) int {
+	snow_task_file := flags.String("snow_task_file", "snow_tasks.json", "")
+	kafka_task_file := flags.String("kafka_task_file", "kafka_tasks.json", "")
+	strict := flags.Bool("strict", false, "exit non-zero on warnings too")
+	flags.Parse(args)
+
+	tasks := make(map[string][]base.BaseConfig)
+	for _, file := range []string{*snow_task_file, *kafka_task_file} {
+		fileTasks, err := getTasks(file)
+		if err != nil {
+			return 1
+		}
+
+		for app, appTasks := range fileTasks {
+			tasks[app] = append(tasks[app], appTasks...)
+		}
+	}
+
+	linter := &mgmt.TaskLinter{TaskKey: services.TaskKey, Topic: services.GenerateTopic}
+	failed := false
+	for _, issue := range linter.Lint(tasks) {
+		fmt.Println(issue)
+		if issue.Severity == mgmt.LintError || *strict {
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	fmt.Println("Task files are lint free")
+	return 0
+}
+
+func runCheckpoint(flags *flag.FlagSet, args []string) int {
+	task_file := flags.String("task", "", "task config file whose checkpoint is inspected")
+	key := flags.String("key", "", "overrides the checkpoint key derived from the task")
+	out := flags.String("out", "", "exports the checkpoint to the file instead of printing it")
+	globalConfig := parseCommand(flags, args)
+	if globalConfig == nil {
+		return 1
+	}
+
+	if *task_file == "" {
+		flags.PrintDefaults()
+		return 1
+	}
+
+	content, err := ioutil.ReadFile(*task_file)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", *task_file, err)
+		return 1
+	}
+
+	task := make(base.BaseConfig)
+	err = json.Unmarshal(content, &task)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", *task_file, err)
+		return 1
+	}
+
+	ckpt, err := services.GetTaskCheckpoint(globalConfig, task, *key)
+	if err != nil {
+		glog.Errorf("Failed to get the checkpoint of task in %s, error=%s", *task_file, err)
+		return 1
+	}
+
+	content, _ = json.MarshalIndent(ckpt, "", "    ")
+	if *out == "" {
+		fmt.Println(string(content))
+		return 0
+	}
+
+	err = ioutil.WriteFile(*out, content, 0644)
+	if err != nil {
+		glog.Errorf("Failed to write %s, error=%s", *out, err)
+		return 1
+	}
+	glog.Infof("Exported the checkpoint of key=%s to %s", ckpt.Key, *out)
+	return 0
+}
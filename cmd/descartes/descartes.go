@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/services"
+	"github.com/chenziliang/descartes/mgmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Overridden by the -config flag of the subcommands
+var globalSettingsFile = "global_settings.json"
+
+func getGlobalConfig(fileName string) (base.BaseConfig, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	configs := make(map[string]base.BaseConfig)
+	err = json.Unmarshal(content, &configs)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	globalConfig := make(map[string]string)
+	for _, config := range configs {
+		for k, v := range config {
+			globalConfig[k] = v
+		}
+	}
+
+	return globalConfig, nil
+}
+
+
+func getTasks(fileName string) (map[string][]base.BaseConfig, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	tasks := make(map[string][]base.BaseConfig)
+	err = json.Unmarshal(content, &tasks)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", fileName, err)
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// setupSignalHandler shall be called once the role is up, the service
+// manager is notified of the readiness, see service.go
+func setupSignalHandler() <-chan os.Signal {
+	c := serviceSignals
+	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGINT,
+                  syscall.SIGTERM, syscall.SIGQUIT)
+	notifyServiceReady()
+	return c
+}
+
+func handleDataCollection(globalConfig base.BaseConfig) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	collect := services.NewCollectService(config)
+	if collect == nil {
+		panic("Failed to create collect service")
+	}
+	collect.Start()
+
+	reload := func() (base.BaseConfig, error) {
+		newConfig, err := getGlobalConfig(globalSettingsFile)
+		if err != nil {
+			return nil, err
+		}
+		return collect.Reload(newConfig), nil
+	}
+
+	if config[base.MgmtListenAddress] != "" {
+		api := mgmt.NewAPIServer(config)
+		if api == nil {
+			panic("Failed to create management API server")
+		}
+		api.Handle("/jobs/history", mgmt.NewJobHistoryHandler(collect.JobHistory()))
+		api.HandleWithRole("/config/reload", mgmt.RoleOperator, mgmt.NewConfigReloadHandler(reload))
+		api.Handle("/jobs/state", mgmt.NewJobStateHandler(collect.JobStates()))
+		api.HandleWithRole("/apps", mgmt.RoleOperator, mgmt.NewAppCatalogHandler(collect.AppCatalog()))
+		api.Handle("/jobs/slo", mgmt.NewSLOHandler(collect.SLOReports))
+		api.Handle("/jobs/health", mgmt.NewJobHealthHandler(collect.JobHealth))
+		api.Handle("/tasks/config", mgmt.NewTaskConfigHandler(collect.EffectiveConfig))
+		api.Handle("/sinks/stats", mgmt.NewSinkStatsHandler(collect.SinkStats))
+		api.HandleWithRole("/tasks/preview", mgmt.RoleOperator, mgmt.NewTaskPreviewHandler(func(task base.BaseConfig, n int) ([]string, error) {
+			return services.Preview(config, task, n)
+		}))
+		api.HandleWithRoles("/checkpoints/history", mgmt.RoleOperator, mgmt.RoleOperator, mgmt.NewCheckpointHistoryHandler(
+			collect.CheckpointHistory(), collect.RollbackCheckpoint))
+		api.HandleWithRoles("/debug/dump", mgmt.RoleOperator, mgmt.RoleOperator, mgmt.NewStateDumpHandler(
+			func() interface{} { return collect.DumpState() }, collect.WriteStateDump))
+		api.HandleProfiling()
+		api.Start()
+		defer api.Stop()
+	}
+
+	c := setupSignalHandler()
+	// SIGHUP reloads the global configs without restarting the collectors,
+	// SIGQUIT dumps the in-memory state for debugging
+	for sig := range c {
+		if sig == syscall.SIGHUP {
+			reload()
+		} else if sig == syscall.SIGQUIT {
+			collect.WriteStateDump()
+		} else {
+			break
+		}
+	}
+
+	// tear down
+	stopService(config, collect.Stop)
+}
+
+// prepareSourceTask completes a task which collects from a source, for
+// e.g. snow tables, before it is published
+func prepareSourceTask(globalConfig, task base.BaseConfig) base.BaseConfig {
+	task[base.KafkaTopic] = services.GenerateTopic(task[base.App],
+	                        task[base.ServerURL], task[base.Username])
+	for k, v := range globalConfig {
+		task[k] = v
+	}
+	task[base.TaskConfigAction] = base.TaskConfigNew
+	task[base.TaskConfigKey] = services.TaskKey(task)
+	return task
+}
+
+// rejectConflictingTasks drops the tasks whose TaskConfigKey is taken by a
+// task with a different definition, and the duplicates of a task
+func rejectConflictingTasks(tasks []base.BaseConfig) []base.BaseConfig {
+	definitions := base.NewTaskDefinitions()
+	seen := make(map[string]bool)
+	var res []base.BaseConfig
+	for _, task := range tasks {
+		key := task[base.TaskConfigKey]
+		if key == "" {
+			// Kafka tasks get their keys per topic partition
+			res = append(res, task)
+			continue
+		}
+
+		if err := definitions.Register(key, task); err != nil {
+			glog.Errorf("Alert: reject task, error=%s", err)
+			continue
+		}
+
+		if seen[key] {
+			glog.Warningf("Skip duplicate task, TaskConfigKey=%s", key)
+			continue
+		}
+		seen[key] = true
+		res = append(res, task)
+	}
+	return res
+}
+
+func newTaskConfigWriter(globalConfig base.BaseConfig) *mgmt.TaskConfigWriter {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	config[base.KafkaTopic] = base.TaskConfig
+    config[base.Key] = base.TaskConfig
+
+	return mgmt.NewTaskConfigWriter(config)
+}
+
+func writeTaskConfigs(globalConfig base.BaseConfig, snow_task_file, kafka_task_file, task_template_file,
+	snow_ta_conf_dir, snow_ta_checkpoint_dir, snow_ta_password_file string) {
+	configWriter := newTaskConfigWriter(globalConfig)
+	configWriter.Start()
+	defer configWriter.Stop()
+
+	snowTasks, err := getTasks(snow_task_file)
+	if err != nil {
+		return
+	}
+
+	kafkaTasks, err := getTasks(kafka_task_file)
+	if err != nil {
+		return
+	}
+
+	var allTasks []base.BaseConfig
+	for _, tasks := range snowTasks {
+		for _, task := range tasks {
+			allTasks = append(allTasks, prepareSourceTask(globalConfig, task))
+		}
+	}
+
+	if task_template_file != "" {
+		templates, err := mgmt.LoadTaskTemplates(task_template_file)
+		if err != nil {
+			return
+		}
+
+		tasks, err := mgmt.ExpandTaskTemplates(templates)
+		if err != nil {
+			return
+		}
+
+		for _, task := range tasks {
+			allTasks = append(allTasks, prepareSourceTask(globalConfig, task))
+		}
+	}
+
+	if snow_ta_conf_dir != "" {
+		var passwords map[string]string
+		if snow_ta_password_file != "" {
+			passwords, err = mgmt.LoadSnowTAPasswords(snow_ta_password_file)
+			if err != nil {
+				return
+			}
+		}
+
+		tasks, err := mgmt.NewSnowTAImporter(snow_ta_conf_dir, snow_ta_checkpoint_dir, passwords).Import()
+		if err != nil {
+			return
+		}
+
+		for _, task := range tasks {
+			allTasks = append(allTasks, prepareSourceTask(globalConfig, task))
+		}
+	}
+
+	for _, tasks := range kafkaTasks {
+		for _, task := range tasks {
+			task[base.KafkaTopic] = services.GenerateTopic("snow",
+			                         task["SourceServerURL"], task["SourceUsername"])
+			for k, v := range globalConfig {
+				task[k] = v
+			}
+			task[base.TaskConfigAction] = base.TaskConfigNew
+			task[base.TaskConfigKey] = ""
+			allTasks = append(allTasks, task)
+		}
+	}
+	configWriter.Write(rejectConflictingTasks(allTasks))
+}
+
+func handleScheduling(globalConfig base.BaseConfig) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	schedule := services.NewScheduleService(config)
+	if schedule == nil {
+		panic("Failed to create schedule service")
+	}
+
+	schedule.Start()
+
+	if config[base.MgmtListenAddress] != "" {
+		configWriter := newTaskConfigWriter(globalConfig)
+		configWriter.Start()
+		defer configWriter.Stop()
+
+		publish := func(tasks []base.BaseConfig) ([]base.BaseConfig, error) {
+			for _, task := range tasks {
+				prepareSourceTask(globalConfig, task)
+			}
+			tasks = rejectConflictingTasks(tasks)
+			return tasks, configWriter.Write(tasks)
+		}
+
+		api := mgmt.NewAPIServer(config)
+		if api == nil {
+			panic("Failed to create management API server")
+		}
+		api.Handle("/tasks/template", mgmt.NewTaskTemplateHandler(publish))
+		api.Handle("/topics", mgmt.NewTopicRegistryHandler(schedule.TopicRegistry().List))
+		api.Handle("/assignments", mgmt.NewAssignmentHandler(schedule.AssignmentTable().List))
+		api.HandleProfiling()
+		api.Start()
+		defer api.Stop()
+	}
+
+	c := setupSignalHandler()
+	<-c
+
+	// tear down
+	stopService(config, schedule.Stop)
+}
+
+func handleSequenceAudit(globalConfig base.BaseConfig, topics string) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	auditor := services.NewSequenceAuditor(config, strings.Split(topics, ","))
+	if auditor == nil {
+		panic("Failed to create sequence auditor")
+	}
+	auditor.Start()
+
+	c := setupSignalHandler()
+	<-c
+
+	// tear down
+	stopService(config, auditor.Stop)
+}
+
+func handleForwarding(globalConfig base.BaseConfig) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	forward := services.NewForwardService(config)
+	if forward == nil {
+		panic("Failed to create forward service")
+	}
+	forward.Start()
+
+	c := setupSignalHandler()
+	<-c
+
+	// tear down
+	stopService(config, forward.Stop)
+}
+
+func handleRetries(globalConfig base.BaseConfig) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	retry := services.NewRetryService(config)
+	if retry == nil {
+		panic("Failed to create retry service")
+	}
+	retry.Start()
+
+	c := setupSignalHandler()
+	<-c
+
+	// tear down
+	stopService(config, retry.Stop)
+}
+
+func handleStatsExport(globalConfig base.BaseConfig) {
+	config := make(base.BaseConfig)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+
+	exporter := services.NewStatsExporter(config)
+	if exporter == nil {
+		panic("Failed to create stats exporter")
+	}
+	exporter.Start()
+
+	c := setupSignalHandler()
+	<-c
+
+	// tear down
+	stopService(config, exporter.Stop)
+}
+
+func runSelfTest(globalConfig base.BaseConfig, snow_task_file string) {
+	var sources []base.BaseConfig
+	snowTasks, err := getTasks(snow_task_file)
+	if err == nil {
+		for _, tasks := range snowTasks {
+			sources = append(sources, tasks...)
+		}
+	}
+
+	report := services.RunSelfTest(globalConfig, sources)
+	content, _ := json.MarshalIndent(report, "", "    ")
+	fmt.Println(string(content))
+	if !report.Passed {
+		glog.Flush()
+		os.Exit(1)
+	}
+}
+
+func runOnce(globalConfig base.BaseConfig, task_file, start, end string) {
+	content, err := ioutil.ReadFile(task_file)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", task_file, err)
+		os.Exit(1)
+	}
+
+	task := make(base.BaseConfig)
+	err = json.Unmarshal(content, &task)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", task_file, err)
+		os.Exit(1)
+	}
+
+	if start != "" {
+		task["NextRecordTime"] = start
+	}
+	if end != "" {
+		task["EndRecordTime"] = end
+	}
+
+	run, err := services.RunOnce(globalConfig, task)
+	if run != nil {
+		content, _ := json.MarshalIndent(run, "", "    ")
+		fmt.Println(string(content))
+	}
+
+	if err != nil {
+		glog.Errorf("Run once task in %s failed, error=%s", task_file, err)
+		glog.Flush()
+		os.Exit(1)
+	}
+}
+
+func main() {
+	startService()
+
+	// "descartes <command> [flags]", see commands.go. The -role flags are
+	// kept for the existing deployments
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	role := flag.String("role", "", "[task_scheduler|data_collector|mgmt|sequence_auditor|forwarder|retrier|stats_exporter]")
+	snow_task_file := flag.String("snow_task_file", "snow_tasks.json", "")
+	kafka_task_file := flag.String("kafka_task_file", "kafka_tasks.json", "")
+	task_template_file := flag.String("task_template_file", "", "task templates expanded into one task per table by mgmt")
+	snow_ta_conf_dir := flag.String("snow_ta_conf_dir", "", "local conf directory of Splunk Add-on for ServiceNow whose inputs are imported by mgmt")
+	snow_ta_checkpoint_dir := flag.String("snow_ta_checkpoint_dir", "", "checkpoint directory of Splunk Add-on for ServiceNow")
+	snow_ta_password_file := flag.String("snow_ta_password_file", "", "JSON object of account => password for the accounts encrypted by Splunk Add-on for ServiceNow")
+	audit_topics := flag.String("audit_topics", "", "comma separated data topics audited by sequence_auditor")
+	self_test := flag.Bool("self_test", false, "validate the pipeline before taking the role, exit non-zero on failure")
+	run_once_task := flag.String("run_once_task", "", "task config file collected for exactly one cycle, then exit")
+	run_once_start := flag.String("run_once_start", "", "overrides NextRecordTime of the run once task")
+	run_once_end := flag.String("run_once_end", "", "collects the records changed before it for the run once task")
+	flag.Parse()
+
+	if *role == "" && !*self_test && *run_once_task == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	globalConfig, err := getGlobalConfig(globalSettingsFile)
+	if err != nil {
+		return
+	}
+
+	if *run_once_task != "" {
+		runOnce(globalConfig, *run_once_task, *run_once_start, *run_once_end)
+		return
+	}
+
+	if *self_test {
+		runSelfTest(globalConfig, *snow_task_file)
+		if *role == "" {
+			return
+		}
+	}
+
+	if *role == "task_scheduler" {
+		handleScheduling(globalConfig)
+	} else if *role == "data_collector" {
+		handleDataCollection(globalConfig)
+	} else if *role == "mgmt" {
+	    writeTaskConfigs(globalConfig, *snow_task_file, *kafka_task_file, *task_template_file,
+	                 *snow_ta_conf_dir, *snow_ta_checkpoint_dir, *snow_ta_password_file)
+	} else if *role == "sequence_auditor" && *audit_topics != "" {
+		handleSequenceAudit(globalConfig, *audit_topics)
+	} else if *role == "forwarder" {
+		handleForwarding(globalConfig)
+	} else if *role == "retrier" {
+		handleRetries(globalConfig)
+	} else if *role == "stats_exporter" {
+		handleStatsExport(globalConfig)
+	} else {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	time.Sleep(2 * time.Second)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The service managers, systemd and the Windows service control manager,
+// kill the process which doesn't stop in time, 20 seconds on Windows shutdown
+const defaultStopTimeout = 20 * time.Second
+
+// serviceSignals carries the signals of the process and the stop requests of
+// the service manager, see setupSignalHandler
+var serviceSignals = make(chan os.Signal, 2)
+
+// stopService tears down within StopTimeout, the tear down is given up
+// before the service manager kills the process
+// @config: StopTimeout in seconds, 20 by default
+func stopService(config base.BaseConfig, teardown func()) {
+	timeout := defaultStopTimeout
+	if seconds, err := strconv.Atoi(config[base.StopTimeout]); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	notifyServiceStopping(timeout)
+
+	done := make(chan struct{})
+	go func() {
+		teardown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		glog.Errorf("Alert: gave up tearing down after %s", timeout)
+	}
+	notifyServiceStopped()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// startService is a no-op, systemd talks to the process by the signals and
+// NOTIFY_SOCKET only
+func startService() {
+}
+
+// notifyServiceReady notifies systemd of the readiness for Type=notify units
+// and starts pinging its watchdog if WatchdogSec is set
+func notifyServiceReady() {
+	if !sdNotify("READY=1") {
+		return
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+	glog.Infof("Pinging systemd watchdog every %s", time.Duration(usec)*time.Microsecond/2)
+}
+
+// notifyServiceStopping extends the stop timeout of systemd to the one of
+// the tear down
+func notifyServiceStopping(timeout time.Duration) {
+	sdNotify(fmt.Sprintf("STOPPING=1\nEXTEND_TIMEOUT_USEC=%d", timeout/time.Microsecond))
+}
+
+func notifyServiceStopped() {
+}
+
+// sdNotify sends state to NOTIFY_SOCKET, false if the process is not run by
+// systemd or the state is not sent
+func sdNotify(state string) bool {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false
+	}
+
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		glog.Errorf("Failed to connect to systemd notify socket=%s, error=%s", socket, err)
+		return false
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		glog.Errorf("Failed to notify systemd, error=%s", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import (
+	"time"
+)
+
+// The processes are managed by the signals only on the other platforms
+
+func startService() {
+}
+
+func notifyServiceReady() {
+}
+
+func notifyServiceStopping(timeout time.Duration) {
+}
+
+func notifyServiceStopped() {
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"golang.org/x/sys/windows/svc"
+	"syscall"
+	"time"
+)
+
+const serviceName = "descartes"
+
+// windowsService relays the state of the process to the service control
+// manager and its stop requests to serviceSignals
+type windowsService struct {
+	states chan svc.Status
+	done   chan struct{}
+}
+
+// service is nil if the process is not run by the service control manager
+var service *windowsService
+
+// startService connects to the service control manager, it shall be done
+// early since the manager fails the services which don't connect in 30s
+func startService() {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		glog.Errorf("Failed to detect Windows service, error=%s", err)
+		return
+	}
+
+	if !isService {
+		return
+	}
+
+	service = &windowsService{
+		states: make(chan svc.Status, 4),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		if err := svc.Run(serviceName, service); err != nil {
+			glog.Errorf("Failed to run Windows service, error=%s", err)
+		}
+		close(service.done)
+	}()
+}
+
+func (service *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	for {
+		select {
+		case state := <-service.states:
+			if state.State == svc.Stopped {
+				// svc.Run reports Stopped once Execute returns
+				return false, 0
+			}
+			status <- state
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				select {
+				case serviceSignals <- syscall.SIGTERM:
+				default:
+					// A stop is pending already
+				}
+			}
+		}
+	}
+}
+
+func notifyServiceReady() {
+	if service != nil {
+		service.states <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	}
+}
+
+// notifyServiceStopping asks the service control manager to wait for the
+// tear down
+func notifyServiceStopping(timeout time.Duration) {
+	if service != nil {
+		service.states <- svc.Status{State: svc.StopPending, WaitHint: uint32(timeout / time.Millisecond)}
+	}
+}
+
+// notifyServiceStopped waits for the service control manager to learn that
+// the service stopped, otherwise it takes the exit as a crash
+func notifyServiceStopped() {
+	if service == nil {
+		return
+	}
+
+	service.states <- svc.Status{State: svc.Stopped}
+	select {
+	case <-service.done:
+	case <-time.After(5 * time.Second):
+		glog.Errorf("Timed out reporting Windows service stopped")
+	}
+}
@@ -0,0 +1,247 @@
+// Package descartes embeds the collection in another Go program: a Pipeline
+// runs the ServiceNow reader of a task and writes the records to a sink in
+// process, see NewPipeline. Unlike the collect and schedule services, an
+// embedded pipeline needs neither Kafka nor ZooKeeper, the task is given by
+// the program instead of being scheduled, and the checkpoints are local
+// files by default
+package descartes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/api"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/blackhole"
+	"github.com/chenziliang/descartes/sinks/splunk"
+	"github.com/chenziliang/descartes/sources/snow"
+	"github.com/golang/glog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInterval            = 60 * time.Second
+	defaultCheckpointNamespace = "descartes"
+	// The data buffered by the sink is flushed within it when Run returns
+	flushTimeout = 30 * time.Second
+)
+
+// Options of a Pipeline, nil or the zero value for the defaults
+type Options struct {
+	// The sink instead of the TargetSystemType of sinkCfg if not nil
+	Writer api.DataWriter
+	// The checkpointer instead of the CheckpointMethod of sourceCfg if not nil
+	Checkpointer api.Checkpointer
+	// Called with the events of the reader, for e.g. the suspected gaps, the
+	// credential health, the catch ups and the quota warnings, by their
+	// topic, see base.DataGapTopic. nil if they are only logged
+	OnEvent func(topic string, event api.BaseConfig)
+}
+
+// Pipeline collects a snow task every Interval until its context is done
+type Pipeline struct {
+	key       string
+	reader    *snow.SnowDataReader
+	writer    *base.CountingDataWriter
+	interval  time.Duration
+	lifecycle base.Lifecycle
+}
+
+// NewPipeline returns the pipeline collecting the task of sourceCfg to the
+// sink of sinkCfg
+// @sourceCfg: the snow task, see snow.NewSnowDataReader, "App" shall be
+// "snow" if set. "Interval" in seconds (60 by default) between the
+// collection cycles. "CheckpointMethod" is "localfile" (by default), the
+// checkpoints are in "CheckpointDir" ("." by default), or "null", the task
+// is collected from its NextRecordTime every time the pipeline runs
+// @sinkCfg: "TargetSystemType" is "Splunk" or "Blackhole", with the settings
+// of the sink, see splunk.NewSplunkDataWriter. Ignored if opts.Writer is set
+func NewPipeline(sourceCfg, sinkCfg api.BaseConfig, opts *Options) (*Pipeline, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	config := make(base.BaseConfig, len(sourceCfg)+4)
+	for k, v := range sourceCfg {
+		config[k] = v
+	}
+
+	if app := config[base.App]; app != "" && app != "snow" {
+		return nil, errors.New(fmt.Sprintf("App=%s can't be embedded, only snow can", app))
+	}
+
+	interval := defaultInterval
+	if config[base.Interval] != "" {
+		seconds, err := strconv.Atoi(config[base.Interval])
+		if err != nil || seconds <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid %s=%s, expect positive seconds", base.Interval, config[base.Interval]))
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	keyParts := []string{"", config[base.ServerURL], config[base.Username], config[base.Metric]}
+	config[base.Key] = strings.Join(keyParts, "/")
+	if config[base.TaskConfigKey] == "" {
+		config[base.TaskConfigKey] = config[base.Key]
+	}
+
+	checkpoint, err := newCheckpointer(config, opts.Checkpointer)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newSink(sinkCfg, opts.Writer)
+	if err != nil {
+		return nil, err
+	}
+	writer := base.NewCountingDataWriter(base.NewSequencingDataWriter(sink, config[base.TaskConfigKey]))
+
+	reader := snow.NewSnowDataReader(config, writer, checkpoint)
+	if reader == nil {
+		return nil, errors.New(fmt.Sprintf("Failed to create the snow reader of %s/%s, see the log", config[base.ServerURL], config[base.Metric]))
+	}
+
+	// QuotaHourly and QuotaDaily count the requests of this pipeline only
+	quota := base.NewRequestQuota()
+	reader.SetRequestQuota(quota)
+	if opts.OnEvent != nil {
+		quota.OnWarning(func(warning *base.QuotaWarning) {
+			opts.OnEvent(base.QuotaWarningTopic, warning.Event())
+		})
+		for _, gap := range reader.Gaps() {
+			opts.OnEvent(base.DataGapTopic, gap.Event())
+		}
+		reader.OnGap(func(gap *base.TimeGap) {
+			opts.OnEvent(base.DataGapTopic, gap.Event())
+		})
+		reader.OnCredentialHealth(func(health *base.CredentialHealth) {
+			opts.OnEvent(base.CredentialHealthTopic, health.Event())
+		})
+		reader.OnCatchUp(func(catchUp *base.CatchUp) {
+			opts.OnEvent(base.CatchUpTopic, catchUp.Event())
+		})
+	}
+
+	return &Pipeline{
+		key:      config[base.TaskConfigKey],
+		reader:   reader,
+		writer:   writer,
+		interval: interval,
+	}, nil
+}
+
+// newCheckpointer returns checkpoint if it is not nil, otherwise the local
+// file or the null checkpointer of config
+func newCheckpointer(config base.BaseConfig, checkpoint base.Checkpointer) (base.Checkpointer, error) {
+	if checkpoint != nil {
+		return checkpoint, nil
+	}
+
+	switch config[base.CheckpointMethod] {
+	case "", "localfile":
+		if config[base.CheckpointDir] == "" {
+			config[base.CheckpointDir] = "."
+		}
+		if config[base.CheckpointNamespace] == "" {
+			config[base.CheckpointNamespace] = defaultCheckpointNamespace
+		}
+		if config[base.CheckpointKey] == "" {
+			// The file name of the checkpoint
+			config[base.CheckpointKey] = url.QueryEscape(config[base.Key])
+		}
+		return base.NewVerifiedCheckpointer(base.NewFileCheckpointer(), base.GetCheckpointVersions(config)), nil
+	case "null":
+		return base.NewNullCheckpointer(), nil
+	}
+	return nil, errors.New(fmt.Sprintf("%s=%s can't be embedded, expect localfile, null or Options.Checkpointer",
+		base.CheckpointMethod, config[base.CheckpointMethod]))
+}
+
+// newSink returns writer if it is not nil, otherwise the TargetSystemType
+// sink of config, shaped by SinkRecordRate and SinkByteRate
+func newSink(config base.BaseConfig, writer base.DataWriter) (base.DataWriter, error) {
+	if writer != nil {
+		return writer, nil
+	}
+
+	switch config[base.TargetSystemType] {
+	case base.Splunk:
+		writer = splunk.NewSplunkDataWriter(config)
+		if writer == nil {
+			return nil, errors.New("Failed to create the Splunk sink, see the log")
+		}
+	case base.Blackhole:
+		writer = blackhole.NewBlackholeDataWriter(config)
+	default:
+		return nil, errors.New(fmt.Sprintf("%s=%s can't be embedded, expect %s, %s or Options.Writer",
+			base.TargetSystemType, config[base.TargetSystemType], base.Splunk, base.Blackhole))
+	}
+	return base.NewThrottledDataWriter(writer, config), nil
+}
+
+// Run starts the pipeline, collects a cycle right away and then every
+// Interval until ctx is done. The cycle in progress is canceled then, and the
+// data buffered by the sink is flushed before the pipeline stops. Run returns
+// ctx.Err() then, or the configuration error which failed a cycle, for e.g.
+// the credentials rejected, the later cycles would fail the same way. The
+// other failures are logged and the cycle is retried after Interval. A
+// pipeline runs once
+func (p *Pipeline) Run(ctx context.Context) error {
+	if err := p.lifecycle.Start("Pipeline"); err != nil {
+		return err
+	}
+
+	p.reader.Start()
+	defer p.stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.reader.Cancel()
+		case <-done:
+		}
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		err := base.CallSafely(p.key, p.reader.IndexData)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if base.IsConfigError(err) {
+			glog.Errorf("Alert: pipeline of %s failed on a configuration error, error=%s", p.key, err)
+			return err
+		} else if err != nil && err != base.ErrSkipped {
+			glog.Errorf("Failed to collect %s, retry in %s, error=%s", p.key, p.interval, err)
+		}
+		timer.Reset(p.interval)
+	}
+}
+
+func (p *Pipeline) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := base.FlushDataWriter(ctx, p.writer); err != nil {
+		glog.Errorf("Failed to flush the sink of %s, error=%s", p.key, err)
+	}
+	p.reader.Stop()
+	p.lifecycle.Stop("Pipeline")
+}
+
+// Stats returns the records and the bytes the pipeline has written
+func (p *Pipeline) Stats() (int64, int64) {
+	return p.writer.Stats()
+}
@@ -0,0 +1,113 @@
+package descartes
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `{"records":[{"sys_id":"1","sys_updated_on":"2015-06-01 08:00:01"},{"sys_id":"2","sys_updated_on":"2015-06-01 08:00:02"}]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := base.BaseConfig{
+		base.ServerURL:        server.URL,
+		base.Username:         "admin",
+		base.Password:         "admin",
+		base.Metric:           "incident",
+		"TimestampField":      "sys_updated_on",
+		"NextRecordTime":      "2015-06-01 08:00:00",
+		"RecordCount":         "100",
+		base.CheckpointDir:    dir,
+		base.CheckpointMethod: "localfile",
+	}
+
+	writer := memory.NewMemoryDataWriter()
+	pipeline, err := NewPipeline(source, nil, &Options{Writer: writer})
+	if err != nil {
+		t.Fatalf("Failed to create pipeline, error=%s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- pipeline.Run(ctx)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-writer.Data():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expect 2 records written, got %d", i)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expect the pipeline stopped by its context, got %v", err)
+	}
+
+	if records, _ := pipeline.Stats(); records != 2 {
+		t.Errorf("Expect 2 records counted, got %d", records)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.ck")); len(files) == 0 {
+		t.Errorf("Expect the checkpoint in %s", dir)
+	}
+
+	if err := pipeline.Run(context.Background()); err != base.ErrAlreadyStopped {
+		t.Errorf("Expect a pipeline to run once, got %v", err)
+	}
+
+	// The rejected credentials fail the pipeline instead of being retried
+	status = http.StatusUnauthorized
+	source[base.CheckpointMethod] = "null"
+	pipeline, err = NewPipeline(source, nil, &Options{Writer: memory.NewMemoryDataWriter()})
+	if err != nil {
+		t.Fatalf("Failed to create pipeline, error=%s", err)
+	}
+
+	if err := pipeline.Run(context.Background()); !base.IsConfigError(err) {
+		t.Errorf("Expect the configuration error returned, got %v", err)
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{base.App: base.KafkaApp},
+		{base.Interval: "0"},
+		{base.CheckpointMethod: "zookeeper"},
+	} {
+		if _, err := NewPipeline(bad, base.BaseConfig{base.TargetSystemType: base.Blackhole}, nil); err == nil {
+			t.Errorf("Expect %v rejected", bad)
+		}
+	}
+
+	if _, err := NewPipeline(source, base.BaseConfig{base.TargetSystemType: "Kafka"}, nil); err == nil {
+		t.Errorf("Expect the Kafka sink rejected")
+	}
+}
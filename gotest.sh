@@ -10,6 +10,18 @@ cd sinks/kafka
 go fmt *.go && go test
 cd ../..
 
+cd sinks/blackhole
+go fmt *.go && go test
+cd ../..
+
+cd sinks/failover
+go fmt *.go && go test
+cd ../..
+
+cd sinks/spool
+go fmt *.go && go test
+cd ../..
+
 cd sources/snow
 go fmt *.go && go test
 cd ../..
@@ -17,3 +29,17 @@ cd ../..
 cd sources/kafka
 go fmt *.go && go test
 cd ../..
+
+cd sources/subprocess
+go fmt *.go && go test
+cd ../..
+
+cd mgmt
+go fmt *.go && go test
+cd ..
+
+cd api
+go fmt *.go && go test
+cd ..
+
+go fmt *.go && go test
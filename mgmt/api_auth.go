@@ -0,0 +1,142 @@
+package mgmt
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var (
+	// roleLevels orders the roles, a role is granted what the lower ones are
+	roleLevels = map[string]int{
+		RoleViewer:   1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+
+	// auditf logs the audit records, replaced in tests
+	auditf = glog.Infof
+)
+
+// APIToken is a bearer token of the management API
+type APIToken struct {
+	Name  string // who owns the token, for e.g. "dashboard", logged on audit
+	Token string
+	Role  string
+}
+
+// LoadAPITokens reads the tokens from fileName, which contains a non-empty
+// JSON list of APIToken
+func LoadAPITokens(fileName string) ([]APIToken, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	var tokens []APIToken
+	err = json.Unmarshal(content, &tokens)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	// An empty list would silently leave the API open
+	if len(tokens) == 0 {
+		glog.Errorf("No API token in %s", fileName)
+		return nil, errors.New(fmt.Sprintf("No API token in %s", fileName))
+	}
+
+	for _, token := range tokens {
+		if token.Token == "" || roleLevels[token.Role] == 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid token=%s with role=%s in %s", token.Name, token.Role, fileName))
+		}
+	}
+	return tokens, nil
+}
+
+// authorizer authenticates the bearer token of the requests and checks its
+// role against the role required by the handler. Requests which change
+// anything are audit logged whatever the outcome is
+type authorizer struct {
+	tokens   []APIToken
+	readRole string // required by the GET/HEAD requests
+	role     string // required by the other requests
+	handler  http.Handler
+}
+
+func (auth *authorizer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	required := auth.role
+	readOnly := req.Method == "GET" || req.Method == "HEAD"
+	if readOnly {
+		required = auth.readRole
+	}
+
+	token := auth.authenticate(req)
+	if token == nil {
+		audit(req, nil, http.StatusUnauthorized)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Invalid or missing API token", http.StatusUnauthorized)
+		return
+	}
+
+	if roleLevels[token.Role] < roleLevels[required] {
+		audit(req, token, http.StatusForbidden)
+		http.Error(w, fmt.Sprintf("Role=%s is required", required), http.StatusForbidden)
+		return
+	}
+
+	if readOnly {
+		auth.handler.ServeHTTP(w, req)
+		return
+	}
+
+	rw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	auth.handler.ServeHTTP(rw, req)
+	audit(req, token, rw.status)
+}
+
+func (auth *authorizer) authenticate(req *http.Request) *APIToken {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil
+	}
+
+	given := []byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	for i := range auth.tokens {
+		if subtle.ConstantTimeCompare(given, []byte(auth.tokens[i].Token)) == 1 {
+			return &auth.tokens[i]
+		}
+	}
+	return nil
+}
+
+func audit(req *http.Request, token *APIToken, status int) {
+	name, role := "-", "-"
+	if token != nil {
+		name, role = token.Name, token.Role
+	}
+	auditf("Audit: token=%s role=%s remote=%s method=%s uri=%s status=%d",
+		name, role, req.RemoteAddr, req.Method, req.URL.RequestURI(), status)
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,119 @@
+package mgmt
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestAPIServer() *APIServer {
+	tokens := []APIToken{
+		{Name: "dashboard", Token: "viewer-token", Role: RoleViewer},
+		{Name: "oncall", Token: "operator-token", Role: RoleOperator},
+		{Name: "deployer", Token: "admin-token", Role: RoleAdmin},
+	}
+
+	server := &APIServer{
+		config: base.BaseConfig{base.MgmtListenAddress: "127.0.0.1:0"},
+		mux:    http.NewServeMux(),
+		tokens: tokens,
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	server.Handle("/admin", ok)
+	server.HandleWithRole("/reload", RoleOperator, ok)
+	server.HandleWithRoles("/dump", RoleOperator, RoleOperator, ok)
+	return server
+}
+
+func TestAuthorizer(t *testing.T) {
+	var audits []string
+	origAuditf := auditf
+	auditf = func(format string, args ...interface{}) {
+		audits = append(audits, fmt.Sprintf(format, args...))
+	}
+	defer func() { auditf = origAuditf }()
+
+	server := newTestAPIServer()
+	cases := []struct {
+		method string
+		path   string
+		token  string
+		status int
+		audit  string
+	}{
+		{"GET", "/admin", "", http.StatusUnauthorized, ""},
+		{"POST", "/admin", "", http.StatusUnauthorized, "token=- role=- "},
+		{"POST", "/admin", "bad-token", http.StatusUnauthorized, "token=- role=- "},
+		{"GET", "/admin", "viewer-token", http.StatusOK, ""},
+		{"POST", "/admin", "viewer-token", http.StatusForbidden, "token=dashboard role=viewer "},
+		{"POST", "/admin", "operator-token", http.StatusForbidden, "token=oncall role=operator "},
+		{"POST", "/admin", "admin-token", http.StatusOK, "token=deployer role=admin "},
+		{"POST", "/reload", "viewer-token", http.StatusForbidden, "token=dashboard role=viewer "},
+		{"POST", "/reload", "operator-token", http.StatusOK, "token=oncall role=operator "},
+		{"POST", "/reload", "admin-token", http.StatusOK, "token=deployer role=admin "},
+		{"GET", "/dump", "viewer-token", http.StatusForbidden, "token=dashboard role=viewer "},
+		{"GET", "/dump", "operator-token", http.StatusOK, ""},
+	}
+
+	for _, c := range cases {
+		audits = audits[:0]
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		rec := httptest.NewRecorder()
+		server.mux.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s %s with token=%q, expect status=%d, got %d", c.method, c.path, c.token, c.status, rec.Code)
+		}
+
+		if c.audit == "" {
+			continue
+		}
+
+		if len(audits) != 1 || !strings.Contains(audits[0], c.audit) ||
+			!strings.Contains(audits[0], fmt.Sprintf("status=%d", c.status)) {
+			t.Errorf("%s %s with token=%q, expect one audit record with %q, got %v", c.method, c.path, c.token, c.audit, audits)
+		}
+	}
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	cases := []struct {
+		content string
+		valid   bool
+	}{
+		{`[{"Name": "dashboard", "Token": "t1", "Role": "viewer"}]`, true},
+		{`[]`, false},
+		{`null`, false},
+		{`[{"Name": "dashboard", "Token": "", "Role": "viewer"}]`, false},
+		{`[{"Name": "dashboard", "Token": "t1", "Role": "root"}]`, false},
+		{`{`, false},
+	}
+
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "tokens")
+		if err != nil {
+			t.Fatalf("Failed to create temp file, error=%s", err)
+		}
+		f.WriteString(c.content)
+		f.Close()
+
+		tokens, err := LoadAPITokens(f.Name())
+		os.Remove(f.Name())
+		if c.valid && (err != nil || len(tokens) != 1) {
+			t.Errorf("Expect tokens loaded from %s, got error=%v", c.content, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("Expect error for tokens=%s", c.content)
+		}
+	}
+}
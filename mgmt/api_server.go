@@ -0,0 +1,109 @@
+package mgmt
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net"
+	"net/http"
+)
+
+// APIServer is the HTTP management API of the collector/scheduler process
+type APIServer struct {
+	config    base.BaseConfig
+	mux       *http.ServeMux
+	tokens    []APIToken
+	listener  net.Listener
+	lifecycle base.Lifecycle
+}
+
+// NewAPIServer
+// @config: contains base.MgmtListenAddress, for e.g. "127.0.0.1:8088", and
+// optionally base.MgmtTokensFile, see LoadAPITokens. With tokens, requests
+// shall carry "Authorization: Bearer <token>", otherwise the API is open
+func NewAPIServer(config base.BaseConfig) *APIServer {
+	if config[base.MgmtListenAddress] == "" {
+		glog.Errorf("%s is required to create APIServer", base.MgmtListenAddress)
+		return nil
+	}
+
+	var tokens []APIToken
+	if config[base.MgmtTokensFile] != "" {
+		var err error
+		tokens, err = LoadAPITokens(config[base.MgmtTokensFile])
+		if err != nil {
+			return nil
+		}
+	}
+
+	return &APIServer{
+		config: config,
+		mux:    http.NewServeMux(),
+		tokens: tokens,
+	}
+}
+
+// Handle registers handler for the pattern, shall be called before Start.
+// GET/HEAD requests require RoleViewer, the others RoleAdmin
+func (server *APIServer) Handle(pattern string, handler http.Handler) {
+	server.HandleWithRole(pattern, RoleAdmin, handler)
+}
+
+// HandleWithRole is Handle with role required by the requests other than
+// GET/HEAD
+func (server *APIServer) HandleWithRole(pattern string, role string, handler http.Handler) {
+	server.HandleWithRoles(pattern, RoleViewer, role, handler)
+}
+
+// HandleWithRoles is Handle with readRole required by the GET/HEAD requests
+// and role by the others, for e.g. when reading exposes internal state
+func (server *APIServer) HandleWithRoles(pattern string, readRole string, role string, handler http.Handler) {
+	if len(server.tokens) > 0 {
+		handler = &authorizer{
+			tokens:   server.tokens,
+			readRole: readRole,
+			role:     role,
+			handler:  handler,
+		}
+	}
+	server.mux.Handle(pattern, handler)
+}
+
+func (server *APIServer) Start() {
+	if server.lifecycle.Start("APIServer") != nil {
+		return
+	}
+
+	// IPv6 literals shall be bracketed, for e.g. "[::1]:8080", which are
+	// only listened on with IPFamily "ipv6" or not set
+	listener, err := net.Listen(base.IPNetwork(server.config, "tcp"), server.config[base.MgmtListenAddress])
+	if err != nil {
+		glog.Errorf("Failed to listen on %s, error=%s", server.config[base.MgmtListenAddress], err)
+		server.lifecycle.Stop("APIServer")
+		return
+	}
+	server.listener = listener
+	if len(server.tokens) == 0 {
+		glog.Warningf("APIServer on %s is not protected, %s is not configured", server.config[base.MgmtListenAddress], base.MgmtTokensFile)
+	}
+
+	go func() {
+		err := http.Serve(listener, server.mux)
+		if err != nil && server.lifecycle.Running() {
+			glog.Errorf("APIServer encounter error=%s", err)
+		}
+	}()
+	glog.Infof("APIServer started on %s...", server.config[base.MgmtListenAddress])
+}
+
+func (server *APIServer) Stop() {
+	if server.lifecycle.Stop("APIServer") != nil {
+		return
+	}
+
+	server.listener.Close()
+	glog.Infof("APIServer stopped...")
+}
+
+func (server *APIServer) Status() string {
+	return server.lifecycle.Status()
+}
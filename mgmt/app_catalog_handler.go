@@ -0,0 +1,57 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// AppCatalog is implemented by services.JobFactory
+type AppCatalog interface {
+	AppCatalog() map[string]bool
+	SetAppEnabled(app string, enabled bool) error
+}
+
+// AppCatalogHandler serves the apps registered on the collector.
+// GET returns whether each of them is enabled. POST app=<app>&enabled=<0|1>
+// enables or disables the app until the next reload of EnabledApps or
+// DisabledApps, the tasks of the disabled apps are rejected
+type AppCatalogHandler struct {
+	catalog AppCatalog
+}
+
+func NewAppCatalogHandler(catalog AppCatalog) *AppCatalogHandler {
+	return &AppCatalogHandler{
+		catalog: catalog,
+	}
+}
+
+func (handler *AppCatalogHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+	case "POST":
+		app, enabled := req.FormValue("app"), req.FormValue("enabled")
+		if app == "" || (enabled != "0" && enabled != "1") {
+			http.Error(w, "app and enabled of 0 or 1 are required", http.StatusBadRequest)
+			return
+		}
+
+		if err := handler.catalog.SetAppEnabled(app, enabled == "1"); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method=%s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	content, err := json.Marshal(handler.catalog.AppCatalog())
+	if err != nil {
+		glog.Errorf("Failed to marshal app catalog, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,45 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeAppCatalog map[string]bool
+
+func (catalog fakeAppCatalog) AppCatalog() map[string]bool {
+	return catalog
+}
+
+func (catalog fakeAppCatalog) SetAppEnabled(app string, enabled bool) error {
+	if _, ok := catalog[app]; !ok {
+		return errors.New("not registered")
+	}
+	catalog[app] = enabled
+	return nil
+}
+
+func TestAppCatalogHandler(t *testing.T) {
+	handler := NewAppCatalogHandler(fakeAppCatalog{"snow": true, "kafka": true})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/apps?app=kafka&enabled=0", nil))
+	var res map[string]bool
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || !res["snow"] || res["kafka"] {
+		t.Errorf("Expect kafka disabled, got=%s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/apps?app=splunk&enabled=1", nil))
+	if w.Code != 404 {
+		t.Errorf("Expect 404 for the app not registered, got=%d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/apps?app=snow", nil))
+	if w.Code != 400 {
+		t.Errorf("Expect 400 without enabled, got=%d", w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"sort"
+)
+
+// AssignmentHandler serves the desired assignments of the tasks to the
+// collector hosts. GET ?host=<Host>&key=<TaskConfigKey> returns the
+// assignments to the host or of the task, without them it returns all of
+// them, ordered by TaskConfigKey
+type AssignmentHandler struct {
+	assignments func() ([]*base.Assignment, error)
+}
+
+func NewAssignmentHandler(assignments func() ([]*base.Assignment, error)) *AssignmentHandler {
+	return &AssignmentHandler{
+		assignments: assignments,
+	}
+}
+
+func (handler *AssignmentHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	assignments, err := handler.assignments()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	host, key := req.URL.Query().Get("host"), req.URL.Query().Get("key")
+	res := []*base.Assignment{}
+	for _, assignment := range assignments {
+		if (host != "" && assignment.Host != host) || (key != "" && assignment.TaskConfigKey != key) {
+			continue
+		}
+		res = append(res, assignment)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].TaskConfigKey < res[j].TaskConfigKey })
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal task assignments, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,53 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAssignmentHandler(t *testing.T) {
+	assignments := []*base.Assignment{
+		{TaskConfigKey: "incident", App: "snow", Host: "collector2"},
+		{TaskConfigKey: "change_request", App: "snow", Host: "collector1"},
+		{TaskConfigKey: "problem", App: "snow", Host: "collector1"},
+	}
+	var failure error
+	handler := NewAssignmentHandler(func() ([]*base.Assignment, error) {
+		return assignments, failure
+	})
+
+	cases := map[string]int{
+		"":                3,
+		"host=collector1": 2,
+		"key=incident":    1,
+		"host=collector3": 0,
+	}
+	for query, expected := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/assignments?"+query, nil))
+
+		var res []base.Assignment
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res) != expected {
+			t.Errorf("Expect %d assignments for query=%s, got=%s", expected, query, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/assignments?host=collector1", nil))
+	var res []base.Assignment
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if len(res) != 2 || res[0].TaskConfigKey != "change_request" || res[1].TaskConfigKey != "problem" {
+		t.Errorf("Expect the assignments ordered by TaskConfigKey, got=%s", w.Body.String())
+	}
+
+	failure = errors.New("ZooKeeper is down")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/assignments", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expect %d when the assignments are unavailable, got=%d", http.StatusServiceUnavailable, w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"time"
+)
+
+// CheckpointHistoryHandler serves the checkpoint transitions of the jobs.
+// GET ?task=<TaskConfigKey> returns the checkpoint keys with history, of the
+// task if it is set. GET ?key=<checkpoint key> returns the transitions of the
+// checkpoint, optionally between "from" and "to" in RFC3339 format.
+// POST key=<checkpoint key>&time=<RFC3339> rolls the checkpoint back to the
+// time, the response carries the transition rolled back to
+type CheckpointHistoryHandler struct {
+	history  *base.CheckpointHistory
+	rollback func(key string, at time.Time) (*base.CheckpointTransition, error)
+}
+
+func NewCheckpointHistoryHandler(history *base.CheckpointHistory,
+	rollback func(key string, at time.Time) (*base.CheckpointTransition, error)) *CheckpointHistoryHandler {
+	return &CheckpointHistoryHandler{
+		history:  history,
+		rollback: rollback,
+	}
+}
+
+func (handler *CheckpointHistoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var res interface{}
+	switch req.Method {
+	case "GET":
+		key := req.FormValue("key")
+		if key == "" {
+			res = map[string][]string{"Keys": handler.history.Keys(req.FormValue("task"))}
+			break
+		}
+
+		from, ferr := parseHistoryTime(req.FormValue("from"))
+		to, terr := parseHistoryTime(req.FormValue("to"))
+		if ferr != nil || terr != nil {
+			http.Error(w, "Invalid from or to, expect RFC3339 format", http.StatusBadRequest)
+			return
+		}
+
+		transitions := handler.history.Transitions(key, from, to)
+		if transitions == nil {
+			transitions = []base.CheckpointTransition{}
+		}
+		res = map[string]interface{}{"Key": key, "Transitions": transitions}
+	case "POST":
+		key := req.FormValue("key")
+		at, err := parseHistoryTime(req.FormValue("time"))
+		if key == "" || at.IsZero() || err != nil {
+			http.Error(w, "key and time in RFC3339 format are required", http.StatusBadRequest)
+			return
+		}
+
+		transition, err := handler.rollback(key, at)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, base.ErrCheckpointHistoryNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		res = transition
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method=%s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal checkpoint history, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+// parseHistoryTime returns the zero time for an empty value
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
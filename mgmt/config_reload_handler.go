@@ -0,0 +1,42 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// ConfigReloadHandler triggers a reload of the global configs.
+// POST returns the changed configs in JSON
+type ConfigReloadHandler struct {
+	reload func() (base.BaseConfig, error)
+}
+
+func NewConfigReloadHandler(reload func() (base.BaseConfig, error)) *ConfigReloadHandler {
+	return &ConfigReloadHandler{
+		reload: reload,
+	}
+}
+
+func (handler *ConfigReloadHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	diff, err := handler.reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content, err := json.Marshal(diff)
+	if err != nil {
+		glog.Errorf("Failed to marshal reloaded configs, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,54 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+type jobHealthSummary struct {
+	Instances map[string]int
+	Jobs      []base.JobHealth
+}
+
+// JobHealthHandler serves the health scores of the jobs and their instances.
+// GET ?key=<TaskConfigKey> returns the score of the job, without key it
+// returns those of all jobs
+type JobHealthHandler struct {
+	health func() []base.JobHealth
+}
+
+func NewJobHealthHandler(health func() []base.JobHealth) *JobHealthHandler {
+	return &JobHealthHandler{
+		health: health,
+	}
+}
+
+func (handler *JobHealthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	healths := handler.health()
+	key := req.URL.Query().Get("key")
+	summary := &jobHealthSummary{
+		Instances: base.AggregateInstanceHealth(healths),
+		Jobs:      []base.JobHealth{},
+	}
+	for _, health := range healths {
+		if key == "" || health.Key == key {
+			summary.Jobs = append(summary.Jobs, health)
+		}
+	}
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		glog.Errorf("Failed to marshal job health, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
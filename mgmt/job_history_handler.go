@@ -0,0 +1,86 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLastErrors = 10
+)
+
+type jobHistorySummary struct {
+	Key         string
+	LastRun     *base.JobRun
+	LastSuccess *base.JobRun
+	LastErrors  []base.JobRun
+	Runs        []base.JobRun `json:",omitempty"`
+}
+
+// JobHistoryHandler serves the job run history.
+// GET ?key=<TaskConfigKey>&errors=<N> returns the runs and the last N errors
+// of the job, without key it returns the summary of all jobs
+type JobHistoryHandler struct {
+	history *base.JobHistory
+}
+
+func NewJobHistoryHandler(history *base.JobHistory) *JobHistoryHandler {
+	return &JobHistoryHandler{
+		history: history,
+	}
+}
+
+func (handler *JobHistoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lastErrors := defaultLastErrors
+	if n := req.URL.Query().Get("errors"); n != "" {
+		var err error
+		lastErrors, err = strconv.Atoi(n)
+		if err != nil {
+			http.Error(w, "errors is expected as a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var res interface{}
+	if key := req.URL.Query().Get("key"); key != "" {
+		summary := handler.summarize(key, lastErrors)
+		summary.Runs = handler.history.Runs(key)
+		res = summary
+	} else {
+		var summaries []*jobHistorySummary
+		for _, key := range handler.history.Keys() {
+			summaries = append(summaries, handler.summarize(key, lastErrors))
+		}
+		res = summaries
+	}
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal job history, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+func (handler *JobHistoryHandler) summarize(key string, lastErrors int) *jobHistorySummary {
+	summary := &jobHistorySummary{
+		Key:         key,
+		LastSuccess: handler.history.LastSuccess(key),
+		LastErrors:  handler.history.LastErrors(key, lastErrors),
+	}
+
+	if runs := handler.history.Runs(key); len(runs) > 0 {
+		summary.LastRun = &runs[len(runs)-1]
+	}
+	return summary
+}
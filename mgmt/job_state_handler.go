@@ -0,0 +1,53 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// JobStates is implemented by services.JobFactory
+type JobStates interface {
+	DegradedJobs() []string
+	ConfigErrors() []base.NegativeCacheEntry
+}
+
+type jobStateSummary struct {
+	Degraded     []string
+	ConfigErrors []base.NegativeCacheEntry
+}
+
+// JobStateHandler serves the jobs which are not healthy.
+// GET returns the degraded jobs and the jobs failing on configuration errors
+// with their next re-check time
+type JobStateHandler struct {
+	states JobStates
+}
+
+func NewJobStateHandler(states JobStates) *JobStateHandler {
+	return &JobStateHandler{
+		states: states,
+	}
+}
+
+func (handler *JobStateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summary := &jobStateSummary{
+		Degraded:     handler.states.DegradedJobs(),
+		ConfigErrors: handler.states.ConfigErrors(),
+	}
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		glog.Errorf("Failed to marshal job states, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
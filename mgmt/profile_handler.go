@@ -0,0 +1,161 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCPUProfileDuration = 30 * time.Second
+	maxCPUProfileDuration     = 10 * time.Minute
+)
+
+// HandleProfiling registers net/http/pprof under /debug/pprof/ and
+// ProfileCaptureHandler on /debug/profile, both require RoleOperator since
+// profiles reveal the internals of the process. They are not registered if
+// MgmtTokensFile is not configured
+func (server *APIServer) HandleProfiling() {
+	if len(server.tokens) == 0 {
+		glog.Errorf("Profiling is not served, it requires %s to be configured", base.MgmtTokensFile)
+		return
+	}
+
+	server.HandleWithRoles("/debug/pprof/", RoleOperator, RoleOperator, http.HandlerFunc(pprof.Index))
+	server.HandleWithRoles("/debug/pprof/cmdline", RoleOperator, RoleOperator, http.HandlerFunc(pprof.Cmdline))
+	server.HandleWithRoles("/debug/pprof/profile", RoleOperator, RoleOperator, http.HandlerFunc(pprof.Profile))
+	server.HandleWithRoles("/debug/pprof/symbol", RoleOperator, RoleOperator, http.HandlerFunc(pprof.Symbol))
+	server.HandleWithRoles("/debug/pprof/trace", RoleOperator, RoleOperator, http.HandlerFunc(pprof.Trace))
+	server.HandleWithRoles("/debug/profile", RoleOperator, RoleOperator, NewProfileCaptureHandler(server.config))
+}
+
+// ProfileCaptureHandler captures a profile of the process to a file in
+// DumpDir for later analysis with "go tool pprof". POST with "type=cpu" and
+// optionally "seconds" (30 by default) starts a CPU profile in the
+// background, "type=heap" writes a heap profile right away. The response
+// carries the file name
+type ProfileCaptureHandler struct {
+	dir string
+}
+
+// NewProfileCaptureHandler
+// @config: DumpDir, the temp directory by default
+func NewProfileCaptureHandler(config base.BaseConfig) *ProfileCaptureHandler {
+	dir := config[base.DumpDir]
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	return &ProfileCaptureHandler{
+		dir: dir,
+	}
+}
+
+func (handler *ProfileCaptureHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		fileName string
+		status   int
+		err      error
+	)
+
+	switch profile := req.FormValue("type"); profile {
+	case "cpu":
+		duration := defaultCPUProfileDuration
+		if seconds := req.FormValue("seconds"); seconds != "" {
+			n, perr := strconv.Atoi(seconds)
+			if perr != nil || n <= 0 || time.Duration(n)*time.Second > maxCPUProfileDuration {
+				http.Error(w, fmt.Sprintf("Invalid seconds=%s, expect 1 to %d", seconds, int(maxCPUProfileDuration.Seconds())), http.StatusBadRequest)
+				return
+			}
+			duration = time.Duration(n) * time.Second
+		}
+		fileName, status, err = handler.captureCPU(duration)
+	case "heap":
+		fileName, status, err = handler.captureHeap()
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported profile type=%s, expect cpu or heap", profile), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	content, err := json.Marshal(map[string]string{"File": fileName})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func (handler *ProfileCaptureHandler) newFile(profile string) (*os.File, error) {
+	host, _ := os.Hostname()
+	fileName := filepath.Join(handler.dir, fmt.Sprintf("descartes_%s_%s_%d.pprof", profile, host, time.Now().UnixNano()))
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		glog.Errorf("Failed to create profile file=%s, error=%s", fileName, err)
+	}
+	return f, err
+}
+
+// captureCPU returns once the profile started, it is written to the file
+// when duration has passed. Only one CPU profile can run at a time
+func (handler *ProfileCaptureHandler) captureCPU(duration time.Duration) (string, int, error) {
+	f, err := handler.newFile("cpu")
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	err = runtimepprof.StartCPUProfile(f)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		glog.Errorf("Failed to start CPU profile, error=%s", err)
+		return "", http.StatusConflict, err
+	}
+
+	go func() {
+		time.Sleep(duration)
+		runtimepprof.StopCPUProfile()
+		f.Close()
+		glog.Infof("Wrote %s CPU profile to %s", duration, f.Name())
+	}()
+	glog.Infof("Started %s CPU profile to %s", duration, f.Name())
+	return f.Name(), http.StatusAccepted, nil
+}
+
+func (handler *ProfileCaptureHandler) captureHeap() (string, int, error) {
+	f, err := handler.newFile("heap")
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	defer f.Close()
+
+	// Up to date statistics of the allocations
+	runtime.GC()
+	err = runtimepprof.WriteHeapProfile(f)
+	if err != nil {
+		glog.Errorf("Failed to write heap profile to %s, error=%s", f.Name(), err)
+		return "", http.StatusInternalServerError, err
+	}
+	glog.Infof("Wrote heap profile to %s", f.Name())
+	return f.Name(), http.StatusOK, nil
+}
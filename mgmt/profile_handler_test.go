@@ -0,0 +1,88 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureProfile(handler http.Handler, query string) (int, string) {
+	req := httptest.NewRequest("POST", "/debug/profile?"+query, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var res map[string]string
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res["File"]
+}
+
+func TestProfileCaptureHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := NewProfileCaptureHandler(base.BaseConfig{base.DumpDir: dir})
+
+	code, fileName := captureProfile(handler, "type=heap")
+	if info, err := os.Stat(fileName); code != http.StatusOK || err != nil || info.Size() == 0 {
+		t.Errorf("Expect heap profile written, got status=%d, file=%s, error=%v", code, fileName, err)
+	}
+
+	code, fileName = captureProfile(handler, "type=cpu&seconds=1")
+	if code != http.StatusAccepted || !strings.HasPrefix(fileName, dir) {
+		t.Fatalf("Expect CPU profile started, got status=%d, file=%s", code, fileName)
+	}
+
+	if code, _ := captureProfile(handler, "type=cpu&seconds=1"); code != http.StatusConflict {
+		t.Errorf("Expect conflict for concurrent CPU profiles, got status=%d", code)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if info, err := os.Stat(fileName); err != nil || info.Size() == 0 {
+		t.Errorf("Expect CPU profile written to %s, error=%v", fileName, err)
+	}
+
+	for _, query := range []string{"type=goroutine", "type=cpu&seconds=0", "type=cpu&seconds=3600"} {
+		if code, _ := captureProfile(handler, query); code != http.StatusBadRequest {
+			t.Errorf("Expect bad request for %s, got status=%d", query, code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/debug/profile?type=heap", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expect GET not allowed, got status=%d", w.Code)
+	}
+}
+
+func TestHandleProfiling(t *testing.T) {
+	get := func(server *APIServer, path string) int {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	// The profiles are not served without tokens
+	open := &APIServer{config: base.BaseConfig{}, mux: http.NewServeMux()}
+	open.HandleProfiling()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/profile"} {
+		if code := get(open, path); code != http.StatusNotFound {
+			t.Errorf("Expect %s not found without tokens, got status=%d", path, code)
+		}
+	}
+
+	server := newTestAPIServer()
+	server.HandleProfiling()
+	if code := get(server, "/debug/pprof/cmdline"); code != http.StatusUnauthorized {
+		t.Errorf("Expect the profiles unauthorized without a token, got status=%d", code)
+	}
+}
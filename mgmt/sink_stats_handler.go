@@ -0,0 +1,54 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"sort"
+)
+
+type sinkStatsEntry struct {
+	Key       string
+	Saturated bool
+	base.SinkStats
+}
+
+// SinkStatsHandler serves the buffering of the sinks of the jobs, their
+// queue depths, the age of their oldest buffered data and their drops.
+// GET ?key=<TaskConfigKey> returns the stats of the sink of the job, without
+// key it returns those of all jobs ordered by key
+type SinkStatsHandler struct {
+	stats func() map[string]base.SinkStats
+}
+
+func NewSinkStatsHandler(stats func() map[string]base.SinkStats) *SinkStatsHandler {
+	return &SinkStatsHandler{
+		stats: stats,
+	}
+}
+
+func (handler *SinkStatsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := req.URL.Query().Get("key")
+	res := []sinkStatsEntry{}
+	for k, stats := range handler.stats() {
+		if key == "" || k == key {
+			res = append(res, sinkStatsEntry{Key: k, Saturated: stats.Saturated(), SinkStats: stats})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal sink stats, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,40 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSinkStatsHandler(t *testing.T) {
+	handler := NewSinkStatsHandler(func() map[string]base.SinkStats {
+		return map[string]base.SinkStats{
+			"incident":       {QueueDepth: 950, Capacity: 1000},
+			"change_request": {QueueDepth: 3, OldestAge: 1.5, Dropped: 2},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/sinks/stats", nil))
+	var res []sinkStatsEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res) != 2 {
+		t.Fatalf("Expect the stats of 2 sinks, got=%s", w.Body.String())
+	}
+
+	if res[0].Key != "change_request" || res[0].Saturated || res[0].Dropped != 2 {
+		t.Errorf("Expect the unsaturated change_request sink first, got=%+v", res[0])
+	}
+
+	if res[1].Key != "incident" || !res[1].Saturated {
+		t.Errorf("Expect the incident sink saturated, got=%+v", res[1])
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/sinks/stats?key=incident", nil))
+	res = nil
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if len(res) != 1 || res[0].QueueDepth != 950 {
+		t.Errorf("Expect the stats of the incident sink only, got=%s", w.Body.String())
+	}
+}
@@ -0,0 +1,57 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+type sloSummary struct {
+	Breached int
+	Reports  []base.SLOReport
+}
+
+// SLOHandler serves the SLO evaluation of the tasks.
+// GET ?key=<TaskConfigKey> returns the objectives of the task with their
+// budget burn, without key it returns those of all tasks
+type SLOHandler struct {
+	reports func() []base.SLOReport
+}
+
+func NewSLOHandler(reports func() []base.SLOReport) *SLOHandler {
+	return &SLOHandler{
+		reports: reports,
+	}
+}
+
+func (handler *SLOHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := req.URL.Query().Get("key")
+	summary := &sloSummary{
+		Reports: []base.SLOReport{},
+	}
+	for _, report := range handler.reports() {
+		if key != "" && report.Key != key {
+			continue
+		}
+
+		if report.Breached {
+			summary.Breached++
+		}
+		summary.Reports = append(summary.Reports, report)
+	}
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		glog.Errorf("Failed to marshal SLO reports, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
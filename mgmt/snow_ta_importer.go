@@ -0,0 +1,317 @@
+package mgmt
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	snowTAInputPrefix   = "snow://"
+	snowTAInputsFile    = "inputs.conf"
+	snowTAAccountsFile  = "splunk_ta_snow_account.conf"
+	snowTALegacyFile    = "service_now.conf"
+	snowTALegacyAccount = "snow_account"
+	snowTALegacyDefault = "snow_default"
+	snowTAMaskedValue   = "********"
+)
+
+// confStanzas is a parsed Splunk .conf file, stanza name indexed
+type confStanzas map[string]map[string]string
+
+// parseConf parses the stanzas of a Splunk .conf file. Comments, which start
+// with "#" or ";", and the settings before the first stanza are ignored
+func parseConf(fileName string) (confStanzas, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stanzas := make(confStanzas)
+	var stanza map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if stanzas[name] == nil {
+				stanzas[name] = make(map[string]string)
+			}
+			stanza = stanzas[name]
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || stanza == nil {
+			continue
+		}
+		stanza[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return stanzas, scanner.Err()
+}
+
+// LoadSnowTAPasswords reads the password overrides of NewSnowTAImporter from
+// fileName, which contains a JSON object of account name => password
+func LoadSnowTAPasswords(fileName string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	var passwords map[string]string
+	err = json.Unmarshal(content, &passwords)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", fileName, err)
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// SnowTAImporter generates descartes snow tasks from the configuration of the
+// Splunk Add-on for ServiceNow. The last collected timestamp of each input
+// becomes the NextRecordTime of the task, which seeds its checkpoint when the
+// task is collected for the first time
+type SnowTAImporter struct {
+	confDir       string
+	checkpointDir string
+	passwords     map[string]string
+}
+
+// NewSnowTAImporter
+// @confDir: the "local" directory of the add-on, which contains inputs.conf
+// and splunk_ta_snow_account.conf (or service_now.conf of the older releases)
+// @checkpointDir: the modular input checkpoint directory of the add-on, can be
+// empty. Each checkpoint file is named by the input and contains either the
+// timestamp or a JSON object with "last_time_records" or "since_when"
+// @passwords: account name indexed, overrides the passwords of the accounts
+// which the add-on has encrypted, "<account>/proxy" for the proxy password.
+// The account of service_now.conf is named "snow_account"
+func NewSnowTAImporter(confDir, checkpointDir string, passwords map[string]string) *SnowTAImporter {
+	return &SnowTAImporter{
+		confDir:       confDir,
+		checkpointDir: checkpointDir,
+		passwords:     passwords,
+	}
+}
+
+// Import returns one task per enabled snow input, ordered by the input name
+func (importer *SnowTAImporter) Import() ([]base.BaseConfig, error) {
+	inputs, err := parseConf(filepath.Join(importer.confDir, snowTAInputsFile))
+	if err != nil {
+		glog.Errorf("Failed to parse %s in %s, error=%s", snowTAInputsFile, importer.confDir, err)
+		return nil, err
+	}
+
+	accounts, defaults, err := importer.getAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if defaults == nil {
+		// settings of the [snow] stanza apply to all snow inputs
+		defaults = inputs[strings.TrimSuffix(snowTAInputPrefix, "://")]
+	}
+
+	var names []string
+	for name := range inputs {
+		if strings.HasPrefix(name, snowTAInputPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var tasks []base.BaseConfig
+	for _, name := range names {
+		input := inputs[name]
+		if input["disabled"] == "1" || strings.ToLower(input["disabled"]) == "true" {
+			glog.Infof("Skip disabled input=%s", name)
+			continue
+		}
+
+		task, err := importer.newTask(strings.TrimPrefix(name, snowTAInputPrefix), input, accounts, defaults)
+		if err != nil {
+			glog.Errorf("Failed to import input=%s, error=%s", name, err)
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// getAccounts returns the accounts, account name indexed, and the input
+// defaults of the older releases which have a single account
+func (importer *SnowTAImporter) getAccounts() (confStanzas, map[string]string, error) {
+	fileName := filepath.Join(importer.confDir, snowTAAccountsFile)
+	if _, err := os.Stat(fileName); err == nil {
+		accounts, err := parseConf(fileName)
+		if err != nil {
+			glog.Errorf("Failed to parse %s, error=%s", fileName, err)
+		}
+		return accounts, nil, err
+	}
+
+	fileName = filepath.Join(importer.confDir, snowTALegacyFile)
+	legacy, err := parseConf(fileName)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", fileName, err)
+		return nil, nil, err
+	}
+
+	accounts := confStanzas{
+		"": legacy[snowTALegacyAccount],
+	}
+	return accounts, legacy[snowTALegacyDefault], nil
+}
+
+func (importer *SnowTAImporter) newTask(name string, input map[string]string, accounts confStanzas, defaults map[string]string) (base.BaseConfig, error) {
+	setting := func(keys ...string) string {
+		for _, key := range keys {
+			if input[key] != "" {
+				return input[key]
+			}
+		}
+		for _, key := range keys {
+			if defaults[key] != "" {
+				return defaults[key]
+			}
+		}
+		return ""
+	}
+
+	account, ok := accounts[input["account"]]
+	if !ok || account["url"] == "" {
+		return nil, errors.New(fmt.Sprintf("Account=%s of input=%s is not found", input["account"], name))
+	}
+
+	accountName := input["account"]
+	if accountName == "" {
+		accountName = snowTALegacyAccount
+	}
+
+	serverURL := account["url"]
+	if !strings.HasPrefix(serverURL, "http") {
+		serverURL = "https://" + serverURL
+	}
+	serverURL = strings.TrimRight(serverURL, "/")
+
+	// The add-on keeps the encrypted passwords in its storage/passwords, a
+	// task without the real one would fail every collection
+	password, err := importer.getPassword(accountName, account["password"])
+	if err != nil {
+		return nil, err
+	}
+
+	proxyPassword := account["proxy_password"]
+	if proxyPassword != "" || importer.passwords[accountName+"/proxy"] != "" {
+		proxyPassword, err = importer.getPassword(accountName+"/proxy", proxyPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	table := setting("table")
+	if table == "" {
+		table = name
+	}
+
+	timestampField := setting("timefield")
+	if timestampField == "" {
+		timestampField = "sys_updated_on"
+	}
+
+	recordCount := setting("record_count")
+	if recordCount == "" {
+		recordCount = "200"
+	}
+
+	interval := setting("duration", "interval", "collection_interval")
+	if interval == "" {
+		interval = "60"
+	}
+
+	nextRecordTime := importer.getLastTime(name, serverURL, table)
+	if nextRecordTime == "" {
+		nextRecordTime = setting("since_when")
+	}
+	if nextRecordTime == "" {
+		return nil, errors.New(fmt.Sprintf("Neither checkpoint nor since_when is found for input=%s", name))
+	}
+
+	task := base.BaseConfig{
+		base.App:           "snow",
+		base.ServerURL:     serverURL,
+		base.Username:      account["username"],
+		base.Password:      password,
+		base.Metric:        table,
+		"TimestampField":   timestampField,
+		"RecordCount":      recordCount,
+		"NextRecordTime":   strings.Replace(nextRecordTime, " ", "+", 1),
+		"Interval":         interval,
+		base.ProxyURL:      account["proxy_url"],
+		base.ProxyUsername: account["proxy_username"],
+		base.ProxyPassword: proxyPassword,
+	}
+	return task, nil
+}
+
+// getPassword returns the override of name if any, otherwise password which
+// shall be neither empty nor masked
+func (importer *SnowTAImporter) getPassword(name, password string) (string, error) {
+	if override := importer.passwords[name]; override != "" {
+		return override, nil
+	}
+
+	if password == "" || password == snowTAMaskedValue {
+		return "", errors.New(fmt.Sprintf("Password of account=%s is encrypted or missing, supply it as an override", name))
+	}
+	return password, nil
+}
+
+// getLastTime returns the last collected timestamp of the input from the
+// checkpoint of the add-on, empty if there is none
+func (importer *SnowTAImporter) getLastTime(name, serverURL, table string) string {
+	if importer.checkpointDir == "" {
+		return ""
+	}
+
+	candidates := []string{name}
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		candidates = append(candidates, u.Host+"."+table, u.Host+"_"+table)
+	}
+
+	for _, candidate := range candidates {
+		content, err := ioutil.ReadFile(filepath.Join(importer.checkpointDir, candidate))
+		if err != nil {
+			continue
+		}
+
+		value := strings.TrimSpace(string(content))
+		var ckpt map[string]interface{}
+		if json.Unmarshal(content, &ckpt) != nil {
+			return value
+		}
+
+		for _, key := range []string{"last_time_records", "since_when"} {
+			if v, ok := ckpt[key].(string); ok && v != "" {
+				return v
+			}
+		}
+		glog.Warningf("No timestamp in checkpoint=%s of input=%s", candidate, name)
+	}
+	return ""
+}
@@ -0,0 +1,220 @@
+package mgmt
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s, error=%s", name, err)
+		}
+	}
+}
+
+func TestParseConf(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "snow_ta")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(t, dir, map[string]string{
+		"test.conf": `
+ignored = before any stanza
+# comment
+[snow://incident]
+table = incident
+; comment
+duration=120
+[snow://incident]
+timefield = sys_created_on
+not a setting
+`,
+	})
+
+	stanzas, err := parseConf(filepath.Join(dir, "test.conf"))
+	if err != nil {
+		t.Fatalf("Failed to parse conf, error=%s", err)
+	}
+
+	if len(stanzas) != 1 {
+		t.Errorf("Expect 1 stanza, got %v", stanzas)
+	}
+
+	stanza := stanzas["snow://incident"]
+	expected := map[string]string{
+		"table":     "incident",
+		"duration":  "120",
+		"timefield": "sys_created_on",
+	}
+	if len(stanza) != len(expected) {
+		t.Errorf("Expect %v, got %v", expected, stanza)
+	}
+	for k, v := range expected {
+		if stanza[k] != v {
+			t.Errorf("Expect %s=%s, got %s", k, v, stanza[k])
+		}
+	}
+}
+
+func TestSnowTAImporter(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "snow_ta")
+	defer os.RemoveAll(confDir)
+	checkpointDir, _ := ioutil.TempDir("", "snow_ta_ckpt")
+	defer os.RemoveAll(checkpointDir)
+
+	writeTestFiles(t, confDir, map[string]string{
+		snowTAInputsFile: `
+[snow]
+duration = 300
+since_when = 2016-01-01 00:00:00
+
+[snow://incident]
+account = prod
+
+[snow://change]
+account = prod
+table = change_request
+timefield = sys_created_on
+
+[snow://problem]
+account = prod
+disabled = 1
+`,
+		snowTAAccountsFile: `
+[prod]
+url = acme.service-now.com/
+username = admin
+password = secret
+`,
+	})
+
+	writeTestFiles(t, checkpointDir, map[string]string{
+		"incident":                            `{"last_time_records": "2016-05-01 10:00:00"}`,
+		"acme.service-now.com.change_request": "2016-04-01 08:00:00\n",
+	})
+
+	tasks, err := NewSnowTAImporter(confDir, checkpointDir, nil).Import()
+	if err != nil {
+		t.Fatalf("Failed to import, error=%s", err)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("Expect 2 tasks since problem is disabled, got %d", len(tasks))
+	}
+
+	// ordered by the input name
+	expected := []base.BaseConfig{
+		{
+			base.Metric:      "change_request",
+			"TimestampField": "sys_created_on",
+			"NextRecordTime": "2016-04-01+08:00:00",
+			"Interval":       "300",
+		},
+		{
+			base.Metric:      "incident",
+			"TimestampField": "sys_updated_on",
+			"NextRecordTime": "2016-05-01+10:00:00",
+			"Interval":       "300",
+		},
+	}
+
+	for i, task := range tasks {
+		expected[i][base.App] = "snow"
+		expected[i][base.ServerURL] = "https://acme.service-now.com"
+		expected[i][base.Username] = "admin"
+		expected[i][base.Password] = "secret"
+		expected[i]["RecordCount"] = "200"
+		for k, v := range expected[i] {
+			if task[k] != v {
+				t.Errorf("Expect %s=%s for task=%d, got %s", k, v, i, task[k])
+			}
+		}
+	}
+
+	// Without any checkpoint, since_when of [snow] applies
+	tasks, err = NewSnowTAImporter(confDir, "", nil).Import()
+	if err != nil || tasks[0]["NextRecordTime"] != "2016-01-01+00:00:00" {
+		t.Errorf("Expect since_when as NextRecordTime, got error=%v", err)
+	}
+}
+
+func TestSnowTAImporterMaskedPassword(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "snow_ta")
+	defer os.RemoveAll(confDir)
+
+	writeTestFiles(t, confDir, map[string]string{
+		snowTAInputsFile: `
+[snow://incident]
+since_when = 2016-01-01 00:00:00
+`,
+		snowTALegacyFile: `
+[snow_account]
+url = https://acme.service-now.com
+username = admin
+password = ********
+proxy_url = proxy:3128
+proxy_password = ********
+
+[snow_default]
+duration = 60
+`,
+	})
+
+	if _, err := NewSnowTAImporter(confDir, "", nil).Import(); err == nil {
+		t.Errorf("Expect error for the masked password")
+	}
+
+	passwords := map[string]string{snowTALegacyAccount: "secret"}
+	if _, err := NewSnowTAImporter(confDir, "", passwords).Import(); err == nil {
+		t.Errorf("Expect error for the masked proxy password")
+	}
+
+	passwords[snowTALegacyAccount+"/proxy"] = "proxy_secret"
+	tasks, err := NewSnowTAImporter(confDir, "", passwords).Import()
+	if err != nil {
+		t.Fatalf("Failed to import with password overrides, error=%s", err)
+	}
+
+	if tasks[0][base.Password] != "secret" || tasks[0][base.ProxyPassword] != "proxy_secret" {
+		t.Errorf("Expect the password overrides, got %s and %s", tasks[0][base.Password], tasks[0][base.ProxyPassword])
+	}
+}
+
+func TestSnowTAGetLastTime(t *testing.T) {
+	checkpointDir, _ := ioutil.TempDir("", "snow_ta_ckpt")
+	defer os.RemoveAll(checkpointDir)
+
+	writeTestFiles(t, checkpointDir, map[string]string{
+		"plain":                         "2016-05-01 10:00:00\n",
+		"since":                         `{"since_when": "2016-03-01 00:00:00"}`,
+		"empty":                         `{"other": 1}`,
+		"acme.service-now.com_sys_user": "2016-02-01 00:00:00",
+	})
+
+	importer := NewSnowTAImporter("", checkpointDir, nil)
+	cases := []struct {
+		name     string
+		table    string
+		expected string
+	}{
+		{"plain", "incident", "2016-05-01 10:00:00"},
+		{"since", "incident", "2016-03-01 00:00:00"},
+		{"empty", "incident", ""},
+		{"users", "sys_user", "2016-02-01 00:00:00"},
+		{"missing", "incident", ""},
+	}
+
+	for _, c := range cases {
+		lastTime := importer.getLastTime(c.name, "https://acme.service-now.com", c.table)
+		if lastTime != c.expected {
+			t.Errorf("Expect last time=%q for %s, got %q", c.expected, c.name, lastTime)
+		}
+	}
+
+	if lastTime := NewSnowTAImporter("", "", nil).getLastTime("plain", "", "incident"); lastTime != "" {
+		t.Errorf("Expect no last time without checkpoint dir, got %s", lastTime)
+	}
+}
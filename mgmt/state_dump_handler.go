@@ -0,0 +1,49 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// StateDumpHandler serves the in-memory state of the process for debugging.
+// GET returns the state in JSON, POST writes it to a file and returns the
+// file name
+type StateDumpHandler struct {
+	dump  func() interface{}
+	write func() (string, error)
+}
+
+func NewStateDumpHandler(dump func() interface{}, write func() (string, error)) *StateDumpHandler {
+	return &StateDumpHandler{
+		dump:  dump,
+		write: write,
+	}
+}
+
+func (handler *StateDumpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var res interface{}
+	switch req.Method {
+	case "GET":
+		res = handler.dump()
+	case "POST":
+		fileName, err := handler.write()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res = map[string]string{"File": fileName}
+	default:
+		http.Error(w, "Only GET and POST are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal state dump, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
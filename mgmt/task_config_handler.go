@@ -0,0 +1,51 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// TaskConfigHandler serves the effective config of the tasks, as their jobs
+// run them after the defaults, the templates and the global configs are
+// applied, for e.g. to debug a task collecting the wrong table.
+// GET ?key=<TaskConfigKey> returns the config of the task with the secrets
+// redacted
+type TaskConfigHandler struct {
+	config func(key string) (base.BaseConfig, bool)
+}
+
+func NewTaskConfigHandler(config func(key string) (base.BaseConfig, bool)) *TaskConfigHandler {
+	return &TaskConfigHandler{
+		config: config,
+	}
+}
+
+func (handler *TaskConfigHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	config, ok := handler.config(key)
+	if !ok {
+		http.Error(w, "No job of task="+key, http.StatusNotFound)
+		return
+	}
+
+	content, err := json.Marshal(redactConfig(config))
+	if err != nil {
+		glog.Errorf("Failed to marshal the config of task=%s, error=%s", key, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
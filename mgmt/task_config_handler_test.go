@@ -0,0 +1,58 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTaskConfigHandler(t *testing.T) {
+	configs := map[string]base.BaseConfig{
+		"incident": {
+			base.Metric:         "incident",
+			base.Password:       "secret",
+			base.ProxyPassword:  "",
+			"SecondaryPassword": "env:SNOW_NEXT_PASSWORD",
+			requestHeadersKey:   `{"X-Api-Key": "k3y", "X-Gateway-Token": "file:/etc/descartes/token"}`,
+		},
+	}
+	handler := NewTaskConfigHandler(func(key string) (base.BaseConfig, bool) {
+		config, ok := configs[key]
+		return config, ok
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/tasks/config?key=incident", nil))
+	var config base.BaseConfig
+	if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expect the config of the task, got status=%d, body=%s", w.Code, w.Body.String())
+	}
+
+	if config[base.Metric] != "incident" || config[base.Password] != redactedValue || config[base.ProxyPassword] != "" {
+		t.Errorf("Expect the password redacted only, got=%s", config)
+	}
+
+	if config["SecondaryPassword"] != "env:SNOW_NEXT_PASSWORD" {
+		t.Errorf("Expect the secret reference kept, got=%s", config["SecondaryPassword"])
+	}
+
+	var headers map[string]string
+	json.Unmarshal([]byte(config[requestHeadersKey]), &headers)
+	if headers["X-Api-Key"] != redactedValue || headers["X-Gateway-Token"] != "file:/etc/descartes/token" {
+		t.Errorf("Expect the header values redacted, got=%s", config[requestHeadersKey])
+	}
+
+	if configs["incident"][base.Password] != "secret" {
+		t.Errorf("Expect the config of the job untouched")
+	}
+
+	for query, expected := range map[string]int{"": http.StatusBadRequest, "?key=change_request": http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/tasks/config"+query, nil))
+		if w.Code != expected {
+			t.Errorf("Expect status=%d for query=%s, got=%d", expected, query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package mgmt
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+
+	// Beyond the default glide.processor.json.row_limit of the instances,
+	// the pages are truncated
+	maxSnowRecordCount = 10000
+	snowTimeTemplate   = "2006-01-02 15:04:05"
+)
+
+// LintIssue is a mistake found in a task config before it is published
+type LintIssue struct {
+	Severity string
+	App      string
+	Task     int // index of the task in the tasks of App
+	Key      string
+	Message  string
+}
+
+func (issue *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s task #%d %s: %s", issue.Severity, issue.App, issue.Task, issue.Key, issue.Message)
+}
+
+// The configs read by the tasks of each app, the other configs are most
+// likely typos. The global settings are merged into the tasks when they are
+// published, so they are not expected in the task files
+var lintKnownConfigs = map[string][]string{
+	"snow": {
+		base.App, base.ServerURL, base.Username, base.Password, base.Metric, base.Interval,
+		"TimestampField", "NextRecordTime", "EndRecordTime", "RecordCount",
+		base.ProxyURL, base.ProxyUsername, base.ProxyPassword,
+		base.Domains, base.DomainField, base.ServerNodes, base.DedupeFilter,
+		base.ScheduleWindows, base.ScheduleTimezone, base.ScheduleCatchUp,
+		base.ResumePolicy, base.ResumeFrom, base.Serialization, base.SortFields, base.FieldOrder,
+		base.ClockSkewThreshold, base.ClockSkewCompensate, base.CompositeMetrics,
+		base.Labels, base.PlacementConstraints, base.TaskSchemaVersion, base.LongRun, base.DryRun,
+		base.TLSCAFile, base.TLSCertFile, base.TLSKeyFile, base.TLSServerName, base.TLSSkipVerify,
+		base.KafkaKeyField, base.WriteTimeout, base.OutputTemplate, base.BootstrapFromTopic,
+		"Endpoint", "CursorParam", "LimitParam", "RecordsPath", "RequestHeaders",
+		"GapTolerance", "GapRequery", "SecondaryUsername", "SecondaryPassword",
+		"ChangeAnnotation", "ChangeCacheSize", "RecordDir", "ReplayDir", "CycleBudget", "Paginate", "Fields", "DisplayValue",
+		"QueryHints", "QueryOrder", base.ExpectedFields,
+		"ClientId", "ClientSecret", "TokenURL", "RefreshToken",
+		base.CatchUpLag, base.CatchUpRecordCount, base.CatchUpInterval,
+		base.QuotaHourly, base.QuotaDaily, base.QuotaWarnRatio, base.Priority,
+		"RetryAttempts", "RetryBackoff", "RetryMaxBackoff", "RetryJitter",
+	},
+	"kafka": {
+		base.App, base.ServerURL, base.Username, base.Password, base.Interval,
+		base.Index, base.Source, base.Sourcetype, base.Host, base.TargetSystemType,
+		"SourceServerURL", "SourceUsername", base.UseOffsetNewest, base.UseOffsetOldest,
+		base.KafkaConsumerGroup, base.KafkaOffsetReset, base.SpoolDir, base.FailoverBrokers,
+		base.Labels, base.PlacementConstraints, base.TaskSchemaVersion, base.OutputTemplate,
+	},
+}
+
+var lintRequiredConfigs = map[string][]string{
+	"snow":  {base.ServerURL, base.Username, base.Password, base.Metric, "TimestampField", "NextRecordTime", "RecordCount"},
+	"kafka": {base.ServerURL, "SourceServerURL", "SourceUsername"},
+}
+
+// TaskLinter statically checks the task files, for e.g. snow_tasks.json and
+// kafka_tasks.json, without connecting to anything. TaskKey and Topic derive
+// the TaskConfigKey and the topic of the tasks the way they are published
+type TaskLinter struct {
+	TaskKey func(task base.BaseConfig) string
+	Topic   func(app, serverURL, username string) string
+}
+
+// Lint returns the issues of tasks, indexed by the app as in the task files,
+// ordered by app and task
+func (linter *TaskLinter) Lint(tasks map[string][]base.BaseConfig) []*LintIssue {
+	var issues []*LintIssue
+	report := func(severity, app string, i int, key, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{Severity: severity, App: app, Task: i, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	apps := make([]string, 0, len(tasks))
+	for app := range tasks {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	// The topics written by the source tasks, the sink tasks of the others
+	// read nothing
+	written := make(map[string]bool)
+	for _, task := range tasks["snow"] {
+		written[linter.Topic(configOr(task, base.App, "snow"), task[base.ServerURL], task[base.Username])] = true
+	}
+
+	definitions := base.NewTaskDefinitions()
+	seen := make(map[string]int)
+	for _, app := range apps {
+		known, ok := lintKnownConfigs[app]
+		if !ok {
+			report(LintError, app, 0, base.App, "unknown app, expect one of snow, kafka")
+			continue
+		}
+
+		for i, task := range tasks[app] {
+			if task[base.App] != "" && task[base.App] != app {
+				report(LintError, app, i, base.App, "App=%s differs from the app of the task file", task[base.App])
+			}
+
+			for _, key := range lintRequiredConfigs[app] {
+				// The OAuth2 client_credentials grant needs no password
+				if key == base.Password && app == "snow" && task["ClientId"] != "" {
+					continue
+				}
+
+				if task[key] == "" {
+					report(LintError, app, i, key, "required config is missing")
+				}
+			}
+
+			for _, key := range sortedKeys(task) {
+				if !contains(known, key) {
+					if similar := similarConfig(known, key); similar != "" {
+						report(LintWarning, app, i, key, "unknown config, did you mean %s?", similar)
+					} else {
+						report(LintWarning, app, i, key, "unknown config is ignored")
+					}
+				}
+			}
+
+			if err := base.CheckTaskSchema(task); err != nil {
+				report(LintError, app, i, base.TaskSchemaVersion, "%s", err)
+			}
+
+			if v, ok := task[base.Interval]; ok {
+				if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+					report(LintError, app, i, base.Interval, "expect positive seconds, got %q", v)
+				}
+			}
+
+			if task[base.ScheduleWindows] != "" {
+				if _, err := base.ParseWorkingHours(task[base.ScheduleWindows], task[base.ScheduleTimezone]); err != nil {
+					report(LintError, app, i, base.ScheduleWindows, "%s", err)
+				}
+			}
+
+			switch app {
+			case "snow":
+				linter.lintSnowTask(task, func(severity, key, format string, args ...interface{}) {
+					report(severity, app, i, key, format, args...)
+				})
+
+				key := linter.TaskKey(task)
+				if err := definitions.Register(key, task); err != nil {
+					report(LintError, app, i, base.TaskConfigKey, "%s", err)
+				} else if first, ok := seen[key]; ok {
+					report(LintError, app, i, base.TaskConfigKey, "duplicate of task #%d, TaskConfigKey=%s", first, key)
+				} else {
+					seen[key] = i
+				}
+			case "kafka":
+				topic := linter.Topic("snow", task["SourceServerURL"], task["SourceUsername"])
+				if task["SourceServerURL"] != "" && !written[topic] {
+					report(LintWarning, app, i, "SourceServerURL", "no snow task writes topic=%s", topic)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+type lintReport func(severity, key, format string, args ...interface{})
+
+func (linter *TaskLinter) lintSnowTask(task base.BaseConfig, report lintReport) {
+	for _, key := range []string{"NextRecordTime", "EndRecordTime"} {
+		if v := task[key]; v != "" {
+			if _, err := time.Parse(snowTimeTemplate, strings.Replace(v, "+", " ", 1)); err != nil {
+				report(LintError, key, "expect %q format, got %q", snowTimeTemplate, v)
+			}
+		}
+	}
+
+	if task["NextRecordTime"] != "" && task["EndRecordTime"] != "" &&
+		strings.Replace(task["EndRecordTime"], "+", " ", 1) <= strings.Replace(task["NextRecordTime"], "+", " ", 1) {
+		report(LintError, "EndRecordTime", "nothing to collect before NextRecordTime=%s", task["NextRecordTime"])
+	}
+
+	if v, ok := task["RecordCount"]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+			report(LintError, "RecordCount", "expect a positive count, got %q", v)
+		} else if n > maxSnowRecordCount {
+			report(LintWarning, "RecordCount", "%d is above the row limit %d of the instances, the pages are truncated", n, maxSnowRecordCount)
+		} else if n < 10 {
+			report(LintWarning, "RecordCount", "%d records per request hardly keep up with a busy table", n)
+		}
+	}
+
+	if task[base.ServerURL] != "" && !strings.HasPrefix(strings.ToLower(task[base.ServerURL]), "https://") {
+		report(LintWarning, base.ServerURL, "the credentials are sent in the clear to %s", task[base.ServerURL])
+	}
+}
+
+// similarConfig returns the config of known which key is most likely a typo
+// of, empty if none
+func similarConfig(known []string, key string) string {
+	for _, k := range known {
+		if strings.EqualFold(k, key) || editDistance(strings.ToLower(k), strings.ToLower(key)) <= 2 {
+			return k
+		}
+	}
+	return ""
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func sortedKeys(config base.BaseConfig) []string {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func configOr(config base.BaseConfig, key, defaultValue string) string {
+	if config[key] != "" {
+		return config[key]
+	}
+	return defaultValue
+}
@@ -0,0 +1,84 @@
+package mgmt
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestTaskLinter() *TaskLinter {
+	return &TaskLinter{
+		TaskKey: func(task base.BaseConfig) string {
+			return task[base.App] + "_" + task[base.ServerURL] + "_" + task[base.Username] + "_" + task[base.Metric]
+		},
+		Topic: func(app, serverURL, username string) string {
+			return app + "_" + serverURL + "_" + username
+		},
+	}
+}
+
+func newTestSnowTask(metric string) base.BaseConfig {
+	return base.BaseConfig{
+		base.App:         "snow",
+		base.ServerURL:   "https://acme.service-now.com",
+		base.Username:    "admin",
+		base.Password:    "secret",
+		base.Metric:      metric,
+		base.Interval:    "60",
+		"TimestampField": "sys_updated_on",
+		"NextRecordTime": "2015-06-01+00:00:00",
+		"RecordCount":    "200",
+	}
+}
+
+func TestTaskLinter(t *testing.T) {
+	tasks := map[string][]base.BaseConfig{
+		"snow": {newTestSnowTask("incident"), newTestSnowTask("problem")},
+		"kafka": {{
+			base.App:          "kafka",
+			base.ServerURL:    "https://splunk:8089",
+			"SourceServerURL": "https://acme.service-now.com",
+			"SourceUsername":  "admin",
+		}},
+	}
+
+	linter := newTestTaskLinter()
+	if issues := linter.Lint(tasks); len(issues) != 0 {
+		t.Fatalf("Expect no issue, got %v", issues)
+	}
+
+	bad := newTestSnowTask("change_request")
+	bad["NextRecordTime"] = "2015/06/01"
+	bad["RecordCount"] = "50000"
+	bad["Intervall"] = "60"
+	delete(bad, base.Password)
+	tasks["snow"] = append(tasks["snow"], bad, newTestSnowTask("incident"))
+	tasks["kafka"][0]["SourceUsername"] = "nobody"
+
+	expected := map[string]string{
+		"snow/2/NextRecordTime":   LintError,
+		"snow/2/RecordCount":      LintWarning,
+		"snow/2/Intervall":        LintWarning,
+		"snow/2/Password":         LintError,
+		"snow/3/TaskConfigKey":    LintError,
+		"kafka/0/SourceServerURL": LintWarning,
+	}
+
+	issues := linter.Lint(tasks)
+	for _, issue := range issues {
+		id := issue.App + "/" + strconv.Itoa(issue.Task) + "/" + issue.Key
+		if severity, ok := expected[id]; !ok || severity != issue.Severity {
+			t.Errorf("Unexpected issue %s", issue)
+		}
+		delete(expected, id)
+
+		if issue.Key == "Intervall" && !strings.Contains(issue.Message, "did you mean Interval") {
+			t.Errorf("Expect the typo of Interval suggested, got %s", issue)
+		}
+	}
+
+	if len(expected) != 0 {
+		t.Errorf("Expect the issues %v found, got %v", expected, issues)
+	}
+}
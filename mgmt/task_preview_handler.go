@@ -0,0 +1,82 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPreviewCount = 10
+	maxPreviewCount     = 1000
+)
+
+type taskPreview struct {
+	Records []string
+	Error   string `json:",omitempty"`
+}
+
+// TaskPreviewHandler previews the records a task would emit, for e.g. to
+// check the effects of its transforms and masking before it is published.
+// POST a task config, ?count=N previews the next N records, 10 by default
+// and 1000 at most. The records collected before a failure are returned
+// along with the error
+type TaskPreviewHandler struct {
+	preview func(task base.BaseConfig, n int) ([]string, error)
+}
+
+// NewTaskPreviewHandler
+// @preview: runs the bounded collection of the task, see services.Preview
+func NewTaskPreviewHandler(preview func(task base.BaseConfig, n int) ([]string, error)) *TaskPreviewHandler {
+	return &TaskPreviewHandler{
+		preview: preview,
+	}
+}
+
+func (handler *TaskPreviewHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := defaultPreviewCount
+	if count := req.URL.Query().Get("count"); count != "" {
+		var err error
+		n, err = strconv.Atoi(count)
+		if err != nil || n <= 0 || n > maxPreviewCount {
+			http.Error(w, "count shall be between 1 and "+strconv.Itoa(maxPreviewCount), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var task base.BaseConfig
+	if err := json.NewDecoder(req.Body).Decode(&task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if task[base.App] == "" {
+		http.Error(w, base.App+" is required", http.StatusBadRequest)
+		return
+	}
+
+	records, err := handler.preview(task, n)
+	res := &taskPreview{Records: records}
+	if res.Records == nil {
+		res.Records = []string{}
+	}
+	if err != nil {
+		glog.Errorf("Failed to preview task=%s, error=%s", task[base.TaskConfigKey], err)
+		res.Error = err.Error()
+	}
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,56 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTaskPreviewHandler(t *testing.T) {
+	var previewed base.BaseConfig
+	handler := NewTaskPreviewHandler(func(task base.BaseConfig, n int) ([]string, error) {
+		previewed = task
+		records := []string{`{"number":"INC1","caller":"****"}`, `{"number":"INC2","caller":"****"}`}
+		if n < len(records) {
+			return records[:n], nil
+		}
+		return records, errors.New("instance unavailable")
+	})
+
+	task := `{"App": "snow", "Metric": "incident", "FieldOrder": "number,caller"}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/tasks/preview?count=1", strings.NewReader(task)))
+	var res taskPreview
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res.Records) != 1 || res.Error != "" {
+		t.Errorf("Expect 1 record previewed, got status=%d, body=%s", w.Code, w.Body.String())
+	}
+
+	if previewed[base.Metric] != "incident" || previewed[base.FieldOrder] != "number,caller" {
+		t.Errorf("Expect the posted task previewed, got=%s", previewed)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/tasks/preview", strings.NewReader(task)))
+	res = taskPreview{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if len(res.Records) != 2 || res.Error != "instance unavailable" {
+		t.Errorf("Expect the records collected before the failure with the error, got=%s", w.Body.String())
+	}
+
+	cases := map[string]string{
+		"/tasks/preview?count=0":    task,
+		"/tasks/preview?count=1001": task,
+		"/tasks/preview":            `{"Metric": "incident"}`,
+	}
+	for url, body := range cases {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expect %d for url=%s, body=%s, got=%d", http.StatusBadRequest, url, body, w.Code)
+		}
+	}
+}
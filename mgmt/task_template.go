@@ -0,0 +1,108 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+)
+
+// TaskTemplate generates one task per table. Base contains the settings
+// shared by the tasks, for e.g. App, ServerURL, credentials and the sink.
+// Overrides contains the per table settings which take precedence over Base
+type TaskTemplate struct {
+	Name      string
+	Base      base.BaseConfig
+	Tables    []string
+	Overrides map[string]base.BaseConfig // table indexed
+}
+
+// Expand returns the task configs of the template, the table is the Metric
+// of the task
+func (tmpl *TaskTemplate) Expand() ([]base.BaseConfig, error) {
+	for _, key := range []string{base.App, base.ServerURL} {
+		if tmpl.Base[key] == "" {
+			return nil, errors.New(fmt.Sprintf("%s is missing in task template=%s", key, tmpl.Name))
+		}
+	}
+
+	if len(tmpl.Tables) == 0 {
+		return nil, errors.New(fmt.Sprintf("No table in task template=%s", tmpl.Name))
+	}
+
+	for table := range tmpl.Overrides {
+		if !tmpl.hasTable(table) {
+			return nil, errors.New(fmt.Sprintf("Override for unknown table=%s in task template=%s", table, tmpl.Name))
+		}
+	}
+
+	seen := make(map[string]bool, len(tmpl.Tables))
+	tasks := make([]base.BaseConfig, 0, len(tmpl.Tables))
+	for _, table := range tmpl.Tables {
+		if table == "" || seen[table] {
+			return nil, errors.New(fmt.Sprintf("Empty or duplicate table=%s in task template=%s", table, tmpl.Name))
+		}
+		seen[table] = true
+
+		task := make(base.BaseConfig, len(tmpl.Base)+len(tmpl.Overrides[table])+1)
+		for k, v := range tmpl.Base {
+			task[k] = v
+		}
+		task[base.Metric] = table
+
+		for k, v := range tmpl.Overrides[table] {
+			task[k] = v
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (tmpl *TaskTemplate) hasTable(table string) bool {
+	for _, t := range tmpl.Tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadTaskTemplates reads templates in {"<name>": [<TaskTemplate>, ...]}
+// format, like the task files
+func LoadTaskTemplates(fileName string) ([]*TaskTemplate, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		glog.Errorf("Failed to read %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	groups := make(map[string][]*TaskTemplate)
+	err = json.Unmarshal(content, &groups)
+	if err != nil {
+		glog.Errorf("Failed to unmarshal %s, error=%s", fileName, err)
+		return nil, err
+	}
+
+	var templates []*TaskTemplate
+	for _, group := range groups {
+		templates = append(templates, group...)
+	}
+	return templates, nil
+}
+
+// ExpandTaskTemplates expands all of the templates, it fails if any of them
+// is invalid so that a bulk onboarding is all or nothing
+func ExpandTaskTemplates(templates []*TaskTemplate) ([]base.BaseConfig, error) {
+	var tasks []base.BaseConfig
+	for _, tmpl := range templates {
+		expanded, err := tmpl.Expand()
+		if err != nil {
+			glog.Errorf("Failed to expand task template, error=%s", err)
+			return nil, err
+		}
+		tasks = append(tasks, expanded...)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,124 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"strings"
+)
+
+const (
+	redactedValue = "********"
+	// The static headers of the snow requests, which may carry API keys
+	requestHeadersKey = "RequestHeaders"
+)
+
+// secretSuffixes are the suffixes of the config keys whose values are not
+// returned by the API, for e.g. Password and ProxyPassword
+var secretSuffixes = []string{"Password", "Secret", "Token"}
+
+// TaskTemplateHandler expands task templates into task configs.
+// POST a TaskTemplate or a list of them, ?dry_run=1 only returns the
+// expanded tasks, otherwise they are published as new tasks. The secrets in
+// the returned tasks are redacted
+type TaskTemplateHandler struct {
+	publish func(tasks []base.BaseConfig) ([]base.BaseConfig, error)
+}
+
+// NewTaskTemplateHandler
+// @publish: completes and publishes the tasks, returns the published ones
+func NewTaskTemplateHandler(publish func(tasks []base.BaseConfig) ([]base.BaseConfig, error)) *TaskTemplateHandler {
+	return &TaskTemplateHandler{
+		publish: publish,
+	}
+}
+
+func (handler *TaskTemplateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var templates []*TaskTemplate
+	if err := json.Unmarshal(raw, &templates); err != nil {
+		var tmpl TaskTemplate
+		if err := json.Unmarshal(raw, &tmpl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		templates = []*TaskTemplate{&tmpl}
+	}
+
+	tasks, err := ExpandTaskTemplates(templates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.URL.Query().Get("dry_run") != "1" {
+		tasks, err = handler.publish(tasks)
+		if err != nil {
+			glog.Errorf("Failed to publish tasks, error=%s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	content, err := json.Marshal(redactSecrets(tasks))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+// redactSecrets returns copies of tasks with the secret values masked
+func redactSecrets(tasks []base.BaseConfig) []base.BaseConfig {
+	redacted := make([]base.BaseConfig, 0, len(tasks))
+	for _, task := range tasks {
+		redacted = append(redacted, redactConfig(task))
+	}
+	return redacted
+}
+
+// redactConfig returns a copy of config with the secret values masked. The
+// references to the secrets, for e.g. "env:SNOW_PASSWORD", are kept since
+// they tell where the secrets are resolved from. The values of the
+// RequestHeaders object are masked in the same way
+func redactConfig(config base.BaseConfig) base.BaseConfig {
+	copied := make(base.BaseConfig, len(config))
+	for k, v := range config {
+		copied[k] = v
+		for _, suffix := range secretSuffixes {
+			if strings.HasSuffix(k, suffix) {
+				copied[k] = redactValue(v)
+				break
+			}
+		}
+	}
+
+	var headers map[string]string
+	if json.Unmarshal([]byte(config[requestHeadersKey]), &headers) == nil {
+		for name, value := range headers {
+			headers[name] = redactValue(value)
+		}
+		content, _ := json.Marshal(headers)
+		copied[requestHeadersKey] = string(content)
+	}
+	return copied
+}
+
+func redactValue(value string) string {
+	if value == "" || strings.HasPrefix(value, base.SecretFilePrefix) || strings.HasPrefix(value, base.SecretEnvPrefix) {
+		return value
+	}
+	return redactedValue
+}
@@ -0,0 +1,139 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestTaskTemplate() *TaskTemplate {
+	return &TaskTemplate{
+		Name: "acme",
+		Base: base.BaseConfig{
+			base.App:         "snow",
+			base.ServerURL:   "https://acme.service-now.com",
+			base.Password:    "secret",
+			"Interval":       "60",
+			"TimestampField": "sys_updated_on",
+		},
+		Tables: []string{"incident", "change_request"},
+		Overrides: map[string]base.BaseConfig{
+			"change_request": {
+				"Interval": "300",
+			},
+		},
+	}
+}
+
+func TestTaskTemplateExpand(t *testing.T) {
+	tasks, err := newTestTaskTemplate().Expand()
+	if err != nil {
+		t.Fatalf("Failed to expand task template, error=%s", err)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("Expect 2 tasks, got %d", len(tasks))
+	}
+
+	expected := []map[string]string{
+		{base.Metric: "incident", "Interval": "60", "TimestampField": "sys_updated_on"},
+		{base.Metric: "change_request", "Interval": "300", "TimestampField": "sys_updated_on"},
+	}
+	for i, task := range tasks {
+		for k, v := range expected[i] {
+			if task[k] != v {
+				t.Errorf("Expect %s=%s for table=%s, got %s", k, v, expected[i][base.Metric], task[k])
+			}
+		}
+	}
+
+	// The expanded tasks don't share the settings
+	tasks[0]["Interval"] = "10"
+	if tasks[1]["Interval"] != "300" || newTestTaskTemplate().Base["Interval"] != "60" {
+		t.Errorf("Expect the tasks not to share the settings")
+	}
+}
+
+func TestTaskTemplateValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(tmpl *TaskTemplate)
+	}{
+		{"missing App", func(tmpl *TaskTemplate) { delete(tmpl.Base, base.App) }},
+		{"missing ServerURL", func(tmpl *TaskTemplate) { tmpl.Base[base.ServerURL] = "" }},
+		{"no table", func(tmpl *TaskTemplate) { tmpl.Tables = nil }},
+		{"empty table", func(tmpl *TaskTemplate) { tmpl.Tables = append(tmpl.Tables, "") }},
+		{"duplicate table", func(tmpl *TaskTemplate) { tmpl.Tables = append(tmpl.Tables, "incident") }},
+		{"unknown override", func(tmpl *TaskTemplate) { tmpl.Overrides["problem"] = base.BaseConfig{} }},
+	}
+
+	for _, c := range cases {
+		tmpl := newTestTaskTemplate()
+		c.modify(tmpl)
+		if _, err := tmpl.Expand(); err == nil {
+			t.Errorf("Expect error for %s", c.name)
+		}
+
+		// all or nothing
+		if tasks, err := ExpandTaskTemplates([]*TaskTemplate{newTestTaskTemplate(), tmpl}); err == nil || tasks != nil {
+			t.Errorf("Expect no task expanded for %s", c.name)
+		}
+	}
+}
+
+func TestTaskTemplateHandler(t *testing.T) {
+	var published []base.BaseConfig
+	handler := NewTaskTemplateHandler(func(tasks []base.BaseConfig) ([]base.BaseConfig, error) {
+		published = tasks
+		return tasks, nil
+	})
+
+	body, _ := json.Marshal(newTestTaskTemplate())
+	for _, dryRun := range []bool{true, false} {
+		published = nil
+		uri := "/tasks/template"
+		if dryRun {
+			uri += "?dry_run=1"
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", uri, strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expect status=200, got %d", rec.Code)
+			continue
+		}
+
+		if dryRun && published != nil {
+			t.Errorf("Expect nothing published on dry run")
+		} else if !dryRun && (len(published) != 2 || published[0][base.Password] != "secret") {
+			t.Errorf("Expect 2 tasks with the secrets published, got %v", published)
+		}
+
+		var tasks []base.BaseConfig
+		if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil || len(tasks) != 2 {
+			t.Errorf("Expect 2 tasks returned, got %s", rec.Body.String())
+			continue
+		}
+
+		for _, task := range tasks {
+			if task[base.Password] != redactedValue {
+				t.Errorf("Expect the password redacted, got %s", task[base.Password])
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/tasks/template", strings.NewReader(`{"Name": "empty"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expect status=400 for invalid template, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/tasks/template", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expect status=405 for GET, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// TopicRegistryHandler serves the registry of the output topics of the tasks.
+// GET ?topic=<KafkaTopic>&key=<TaskConfigKey> returns the registrations of
+// the topic or of the task, without them it returns all of them
+type TopicRegistryHandler struct {
+	registrations func() ([]*base.TopicRegistration, error)
+}
+
+func NewTopicRegistryHandler(registrations func() ([]*base.TopicRegistration, error)) *TopicRegistryHandler {
+	return &TopicRegistryHandler{
+		registrations: registrations,
+	}
+}
+
+func (handler *TopicRegistryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regs, err := handler.registrations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	topic, key := req.URL.Query().Get("topic"), req.URL.Query().Get("key")
+	res := []*base.TopicRegistration{}
+	for _, reg := range regs {
+		if (topic != "" && reg.Topic != topic) || (key != "" && reg.TaskConfigKey != key) {
+			continue
+		}
+		res = append(res, reg)
+	}
+
+	content, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal topic registrations, error=%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,60 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTopicRegistryHandler(t *testing.T) {
+	regs := []*base.TopicRegistration{
+		base.NewTopicRegistration(base.BaseConfig{
+			base.TaskConfigKey: "incident",
+			base.KafkaTopic:    "snow_acme_admin",
+		}),
+		base.NewTopicRegistration(base.BaseConfig{
+			base.TaskConfigKey: "change_request",
+			base.KafkaTopic:    "snow_acme_admin",
+			base.Compression:   "zstd",
+			base.Serialization: base.FormatNDJSON,
+		}),
+	}
+	var failure error
+	handler := NewTopicRegistryHandler(func() ([]*base.TopicRegistration, error) {
+		return regs, failure
+	})
+
+	cases := map[string]int{
+		"":                       2,
+		"topic=snow_acme_admin":  2,
+		"key=incident":           1,
+		"topic=snow_other_admin": 0,
+	}
+	for query, expected := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/topics?"+query, nil))
+
+		var res []base.TopicRegistration
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res) != expected {
+			t.Errorf("Expect %d registrations for query=%s, got=%s", expected, query, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/topics?key=incident", nil))
+	var res []base.TopicRegistration
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if len(res) != 1 || res[0].Serialization != base.FormatJSON || res[0].Compression != base.CodecNone || res[0].Envelope != base.EnvelopeVersion {
+		t.Errorf("Expect the default decoding of the registration, got=%s", w.Body.String())
+	}
+
+	failure = errors.New("ZooKeeper is down")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/topics", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expect %d when the registry is unavailable, got=%d", http.StatusServiceUnavailable, w.Code)
+	}
+}
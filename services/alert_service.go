@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAlertDedupeWindow = 10 * time.Minute
+	defaultAlertRateLimit    = 30 // per minute
+	defaultPagerDutyURL      = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// alertTopics are the events of the bus which are notified
+var alertTopics = []string{base.JobFailureTopic, base.DataGapTopic, base.SLOBreachTopic, base.TaskNackTopic, base.CredentialHealthTopic, base.SinkSaturationTopic, base.ContractViolationTopic}
+
+type alertTarget struct {
+	name string
+	send func(alert *alert) error
+}
+
+type alert struct {
+	topic    string
+	dedupKey string
+	summary  string
+	event    base.BaseConfig
+}
+
+// AlertService notifies the JobFailureTopic, DataGapTopic, SLOBreachTopic,
+// TaskNackTopic, CredentialHealthTopic, SinkSaturationTopic and
+// ContractViolationTopic events of the bus to a generic JSON webhook, Slack
+// and PagerDuty. The same event of a task, for e.g. the failures of one job, is
+// notified once within AlertDedupeWindow, and no more than AlertRateLimit
+// alerts are sent per minute, the others are dropped with a warning
+type AlertService struct {
+	bus          *base.EventBus
+	http_client  *http.Client
+	targets      []alertTarget
+	host         string
+	dedupeWindow time.Duration
+	rateLimit    int
+	sent         map[string]time.Time // dedup key indexed
+	windowStart  time.Time
+	windowCount  int
+	mutex        sync.Mutex
+	wg           sync.WaitGroup
+	lifecycle    base.Lifecycle
+}
+
+// NewAlertService returns nil if no alert target is configured or the
+// config is invalid, see hasAlertTargets
+// @config: AlertWebhook, AlertSlackWebhook URLs, AlertPagerDutyKey which is
+// the routing key of the PagerDuty Events API v2 integration,
+// AlertPagerDutyURL overrides its endpoint. AlertDedupeWindow in seconds,
+// 600 by default, AlertRateLimit per minute, 30 by default
+func NewAlertService(config base.BaseConfig, bus *base.EventBus) *AlertService {
+	client, err := base.NewHTTPClient(config, 30*time.Second)
+	if err != nil {
+		glog.Errorf("Failed to create http client for alerts, error=%s", err)
+		return nil
+	}
+
+	host, _ := os.Hostname()
+	service := &AlertService{
+		bus:          bus,
+		host:         host,
+		http_client:  client,
+		dedupeWindow: defaultAlertDedupeWindow,
+		rateLimit:    defaultAlertRateLimit,
+		sent:         make(map[string]time.Time),
+	}
+
+	if config[base.AlertDedupeWindow] != "" {
+		n, err := strconv.Atoi(config[base.AlertDedupeWindow])
+		if err != nil || n < 0 {
+			glog.Errorf("Invalid %s=%s, expect seconds", base.AlertDedupeWindow, config[base.AlertDedupeWindow])
+			return nil
+		}
+		service.dedupeWindow = time.Duration(n) * time.Second
+	}
+
+	if config[base.AlertRateLimit] != "" {
+		n, err := strconv.Atoi(config[base.AlertRateLimit])
+		if err != nil || n <= 0 {
+			glog.Errorf("Invalid %s=%s, expect a positive integer", base.AlertRateLimit, config[base.AlertRateLimit])
+			return nil
+		}
+		service.rateLimit = n
+	}
+
+	if url := config[base.AlertWebhook]; url != "" {
+		service.targets = append(service.targets, alertTarget{"webhook", func(a *alert) error {
+			return service.post(url, map[string]interface{}{
+				"Topic":    a.topic,
+				"DedupKey": a.dedupKey,
+				"Summary":  a.summary,
+				"Event":    a.event,
+			})
+		}})
+	}
+
+	if url := config[base.AlertSlackWebhook]; url != "" {
+		service.targets = append(service.targets, alertTarget{"slack", func(a *alert) error {
+			return service.post(url, map[string]interface{}{"text": a.summary})
+		}})
+	}
+
+	if key := config[base.AlertPagerDutyKey]; key != "" {
+		url := config[base.AlertPagerDutyURL]
+		if url == "" {
+			url = defaultPagerDutyURL
+		}
+
+		service.targets = append(service.targets, alertTarget{"pagerduty", func(a *alert) error {
+			return service.post(url, map[string]interface{}{
+				"routing_key":  key,
+				"event_action": "trigger",
+				"dedup_key":    a.dedupKey,
+				"payload": map[string]interface{}{
+					"summary":        a.summary,
+					"source":         service.host,
+					"severity":       "error",
+					"component":      "descartes",
+					"class":          a.topic,
+					"custom_details": a.event,
+				},
+			})
+		}})
+	}
+
+	if len(service.targets) == 0 {
+		return nil
+	}
+	return service
+}
+
+// hasAlertTargets returns true if config sets an alert target, the alert
+// service is expected then
+func hasAlertTargets(config base.BaseConfig) bool {
+	return config[base.AlertWebhook] != "" || config[base.AlertSlackWebhook] != "" || config[base.AlertPagerDutyKey] != ""
+}
+
+func (service *AlertService) Start() {
+	if service.lifecycle.Start("AlertService") != nil {
+		return
+	}
+
+	for _, topic := range alertTopics {
+		service.wg.Add(1)
+		go func(topic string, events <-chan base.BaseConfig) {
+			defer service.wg.Done()
+			for event := range events {
+				service.notify(newAlert(topic, event), time.Now())
+			}
+		}(topic, service.bus.Subscribe(topic))
+	}
+	glog.Infof("AlertService started...")
+}
+
+// Stop waits for the alerts being sent, the bus shall be closed before
+func (service *AlertService) Stop() {
+	if service.lifecycle.Stop("AlertService") != nil {
+		return
+	}
+
+	service.wg.Wait()
+	glog.Infof("AlertService stopped...")
+}
+
+func (service *AlertService) Status() string {
+	return service.lifecycle.Status()
+}
+
+func newAlert(topic string, event base.BaseConfig) *alert {
+	var keys []string
+	for k := range event {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	details := make([]string, 0, len(keys))
+	for _, k := range keys {
+		details = append(details, k+"="+event[k])
+	}
+
+	// The identity of the event, the values changing between the
+	// occurrences, for e.g. Error and Actual, are not part of it. The SLO
+	// Objective and the Credential qualify the subject
+	subject := event[base.TaskConfigKey]
+	if subject == "" {
+		subject = event[base.Key]
+	}
+	if subject == "" {
+		subject = event[base.KafkaTopic] + "/" + event[base.KafkaPartition]
+	}
+
+	return &alert{
+		topic:    topic,
+		dedupKey: strings.Join([]string{"descartes", topic, subject, event["Objective"] + event["Credential"]}, "/"),
+		summary:  fmt.Sprintf("descartes %s: %s", topic, strings.Join(details, ", ")),
+		event:    event,
+	}
+}
+
+func (service *AlertService) notify(a *alert, now time.Time) {
+	if !service.allow(a, now) {
+		return
+	}
+
+	for _, target := range service.targets {
+		if err := target.send(a); err != nil {
+			glog.Errorf("Failed to send alert=%s to %s, error=%s", a.dedupKey, target.name, err)
+		}
+	}
+}
+
+// allow dedupes and throttles the alerts
+func (service *AlertService) allow(a *alert, now time.Time) bool {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if last, ok := service.sent[a.dedupKey]; ok && now.Sub(last) < service.dedupeWindow {
+		glog.Infof("Alert=%s was sent at %s, skip", a.dedupKey, last)
+		return false
+	}
+
+	if now.Sub(service.windowStart) >= time.Minute {
+		service.windowStart = now
+		service.windowCount = 0
+	}
+
+	if service.windowCount >= service.rateLimit {
+		glog.Warningf("%s=%d reached, drop alert=%s", base.AlertRateLimit, service.rateLimit, a.summary)
+		return false
+	}
+	service.windowCount++
+	service.sent[a.dedupKey] = now
+
+	for key, last := range service.sent {
+		if now.Sub(last) >= service.dedupeWindow {
+			delete(service.sent, key)
+		}
+	}
+	return true
+}
+
+func (service *AlertService) post(url string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := service.http_client.Post(url, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("Unexpected status=%s", resp.Status))
+	}
+	return nil
+}
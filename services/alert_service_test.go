@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlertService(t *testing.T) {
+	var mutex sync.Mutex
+	posted := make(map[string][]map[string]interface{}) // path indexed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		posted[r.URL.Path] = append(posted[r.URL.Path], body)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.AlertWebhook:      server.URL + "/webhook",
+		base.AlertSlackWebhook: server.URL + "/slack",
+		base.AlertPagerDutyKey: "routing-key",
+		base.AlertPagerDutyURL: server.URL + "/pagerduty",
+		base.AlertRateLimit:    "2",
+	}
+
+	service := NewAlertService(config, base.NewEventBus())
+	if service == nil || len(service.targets) != 3 || service.dedupeWindow != defaultAlertDedupeWindow {
+		t.Fatalf("Expect the alert service with 3 targets and the default dedupe window")
+	}
+
+	failure := base.BaseConfig{base.TaskConfigKey: "/snow/incident", "Error": "timeout"}
+	now := time.Now()
+	service.notify(newAlert(base.JobFailureTopic, failure), now)
+
+	webhook, slack, pagerduty := posted["/webhook"], posted["/slack"], posted["/pagerduty"]
+	if len(webhook) != 1 || len(slack) != 1 || len(pagerduty) != 1 {
+		t.Fatalf("Expect the alert sent to every target, got %v", posted)
+	}
+
+	dedupKey := "descartes/" + base.JobFailureTopic + "//snow/incident/"
+	if webhook[0]["Topic"] != base.JobFailureTopic || webhook[0]["DedupKey"] != dedupKey {
+		t.Errorf("Unexpected webhook payload=%v", webhook[0])
+	}
+
+	if text, _ := slack[0]["text"].(string); !strings.Contains(text, "Error=timeout") {
+		t.Errorf("Expect the event in the Slack text, got %v", slack[0])
+	}
+
+	payload, _ := pagerduty[0]["payload"].(map[string]interface{})
+	if pagerduty[0]["routing_key"] != "routing-key" || pagerduty[0]["event_action"] != "trigger" ||
+		pagerduty[0]["dedup_key"] != dedupKey || payload["class"] != base.JobFailureTopic {
+		t.Errorf("Unexpected PagerDuty payload=%v", pagerduty[0])
+	}
+
+	// The same failure with another error is deduped within the window
+	failure = base.BaseConfig{base.TaskConfigKey: "/snow/incident", "Error": "reset"}
+	service.notify(newAlert(base.JobFailureTopic, failure), now.Add(time.Second))
+	if len(posted["/webhook"]) != 1 {
+		t.Errorf("Expect the same failure deduped, got %d alerts", len(posted["/webhook"]))
+	}
+
+	// The rate limit is reached by the second task
+	gap := base.BaseConfig{base.TaskConfigKey: "/snow/problem"}
+	service.notify(newAlert(base.DataGapTopic, gap), now.Add(time.Second))
+	service.notify(newAlert(base.DataGapTopic, base.BaseConfig{base.TaskConfigKey: "/snow/change"}), now.Add(time.Second))
+	if len(posted["/webhook"]) != 2 {
+		t.Errorf("Expect the alerts beyond %s dropped, got %d alerts", base.AlertRateLimit, len(posted["/webhook"]))
+	}
+
+	// Both the window and the minute passed
+	service.notify(newAlert(base.JobFailureTopic, failure), now.Add(defaultAlertDedupeWindow))
+	if len(posted["/webhook"]) != 3 {
+		t.Errorf("Expect the failure alerted again after the dedupe window, got %d alerts", len(posted["/webhook"]))
+	}
+
+	if NewAlertService(base.BaseConfig{}, base.NewEventBus()) != nil {
+		t.Errorf("Expect no alert service without targets")
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{base.AlertWebhook: server.URL, base.AlertDedupeWindow: "10m"},
+		{base.AlertWebhook: server.URL, base.AlertRateLimit: "0"},
+	} {
+		if NewAlertService(bad, base.NewEventBus()) != nil || !hasAlertTargets(bad) {
+			t.Errorf("Expect the alert config %v rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sources/snow"
+	"github.com/golang/glog"
+)
+
+const (
+	// Of each partition of the topic, the newest records of a table are
+	// expected among them
+	bootstrapScanMessages = 1000
+)
+
+// bootstrapSnowCheckpoint initializes the checkpoint of a new snow task from
+// the records of its table already in KafkaTopic when BootstrapFromTopic is
+// "1", for e.g. when the collection is migrated from another deployment, so
+// the table is not backfilled again. The tail of each partition is scanned,
+// the domain separated tables are not bootstrapped
+func (factory *JobFactory) bootstrapSnowCheckpoint(config base.BaseConfig, checkpoint base.Checkpointer) {
+	if config[base.BootstrapFromTopic] != "1" || config[base.Domains] != "" {
+		return
+	}
+
+	if data, err := checkpoint.GetCheckpoint(config); err != nil || data != nil {
+		return
+	}
+
+	topic := config[base.KafkaTopic]
+	records, err := factory.scanTopicTail(config, topic)
+	if err != nil {
+		glog.Errorf("Failed to scan topic=%s to bootstrap %s, error=%s", topic, config[base.Key], err)
+		return
+	}
+
+	next, err := snow.BootstrapCheckpoint(config, checkpoint, records)
+	if err != nil {
+		glog.Errorf("Failed to bootstrap checkpoint of %s, error=%s", config[base.Key], err)
+	} else if next == "" {
+		glog.Infof("No record of Metric=%s in topic=%s, collect from NextRecordTime=%s",
+			config[base.Metric], topic, config["NextRecordTime"])
+	}
+}
+
+// scanTopicTail returns the records of the Metric of config in the last
+// messages of the partitions of topic
+func (factory *JobFactory) scanTopicTail(config base.BaseConfig, topic string) ([]map[string]interface{}, error) {
+	client := factory.getKafkaClient(config)
+	if client == nil {
+		return nil, errors.New("Failed to create kafka client")
+	}
+
+	codec, err := base.NewAutoCodec(config)
+	if err != nil {
+		return nil, err
+	}
+
+	topicPartitions, err := client.TopicPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+	for _, partition := range topicPartitions[topic] {
+		values, err := client.GetLastMessages(topic, partition, bootstrapScanMessages)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, value := range values {
+			payload, err := codec.Decode(value)
+			if err != nil {
+				continue
+			}
+
+			data, err := base.DecodeMessage(payload)
+			if err != nil || data.MetaInfo[base.Metric] != config[base.Metric] || data.MetaInfo[base.Domain] != "" {
+				continue
+			}
+
+			parsed, err := data.ParseRecords()
+			if err != nil {
+				continue
+			}
+			records = append(records, parsed...)
+		}
+	}
+	return records, nil
+}
@@ -1,15 +1,19 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/chenziliang/descartes/base"
 	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
-	"github.com/chenziliang/descartes/sinks/memory"
-	kafkareader "github.com/chenziliang/descartes/sources/kafka"
 	"github.com/golang/glog"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -20,16 +24,30 @@ type CollectService struct {
 	kafkaClient    *base.KafkaClient
 	zkClient       *base.ZooKeeperClient
 	jobs           map[string]base.Job         // job key indexed
+	definitions    *base.TaskDefinitions
+	jobsMutex      sync.Mutex
+	rejections     map[string]TaskRejection    // TaskConfigKey indexed
+	rejectMutex    sync.Mutex
+	historyWriter  base.DataWriter
+	store          *base.MetadataStore         // nil if MetadataStorePath is not set
+	bus            *base.EventBus
+	slo            *SLOMonitor
+	health         *HealthMonitor
+	sinks          *SinkMonitor
+	alerts         *AlertService               // nil if no alert target is configured
+	taskMonitor    *TaskMonitor
+	limiter        *base.JobLimiter
+	inflight       *base.InflightWatermark
+	globals        base.BaseConfig             // reloadable global configs
+	globalsMutex   sync.Mutex
+	heartbeatMode  atomic.Value
+	clock          base.Clock
 	host           string
-	started        int32
+	lifecycle      base.Lifecycle
 }
 
-const (
-	heartbeatInterval = 30 * time.Second
-)
-
 func NewCollectService(config base.BaseConfig) *CollectService {
-	client := base.NewKafkaClient(config, "TaskMonitorClient")
+	client := base.NewKafkaClient(base.ControlKafkaConfig(config), "TaskMonitorClient")
 	if client == nil {
 		return nil
 	}
@@ -44,60 +62,342 @@ func NewCollectService(config base.BaseConfig) *CollectService {
 		return nil
 	}
 
-	return &CollectService{
+	globals := make(base.BaseConfig)
+	for _, key := range base.ReloadableConfigs {
+		globals[key] = config[key]
+	}
+
+	cs := &CollectService{
 		jobFactory:     NewJobFactory(),
 		kafkaClient:    client,
 		zkClient:       zkClient,
 		config:			config,
 		jobs:           make(map[string]base.Job, 100),
+		definitions:    base.NewTaskDefinitions(),
+		rejections:     make(map[string]TaskRejection),
+		bus:            base.NewEventBus(),
+		limiter:        base.NewJobLimiterFromConfig(config),
+		inflight:       base.NewInflightWatermark(config),
+		globals:        globals,
+		clock:          base.SystemClock,
 		host:           host,
-		started:        0,
 	}
+	cs.heartbeatMode.Store(base.GetHeartbeatMode(config))
+	cs.slo = NewSLOMonitor(cs.jobFactory.JobHistory(), cs.bus)
+	cs.health = NewHealthMonitor(cs.jobFactory.JobHistory())
+	cs.sinks = NewSinkMonitor(config, cs.SinkStats, cs.bus)
+	cs.jobFactory.SetEventBus(cs.bus)
+	cs.jobFactory.SetAppFilter(config)
+	cs.jobFactory.SetCheckpointHistory(base.NewCheckpointHistory(config))
+	cs.alerts = NewAlertService(config, cs.bus)
+	if cs.alerts == nil && hasAlertTargets(config) {
+		// A typo in the alert config shall not silently disable the alerts
+		return nil
+	}
+
+	if config[base.MetadataStorePath] != "" {
+		cs.store = base.NewMetadataStore(config)
+		if cs.store == nil {
+			return nil
+		}
+		cs.jobFactory.CheckpointHistory().SetStore(cs.store)
+	}
+	return cs
 }
 
 func (cs *CollectService) Start() {
-	if !atomic.CompareAndSwapInt32(&cs.started, 0, 1) {
-		glog.Infof("CollectService already started.")
+	if cs.lifecycle.Start("CollectService") != nil {
 		return
 	}
 
-	go cs.monitorTasks(base.Tasks)
+	if cs.config[base.JobHistoryTopic] != "" {
+		cs.publishJobHistory()
+	}
+
+	go cs.handleReloads(cs.bus.Subscribe(base.ConfigReloadTopic))
+	cs.recoverTasks()
+	cs.monitorTasks(base.Tasks)
 	go cs.doHeartbeatsThroughZooKeeper()
 	go cs.reportStatus()
+	cs.slo.Start()
+	cs.sinks.Start()
+	if cs.alerts != nil {
+		cs.alerts.Start()
+	}
 
 	glog.Infof("CollectService started...")
 }
 
+// JobHistory returns the run history of the jobs collected by this service
+func (cs *CollectService) JobHistory() *base.JobHistory {
+	return cs.jobFactory.JobHistory()
+}
+
+// SLOReports returns the last SLO evaluation of the tasks which have
+// objectives, see base.ParseSLO
+func (cs *CollectService) SLOReports() []base.SLOReport {
+	return cs.slo.Reports()
+}
+
+// JobHealth returns the health scores of the jobs
+func (cs *CollectService) JobHealth() []base.JobHealth {
+	return cs.health.Health()
+}
+
+// CheckpointHistory returns the checkpoint transitions of the jobs
+func (cs *CollectService) CheckpointHistory() *base.CheckpointHistory {
+	return cs.jobFactory.CheckpointHistory()
+}
+
+// RollbackCheckpoint rolls the checkpoint key back to the time at, see
+// base.CheckpointHistory.Rollback. The cached job of its task is stopped and
+// dropped before, the next cycle of the task re-creates the job from the
+// rolled back checkpoint. A cycle in progress may still checkpoint after the
+// rollback, which shows in the history. Long running tasks resume when they
+// are published again
+func (cs *CollectService) RollbackCheckpoint(key string, at time.Time) (*base.CheckpointTransition, error) {
+	history := cs.jobFactory.CheckpointHistory()
+	task := history.Task(key)
+
+	cs.jobsMutex.Lock()
+	if job, ok := cs.jobs[task]; ok {
+		job.Stop()
+		delete(cs.jobs, task)
+	}
+	cs.jobsMutex.Unlock()
+	return history.Rollback(key, at)
+}
+
+// Reload applies the changes of the reloadable global configs, see
+// base.ReloadableConfigs. Other configs are ignored and the running jobs are
+// not interrupted
+// @Return: the changed configs
+func (cs *CollectService) Reload(config base.BaseConfig) base.BaseConfig {
+	cs.globalsMutex.Lock()
+	diff := base.DiffConfig(cs.globals, config, base.ReloadableConfigs)
+	for k, v := range diff {
+		cs.globals[k] = v
+	}
+	cs.globalsMutex.Unlock()
+
+	if len(diff) > 0 {
+		glog.Infof("Reload global configs=%s", diff)
+		cs.bus.Publish(base.ConfigReloadTopic, diff)
+	}
+	return diff
+}
+
+func (cs *CollectService) handleReloads(reloads <-chan base.BaseConfig) {
+	for diff := range reloads {
+		if level, ok := diff[base.LogLevel]; ok {
+			if err := base.SetLogLevel(level); err != nil {
+				glog.Errorf("Failed to set log level=%s, error=%s", level, err)
+			}
+		}
+
+		if _, ok := diff[base.MaxConcurrentJobs]; ok {
+			concurrency, _ := strconv.Atoi(diff[base.MaxConcurrentJobs])
+			cs.limiter.SetConcurrency(concurrency)
+		}
+
+		if _, ok := diff[base.JobRateLimit]; ok {
+			rate, _ := strconv.ParseFloat(diff[base.JobRateLimit], 64)
+			cs.limiter.SetRate(rate)
+		}
+
+		if _, ok := diff[base.HeartbeatMode]; ok {
+			cs.heartbeatMode.Store(base.GetHeartbeatMode(diff))
+		}
+
+		_, enabledChanged := diff[base.EnabledApps]
+		_, disabledChanged := diff[base.DisabledApps]
+		if enabledChanged || disabledChanged {
+			cs.globalsMutex.Lock()
+			apps := base.BaseConfig{
+				base.EnabledApps:  cs.globals[base.EnabledApps],
+				base.DisabledApps: cs.globals[base.DisabledApps],
+			}
+			cs.globalsMutex.Unlock()
+			cs.jobFactory.SetAppFilter(apps)
+		}
+	}
+}
+
+// JobStates returns the degraded jobs and the jobs failing on configuration
+// errors
+func (cs *CollectService) JobStates() *JobFactory {
+	return cs.jobFactory
+}
+
+// AppCatalog returns the apps registered on the collector, which can be
+// enabled or disabled
+func (cs *CollectService) AppCatalog() *JobFactory {
+	return cs.jobFactory
+}
+
+func (cs *CollectService) configErrorJobs() []string {
+	var keys []string
+	for _, entry := range cs.jobFactory.ConfigErrors() {
+		keys = append(keys, entry.Key)
+	}
+	return keys
+}
+
+func (cs *CollectService) publishJobHistory() {
+	brokerConfig := base.ControlKafkaConfig(cs.config)
+	brokerConfig[base.KafkaTopic] = cs.config[base.JobHistoryTopic]
+
+	writer := kafkawriter.NewKafkaDataWriter(brokerConfig)
+	if writer == nil {
+		glog.Errorf("Failed to create kafka writer for job history topic=%s", cs.config[base.JobHistoryTopic])
+		return
+	}
+	writer.Start()
+	cs.historyWriter = writer
+	cs.jobFactory.JobHistory().SetWriter(writer)
+}
+
+// Stop tears down in order so nothing writes on a closed client: the tasks
+// and the monitors stop being scheduled, the in-flight reads are canceled
+// and the data buffered by the writers are flushed within FlushTimeout, the
+// readers persist their checkpoints once their writers stop, then the
+// clients are closed
 func (cs *CollectService) Stop() {
-	if !atomic.CompareAndSwapInt32(&cs.started, 1, 0) {
-		glog.Infof("CollectService already stopped.")
+	if cs.lifecycle.Stop("CollectService") != nil {
 		return
 	}
 
+	// The tasks read before are still handled
+	if cs.taskMonitor != nil {
+		cs.taskMonitor.Stop()
+	}
+	cs.slo.Stop()
+	cs.sinks.Stop()
+
+	cs.jobsMutex.Lock()
+	var jobs []*ReaderJob
+	for _, job := range cs.jobs {
+		if job, ok := job.(*ReaderJob); ok {
+			job.halt()
+			jobs = append(jobs, job)
+		}
+	}
+	cs.jobsMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), base.GetFlushTimeout(cs.config))
+	defer cancel()
+	cs.drainJobs(ctx, jobs)
+
+	cs.jobsMutex.Lock()
+	for _, job := range cs.jobs {
+		job.Stop()
+	}
+	cs.jobsMutex.Unlock()
+
+	if cs.historyWriter != nil {
+		cs.jobFactory.JobHistory().SetWriter(nil)
+		if err := base.FlushDataWriter(ctx, cs.historyWriter); err != nil {
+			glog.Errorf("Failed to flush the job history, error=%s", err)
+		}
+		cs.historyWriter.Stop()
+	}
+
 	cs.jobFactory.CloseClients()
 	cs.kafkaClient.Close()
 	cs.zkClient.Close()
+	if cs.store != nil {
+		cs.store.Close()
+	}
 
-	for _, job := range cs.jobs {
-		job.Stop()
+	cs.bus.Close()
+	if cs.alerts != nil {
+		cs.alerts.Stop()
 	}
 	glog.Infof("CollectService stopped...")
 }
 
-func (cs *CollectService) doHeartbeats(f func(app string, d map[string]string)) {
+func (cs *CollectService) Status() string {
+	return cs.lifecycle.Status()
+}
+
+// drainJobs drains the jobs concurrently until ctx is done, the jobs not
+// drained by then are stopped anyway with an alert
+func (cs *CollectService) drainJobs(ctx context.Context, jobs []*ReaderJob) {
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *ReaderJob) {
+			defer wg.Done()
+			if err := job.drain(ctx); err != nil {
+				glog.Errorf("Alert: failed to drain job=%s before stopping, error=%s", job.key, err)
+			}
+		}(job)
+	}
+	wg.Wait()
+}
+
+// doHeartbeats calls f every HeartbeatInterval if the current HeartbeatMode
+// is mode or "all". Both can be reloaded
+func (cs *CollectService) doHeartbeats(mode string, f func(app string, d map[string]string)) {
 	stats := map[string]string {
 		base.Host: cs.host,
 		base.Platform: runtime.GOOS,
 		base.App: "",
 		base.CpuCount: fmt.Sprintf("%d", runtime.NumCPU()),
+		base.Labels: cs.config[base.Labels],
 		base.Timestamp: "",
 	}
 
-	ticker := time.Tick(heartbeatInterval)
-	for atomic.LoadInt32(&cs.started) != 0 {
+	reloads := cs.bus.Subscribe(base.ConfigReloadTopic)
+	ticker := cs.clock.NewTicker(base.GetHeartbeatInterval(cs.config))
+	defer func() {
+		ticker.Stop()
+	}()
+
+	for cs.lifecycle.Running() {
 		select {
-		case <-ticker:
-			stats[base.Timestamp] = fmt.Sprintf("%d", time.Now().UnixNano())
+		case diff, ok := <-reloads:
+			if !ok {
+				return
+			}
+
+			if _, changed := diff[base.HeartbeatInterval]; changed {
+				ticker.Stop()
+				ticker = cs.clock.NewTicker(base.GetHeartbeatInterval(diff))
+			}
+		case <-ticker.C():
+			current := cs.heartbeatMode.Load().(string)
+			if current != base.HeartbeatModeAll && current != mode {
+				continue
+			}
+
+			stats[base.Timestamp] = fmt.Sprintf("%d", cs.clock.Now().UnixNano())
+			stats[base.DegradedJobs] = strings.Join(cs.jobFactory.DegradedJobs(), ";")
+			stats[base.ConfigErrorJobs] = strings.Join(cs.configErrorJobs(), ";")
+			stats[base.FailedSinks] = strings.Join(cs.jobFactory.FailedSinks(), ";")
+			stats[base.ContractViolations] = strings.Join(cs.jobFactory.ContractViolations(), ";")
+			stats[base.SinkLatencies] = strings.Join(cs.jobFactory.SinkLatencies(), ";")
+			stats[base.CatchUpJobs] = strings.Join(cs.jobFactory.CatchUpJobs(), ";")
+			stats[base.RunningJobs] = strings.Join(cs.runningJobs(), ";")
+			stats[base.HTTPProtocols] = strings.Join(base.NegotiatedProtocols(), ";")
+			stats[base.HTTPTransport] = base.FormatHTTPTransportStats(base.HTTPTransportStatsOf())
+			stats[base.NodeHealth] = strings.Join(base.EndpointHealthStats(), ";")
+			healths := cs.health.Health()
+			stats[base.InstanceHealth] = base.FormatInstanceHealth(base.AggregateInstanceHealth(healths))
+			stats[base.UnhealthyJobs] = unhealthyJobs(healths)
+			stats[base.TaskSchemaVersion] = fmt.Sprintf("%d", base.SupportedTaskSchemaVersion)
+			stats[base.InflightBytes] = fmt.Sprintf("%d", base.InflightBytesOf(""))
+			sinkStats := aggregateSinkStats(cs.SinkStats())
+			stats[base.SinkQueueDepth] = fmt.Sprintf("%d", sinkStats.QueueDepth)
+			stats[base.SinkOldestAge] = fmt.Sprintf("%d", int64(sinkStats.OldestAge))
+			stats[base.SinkDropped] = fmt.Sprintf("%d", sinkStats.Dropped)
+			stats[base.SaturatedSinks] = strings.Join(cs.sinks.Saturated(), ";")
+			records, bytes := cs.jobFactory.JobHistory().Totals()
+			stats[base.RecordsWritten] = fmt.Sprintf("%d", records)
+			stats[base.BytesWritten] = fmt.Sprintf("%d", bytes)
+			shapedWrites, shapingDelay := base.ShapingStats()
+			stats[base.ShapedWrites] = fmt.Sprintf("%d", shapedWrites)
+			stats[base.ShapingDelay] = fmt.Sprintf("%d", int64(shapingDelay))
 			for _, app := range cs.jobFactory.Apps() {
 				stats[base.App] = app
 				f(app, stats)
@@ -106,11 +406,44 @@ func (cs *CollectService) doHeartbeats(f func(app string, d map[string]string))
 	}
 }
 
+// unhealthyJobs returns "key=score" of the jobs scored below 100 joined by ";"
+func unhealthyJobs(healths []base.JobHealth) string {
+	var res []string
+	for _, health := range healths {
+		if health.Score < 100 {
+			res = append(res, fmt.Sprintf("%s=%d", health.Key, health.Score))
+		}
+	}
+	return strings.Join(res, ";")
+}
+
+// aggregateSinkStats returns the total queue depth and drops of the sinks
+// with the age of the oldest data buffered by any of them
+func aggregateSinkStats(sinks map[string]base.SinkStats) base.SinkStats {
+	var res base.SinkStats
+	for _, stats := range sinks {
+		res.QueueDepth += stats.QueueDepth
+		res.Dropped += stats.Dropped
+		if stats.OldestAge > res.OldestAge {
+			res.OldestAge = stats.OldestAge
+		}
+	}
+	return res
+}
+
 func (cs *CollectService) doHeartbeatsThroughZooKeeper() {
-	// FIXME session expiration/network outage ?
+	// The heartbeat nodes are ephemeral, ZooKeeperClient re-creates them
+	// after session expiration. Register with labels at startup so the scheduler can honor placement
+	// constraints before the first heartbeat arrives
 	for _, app := range cs.jobFactory.Apps() {
+		registration := map[string]string{
+			base.Host:   cs.host,
+			base.App:    app,
+			base.Labels: cs.config[base.Labels],
+		}
+		rawData, _ := json.Marshal(registration)
 		node := base.HeartbeatRoot + "/" + cs.host + "!" + app
-		cs.zkClient.CreateNode(node, nil, true, true)
+		cs.zkClient.CreateNode(node, rawData, true, true)
 	}
 
 	f := func(app string, stats map[string]string) {
@@ -122,14 +455,12 @@ func (cs *CollectService) doHeartbeatsThroughZooKeeper() {
 		node := base.HeartbeatRoot + "/" + cs.host + "!" + app
 		cs.zkClient.SetNode(node, data.RawData[0])
 	}
-	cs.doHeartbeats(f)
+	cs.doHeartbeats(base.HeartbeatModeZooKeeper, f)
 }
 
 func (cs *CollectService) reportStatus() {
-	brokerConfig := base.BaseConfig{
-		base.KafkaBrokers:   cs.config[base.KafkaBrokers],
-		base.KafkaTopic:     base.TaskStats,
-	}
+	brokerConfig := base.ControlKafkaConfig(cs.config)
+	brokerConfig[base.KafkaTopic] = base.TaskStats
 
 	writer := kafkawriter.NewKafkaDataWriter(brokerConfig)
 	if writer == nil {
@@ -145,53 +476,202 @@ func (cs *CollectService) reportStatus() {
 	}
 
 	f := func(app string, stats map[string]string) {
-		var rawData []byte
-		for k, v := range stats {
-			rawData = append(rawData, []byte(k + "=" + v + ",")...)
+		// JSON like the ZooKeeper heartbeats, the values, for e.g. Labels
+		// and FailedSinks, may contain "," and "="
+		rawData, err := json.Marshal(stats)
+		if err != nil {
+			glog.Errorf("Failed to marshal heartbeat, error=%s", err)
+			return
 		}
 		data := &base.Data{
 			MetaInfo: metaInfo,
-			RawData:  [][]byte{rawData[:len(rawData) - 1]},
+			RawData:  [][]byte{rawData},
 		}
 
 		writer.WriteData(data)
 	}
-	cs.doHeartbeats(f)
+	cs.doHeartbeats(base.HeartbeatModeKafka, f)
 }
 
 func (cs *CollectService) monitorTasks(topic string) {
-	checkpoint := base.NewNullCheckpointer()
-	writer := memory.NewMemoryDataWriter()
-	topicPartitions, err := cs.kafkaClient.TopicPartitions(topic)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to get partitions for topic=%s", topic))
+	cs.taskMonitor = NewTaskMonitor(cs.kafkaClient, topic, cs.handleTasks)
+	if err := cs.taskMonitor.Start(); err != nil {
+		panic(fmt.Sprintf("Failed to monitor topic=%s, error=%s", topic, err))
+	}
+}
+
+// TaskRejection is why the last message of a task was rejected
+type TaskRejection struct {
+	Key    string
+	Reason string // one of base.TaskReject*
+	Error  string
+	Time   string
+}
+
+// rejectTask records why the task is not collected and publishes it to
+// TaskNackTopic
+// @reason: one of base.TaskReject*
+func (cs *CollectService) rejectTask(taskConfig base.BaseConfig, reason string, err error) {
+	glog.Errorf("Alert: NACK task=%s, reason=%s, error=%s", taskConfig[base.TaskConfigKey], reason, err)
+
+	cs.rejectMutex.Lock()
+	cs.rejections[taskConfig[base.TaskConfigKey]] = TaskRejection{
+		Key:    taskConfig[base.TaskConfigKey],
+		Reason: reason,
+		Error:  err.Error(),
+		Time:   cs.clock.Now().Format(time.RFC3339),
+	}
+	cs.rejectMutex.Unlock()
+	cs.bus.Publish(base.TaskNackTopic, base.TaskRejectEvent(taskConfig, cs.host, reason, err))
+}
+
+// Rejections returns the tasks whose last message was rejected, ordered by
+// TaskConfigKey
+func (cs *CollectService) Rejections() []TaskRejection {
+	cs.rejectMutex.Lock()
+	defer cs.rejectMutex.Unlock()
+
+	res := make([]TaskRejection, 0, len(cs.rejections))
+	for _, rejection := range cs.rejections {
+		res = append(res, rejection)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+// getOrCreateJob returns nil if the task is rejected, see rejectTask
+func (cs *CollectService) getOrCreateJob(taskConfig base.BaseConfig) base.Job {
+	cs.jobsMutex.Lock()
+	defer cs.jobsMutex.Unlock()
+
+	// FIXME
+	var job base.Job
+	if taskConfig[base.App] == base.KafkaApp {
+		taskConfig[base.LongRun] = "1"
+	} else if j, ok := cs.jobs[taskConfig[base.TaskConfigKey]]; ok {
+		job = j
+		glog.Infof("Use cached collector, app=%s", taskConfig[base.App])
 	}
 
-	for _, partition := range topicPartitions[topic] {
-		config := base.BaseConfig{
-			base.KafkaTopic:        topic,
-			base.KafkaPartition:    fmt.Sprintf("%d", partition),
-		    base.UseOffsetNewest:   "1",
+	// A task of a newer schema would be collected with its new configs
+	// ignored, it is rejected for a collector of the newer release
+	if err := base.CheckTaskSchema(taskConfig); err != nil {
+		cs.rejectTask(taskConfig, base.TaskRejectSchema, err)
+		return nil
+	}
+
+	// The disabled apps are not in the heartbeats, the tasks assigned
+	// before they are disabled are rejected
+	if err := cs.jobFactory.CheckApp(taskConfig[base.App]); err != nil {
+		cs.rejectTask(taskConfig, base.TaskRejectApp, err)
+		return nil
+	}
+
+	if taskConfig[base.TaskConfigAction] == base.TaskConfigUpdate {
+		// The cached job collects what the task was defined by before
+		if cs.definitions.Replace(taskConfig[base.TaskConfigKey], taskConfig) && job != nil {
+			glog.Infof("Task=%s is redefined, recreate its job", taskConfig[base.TaskConfigKey])
+			job.Stop()
+			delete(cs.jobs, taskConfig[base.TaskConfigKey])
+			job = nil
 		}
+	} else if err := cs.definitions.Register(taskConfig[base.TaskConfigKey], taskConfig); err != nil {
+		// Reusing the cached job would collect the other task
+		cs.rejectTask(taskConfig, base.TaskRejectConflict, err)
+		return nil
+	}
 
-		reader := kafkareader.NewKafkaDataReader(cs.kafkaClient, config, writer, checkpoint)
-		if reader == nil {
-			panic("Failed to create kafka reader")
+	if job == nil {
+		job = cs.jobFactory.CreateJob(taskConfig[base.App], taskConfig)
+		if job == nil {
+			// The factories log why, for e.g. the missing configs
+			cs.rejectTask(taskConfig, base.TaskRejectCreation, errors.New(fmt.Sprintf(
+				"Failed to create job of App=%s, Metric=%s, see the log of the collector",
+				taskConfig[base.App], taskConfig[base.Metric])))
+			return nil
 		}
+		cs.jobs[taskConfig[base.TaskConfigKey]] = job
+		job.Start()
+	}
 
-		go func(r base.DataReader, w *memory.MemoryDataWriter) {
-			r.Start()
-			defer r.Stop()
-			go r.IndexData()
+	cs.rejectMutex.Lock()
+	delete(cs.rejections, taskConfig[base.TaskConfigKey])
+	cs.rejectMutex.Unlock()
+	cs.slo.Register(taskConfig)
+	cs.health.Register(taskConfig)
+	return job
+}
 
-			for atomic.LoadInt32(&cs.started) != 0 {
-				select {
-				case data := <-writer.Data():
-					cs.handleTasks(data)
-				}
-			}
-		}(reader, writer)
+// releaseTask stops and drops the job of the task of key, and forgets the
+// task, so it is neither recovered nor reported in the heartbeats
+func (cs *CollectService) releaseTask(key string) {
+	cs.jobsMutex.Lock()
+	job, ok := cs.jobs[key]
+	delete(cs.jobs, key)
+	cs.jobsMutex.Unlock()
+
+	if !ok {
+		return
 	}
+
+	job.Stop()
+	cs.definitions.Unregister(key)
+	if cs.store != nil {
+		if err := cs.store.Delete(base.MetadataTasks, key); err != nil {
+			glog.Errorf("Failed to delete task=%s from metadata store, error=%s", key, err)
+		}
+	}
+	glog.Infof("Released task=%s", key)
+}
+
+// runningJobs returns the keys of the jobs of the collector, ordered
+func (cs *CollectService) runningJobs() []string {
+	cs.jobsMutex.Lock()
+	defer cs.jobsMutex.Unlock()
+
+	keys := make([]string, 0, len(cs.jobs))
+	for key := range cs.jobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recoverTasks re-creates the jobs of the tasks accepted before the restart
+// from the metadata store and resumes the long running ones, the others wait
+// for their next cycle published by the scheduler
+func (cs *CollectService) recoverTasks() {
+	if cs.store == nil {
+		return
+	}
+
+	var tasks []base.BaseConfig
+	err := cs.store.ForEach(base.MetadataTasks, func(key string, value []byte) error {
+		taskConfig := make(base.BaseConfig)
+		if err := json.Unmarshal(value, &taskConfig); err != nil {
+			glog.Errorf("Unexpected config format of task=%s in metadata store, got=%s", key, string(value))
+			return nil
+		}
+		tasks = append(tasks, taskConfig)
+		return nil
+	})
+
+	if err != nil {
+		glog.Errorf("Failed to recover tasks from metadata store, error=%s", err)
+		return
+	}
+
+	for _, taskConfig := range tasks {
+		job := cs.getOrCreateJob(taskConfig)
+		if job == nil {
+			continue
+		}
+
+		if taskConfig[base.LongRun] == "1" {
+			go job.Callback()
+		}
+	}
+	glog.Infof("Recovered %d tasks from metadata store", len(tasks))
 }
 
 // tasks are expected in map[string]string format
@@ -209,33 +689,55 @@ func (cs *CollectService) handleTasks(data *base.Data) {
 			continue
 		}
 
+		if data.MetaInfo[base.Host] != cs.host && data.MetaInfo[base.Host] != base.Broadcast {
+			return
+		}
+
 		if _, ok := taskConfig[base.App]; !ok {
-			glog.Errorf("Invalid config, App is missing in the task=%s", taskConfig)
+			cs.rejectTask(taskConfig, base.TaskRejectInvalid, errors.New("App is missing in the task"))
 			continue
 		}
 
-		if data.MetaInfo[base.Host] != cs.host && data.MetaInfo[base.Host] != base.Broadcast {
-			return
+		// The scheduler moved the task to another collector or deleted it
+		if taskConfig[base.TaskConfigAction] == base.TaskConfigDelete {
+			cs.releaseTask(taskConfig[base.TaskConfigKey])
+			continue
 		}
 
-		// FIXME
-		var job base.Job
-		if taskConfig[base.App] == base.KafkaApp {
-			taskConfig[base.LongRun] = "1"
-		} else if j, ok := cs.jobs[taskConfig[base.TaskConfigKey]]; ok {
-			job = j
-			glog.Infof("Use cached collector, app=%s", taskConfig[base.App])
+		// The rest of the tasks in the message are handled regardless
+		job := cs.getOrCreateJob(taskConfig)
+		if job == nil {
+			continue
 		}
 
-		if job == nil {
-			job = cs.jobFactory.CreateJob(taskConfig[base.App], taskConfig)
-			if job == nil {
-				return
-			}
-			cs.jobs[taskConfig[base.TaskConfigKey]] = job
-			job.Start()
+		if cs.store != nil {
+			cs.store.Put(base.MetadataTasks, taskConfig[base.TaskConfigKey], rawData)
+		}
+
+		if taskConfig[base.LongRun] == "1" {
+			go job.Callback()
+			continue
+		}
+
+		// The sinks buffer too much data, the skipped cycle is picked up
+		// next time
+		if !cs.inflight.Admit(taskConfig) {
+			glog.Warningf("Inflight bytes above high watermark, skip this cycle of task=%s",
+				taskConfig[base.TaskConfigKey])
+			continue
+		}
+
+		// Short lived collection cycles are bounded by MaxConcurrentJobs
+		// and JobRateLimit, the skipped cycle is picked up next time
+		if !cs.limiter.TryAcquire() {
+			glog.Warningf("Job concurrency or rate limit reached, skip this cycle of task=%s",
+				taskConfig[base.TaskConfigKey])
+			continue
 		}
 
-		go cs.jobs[taskConfig[base.TaskConfigKey]].Callback()
+		go func(j base.Job) {
+			defer cs.limiter.Release()
+			j.Callback()
+		}(job)
 	}
 }
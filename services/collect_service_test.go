@@ -0,0 +1,71 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"testing"
+)
+
+// stopJob records whether the job was stopped
+type stopJob struct {
+	*base.BaseJob
+	config  base.BaseConfig
+	stopped bool
+}
+
+func (job *stopJob) Stop() {
+	job.stopped = true
+}
+
+func TestCollectServiceRedefineTask(t *testing.T) {
+	var created []*stopJob
+	factory := NewJobFactory()
+	factory.RegisterJobCreationHandler("fake", func(config base.BaseConfig) base.Job {
+		job := &stopJob{BaseJob: base.NewJob(nil, 0, 60, config), config: config}
+		created = append(created, job)
+		return job
+	})
+
+	bus := base.NewEventBus()
+	cs := &CollectService{
+		jobFactory:  factory,
+		jobs:        make(map[string]base.Job),
+		definitions: base.NewTaskDefinitions(),
+		rejections:  make(map[string]TaskRejection),
+		bus:         bus,
+		clock:       base.SystemClock,
+		slo:         NewSLOMonitor(factory.JobHistory(), bus),
+		health:      NewHealthMonitor(factory.JobHistory()),
+	}
+
+	task := func(action, serverURL string) base.BaseConfig {
+		return base.BaseConfig{
+			base.App:              "fake",
+			base.TaskConfigKey:    "/fake/incident",
+			base.ServerURL:        serverURL,
+			base.Username:         "admin",
+			base.Metric:           "incident",
+			base.TaskConfigAction: action,
+		}
+	}
+
+	if cs.getOrCreateJob(task(base.TaskConfigNew, "https://acme.service-now.com")) == nil {
+		t.Fatalf("Expect the job of the new task created")
+	}
+
+	// Another task with the same key is rejected
+	if cs.getOrCreateJob(task(base.TaskConfigNew, "https://other.service-now.com")) != nil || len(cs.Rejections()) != 1 {
+		t.Errorf("Expect the conflicting task rejected, got %v", cs.Rejections())
+	}
+
+	// The task updated with another ServerURL replaces the job
+	job := cs.getOrCreateJob(task(base.TaskConfigUpdate, "https://other.service-now.com"))
+	if job == nil || len(created) != 2 || job != created[1] || !created[0].stopped ||
+		created[1].config[base.ServerURL] != "https://other.service-now.com" || len(cs.Rejections()) != 0 {
+		t.Fatalf("Expect the job recreated for the new identity, got %d jobs, rejections=%v", len(created), cs.Rejections())
+	}
+
+	// The later cycles of the updated task reuse the new job
+	if cs.getOrCreateJob(task(base.TaskConfigUpdate, "https://other.service-now.com")) != job || len(created) != 2 || created[1].stopped {
+		t.Errorf("Expect the job of the updated task reused, got %d jobs", len(created))
+	}
+}
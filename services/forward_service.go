@@ -0,0 +1,279 @@
+package services
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
+	kafkareader "github.com/chenziliang/descartes/sources/kafka"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultForwardConsumerGroup = "descartes_forwarder"
+	defaultForwardLagThreshold  = 10000
+	forwardMonitorInterval      = 30 * time.Second
+)
+
+type forwarder struct {
+	topic     string
+	partition int32
+	target    string
+	reader    *kafkareader.KafkaDataReader
+	counter   *base.CountingDataWriter
+}
+
+// ForwardLag is the lag of a forwarded topic partition
+type ForwardLag struct {
+	Topic     string
+	Partition int32
+	Target    string
+	Lag       int64 // -1 if nothing has been forwarded yet
+	Records   int64
+}
+
+// ForwardService consumes the topics of one Kafka cluster and writes the
+// data to the mapped topics of another, for e.g. cross DC forwarding. New
+// topics matching the rules are picked up while running
+type ForwardService struct {
+	config          base.BaseConfig
+	client          *base.KafkaClient
+	rules           []base.TopicRule
+	transforms      []base.Transform
+	lagThreshold    int64
+	forwarders      map[string]*forwarder // "topic/partition" indexed
+	forwardersMutex sync.Mutex
+	lifecycle       base.Lifecycle
+}
+
+// NewForwardService
+// @config: KafkaBrokers of the source cluster, ForwardBrokers of the target
+// cluster and ForwardTopics rules in base.ParseTopicRules format. Optionally
+// KafkaConsumerGroup, CheckpointMethod for the consumed offsets and
+// ForwardLagThreshold in messages beyond which the lag is warned
+func NewForwardService(config base.BaseConfig) *ForwardService {
+	for _, k := range []string{base.KafkaBrokers, base.ForwardBrokers, base.ForwardTopics} {
+		if config[k] == "" {
+			glog.Errorf("%s is required by ForwardService", k)
+			return nil
+		}
+	}
+
+	rules, err := base.ParseTopicRules(config[base.ForwardTopics])
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", base.ForwardTopics, err)
+		return nil
+	}
+
+	lagThreshold := int64(defaultForwardLagThreshold)
+	if config[base.ForwardLagThreshold] != "" {
+		lagThreshold, err = strconv.ParseInt(config[base.ForwardLagThreshold], 10, 64)
+		if err != nil {
+			glog.Errorf("Invalid %s=%s", base.ForwardLagThreshold, config[base.ForwardLagThreshold])
+			return nil
+		}
+	}
+
+	if config[base.KafkaConsumerGroup] == "" {
+		config[base.KafkaConsumerGroup] = defaultForwardConsumerGroup
+	}
+
+	client := base.NewKafkaClient(config, "ForwardClient")
+	if client == nil {
+		return nil
+	}
+
+	return &ForwardService{
+		config:       config,
+		client:       client,
+		rules:        rules,
+		lagThreshold: lagThreshold,
+		forwarders:   make(map[string]*forwarder),
+	}
+}
+
+// AddTransform appends transform applied to the data before it is written
+// to the target cluster, shall be called before Start
+func (fs *ForwardService) AddTransform(transform base.Transform) {
+	fs.transforms = append(fs.transforms, transform)
+}
+
+func (fs *ForwardService) Start() {
+	if fs.lifecycle.Start("ForwardService") != nil {
+		return
+	}
+
+	fs.forwardNewTopicPartitions()
+	go fs.monitor()
+	glog.Infof("ForwardService started...")
+}
+
+func (fs *ForwardService) Stop() {
+	if fs.lifecycle.Stop("ForwardService") != nil {
+		return
+	}
+
+	fs.forwardersMutex.Lock()
+	for _, f := range fs.forwarders {
+		f.reader.Stop()
+	}
+	fs.forwardersMutex.Unlock()
+	fs.client.Close()
+	glog.Infof("ForwardService stopped...")
+}
+
+func (fs *ForwardService) Status() string {
+	return fs.lifecycle.Status()
+}
+
+// Lags returns the lag of the forwarded topic partitions, ordered by topic
+// and partition
+func (fs *ForwardService) Lags() []ForwardLag {
+	fs.forwardersMutex.Lock()
+	forwarders := make([]*forwarder, 0, len(fs.forwarders))
+	for _, f := range fs.forwarders {
+		forwarders = append(forwarders, f)
+	}
+	fs.forwardersMutex.Unlock()
+
+	lags := make([]ForwardLag, 0, len(forwarders))
+	for _, f := range forwarders {
+		lag := ForwardLag{
+			Topic:     f.topic,
+			Partition: f.partition,
+			Target:    f.target,
+			Lag:       -1,
+		}
+		lag.Records, _ = f.counter.Stats()
+
+		if offset := f.reader.Offset(); offset >= 0 {
+			latest, err := fs.client.GetProducerOffset(f.topic, f.partition)
+			if err == nil && latest >= offset {
+				lag.Lag = latest - offset
+			}
+		}
+		lags = append(lags, lag)
+	}
+
+	sort.Sort(forwardLagSorter(lags))
+	return lags
+}
+
+func (fs *ForwardService) monitor() {
+	ticker := time.NewTicker(forwardMonitorInterval)
+	defer ticker.Stop()
+
+	for fs.lifecycle.Running() {
+		select {
+		case <-ticker.C:
+			fs.forwardNewTopicPartitions()
+			for _, lag := range fs.Lags() {
+				if lag.Lag > fs.lagThreshold {
+					glog.Warningf("Forward lag of topic=%s, partition=%d to topic=%s is %d messages, beyond threshold=%d",
+						lag.Topic, lag.Partition, lag.Target, lag.Lag, fs.lagThreshold)
+				}
+			}
+		}
+	}
+}
+
+// forwardNewTopicPartitions starts forwarding the topic partitions matching
+// the rules which are not forwarded yet
+func (fs *ForwardService) forwardNewTopicPartitions() {
+	topicPartitions, err := fs.client.TopicPartitions("")
+	if err != nil {
+		glog.Errorf("Failed to get topic partitions, error=%s", err)
+		return
+	}
+
+	fs.forwardersMutex.Lock()
+	defer fs.forwardersMutex.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		target, ok := base.MapTopic(fs.rules, topic)
+		if !ok {
+			continue
+		}
+
+		for _, partition := range partitions {
+			key := fmt.Sprintf("%s/%d", topic, partition)
+			if _, ok := fs.forwarders[key]; ok {
+				continue
+			}
+
+			f := fs.newForwarder(topic, partition, target)
+			if f == nil {
+				continue
+			}
+			fs.forwarders[key] = f
+
+			f.reader.Start()
+			go f.reader.IndexData()
+			glog.Infof("Forward topic=%s, partition=%d to topic=%s", topic, partition, target)
+		}
+	}
+}
+
+func (fs *ForwardService) newForwarder(topic string, partition int32, target string) *forwarder {
+	brokerConfig := base.BaseConfig{
+		base.KafkaBrokers: fs.config[base.ForwardBrokers],
+		base.KafkaTopic:   target,
+	}
+	for _, k := range []string{base.Compression, base.CompressionLevel, base.CompressionDict} {
+		brokerConfig[k] = fs.config[k]
+	}
+
+	sink := kafkawriter.NewKafkaDataWriter(brokerConfig)
+	if sink == nil {
+		return nil
+	}
+	counter := base.NewCountingDataWriter(base.NewTransformingDataWriter(sink, fs.transforms...))
+
+	config := make(base.BaseConfig, len(fs.config)+3)
+	for k, v := range fs.config {
+		config[k] = v
+	}
+	config[base.KafkaTopic] = topic
+	config[base.KafkaPartition] = strconv.Itoa(int(partition))
+	keyParts := []string{"", config[base.KafkaConsumerGroup], topic, config[base.KafkaPartition]}
+	config[base.Key] = strings.Join(keyParts, "/")
+
+	checkpoint := createCheckpointer(config)
+	if checkpoint == nil {
+		return nil
+	}
+
+	reader := kafkareader.NewKafkaDataReader(fs.client, config, counter, checkpoint)
+	if reader == nil {
+		return nil
+	}
+
+	return &forwarder{
+		topic:     topic,
+		partition: partition,
+		target:    target,
+		reader:    reader,
+		counter:   counter,
+	}
+}
+
+type forwardLagSorter []ForwardLag
+
+func (lags forwardLagSorter) Len() int {
+	return len(lags)
+}
+
+func (lags forwardLagSorter) Swap(i, j int) {
+	lags[i], lags[j] = lags[j], lags[i]
+}
+
+func (lags forwardLagSorter) Less(i, j int) bool {
+	if lags[i].Topic != lags[j].Topic {
+		return lags[i].Topic < lags[j].Topic
+	}
+	return lags[i].Partition < lags[j].Partition
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type healthTask struct {
+	instance string
+	interval time.Duration
+}
+
+// HealthMonitor scores the jobs of the collector by their JobHistory, the
+// scores are evaluated on demand, for e.g. with each heartbeat
+type HealthMonitor struct {
+	history *base.JobHistory
+	tasks   map[string]healthTask // TaskConfigKey indexed
+	mutex   sync.Mutex
+}
+
+func NewHealthMonitor(history *base.JobHistory) *HealthMonitor {
+	return &HealthMonitor{
+		history: history,
+		tasks:   make(map[string]healthTask),
+	}
+}
+
+// Register replaces the instance and interval of the task
+func (monitor *HealthMonitor) Register(task base.BaseConfig) {
+	interval, _ := strconv.ParseInt(task[base.Interval], 10, 64)
+
+	monitor.mutex.Lock()
+	monitor.tasks[task[base.TaskConfigKey]] = healthTask{
+		instance: base.NormalizeServerURL(task[base.ServerURL]),
+		interval: time.Duration(interval) * time.Second,
+	}
+	monitor.mutex.Unlock()
+}
+
+// Health returns the health of the registered jobs ordered by TaskConfigKey
+func (monitor *HealthMonitor) Health() []base.JobHealth {
+	monitor.mutex.Lock()
+	tasks := make(map[string]healthTask, len(monitor.tasks))
+	for key, task := range monitor.tasks {
+		tasks[key] = task
+	}
+	monitor.mutex.Unlock()
+
+	now := time.Now()
+	healths := make([]base.JobHealth, 0, len(tasks))
+	for key, task := range tasks {
+		healths = append(healths, base.EvaluateJobHealth(key, task.instance, monitor.history.Runs(key), task.interval, now))
+	}
+	sort.Sort(jobHealthSorter(healths))
+	return healths
+}
+
+type jobHealthSorter []base.JobHealth
+
+func (healths jobHealthSorter) Len() int {
+	return len(healths)
+}
+
+func (healths jobHealthSorter) Swap(i, j int) {
+	healths[i], healths[j] = healths[j], healths[i]
+}
+
+func (healths jobHealthSorter) Less(i, j int) bool {
+	return healths[i].Key < healths[j].Key
+}
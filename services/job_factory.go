@@ -2,16 +2,27 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/blackhole"
+	"github.com/chenziliang/descartes/sinks/failover"
 	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
+	"github.com/chenziliang/descartes/sinks/multi"
 	"github.com/chenziliang/descartes/sinks/splunk"
+	"github.com/chenziliang/descartes/sinks/spool"
+	"github.com/chenziliang/descartes/sources/composite"
 	kafkareader "github.com/chenziliang/descartes/sources/kafka"
 	"github.com/chenziliang/descartes/sources/snow"
+	"github.com/chenziliang/descartes/sources/subprocess"
 	"github.com/golang/glog"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,40 +39,184 @@ func GenerateTopic(app, serverURL, username string) string {
 	return strings.Join([]string{app, url, username}, "_")
 }
 
+// createCheckpointer returns a CheckpointMethod checkpointer whose reads are
+// CRC verified, and which keeps CheckpointVersions previous versions to fall
+// back to on corruption. With FaultInjection, some of the writes fail, see
+// base.FaultInjector
 func createCheckpointer(config base.BaseConfig) base.Checkpointer {
+	var checkpoint base.Checkpointer
+	versions := base.GetCheckpointVersions(config)
 	switch config[base.CheckpointMethod] {
-	case "zookeeper":
-		return base.NewZooKeeperCheckpointer(config)
 	case "cassandra":
-		return base.NewCassandraCheckpointer(config)
+		ck := base.NewCassandraCheckpointer(config)
+		if ck == nil {
+			return nil
+		}
+		checkpoint = ck
 	case "kafka":
 		client := base.NewKafkaClient(config, "")
 		if client == nil {
 			return nil
 		}
-		return base.NewKafkaCheckpointer(client)
+		checkpoint = base.NewKafkaCheckpointer(client)
+		// Kafka checkpoints are the last message of the topic, there are
+		// no addressable versions
+		versions = 0
 	case "localfile":
-		return base.NewFileCheckpointer()
+		checkpoint = base.NewFileCheckpointer()
+	case "null":
+		// Neither read nor written, for e.g. run once jobs
+		return base.NewNullCheckpointer()
+	default:
+		ck := base.NewZooKeeperCheckpointer(config)
+		if ck == nil {
+			return nil
+		}
+		checkpoint = ck
 	}
-	return base.NewZooKeeperCheckpointer(config)
+	return base.NewFaultInjector(config).WrapCheckpointer(base.NewVerifiedCheckpointer(checkpoint, versions))
 }
 
 type ReaderJob struct {
 	*base.BaseJob
-	reader base.DataReader
+	key     string
+	reader  base.DataReader
+	counter *base.CountingDataWriter
+	history *base.JobHistory
+	factory *JobFactory
 	zkClient *base.ZooKeeperClient
+	checkpoint base.Checkpointer
+	config     base.BaseConfig // checkpoint key info
+	running    int32 // collection cycles in progress
+	stopping   int32
+	interval   int64 // Interval in nano seconds
+	catchUp    int64 // CatchUpInterval in nano seconds, 0 if the job doesn't catch up
 }
 
 func (job *ReaderJob) call(params base.JobParam) error {
-	go job.reader.IndexData()
+	if atomic.LoadInt32(&job.stopping) != 0 {
+		return nil
+	}
+
+	atomic.AddInt32(&job.running, 1)
+	go func() {
+		defer atomic.AddInt32(&job.running, -1)
+		job.indexData()
+	}()
 	return nil
 }
 
+// indexData runs one collection cycle and records it in the job history,
+// unless it is skipped
+func (job *ReaderJob) indexData() error {
+	// Jobs failing on configuration errors are re-checked at escalating
+	// intervals instead of in every cycle
+	if !job.factory.configErrors.Allow(job.key, time.Now()) {
+		return base.ErrSkipped
+	}
+
+	records, bytes := job.counter.Stats()
+	run := base.JobRun{
+		Key:       job.key,
+		StartTime: time.Now().UnixNano(),
+		Outcome:   base.JobRunSuccess,
+	}
+
+	// A panic fails this run and marks the job degraded until a later run
+	// succeeds, the other jobs keep running
+	err := base.CallSafely(job.key, job.reader.IndexData)
+	if err == base.ErrSkipped {
+		return err
+	}
+
+	// The cycle canceled by the shutdown is not a failure of the job
+	if err != nil && atomic.LoadInt32(&job.stopping) != 0 {
+		glog.Infof("Collection cycle of %s ended by the shutdown, error=%s", job.key, err)
+		return err
+	}
+	_, panicked := err.(*base.PanicError)
+
+	run.EndTime = time.Now().UnixNano()
+	doneRecords, doneBytes := job.counter.Stats()
+	run.Records, run.Bytes = doneRecords-records, doneBytes-bytes
+	if err != nil {
+		run.Outcome = base.JobRunFailure
+		run.Error = err.Error()
+	}
+
+	if panicked {
+		job.factory.setDegraded(job.key, true)
+	} else if err == nil {
+		job.factory.setDegraded(job.key, false)
+	}
+
+	if base.IsConfigError(err) {
+		job.factory.configErrors.Fail(job.key, err, time.Now())
+	} else if err == nil {
+		job.factory.configErrors.Succeed(job.key)
+	}
+	job.history.Record(run)
+	if err != nil {
+		job.factory.publish(base.JobFailureTopic, run.Event())
+	}
+	job.adjustInterval()
+	return err
+}
+
+// adjustInterval runs the job every CatchUpInterval while its reader catches
+// up, every Interval otherwise
+func (job *ReaderJob) adjustInterval() {
+	reader, ok := job.reader.(base.CatchUpDataReader)
+	if !ok || job.catchUp <= 0 {
+		return
+	}
+
+	catchingUp := reader.CatchingUp()
+	interval := job.interval
+	if catchingUp {
+		interval = job.catchUp
+	}
+
+	if job.Interval() != interval {
+		glog.Infof("Job=%s runs every %s, catching up=%v", job.key, time.Duration(interval), catchingUp)
+		job.SetInterval(interval)
+	}
+	job.factory.setCatchingUp(job.key, catchingUp)
+}
+
 func (job *ReaderJob) Start() {
 	job.reader.Start()
 }
 
+// halt stops starting new collection cycles
+func (job *ReaderJob) halt() {
+	atomic.StoreInt32(&job.stopping, 1)
+}
+
+// drain cancels the collection cycle in progress, if the reader supports it,
+// and waits for it before flushing the data buffered by the writers of the
+// job, until ctx is done
+func (job *ReaderJob) drain(ctx context.Context) error {
+	job.halt()
+	if reader, ok := job.reader.(base.CancelableDataReader); ok {
+		reader.Cancel()
+	}
+
+	for atomic.LoadInt32(&job.running) != 0 {
+		select {
+		case <-ctx.Done():
+			return errors.New(fmt.Sprintf("collection cycle still in progress, error=%s", ctx.Err()))
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return base.FlushDataWriter(ctx, job.counter)
+}
+
 func (job *ReaderJob) Stop() {
+	job.halt()
+	if job.catchUp > 0 {
+		job.factory.setCatchingUp(job.key, false)
+	}
 	job.reader.Stop()
 	if job.zkClient != nil {
 		job.zkClient.Close()
@@ -73,37 +228,314 @@ type JobCreationHandler func(config base.BaseConfig) base.Job
 type JobFactory struct {
 	creationTbl map[string]JobCreationHandler
 	clients     map[string]*base.KafkaClient
+	history     *base.JobHistory
+	degraded    map[string]bool // job key indexed
+	degradedMutex sync.Mutex
+	configErrors  *base.NegativeCache
+	multiWriters  map[string]*multi.MultiDataWriter // job key indexed
+	multiMutex    sync.Mutex
+	bus           *base.EventBus // nil if the events are not published
+	checkpoints   *base.CheckpointHistory // nil if the transitions are not recorded
+	preview       base.DataWriter // nil unless the jobs are previewed, see Preview
+	violations    map[string]int64 // job key indexed records missing ExpectedFields
+	contractMutex sync.Mutex
+	catchingUp    map[string]bool // job key indexed
+	catchUpMutex  sync.Mutex
+	quota         *base.RequestQuota // the requests to the snow instances
+	enabledApps   map[string]bool // nil if all of the apps are enabled
+	disabledApps  map[string]bool
+	appsMutex     sync.RWMutex // guards enabledApps and disabledApps
 }
 
 func NewJobFactory() *JobFactory {
 	td := &JobFactory{
 		creationTbl: make(map[string]JobCreationHandler),
 		clients:     make(map[string]*base.KafkaClient),
+		history:     base.NewJobHistory(0),
+		degraded:    make(map[string]bool),
+		configErrors: base.NewNegativeCache(0, 0),
+		multiWriters: make(map[string]*multi.MultiDataWriter),
+		disabledApps: make(map[string]bool),
+		violations:   make(map[string]int64),
+		catchingUp:   make(map[string]bool),
+		quota:        base.NewRequestQuota(),
 	}
+	td.quota.OnWarning(func(warning *base.QuotaWarning) {
+		td.publish(base.QuotaWarningTopic, warning.Event())
+	})
 	td.RegisterJobCreationHandler("snow", td.newSnowJob)
 	td.RegisterJobCreationHandler(base.KafkaApp, td.newKafkaJob)
+	td.RegisterJobCreationHandler(base.SubprocessApp, td.newSubprocessJob)
 	return td
 }
 
 func (factory *JobFactory) CreateJob(app string, config base.BaseConfig) base.Job {
-	if createFunc, ok := factory.creationTbl[app]; ok {
-		return createFunc(config)
-	} else {
-		glog.Errorf("%s is not registed.", app)
+	if err := factory.CheckApp(app); err != nil {
+		glog.Errorf("Failed to create job, error=%s", err)
 		return nil
 	}
+	return factory.creationTbl[app](config)
+}
+
+// CheckApp returns error if app is not registered or it is disabled on this
+// collector, its tasks shall be rejected then
+func (factory *JobFactory) CheckApp(app string) error {
+	if _, ok := factory.creationTbl[app]; !ok {
+		return errors.New(fmt.Sprintf("App=%s is not registered", app))
+	}
+
+	if !factory.appEnabled(app) {
+		return errors.New(fmt.Sprintf("App=%s is disabled on this collector", app))
+	}
+	return nil
 }
 
+// Apps returns the enabled apps ordered by name, the collector only takes
+// the tasks of them
 func (factory *JobFactory) Apps() []string {
 	var apps []string
-	for app, _ := range factory.creationTbl {
-		apps = append(apps, app)
+	for app, enabled := range factory.AppCatalog() {
+		if enabled {
+			apps = append(apps, app)
+		}
 	}
+	sort.Strings(apps)
 	return apps
 }
 
+// AppCatalog returns the registered apps and whether they are enabled
+func (factory *JobFactory) AppCatalog() map[string]bool {
+	catalog := make(map[string]bool, len(factory.creationTbl))
+	for app := range factory.creationTbl {
+		catalog[app] = factory.appEnabled(app)
+	}
+	return catalog
+}
+
+func (factory *JobFactory) appEnabled(app string) bool {
+	factory.appsMutex.RLock()
+	defer factory.appsMutex.RUnlock()
+	return !factory.disabledApps[app] && (factory.enabledApps == nil || factory.enabledApps[app])
+}
+
+// SetAppFilter enables the apps of EnabledApps, all of them if it is empty,
+// except those of DisabledApps. Both are separated by ",", for e.g.
+// EnabledApps "snow" for the fleet which only collects snow. It overrides
+// the apps enabled or disabled by SetAppEnabled
+func (factory *JobFactory) SetAppFilter(config base.BaseConfig) {
+	var enabled map[string]bool
+	if config[base.EnabledApps] != "" {
+		enabled = parseApps(config[base.EnabledApps])
+	}
+
+	factory.appsMutex.Lock()
+	factory.enabledApps = enabled
+	factory.disabledApps = parseApps(config[base.DisabledApps])
+	factory.appsMutex.Unlock()
+	glog.Infof("Enabled apps=%s", factory.Apps())
+}
+
+// SetAppEnabled enables or disables app until SetAppFilter is called again.
+// The jobs of app already created keep running when it is disabled
+func (factory *JobFactory) SetAppEnabled(app string, enabled bool) error {
+	if _, ok := factory.creationTbl[app]; !ok {
+		return errors.New(fmt.Sprintf("App=%s is not registered", app))
+	}
+
+	factory.appsMutex.Lock()
+	if enabled {
+		delete(factory.disabledApps, app)
+		if factory.enabledApps != nil {
+			factory.enabledApps[app] = true
+		}
+	} else {
+		factory.disabledApps[app] = true
+	}
+	factory.appsMutex.Unlock()
+	glog.Infof("Set App=%s enabled=%t", app, enabled)
+	return nil
+}
+
+func parseApps(apps string) map[string]bool {
+	res := make(map[string]bool)
+	for _, app := range strings.Split(apps, ",") {
+		if app = strings.TrimSpace(app); app != "" {
+			res[app] = true
+		}
+	}
+	return res
+}
+
+// SetEventBus publishes the failed runs, the data gaps and the credential
+// health of the jobs to JobFailureTopic, DataGapTopic and
+// CredentialHealthTopic of bus. It shall be called before the jobs are
+// created
+func (factory *JobFactory) SetEventBus(bus *base.EventBus) {
+	factory.bus = bus
+}
+
+// SetCheckpointHistory records the checkpoint transitions of the jobs in
+// history. It shall be called before the jobs are created
+func (factory *JobFactory) SetCheckpointHistory(history *base.CheckpointHistory) {
+	factory.checkpoints = history
+}
+
+// CheckpointHistory returns nil if the transitions are not recorded
+func (factory *JobFactory) CheckpointHistory() *base.CheckpointHistory {
+	return factory.checkpoints
+}
+
+// newCheckpointer is createCheckpointer recording the transitions in the
+// CheckpointHistory of the factory
+func (factory *JobFactory) newCheckpointer(config base.BaseConfig) base.Checkpointer {
+	checkpoint := createCheckpointer(config)
+	if checkpoint != nil && factory.preview != nil {
+		return base.NewReadOnlyCheckpointer(checkpoint)
+	}
+
+	if checkpoint == nil || factory.checkpoints == nil || config[base.CheckpointMethod] == "null" {
+		return checkpoint
+	}
+	return base.NewHistoryCheckpointer(checkpoint, factory.checkpoints)
+}
+
+func (factory *JobFactory) publish(topic string, event base.BaseConfig) {
+	if factory.bus != nil {
+		factory.bus.Publish(topic, event)
+	}
+}
+
+// JobHistory returns the run history of the reader jobs created by the factory
+func (factory *JobFactory) JobHistory() *base.JobHistory {
+	return factory.history
+}
+
+// DegradedJobs returns the keys of the jobs whose last run panicked and
+// have not succeeded since then
+func (factory *JobFactory) DegradedJobs() []string {
+	factory.degradedMutex.Lock()
+	defer factory.degradedMutex.Unlock()
+
+	var keys []string
+	for key := range factory.degraded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CatchUpJobs returns the keys of the jobs which are catching up, see
+// base.CatchUpLag
+func (factory *JobFactory) CatchUpJobs() []string {
+	factory.catchUpMutex.Lock()
+	defer factory.catchUpMutex.Unlock()
+
+	var keys []string
+	for key := range factory.catchingUp {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (factory *JobFactory) setCatchingUp(key string, catchingUp bool) {
+	factory.catchUpMutex.Lock()
+	defer factory.catchUpMutex.Unlock()
+
+	if catchingUp {
+		factory.catchingUp[key] = true
+	} else {
+		delete(factory.catchingUp, key)
+	}
+}
+
+// ConfigErrors returns the jobs which are failing on configuration errors
+func (factory *JobFactory) ConfigErrors() []base.NegativeCacheEntry {
+	return factory.configErrors.Entries()
+}
+
+// FailedSinks returns "<job key>:<sink>" of the fan-out sinks which stopped
+// acknowledging, the checkpoint of their jobs only advances with the others
+func (factory *JobFactory) FailedSinks() []string {
+	factory.multiMutex.Lock()
+	defer factory.multiMutex.Unlock()
+
+	var res []string
+	for key, writer := range factory.multiWriters {
+		for _, name := range writer.FailedSinks() {
+			res = append(res, key+":"+name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// SinkLatencies returns "<job key>:<sink>=<seconds>" of the fan-out sinks,
+// the moving average of their write latency
+func (factory *JobFactory) SinkLatencies() []string {
+	factory.multiMutex.Lock()
+	defer factory.multiMutex.Unlock()
+
+	var res []string
+	for key, writer := range factory.multiWriters {
+		for name, latency := range writer.SinkLatencies() {
+			res = append(res, fmt.Sprintf("%s:%s=%.3f", key, name, latency.Seconds()))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ContractViolations returns "<job key>=<records>" of the jobs which wrote
+// records missing their ExpectedFields
+func (factory *JobFactory) ContractViolations() []string {
+	factory.contractMutex.Lock()
+	defer factory.contractMutex.Unlock()
+
+	var res []string
+	for key, n := range factory.violations {
+		res = append(res, fmt.Sprintf("%s=%d", key, n))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// withContractCheck checks the records written to sink against the
+// ExpectedFields of config, see base.NewContractCheck
+func (factory *JobFactory) withContractCheck(sink base.DataWriter, config base.BaseConfig) base.DataWriter {
+	check := base.NewContractCheck(config, func(violation *base.ContractViolation) {
+		glog.Warningf("%d of %d records of %s miss expected fields=%s", violation.Violated,
+			violation.Records, violation.Key, violation.Event()["Missing"])
+
+		factory.contractMutex.Lock()
+		factory.violations[violation.Key] += int64(violation.Violated)
+		factory.contractMutex.Unlock()
+		factory.publish(base.ContractViolationTopic, violation.Event())
+	})
+
+	if check == nil {
+		return sink
+	}
+	return base.NewTransformingDataWriter(sink, check)
+}
+
+func (factory *JobFactory) setDegraded(key string, degraded bool) {
+	factory.degradedMutex.Lock()
+	defer factory.degradedMutex.Unlock()
+
+	if degraded {
+		if !factory.degraded[key] {
+			glog.Warningf("Job=%s is degraded", key)
+		}
+		factory.degraded[key] = true
+	} else if factory.degraded[key] {
+		glog.Infof("Job=%s recovered", key)
+		delete(factory.degraded, key)
+	}
+}
+
 func (factory *JobFactory) getKafkaClient(config base.BaseConfig) *base.KafkaClient {
-	brokers := strings.Split(config[base.KafkaBrokers], ";")
+	brokers := base.KafkaBrokerList(config[base.KafkaBrokers])
 	sort.Sort(sort.StringSlice(brokers))
 	sortedBrokers := strings.Join(brokers, ";")
 
@@ -125,39 +557,267 @@ func (factory *JobFactory) CloseClients() {
 	}
 }
 
+// newKafkaSink creates the Kafka writer of a source task. With
+// FailoverBrokers and/or SpoolDir, the data fails over to the Kafka cluster
+// of FailoverBrokers and then to the disk spool when the primary cluster
+// keeps failing, see failover.FailoverDataWriter
+func newKafkaSink(config base.BaseConfig) base.DataWriter {
+	primary := kafkawriter.NewKafkaDataWriter(config)
+	if primary == nil {
+		return nil
+	}
+	// The injected write failures exercise the failover and the spool
+	primary = base.NewFaultInjector(config).WrapDataWriter(primary)
+
+	if config[base.FailoverBrokers] == "" && config[base.SpoolDir] == "" {
+		return primary
+	}
+
+	names := []string{config[base.KafkaBrokers]}
+	writers := []base.DataWriter{primary}
+	if config[base.FailoverBrokers] != "" {
+		secondaryConfig := make(base.BaseConfig, len(config))
+		for k, v := range config {
+			secondaryConfig[k] = v
+		}
+		secondaryConfig[base.KafkaBrokers] = config[base.FailoverBrokers]
+
+		secondary := kafkawriter.NewKafkaDataWriter(secondaryConfig)
+		if secondary == nil {
+			return nil
+		}
+		names = append(names, config[base.FailoverBrokers])
+		writers = append(writers, secondary)
+	}
+
+	if config[base.SpoolDir] != "" {
+		spoolWriter := spool.NewSpoolDataWriter(config)
+		if spoolWriter == nil {
+			return nil
+		}
+		names = append(names, config[base.SpoolDir])
+		writers = append(writers, spoolWriter)
+	}
+
+	writer := failover.NewFailoverDataWriter(names, writers, config)
+	if writer == nil {
+		return nil
+	}
+	return writer
+}
+
 func (factory *JobFactory) newSnowJob(config base.BaseConfig) base.Job {
 	newConfig := make(base.BaseConfig, len(config))
 	for k, v := range config {
 		newConfig[k] = v
 	}
 
-	writer := kafkawriter.NewKafkaDataWriter(newConfig)
-	if writer == nil {
+	// Dry run validates the task without writing anything to Kafka
+	var sink base.DataWriter
+	if factory.preview != nil {
+		sink = factory.preview
+	} else if config[base.DryRun] == "1" {
+		sink = blackhole.NewBlackholeDataWriter(newConfig)
+	} else {
+		kafkaWriter := newKafkaSink(newConfig)
+		if kafkaWriter == nil {
+			return nil
+		}
+		// The tables of CompositeMetrics share the batches by their MetaInfo
+		sink = base.NewBatchingDataWriter(base.NewThrottledDataWriter(kafkaWriter, newConfig), newConfig)
+	}
+	writer := base.NewCountingDataWriter(factory.withContractCheck(
+		base.NewSequencingDataWriter(sink, config[base.TaskConfigKey]), config))
+
+	// The checkpoints of the composite tables are per table
+	var reader base.DataReader
+	var checkpoint base.Checkpointer
+	if config[base.CompositeMetrics] != "" {
+		keyParts := []string{"", encodeURL(config[base.ServerURL]), config[base.Username], config[base.CompositeMetrics]}
+		config[base.Key] = strings.Join(keyParts, "/")
+		reader = factory.newCompositeSnowReader(config, writer)
+	} else {
+		keyParts := []string{"", encodeURL(config[base.ServerURL]), config[base.Username], config[base.Metric]}
+		config[base.Key] = strings.Join(keyParts, "/")
+		checkpoint = factory.newCheckpointer(config)
+		if checkpoint == nil {
+			return nil
+		}
+		if factory.preview == nil && config[base.DryRun] != "1" {
+			factory.bootstrapSnowCheckpoint(config, checkpoint)
+		}
+		reader = factory.newSnowReader(config, writer, checkpoint)
+	}
+
+	if reader == nil {
 		return nil
 	}
 
-	keyParts := []string{"", encodeURL(config[base.ServerURL]), config[base.Username], config[base.Metric]}
+	interval, err := strconv.ParseInt(config["Interval"], 10, 64)
+	if err != nil {
+		glog.Errorf("Failed to convert %s to integer, error=%s", config["Interval"], err)
+		return nil
+	}
+
+	catchUp, err := catchUpInterval(config, interval)
+	if err != nil {
+		glog.Errorf("Failed to create job=%s, error=%s", config[base.TaskConfigKey], err)
+		return nil
+	}
+
+	interval = interval * int64(time.Second)
+	job := &ReaderJob{
+		BaseJob: base.NewJob(nil, time.Now().UnixNano(), interval, config),
+		key:     config[base.TaskConfigKey],
+		reader:  reader,
+		counter: writer,
+		history: factory.history,
+		factory: factory,
+		checkpoint: checkpoint,
+		config:     config,
+		interval:   interval,
+		catchUp:    catchUp,
+	}
+	job.ResetFunc(job.call)
+	return job
+}
+
+// newSnowReader returns nil if the snow reader can't be created
+func (factory *JobFactory) newSnowReader(config base.BaseConfig, writer base.DataWriter, checkpoint base.Checkpointer) base.DataReader {
+	reader := snow.NewSnowDataReader(config, writer, checkpoint)
+	if reader == nil {
+		return nil
+	}
+
+	for _, gap := range reader.Gaps() {
+		factory.publish(base.DataGapTopic, gap.Event())
+	}
+	reader.OnGap(func(gap *base.TimeGap) {
+		factory.publish(base.DataGapTopic, gap.Event())
+	})
+	reader.OnCredentialHealth(func(health *base.CredentialHealth) {
+		factory.publish(base.CredentialHealthTopic, health.Event())
+	})
+	reader.OnCatchUp(func(catchUp *base.CatchUp) {
+		factory.publish(base.CatchUpTopic, catchUp.Event())
+	})
+	reader.SetRequestQuota(factory.quota)
+	return reader
+}
+
+// catchUpInterval returns CatchUpInterval in nano seconds, a quarter of
+// interval by default and at least 1 second, 0 if CatchUpLag is not set
+// @interval: Interval in seconds
+func catchUpInterval(config base.BaseConfig, interval int64) (int64, error) {
+	if config[base.CatchUpLag] == "" {
+		return 0, nil
+	}
+
+	seconds := interval / 4
+	if config[base.CatchUpInterval] != "" {
+		var err error
+		seconds, err = strconv.ParseInt(config[base.CatchUpInterval], 10, 64)
+		if err != nil || seconds <= 0 || seconds > interval {
+			return 0, errors.New(fmt.Sprintf("Invalid %s=%s, expect positive seconds up to %s=%d",
+				base.CatchUpInterval, config[base.CatchUpInterval], base.Interval, interval))
+		}
+	}
+
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds * int64(time.Second), nil
+}
+
+// newCompositeSnowReader merges the tables in CompositeMetrics, "," separated,
+// into one stream ordered by TimestampField. Each table is collected by a
+// snow reader with its own checkpoint
+func (factory *JobFactory) newCompositeSnowReader(config base.BaseConfig, writer base.DataWriter) base.DataReader {
+	reader := composite.NewCompositeDataReader(config, writer)
+	if reader == nil {
+		return nil
+	}
+
+	for _, metric := range strings.Split(config[base.CompositeMetrics], ",") {
+		metric = strings.TrimSpace(metric)
+		if metric == "" {
+			continue
+		}
+
+		tableConfig := make(base.BaseConfig, len(config))
+		for k, v := range config {
+			tableConfig[k] = v
+		}
+		delete(tableConfig, base.CompositeMetrics)
+		tableConfig[base.Metric] = metric
+		keyParts := []string{"", encodeURL(config[base.ServerURL]), config[base.Username], metric}
+		tableConfig[base.Key] = strings.Join(keyParts, "/")
+
+		checkpoint := factory.newCheckpointer(tableConfig)
+		if checkpoint == nil {
+			return nil
+		}
+		if factory.preview == nil && config[base.DryRun] != "1" {
+			factory.bootstrapSnowCheckpoint(tableConfig, checkpoint)
+		}
+
+		err := reader.AddSource(metric, checkpoint, func(writer base.DataWriter, checkpoint base.Checkpointer) base.DataReader {
+			return factory.newSnowReader(tableConfig, writer, checkpoint)
+		})
+		if err != nil {
+			glog.Errorf("Failed to merge table=%s, error=%s", metric, err)
+			return nil
+		}
+	}
+	return reader
+}
+
+// newSubprocessJob collects data from a source running as a child process,
+// see package subprocess for the protocol. The data goes to Kafka like snow
+func (factory *JobFactory) newSubprocessJob(config base.BaseConfig) base.Job {
+	newConfig := make(base.BaseConfig, len(config))
+	for k, v := range config {
+		newConfig[k] = v
+	}
+
+	sink := factory.preview
+	if sink == nil {
+		kafkaWriter := newKafkaSink(newConfig)
+		if kafkaWriter == nil {
+			return nil
+		}
+		sink = base.NewThrottledDataWriter(kafkaWriter, newConfig)
+	}
+	writer := base.NewCountingDataWriter(factory.withContractCheck(
+		base.NewSequencingDataWriter(sink, config[base.TaskConfigKey]), config))
+
+	keyParts := []string{"", base.SubprocessApp, encodeURL(config[base.TaskConfigKey])}
 	config[base.Key] = strings.Join(keyParts, "/")
-	checkpoint := createCheckpointer(config)
+	checkpoint := factory.newCheckpointer(config)
 	if checkpoint == nil {
 		return nil
 	}
 
-	reader := snow.NewSnowDataReader(config, writer, checkpoint)
+	reader := subprocess.NewSubprocessDataReader(config, writer, checkpoint)
 	if reader == nil {
 		return nil
 	}
 
-	interval, err := strconv.ParseInt(config["Interval"], 10, 64)
+	interval, err := strconv.ParseInt(config[base.Interval], 10, 64)
 	if err != nil {
-		glog.Errorf("Failed to convert %s to integer, error=%s", config["Interval"], err)
+		glog.Errorf("Failed to convert %s to integer, error=%s", config[base.Interval], err)
 		return nil
 	}
 
-	interval = interval * int64(time.Second)
 	job := &ReaderJob{
-		BaseJob: base.NewJob(nil, time.Now().UnixNano(), interval, config),
+		BaseJob: base.NewJob(nil, time.Now().UnixNano(), interval*int64(time.Second), config),
+		key:     config[base.TaskConfigKey],
 		reader:  reader,
+		counter: writer,
+		history: factory.history,
+		factory: factory,
+		checkpoint: checkpoint,
+		config:     config,
 	}
 	job.ResetFunc(job.call)
 	return job
@@ -199,26 +859,44 @@ func (factory *JobFactory) newKafkaJob(config base.BaseConfig) (res base.Job) {
 		return nil
 	}
 
-	writer := factory.getDataWriter(config)
-	if writer == nil {
-		return nil
+	sink := factory.preview
+	if sink == nil {
+		sink = factory.getDataWriter(config)
+		if sink == nil {
+			return nil
+		}
 	}
+	writer := base.NewCountingDataWriter(sink)
 
 	keyParts := []string{"", config[base.KafkaTopic], config[base.KafkaPartition]}
 	config[base.Key] = strings.Join(keyParts, "/")
-	checkpoint := createCheckpointer(config)
+	checkpoint := factory.newCheckpointer(config)
 	if checkpoint == nil {
 		return nil
 	}
 
+	if multiWriter, ok := sink.(*multi.MultiDataWriter); ok {
+		checkpoint = multiWriter.Checkpointer(checkpoint)
+	}
+
 	reader := kafkareader.NewKafkaDataReader(client, config, writer, checkpoint)
 	if reader == nil {
 		return nil
 	}
 
+	if gap := reader.Gap(); gap != nil {
+		factory.publish(base.DataGapTopic, gap.Event())
+	}
+
 	job := &ReaderJob{
 		BaseJob: base.NewJob(nil, time.Now().UnixNano(), int64(15 * time.Second), config),
+		key:     config[base.TaskConfigKey],
 		reader:  reader,
+		counter: writer,
+		history: factory.history,
+		factory: factory,
+		checkpoint: checkpoint,
+		config:     config,
 		zkClient: zkClient,
 	}
 
@@ -226,15 +904,61 @@ func (factory *JobFactory) newKafkaJob(config base.BaseConfig) (res base.Job) {
 	return job
 }
 
+// getDataWriter creates the sink of TargetSystemType. Several types separated
+// by "," fan out to all of them, the checkpoint then advances after
+// CheckpointQuorum (all by default) sinks have written the data
 func (factory *JobFactory) getDataWriter(config base.BaseConfig) base.DataWriter {
-	switch config[base.TargetSystemType] {
+	targets := strings.Split(config[base.TargetSystemType], ",")
+	if len(targets) == 1 {
+		return factory.doGetDataWriter(targets[0], config)
+	}
+
+	writers := make(map[string]base.DataWriter, len(targets))
+	for i, target := range targets {
+		writer := factory.doGetDataWriter(strings.TrimSpace(target), config)
+		if writer == nil {
+			return nil
+		}
+		writers[fmt.Sprintf("%s_%d", strings.TrimSpace(target), i)] = writer
+	}
+
+	quorum, _ := strconv.Atoi(config[base.CheckpointQuorum])
+	writer := multi.NewMultiDataWriter(writers, quorum)
+	if writer == nil {
+		return nil
+	}
+
+	// The writes wait for a quorum of the sinks up to SinkAckTimeout seconds
+	if seconds, err := strconv.Atoi(config[base.SinkAckTimeout]); err == nil && seconds > 0 {
+		writer.SetAckTimeout(time.Duration(seconds) * time.Second)
+	}
+
+	factory.multiMutex.Lock()
+	factory.multiWriters[config[base.TaskConfigKey]] = writer
+	factory.multiMutex.Unlock()
+	return writer
+}
+
+// doGetDataWriter returns the sink of target, shaped by SinkRecordRate and
+// SinkByteRate if they are configured
+func (factory *JobFactory) doGetDataWriter(target string, config base.BaseConfig) base.DataWriter {
+	var writer base.DataWriter
+	switch target {
 	case base.Splunk:
-		return splunk.NewSplunkDataWriter(config)
+		splunkWriter := splunk.NewSplunkDataWriter(config)
+		if splunkWriter == nil {
+			return nil
+		}
+		writer = splunkWriter
 	case base.AWSS3:
 		// FIXME
 		return nil
+	case base.Blackhole:
+		writer = blackhole.NewBlackholeDataWriter(config)
+	default:
+		return nil
 	}
-	return nil
+	return base.NewThrottledDataWriter(writer, config)
 }
 
 func (factory *JobFactory) RegisterJobCreationHandler(app string, newFunc JobCreationHandler) {
@@ -5,7 +5,6 @@ import (
 	"github.com/chenziliang/descartes/base"
 	"github.com/golang/glog"
 	"strings"
-	"sync/atomic"
 	"time"
 )
 
@@ -16,12 +15,12 @@ type KafkaMetaDataMonitor struct {
 	topicPartitions     map[string]map[int32]bool
 	topicConfigs        map[string]base.BaseConfig
 	configChan          chan base.BaseConfig
-	started             int32
+	lifecycle           base.Lifecycle
 }
 
 // For now, only support one kafka cluster
 func NewKafkaMetaDataMonitor(config base.BaseConfig, ss *ScheduleService) *KafkaMetaDataMonitor {
-	client := base.NewKafkaClient(config, "MonitorClient")
+	client := base.NewKafkaClient(base.ControlKafkaConfig(config), "MonitorClient")
 
 	monitor := &KafkaMetaDataMonitor{
 		ss:                  ss,
@@ -37,6 +36,14 @@ func NewKafkaMetaDataMonitor(config base.BaseConfig, ss *ScheduleService) *Kafka
 		topicConfig[k] = v
 	}
 
+	// The monitored topics are in the control cluster
+	for _, k := range base.KafkaClusterConfigs {
+		delete(topicConfig, k)
+	}
+	for k, v := range base.ControlKafkaConfig(config) {
+		topicConfig[k] = v
+	}
+
 	for _, topic := range []string{base.TaskStats} {
 		topicConfig[base.KafkaTopic] = topic
 		topicConfig[base.App] = base.KafkaApp
@@ -48,8 +55,7 @@ func NewKafkaMetaDataMonitor(config base.BaseConfig, ss *ScheduleService) *Kafka
 }
 
 func (mon *KafkaMetaDataMonitor) Start() {
-	if !atomic.CompareAndSwapInt32(&mon.started, 0, 1) {
-		glog.Infof("KafkaMetaDataMonitor already started.")
+	if mon.lifecycle.Start("KafkaMetaDataMonitor") != nil {
 		return
 	}
 
@@ -59,8 +65,7 @@ func (mon *KafkaMetaDataMonitor) Start() {
 }
 
 func (mon *KafkaMetaDataMonitor) Stop() {
-	if !atomic.CompareAndSwapInt32(&mon.started, 1, 0) {
-		glog.Infof("KafkaMetaDataMonitor already stopped.")
+	if mon.lifecycle.Stop("KafkaMetaDataMonitor") != nil {
 		return
 	}
 	mon.client.Close()
@@ -68,6 +73,10 @@ func (mon *KafkaMetaDataMonitor) Stop() {
 	glog.Infof("KafkaMetaDataMonitor stopped...")
 }
 
+func (mon *KafkaMetaDataMonitor) Status() string {
+	return mon.lifecycle.Status()
+}
+
 func (mon *KafkaMetaDataMonitor) AddTopicConfig(config base.BaseConfig) {
 	mon.configChan <- config
 }
@@ -83,7 +92,7 @@ func (mon *KafkaMetaDataMonitor) doAddTopicConfig(config base.BaseConfig) {
 
 func (mon *KafkaMetaDataMonitor) monitorNewTopicPartitions() {
     ticker := time.Tick(30 * time.Second)
-	for atomic.LoadInt32(&mon.started) != 0 {
+	for mon.lifecycle.Running() {
 		select {
 		case <-ticker:
 			mon.client.Client().RefreshMetadata()
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	previewKeyPrefix = "_Preview_"
+	// A preview ends with the records collected by then
+	previewTimeout = 30 * time.Second
+)
+
+// Preview runs a bounded collection of task and returns the first n records
+// it would emit, serialized as the sink would get them after the transforms
+// of the job. Nothing is written to the sink, the checkpoint of the task is
+// read but not advanced, so the records are the next ones of the task. The
+// collection ends after n records, one collection cycle or 30 seconds,
+// whichever comes first
+// @config: global config, the settings of task take precedence
+func Preview(config base.BaseConfig, task base.BaseConfig, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid number of records=%d to preview", n))
+	}
+
+	newConfig := mergeTaskConfig(config, task)
+	if newConfig[base.TaskConfigKey] == "" {
+		newConfig[base.TaskConfigKey] = previewKeyPrefix + newConfig[base.Metric]
+	}
+
+	// snow requests no more records than previewed
+	if count, err := strconv.Atoi(newConfig[recordCountKey]); err != nil || count > n {
+		newConfig[recordCountKey] = strconv.Itoa(n)
+	}
+	// A long running preview would hold back the long running task itself
+	delete(newConfig, base.LongRun)
+
+	sink := newPreviewDataWriter(n)
+	factory := NewJobFactory()
+	factory.preview = sink
+	defer factory.CloseClients()
+
+	job := factory.CreateJob(newConfig[base.App], newConfig)
+	if job == nil {
+		return nil, errors.New(fmt.Sprintf("Failed to create job for App=%s", newConfig[base.App]))
+	}
+
+	readerJob, ok := job.(*ReaderJob)
+	if !ok {
+		job.Stop()
+		return nil, errors.New(fmt.Sprintf("App=%s doesn't support preview", newConfig[base.App]))
+	}
+
+	job.Start()
+	defer job.Stop()
+
+	// The cycle is not recorded in the job history
+	done := make(chan error, 1)
+	go func() {
+		done <- base.CallSafely(readerJob.key, readerJob.reader.IndexData)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-sink.full:
+	case <-time.After(previewTimeout):
+		glog.Warningf("Preview of job=%s timed out after %s", readerJob.key, previewTimeout)
+	}
+
+	if reader, ok := readerJob.reader.(base.CancelableDataReader); ok {
+		reader.Cancel()
+	}
+
+	if err != nil && err != base.ErrSkipped {
+		return sink.Records(), err
+	}
+	return sink.Records(), nil
+}
+
+// mergeTaskConfig returns the global config overridden by the settings of
+// task
+func mergeTaskConfig(config base.BaseConfig, task base.BaseConfig) base.BaseConfig {
+	newConfig := make(base.BaseConfig, len(config)+len(task))
+	for k, v := range config {
+		newConfig[k] = v
+	}
+	for k, v := range task {
+		newConfig[k] = v
+	}
+	return newConfig
+}
+
+// previewDataWriter keeps the first records written to it, the others are
+// discarded. full is closed once it has them
+type previewDataWriter struct {
+	max     int
+	records []string
+	full    chan struct{}
+	mutex   sync.Mutex
+}
+
+func newPreviewDataWriter(max int) *previewDataWriter {
+	return &previewDataWriter{
+		max:  max,
+		full: make(chan struct{}),
+	}
+}
+
+func (writer *previewDataWriter) Start() {
+}
+
+func (writer *previewDataWriter) Stop() {
+}
+
+func (writer *previewDataWriter) WriteData(data *base.Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if len(writer.records) >= writer.max {
+		return nil
+	}
+
+	for _, raw := range data.RawData {
+		writer.records = append(writer.records, string(raw))
+		if len(writer.records) >= writer.max {
+			close(writer.full)
+			break
+		}
+	}
+	return nil
+}
+
+func (writer *previewDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *previewDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *previewDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+// Records returns the records kept so far
+func (writer *previewDataWriter) Records() []string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return append([]string{}, writer.records...)
+}
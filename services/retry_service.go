@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
+	kafkareader "github.com/chenziliang/descartes/sources/kafka"
+	"github.com/golang/glog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryConsumerGroup = "descartes_retry"
+	retryMonitorInterval      = 30 * time.Second
+)
+
+// RetryService moves the messages of the retry topics, see
+// base.KafkaRetryDelays, back to their original topics once their delay has
+// passed. The messages of a retry topic have the same delay, so they become
+// due in the order they were written
+type RetryService struct {
+	config       base.BaseConfig
+	client       *base.KafkaClient
+	delays       []base.RetryDelay
+	readers      map[string]*kafkareader.KafkaDataReader // "topic/partition" indexed
+	readersMutex sync.Mutex
+	writer       *redeliveryWriter
+	lifecycle    base.Lifecycle
+}
+
+// NewRetryService
+// @config: KafkaBrokers, KafkaRetryDelays as configured for the Kafka sinks,
+// optionally KafkaConsumerGroup and CheckpointMethod for the consumed offsets
+func NewRetryService(config base.BaseConfig) *RetryService {
+	delays, err := base.ParseRetryDelays(config[base.KafkaRetryDelays])
+	if err != nil || len(delays) == 0 {
+		glog.Errorf("Invalid %s=%s, error=%v", base.KafkaRetryDelays, config[base.KafkaRetryDelays], err)
+		return nil
+	}
+
+	if config[base.KafkaConsumerGroup] == "" {
+		config[base.KafkaConsumerGroup] = defaultRetryConsumerGroup
+	}
+
+	client := base.NewKafkaClient(config, "RetryClient")
+	if client == nil {
+		return nil
+	}
+
+	return &RetryService{
+		config:  config,
+		client:  client,
+		delays:  delays,
+		readers: make(map[string]*kafkareader.KafkaDataReader),
+		writer:  newRedeliveryWriter(config),
+	}
+}
+
+func (rs *RetryService) Start() {
+	if rs.lifecycle.Start("RetryService") != nil {
+		return
+	}
+
+	rs.consumeNewRetryTopics()
+	go rs.monitor()
+	glog.Infof("RetryService started...")
+}
+
+func (rs *RetryService) Stop() {
+	if rs.lifecycle.Stop("RetryService") != nil {
+		return
+	}
+
+	// Wake up the writes waiting for their messages to be due first
+	rs.writer.redeliverNow()
+	rs.readersMutex.Lock()
+	for _, reader := range rs.readers {
+		reader.Stop()
+	}
+	rs.readersMutex.Unlock()
+	rs.writer.close()
+	rs.client.Close()
+	glog.Infof("RetryService stopped...")
+}
+
+func (rs *RetryService) Status() string {
+	return rs.lifecycle.Status()
+}
+
+func (rs *RetryService) monitor() {
+	ticker := time.NewTicker(retryMonitorInterval)
+	defer ticker.Stop()
+
+	for rs.lifecycle.Running() {
+		select {
+		case <-ticker.C:
+			rs.consumeNewRetryTopics()
+		}
+	}
+}
+
+// consumeNewRetryTopics starts consuming the partitions of the retry topics
+// which are not consumed yet
+func (rs *RetryService) consumeNewRetryTopics() {
+	topicPartitions, err := rs.client.TopicPartitions("")
+	if err != nil {
+		glog.Errorf("Failed to get topic partitions, error=%s", err)
+		return
+	}
+
+	rs.readersMutex.Lock()
+	defer rs.readersMutex.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		if !base.IsRetryTopic(topic, rs.delays) {
+			continue
+		}
+
+		for _, partition := range partitions {
+			key := fmt.Sprintf("%s/%d", topic, partition)
+			if _, ok := rs.readers[key]; ok {
+				continue
+			}
+
+			reader := rs.newReader(topic, partition)
+			if reader == nil {
+				continue
+			}
+			rs.readers[key] = reader
+
+			reader.Start()
+			go reader.IndexData()
+			glog.Infof("Redeliver retry topic=%s, partition=%d", topic, partition)
+		}
+	}
+}
+
+func (rs *RetryService) newReader(topic string, partition int32) *kafkareader.KafkaDataReader {
+	config := make(base.BaseConfig, len(rs.config)+4)
+	for k, v := range rs.config {
+		config[k] = v
+	}
+	config[base.KafkaTopic] = topic
+	config[base.KafkaPartition] = strconv.Itoa(int(partition))
+	keyParts := []string{"", config[base.KafkaConsumerGroup], topic, config[base.KafkaPartition]}
+	config[base.Key] = strings.Join(keyParts, "/")
+	// The writes wait until the messages are due
+	config[base.WriteTimeout] = "0"
+
+	checkpoint := createCheckpointer(config)
+	if checkpoint == nil {
+		return nil
+	}
+	return kafkareader.NewKafkaDataReader(rs.client, config, rs.writer, checkpoint)
+}
+
+// redeliveryWriter writes the data of the retry topics to their RetryOrigin
+// topics when RetryAt has passed. It is shared by the retry topic readers
+type redeliveryWriter struct {
+	config       base.BaseConfig
+	writers      map[string]base.DataWriter // origin topic indexed
+	writersMutex sync.Mutex
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+func newRedeliveryWriter(config base.BaseConfig) *redeliveryWriter {
+	return &redeliveryWriter{
+		config:  config,
+		writers: make(map[string]base.DataWriter),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start and Stop are called by every reader, the writers are closed by
+// RetryService.Stop
+func (writer *redeliveryWriter) Start() {
+}
+
+func (writer *redeliveryWriter) Stop() {
+}
+
+func (writer *redeliveryWriter) WriteData(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *redeliveryWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *redeliveryWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+// WriteDataContext waits until data is due. The data which is not due yet
+// is redelivered early when the service stops, so the saved offsets never
+// skip data
+func (writer *redeliveryWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	origin := data.MetaInfo[base.RetryOrigin]
+	if origin == "" {
+		glog.Errorf("%s is missing in the retry message, drop it", base.RetryOrigin)
+		return nil
+	}
+
+	retryAt, _ := strconv.ParseInt(data.MetaInfo[base.RetryAt], 10, 64)
+	if delay := time.Unix(retryAt, 0).Sub(time.Now()); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-writer.done:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	sink := writer.getWriter(origin)
+	if sink == nil {
+		return errors.New(fmt.Sprintf("Failed to create kafka writer for topic=%s", origin))
+	}
+	// Failed async writes go to the retry topic of the next stage
+	return sink.WriteDataAsync(data)
+}
+
+func (writer *redeliveryWriter) getWriter(topic string) base.DataWriter {
+	writer.writersMutex.Lock()
+	defer writer.writersMutex.Unlock()
+
+	if sink, ok := writer.writers[topic]; ok {
+		return sink
+	}
+
+	brokerConfig := base.BaseConfig{
+		base.KafkaBrokers:     writer.config[base.KafkaBrokers],
+		base.KafkaTopic:       topic,
+		base.KafkaRetryDelays: writer.config[base.KafkaRetryDelays],
+	}
+	for _, k := range []string{base.Compression, base.CompressionLevel, base.CompressionDict} {
+		brokerConfig[k] = writer.config[k]
+	}
+
+	sink := kafkawriter.NewKafkaDataWriter(brokerConfig)
+	if sink == nil {
+		return nil
+	}
+	sink.Start()
+	writer.writers[topic] = sink
+	return sink
+}
+
+func (writer *redeliveryWriter) redeliverNow() {
+	writer.closeOnce.Do(func() { close(writer.done) })
+}
+
+func (writer *redeliveryWriter) close() {
+	writer.writersMutex.Lock()
+	for _, sink := range writer.writers {
+		sink.Stop()
+	}
+	writer.writersMutex.Unlock()
+}
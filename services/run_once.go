@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+)
+
+const (
+	runOnceKeyPrefix = "_RunOnce_"
+	endRecordTimeKey = "EndRecordTime"
+	recordCountKey   = "RecordCount"
+)
+
+// RunOnce runs exactly one collection cycle of task and returns the run.
+// The task is not registered and its checkpoint is neither read nor written,
+// so the collection starts from the NextRecordTime of the task. When the
+// task has an EndRecordTime (snow), the cycles are repeated until the time
+// range is exhausted, since one cycle collects at most RecordCount records,
+// and the returned run sums them up
+// @config: global config, the settings of task take precedence
+func RunOnce(config base.BaseConfig, task base.BaseConfig) (*base.JobRun, error) {
+	newConfig := mergeTaskConfig(config, task)
+	newConfig[base.CheckpointMethod] = "null"
+	if newConfig[base.KafkaTopic] == "" {
+		// the topic of the ongoing task, so that backfilled data is found
+		// together with the collected one
+		newConfig[base.KafkaTopic] = GenerateTopic(newConfig[base.App],
+			newConfig[base.ServerURL], newConfig[base.Username])
+	}
+	if newConfig[base.TaskConfigKey] == "" {
+		newConfig[base.TaskConfigKey] = runOnceKeyPrefix + newConfig[base.Metric]
+	}
+
+	factory := NewJobFactory()
+	defer factory.CloseClients()
+
+	job := factory.CreateJob(newConfig[base.App], newConfig)
+	if job == nil {
+		return nil, errors.New(fmt.Sprintf("Failed to create job for App=%s", newConfig[base.App]))
+	}
+
+	readerJob, ok := job.(*ReaderJob)
+	if !ok {
+		job.Stop()
+		return nil, errors.New(fmt.Sprintf("App=%s doesn't support run once", newConfig[base.App]))
+	}
+
+	job.Start()
+	defer job.Stop()
+
+	var total *base.JobRun
+	for cycle := 1; ; cycle++ {
+		err := readerJob.indexData()
+		if err == base.ErrSkipped {
+			if total != nil {
+				return total, nil
+			}
+			// for e.g. out of the schedule windows
+			return nil, errors.New(fmt.Sprintf("Job=%s skipped the collection", readerJob.key))
+		}
+
+		runs := factory.JobHistory().Runs(readerJob.key)
+		run := runs[len(runs)-1]
+		if total == nil {
+			total = &run
+		} else {
+			total.EndTime = run.EndTime
+			total.Records += run.Records
+			total.Bytes += run.Bytes
+			total.Outcome, total.Error = run.Outcome, run.Error
+		}
+
+		if err != nil {
+			return total, err
+		}
+
+		if newConfig[endRecordTimeKey] == "" {
+			if recordCount, _ := strconv.ParseInt(newConfig[recordCountKey], 10, 64); recordCount > 0 && run.Records >= recordCount {
+				glog.Warningf("Job=%s collected RecordCount=%d records in one cycle, more records may be left, "+
+					"set an end time to collect the whole range", readerJob.key, recordCount)
+			}
+			return total, nil
+		}
+
+		if run.Records == 0 {
+			glog.Infof("Job=%s exhausted the time range in %d cycles", readerJob.key, cycle)
+			return total, nil
+		}
+	}
+}
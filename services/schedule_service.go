@@ -5,15 +5,12 @@ import (
 	"fmt"
 	"github.com/chenziliang/descartes/base"
 	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
-	"github.com/chenziliang/descartes/sinks/memory"
-	kafkareader "github.com/chenziliang/descartes/sources/kafka"
 	"github.com/golang/glog"
 	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
@@ -26,23 +23,33 @@ type ScheduleService struct {
 	config         base.BaseConfig
 	jobConfigs     map[string]base.BaseConfig            // job key indexed
 	jobs           map[string]base.Job                   // job key indexed
+	jobsMutex      sync.Mutex // guards jobConfigs and jobs
 	liveCollectors map[string]map[string]base.BaseConfig // ip, app => heartbeat
 	liveCollectorsMutex sync.Mutex
+	collectorRings map[string]*base.HashRing // app and constraints indexed
+	collectorRingsMutex sync.Mutex
+	failureDetector *base.FailureDetector
 	taskChan       chan base.BaseConfig
 	zkClient       *base.ZooKeeperClient
+	topics         *base.TopicRegistry
+	archive        *base.TaskArchive
+	assignments    *base.AssignmentTable
+	desired        map[string]*base.Assignment // TaskConfigKey indexed, see assignedHost
+	desiredMutex   sync.Mutex
+	assignChan     chan taskMessage
+	monitors       []*TaskMonitor
+	monitorsMutex  sync.Mutex
 	nodeGUID       string
 	isLeader       bool
-	started        int32
+	leaderMutex    sync.Mutex // guards nodeGUID and isLeader
+	lifecycle      base.Lifecycle
 }
 
-const (
-	heartbeatThreadhold = 2 * int64(6 * time.Second)
-)
-
 // TODO, refactor out the ZooKeeper dependency ?
-// config contains: KafkaBrokers, ZooKeeperServers IPs
+// config contains: KafkaBrokers, ZooKeeperServers IPs, the tasks are published
+// to ControlKafkaBrokers if it is configured
 func NewScheduleService(config base.BaseConfig) *ScheduleService {
-	client := base.NewKafkaClient(config, "TaskMonitorClient")
+	client := base.NewKafkaClient(base.ControlKafkaConfig(config), "TaskMonitorClient")
 	if client == nil {
 		return nil
 	}
@@ -81,11 +88,17 @@ func NewScheduleService(config base.BaseConfig) *ScheduleService {
 		jobConfigs:     make(map[string]base.BaseConfig, 100),
 		jobs:           make(map[string]base.Job, 100),
 		liveCollectors: make(map[string]map[string]base.BaseConfig, 100),
+		collectorRings: make(map[string]*base.HashRing),
+		failureDetector: base.NewFailureDetectorFromConfig(config),
 		taskChan:       make(chan base.BaseConfig, 100),
 		zkClient:       zkClient,
+		topics:         base.NewTopicRegistry(zkClient),
+		archive:        base.NewTaskArchive(zkClient),
+		assignments:    base.NewAssignmentTable(zkClient),
+		desired:        make(map[string]*base.Assignment),
+		assignChan:     make(chan taskMessage, 100),
 		nodeGUID:       guid,
 		isLeader:       isLeader,
-		started:        0,
 	}
 	ss.jobFactory.RegisterJobCreationHandler(base.TaskConfig, ss.createTaskPublishJob)
 	ss.partitionMonitor = NewKafkaMetaDataMonitor(config, ss)
@@ -93,27 +106,34 @@ func NewScheduleService(config base.BaseConfig) *ScheduleService {
 }
 
 func (ss *ScheduleService) Start() {
-	if !atomic.CompareAndSwapInt32(&ss.started, 0, 1) {
-		glog.Infof("ScheduleService already started.")
+	if ss.lifecycle.Start("ScheduleService") != nil {
 		return
 	}
 
+	ss.loadAssignments()
 	ss.jobScheduler.Start()
 	ss.statsService.Start()
 	go ss.monitorLeaderChanges()
 	go ss.monitorTasks()
 	go ss.monitorCollectorHeartbeats()
 	go ss.doPublishTask()
+	go ss.doArchiveStaleTasks()
+	go ss.doReconcile()
 
 	glog.Infof("ScheduleService started...")
 }
 
 func (ss *ScheduleService) Stop() {
-	if !atomic.CompareAndSwapInt32(&ss.started, 1, 0) {
-		glog.Infof("ScheduleService already stopped.")
+	if ss.lifecycle.Stop("ScheduleService") != nil {
 		return
 	}
 
+	// The tasks and heartbeats read before are still handled
+	ss.monitorsMutex.Lock()
+	for _, monitor := range ss.monitors {
+		monitor.Stop()
+	}
+	ss.monitorsMutex.Unlock()
 	ss.jobScheduler.Stop()
 	ss.statsService.Stop()
 	ss.partitionMonitor.Stop()
@@ -123,32 +143,89 @@ func (ss *ScheduleService) Stop() {
 	glog.Infof("ScheduleService stopped...")
 }
 
+func (ss *ScheduleService) Status() string {
+	return ss.lifecycle.Status()
+}
+
 func (ss *ScheduleService) monitorLeaderChanges() {
+	sessionEvents := ss.zkClient.Subscribe()
 	watchChan, err := ss.zkClient.WatchElectionParticipants()
 	if err != nil {
 		panic("Failed to monitor leader changes")
 	}
 
-	for atomic.LoadInt32(&ss.started) != 0 {
+	for ss.lifecycle.Running() {
 		select{
-		case <-watchChan:
+		case _, ok := <-watchChan:
 			// register the watch immediately
+			watchChan = nil
 			watch, err := ss.zkClient.WatchElectionParticipants()
 			if err == nil {
 				watchChan = watch
+			} else if !ok {
+				continue
 			}
 			glog.Infof("Detect leader participants change")
-			isLeader, err := ss.zkClient.IsLeader(ss.nodeGUID)
-			if err == nil {
-				if ss.isLeader != isLeader {
-					glog.Warningf("Change the role from leader=%v to leader=%v", ss.isLeader, isLeader)
+			ss.checkLeader()
+
+		case event, ok := <-sessionEvents:
+			if !ok {
+				return
+			}
+
+			switch event {
+			case base.ZooKeeperSessionExpired:
+				// Our election node is gone with the session, step down
+				// before others take over
+				ss.setLeader(false)
+			case base.ZooKeeperSessionRecovered:
+				host, _ := os.Hostname()
+				guid, err := ss.zkClient.JoinElection(host)
+				if err != nil {
+					continue
 				}
-				ss.isLeader = isLeader
+				ss.leaderMutex.Lock()
+				ss.nodeGUID = guid
+				ss.leaderMutex.Unlock()
+				fallthrough
+			case base.ZooKeeperReconnected:
+				watch, err := ss.zkClient.WatchElectionParticipants()
+				if err == nil {
+					watchChan = watch
+				}
+				ss.checkLeader()
 			}
 		}
 	}
 }
 
+func (ss *ScheduleService) checkLeader() {
+	ss.leaderMutex.Lock()
+	guid := ss.nodeGUID
+	ss.leaderMutex.Unlock()
+
+	isLeader, err := ss.zkClient.IsLeader(guid)
+	if err == nil {
+		ss.setLeader(isLeader)
+	}
+}
+
+func (ss *ScheduleService) setLeader(isLeader bool) {
+	ss.leaderMutex.Lock()
+	defer ss.leaderMutex.Unlock()
+
+	if ss.isLeader != isLeader {
+		glog.Warningf("Change the role from leader=%v to leader=%v", ss.isLeader, isLeader)
+	}
+	ss.isLeader = isLeader
+}
+
+func (ss *ScheduleService) leader() bool {
+	ss.leaderMutex.Lock()
+	defer ss.leaderMutex.Unlock()
+	return ss.isLeader
+}
+
 func (ss *ScheduleService) createTaskPublishJob(config base.BaseConfig) base.Job {
 	interval, err := strconv.ParseInt(config[base.Interval], 10, 64)
 	if err != nil {
@@ -157,10 +234,35 @@ func (ss *ScheduleService) createTaskPublishJob(config base.BaseConfig) base.Job
 	}
 
 	interval = interval * int64(time.Second)
-	job := base.NewJob(ss.publishTaskToKafka, time.Now().UnixNano(), interval, config)
+	publish := base.JobFunc(ss.publishTaskToKafka)
+	if config[base.ScheduleWindows] != "" {
+		hours, err := base.ParseWorkingHours(config[base.ScheduleWindows], config[base.ScheduleTimezone])
+		if err != nil {
+			glog.Errorf("Failed to parse schedule windows=%s, error=%s", config[base.ScheduleWindows], err)
+			return nil
+		}
+		publish = ss.newWindowedPublisher(hours)
+	}
+
+	job := base.NewJob(publish, time.Now().UnixNano(), interval, config)
 	return job
 }
 
+// newWindowedPublisher only publishes the task within the working hours.
+// Whether the changes in the skipped period are collected when the window
+// opens again is decided by the collector according to ScheduleCatchUp
+func (ss *ScheduleService) newWindowedPublisher(hours *base.WorkingHours) base.JobFunc {
+	return func(params base.JobParam) error {
+		config := params.(base.BaseConfig)
+		if !hours.Contains(time.Now()) {
+			glog.V(1).Infof("Out of schedule windows=%s, skip publishing task=%s",
+				config[base.ScheduleWindows], config[base.TaskConfigKey])
+			return nil
+		}
+		return ss.publishTaskToKafka(params)
+	}
+}
+
 func (ss *ScheduleService) publishTaskToKafka(params base.JobParam) error {
 	config := params.(base.BaseConfig)
 	ss.taskChan <- config
@@ -168,10 +270,8 @@ func (ss *ScheduleService) publishTaskToKafka(params base.JobParam) error {
 }
 
 func (ss *ScheduleService) doPublishTask() {
-	brokerConfig := base.BaseConfig{
-		base.KafkaBrokers: ss.config[base.KafkaBrokers],
-		base.KafkaTopic:   base.Tasks,
-	}
+	brokerConfig := base.ControlKafkaConfig(ss.config)
+	brokerConfig[base.KafkaTopic] = base.Tasks
 
 	writer := kafkawriter.NewKafkaDataWriter(brokerConfig)
 	if writer == nil {
@@ -180,65 +280,120 @@ func (ss *ScheduleService) doPublishTask() {
 	writer.Start()
 	defer writer.Stop()
 
-	for atomic.LoadInt32(&ss.started) != 0 {
+	for ss.lifecycle.Running() {
 		select {
 		case taskConfig := <-ss.taskChan:
-	        if !ss.isLeader {
+	        if !ss.leader() {
 				continue
 			}
 
-			rawData, err := json.Marshal(taskConfig)
-			if err != nil {
-				glog.Errorf("Failed to marshal task config, error=%s", err)
-				continue
-			}
-
-			host := ss.getAvailableGatheringHost(taskConfig)
+			host := ss.assignedHost(taskConfig)
 			if host == "" {
 				continue
 			}
 
 			glog.Infof("app=%s job=%s, host=%s", taskConfig[base.App], taskConfig[base.TaskConfigKey], host)
-			meta := base.BaseConfig{
-				base.Host: host,
-			}
+			writeTask(writer, host, taskConfig)
 
-			data := &base.Data{
-				MetaInfo: meta,
-				RawData:  [][]byte{rawData},
+		case message := <-ss.assignChan:
+			if !ss.leader() {
+				continue
 			}
-			writer.WriteData(data)
+
+			glog.Infof("app=%s job=%s, host=%s, action=%s", message.task[base.App],
+				message.task[base.TaskConfigKey], message.host, message.task[base.TaskConfigAction])
+			writeTask(writer, message.host, message.task)
 		}
 	}
 }
 
-func (ss *ScheduleService) getAvailableGatheringHost(config base.BaseConfig) string {
-	// TODO locality
-	var availableHosts []string
+// getCollectorRing returns the ring of the collectors of app which satisfy
+// constraints. Each of them has its own ring so that the placement of an app
+// doesn't churn when the tasks of another app are published
+func (ss *ScheduleService) getCollectorRing(app, constraints string) *base.HashRing {
+	ss.collectorRingsMutex.Lock()
+	defer ss.collectorRingsMutex.Unlock()
+
+	key := app + "|" + constraints
+	ring, ok := ss.collectorRings[key]
+	if !ok {
+		ring = base.NewHashRing(0)
+		ss.collectorRings[key] = ring
+	}
+	return ring
+}
+
+// availableHosts returns the hosts the task can be placed on, the alive
+// collectors of its App which satisfy its PlacementConstraints and reach its
+// instance, or the unhealthy or the suspected ones if none is
+func (ss *ScheduleService) availableHosts(config base.BaseConfig) []string {
+	constraints := base.ParseLabels(config[base.PlacementConstraints])
+	instance := base.NormalizeServerURL(config[base.ServerURL])
+	threshold := base.GetHealthThreshold(ss.config)
+	var availableHosts, suspectedHosts, unhealthyHosts []string
+	now := time.Now().UnixNano()
 	ss.liveCollectorsMutex.Lock()
 	for host, apps := range ss.liveCollectors {
-	    if ss.config[base.Heartbeat] != "kafka" {
-			if _, ok := apps[config[base.App]]; ok {
-				availableHosts = append(availableHosts, host)
-			} else {
+		heartbeat, ok := apps[config[base.App]]
+		if !ok {
+			if ss.config[base.Heartbeat] != "kafka" {
 				glog.Warningf("Host=%s, App=%s has lost the heartbeat", host, config[base.App])
 			}
-		} else {
-			if heartbeat, ok := apps[config[base.App]]; ok {
-				lasttime, _ := strconv.ParseInt(heartbeat[base.Timestamp], 10, 64)
-				if time.Now().UnixNano()-lasttime < heartbeatThreadhold {
-					availableHosts = append(availableHosts, host)
-				} else {
-					glog.Warningf("Host=%s, App=%s has lost the heartbeat", host, config[base.App])
-				}
+			continue
+		}
+
+		if !base.MatchLabels(base.ParseLabels(heartbeat[base.Labels]), constraints) {
+			continue
+		}
+
+		switch ss.failureDetector.Status(host+"!"+config[base.App], now) {
+		case base.NodeAlive:
+			// The egress of the collector to the instance is degraded
+			score, ok := base.ParseInstanceHealth(heartbeat[base.InstanceHealth])[instance]
+			if instance != "" && ok && score < threshold {
+				unhealthyHosts = append(unhealthyHosts, host)
+				continue
 			}
+			availableHosts = append(availableHosts, host)
+		case base.NodeSuspected:
+			suspectedHosts = append(suspectedHosts, host)
+		default:
+			glog.Warningf("Host=%s, App=%s has lost the heartbeat", host, config[base.App])
 		}
 	}
 	ss.liveCollectorsMutex.Unlock()
 
+	if len(availableHosts) == 0 && len(unhealthyHosts) > 0 {
+		glog.Warningf("No healthy Host for App=%s to reach %s, fallback to unhealthy hosts=%s", config[base.App], instance, unhealthyHosts)
+		availableHosts = unhealthyHosts
+	}
+
+	if len(availableHosts) == 0 && len(suspectedHosts) > 0 {
+		// Suspected hosts may still be alive, prefer them to dropping the task
+		glog.Warningf("No alive Host for App=%s, fallback to suspected hosts=%s", config[base.App], suspectedHosts)
+		availableHosts = suspectedHosts
+	}
+	return availableHosts
+}
+
+func (ss *ScheduleService) getAvailableGatheringHost(config base.BaseConfig) string {
+	availableHosts := ss.availableHosts(config)
 	if len(availableHosts) > 0 {
-		r := rand.New(rand.NewSource(time.Now().UnixNano()))
-		return availableHosts[r.Int()%len(availableHosts)]
+		if ss.config[base.TaskPlacement] == "random" {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			return availableHosts[r.Int()%len(availableHosts)]
+		}
+
+		// Consistent hashing keeps a task on the same collector as long as
+		// it is alive, so its checkpoint and cached reader stay warm
+		ring := ss.getCollectorRing(config[base.App], config[base.PlacementConstraints])
+		if ring.SetNodes(availableHosts) {
+			glog.Infof("Collector ring of App=%s changed, hosts=%s", config[base.App], ring.Nodes())
+		}
+		return ring.GetNode(config[base.TaskConfigKey])
+	} else if len(base.ParseLabels(config[base.PlacementConstraints])) > 0 {
+		glog.Errorf("No live Host for App=%s satisfies constraints=%s, ignore this task=%s",
+		            config[base.App], config[base.PlacementConstraints], config)
 	} else {
 		glog.Errorf("All Hosts for App=%s have lost heartbeat, ignore this task=%s",
 		            config[base.App], config)
@@ -248,38 +403,16 @@ func (ss *ScheduleService) getAvailableGatheringHost(config base.BaseConfig) str
 }
 
 func (ss *ScheduleService) doMonitor(topic string) {
-	checkpoint := base.NewNullCheckpointer()
-	writer := memory.NewMemoryDataWriter()
-	topicPartitions, err := ss.kafkaClient.TopicPartitions(topic)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to get partitions for topic=%s", topic))
+	monitor := NewTaskMonitor(ss.kafkaClient, topic, func(data *base.Data) {
+		ss.handleMonitorData(data, topic)
+	})
+	if err := monitor.Start(); err != nil {
+		panic(fmt.Sprintf("Failed to monitor topic=%s, error=%s", topic, err))
 	}
 
-	for _, partition := range topicPartitions[topic] {
-		config := base.BaseConfig{
-			base.KafkaTopic:		topic,
-			base.KafkaPartition:    fmt.Sprintf("%d", partition),
-			base.UseOffsetNewest:   "1",
-		}
-
-		reader := kafkareader.NewKafkaDataReader(ss.kafkaClient, config, writer, checkpoint)
-		if reader == nil {
-			panic("Failed to create kafka reader")
-		}
-
-		go func(r base.DataReader, w *memory.MemoryDataWriter) {
-			r.Start()
-			defer r.Stop()
-			go r.IndexData()
-
-			for atomic.LoadInt32(&ss.started) != 0 {
-				select {
-				case data := <-writer.Data():
-					ss.handleMonitorData(data, topic)
-				}
-			}
-		}(reader, writer)
-	}
+	ss.monitorsMutex.Lock()
+	ss.monitors = append(ss.monitors, monitor)
+	ss.monitorsMutex.Unlock()
 }
 
 func (ss *ScheduleService) handleMonitorData(data *base.Data, topic string) {
@@ -302,15 +435,19 @@ func (ss *ScheduleService) monitorCollectorHeartbeats() {
 }
 
 func (ss *ScheduleService) doMonitorThroughZooKeeper() {
+	sessionEvents := ss.zkClient.Subscribe()
 	ss.refreshRegisteredCollectors()
 	collectorChanges, err := ss.zkClient.ChildrenW(base.HeartbeatRoot)
 	if err != nil {
 		panic("Failed to monitor the collectors")
 	}
 
-	ticker := time.Tick(60 * time.Second)
+	// Refresh at least every heartbeat interval so the failure detector
+	// sees the heartbeats written to the collector nodes
+	refreshInterval := ss.failureDetector.Interval()
+	ticker := time.Tick(refreshInterval)
 	lastFreshed := time.Now().UnixNano()
-	for atomic.LoadInt32(&ss.started) != 0 {
+	for ss.lifecycle.Running() {
 		select {
 		case <-collectorChanges:
 			collectorChanges, err = ss.zkClient.ChildrenW(base.HeartbeatRoot)
@@ -321,8 +458,23 @@ func (ss *ScheduleService) doMonitorThroughZooKeeper() {
 			ss.refreshRegisteredCollectors()
 			lastFreshed = time.Now().UnixNano()
 
+		case event, ok := <-sessionEvents:
+			if !ok {
+				return
+			}
+
+			if event == base.ZooKeeperReconnected || event == base.ZooKeeperSessionRecovered {
+				// The watch may be lost during the outage, register it again
+				watch, err := ss.zkClient.ChildrenW(base.HeartbeatRoot)
+				if err == nil {
+					collectorChanges = watch
+				}
+				ss.refreshRegisteredCollectors()
+				lastFreshed = time.Now().UnixNano()
+			}
+
 		case <-ticker:
-			if time.Now().UnixNano() - lastFreshed > int64(60 * time.Second) {
+			if time.Now().UnixNano() - lastFreshed >= int64(refreshInterval) {
 				ss.refreshRegisteredCollectors()
 			    lastFreshed = time.Now().UnixNano()
 			}
@@ -345,7 +497,19 @@ func (ss *ScheduleService) refreshRegisteredCollectors() {
 			if newLivings[hostApp[0]] == nil {
 				newLivings[hostApp[0]] = make(map[string]base.BaseConfig)
 			}
-			newLivings[hostApp[0]][hostApp[1]] = nil
+
+			// The node payload carries the labels registered by the collector
+			var heartbeat base.BaseConfig
+			rawData, err := ss.zkClient.GetNode(base.HeartbeatRoot+"/"+hostCollector, true)
+			if err == nil && len(rawData) > 0 {
+				if err := json.Unmarshal(rawData, &heartbeat); err != nil {
+					glog.Errorf("Unexpected heartbeat format for collector=%s, got=%s", hostCollector, string(rawData))
+				}
+			}
+			newLivings[hostApp[0]][hostApp[1]] = heartbeat
+			if lasttime, err := strconv.ParseInt(heartbeat[base.Timestamp], 10, 64); err == nil {
+				ss.failureDetector.Heartbeat(hostCollector, lasttime)
+			}
 		}
 	}
 
@@ -381,6 +545,7 @@ func (ss *ScheduleService) handleTaskStats(data *base.Data) {
 		}
 		ss.liveCollectors[heartBeat[base.Host]][heartBeat[base.App]] = heartBeat
 		ss.liveCollectorsMutex.Unlock()
+		ss.failureDetector.Heartbeat(heartBeat[base.Host]+"!"+heartBeat[base.App], time.Now().UnixNano())
 	}
 }
 
@@ -421,12 +586,28 @@ func (ss *ScheduleService) handleTasks(data *base.Data) {
 }
 
 func (ss *ScheduleService) handleNewTask(config base.BaseConfig) {
+	ss.jobsMutex.Lock()
+	defer ss.jobsMutex.Unlock()
+
 	key := config[base.TaskConfigKey]
+	if ss.isArchived(key) {
+		glog.Warningf("Task=%s is archived, update or delete it to schedule it again", key)
+		return
+	}
+
 	if _, ok := ss.jobs[key]; ok {
+		if existing := ss.jobConfigs[key]; base.TaskIdentity(existing) != base.TaskIdentity(config) {
+			glog.Errorf("Alert: reject task, TaskConfigKey=%s is defined by %s, rejected %s",
+				key, base.TaskIdentity(existing), base.TaskIdentity(config))
+			return
+		}
 		glog.Errorf("%s already exists", config)
 		return
 	}
 
+	// Stamped once, the config is published every cycle of the job
+	base.StampTaskSchema(config)
+
 	// This is an exception
 	if config[base.App] == base.KafkaApp {
 		ss.partitionMonitor.AddTopicConfig(config)
@@ -439,13 +620,32 @@ func (ss *ScheduleService) handleNewTask(config base.BaseConfig) {
 	}
 	ss.jobs[key] = job
 	ss.jobConfigs[key] = config
+
+	if err := ss.topics.Register(config); err != nil {
+		glog.Errorf("Failed to register the output topic of task=%s, error=%s", key, err)
+	}
 }
 
+// handleDeleteTask stops scheduling the task and releases it from its host
 func (ss *ScheduleService) handleDeleteTask(config base.BaseConfig) {
+	if ss.removeTask(config) {
+		ss.unassign(config)
+	}
+}
+
+// removeTask returns false if the task is not scheduled
+func (ss *ScheduleService) removeTask(config base.BaseConfig) bool {
+	ss.jobsMutex.Lock()
+	defer ss.jobsMutex.Unlock()
+
 	key := config[base.TaskConfigKey]
+	if err := ss.archive.Delete(key); err != nil {
+		glog.Errorf("Failed to unarchive task=%s, error=%s", key, err)
+	}
+
 	if _, ok := ss.jobs[key]; !ok {
 		glog.Errorf("%s doesn't already exists", config)
-		return
+		return false
 	}
 
 	job := ss.jobs[key]
@@ -453,13 +653,25 @@ func (ss *ScheduleService) handleDeleteTask(config base.BaseConfig) {
 
 	delete(ss.jobs, key)
 	delete(ss.jobConfigs, key)
+
+	if err := ss.topics.Deregister(key); err != nil {
+		glog.Errorf("Failed to deregister the output topic of task=%s, error=%s", key, err)
+	}
+	return true
 }
 
+// handleUpdateTask keeps the assignment of the task, its host collects the
+// updated task from the next cycle on
 func (ss *ScheduleService) handleUpdateTask(config base.BaseConfig) {
-	ss.handleDeleteTask(config)
+	ss.removeTask(config)
 	ss.handleNewTask(config)
 }
 
+// TopicRegistry returns the registry of the output topics of the tasks
+func (ss *ScheduleService) TopicRegistry() *base.TopicRegistry {
+	return ss.topics
+}
+
 func (ss *ScheduleService) AddJob(app string, config base.BaseConfig) base.Job {
 	job := ss.jobFactory.CreateJob(app, config)
 	if job != nil {
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
+	"github.com/chenziliang/descartes/sources/snow"
+	"os"
+	"time"
+)
+
+const (
+	selfTestTopic = "_SelfTest_"
+)
+
+type SelfTestCheck struct {
+	Name    string
+	Passed  bool
+	Error   string `json:",omitempty"`
+	Elapsed string
+}
+
+type SelfTestReport struct {
+	Host   string
+	Passed bool
+	Checks []SelfTestCheck
+}
+
+// RunSelfTest validates the pipeline end to end: ZooKeeper and Kafka
+// connectivity, a checkpoint write/read roundtrip, a marker event written to
+// the sink and an auth probe against every distinct source
+// @sources: snow task configs to probe
+func RunSelfTest(config base.BaseConfig, sources []base.BaseConfig) *SelfTestReport {
+	host, _ := os.Hostname()
+	report := &SelfTestReport{
+		Host:   host,
+		Passed: true,
+	}
+
+	report.run("zookeeper", func() error { return selfTestZooKeeper(config) })
+	report.run("kafka", func() error { return selfTestKafka(base.DataKafkaConfig(config)) })
+	if config[base.ControlKafkaBrokers] != "" {
+		report.run("kafka:control", func() error { return selfTestKafka(base.ControlKafkaConfig(config)) })
+	}
+	report.run("checkpoint:"+config[base.CheckpointMethod], func() error { return selfTestCheckpoint(config, host) })
+	report.run("sink", func() error { return selfTestSink(config, host) })
+
+	probed := make(map[string]bool)
+	for _, source := range sources {
+		key := source[base.ServerURL] + "/" + source[base.Username]
+		if probed[key] {
+			continue
+		}
+		probed[key] = true
+		report.run("source:"+key, func() error { return snow.ProbeAuth(source) })
+	}
+	return report
+}
+
+func (report *SelfTestReport) run(name string, f func() error) {
+	start := time.Now()
+	err := f()
+	check := SelfTestCheck{
+		Name:    name,
+		Passed:  err == nil,
+		Elapsed: time.Since(start).String(),
+	}
+
+	if err != nil {
+		check.Error = err.Error()
+		report.Passed = false
+	}
+	report.Checks = append(report.Checks, check)
+}
+
+func selfTestZooKeeper(config base.BaseConfig) error {
+	client := base.NewZooKeeperClient(config)
+	if client == nil {
+		return errors.New("Failed to connect to ZooKeeper")
+	}
+	defer client.Close()
+
+	exists, err := client.NodeExists(base.Root)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.New(fmt.Sprintf("%s doesn't exist in ZooKeeper", base.Root))
+	}
+	return nil
+}
+
+func selfTestKafka(config base.BaseConfig) error {
+	client := base.NewKafkaClient(config, "SelfTestClient")
+	if client == nil {
+		return errors.New("Failed to connect to Kafka")
+	}
+	defer client.Close()
+
+	_, err := client.TopicPartitions("")
+	return err
+}
+
+func selfTestCheckpoint(config base.BaseConfig, host string) error {
+	keyInfo := make(base.BaseConfig, len(config))
+	for k, v := range config {
+		keyInfo[k] = v
+	}
+	keyInfo[base.Key] = base.Root + "/selftest/" + host
+	keyInfo[base.CheckpointNamespace] = "selftest"
+	keyInfo[base.CheckpointKey] = host
+	keyInfo[base.CheckpointTopic] = selfTestTopic
+
+	checkpoint := createCheckpointer(keyInfo)
+	if checkpoint == nil {
+		return errors.New("Failed to create checkpointer")
+	}
+	checkpoint.Start()
+	defer checkpoint.Stop()
+
+	marker := []byte(fmt.Sprintf("descartes selftest %d", time.Now().UnixNano()))
+	if err := checkpoint.WriteCheckpoint(keyInfo, marker); err != nil {
+		return err
+	}
+
+	data, err := checkpoint.GetCheckpoint(keyInfo)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(data, marker) {
+		return errors.New(fmt.Sprintf("Checkpoint roundtrip mismatch, wrote=%s, read=%s", marker, data))
+	}
+	return checkpoint.DeleteCheckpoint(keyInfo)
+}
+
+// selfTestSink writes a marker event to TargetSystemType, or to a Kafka
+// self test topic if there is no target system
+func selfTestSink(config base.BaseConfig, host string) error {
+	var writer base.DataWriter
+	if config[base.TargetSystemType] != "" {
+		sinkConfig := make(base.BaseConfig, len(config))
+		for k, v := range config {
+			sinkConfig[k] = v
+		}
+		sinkConfig[base.ServerURL] = config[base.TargetSystem]
+		writer = NewJobFactory().getDataWriter(sinkConfig)
+	} else {
+		sinkConfig := base.DataKafkaConfig(config)
+		sinkConfig[base.KafkaTopic] = selfTestTopic
+		writer = kafkawriter.NewKafkaDataWriter(sinkConfig)
+	}
+
+	if writer == nil {
+		return errors.New("Failed to create sink writer")
+	}
+	writer.Start()
+	defer writer.Stop()
+
+	metaInfo := map[string]string{
+		base.ServerURL:  host,
+		base.Source:     "descartes:selftest",
+		base.Sourcetype: "descartes:selftest",
+	}
+	marker := []byte(fmt.Sprintf("descartes selftest marker host=%s time=%d", host, time.Now().UnixNano()))
+	return writer.WriteDataSync(base.NewData(metaInfo, [][]byte{marker}))
+}
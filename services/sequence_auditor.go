@@ -0,0 +1,98 @@
+package services
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	kafkareader "github.com/chenziliang/descartes/sources/kafka"
+	"github.com/golang/glog"
+	"sync/atomic"
+)
+
+// SequenceAuditor consumes data topics from the oldest offset and reports
+// the sequence gaps and out of order records of each task
+type SequenceAuditor struct {
+	kafkaClient *base.KafkaClient
+	topics      []string
+	verifier    *base.SequenceVerifier
+	anomalies   int64
+	lifecycle   base.Lifecycle
+}
+
+func NewSequenceAuditor(config base.BaseConfig, topics []string) *SequenceAuditor {
+	client := base.NewKafkaClient(config, "SequenceAuditorClient")
+	if client == nil {
+		return nil
+	}
+
+	return &SequenceAuditor{
+		kafkaClient: client,
+		topics:      topics,
+		verifier:    base.NewSequenceVerifier(),
+	}
+}
+
+func (auditor *SequenceAuditor) Start() {
+	if auditor.lifecycle.Start("SequenceAuditor") != nil {
+		return
+	}
+
+	for _, topic := range auditor.topics {
+		auditor.audit(topic)
+	}
+	glog.Infof("SequenceAuditor started...")
+}
+
+func (auditor *SequenceAuditor) Stop() {
+	if auditor.lifecycle.Stop("SequenceAuditor") != nil {
+		return
+	}
+
+	auditor.kafkaClient.Close()
+	glog.Infof("SequenceAuditor stopped, found %d anomalies...", atomic.LoadInt64(&auditor.anomalies))
+}
+
+func (auditor *SequenceAuditor) Status() string {
+	return auditor.lifecycle.Status()
+}
+
+func (auditor *SequenceAuditor) audit(topic string) {
+	checkpoint := base.NewNullCheckpointer()
+	topicPartitions, err := auditor.kafkaClient.TopicPartitions(topic)
+	if err != nil {
+		glog.Errorf("Failed to get partitions for topic=%s, error=%s", topic, err)
+		return
+	}
+
+	for _, partition := range topicPartitions[topic] {
+		config := base.BaseConfig{
+			base.KafkaTopic:      topic,
+			base.KafkaPartition:  fmt.Sprintf("%d", partition),
+			base.UseOffsetOldest: "1",
+		}
+
+		writer := memory.NewMemoryDataWriter()
+		reader := kafkareader.NewKafkaDataReader(auditor.kafkaClient, config, writer, checkpoint)
+		if reader == nil {
+			glog.Errorf("Failed to create kafka reader for topic=%s, partition=%d", topic, partition)
+			continue
+		}
+
+		go func(r base.DataReader, w *memory.MemoryDataWriter, partition int32) {
+			r.Start()
+			defer r.Stop()
+			go r.IndexData()
+
+			for auditor.lifecycle.Running() {
+				select {
+				case data := <-w.Data():
+					for _, anomaly := range auditor.verifier.Verify(data) {
+						atomic.AddInt64(&auditor.anomalies, 1)
+						glog.Warningf("Sequence %s for task=%s, epoch=%s in topic=%s, partition=%d, expect record seq=%d, got=%d",
+							anomaly.Kind, anomaly.TaskKey, anomaly.Epoch, topic, partition, anomaly.Expected, anomaly.Got)
+					}
+				}
+			}
+		}(reader, writer, partition)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sinkEvaluationInterval = 10 * time.Second
+)
+
+// SinkMonitor samples the buffering of the sinks of the jobs every 10
+// seconds. A sink which stays saturated longer than SinkSaturationTime
+// raises an alert and is published to SinkSaturationTopic of the bus once,
+// until it is not saturated anymore
+type SinkMonitor struct {
+	stats     func() map[string]base.SinkStats // TaskConfigKey indexed
+	bus       *base.EventBus
+	threshold time.Duration
+	since     map[string]time.Time // TaskConfigKey indexed saturation start
+	alerted   map[string]bool      // TaskConfigKey indexed
+	mutex     sync.Mutex
+	lifecycle base.Lifecycle
+}
+
+// NewSinkMonitor
+// @config: contains SinkSaturationTime in seconds, see
+// base.GetSinkSaturationTime
+func NewSinkMonitor(config base.BaseConfig, stats func() map[string]base.SinkStats, bus *base.EventBus) *SinkMonitor {
+	return &SinkMonitor{
+		stats:     stats,
+		bus:       bus,
+		threshold: base.GetSinkSaturationTime(config),
+		since:     make(map[string]time.Time),
+		alerted:   make(map[string]bool),
+	}
+}
+
+func (monitor *SinkMonitor) Start() {
+	if monitor.lifecycle.Start("SinkMonitor") != nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(sinkEvaluationInterval)
+		defer ticker.Stop()
+
+		for monitor.lifecycle.Running() {
+			select {
+			case <-ticker.C:
+				monitor.evaluate(monitor.stats(), time.Now())
+			}
+		}
+	}()
+	glog.Infof("SinkMonitor started...")
+}
+
+func (monitor *SinkMonitor) Stop() {
+	if monitor.lifecycle.Stop("SinkMonitor") != nil {
+		return
+	}
+	glog.Infof("SinkMonitor stopped...")
+}
+
+func (monitor *SinkMonitor) Status() string {
+	return monitor.lifecycle.Status()
+}
+
+// Saturated returns the keys of the tasks whose sinks have been saturated
+// since the last evaluation, sorted
+func (monitor *SinkMonitor) Saturated() []string {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	keys := make([]string, 0, len(monitor.since))
+	for key := range monitor.since {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (monitor *SinkMonitor) evaluate(stats map[string]base.SinkStats, now time.Time) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	for key := range monitor.since {
+		if s, ok := stats[key]; !ok || !s.Saturated() {
+			if monitor.alerted[key] {
+				glog.Infof("Sink recovered, task=%s", key)
+			}
+			delete(monitor.since, key)
+			delete(monitor.alerted, key)
+		}
+	}
+
+	for key, s := range stats {
+		if !s.Saturated() {
+			continue
+		}
+
+		since, ok := monitor.since[key]
+		if !ok {
+			monitor.since[key] = now
+			continue
+		}
+
+		if !monitor.alerted[key] && now.Sub(since) >= monitor.threshold {
+			glog.Errorf("Alert: sink saturated, task=%s, since=%s, queue depth=%d, capacity=%d, oldest age=%.1fs, dropped=%d",
+				key, since.Format(time.RFC3339), s.QueueDepth, s.Capacity, s.OldestAge, s.Dropped)
+			saturation := &base.SinkSaturation{Key: key, Since: since, Stats: s}
+			monitor.bus.Publish(base.SinkSaturationTopic, saturation.Event())
+			monitor.alerted[key] = true
+		}
+	}
+}
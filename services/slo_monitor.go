@@ -0,0 +1,137 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sloEvaluationInterval = time.Minute
+)
+
+// SLOMonitor evaluates the SLOs of the tasks against their JobHistory every
+// minute. A breach raises an alert and is published to SLOBreachTopic of the
+// bus once, until the objective is met again
+type SLOMonitor struct {
+	history   *base.JobHistory
+	bus       *base.EventBus
+	slos      map[string]*base.SLO // TaskConfigKey indexed
+	breached  map[string]bool      // TaskConfigKey + objective indexed
+	reports   []base.SLOReport
+	mutex     sync.Mutex
+	lifecycle base.Lifecycle
+}
+
+func NewSLOMonitor(history *base.JobHistory, bus *base.EventBus) *SLOMonitor {
+	return &SLOMonitor{
+		history:  history,
+		bus:      bus,
+		slos:     make(map[string]*base.SLO),
+		breached: make(map[string]bool),
+	}
+}
+
+func (monitor *SLOMonitor) Start() {
+	if monitor.lifecycle.Start("SLOMonitor") != nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(sloEvaluationInterval)
+		defer ticker.Stop()
+
+		for monitor.lifecycle.Running() {
+			select {
+			case <-ticker.C:
+				monitor.evaluate(time.Now())
+			}
+		}
+	}()
+	glog.Infof("SLOMonitor started...")
+}
+
+func (monitor *SLOMonitor) Stop() {
+	if monitor.lifecycle.Stop("SLOMonitor") != nil {
+		return
+	}
+	glog.Infof("SLOMonitor stopped...")
+}
+
+func (monitor *SLOMonitor) Status() string {
+	return monitor.lifecycle.Status()
+}
+
+// Register replaces the SLO of the task, the tasks without objectives are
+// not monitored
+func (monitor *SLOMonitor) Register(task base.BaseConfig) {
+	slo, err := base.ParseSLO(task)
+	if err != nil {
+		glog.Errorf("Ignore the SLO of task=%s, error=%s", task[base.TaskConfigKey], err)
+	}
+
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if slo == nil {
+		delete(monitor.slos, task[base.TaskConfigKey])
+	} else {
+		monitor.slos[task[base.TaskConfigKey]] = slo
+	}
+}
+
+// Reports returns the last evaluation, ordered by task and objective
+func (monitor *SLOMonitor) Reports() []base.SLOReport {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	return append([]base.SLOReport(nil), monitor.reports...)
+}
+
+func (monitor *SLOMonitor) evaluate(now time.Time) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	var reports []base.SLOReport
+	for key, slo := range monitor.slos {
+		reports = append(reports, base.EvaluateSLO(key, slo, monitor.history.Runs(key), now)...)
+	}
+	sort.Sort(sloReportSorter(reports))
+
+	for i := range reports {
+		report := &reports[i]
+		id := report.Key + "/" + report.Objective
+		if report.Breached && !monitor.breached[id] {
+			glog.Errorf("Alert: SLO breach, task=%s, objective=%s, target=%v, actual=%.2f, budget burn=%.2f",
+				report.Key, report.Objective, report.Target, report.Actual, report.BudgetBurn)
+			monitor.bus.Publish(base.SLOBreachTopic, report.Event())
+		} else if !report.Breached && monitor.breached[id] {
+			glog.Infof("SLO recovered, task=%s, objective=%s, actual=%.2f", report.Key, report.Objective, report.Actual)
+		}
+
+		if report.Breached {
+			monitor.breached[id] = true
+		} else {
+			delete(monitor.breached, id)
+		}
+	}
+	monitor.reports = reports
+}
+
+type sloReportSorter []base.SLOReport
+
+func (reports sloReportSorter) Len() int {
+	return len(reports)
+}
+
+func (reports sloReportSorter) Swap(i, j int) {
+	reports[i], reports[j] = reports[j], reports[i]
+}
+
+func (reports sloReportSorter) Less(i, j int) bool {
+	if reports[i].Key != reports[j].Key {
+		return reports[i].Key < reports[j].Key
+	}
+	return reports[i].Objective < reports[j].Objective
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
+
+const (
+	dumpRecentRuns = 10
+)
+
+type JobDump struct {
+	Key        string
+	Degraded   bool
+	Checkpoint string          `json:",omitempty"`
+	QueueDepth int             // -1 if the sink doesn't queue
+	Sink       *base.SinkStats `json:",omitempty"`
+	RecentRuns []base.JobRun
+}
+
+// StateDump is a snapshot of the in-memory state of the collector for
+// debugging, for e.g. stuck collections
+type StateDump struct {
+	Host         string
+	Time         string
+	Jobs         []JobDump
+	ConfigErrors []base.NegativeCacheEntry
+	Rejections   []TaskRejection
+	Goroutines   string
+}
+
+// DumpState returns a snapshot of the jobs, their checkpoints, the queue
+// depths of their sinks, their recent runs and the goroutine stacks
+func (cs *CollectService) DumpState() *StateDump {
+	cs.jobsMutex.Lock()
+	jobs := make(map[string]base.Job, len(cs.jobs))
+	for key, job := range cs.jobs {
+		jobs[key] = job
+	}
+	cs.jobsMutex.Unlock()
+
+	degraded := make(map[string]bool)
+	for _, key := range cs.jobFactory.DegradedJobs() {
+		degraded[key] = true
+	}
+
+	keys := make([]string, 0, len(jobs))
+	for key := range jobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dump := &StateDump{
+		Host:         cs.host,
+		Time:         time.Now().Format(time.RFC3339Nano),
+		ConfigErrors: cs.jobFactory.ConfigErrors(),
+		Rejections:   cs.Rejections(),
+	}
+
+	for _, key := range keys {
+		jobDump := JobDump{
+			Key:        key,
+			Degraded:   degraded[key],
+			QueueDepth: -1,
+		}
+
+		if job, ok := jobs[key].(*ReaderJob); ok {
+			jobDump.QueueDepth = base.QueueDepth(job.counter)
+			if stats, ok := base.SinkStatsOf(job.counter); ok {
+				jobDump.Sink = &stats
+			}
+			if job.checkpoint != nil {
+				ckpt, err := job.checkpoint.GetCheckpoint(job.config)
+				if err != nil {
+					jobDump.Checkpoint = fmt.Sprintf("error=%s", err)
+				} else {
+					jobDump.Checkpoint = string(ckpt)
+				}
+			}
+
+			runs := cs.jobFactory.JobHistory().Runs(job.key)
+			if len(runs) > dumpRecentRuns {
+				runs = runs[len(runs)-dumpRecentRuns:]
+			}
+			jobDump.RecentRuns = runs
+		}
+		dump.Jobs = append(dump.Jobs, jobDump)
+	}
+
+	var stacks bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&stacks, 2)
+	dump.Goroutines = stacks.String()
+	return dump
+}
+
+// SinkStats returns the buffering of the sinks of the jobs which track it,
+// TaskConfigKey indexed
+func (cs *CollectService) SinkStats() map[string]base.SinkStats {
+	cs.jobsMutex.Lock()
+	defer cs.jobsMutex.Unlock()
+
+	res := make(map[string]base.SinkStats)
+	for key, job := range cs.jobs {
+		if job, ok := job.(*ReaderJob); ok {
+			if stats, ok := base.SinkStatsOf(job.counter); ok {
+				res[key] = stats
+			}
+		}
+	}
+	return res
+}
+
+// EffectiveConfig returns the config of the job of key as it runs, completed
+// with the defaults of its reader, false if there is no such job
+func (cs *CollectService) EffectiveConfig(key string) (base.BaseConfig, bool) {
+	cs.jobsMutex.Lock()
+	job, ok := cs.jobs[key].(*ReaderJob)
+	cs.jobsMutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	if reader, ok := job.reader.(interface{ EffectiveConfig() base.BaseConfig }); ok {
+		return reader.EffectiveConfig(), true
+	}
+
+	config := make(base.BaseConfig, len(job.config))
+	for k, v := range job.config {
+		config[k] = v
+	}
+	return config, true
+}
+
+// WriteStateDump writes DumpState in JSON to a new file in DumpDir, the
+// temp directory by default
+// @Return: the file name
+func (cs *CollectService) WriteStateDump() (string, error) {
+	dir := cs.config[base.DumpDir]
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	content, err := json.MarshalIndent(cs.DumpState(), "", "    ")
+	if err != nil {
+		glog.Errorf("Failed to marshal state dump, error=%s", err)
+		return "", err
+	}
+
+	fileName := filepath.Join(dir, fmt.Sprintf("descartes_dump_%s_%d.json", cs.host, time.Now().UnixNano()))
+	err = ioutil.WriteFile(fileName, content, 0600)
+	if err != nil {
+		glog.Errorf("Failed to write state dump to %s, error=%s", fileName, err)
+		return "", err
+	}
+	glog.Infof("Wrote state dump to %s", fileName)
+	return fileName, nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	"github.com/chenziliang/descartes/sinks/tsdb"
+	kafkareader "github.com/chenziliang/descartes/sources/kafka"
+	"github.com/golang/glog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	statsExportInterval = 10 * time.Second
+	// Points kept while the time-series database is unavailable, the oldest
+	// are dropped beyond it
+	maxPendingPoints = 100000
+)
+
+var (
+	// The heartbeat stats of ";" separated items, exported as their counts
+	exportedListStats = []string{base.DegradedJobs, base.ConfigErrorJobs, base.FailedSinks, base.SaturatedSinks}
+	// The heartbeat stats which are the tags of the series
+	exportedTagStats = map[string]string{base.Host: "host", base.App: "app", base.Platform: "platform"}
+)
+
+// StatsExporter writes the heartbeats of the collectors in the TaskStats
+// topic into a time-series database, so the collector performance can be
+// analyzed over time. Every numeric stat is a series, for e.g.
+// descartes_records_written, tagged with the host, app and platform of the
+// collector
+type StatsExporter struct {
+	config       base.BaseConfig
+	client       *base.KafkaClient
+	writer       tsdb.Writer
+	readers      []base.DataReader
+	pending      []tsdb.Point
+	pendingMutex sync.Mutex
+	lifecycle    base.Lifecycle
+}
+
+// NewStatsExporter
+// @config: ControlKafkaBrokers or KafkaBrokers and the TSDB configs of tsdb.NewWriter
+func NewStatsExporter(config base.BaseConfig) *StatsExporter {
+	writer, err := tsdb.NewWriter(config)
+	if err != nil {
+		glog.Errorf("Failed to create time-series database writer, error=%s", err)
+		return nil
+	}
+
+	client := base.NewKafkaClient(base.ControlKafkaConfig(config), "StatsExporterClient")
+	if client == nil {
+		return nil
+	}
+
+	return &StatsExporter{
+		config: config,
+		client: client,
+		writer: writer,
+	}
+}
+
+func (exporter *StatsExporter) Start() {
+	if exporter.lifecycle.Start("StatsExporter") != nil {
+		return
+	}
+
+	topicPartitions, err := exporter.client.TopicPartitions(base.TaskStats)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to get partitions for topic=%s", base.TaskStats))
+	}
+
+	writer := memory.NewMemoryDataWriter()
+	for _, partition := range topicPartitions[base.TaskStats] {
+		config := base.BaseConfig{
+			base.KafkaTopic:      base.TaskStats,
+			base.KafkaPartition:  fmt.Sprintf("%d", partition),
+			base.UseOffsetNewest: "1",
+		}
+
+		reader := kafkareader.NewKafkaDataReader(exporter.client, config, writer, base.NewNullCheckpointer())
+		if reader == nil {
+			panic("Failed to create kafka reader")
+		}
+		exporter.readers = append(exporter.readers, reader)
+		reader.Start()
+		go reader.IndexData()
+	}
+
+	go exporter.export(writer)
+	glog.Infof("StatsExporter started...")
+}
+
+// Stop writes the pending points before it returns
+func (exporter *StatsExporter) Stop() {
+	if exporter.lifecycle.Stop("StatsExporter") != nil {
+		return
+	}
+
+	for _, reader := range exporter.readers {
+		reader.Stop()
+	}
+	exporter.flush()
+	exporter.client.Close()
+	glog.Infof("StatsExporter stopped...")
+}
+
+func (exporter *StatsExporter) Status() string {
+	return exporter.lifecycle.Status()
+}
+
+func (exporter *StatsExporter) export(writer *memory.MemoryDataWriter) {
+	ticker := time.NewTicker(statsExportInterval)
+	defer ticker.Stop()
+
+	for exporter.lifecycle.Running() {
+		select {
+		case data := <-writer.Data():
+			exporter.add(data)
+		case <-ticker.C:
+			exporter.flush()
+		}
+	}
+}
+
+func (exporter *StatsExporter) add(data *base.Data) {
+	var points []tsdb.Point
+	for _, rawData := range data.RawData {
+		heartbeat := make(base.BaseConfig)
+		if err := json.Unmarshal(rawData, &heartbeat); err != nil {
+			glog.Errorf("Unexpected heartbeat format, got=%s", string(rawData))
+			continue
+		}
+		points = append(points, heartbeatPoints(heartbeat)...)
+	}
+
+	exporter.pendingMutex.Lock()
+	exporter.pending = append(exporter.pending, points...)
+	if dropped := len(exporter.pending) - maxPendingPoints; dropped > 0 {
+		glog.Warningf("Drop %d points of the collector stats not written yet", dropped)
+		exporter.pending = exporter.pending[dropped:]
+	}
+	exporter.pendingMutex.Unlock()
+}
+
+// flush writes the pending points, they are kept for the next flush on
+// failure
+func (exporter *StatsExporter) flush() {
+	exporter.pendingMutex.Lock()
+	points := exporter.pending
+	exporter.pending = nil
+	exporter.pendingMutex.Unlock()
+
+	if err := exporter.writer.WritePoints(points); err != nil {
+		exporter.pendingMutex.Lock()
+		exporter.pending = append(points, exporter.pending...)
+		exporter.pendingMutex.Unlock()
+	}
+}
+
+// heartbeatPoints returns the numeric stats of heartbeat as points, the
+// per instance and per job health scores and the HTTP transport stats per
+// destination host as series tagged with them
+func heartbeatPoints(heartbeat base.BaseConfig) []tsdb.Point {
+	at := time.Now()
+	if nanos, err := strconv.ParseInt(heartbeat[base.Timestamp], 10, 64); err == nil {
+		at = time.Unix(0, nanos)
+	}
+
+	tags := make(map[string]string, len(exportedTagStats))
+	for stat, tag := range exportedTagStats {
+		tags[tag] = heartbeat[stat]
+	}
+
+	newPoint := func(name string, value float64, extra ...string) tsdb.Point {
+		pointTags := make(map[string]string, len(tags)+len(extra)/2)
+		for k, v := range tags {
+			pointTags[k] = v
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			pointTags[extra[i]] = extra[i+1]
+		}
+		return tsdb.Point{Name: "descartes_" + name, Tags: pointTags, Value: value, Time: at}
+	}
+
+	var points []tsdb.Point
+	for stat, value := range heartbeat {
+		if stat == base.Timestamp {
+			continue
+		}
+
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			points = append(points, newPoint(snakeCase(stat), number))
+		}
+	}
+
+	for _, stat := range exportedListStats {
+		count := 0
+		if heartbeat[stat] != "" {
+			count = len(strings.Split(heartbeat[stat], ";"))
+		}
+		points = append(points, newPoint(snakeCase(stat)+"_count", float64(count)))
+	}
+
+	for instance, score := range base.ParseInstanceHealth(heartbeat[base.InstanceHealth]) {
+		points = append(points, newPoint("instance_health", float64(score), "instance", instance))
+	}
+
+	// Same "key=score" format
+	for job, score := range base.ParseInstanceHealth(heartbeat[base.UnhealthyJobs]) {
+		points = append(points, newPoint("job_health", float64(score), "job", job))
+	}
+
+	for _, stats := range base.ParseHTTPTransportStats(heartbeat[base.HTTPTransport]) {
+		for name, value := range map[string]float64{
+			"open":               float64(stats.Open),
+			"in_use":             float64(stats.InUse),
+			"idle":               float64(stats.Idle),
+			"dns_seconds":        stats.DNSTime.Seconds(),
+			"connect_seconds":    stats.ConnectTime.Seconds(),
+			"handshake_seconds":  stats.HandshakeTime.Seconds(),
+			"first_byte_seconds": stats.FirstByteTime.Seconds(),
+		} {
+			points = append(points, newPoint("http_transport_"+name, value, "destination", stats.Host))
+		}
+	}
+	return points
+}
+
+// snakeCase returns the stat name in the metric naming convention, for e.g.
+// "InflightBytes" is "inflight_bytes"
+func snakeCase(name string) string {
+	var buf strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// The boundaries of the words and of the acronyms, for e.g. HTTPProtocols
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
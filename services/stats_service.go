@@ -6,14 +6,13 @@ import (
 	"github.com/golang/glog"
 	"os"
 	kafkawriter "github.com/chenziliang/descartes/sinks/kafka"
-	"sync/atomic"
 	"time"
 )
 
 type StatsService struct {
 	kafkaClient *base.KafkaClient
 	config      base.BaseConfig
-	started     int32
+	lifecycle   base.Lifecycle
 }
 
 const (
@@ -21,7 +20,7 @@ const (
 )
 
 func NewStatsService(config base.BaseConfig) *StatsService {
-	client := base.NewKafkaClient(config, "StatsMonitorClient")
+	client := base.NewKafkaClient(base.ControlKafkaConfig(config), "StatsMonitorClient")
 	if client == nil {
 		return nil
 	}
@@ -33,26 +32,27 @@ func NewStatsService(config base.BaseConfig) *StatsService {
 }
 
 func (ss *StatsService) Start() {
-	if !atomic.CompareAndSwapInt32(&ss.started, 0, 1) {
-		glog.Infof("StatsService already started.")
+	if ss.lifecycle.Start("StatsService") != nil {
+		return
 	}
 
 	go ss.dumpCurrentTopics()
 }
 
 func (ss *StatsService) Stop() {
-	if !atomic.CompareAndSwapInt32(&ss.started, 1, 0) {
-		glog.Infof("StatsService already stopped.")
+	if ss.lifecycle.Stop("StatsService") != nil {
 		return
 	}
 	glog.Infof("StatsService stopped...")
 }
 
+func (ss *StatsService) Status() string {
+	return ss.lifecycle.Status()
+}
+
 func (ss *StatsService) dumpCurrentTopics() {
-	brokerConfig := base.BaseConfig{
-		base.KafkaBrokers:   ss.config[base.KafkaBrokers],
-		base.KafkaTopic:     base.TaskStats,
-	}
+	brokerConfig := base.ControlKafkaConfig(ss.config)
+	brokerConfig[base.KafkaTopic] = base.TaskStats
 
 	writer := kafkawriter.NewKafkaDataWriter(brokerConfig)
 	if writer == nil {
@@ -70,7 +70,7 @@ func (ss *StatsService) dumpCurrentTopics() {
 	}
 
 	ticker := time.Tick(dumpInterval)
-	for atomic.LoadInt32(&ss.started) != 0 {
+	for ss.lifecycle.Running() {
 		select {
 		case <-ticker:
 			topicPartitions, err := ss.kafkaClient.TopicPartitions("")
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strings"
+	"time"
+)
+
+// taskMessage is a task sent to host out of its publishing cycle by the
+// reconciliation, for e.g. a release of the task
+type taskMessage struct {
+	host string
+	task base.BaseConfig
+}
+
+// loadAssignments replaces the desired assignments in memory with the ones
+// in ZooKeeper, returns false if they can't be read
+func (ss *ScheduleService) loadAssignments() bool {
+	assignments, err := ss.assignments.List()
+	if err != nil {
+		return false
+	}
+
+	desired := make(map[string]*base.Assignment, len(assignments))
+	for _, assignment := range assignments {
+		desired[assignment.TaskConfigKey] = assignment
+	}
+
+	ss.desiredMutex.Lock()
+	ss.desired = desired
+	ss.desiredMutex.Unlock()
+	glog.Infof("Loaded %d task assignments", len(desired))
+	return true
+}
+
+// assignedHost returns the host the task is desired to run on. A task is
+// assigned to an available host when it is published first, and stays there
+// as long as the host is available, so a collector joining doesn't take the
+// tasks over from the others. When the host is not available any more, the
+// task moves to another one. The assignments are persisted, they survive the
+// leader changes. The Kafka partition tasks run long on whichever collector
+// gets them, they are placed every time they are published as before
+func (ss *ScheduleService) assignedHost(config base.BaseConfig) string {
+	if config[base.App] == base.KafkaApp {
+		return ss.getAvailableGatheringHost(config)
+	}
+
+	key := config[base.TaskConfigKey]
+	ss.desiredMutex.Lock()
+	assignment := ss.desired[key]
+	ss.desiredMutex.Unlock()
+
+	if assignment != nil {
+		for _, host := range ss.availableHosts(config) {
+			if host == assignment.Host {
+				return host
+			}
+		}
+	}
+
+	host := ss.getAvailableGatheringHost(config)
+	if host == "" {
+		return ""
+	}
+
+	if assignment != nil {
+		glog.Warningf("Alert: move task=%s from host=%s, which is not available, to host=%s", key, assignment.Host, host)
+		ss.sendTask(assignment.Host, releaseOf(config))
+	}
+
+	assignment = &base.Assignment{
+		TaskConfigKey: key,
+		App:           config[base.App],
+		Host:          host,
+		Assigned:      time.Now().UnixNano(),
+	}
+	if err := ss.assignments.Put(assignment); err != nil {
+		// Kept in memory, persisted when the task is assigned next time
+		glog.Errorf("Failed to persist the assignment of task=%s to host=%s, error=%s", key, host, err)
+	}
+
+	ss.desiredMutex.Lock()
+	ss.desired[key] = assignment
+	ss.desiredMutex.Unlock()
+	return host
+}
+
+// unassign drops the assignment of the task of key, and releases the task
+// from its host
+func (ss *ScheduleService) unassign(config base.BaseConfig) {
+	key := config[base.TaskConfigKey]
+	ss.desiredMutex.Lock()
+	assignment, ok := ss.desired[key]
+	delete(ss.desired, key)
+	ss.desiredMutex.Unlock()
+
+	if err := ss.assignments.Delete(key); err != nil {
+		glog.Errorf("Failed to delete the assignment of task=%s, error=%s", key, err)
+	}
+
+	if ok {
+		ss.sendTask(assignment.Host, releaseOf(config))
+	}
+}
+
+// releaseOf returns the message which makes a collector stop collecting task
+func releaseOf(task base.BaseConfig) base.BaseConfig {
+	return base.BaseConfig{
+		base.TaskConfigKey:    task[base.TaskConfigKey],
+		base.App:              task[base.App],
+		base.TaskConfigAction: base.TaskConfigDelete,
+	}
+}
+
+func (ss *ScheduleService) sendTask(host string, task base.BaseConfig) {
+	select {
+	case ss.assignChan <- taskMessage{host: host, task: task}:
+	default:
+		glog.Warningf("Too many pending assignments, drop the %s of task=%s to host=%s, it is sent again when reconciled",
+			task[base.TaskConfigAction], task[base.TaskConfigKey], host)
+	}
+}
+
+// doReconcile is the reconciliation loop of the leader. Every
+// ReconcileInterval it compares the desired assignments with the tasks the
+// collectors report running in their heartbeats, see base.RunningJobs, and
+// corrects the differences, see reconcile. The published tasks are not
+// assumed to be received any more
+func (ss *ScheduleService) doReconcile() {
+	interval := base.GetReconcileInterval(ss.config)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The leader before may have changed the assignments
+	loaded := ss.leader()
+	for ss.lifecycle.Running() {
+		select {
+		case <-ticker.C:
+			if !ss.leader() {
+				loaded = false
+				continue
+			}
+
+			if !loaded {
+				if loaded = ss.loadAssignments(); !loaded {
+					continue
+				}
+			}
+			ss.reconcile(time.Now(), interval)
+		}
+	}
+}
+
+// reconcile moves the tasks off the hosts which are not available, sends the
+// tasks again to the hosts which don't report them after a grace period, and
+// releases the tasks from the hosts they are not assigned to, for e.g. a
+// collector which came back after its tasks moved. Only the tasks scheduled
+// by this scheduler are reconciled, the assignments of the others are kept
+// since a new leader may not have received all of the tasks yet, the
+// assignments of the deleted and the archived tasks are dropped by them
+func (ss *ScheduleService) reconcile(now time.Time, interval time.Duration) {
+	grace := 2 * base.GetHeartbeatInterval(ss.config)
+	if grace < 2*interval {
+		grace = 2 * interval
+	}
+
+	running := ss.runningTasks()
+	for _, config := range ss.jobConfigsSnapshot() {
+		key := config[base.TaskConfigKey]
+		host := ss.assignedHost(config)
+		if host == "" {
+			continue
+		}
+
+		confirmed := false
+		for _, runningHost := range running[key] {
+			if runningHost == host {
+				confirmed = true
+				continue
+			}
+
+			// Released once it is back and reports the task again
+			if ss.failureDetector.Status(runningHost+"!"+config[base.App], now.UnixNano()) != base.NodeAlive {
+				continue
+			}
+			glog.Warningf("Task=%s runs on host=%s while assigned to host=%s, release it", key, runningHost, host)
+			ss.sendTask(runningHost, releaseOf(config))
+		}
+
+		ss.desiredMutex.Lock()
+		assignment := ss.desired[key]
+		resend := false
+		if assignment != nil && confirmed {
+			assignment.Confirm(now)
+		} else if assignment != nil && assignment.Overdue(grace, now) {
+			assignment.Resent = now.UnixNano()
+			resend = true
+		}
+		ss.desiredMutex.Unlock()
+
+		if resend {
+			glog.Warningf("Host=%s doesn't report task=%s in %s, send it again", host, key, grace)
+			ss.sendTask(host, config)
+		}
+	}
+}
+
+// runningTasks returns the hosts which report each task running in their
+// last heartbeats, TaskConfigKey indexed
+func (ss *ScheduleService) runningTasks() map[string][]string {
+	ss.liveCollectorsMutex.Lock()
+	defer ss.liveCollectorsMutex.Unlock()
+
+	running := make(map[string][]string)
+	for host, apps := range ss.liveCollectors {
+		// Every app of a collector reports all of its tasks
+		seen := make(map[string]bool)
+		for _, heartbeat := range apps {
+			for _, key := range strings.Split(heartbeat[base.RunningJobs], ";") {
+				if key == "" || seen[key] {
+					continue
+				}
+				seen[key] = true
+				running[key] = append(running[key], host)
+			}
+		}
+	}
+	return running
+}
+
+// AssignmentTable returns the persisted assignments of the tasks
+func (ss *ScheduleService) AssignmentTable() *base.AssignmentTable {
+	return ss.assignments
+}
+
+// writeTask writes task to the Tasks topic for host
+func writeTask(writer base.DataWriter, host string, task base.BaseConfig) {
+	rawData, err := json.Marshal(task)
+	if err != nil {
+		glog.Errorf("Failed to marshal task config, error=%s", err)
+		return
+	}
+
+	data := &base.Data{
+		MetaInfo: base.BaseConfig{
+			base.Host: host,
+		},
+		RawData: [][]byte{rawData},
+	}
+	writer.WriteData(data)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"strings"
+)
+
+// TaskCheckpoint is the checkpoint of a task as inspected or exported by
+// the checkpoint command
+type TaskCheckpoint struct {
+	TaskConfigKey string
+	Key           string
+	Method        string
+	Checkpoint    string `json:",omitempty"` // empty if never checkpointed
+}
+
+// TaskCheckpointKey returns the checkpoint key the collector job of task
+// uses, see newSnowJob, newKafkaJob and newSubprocessJob
+func TaskCheckpointKey(task base.BaseConfig) string {
+	var keyParts []string
+	switch task[base.App] {
+	case base.KafkaApp:
+		keyParts = []string{"", task[base.KafkaTopic], task[base.KafkaPartition]}
+	case base.SubprocessApp:
+		keyParts = []string{"", base.SubprocessApp, encodeURL(task[base.TaskConfigKey])}
+	default:
+		keyParts = []string{"", encodeURL(task[base.ServerURL]), task[base.Username], task[base.Metric]}
+	}
+	return strings.Join(keyParts, "/")
+}
+
+// GetTaskCheckpoint reads the checkpoint of task through the checkpointer
+// its collector job would create
+// @globalConfig: overridden by task
+// @key: overrides TaskCheckpointKey if not empty, for e.g. for the per
+// domain checkpoints of snow tasks
+func GetTaskCheckpoint(globalConfig, task base.BaseConfig, key string) (*TaskCheckpoint, error) {
+	config, key := taskCheckpointConfig(globalConfig, task, key)
+	data, err := readCheckpoint(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TaskCheckpoint{
+		TaskConfigKey: config[base.TaskConfigKey],
+		Key:           key,
+		Method:        config[base.CheckpointMethod],
+		Checkpoint:    string(data),
+	}, nil
+}
+
+// DeleteTaskCheckpoint deletes the checkpoint of task, see GetTaskCheckpoint
+func DeleteTaskCheckpoint(globalConfig, task base.BaseConfig, key string) error {
+	config, _ := taskCheckpointConfig(globalConfig, task, key)
+	return deleteCheckpoint(config)
+}
+
+func readCheckpoint(config base.BaseConfig) ([]byte, error) {
+	checkpoint := createCheckpointer(config)
+	if checkpoint == nil {
+		return nil, errors.New(fmt.Sprintf("Failed to create %s checkpointer", config[base.CheckpointMethod]))
+	}
+	checkpoint.Start()
+	defer checkpoint.Stop()
+
+	return checkpoint.GetCheckpoint(config)
+}
+
+func deleteCheckpoint(config base.BaseConfig) error {
+	checkpoint := createCheckpointer(config)
+	if checkpoint == nil {
+		return errors.New(fmt.Sprintf("Failed to create %s checkpointer", config[base.CheckpointMethod]))
+	}
+	checkpoint.Start()
+	defer checkpoint.Stop()
+
+	return checkpoint.DeleteCheckpoint(config)
+}
+
+func taskCheckpointConfig(globalConfig, task base.BaseConfig, key string) (base.BaseConfig, string) {
+	config := make(base.BaseConfig, len(globalConfig)+len(task)+1)
+	for k, v := range globalConfig {
+		config[k] = v
+	}
+	for k, v := range task {
+		config[k] = v
+	}
+
+	if key == "" {
+		key = TaskCheckpointKey(config)
+	}
+	config[base.Key] = key
+	return config, key
+}
+
+// taskCheckpointConfigs returns the checkpoint configs of task, one per
+// domain of a snow task with Domains, which is only checkpointed per domain,
+// see domainKeyInfo of the snow reader
+func taskCheckpointConfigs(globalConfig, task base.BaseConfig) []base.BaseConfig {
+	config, key := taskCheckpointConfig(globalConfig, task, "")
+	if config[base.App] == base.KafkaApp || config[base.App] == base.SubprocessApp {
+		return []base.BaseConfig{config}
+	}
+
+	var configs []base.BaseConfig
+	for _, domain := range strings.Split(config[base.Domains], ",") {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+
+		domainConfig := make(base.BaseConfig, len(config))
+		for k, v := range config {
+			domainConfig[k] = v
+		}
+		domainConfig[base.Key] = key + "_" + domain
+		if domainConfig[base.CheckpointKey] != "" {
+			domainConfig[base.CheckpointKey] += "_" + domain
+		}
+		configs = append(configs, domainConfig)
+	}
+
+	if len(configs) == 0 {
+		return []base.BaseConfig{config}
+	}
+	return configs
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	janitorInterval = time.Hour
+)
+
+// getArchivePolicy returns how long the checkpoint of a task doesn't advance
+// before it is archived, 0 if the tasks are never archived, and how long an
+// archived task is kept before its state is purged, 0 if never purged
+func getArchivePolicy(config base.BaseConfig) (time.Duration, time.Duration) {
+	days := func(key string) time.Duration {
+		n, err := strconv.Atoi(config[key])
+		if config[key] != "" && (err != nil || n < 0) {
+			glog.Errorf("Invalid %s=%s, expect days", key, config[key])
+			return 0
+		}
+		return time.Duration(n) * 24 * time.Hour
+	}
+	return days(base.ArchiveAfterDays), days(base.ArchivePurgeDays)
+}
+
+// doArchiveStaleTasks is the janitor of the tasks whose checkpoint hasn't
+// advanced in ArchiveAfterDays, for e.g. of deleted tables or decommissioned
+// instances. The leader tracks the checkpoints and archives the stale tasks,
+// every scheduler stops scheduling the archived ones. Their state is purged
+// ArchivePurgeDays after they are archived. Deleting or updating the task
+// brings it back
+func (ss *ScheduleService) doArchiveStaleTasks() {
+	archiveAfter, purgeAfter := getArchivePolicy(ss.config)
+	if archiveAfter <= 0 {
+		return
+	}
+
+	glog.Infof("Archive the tasks stale for %s, purge after %s", archiveAfter, purgeAfter)
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for ss.lifecycle.Running() {
+		select {
+		case <-ticker.C:
+			if ss.leader() {
+				ss.archiveStaleTasks(time.Now(), archiveAfter, purgeAfter)
+			}
+			ss.removeArchivedJobs()
+		}
+	}
+}
+
+func (ss *ScheduleService) archiveStaleTasks(now time.Time, archiveAfter, purgeAfter time.Duration) {
+	for _, config := range ss.jobConfigsSnapshot() {
+		key := config[base.TaskConfigKey]
+		checkpoint, ok, err := observeCheckpoint(ss.config, config)
+		if err != nil {
+			glog.Errorf("Failed to get checkpoint of task=%s, error=%s", key, err)
+			continue
+		} else if !ok {
+			// Never checkpointed, whether it collects can't be told
+			continue
+		}
+
+		progress, err := ss.archive.Get(key)
+		if err != nil {
+			glog.Errorf("Failed to get progress of task=%s, error=%s", key, err)
+			continue
+		}
+
+		if progress == nil {
+			progress = &base.TaskProgress{TaskConfigKey: key}
+		}
+
+		if !progress.Observe(checkpoint, now) {
+			if progress.Stale(now) < archiveAfter {
+				continue
+			}
+
+			glog.Errorf("Alert: archive task=%s, its checkpoint hasn't advanced since %s",
+				key, time.Unix(0, progress.Since).Format(time.RFC3339))
+			progress.Archived = now.UnixNano()
+			progress.Task = config
+		}
+
+		if err := ss.archive.Put(progress); err != nil {
+			glog.Errorf("Failed to save progress of task=%s, error=%s", key, err)
+		}
+	}
+
+	if purgeAfter > 0 {
+		ss.purgeArchivedTasks(now, purgeAfter)
+	}
+}
+
+// purgeArchivedTasks deletes the checkpoints and the topic registrations of
+// the tasks archived for purgeAfter. The archive records are kept, so the
+// tasks are not scheduled again when they are published
+func (ss *ScheduleService) purgeArchivedTasks(now time.Time, purgeAfter time.Duration) {
+	progresses, err := ss.archive.List()
+	if err != nil {
+		return
+	}
+
+	for _, progress := range progresses {
+		if progress.Archived == 0 || progress.Purged != 0 || now.Sub(time.Unix(0, progress.Archived)) < purgeAfter {
+			continue
+		}
+
+		key := progress.TaskConfigKey
+		if err := purgeCheckpoint(ss.config, progress.Task); err != nil {
+			glog.Errorf("Failed to purge checkpoint of archived task=%s, error=%s", key, err)
+			continue
+		}
+
+		if err := ss.topics.Deregister(key); err != nil {
+			glog.Errorf("Failed to deregister the output topic of archived task=%s, error=%s", key, err)
+		}
+
+		glog.Infof("Purged the state of task=%s archived at %s", key, time.Unix(0, progress.Archived).Format(time.RFC3339))
+		progress.Purged = now.UnixNano()
+		if err := ss.archive.Put(progress); err != nil {
+			glog.Errorf("Failed to save progress of task=%s, error=%s", key, err)
+		}
+	}
+}
+
+// observeCheckpoint returns the checkpoints of task, of all of its domains if
+// it has Domains, false if it has no checkpointer
+func observeCheckpoint(globalConfig, task base.BaseConfig) (string, bool, error) {
+	configs := taskCheckpointConfigs(globalConfig, task)
+	if configs[0][base.CheckpointMethod] == "null" {
+		return "", false, nil
+	}
+
+	checkpoints := make([]string, 0, len(configs))
+	for _, config := range configs {
+		data, err := readCheckpoint(config)
+		if err != nil {
+			return "", true, err
+		}
+		checkpoints = append(checkpoints, string(data))
+	}
+	return strings.Join(checkpoints, "\n"), true, nil
+}
+
+// purgeCheckpoint deletes the checkpoints of task, see observeCheckpoint
+func purgeCheckpoint(globalConfig, task base.BaseConfig) error {
+	configs := taskCheckpointConfigs(globalConfig, task)
+	if configs[0][base.CheckpointMethod] == "null" {
+		return nil
+	}
+
+	for _, config := range configs {
+		if err := deleteCheckpoint(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeArchivedJobs stops scheduling the archived tasks
+func (ss *ScheduleService) removeArchivedJobs() {
+	progresses, err := ss.archive.List()
+	if err != nil {
+		return
+	}
+
+	ss.jobsMutex.Lock()
+	defer ss.jobsMutex.Unlock()
+
+	for _, progress := range progresses {
+		job, ok := ss.jobs[progress.TaskConfigKey]
+		if progress.Archived == 0 || !ok {
+			continue
+		}
+
+		glog.Warningf("Stop scheduling archived task=%s", progress.TaskConfigKey)
+		ss.RemoveJob(job)
+		ss.unassign(ss.jobConfigs[progress.TaskConfigKey])
+		delete(ss.jobs, progress.TaskConfigKey)
+		delete(ss.jobConfigs, progress.TaskConfigKey)
+	}
+}
+
+// isArchived returns true if the task of key is archived
+func (ss *ScheduleService) isArchived(key string) bool {
+	progress, err := ss.archive.Get(key)
+	if err != nil {
+		glog.Errorf("Failed to get progress of task=%s, error=%s", key, err)
+		return false
+	}
+	return progress != nil && progress.Archived != 0
+}
+
+func (ss *ScheduleService) jobConfigsSnapshot() []base.BaseConfig {
+	ss.jobsMutex.Lock()
+	defer ss.jobsMutex.Unlock()
+
+	configs := make([]base.BaseConfig, 0, len(ss.jobConfigs))
+	for _, config := range ss.jobConfigs {
+		configs = append(configs, config)
+	}
+	return configs
+}
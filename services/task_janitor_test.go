@@ -0,0 +1,77 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTaskJanitorDomainCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "janitor")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	globalConfig := base.BaseConfig{
+		base.CheckpointMethod:    "localfile",
+		base.CheckpointDir:       dir,
+		base.CheckpointNamespace: "janitor",
+	}
+	task := base.BaseConfig{
+		base.TaskConfigKey: "/snow/incident",
+		base.ServerURL:     "https://snow.example.com",
+		base.Username:      "admin",
+		base.Metric:        "incident",
+		base.CheckpointKey: "incident",
+		base.Domains:       "acme, globex",
+	}
+
+	configs := taskCheckpointConfigs(globalConfig, task)
+	if len(configs) != 2 || configs[0][base.CheckpointKey] != "incident_acme" || configs[1][base.CheckpointKey] != "incident_globex" {
+		t.Fatalf("Expect a checkpoint config per domain, got %v", configs)
+	}
+
+	write := func(config base.BaseConfig, value string) {
+		ck := createCheckpointer(config)
+		ck.Start()
+		defer ck.Stop()
+		if err := ck.WriteCheckpoint(config, []byte(value)); err != nil {
+			t.Fatalf("Failed to write checkpoint, error=%s", err)
+		}
+	}
+
+	write(configs[0], "acme-1")
+	write(configs[1], "globex-1")
+	first, ok, err := observeCheckpoint(globalConfig, task)
+	if err != nil || !ok {
+		t.Fatalf("Failed to observe checkpoint, error=%v", err)
+	}
+
+	// Only one of the domains advances
+	write(configs[1], "globex-2")
+	second, _, err := observeCheckpoint(globalConfig, task)
+	if err != nil || second == first {
+		t.Errorf("Expect the checkpoint of a domain observed, got %q and %q, error=%v", first, second, err)
+	}
+
+	if err := purgeCheckpoint(globalConfig, task); err != nil {
+		t.Fatalf("Failed to purge checkpoint, error=%s", err)
+	}
+
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("Expect the checkpoints of every domain purged, got %v", left)
+	}
+
+	// Tasks without a checkpointer are neither observed nor purged
+	task[base.CheckpointMethod] = "null"
+	if _, ok, err := observeCheckpoint(globalConfig, task); ok || err != nil {
+		t.Errorf("Expect the task without checkpointer not observed, error=%v", err)
+	}
+
+	if err := purgeCheckpoint(globalConfig, task); err != nil {
+		t.Errorf("Expect the task without checkpointer not purged, error=%s", err)
+	}
+}
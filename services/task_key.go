@@ -0,0 +1,13 @@
+package services
+
+import (
+	"github.com/chenziliang/descartes/base"
+)
+
+// TaskKey returns the canonical TaskConfigKey of a source task derived from
+// App, ServerURL, Username, the tenant, and Metric, the endpoint. The
+// spellings of the same ServerURL get the same key
+func TaskKey(task base.BaseConfig) string {
+	topic := GenerateTopic(task[base.App], base.NormalizeServerURL(task[base.ServerURL]), task[base.Username])
+	return topic + "_" + task[base.Metric]
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	kafkareader "github.com/chenziliang/descartes/sources/kafka"
+	"github.com/golang/glog"
+	"sync"
+)
+
+const (
+	taskMonitorCapacity = 256
+)
+
+// TaskMonitor reads the newest messages of all partitions of a control topic,
+// for e.g. the tasks or the heartbeats, and hands them over to handle in one
+// goroutine in the order they are buffered. The readers block while
+// taskMonitorCapacity messages wait for handle, the Kafka offsets don't move
+// then, and the writes which found the buffer full are counted as overflows.
+// Stop stops the readers first, then handles the messages still buffered
+// before it returns, so none read is lost on shutdown
+type TaskMonitor struct {
+	topic   string
+	client  *base.KafkaClient
+	handle  func(data *base.Data)
+	writer  *memory.MemoryDataWriter
+	readers []base.DataReader
+	reading sync.WaitGroup
+	ctx     context.Context // canceled when the readers are stopped
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when the buffer is drained
+}
+
+func NewTaskMonitor(client *base.KafkaClient, topic string, handle func(data *base.Data)) *TaskMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TaskMonitor{
+		topic:  topic,
+		client: client,
+		handle: handle,
+		writer: memory.NewMemoryDataWriterSize(taskMonitorCapacity),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start returns error if the readers of the partitions can't be created
+func (monitor *TaskMonitor) Start() error {
+	topicPartitions, err := monitor.client.TopicPartitions(monitor.topic)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := base.NewNullCheckpointer()
+	for _, partition := range topicPartitions[monitor.topic] {
+		config := base.BaseConfig{
+			base.KafkaTopic:      monitor.topic,
+			base.KafkaPartition:  fmt.Sprintf("%d", partition),
+			base.UseOffsetNewest: "1",
+		}
+
+		reader := kafkareader.NewKafkaDataReader(monitor.client, config, monitor.writer, checkpoint)
+		if reader == nil {
+			monitor.stopReaders()
+			monitor.readers = nil
+			close(monitor.done)
+			return errors.New(fmt.Sprintf("Failed to create kafka reader for topic=%s, partition=%d", monitor.topic, partition))
+		}
+		monitor.readers = append(monitor.readers, reader)
+	}
+
+	for _, reader := range monitor.readers {
+		reader.Start()
+		monitor.reading.Add(1)
+		go func(r base.DataReader) {
+			defer monitor.reading.Done()
+			r.IndexData()
+		}(reader)
+	}
+
+	go monitor.dispatch()
+	return nil
+}
+
+func (monitor *TaskMonitor) dispatch() {
+	defer close(monitor.done)
+
+	var overflows int64
+	for {
+		select {
+		case data := <-monitor.writer.Data():
+			monitor.handle(data)
+			if n := monitor.writer.Overflows(); n != overflows {
+				glog.Warningf("Handling of topic=%s falls behind, %d messages waited for the buffer", monitor.topic, n-overflows)
+				overflows = n
+			}
+
+		case <-monitor.ctx.Done():
+			// The readers are stopped, handle the rest in order
+			for {
+				select {
+				case data := <-monitor.writer.Data():
+					monitor.handle(data)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopReaders cancels the readers and waits for them
+func (monitor *TaskMonitor) stopReaders() {
+	for _, reader := range monitor.readers {
+		if r, ok := reader.(base.CancelableDataReader); ok {
+			r.Cancel()
+		}
+	}
+	monitor.reading.Wait()
+
+	for _, reader := range monitor.readers {
+		reader.Stop()
+	}
+}
+
+func (monitor *TaskMonitor) Stop() {
+	monitor.stopReaders()
+	monitor.cancel()
+	<-monitor.done
+	glog.Infof("TaskMonitor of topic=%s stopped, overflows=%d", monitor.topic, monitor.writer.Overflows())
+}
+
+// Overflows returns the number of messages which waited for the buffer
+func (monitor *TaskMonitor) Overflows() int64 {
+	return monitor.writer.Overflows()
+}
@@ -0,0 +1,95 @@
+package blackhole
+
+import (
+	"context"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"sync/atomic"
+)
+
+// BlackholeDataWriter drops the data after counting it, and logs one of
+// every DryRunSample records. It is for validating a new task's query,
+// dedup behavior and volume before pointing it at a real sink
+type BlackholeDataWriter struct {
+	config      base.BaseConfig
+	sampleEvery int64
+	records     int64
+	bytes       int64
+	batches     int64
+	lifecycle   base.Lifecycle
+}
+
+// NewBlackholeDataWriter
+// @config: contains optional base.DryRunSample, log one of every N records,
+// no sampling if it is absent or not positive
+func NewBlackholeDataWriter(config base.BaseConfig) *BlackholeDataWriter {
+	sampleEvery, _ := strconv.ParseInt(config[base.DryRunSample], 10, 64)
+	return &BlackholeDataWriter{
+		config:      config,
+		sampleEvery: sampleEvery,
+	}
+}
+
+func (writer *BlackholeDataWriter) Start() {
+	if writer.lifecycle.Start("BlackholeDataWriter") != nil {
+		return
+	}
+	glog.Infof("BlackholeDataWriter started...")
+}
+
+func (writer *BlackholeDataWriter) Stop() {
+	if writer.lifecycle.Stop("BlackholeDataWriter") != nil {
+		return
+	}
+
+	records, bytes, batches := writer.Stats()
+	glog.Infof("BlackholeDataWriter stopped, task=%s dropped records=%d, bytes=%d, batches=%d",
+		writer.config[base.TaskConfigKey], records, bytes, batches)
+}
+
+func (writer *BlackholeDataWriter) Status() string {
+	return writer.lifecycle.Status()
+}
+
+func (writer *BlackholeDataWriter) WriteData(data *base.Data) error {
+	return writer.doWriteData(data)
+}
+
+func (writer *BlackholeDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.doWriteData(data)
+}
+
+func (writer *BlackholeDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.doWriteData(data)
+}
+
+func (writer *BlackholeDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.doWriteData(data)
+}
+
+// Stats returns the total records, bytes and batches dropped so far
+func (writer *BlackholeDataWriter) Stats() (int64, int64, int64) {
+	return atomic.LoadInt64(&writer.records), atomic.LoadInt64(&writer.bytes), atomic.LoadInt64(&writer.batches)
+}
+
+func (writer *BlackholeDataWriter) doWriteData(data *base.Data) error {
+	if err := data.Serialize(); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&writer.batches, 1)
+	for _, rawData := range data.RawData {
+		if len(rawData) == 0 {
+			continue
+		}
+
+		n := atomic.AddInt64(&writer.records, 1)
+		atomic.AddInt64(&writer.bytes, int64(len(rawData)))
+		if writer.sampleEvery > 0 && n%writer.sampleEvery == 1%writer.sampleEvery {
+			glog.Infof("Dry run sample #%d task=%s meta=%s record=%s",
+				n, writer.config[base.TaskConfigKey], data.MetaInfo, string(rawData))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package blackhole
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"testing"
+)
+
+func TestBlackholeDataWriter(t *testing.T) {
+	writer := NewBlackholeDataWriter(base.BaseConfig{base.DryRunSample: "2"})
+	writer.Start()
+	defer writer.Stop()
+
+	data := base.NewData(nil, [][]byte{
+		[]byte("a=b,c=d"),
+		nil,
+		[]byte("1=2,3=4"),
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := writer.WriteData(data); err != nil {
+			t.Errorf("BlackholeDataWriter should not error out, got error=%s", err)
+		}
+	}
+
+	records, bytes, batches := writer.Stats()
+	if records != 6 || bytes != 42 || batches != 3 {
+		t.Errorf("Expect records=6, bytes=42, batches=3, got records=%d, bytes=%d, batches=%d", records, bytes, batches)
+	}
+}
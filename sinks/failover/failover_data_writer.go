@@ -0,0 +1,197 @@
+package failover
+
+import (
+	"context"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultFailoverThreshold     = 3
+	defaultFailoverProbeInterval = 60 * time.Second
+)
+
+// Replayer is implemented by the sinks keeping the data for a later
+// delivery, for e.g. the disk spool. The failover writer replays them into
+// the primary sink when it recovers
+type Replayer interface {
+	Replay(sink base.DataWriter) error
+}
+
+// FailoverDataWriter writes to the first sink of an ordered chain, for e.g.
+// primary Kafka cluster, secondary cluster and disk spool. After
+// FailoverThreshold consecutive failures it switches to the next sink and
+// writes the failed data there. While a fallback sink is in use, the primary
+// sink is probed with the data every FailoverProbeInterval, it is switched
+// back to on success.
+// The writes are synchronous regardless of the method called, an async
+// failure would be noticed too late to write the data elsewhere
+type FailoverDataWriter struct {
+	writers       []base.DataWriter
+	names         []string
+	threshold     int
+	probeInterval time.Duration
+	current       int
+	failures      int
+	lastProbe     time.Time
+	replaying     int32
+	lockGuard     sync.Mutex // guards current, failures and lastProbe
+	lifecycle     base.Lifecycle
+}
+
+// NewFailoverDataWriter
+// @names: names of the writers used in the logs
+// @writers: the chain, primary first
+// @config: FailoverThreshold, 3 by default. FailoverProbeInterval in
+// seconds, 60 by default
+func NewFailoverDataWriter(names []string, writers []base.DataWriter, config base.BaseConfig) *FailoverDataWriter {
+	if len(writers) == 0 || len(names) != len(writers) {
+		glog.Errorf("One name per writer and at least one writer are required to create FailoverDataWriter")
+		return nil
+	}
+
+	threshold := defaultFailoverThreshold
+	if config[base.FailoverThreshold] != "" {
+		n, err := strconv.Atoi(config[base.FailoverThreshold])
+		if err != nil || n <= 0 {
+			glog.Errorf("Invalid %s=%s, expect a positive integer", base.FailoverThreshold, config[base.FailoverThreshold])
+			return nil
+		}
+		threshold = n
+	}
+
+	probeInterval := defaultFailoverProbeInterval
+	if config[base.FailoverProbeInterval] != "" {
+		n, err := strconv.Atoi(config[base.FailoverProbeInterval])
+		if err != nil || n <= 0 {
+			glog.Errorf("Invalid %s=%s, expect a positive integer", base.FailoverProbeInterval, config[base.FailoverProbeInterval])
+			return nil
+		}
+		probeInterval = time.Duration(n) * time.Second
+	}
+
+	return &FailoverDataWriter{
+		writers:       writers,
+		names:         names,
+		threshold:     threshold,
+		probeInterval: probeInterval,
+	}
+}
+
+func (writer *FailoverDataWriter) Start() {
+	if writer.lifecycle.Start("FailoverDataWriter") != nil {
+		return
+	}
+
+	for _, w := range writer.writers {
+		w.Start()
+	}
+	glog.Infof("FailoverDataWriter started...")
+}
+
+func (writer *FailoverDataWriter) Stop() {
+	if writer.lifecycle.Stop("FailoverDataWriter") != nil {
+		return
+	}
+
+	for _, w := range writer.writers {
+		w.Stop()
+	}
+	glog.Infof("FailoverDataWriter stopped...")
+}
+
+func (writer *FailoverDataWriter) Status() string {
+	return writer.lifecycle.Status()
+}
+
+func (writer *FailoverDataWriter) WriteData(data *base.Data) error {
+	return writer.doWriteData(context.Background(), data)
+}
+
+func (writer *FailoverDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.doWriteData(context.Background(), data)
+}
+
+func (writer *FailoverDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.doWriteData(context.Background(), data)
+}
+
+func (writer *FailoverDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.doWriteData(ctx, data)
+}
+
+// Current returns the name of the sink in use
+func (writer *FailoverDataWriter) Current() string {
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+	return writer.names[writer.current]
+}
+
+func (writer *FailoverDataWriter) doWriteData(ctx context.Context, data *base.Data) error {
+	writer.lockGuard.Lock()
+	defer writer.lockGuard.Unlock()
+
+	if writer.current > 0 && time.Since(writer.lastProbe) >= writer.probeInterval {
+		writer.lastProbe = time.Now()
+		if err := writer.writers[0].WriteDataContext(ctx, data); err == nil {
+			glog.Infof("Sink=%s recovered, switch back from sink=%s", writer.names[0], writer.names[writer.current])
+			writer.switchBack()
+			return nil
+		}
+		glog.Warningf("Sink=%s is still failing, stay on sink=%s", writer.names[0], writer.names[writer.current])
+	}
+
+	for {
+		err := writer.writers[writer.current].WriteDataContext(ctx, data)
+		if err == nil {
+			writer.failures = 0
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		writer.failures++
+		if writer.failures < writer.threshold || writer.current == len(writer.writers)-1 {
+			return err
+		}
+
+		glog.Errorf("Sink=%s failed %d times in a row, fail over to sink=%s, error=%s",
+			writer.names[writer.current], writer.failures, writer.names[writer.current+1], err)
+		writer.current++
+		writer.failures = 0
+		writer.lastProbe = time.Now()
+	}
+}
+
+// switchBack shall be called with lockGuard held. The fallbacks which keep
+// the data are replayed into the primary sink in the background
+func (writer *FailoverDataWriter) switchBack() {
+	writer.current = 0
+	writer.failures = 0
+
+	if !atomic.CompareAndSwapInt32(&writer.replaying, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&writer.replaying, 0)
+		for i := 1; i < len(writer.writers); i++ {
+			replayer, ok := writer.writers[i].(Replayer)
+			if !ok {
+				continue
+			}
+
+			if err := replayer.Replay(writer.writers[0]); err != nil {
+				glog.Errorf("Failed to replay sink=%s into sink=%s, error=%s", writer.names[i], writer.names[0], err)
+				continue
+			}
+			glog.Infof("Replayed sink=%s into sink=%s", writer.names[i], writer.names[0])
+		}
+	}()
+}
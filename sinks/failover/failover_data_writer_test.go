@@ -0,0 +1,124 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"github.com/chenziliang/descartes/base"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeDataWriter struct {
+	failing  bool
+	written  int
+	replayed chan struct{}
+	mutex    sync.Mutex
+}
+
+func (writer *fakeDataWriter) Start() {
+}
+
+func (writer *fakeDataWriter) Stop() {
+}
+
+func (writer *fakeDataWriter) WriteData(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *fakeDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *fakeDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *fakeDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.failing {
+		return errors.New("sink is down")
+	}
+	writer.written++
+	return nil
+}
+
+func (writer *fakeDataWriter) setFailing(failing bool) {
+	writer.mutex.Lock()
+	writer.failing = failing
+	writer.mutex.Unlock()
+}
+
+func (writer *fakeDataWriter) count() int {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.written
+}
+
+type fakeSpool struct {
+	fakeDataWriter
+}
+
+func (writer *fakeSpool) Replay(sink base.DataWriter) error {
+	for i := 0; i < writer.count(); i++ {
+		sink.WriteDataSync(base.NewData(nil, nil))
+	}
+	close(writer.replayed)
+	return nil
+}
+
+func TestFailoverDataWriter(t *testing.T) {
+	primary := &fakeDataWriter{}
+	secondary := &fakeDataWriter{}
+	spool := &fakeSpool{fakeDataWriter{replayed: make(chan struct{})}}
+
+	config := base.BaseConfig{
+		base.FailoverThreshold:     "2",
+		base.FailoverProbeInterval: "1",
+	}
+	writer := NewFailoverDataWriter([]string{"primary", "secondary", "spool"}, []base.DataWriter{primary, secondary, spool}, config)
+	if writer == nil {
+		t.Fatalf("Failed to create FailoverDataWriter")
+	}
+	writer.Start()
+	defer writer.Stop()
+
+	data := base.NewData(nil, [][]byte{[]byte("a=b")})
+	primary.setFailing(true)
+	if err := writer.WriteData(data); err == nil {
+		t.Errorf("Expect the error of primary below the threshold")
+	}
+
+	// The second failure reaches the threshold, the data goes to secondary
+	if err := writer.WriteData(data); err != nil || writer.Current() != "secondary" || secondary.count() != 1 {
+		t.Errorf("Expect failover to secondary, got error=%v, current=%s, written=%d", err, writer.Current(), secondary.count())
+	}
+
+	secondary.setFailing(true)
+	writer.WriteData(data)
+	if err := writer.WriteData(data); err != nil || writer.Current() != "spool" || spool.count() != 1 {
+		t.Errorf("Expect failover to spool, got error=%v, current=%s, written=%d", err, writer.Current(), spool.count())
+	}
+
+	if err := writer.WriteData(data); err != nil || spool.count() != 2 {
+		t.Errorf("Expect spool used before the probe, got error=%v, written=%d", err, spool.count())
+	}
+
+	primary.setFailing(false)
+	time.Sleep(1100 * time.Millisecond)
+	if err := writer.WriteData(data); err != nil || writer.Current() != "primary" || primary.count() != 1 {
+		t.Errorf("Expect switching back to primary, got error=%v, current=%s, written=%d", err, writer.Current(), primary.count())
+	}
+
+	select {
+	case <-spool.replayed:
+	case <-time.After(time.Second):
+		t.Fatalf("Expect spool replayed into primary")
+	}
+
+	if primary.count() != 3 {
+		t.Errorf("Expect 2 spooled data replayed into primary, got %d written", primary.count())
+	}
+}
@@ -1,11 +1,11 @@
 package kafka
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"github.com/Shopify/sarama"
 	"github.com/chenziliang/descartes/base"
 	"github.com/golang/glog"
-	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -14,19 +14,26 @@ type KafkaDataWriter struct {
 	brokerConfig  base.BaseConfig
 	asyncProducer sarama.AsyncProducer
 	syncProducer  sarama.SyncProducer
-	state         int32
+	codec         base.Codec
+	retryDelays   []base.RetryDelay
+	inflight      int64 // messages handed to asyncProducer but not acked yet
+	buffer        *base.BufferTracker
+	lifecycle     base.Lifecycle
 }
 
-const (
-	stopped        = 0
-	initialStarted = 1
-	started        = 2
-)
-
 // NewKafaDataWriter
 // @BaseConfig: contains
 // base.KafkaTopic, base.Key which indicates where to write the data to Kafka
 // base.RequireAcks, base.FlushMemory, base.SyncWrite Kafka producer options
+// base.Compression, base.CompressionLevel, base.CompressionDict which
+// compress the message values, the readers of the topic shall use the same
+// base.KafkaRetryDelays, for e.g. "5m,1h", writes the messages failed to be
+// written asynchronously to the retry topics "<topic>.retry.5m" and then
+// "<topic>.retry.1h", see services.RetryService for the redelivery
+// base.KafkaKeyField, for e.g. "sys_id", writes each record in its own
+// message keyed by the field instead of base.Key, so that the compacted
+// topics keep the latest version of each record. The records without the
+// field are keyed by base.Key
 
 func NewKafkaDataWriter(brokerConfig base.BaseConfig) base.DataWriter {
 	for _, k := range []string{base.KafkaTopic, base.KafkaBrokers} {
@@ -40,17 +47,36 @@ func NewKafkaDataWriter(brokerConfig base.BaseConfig) base.DataWriter {
 		brokerConfig[base.Key] = brokerConfig[base.KafkaTopic]
 	}
 
-	config := sarama.NewConfig()
+	codec, err := base.NewCodec(brokerConfig)
+	if err != nil {
+		glog.Errorf("Failed to create compression codec, error=%s", err)
+		return nil
+	}
+
+	retryDelays, err := base.ParseRetryDelays(brokerConfig[base.KafkaRetryDelays])
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", base.KafkaRetryDelays, err)
+		return nil
+	}
+
+	config, err := base.NewKafkaConfig(brokerConfig, "")
+	if err != nil {
+		glog.Errorf("Invalid Kafka configs, error=%s", err)
+		return nil
+	}
+
 	config.Producer.RequiredAcks = sarama.WaitForLocal
 	config.Producer.Flush.Frequency = 500 * time.Millisecond
-	brokers := strings.Split(brokerConfig[base.KafkaBrokers], ";")
+	// The successes are drained to track the in-flight messages
+	config.Producer.Return.Successes = true
+	brokers := base.KafkaBrokerList(brokerConfig[base.KafkaBrokers])
 	asyncProducer, err := sarama.NewAsyncProducer(brokers, config)
 	if err != nil {
 		glog.Errorf("Failed to create Kafka async producer, error=%s", err)
 		return nil
 	}
 
-	syncConfig := sarama.NewConfig()
+	syncConfig, _ := base.NewKafkaConfig(brokerConfig, "")
 	syncProducer, err := sarama.NewSyncProducer(brokers, syncConfig)
 	if err != nil {
 		glog.Errorf("Failed to create Kafka sync producer, error=%s", err)
@@ -61,27 +87,42 @@ func NewKafkaDataWriter(brokerConfig base.BaseConfig) base.DataWriter {
 		brokerConfig:  brokerConfig,
 		asyncProducer: asyncProducer,
 		syncProducer:  syncProducer,
-		state:         initialStarted,
+		codec:         codec,
+		retryDelays:   retryDelays,
+		buffer:        base.NewBufferTracker(0),
 	}
 }
 
 func (writer *KafkaDataWriter) Start() {
-	if !atomic.CompareAndSwapInt32(&writer.state, initialStarted, started) {
-		glog.Infof("KafkaDataWriter already started or stopped")
+	if writer.lifecycle.Start("KafkaDataWriter") != nil {
 		return
 	}
 
 	go func() {
 		for err := range writer.asyncProducer.Errors() {
+			atomic.AddInt64(&writer.inflight, -1)
+			writer.buffer.Released()
+			writer.release(err.Msg)
 			glog.Errorf("Kafka AsyncProducer encounter error=%s", err)
+			if !writer.retry(err.Msg) {
+				writer.buffer.Dropped()
+			}
+		}
+	}()
+
+	go func() {
+		for msg := range writer.asyncProducer.Successes() {
+			atomic.AddInt64(&writer.inflight, -1)
+			writer.buffer.Released()
+			writer.release(msg)
 		}
 	}()
 	glog.Infof("KafkaDataWriter started...")
 }
 
 func (writer *KafkaDataWriter) Stop() {
-	if !atomic.CompareAndSwapInt32(&writer.state, started, stopped) {
-		glog.Infof("KafkaDataWriter already stopped")
+	// The producers are created with the writer, close them even if it is not started
+	if writer.lifecycle.Stop("KafkaDataWriter") == base.ErrAlreadyStopped {
 		return
 	}
 
@@ -90,6 +131,10 @@ func (writer *KafkaDataWriter) Stop() {
 	glog.Infof("KafkaDataWriter stopped...")
 }
 
+func (writer *KafkaDataWriter) Status() string {
+	return writer.lifecycle.Status()
+}
+
 func (writer *KafkaDataWriter) WriteData(data *base.Data) error {
 	if writer.brokerConfig[base.SyncWrite] == "0" {
 		return writer.WriteDataSync(data)
@@ -98,44 +143,240 @@ func (writer *KafkaDataWriter) WriteData(data *base.Data) error {
 	}
 }
 
-func (writer *KafkaDataWriter) prepareData(data *base.Data) (*sarama.ProducerMessage, error) {
-	payload, err := json.Marshal(data)
+// retry writes msg to the retry topic of the next stage synchronously, the
+// message is dropped if all of the stages have been tried. It returns false
+// if the message is dropped
+func (writer *KafkaDataWriter) retry(msg *sarama.ProducerMessage) bool {
+	if len(writer.retryDelays) == 0 || msg == nil {
+		return false
+	}
+
+	errMsg := fmt.Sprintf("Failed to retry message of topic=%s, key=%s", msg.Topic, msg.Key)
+	value, err := msg.Value.Encode()
+	if err == nil {
+		value, err = writer.codec.Decode(value)
+	}
+
+	var data *base.Data
+	if err == nil {
+		data, err = base.DecodeEnvelope(value)
+	}
+
+	if err != nil {
+		glog.Errorf("%s, error=%s", errMsg, err)
+		return false
+	}
+
+	data, topic := base.NewRetryData(data, msg.Topic, writer.retryDelays, time.Now())
+	if data == nil {
+		glog.Errorf("%s, all of the retry topics have been tried, drop it", errMsg)
+		return false
+	}
+
+	// The message keeps its key in the retry topics
+	key := writer.brokerConfig[base.Key]
+	if msg.Key != nil {
+		if k, err := msg.Key.Encode(); err == nil {
+			key = string(k)
+		}
+	}
+
+	retryMsg, err := writer.prepareData(data, key)
+	if err != nil {
+		return false
+	}
+	retryMsg.Topic = topic
+
+	_, _, err = writer.syncProducer.SendMessage(retryMsg)
+	if err != nil {
+		glog.Errorf("%s to topic=%s, error=%s", errMsg, topic, err)
+		return false
+	}
+	glog.Warningf("Wrote message of topic=%s, key=%s to retry topic=%s", msg.Topic, msg.Key, topic)
+	return true
+}
+
+func (writer *KafkaDataWriter) prepareData(data *base.Data, key string) (*sarama.ProducerMessage, error) {
+	payload, err := base.EncodeEnvelope(data)
 	if err != nil {
 		glog.Errorf("Failed to marshal base.Data object, error=%s", err)
 		return nil, err
 	}
 
+	payload, err = writer.codec.Encode(payload)
+	if err != nil {
+		glog.Errorf("Failed to compress base.Data object with codec=%s, error=%s", writer.codec.Name(), err)
+		return nil, err
+	}
+
 	msg := &sarama.ProducerMessage{
 		Topic: writer.brokerConfig[base.KafkaTopic],
-		Key:   sarama.StringEncoder(writer.brokerConfig[base.Key]),
+		Key:   sarama.StringEncoder(key),
 		Value: sarama.StringEncoder(payload),
 	}
 	return msg, err
 }
 
+// prepareMessages returns data in one message keyed by base.Key, or one
+// message per record keyed by its base.KafkaKeyField
+func (writer *KafkaDataWriter) prepareMessages(data *base.Data) ([]*sarama.ProducerMessage, error) {
+	field := writer.brokerConfig[base.KafkaKeyField]
+	if field == "" {
+		msg, err := writer.prepareData(data, writer.brokerConfig[base.Key])
+		if err != nil {
+			return nil, err
+		}
+		return []*sarama.ProducerMessage{msg}, nil
+	}
+
+	records, err := data.ParseRecords()
+	if err != nil {
+		glog.Errorf("Failed to parse the records to key them by %s, error=%s", field, err)
+		return nil, err
+	}
+
+	if err := data.Serialize(); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(data.RawData))
+	for i, rawData := range data.RawData {
+		key := writer.brokerConfig[base.Key]
+		if i < len(records) {
+			if id, ok := records[i][field]; ok && id != nil && fmt.Sprint(id) != "" {
+				key = fmt.Sprint(id)
+			}
+		}
+
+		msg, err := writer.prepareData(base.NewData(data.MetaInfo, [][]byte{rawData}), key)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
 func (writer *KafkaDataWriter) WriteDataAsync(data *base.Data) error {
-	msg, err := writer.prepareData(data)
+	msgs, err := writer.prepareMessages(data)
 	if err != nil {
 		return err
 	}
 
-	if atomic.LoadInt32(&writer.state) != stopped {
+	for _, msg := range msgs {
+		if writer.lifecycle.Stopped() {
+			break
+		}
+
+		atomic.AddInt64(&writer.inflight, 1)
+		writer.buffer.Buffered()
+		writer.hold(msg)
 		writer.asyncProducer.Input() <- msg
 	}
 	return nil
 }
 
-func (writer *KafkaDataWriter) WriteDataSync(data *base.Data) error {
-	msg, err := writer.prepareData(data)
+// hold accounts the message written asynchronously in the inflight bytes
+// until it is acked or failed, see release
+func (writer *KafkaDataWriter) hold(msg *sarama.ProducerMessage) {
+	n := int64(msg.Value.Length())
+	msg.Metadata = n
+	base.AddInflightBytes(writer.brokerConfig[base.TaskConfigKey], n)
+}
+
+func (writer *KafkaDataWriter) release(msg *sarama.ProducerMessage) {
+	if msg == nil {
+		return
+	}
+
+	if n, ok := msg.Metadata.(int64); ok {
+		base.AddInflightBytes(writer.brokerConfig[base.TaskConfigKey], -n)
+	}
+}
+
+// WriteDataContext honors base.SyncWrite like WriteData but gives up when
+// ctx is done. A sync write which has been given up may still succeed later
+func (writer *KafkaDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	msgs, err := writer.prepareMessages(data)
 	if err != nil {
 		return err
 	}
 
-	_, _, err = writer.syncProducer.SendMessage(msg)
-	// FIXME retry other brokers when failed ?
+	for _, msg := range msgs {
+		if err := writer.writeMessageContext(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *KafkaDataWriter) writeMessageContext(ctx context.Context, msg *sarama.ProducerMessage) error {
+	if writer.brokerConfig[base.SyncWrite] != "0" {
+		if writer.lifecycle.Stopped() {
+			return nil
+		}
+
+		atomic.AddInt64(&writer.inflight, 1)
+		writer.buffer.Buffered()
+		writer.hold(msg)
+		select {
+		case writer.asyncProducer.Input() <- msg:
+			return nil
+		case <-ctx.Done():
+			atomic.AddInt64(&writer.inflight, -1)
+			writer.buffer.Unbuffered()
+			writer.release(msg)
+			glog.Errorf("Timed out writing data to kafka for topic=%s, key=%s, error=%s", msg.Topic, msg.Key, ctx.Err())
+			return ctx.Err()
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := writer.syncProducer.SendMessage(msg)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			glog.Errorf("Failed to write data to kafka for topic=%s, partition=%d, key=%s, error=%s",
+				msg.Topic, msg.Partition, msg.Key, err)
+		}
+		return err
+	case <-ctx.Done():
+		glog.Errorf("Timed out writing data to kafka for topic=%s, key=%s, error=%s", msg.Topic, msg.Key, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of messages written asynchronously which
+// have not been acked or failed yet
+func (writer *KafkaDataWriter) QueueDepth() int {
+	return int(atomic.LoadInt64(&writer.inflight))
+}
+
+// SinkStats returns the buffering of the messages written asynchronously,
+// the messages failed to be written which are not written to a retry topic
+// are dropped
+func (writer *KafkaDataWriter) SinkStats() base.SinkStats {
+	return writer.buffer.Stats(time.Now())
+}
+
+func (writer *KafkaDataWriter) WriteDataSync(data *base.Data) error {
+	msgs, err := writer.prepareMessages(data)
 	if err != nil {
-		glog.Errorf("Failed to write data to kafka for topic=%s, partition=%d, key=%s, error=%s",
-			msg.Topic, msg.Partition, msg.Key, err)
+		return err
+	}
+
+	for _, msg := range msgs {
+		_, _, err = writer.syncProducer.SendMessage(msg)
+		// FIXME retry other brokers when failed ?
+		if err != nil {
+			glog.Errorf("Failed to write data to kafka for topic=%s, partition=%d, key=%s, error=%s",
+				msg.Topic, msg.Partition, msg.Key, err)
+			return err
+		}
 	}
-	return err
+	return nil
 }
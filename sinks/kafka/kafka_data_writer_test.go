@@ -39,3 +39,44 @@ func TestKafkaDataWriter(t *testing.T) {
 	}
 	time.Sleep(time.Second)
 }
+
+func TestKafkaDataWriterKeyField(t *testing.T) {
+	config := base.BaseConfig{
+		base.KafkaTopic:    "snow",
+		base.Key:           "/snow/incident",
+		base.KafkaKeyField: "sys_id",
+	}
+	codec, _ := base.NewCodec(config)
+	writer := &KafkaDataWriter{brokerConfig: config, codec: codec}
+
+	rawData := [][]byte{[]byte(`{"sys_id":"a1","state":"1"}`), []byte(`{"state":"2"}`), []byte(`{"sys_id":"b2","state":"3"}`)}
+	msgs, err := writer.prepareMessages(base.NewData(map[string]string{base.Metric: "incident"}, rawData))
+	if err != nil {
+		t.Errorf("Failed to prepare messages, error=%s", err)
+		return
+	}
+
+	expected := []string{"a1", "/snow/incident", "b2"}
+	if len(msgs) != len(expected) {
+		t.Errorf("Expect one message per record, got=%d", len(msgs))
+		return
+	}
+
+	for i, msg := range msgs {
+		key, _ := msg.Key.Encode()
+		if string(key) != expected[i] {
+			t.Errorf("Expect key=%s, got=%s", expected[i], key)
+		}
+
+		value, _ := msg.Value.Encode()
+		data, err := base.DecodeEnvelope(value)
+		if err != nil || len(data.RawData) != 1 || string(data.RawData[0]) != string(rawData[i]) {
+			t.Errorf("Expect message of record=%s, got=%s", rawData[i], value)
+		}
+	}
+
+	delete(config, base.KafkaKeyField)
+	if msgs, _ := writer.prepareMessages(base.NewData(nil, rawData)); len(msgs) != 1 {
+		t.Errorf("Expect the data in one message, got=%d", len(msgs))
+	}
+}
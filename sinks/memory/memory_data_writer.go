@@ -1,16 +1,31 @@
 package memory
 
 import (
+	"context"
 	"github.com/chenziliang/descartes/base"
+	"sync/atomic"
 )
 
+const (
+	defaultCapacity = 16
+)
+
+// MemoryDataWriter hands the data over to the consumer of Data through a
+// bounded channel. The writes block while the channel is full, those which
+// found it full are counted as overflows
 type MemoryDataWriter struct {
-	dataChan chan *base.Data
+	dataChan  chan *base.Data
+	overflows int64
 }
 
 func NewMemoryDataWriter() *MemoryDataWriter {
+	return NewMemoryDataWriterSize(defaultCapacity)
+}
+
+// NewMemoryDataWriterSize returns the writer buffering capacity data
+func NewMemoryDataWriterSize(capacity int) *MemoryDataWriter {
 	return &MemoryDataWriter{
-		dataChan: make(chan *base.Data, 16),
+		dataChan: make(chan *base.Data, capacity),
 	}
 }
 
@@ -32,11 +47,31 @@ func (writer *MemoryDataWriter) WriteDataAsync(data *base.Data) error {
 	return writer.doWriteData(data)
 }
 
+func (writer *MemoryDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	select {
+	case writer.dataChan <- data:
+		return nil
+	default:
+		atomic.AddInt64(&writer.overflows, 1)
+	}
+
+	select {
+	case writer.dataChan <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (writer *MemoryDataWriter) doWriteData(data *base.Data) error {
-	writer.dataChan <- data
-	return nil
+	return writer.WriteDataContext(context.Background(), data)
 }
 
 func (writer *MemoryDataWriter) Data() <-chan *base.Data {
 	return writer.dataChan
 }
+
+// Overflows returns the number of writes which found the channel full
+func (writer *MemoryDataWriter) Overflows() int64 {
+	return atomic.LoadInt64(&writer.overflows)
+}
@@ -0,0 +1,372 @@
+package multi
+
+import (
+	"context"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxRetry  = 16
+	queueSize = 1000
+)
+
+type sequencedData struct {
+	seq  int64
+	data *base.Data
+}
+
+type sink struct {
+	name    string
+	writer  base.DataWriter
+	dataQ   chan *sequencedData
+	failed  int32
+	acked   int64 // seq of the last data written
+	latency int64 // moving average of the write latency in nano seconds
+}
+
+// observe records the latency of a write in the moving average
+func (s *sink) observe(latency time.Duration) {
+	avg := atomic.LoadInt64(&s.latency)
+	if avg == 0 {
+		avg = int64(latency)
+	} else {
+		avg += (int64(latency) - avg) / 8
+	}
+	atomic.StoreInt64(&s.latency, avg)
+}
+
+// MultiDataWriter fans out data to several sinks. Each sink writes in
+// order in its own goroutine and acknowledges its high-water mark to a
+// CheckpointCoordinator, so the checkpoint returned by Checkpointer only
+// advances after a quorum of sinks have written the data. A sink which still
+// fails after retries stops acknowledging until the writer is restarted, and
+// is excluded from the quorum.
+// The sinks write in parallel, WriteDataContext returns once the data is
+// queued, or with SetAckTimeout once a quorum of sinks have written it, so a
+// slow sink, for e.g. an archive, doesn't add its latency to the others.
+// When WriteDataContext times out partway through the fan-out, the data stays
+// queued on the sinks it has reached and is written by them. The checkpoint
+// is not advanced for it, so the re-collected data is duplicated on those sinks
+type MultiDataWriter struct {
+	sinks       []*sink
+	coordinator *base.CheckpointCoordinator
+	quorum      int
+	seq         int64
+	wg          sync.WaitGroup
+	lifecycle   base.Lifecycle
+	lockGuard   sync.RWMutex // guards queuing against closing the queues
+	ackTimeout  time.Duration
+	acks        chan struct{} // closed and renewed when a sink writes
+	acksMutex   sync.Mutex
+}
+
+// NewMultiDataWriter
+// @writers: sink name indexed writers
+// @quorum: number of sinks which shall acknowledge before the checkpoint is
+// advanced, all sinks if it is not positive
+func NewMultiDataWriter(writers map[string]base.DataWriter, quorum int) *MultiDataWriter {
+	if len(writers) == 0 {
+		glog.Errorf("At least one sink is required to create MultiDataWriter")
+		return nil
+	}
+
+	var sinks []*sink
+	for name, writer := range writers {
+		sinks = append(sinks, &sink{
+			name:   name,
+			writer: writer,
+			dataQ:  make(chan *sequencedData, queueSize),
+		})
+	}
+
+	return &MultiDataWriter{
+		sinks:  sinks,
+		quorum: quorum,
+		acks:   make(chan struct{}),
+	}
+}
+
+// SetAckTimeout makes WriteDataContext wait up to timeout for a quorum of
+// the sinks to write the data. The data not written by then stays queued
+// and is not checkpointed until it is. It shall be called before Start
+func (writer *MultiDataWriter) SetAckTimeout(timeout time.Duration) {
+	writer.ackTimeout = timeout
+}
+
+// Checkpointer wraps checkpoint so that WriteCheckpoint only takes effect
+// when a quorum of sinks have written the data before it. It shall be called
+// once before Start
+func (writer *MultiDataWriter) Checkpointer(checkpoint base.Checkpointer) base.Checkpointer {
+	var names []string
+	for _, s := range writer.sinks {
+		names = append(names, s.name)
+	}
+
+	writer.coordinator = base.NewCheckpointCoordinator(checkpoint, names, writer.quorum)
+	return &coordinatedCheckpointer{
+		Checkpointer: checkpoint,
+		writer:       writer,
+	}
+}
+
+// QueueDepth returns the number of data queued for the most lagging sink,
+// including what the sink itself queues
+func (writer *MultiDataWriter) QueueDepth() int {
+	depth := 0
+	for _, s := range writer.sinks {
+		n := len(s.dataQ)
+		if d := base.QueueDepth(s.writer); d > 0 {
+			n += d
+		}
+		if n > depth {
+			depth = n
+		}
+	}
+	return depth
+}
+
+// SinkStats returns the buffering of the most saturated sink which tracks its
+// buffer, with the data dropped by all of them
+func (writer *MultiDataWriter) SinkStats() base.SinkStats {
+	var res base.SinkStats
+	for _, s := range writer.sinks {
+		stats, ok := base.SinkStatsOf(s.writer)
+		if !ok {
+			continue
+		}
+
+		dropped := res.Dropped + stats.Dropped
+		if stats.Saturated() != res.Saturated() {
+			if stats.Saturated() {
+				res = stats
+			}
+		} else if stats.OldestAge > res.OldestAge {
+			res = stats
+		}
+		res.Dropped = dropped
+	}
+	return res
+}
+
+// SinkLatencies returns the moving average of the write latency of the sinks
+// by name, the sinks which haven't written are not included
+func (writer *MultiDataWriter) SinkLatencies() map[string]time.Duration {
+	latencies := make(map[string]time.Duration, len(writer.sinks))
+	for _, s := range writer.sinks {
+		if latency := atomic.LoadInt64(&s.latency); latency > 0 {
+			latencies[s.name] = time.Duration(latency)
+		}
+	}
+	return latencies
+}
+
+// FailedSinks returns the names of the sinks which stopped acknowledging
+func (writer *MultiDataWriter) FailedSinks() []string {
+	var names []string
+	for _, s := range writer.sinks {
+		if atomic.LoadInt32(&s.failed) != 0 {
+			names = append(names, s.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (writer *MultiDataWriter) Start() {
+	if writer.lifecycle.Start("MultiDataWriter") != nil {
+		return
+	}
+
+	for _, s := range writer.sinks {
+		s.writer.Start()
+		writer.wg.Add(1)
+		go writer.doWrite(s)
+	}
+	glog.Infof("MultiDataWriter started...")
+}
+
+func (writer *MultiDataWriter) Stop() {
+	writer.lockGuard.Lock()
+	if writer.lifecycle.Stop("MultiDataWriter") != nil {
+		writer.lockGuard.Unlock()
+		return
+	}
+
+	for _, s := range writer.sinks {
+		close(s.dataQ)
+	}
+	writer.lockGuard.Unlock()
+	writer.wg.Wait()
+
+	for _, s := range writer.sinks {
+		s.writer.Stop()
+	}
+	glog.Infof("MultiDataWriter stopped...")
+}
+
+func (writer *MultiDataWriter) Status() string {
+	return writer.lifecycle.Status()
+}
+
+func (writer *MultiDataWriter) WriteData(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *MultiDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *MultiDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+// WriteDataContext queues data to all of the sinks, see SetAckTimeout
+func (writer *MultiDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	// Serialize once before fanning out, the sinks write concurrently
+	if err := data.Serialize(); err != nil {
+		glog.Errorf("Failed to serialize records, error=%s", err)
+		return err
+	}
+
+	seq, err := writer.queue(ctx, data)
+	if err != nil || seq == 0 {
+		return err
+	}
+
+	// Not holding lockGuard, Stop doesn't wait for the acks
+	if writer.ackTimeout > 0 {
+		writer.waitForAcks(ctx, seq)
+	}
+	return nil
+}
+
+// queue returns the seq of data queued to the sinks, 0 if the writer is
+// stopped
+func (writer *MultiDataWriter) queue(ctx context.Context, data *base.Data) (int64, error) {
+	writer.lockGuard.RLock()
+	defer writer.lockGuard.RUnlock()
+
+	if writer.lifecycle.Stopped() {
+		return 0, nil
+	}
+
+	d := &sequencedData{
+		seq:  atomic.AddInt64(&writer.seq, 1),
+		data: data,
+	}
+
+	for _, s := range writer.sinks {
+		if atomic.LoadInt32(&s.failed) != 0 {
+			continue
+		}
+
+		select {
+		case s.dataQ <- d:
+		case <-ctx.Done():
+			glog.Errorf("Timed out queuing data to sink=%s, error=%s", s.name, ctx.Err())
+			return 0, ctx.Err()
+		}
+	}
+	return d.seq, nil
+}
+
+// waitForAcks waits until a quorum of the sinks which haven't failed have
+// written the data of seq, ackTimeout or ctx done at most
+func (writer *MultiDataWriter) waitForAcks(ctx context.Context, seq int64) {
+	timer := time.NewTimer(writer.ackTimeout)
+	defer timer.Stop()
+
+	for {
+		writer.acksMutex.Lock()
+		acks := writer.acks
+		writer.acksMutex.Unlock()
+
+		healthy, acked := 0, 0
+		for _, s := range writer.sinks {
+			if atomic.LoadInt32(&s.failed) != 0 {
+				continue
+			}
+			healthy++
+			if atomic.LoadInt64(&s.acked) >= seq {
+				acked++
+			}
+		}
+
+		quorum := writer.quorum
+		if quorum <= 0 || quorum > healthy {
+			quorum = healthy
+		}
+		if acked >= quorum {
+			return
+		}
+
+		select {
+		case <-acks:
+		case <-timer.C:
+			glog.Warningf("Quorum of sinks didn't write seq=%d in %s, %d of %d did", seq, writer.ackTimeout, acked, quorum)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notifyAcks wakes up the writes waiting for the sinks
+func (writer *MultiDataWriter) notifyAcks() {
+	writer.acksMutex.Lock()
+	close(writer.acks)
+	writer.acks = make(chan struct{})
+	writer.acksMutex.Unlock()
+}
+
+func (writer *MultiDataWriter) doWrite(s *sink) {
+	defer writer.wg.Done()
+
+	for d := range s.dataQ {
+		if atomic.LoadInt32(&s.failed) != 0 {
+			continue
+		}
+
+		var err error
+		for i := 0; i < maxRetry; i++ {
+			start := time.Now()
+			err = s.writer.WriteDataSync(d.data)
+			if err == nil {
+				s.observe(time.Since(start))
+				break
+			}
+			glog.Errorf("Failed to write data to sink=%s, seq=%d, error=%s", s.name, d.seq, err)
+			time.Sleep(time.Second)
+		}
+
+		if err != nil {
+			glog.Errorf("Sink=%s keeps failing, stop acknowledging at seq=%d", s.name, d.seq)
+			atomic.StoreInt32(&s.failed, 1)
+			if writer.coordinator != nil {
+				writer.coordinator.Fail(s.name)
+			}
+			writer.notifyAcks()
+			continue
+		}
+
+		atomic.StoreInt64(&s.acked, d.seq)
+		if writer.coordinator != nil {
+			writer.coordinator.Ack(s.name, d.seq)
+		}
+		writer.notifyAcks()
+	}
+}
+
+type coordinatedCheckpointer struct {
+	base.Checkpointer
+	writer *MultiDataWriter
+}
+
+func (ck *coordinatedCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	return ck.writer.coordinator.Propose(keyInfo, value, atomic.LoadInt64(&ck.writer.seq))
+}
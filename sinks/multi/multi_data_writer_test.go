@@ -0,0 +1,67 @@
+package multi
+
+import (
+	"context"
+	"github.com/chenziliang/descartes/base"
+	"testing"
+	"time"
+)
+
+type delayedDataWriter struct {
+	delay time.Duration
+}
+
+func (writer *delayedDataWriter) Start() {
+}
+
+func (writer *delayedDataWriter) Stop() {
+}
+
+func (writer *delayedDataWriter) WriteData(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *delayedDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *delayedDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteDataContext(context.Background(), data)
+}
+
+func (writer *delayedDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	time.Sleep(writer.delay)
+	return nil
+}
+
+func TestMultiDataWriterAcks(t *testing.T) {
+	writer := NewMultiDataWriter(map[string]base.DataWriter{
+		"splunk":  &delayedDataWriter{delay: 10 * time.Millisecond},
+		"archive": &delayedDataWriter{delay: 500 * time.Millisecond},
+	}, 1)
+	writer.SetAckTimeout(5 * time.Second)
+	writer.Start()
+	defer writer.Stop()
+
+	start := time.Now()
+	if err := writer.WriteData(base.NewData(nil, [][]byte{[]byte("r1")})); err != nil {
+		t.Fatalf("Failed to write data, error=%s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond || elapsed >= 500*time.Millisecond {
+		t.Errorf("Expect the write to wait for the fast sink only, took %s", elapsed)
+	}
+
+	if latencies := writer.SinkLatencies(); latencies["splunk"] <= 0 {
+		t.Errorf("Expect the latency of the fast sink, got %v", latencies)
+	}
+
+	// Waiting for both sinks is bounded by the ack timeout
+	writer.quorum = 2
+	writer.SetAckTimeout(100 * time.Millisecond)
+	start = time.Now()
+	writer.WriteData(base.NewData(nil, [][]byte{[]byte("r2")}))
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("Expect the wait bounded by the ack timeout, took %s", elapsed)
+	}
+}
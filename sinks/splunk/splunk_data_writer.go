@@ -1,41 +1,78 @@
 package splunk
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/chenziliang/descartes/base"
 	"github.com/golang/glog"
-	"net/http"
+	"io"
 	"net/url"
 	"strings"
-	"sync/atomic"
 	"time"
 )
 
+const (
+	queueSize = 1000
+)
+
 type SplunkDataWriter struct {
-	splunkdConfig base.BaseConfig
-	sessionKeys   [][]string
-	rest          SplunkRest
-	dataQ         chan *base.Data
-	nextSlot      int
-	started       int32
+	splunkdConfig   base.BaseConfig
+	sessionKeys     [][]string
+	rest            SplunkRest
+	format          base.Format         // nil to index RawData as it is
+	template        *base.EventTemplate // nil to index the records without envelope
+	streamThreshold int                 // 0 to never stream
+	dataQ           base.Queue
+	buffer          *base.BufferTracker
+	nextSlot        int
+	lifecycle       base.Lifecycle
 }
 
+// NewSplunkDataWriter
+// @config: contains base.ServerURL, base.Username, base.Password and the
+// HTTP options of base.NewHTTPClient. base.Serialization optionally converts
+// the records to the format before indexing. base.OutputTemplate optionally
+// wraps each record in an envelope, see base.NewEventTemplate.
+// base.StreamThreshold optionally streams the data of the size in bytes or
+// larger in chunked requests instead of buffering them
 func NewSplunkDataWriter(config base.BaseConfig) base.DataWriter {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	client, err := base.NewHTTPClient(config, 120*time.Second)
+	if err != nil {
+		return nil
+	}
+
+	var format base.Format
+	if config[base.Serialization] != "" {
+		format, err = base.NewFormat(config, "")
+		if err != nil {
+			glog.Errorf("Failed to create the record format of SplunkDataWriter, error=%s", err)
+			return nil
+		}
+	}
+
+	var template *base.EventTemplate
+	if config[base.OutputTemplate] != "" {
+		template, err = base.NewEventTemplate(config[base.OutputTemplate], config)
+		if err != nil {
+			glog.Errorf("Failed to parse the event template of SplunkDataWriter, error=%s", err)
+			return nil
+		}
 	}
-	client := &http.Client{Transport: tr, Timeout: 120 * time.Second}
 
 	writer := &SplunkDataWriter{
-		splunkdConfig: config,
-		sessionKeys:   make([][]string, 0),
-		rest:          SplunkRest{client},
-		dataQ:         make(chan *base.Data, 1000),
+		splunkdConfig:   config,
+		sessionKeys:     make([][]string, 0),
+		rest:            SplunkRest{client},
+		format:          format,
+		template:        template,
+		streamThreshold: base.GetStreamThreshold(config),
+		dataQ:           base.NewMemoryQueue(queueSize),
+		buffer:          base.NewBufferTracker(queueSize),
 	}
 
-	err := writer.login()
+	err = writer.login()
 	if err != nil {
 		return nil
 	}
@@ -43,27 +80,40 @@ func NewSplunkDataWriter(config base.BaseConfig) base.DataWriter {
 }
 
 func (writer *SplunkDataWriter) Start() {
-	if !atomic.CompareAndSwapInt32(&writer.started, 0, 1) {
-		glog.Infof("SplunkDataWriter already started")
+	if writer.lifecycle.Start("SplunkDataWriter") != nil {
 		return
 	}
 
 	go func() {
 		for {
-			data := <-writer.dataQ
-			if data != nil {
-				writer.doWriteData(data)
-			} else {
+			item, err := writer.dataQ.Dequeue(context.Background())
+			if err != nil {
 				break
 			}
+			err = writer.doWriteData(item.Data)
+			writer.dataQ.Ack(item)
+			writer.buffer.Released()
+			if err != nil {
+				writer.buffer.Dropped()
+			}
+			base.AddInflightBytes(writer.splunkdConfig[base.TaskConfigKey], -int64(base.RawDataSize(item.Data)))
 		}
 		glog.Infof("SplunkDataWriter stopped...")
 	}()
 	glog.Infof("SplunkDataWriter started...")
 }
 
+// Stop writes the queued data before the writer stops
 func (writer *SplunkDataWriter) Stop() {
-	writer.dataQ <- nil
+	if writer.lifecycle.Stop("SplunkDataWriter") != nil {
+		return
+	}
+
+	writer.dataQ.Close()
+}
+
+func (writer *SplunkDataWriter) Status() string {
+	return writer.lifecycle.Status()
 }
 
 func (writer *SplunkDataWriter) WriteData(data *base.Data) error {
@@ -75,7 +125,23 @@ func (writer *SplunkDataWriter) WriteData(data *base.Data) error {
 }
 
 func (writer *SplunkDataWriter) WriteDataAsync(data *base.Data) error {
-	writer.dataQ <- data
+	return writer.enqueue(context.Background(), data)
+}
+
+// enqueue accounts the queued data in the inflight bytes until it is written
+func (writer *SplunkDataWriter) enqueue(ctx context.Context, data *base.Data) error {
+	if err := data.Serialize(); err != nil {
+		glog.Errorf("Failed to serialize records, error=%s", err)
+		return err
+	}
+
+	// Tracked before it may be dequeued
+	writer.buffer.Buffered()
+	if err := writer.dataQ.Enqueue(ctx, data); err != nil {
+		writer.buffer.Unbuffered()
+		return err
+	}
+	base.AddInflightBytes(writer.splunkdConfig[base.TaskConfigKey], int64(base.RawDataSize(data)))
 	return nil
 }
 
@@ -83,7 +149,48 @@ func (writer *SplunkDataWriter) WriteDataSync(data *base.Data) error {
 	return writer.doWriteData(data)
 }
 
+// WriteDataContext honors base.SyncWrite like WriteData but gives up when
+// ctx is done. A sync write which has been given up may still succeed later
+func (writer *SplunkDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	if writer.splunkdConfig[base.SyncWrite] != "0" {
+		err := writer.enqueue(ctx, data)
+		if err != nil && ctx.Err() != nil {
+			glog.Errorf("Timed out queuing data to Splunk, error=%s", err)
+		}
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- writer.doWriteData(data)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		glog.Errorf("Timed out writing data to Splunk, error=%s", ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of data waiting to be written
+func (writer *SplunkDataWriter) QueueDepth() int {
+	return writer.dataQ.Len()
+}
+
+// SinkStats returns the buffering of the data queued, the data failed to be
+// written asynchronously are dropped
+func (writer *SplunkDataWriter) SinkStats() base.SinkStats {
+	return writer.buffer.Stats(time.Now())
+}
+
 func (writer *SplunkDataWriter) doWriteData(data *base.Data) error {
+	if err := data.Serialize(); err != nil {
+		glog.Errorf("Failed to serialize records, error=%s", err)
+		return err
+	}
+
 	metaProps := url.Values{}
 	source, sourcetype := SourceAndSourcetype(data.MetaInfo)
 	metaProps.Add("host", data.MetaInfo[base.ServerURL])
@@ -91,28 +198,60 @@ func (writer *SplunkDataWriter) doWriteData(data *base.Data) error {
 	metaProps.Add("source", source)
 	metaProps.Add("sourcetype", sourcetype)
 
-	// FIXME perf issue for bytes concatenation
-	allData := make([]byte, 0, 4096)
-	n := len(data.RawData)
-	for i := 0; i < n; i++ {
-		allData = append(allData, data.RawData[i]...)
-		allData = append(allData, '\n')
+	write := func(w io.Writer) error {
+		return base.WriteLines(w, data.RawData)
+	}
+	if writer.template != nil || writer.format != nil {
+		records := data.RawData
+		if writer.format != nil {
+			var err error
+			records, err = base.EncodeRecords(data, writer.format)
+			if err != nil {
+				glog.Errorf("Failed to encode records in format=%s, error=%s", writer.format.Name(), err)
+				return err
+			}
+		}
+
+		write = func(w io.Writer) error {
+			if writer.template != nil {
+				return writer.template.RenderTo(w, data, records)
+			}
+			return base.WriteRecords(w, writer.format, records)
+		}
 	}
 
+	// The large batches are streamed instead of being framed in memory
+	stream := writer.streamThreshold > 0 && base.RawDataSize(data) >= writer.streamThreshold
+	var allData []byte
+	if !stream {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			// The body would be truncated
+			glog.Errorf("Failed to render records, error=%s", err)
+			return err
+		}
+		allData = buf.Bytes()
+	}
+
+	err := errors.New("No splunkd session to index data to")
 	for range writer.sessionKeys {
 		writer.nextSlot = (writer.nextSlot + 1) % len(writer.sessionKeys)
 		urlSession := writer.sessionKeys[writer.nextSlot]
-		err := writer.rest.IndexData(urlSession[0], urlSession[1], &metaProps, allData)
+		if stream {
+			err = writer.rest.IndexStream(urlSession[0], urlSession[1], &metaProps, write)
+		} else {
+			err = writer.rest.IndexData(urlSession[0], urlSession[1], &metaProps, allData)
+		}
+
 		if err != nil {
 			glog.Errorf("Failed to index data to %s, error=%s", urlSession[0], err)
 			continue
 		}
-		break
+		return nil
 	}
 
 	// FIXME relogin when fail
-
-	return nil
+	return err
 }
 
 func (writer *SplunkDataWriter) login() error {
@@ -2,7 +2,10 @@ package splunk
 
 import (
 	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestSplunkDataWriter(t *testing.T) {
@@ -47,3 +50,46 @@ func TestSplunkDataWriter(t *testing.T) {
 
 	writer.Stop()
 }
+
+func TestSplunkDataWriterFailure(t *testing.T) {
+	indexed := 0
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		indexed++
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	writer := &SplunkDataWriter{
+		splunkdConfig: base.BaseConfig{},
+		sessionKeys:   [][]string{{down.URL, "key"}},
+		rest:          SplunkRest{&http.Client{}},
+		dataQ:         base.NewMemoryQueue(queueSize),
+		buffer:        base.NewBufferTracker(queueSize),
+	}
+	data := base.NewData(map[string]string{base.ServerURL: "https://acme.service-now.com"}, [][]byte{[]byte("a=b")})
+
+	// The data is dropped when every splunkd fails
+	if err := writer.WriteDataSync(data); err == nil {
+		t.Errorf("Expect the write failed when every splunkd is down")
+	}
+
+	writer.Start()
+	if err := writer.WriteDataAsync(data); err != nil {
+		t.Fatalf("Failed to queue data, error=%s", err)
+	}
+	writer.Stop()
+	for i := 0; i < 100 && writer.SinkStats().Dropped == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if writer.SinkStats().Dropped != 1 {
+		t.Errorf("Expect the async data failed to be written dropped, got %+v", writer.SinkStats())
+	}
+
+	// Or written by the next one
+	writer.sessionKeys = append(writer.sessionKeys, []string{up.URL, "key"})
+	writer.nextSlot = len(writer.sessionKeys) - 1
+	if err := writer.WriteDataSync(data); err != nil || indexed != 1 {
+		t.Errorf("Expect the data indexed to the splunkd up, got %d, error=%v", indexed, err)
+	}
+}
@@ -3,6 +3,7 @@ package splunk
 import (
 	"bytes"
 	"encoding/xml"
+	"github.com/chenziliang/descartes/base"
 	"github.com/golang/glog"
 	"io"
 	"io/ioutil"
@@ -24,6 +25,34 @@ func (rest SplunkRest) IndexData(splunkdURI string, sessionKey string,
 	return err
 }
 
+// IndexStream is IndexData with the data written by write while it is sent,
+// in chunked transfer encoding, so the data is not buffered as a whole
+func (rest SplunkRest) IndexStream(splunkdURI string, sessionKey string,
+	metaProps *url.Values, write func(w io.Writer) error) error {
+	uri := splunkdURI + "/services/receivers/simple?" + metaProps.Encode()
+	req, err := http.NewRequest("POST", uri, nil)
+	if err != nil {
+		glog.Errorf("Failed to create request to %s, reason=%s", uri, err)
+		return err
+	}
+
+	req.Body = base.NewStreamBody(write)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return base.NewStreamBody(write), nil
+	}
+	req.ContentLength = -1
+	rest.addHeaders(req, nil, sessionKey)
+
+	resp, err := rest.client.Do(req)
+	if err != nil {
+		glog.Errorf("Failed to stream to %s, error=%s", uri, err)
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = ioutil.ReadAll(resp.Body)
+	return err
+}
+
 func (rest SplunkRest) addHeaders(req *http.Request, headers map[string]string, sessionKey string) {
 	for k, v := range headers {
 		req.Header.Add(k, v)
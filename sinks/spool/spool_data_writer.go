@@ -0,0 +1,125 @@
+package spool
+
+import (
+	"context"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"path/filepath"
+	"strings"
+)
+
+// SpoolDataWriter keeps the data in a base.DiskQueue. It is the last resort
+// of a failover chain when none of the remote sinks is writable, Replay
+// writes the spooled data to a sink once it recovers. Every write is synced
+// to disk
+type SpoolDataWriter struct {
+	queue     *base.DiskQueue
+	lifecycle base.Lifecycle
+}
+
+// NewSpoolDataWriter
+// @config: SpoolDir, each task spools to its sub-directory named after
+// TaskConfigKey. EncryptionKeyFile and EncryptionKeyID to encrypt the
+// spooled data, see base.DataKeyring
+func NewSpoolDataWriter(config base.BaseConfig) *SpoolDataWriter {
+	if config[base.SpoolDir] == "" {
+		glog.Errorf("%s is required by SpoolDataWriter", base.SpoolDir)
+		return nil
+	}
+
+	keyring, err := base.NewDataKeyring(config)
+	if err != nil {
+		glog.Errorf("Failed to load the encryption keys of SpoolDataWriter, error=%s", err)
+		return nil
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '.' {
+			return '_'
+		}
+		return r
+	}, config[base.TaskConfigKey])
+
+	queue, err := base.NewDiskQueue(filepath.Join(config[base.SpoolDir], name), keyring)
+	if err != nil {
+		return nil
+	}
+
+	return &SpoolDataWriter{
+		queue: queue,
+	}
+}
+
+func (writer *SpoolDataWriter) Start() {
+	if writer.lifecycle.Start("SpoolDataWriter") != nil {
+		return
+	}
+	glog.Infof("SpoolDataWriter started...")
+}
+
+func (writer *SpoolDataWriter) Stop() {
+	if writer.lifecycle.Stop("SpoolDataWriter") != nil {
+		return
+	}
+	glog.Infof("SpoolDataWriter stopped...")
+}
+
+func (writer *SpoolDataWriter) Status() string {
+	return writer.lifecycle.Status()
+}
+
+func (writer *SpoolDataWriter) WriteData(data *base.Data) error {
+	return writer.queue.Enqueue(context.Background(), data)
+}
+
+func (writer *SpoolDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.queue.Enqueue(context.Background(), data)
+}
+
+func (writer *SpoolDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.queue.Enqueue(context.Background(), data)
+}
+
+func (writer *SpoolDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.queue.Enqueue(ctx, data)
+}
+
+// QueueDepth returns the number of data spooled
+func (writer *SpoolDataWriter) QueueDepth() int {
+	return writer.queue.Len()
+}
+
+// Replay writes the spooled data to sink synchronously in the order it was
+// spooled and removes the data which has been written. It stops at the first
+// failure, the rest is replayed next time
+func (writer *SpoolDataWriter) Replay(sink base.DataWriter) error {
+	// Only the data spooled so far, Dequeue doesn't wait on a done context
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	replayed := 0
+	for {
+		item, err := writer.queue.Dequeue(done)
+		if err == context.Canceled || err == base.ErrQueueClosed {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if err = sink.WriteDataSync(item.Data); err != nil {
+			glog.Errorf("Failed to replay spooled data, error=%s", err)
+			writer.queue.Nack(item)
+			return err
+		}
+
+		if err = writer.queue.Ack(item); err != nil {
+			return err
+		}
+		replayed++
+	}
+
+	if replayed > 0 {
+		glog.Infof("Replayed %d spooled data", replayed)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package spool
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpoolDataWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if NewSpoolDataWriter(base.BaseConfig{}) != nil {
+		t.Errorf("Expect nil SpoolDataWriter without %s", base.SpoolDir)
+	}
+
+	config := base.BaseConfig{
+		base.SpoolDir:      filepath.Join(dir, "spool"),
+		base.TaskConfigKey: "snow/incident",
+	}
+	writer := NewSpoolDataWriter(config)
+	if writer == nil {
+		t.Fatalf("Failed to create SpoolDataWriter")
+	}
+	writer.Start()
+	defer writer.Stop()
+
+	for _, record := range []string{"a=b", "c=d"} {
+		data := base.NewData(map[string]string{base.Source: "incident"}, [][]byte{[]byte(record)})
+		if err := writer.WriteData(data); err != nil {
+			t.Errorf("Failed to spool data, error=%s", err)
+		}
+	}
+
+	sink := memory.NewMemoryDataWriter()
+	if err := writer.Replay(sink); err != nil {
+		t.Errorf("Failed to replay spool, error=%s", err)
+	}
+
+	if len(sink.Data()) != 2 {
+		t.Fatalf("Expect 2 replayed data, got %d", len(sink.Data()))
+	}
+	allData := []*base.Data{<-sink.Data(), <-sink.Data()}
+
+	if string(allData[0].RawData[0]) != "a=b" || string(allData[1].RawData[0]) != "c=d" {
+		t.Errorf("Expect data replayed in order, got %s, %s", allData[0].RawData[0], allData[1].RawData[0])
+	}
+
+	if allData[0].MetaInfo[base.Source] != "incident" {
+		t.Errorf("Expect MetaInfo replayed, got %v", allData[0].MetaInfo)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(config[base.SpoolDir], "snow_incident"))
+	if len(files) != 0 || writer.QueueDepth() != 0 {
+		t.Errorf("Expect replayed data removed, got %d files", len(files))
+	}
+
+	if err := writer.Replay(sink); err != nil || len(sink.Data()) != 0 {
+		t.Errorf("Expect nothing replayed again, got error=%v, data=%d", err, len(sink.Data()))
+	}
+}
+
+func TestSpoolDataWriterEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(keyFile, []byte(`{"k1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}`), 0600)
+	config := base.BaseConfig{
+		base.SpoolDir:          filepath.Join(dir, "spool"),
+		base.TaskConfigKey:     "snow/incident",
+		base.EncryptionKeyFile: keyFile,
+		base.EncryptionKeyID:   "k1",
+	}
+
+	writer := NewSpoolDataWriter(config)
+	if writer == nil {
+		t.Fatalf("Failed to create SpoolDataWriter")
+	}
+	writer.Start()
+	defer writer.Stop()
+
+	if err := writer.WriteData(base.NewData(nil, [][]byte{[]byte("secret=1")})); err != nil {
+		t.Errorf("Failed to spool data, error=%s", err)
+	}
+
+	spoolDir := filepath.Join(config[base.SpoolDir], "snow_incident")
+	files, _ := ioutil.ReadDir(spoolDir)
+	if len(files) != 1 {
+		t.Fatalf("Expect 1 spooled data, got %d", len(files))
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(spoolDir, files[0].Name()))
+	if strings.Contains(string(content), "secret") || !strings.Contains(string(content), `"KeyID":"k1"`) {
+		t.Errorf("Expect the data encrypted by k1, got %s", content)
+	}
+
+	// The data can't be replayed without the key. A spool directory is
+	// opened by one writer at a time in practice
+	plain := NewSpoolDataWriter(base.BaseConfig{base.SpoolDir: config[base.SpoolDir], base.TaskConfigKey: "snow/incident"})
+	sink := memory.NewMemoryDataWriter()
+	if err := plain.Replay(sink); err == nil || len(sink.Data()) != 0 {
+		t.Errorf("Expect replay to fail without the key")
+	}
+
+	if err := writer.Replay(sink); err != nil || len(sink.Data()) != 1 {
+		t.Fatalf("Failed to replay spool, error=%v", err)
+	}
+
+	if data := <-sink.Data(); string(data.RawData[0]) != "secret=1" {
+		t.Errorf("Expect secret=1 replayed, got %s", data.RawData[0])
+	}
+}
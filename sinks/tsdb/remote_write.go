@@ -0,0 +1,104 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"github.com/klauspost/compress/snappy"
+	"math"
+	"strings"
+)
+
+// remoteWriter writes the points with the Prometheus remote-write protocol,
+// a snappy compressed WriteRequest protobuf. The message is small enough to
+// be encoded by hand, see EncodeWriteRequest
+type remoteWriter struct {
+	httpWriter
+}
+
+func (writer *remoteWriter) WritePoints(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	headers := map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+	return writer.post(snappy.Encode(nil, EncodeWriteRequest(points)), headers)
+}
+
+// EncodeWriteRequest returns the points as a WriteRequest protobuf, one
+// TimeSeries per point
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+//
+// The metric and label names are sanitized to the Prometheus charset and
+// the labels are sorted by name as Prometheus expects
+func EncodeWriteRequest(points []Point) []byte {
+	var req []byte
+	for _, point := range points {
+		var series []byte
+		series = appendLabel(series, "__name__", sanitizeName(point.Name))
+		for _, name := range sortedTagNames(point.Tags) {
+			if point.Tags[name] != "" {
+				series = appendLabel(series, sanitizeName(name), point.Tags[name])
+			}
+		}
+
+		var sample []byte
+		sample = appendTag(sample, 1, 1)
+		var value [8]byte
+		binary.LittleEndian.PutUint64(value[:], math.Float64bits(point.Value))
+		sample = append(sample, value[:]...)
+		sample = appendTag(sample, 2, 0)
+		sample = appendUvarint(sample, uint64(point.Time.UnixNano()/1e6))
+		series = appendBytes(series, 2, sample)
+
+		req = appendBytes(req, 1, series)
+	}
+	return req
+}
+
+func appendLabel(buf []byte, name, value string) []byte {
+	var label []byte
+	label = appendBytes(label, 1, []byte(name))
+	label = appendBytes(label, 2, []byte(value))
+	return appendBytes(buf, 1, label)
+}
+
+// appendTag appends the key of field with the wire type
+func appendTag(buf []byte, field, wireType int) []byte {
+	return appendUvarint(buf, uint64(field<<3|wireType))
+}
+
+func appendUvarint(buf []byte, value uint64) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varint[:], value)
+	return append(buf, varint[:n]...)
+}
+
+// appendBytes appends a length delimited field
+func appendBytes(buf []byte, field int, value []byte) []byte {
+	buf = appendTag(buf, field, 2)
+	buf = appendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// sanitizeName replaces the characters out of [a-zA-Z0-9_] with "_", a
+// leading digit is prefixed with "_"
+func sanitizeName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if sanitized != "" && sanitized[0] >= '0' && sanitized[0] <= '9' {
+		sanitized = "_" + sanitized
+	}
+	return sanitized
+}
@@ -0,0 +1,164 @@
+package tsdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TSDBType values
+	InfluxDB   = "influxdb"
+	Prometheus = "prometheus"
+)
+
+// Point is a sample of the series of Name and Tags
+type Point struct {
+	Name  string
+	Tags  map[string]string
+	Value float64
+	Time  time.Time
+}
+
+// Writer writes points into a time-series database
+type Writer interface {
+	WritePoints(points []Point) error
+}
+
+// NewWriter
+// @config: TSDBType "influxdb" or "prometheus", TSDBURL the write endpoint,
+// for e.g. "http://influx:8086/write?db=descartes" or the remote-write URL of
+// Prometheus, TSDBToken optionally authorizes the writes with a bearer
+// token, it may refer to a secret, see base.ResolveSecret. The HTTP options
+// of base.NewHTTPClient apply
+func NewWriter(config base.BaseConfig) (Writer, error) {
+	if config[base.TSDBURL] == "" {
+		return nil, errors.New(fmt.Sprintf("%s is missing", base.TSDBURL))
+	}
+
+	token, err := base.ResolveSecret(config[base.TSDBToken])
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := base.NewHTTPClient(config, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := httpWriter{url: config[base.TSDBURL], token: token, client: client}
+	switch config[base.TSDBType] {
+	case InfluxDB:
+		return &influxWriter{writer}, nil
+	case Prometheus:
+		return &remoteWriter{writer}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported %s=%s, expect %s or %s", base.TSDBType, config[base.TSDBType], InfluxDB, Prometheus))
+	}
+}
+
+type httpWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (writer *httpWriter) post(body []byte, headers map[string]string) error {
+	req, err := http.NewRequest("POST", writer.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if writer.token != "" {
+		req.Header.Set("Authorization", "Bearer "+writer.token)
+	}
+
+	resp, err := writer.client.Do(req)
+	if err != nil {
+		glog.Errorf("Failed to write points to %s, error=%s", writer.url, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		glog.Errorf("Failed to write points to %s, status=%s, response=%s", writer.url, resp.Status, content)
+		return errors.New(fmt.Sprintf("Failed to write points to %s, status=%s", writer.url, resp.Status))
+	}
+	return nil
+}
+
+// influxWriter writes the points in the InfluxDB line protocol, each point
+// is a measurement of one "value" field
+type influxWriter struct {
+	httpWriter
+}
+
+func (writer *influxWriter) WritePoints(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return writer.post(EncodeLineProtocol(points), map[string]string{"Content-Type": "text/plain; charset=utf-8"})
+}
+
+// EncodeLineProtocol returns the points in the InfluxDB line protocol, the
+// tags are sorted and the timestamps are in nano seconds
+func EncodeLineProtocol(points []Point) []byte {
+	var buf bytes.Buffer
+	for _, point := range points {
+		if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+			continue
+		}
+
+		buf.WriteString(escapeLine(point.Name, ", "))
+		for _, name := range sortedTagNames(point.Tags) {
+			if point.Tags[name] == "" {
+				// Empty tag values are invalid
+				continue
+			}
+			buf.WriteByte(',')
+			buf.WriteString(escapeLine(name, ",= "))
+			buf.WriteByte('=')
+			buf.WriteString(escapeLine(point.Tags[name], ",= "))
+		}
+		buf.WriteString(" value=")
+		buf.WriteString(strconv.FormatFloat(point.Value, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(point.Time.UnixNano(), 10))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func escapeLine(value, special string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		if r == '\\' || strings.ContainsRune(special, r) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func sortedTagNames(tags map[string]string) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
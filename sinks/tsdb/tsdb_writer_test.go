@@ -0,0 +1,110 @@
+package tsdb
+
+import (
+	"bytes"
+	"github.com/chenziliang/descartes/base"
+	"github.com/klauspost/compress/snappy"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testPoints() []Point {
+	at := time.Unix(1500000000, 123)
+	return []Point{
+		{Name: "descartes_records_written", Tags: map[string]string{"host": "h1", "app": "snow"}, Value: 42, Time: at},
+		{Name: "job health", Tags: map[string]string{"job": "a=b,c", "platform": ""}, Value: 0.5, Time: at},
+		{Name: "descartes_nan", Value: math.NaN(), Time: at},
+	}
+}
+
+func TestEncodeLineProtocol(t *testing.T) {
+	expected := "descartes_records_written,app=snow,host=h1 value=42 1500000000000000123\n" +
+		"job\\ health,job=a\\=b\\,c value=0.5 1500000000000000123\n"
+	if res := string(EncodeLineProtocol(testPoints())); res != expected {
+		t.Errorf("Expect line protocol=%q, got=%q", expected, res)
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	point := Point{Name: "m", Tags: map[string]string{"a": "b"}, Value: 1, Time: time.Unix(1, 0)}
+	expected := []byte{
+		0x0a, 0x25, // timeseries
+		0x0a, 0x0d, 0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 0x12, 0x01, 'm', // __name__ label
+		0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', // a label
+		0x12, 0x0c, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x10, 0xe8, 0x07, // sample of 1.0 at 1000ms
+	}
+	if res := EncodeWriteRequest([]Point{point}); !bytes.Equal(res, expected) {
+		t.Errorf("Expect WriteRequest=% x, got=% x", expected, res)
+	}
+
+	cases := map[string]string{
+		"descartes_ok": "descartes_ok",
+		"job health":   "job_health",
+		"0day":         "_0day",
+	}
+	for name, expected := range cases {
+		if res := sanitizeName(name); res != expected {
+			t.Errorf("Expect %s sanitized to %s, got=%s", name, expected, res)
+		}
+	}
+}
+
+func TestWritePoints(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cases := map[string]string{
+		InfluxDB:   "text/plain; charset=utf-8",
+		Prometheus: "application/x-protobuf",
+	}
+	for tsdbType, contentType := range cases {
+		config := base.BaseConfig{
+			base.TSDBType:  tsdbType,
+			base.TSDBURL:   server.URL,
+			base.TSDBToken: "t0ken",
+		}
+		writer, err := NewWriter(config)
+		if err != nil {
+			t.Fatalf("Failed to create %s writer, error=%s", tsdbType, err)
+		}
+
+		if err := writer.WritePoints(testPoints()); err != nil {
+			t.Errorf("Failed to write points to %s, error=%s", tsdbType, err)
+			continue
+		}
+
+		if req.Header.Get("Content-Type") != contentType || req.Header.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("Unexpected %s headers=%v", tsdbType, req.Header)
+		}
+
+		var expected []byte
+		if tsdbType == InfluxDB {
+			expected = EncodeLineProtocol(testPoints())
+		} else {
+			expected = snappy.Encode(nil, EncodeWriteRequest(testPoints()))
+		}
+		if !bytes.Equal(body, expected) {
+			t.Errorf("Unexpected %s body=%q", tsdbType, body)
+		}
+	}
+
+	server.Close()
+	writer, _ := NewWriter(base.BaseConfig{base.TSDBType: InfluxDB, base.TSDBURL: server.URL})
+	if err := writer.WritePoints(testPoints()); err == nil {
+		t.Errorf("Expect failure when the time-series database is down")
+	}
+
+	if _, err := NewWriter(base.BaseConfig{base.TSDBType: "graphite", base.TSDBURL: server.URL}); err == nil {
+		t.Errorf("Expect unsupported TSDBType rejected")
+	}
+}
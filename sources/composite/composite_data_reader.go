@@ -0,0 +1,375 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	timestampFieldKey = "TimestampField"
+	defaultBufferSize = 10000
+	// The name the composite acknowledges the data of the sources with to
+	// their checkpoint coordinators
+	releaseSink = "composite"
+)
+
+// bufferedRecord is a record of a source waiting to be released in order
+type bufferedRecord struct {
+	timestamp string
+	source    *source
+	seq       int64 // of the data of the source the record belongs to
+	last      bool  // the last record of the data
+	metaInfo  map[string]string
+	raw       []byte
+}
+
+type source struct {
+	name        string
+	reader      base.DataReader
+	coordinator *base.CheckpointCoordinator
+	seq         int64  // of the last data written by the source
+	mark        string // the latest timestamp written by the source
+	wrote       bool   // written in the current cycle
+	idle        bool   // wrote nothing in the last cycle
+}
+
+// CompositeDataReader merges the data of several sources, for e.g. the
+// incident and the incident_task tables, into one stream ordered by the
+// TimestampField of the records. Each source is supposed to collect its
+// records in timestamp order. The records are buffered until every source
+// which collected data in the last cycle has collected past them, or the
+// buffer is full, then the oldest ones are released regardless. A source
+// which collected nothing in a cycle has caught up and doesn't hold the others
+// back. The checkpoint of a source only advances once its records before it
+// are released, so the buffered records are collected again after a crash
+type CompositeDataReader struct {
+	config     base.BaseConfig
+	writer     base.DataWriter
+	field      string
+	bufferSize int
+	sources    []*source
+	buffer     []*bufferedRecord // ordered by timestamp, then arrival
+	mutex      sync.Mutex
+	collecting int32
+	lifecycle  base.Lifecycle
+}
+
+// NewCompositeDataReader
+// @config: TimestampField of the records to order them by,
+// CompositeBufferSize the max number of records buffered, 10000 by default
+// @writer: the writer of the merged stream
+func NewCompositeDataReader(config base.BaseConfig, writer base.DataWriter) *CompositeDataReader {
+	if config[timestampFieldKey] == "" {
+		glog.Errorf("%s is required to merge the sources", timestampFieldKey)
+		return nil
+	}
+
+	bufferSize := defaultBufferSize
+	if config[base.CompositeBufferSize] != "" {
+		n, err := strconv.Atoi(config[base.CompositeBufferSize])
+		if err != nil || n <= 0 {
+			glog.Errorf("Invalid %s=%s, expect a positive number", base.CompositeBufferSize, config[base.CompositeBufferSize])
+			return nil
+		}
+		bufferSize = n
+	}
+
+	return &CompositeDataReader{
+		config:     config,
+		writer:     writer,
+		field:      config[timestampFieldKey],
+		bufferSize: bufferSize,
+	}
+}
+
+// AddSource creates a source by newReader with the writer and the
+// checkpointer the source shall use. It shall be called before Start
+// @checkpoint: the checkpointer of the source
+func (reader *CompositeDataReader) AddSource(name string, checkpoint base.Checkpointer,
+	newReader func(writer base.DataWriter, checkpoint base.Checkpointer) base.DataReader) error {
+	s := &source{
+		name:        name,
+		coordinator: base.NewCheckpointCoordinator(checkpoint, []string{releaseSink}, 1),
+	}
+
+	r := newReader(&sourceWriter{composite: reader, source: s}, &sourceCheckpointer{Checkpointer: checkpoint, source: s})
+	if r == nil {
+		return errors.New(fmt.Sprintf("Failed to create source=%s", name))
+	}
+	s.reader = r
+	reader.sources = append(reader.sources, s)
+	return nil
+}
+
+func (reader *CompositeDataReader) Start() {
+	if reader.lifecycle.Start("CompositeDataReader") != nil {
+		return
+	}
+
+	reader.writer.Start()
+	for _, s := range reader.sources {
+		s.reader.Start()
+	}
+	glog.Infof("CompositeDataReader started...")
+}
+
+// Stop releases the buffered records in order before the sources stop
+func (reader *CompositeDataReader) Stop() {
+	if reader.lifecycle.Stop("CompositeDataReader") != nil {
+		return
+	}
+
+	reader.mutex.Lock()
+	if err := reader.release(true); err != nil {
+		glog.Errorf("Failed to release %d buffered records, error=%s", len(reader.buffer), err)
+	}
+	reader.mutex.Unlock()
+
+	for _, s := range reader.sources {
+		s.reader.Stop()
+	}
+	reader.writer.Stop()
+	glog.Infof("CompositeDataReader stopped...")
+}
+
+func (reader *CompositeDataReader) Status() string {
+	return reader.lifecycle.Status()
+}
+
+// Cancel cancels the collection cycles of the sources which support it
+func (reader *CompositeDataReader) Cancel() {
+	for _, s := range reader.sources {
+		if r, ok := s.reader.(base.CancelableDataReader); ok {
+			r.Cancel()
+		}
+	}
+}
+
+// CatchingUp returns true while any of the sources catches up
+func (reader *CompositeDataReader) CatchingUp() bool {
+	for _, s := range reader.sources {
+		if r, ok := s.reader.(base.CatchUpDataReader); ok && r.CatchingUp() {
+			return true
+		}
+	}
+	return false
+}
+
+func (reader *CompositeDataReader) ReadData() ([]byte, error) {
+	return nil, nil
+}
+
+// IndexData runs a collection cycle of every source in turn, then releases
+// the records which are in order. A failed source doesn't hold back the
+// others
+func (reader *CompositeDataReader) IndexData() error {
+	if !atomic.CompareAndSwapInt32(&reader.collecting, 0, 1) {
+		glog.Infof("Last data collection of the composite sources has not been done")
+		return base.ErrSkipped
+	}
+	defer atomic.StoreInt32(&reader.collecting, 0)
+
+	var lastErr error
+	skipped := 0
+	for _, s := range reader.sources {
+		reader.mutex.Lock()
+		s.wrote = false
+		reader.mutex.Unlock()
+
+		err := s.reader.IndexData()
+		if err == base.ErrSkipped {
+			skipped++
+		} else if err != nil {
+			glog.Errorf("Failed to collect source=%s, error=%s", s.name, err)
+			lastErr = err
+		}
+
+		reader.mutex.Lock()
+		s.idle = !s.wrote
+		reader.mutex.Unlock()
+	}
+
+	reader.mutex.Lock()
+	err := reader.release(false)
+	reader.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if lastErr == nil && skipped == len(reader.sources) {
+		return base.ErrSkipped
+	}
+	return lastErr
+}
+
+// Buffered returns the number of records waiting to be released
+func (reader *CompositeDataReader) Buffered() int {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	return len(reader.buffer)
+}
+
+// bufferData queues the records of data written by s in order
+func (reader *CompositeDataReader) bufferData(s *source, data *base.Data) error {
+	// The sources may reuse data once it is written
+	copied := base.NewData(data.MetaInfo, append([][]byte(nil), data.RawData...))
+	copied.Records = data.Records
+	records, err := copied.ParseRecords()
+	if err != nil {
+		return err
+	}
+
+	if err := copied.Serialize(); err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	s.seq++
+	s.wrote = true
+	for i, record := range records {
+		r := &bufferedRecord{
+			timestamp: timestampOf(record, reader.field),
+			source:    s,
+			seq:       s.seq,
+			last:      i == len(records)-1,
+			metaInfo:  copied.MetaInfo,
+			raw:       copied.RawData[i],
+		}
+		if r.timestamp > s.mark {
+			s.mark = r.timestamp
+		}
+
+		idx := sort.Search(len(reader.buffer), func(j int) bool {
+			return reader.buffer[j].timestamp > r.timestamp
+		})
+		reader.buffer = append(reader.buffer, nil)
+		copy(reader.buffer[idx+1:], reader.buffer[idx:])
+		reader.buffer[idx] = r
+	}
+
+	if len(reader.buffer) > reader.bufferSize {
+		glog.Warningf("Composite buffer of %d records is full, release the oldest out of order", reader.bufferSize)
+		return reader.release(false)
+	}
+	return nil
+}
+
+// watermark returns the timestamp which every source collecting data has
+// collected past, false if no source holds the records back
+func (reader *CompositeDataReader) watermark() (string, bool) {
+	mark, held := "", false
+	for _, s := range reader.sources {
+		if s.idle {
+			continue
+		}
+
+		if !held || s.mark < mark {
+			mark = s.mark
+		}
+		held = true
+	}
+	return mark, held
+}
+
+// release writes the buffered records which are in order, the oldest ones
+// beyond the buffer size, or all of them if flush. Consecutive records of the
+// same data are written together
+func (reader *CompositeDataReader) release(flush bool) error {
+	mark, held := reader.watermark()
+	n := 0
+	for n < len(reader.buffer) {
+		r := reader.buffer[n]
+		if flush || !held || r.timestamp <= mark || len(reader.buffer)-n > reader.bufferSize {
+			n++
+			continue
+		}
+		break
+	}
+
+	for n > 0 {
+		first := reader.buffer[0]
+		group := 1
+		for group < n && reader.buffer[group].source == first.source && reader.buffer[group].seq == first.seq {
+			group++
+		}
+
+		raws := make([][]byte, 0, group)
+		for _, r := range reader.buffer[:group] {
+			raws = append(raws, r.raw)
+		}
+
+		if err := reader.writer.WriteData(base.NewData(first.metaInfo, raws)); err != nil {
+			return err
+		}
+
+		if last := reader.buffer[group-1]; last.last {
+			last.source.coordinator.Ack(releaseSink, last.seq)
+		}
+		reader.buffer = reader.buffer[group:]
+		n -= group
+	}
+	return nil
+}
+
+func timestampOf(record map[string]interface{}, field string) string {
+	switch ts := record[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return ts
+	default:
+		return fmt.Sprint(ts)
+	}
+}
+
+// sourceWriter buffers the data written by a source into the composite
+type sourceWriter struct {
+	composite *CompositeDataReader
+	source    *source
+}
+
+func (writer *sourceWriter) Start() {
+}
+
+func (writer *sourceWriter) Stop() {
+}
+
+func (writer *sourceWriter) WriteData(data *base.Data) error {
+	return writer.composite.bufferData(writer.source, data)
+}
+
+func (writer *sourceWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *sourceWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *sourceWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+// sourceCheckpointer holds the checkpoints of a source back until the
+// records written before them are released
+type sourceCheckpointer struct {
+	base.Checkpointer
+	source *source
+}
+
+func (checkpoint *sourceCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	return checkpoint.source.coordinator.Propose(keyInfo, value, checkpoint.source.seq)
+}
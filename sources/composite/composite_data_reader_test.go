@@ -0,0 +1,189 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"testing"
+)
+
+type recordingCheckpointer struct {
+	base.NullCheckpointer
+	values []string
+}
+
+func (ck *recordingCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	ck.values = append(ck.values, string(value))
+	return nil
+}
+
+type recordingDataWriter struct {
+	records []string
+}
+
+func (writer *recordingDataWriter) Start() {
+}
+
+func (writer *recordingDataWriter) Stop() {
+}
+
+func (writer *recordingDataWriter) WriteData(data *base.Data) error {
+	for _, raw := range data.RawData {
+		writer.records = append(writer.records, string(raw))
+	}
+	return nil
+}
+
+func (writer *recordingDataWriter) WriteDataSync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *recordingDataWriter) WriteDataAsync(data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+func (writer *recordingDataWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	return writer.WriteData(data)
+}
+
+// cycleDataReader writes the records of a cycle each IndexData, then
+// checkpoints the timestamp of the last one
+type cycleDataReader struct {
+	table      string
+	cycles     [][]string // timestamps of the records of each cycle
+	writer     base.DataWriter
+	checkpoint base.Checkpointer
+	data       *base.Data
+}
+
+func (reader *cycleDataReader) Start() {
+}
+
+func (reader *cycleDataReader) Stop() {
+}
+
+func (reader *cycleDataReader) ReadData() ([]byte, error) {
+	return nil, nil
+}
+
+func (reader *cycleDataReader) IndexData() error {
+	if len(reader.cycles) == 0 {
+		return nil
+	}
+
+	cycle := reader.cycles[0]
+	reader.cycles = reader.cycles[1:]
+	if len(cycle) == 0 {
+		return nil
+	}
+
+	// Like snow, the data is reused once written
+	reader.data.RawData = reader.data.RawData[:0]
+	reader.data.Records = nil
+	for _, ts := range cycle {
+		record := fmt.Sprintf(`{"table":"%s","sys_updated_on":"%s"}`, reader.table, ts)
+		reader.data.RawData = append(reader.data.RawData, []byte(record))
+	}
+	if err := reader.writer.WriteData(reader.data); err != nil {
+		return err
+	}
+	return reader.checkpoint.WriteCheckpoint(nil, []byte(cycle[len(cycle)-1]))
+}
+
+func newTestCompositeDataReader(t *testing.T, bufferSize string, sources map[string][][]string) (*CompositeDataReader, *recordingDataWriter, map[string]*recordingCheckpointer) {
+	writer := &recordingDataWriter{}
+	config := base.BaseConfig{
+		timestampFieldKey:        "sys_updated_on",
+		base.CompositeBufferSize: bufferSize,
+	}
+	reader := NewCompositeDataReader(config, writer)
+	if reader == nil {
+		t.Fatalf("Failed to create CompositeDataReader")
+	}
+
+	checkpoints := make(map[string]*recordingCheckpointer)
+	for _, table := range []string{"incident", "incident_task"} {
+		table := table
+		checkpoints[table] = &recordingCheckpointer{}
+		err := reader.AddSource(table, checkpoints[table], func(w base.DataWriter, ck base.Checkpointer) base.DataReader {
+			return &cycleDataReader{
+				table:      table,
+				cycles:     sources[table],
+				writer:     w,
+				checkpoint: ck,
+				data:       base.NewData(map[string]string{base.Metric: table}, nil),
+			}
+		})
+		if err != nil {
+			t.Fatalf("Failed to add source=%s, error=%s", table, err)
+		}
+	}
+	return reader, writer, checkpoints
+}
+
+func TestCompositeDataReaderOrder(t *testing.T) {
+	reader, writer, checkpoints := newTestCompositeDataReader(t, "", map[string][][]string{
+		"incident":      {{"2020-01-01 00:00:01", "2020-01-01 00:00:04"}, {"2020-01-01 00:00:06"}, {}},
+		"incident_task": {{"2020-01-01 00:00:02", "2020-01-01 00:00:03", "2020-01-01 00:00:05"}, {}},
+	})
+	reader.Start()
+
+	if err := reader.IndexData(); err != nil {
+		t.Errorf("Failed to index data, error=%s", err)
+	}
+
+	// incident has collected up to 00:00:04, the 00:00:05 task waits for it
+	expected := []string{
+		`{"table":"incident","sys_updated_on":"2020-01-01 00:00:01"}`,
+		`{"table":"incident_task","sys_updated_on":"2020-01-01 00:00:02"}`,
+		`{"table":"incident_task","sys_updated_on":"2020-01-01 00:00:03"}`,
+		`{"table":"incident","sys_updated_on":"2020-01-01 00:00:04"}`,
+	}
+	if fmt.Sprint(writer.records) != fmt.Sprint(expected) {
+		t.Errorf("Expect records=%s, got=%s", expected, writer.records)
+	}
+
+	if len(checkpoints["incident"].values) != 1 || len(checkpoints["incident_task"].values) != 0 {
+		t.Errorf("Expect the checkpoint of incident_task held back, got incident=%s incident_task=%s",
+			checkpoints["incident"].values, checkpoints["incident_task"].values)
+	}
+
+	// incident_task is idle and doesn't hold incident back anymore
+	reader.IndexData()
+	expected = append(expected,
+		`{"table":"incident_task","sys_updated_on":"2020-01-01 00:00:05"}`,
+		`{"table":"incident","sys_updated_on":"2020-01-01 00:00:06"}`)
+	if fmt.Sprint(writer.records) != fmt.Sprint(expected) || reader.Buffered() != 0 {
+		t.Errorf("Expect records=%s, got=%s buffered=%d", expected, writer.records, reader.Buffered())
+	}
+
+	if fmt.Sprint(checkpoints["incident"].values) != "[2020-01-01 00:00:04 2020-01-01 00:00:06]" ||
+		fmt.Sprint(checkpoints["incident_task"].values) != "[2020-01-01 00:00:05]" {
+		t.Errorf("Unexpected checkpoints incident=%s incident_task=%s",
+			checkpoints["incident"].values, checkpoints["incident_task"].values)
+	}
+	reader.Stop()
+}
+
+func TestCompositeDataReaderBufferSize(t *testing.T) {
+	reader, writer, _ := newTestCompositeDataReader(t, "2", map[string][][]string{
+		"incident":      {{"2020-01-01 00:00:01"}},
+		"incident_task": {{"2020-01-01 00:00:02", "2020-01-01 00:00:03", "2020-01-01 00:00:04", "2020-01-01 00:00:05"}},
+	})
+	reader.Start()
+	reader.IndexData()
+
+	if reader.Buffered() != 2 || len(writer.records) != 3 {
+		t.Errorf("Expect 2 records buffered, got buffered=%d written=%d", reader.Buffered(), len(writer.records))
+	}
+
+	reader.Stop()
+	if reader.Buffered() != 0 || len(writer.records) != 5 {
+		t.Errorf("Expect the buffered records released on stop, got buffered=%d written=%d",
+			reader.Buffered(), len(writer.records))
+	}
+
+	if NewCompositeDataReader(base.BaseConfig{}, writer) != nil {
+		t.Errorf("Expect TimestampField required")
+	}
+}
@@ -2,11 +2,13 @@ package kafka
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Shopify/sarama"
 	"github.com/chenziliang/descartes/base"
 	"github.com/golang/glog"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -27,19 +29,27 @@ type KafkaDataReader struct {
 	partitionConsumer sarama.PartitionConsumer
 	state             collectionState
 	config            base.BaseConfig
-	collecting        int32
+	codec             base.Codec
+	writeTimeout      time.Duration
+	offset            int64 // next offset to consume as checkpointed
+	gap               *base.OffsetGap
+	canceled          chan struct{} // closed by Cancel
+	cancelOnce        sync.Once
+	lifecycle         base.Lifecycle
 	startIndexing     int32
 }
 
 const (
-	stopped        = 0
-	initialStarted = 1
-	started        = 2
-	startIndex     = 3
-	maxRetry       = 16
+	startIndex = 3
+	maxRetry   = 16
 )
 
 // NewKafaDataReader
+// The messages compressed by gzip or zstd are detected by their magic bytes,
+// base.Compression and base.CompressionDict are the codec of the others and
+// the zstd dictionary. Besides the envelopes, the raw JSON records of other
+// producers are read, see base.DecodeMessage, so mixed producer topics can
+// be relayed
 // FIXME support more config options
 func NewKafkaDataReader(client *base.KafkaClient, config base.BaseConfig,
 	writer base.DataWriter, checkpoint base.Checkpointer) *KafkaDataReader {
@@ -50,6 +60,12 @@ func NewKafkaDataReader(client *base.KafkaClient, config base.BaseConfig,
 		}
 	}
 
+	codec, err := base.NewAutoCodec(config)
+	if err != nil {
+		glog.Errorf("Failed to create compression codec, error=%s", err)
+		return nil
+	}
+
 	topic, partition := config[base.KafkaTopic], config[base.KafkaPartition]
 	master, err := sarama.NewConsumerFromClient(client.Client())
 	if err != nil {
@@ -75,6 +91,16 @@ func NewKafkaDataReader(client *base.KafkaClient, config base.BaseConfig,
 	}
 
 	consumer, err := master.ConsumePartition(topic, int32(pid), state.Offset)
+	var gap *base.OffsetGap
+	if err == sarama.ErrOffsetOutOfRange {
+		var offset int64
+		offset, gap, err = resetOffset(client, config, state)
+		if err == nil {
+			consumer, err = master.ConsumePartition(topic, int32(pid), offset)
+			state.Offset = offset
+		}
+	}
+
 	if err != nil {
 		glog.Errorf("Failed to create Kafka partition consumer for topic=%s, partition=%s, error=%s",
 			topic, partition, err)
@@ -89,13 +115,16 @@ func NewKafkaDataReader(client *base.KafkaClient, config base.BaseConfig,
 		partitionConsumer: consumer,
 		state:             *state,
 		config:            config,
-		collecting:        initialStarted,
+		codec:             codec,
+		writeTimeout:      base.GetWriteTimeout(config),
+		offset:            state.Offset,
+		gap:               gap,
+		canceled:          make(chan struct{}),
 	}
 }
 
 func (reader *KafkaDataReader) Start() {
-	if !atomic.CompareAndSwapInt32(&reader.collecting, initialStarted, started) {
-		glog.Infof("KafkDataReader already started or stopped")
+	if reader.lifecycle.Start("KafkaDataReader") != nil {
 		return
 	}
 	reader.writer.Start()
@@ -104,18 +133,32 @@ func (reader *KafkaDataReader) Start() {
 }
 
 func (reader *KafkaDataReader) Stop() {
-	if !atomic.CompareAndSwapInt32(&reader.collecting, started, stopped) {
-		glog.Infof("KafkaDataReader already stopped")
+	err := reader.lifecycle.Stop("KafkaDataReader")
+	if err == base.ErrAlreadyStopped {
 		return
 	}
 
+	// The consumers are created with the reader, close them even if it is not started
 	reader.master.Close()
 	reader.partitionConsumer.AsyncClose()
+	if err == base.ErrNotStarted {
+		return
+	}
 	reader.writer.Stop()
 	reader.checkpoint.Stop()
 	glog.Infof("KafkDataReader stopped...")
 }
 
+func (reader *KafkaDataReader) Status() string {
+	return reader.lifecycle.Status()
+}
+
+// Cancel ends the collection after the messages consumed are written and
+// their offset saved, the reader shall be stopped then
+func (reader *KafkaDataReader) Cancel() {
+	reader.cancelOnce.Do(func() { close(reader.canceled) })
+}
+
 func (reader *KafkaDataReader) ReadData() ([]byte, error) {
 	return nil, nil
 }
@@ -123,14 +166,14 @@ func (reader *KafkaDataReader) ReadData() ([]byte, error) {
 func (reader *KafkaDataReader) IndexData() error {
 	if !atomic.CompareAndSwapInt32(&reader.startIndexing, 0, 1) {
 		glog.Infof("KafkDataReader indexing already started.")
-		return nil
+		return base.ErrSkipped
 	}
 
 	var (
 		n                               = 16
 		lastMsg *sarama.ConsumerMessage = nil
 		batchs                          = make([]*base.Data, 0, n)
-		errMsg                          = "Failed to unmarshal msg, expect marshalled in JSON format of base.Data"
+		errMsg                          = "Failed to unmarshal msg, expect base.Envelope in JSON format"
 	)
 
 	f := func(msg *sarama.ConsumerMessage, msgs []*base.Data) []*base.Data {
@@ -143,8 +186,15 @@ func (reader *KafkaDataReader) IndexData() error {
 	}
 
 	ticker := time.Tick(10 * time.Second)
-	for atomic.LoadInt32(&reader.collecting) != stopped {
+	for !reader.lifecycle.Stopped() {
 		select {
+		case <-reader.canceled:
+			if lastMsg != nil && len(batchs) > 0 {
+				f(lastMsg, batchs)
+			}
+			glog.Infof("KafkaDataReader canceled, topic=%s", reader.config[base.KafkaTopic])
+			return nil
+
 		case err, ok := <-reader.partitionConsumer.Errors():
 			if ok {
 				glog.Errorf("Encounter error while collecting data, error=%s", err)
@@ -155,15 +205,20 @@ func (reader *KafkaDataReader) IndexData() error {
 				break
 			}
 
-			var data base.Data
-			err := json.Unmarshal(msg.Value, &data)
+			value, err := reader.codec.Decode(msg.Value)
+			if err != nil {
+				glog.Errorf("Failed to decompress msg with codec=%s, error=%s", reader.codec.Name(), err)
+				continue
+			}
+
+			data, err := base.DecodeMessage(value)
 			if err != nil {
-				glog.Errorf(errMsg)
+				glog.Errorf("%s, error=%s", errMsg, err)
 				continue
 			}
 
 			lastMsg = msg
-			batchs = append(batchs, &data)
+			batchs = append(batchs, data)
 			if len(batchs) >= n {
 				batchs = f(msg, batchs)
 			}
@@ -181,8 +236,10 @@ func (reader *KafkaDataReader) writeData(topic string, partition int32, offset i
 	errMsg := fmt.Sprintf("Failed to write data for topic=%s, partition=%d, offset=%d",
 		topic, partition, offset)
 	var i int
+	// A write which times out is retried, the offset is not saved until the
+	// data has been written
 	for i = 0; i < maxRetry; i++ {
-		err := reader.writer.WriteData(data)
+		err := base.WriteDataTimeout(reader.writer, data, reader.writeTimeout)
 		if err != nil {
 			glog.Errorf(errMsg)
 			time.Sleep(time.Second)
@@ -221,6 +278,70 @@ func (reader *KafkaDataReader) saveOffset(offset int64) {
 	if i == maxRetry {
 		panic(errMsg)
 	}
+	atomic.StoreInt64(&reader.offset, offset)
+}
+
+// Offset returns the next offset to consume as checkpointed, negative if
+// nothing has been consumed yet, for e.g. sarama.OffsetOldest
+func (reader *KafkaDataReader) Offset() int64 {
+	return atomic.LoadInt64(&reader.offset)
+}
+
+// Gap returns the offsets skipped on resume because the checkpointed offset
+// had expired, nil if nothing was skipped
+func (reader *KafkaDataReader) Gap() *base.OffsetGap {
+	return reader.gap
+}
+
+// resetOffset decides where to resume when the checkpointed offset of state
+// has been deleted by retention according to KafkaOffsetReset, "fail" by
+// default, and reports the skipped offsets as a data gap audit event
+func resetOffset(client *base.KafkaClient, config base.BaseConfig, state *collectionState) (int64, *base.OffsetGap, error) {
+	policy := config[base.KafkaOffsetReset]
+	if policy == "" {
+		policy = base.OffsetResetFail
+	}
+
+	errMsg := fmt.Sprintf("Checkpointed offset=%d of consumer group=%s, topic=%s, partition=%d has expired",
+		state.Offset, state.ConsumerGroup, state.Topic, state.Partition)
+
+	var when int64
+	switch policy {
+	case base.OffsetResetOldest:
+		when = sarama.OffsetOldest
+	case base.OffsetResetNewest:
+		when = sarama.OffsetNewest
+	case base.OffsetResetFail:
+		glog.Errorf("%s, set %s to %s or %s to resume", errMsg, base.KafkaOffsetReset, base.OffsetResetOldest, base.OffsetResetNewest)
+		return 0, nil, sarama.ErrOffsetOutOfRange
+	default:
+		glog.Errorf("%s, unsupported %s=%s", errMsg, base.KafkaOffsetReset, policy)
+		return 0, nil, errors.New(fmt.Sprintf("Unsupported %s=%s", base.KafkaOffsetReset, policy))
+	}
+
+	offset, err := client.Client().GetOffset(state.Topic, state.Partition, when)
+	if err != nil {
+		glog.Errorf("%s, failed to get the %s offset, error=%s", errMsg, policy, err)
+		return 0, nil, err
+	}
+
+	gap := &base.OffsetGap{
+		ConsumerGroup: state.ConsumerGroup,
+		Topic:         state.Topic,
+		Partition:     state.Partition,
+		From:          state.Offset,
+		To:            offset,
+		Policy:        policy,
+	}
+
+	// Offsets beyond the newest mean the topic was re-created
+	missed := "unknown"
+	if offset > state.Offset {
+		missed = strconv.FormatInt(offset-state.Offset, 10)
+	}
+	glog.Warningf("Audit: data gap, %s, resume from %s offset=%d, estimated missed messages=%s",
+		errMsg, policy, offset, missed)
+	return offset, gap, nil
 }
 
 func getCheckpoint(checkpoint base.Checkpointer, config base.BaseConfig) *collectionState {
@@ -0,0 +1,67 @@
+package snow
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strings"
+)
+
+// BootstrapCheckpoint initializes the checkpoint of the task of config, if it
+// has none, from records of its table collected before, for e.g. found in
+// the destination topic when the task is migrated from another deployment.
+// The collection then continues after the newest of them instead of
+// collecting them again from NextRecordTime. Returns the NextRecordTime of
+// the checkpoint initialized, empty if the checkpoint is kept
+func BootstrapCheckpoint(config base.BaseConfig, checkpoint base.Checkpointer, records []map[string]interface{}) (string, error) {
+	data, err := checkpoint.GetCheckpoint(config)
+	if err != nil || data != nil {
+		return "", err
+	}
+
+	timefield := config[timestampFieldKey]
+	newest := strings.Replace(config[nextRecordTimeKey], "+", " ", 1)
+	var newestRecords []string
+	for _, record := range records {
+		recordTime, _ := record[timefield].(string)
+		sysId, _ := record["sys_id"].(string)
+		if recordTime == "" || recordTime < newest {
+			continue
+		}
+
+		if recordTime > newest {
+			newest = recordTime
+			newestRecords = newestRecords[:0]
+		}
+
+		if sysId != "" {
+			newestRecords = append(newestRecords, sysId)
+		}
+	}
+
+	// The records with the newest timestamp are known, the others of the
+	// same timestamp are still collected
+	if len(newestRecords) == 0 {
+		return "", nil
+	}
+
+	state := &collectionState{
+		Version:         "1",
+		NextRecordTime:  newest,
+		LastTimeRecords: newestRecords,
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		glog.Errorf("Failed to marhsal checkpoint, error=%s", err)
+		return "", err
+	}
+
+	if err := checkpoint.WriteCheckpoint(config, data); err != nil {
+		return "", err
+	}
+
+	glog.Infof("Bootstrapped checkpoint of %s from %d records collected before, NextRecordTime=%s",
+		config[base.Key], len(records), newest)
+	return newest, nil
+}
@@ -0,0 +1,112 @@
+package snow
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"strconv"
+)
+
+const (
+	// Change annotation, see annotateChanges
+	changeAnnotationKey     = "ChangeAnnotation"
+	changeCacheSizeKey      = "ChangeCacheSize"
+	defaultChangeCacheSize  = 100000
+	changeTypeField         = "_change_type"
+	previousRecordTimeField = "_previous_record_time"
+	changeFirstSeen         = "first_seen"
+	changeUpdate            = "update"
+)
+
+// changeCache remembers the TimestampField of the records collected lately
+// by sys_id, the least recently used of them are evicted first when it is
+// full. It only lives in memory, the records collected before a restart are
+// unknown
+type changeCache struct {
+	times *base.LRUCache // sys_id indexed
+}
+
+func newChangeCache(size int) *changeCache {
+	if size <= 0 {
+		size = defaultChangeCacheSize
+	}
+
+	return &changeCache{
+		times: base.NewLRUCache(size, 0),
+	}
+}
+
+func newChangeCacheOf(config base.BaseConfig) *changeCache {
+	if config[changeAnnotationKey] != "1" {
+		return nil
+	}
+
+	size, _ := strconv.Atoi(config[changeCacheSizeKey])
+	return newChangeCache(size)
+}
+
+func (cache *changeCache) get(sysId string) (string, bool) {
+	recordTime, ok := cache.times.Get(sysId)
+	if !ok {
+		return "", false
+	}
+	return recordTime.(string), true
+}
+
+func (cache *changeCache) put(sysId, recordTime string) {
+	cache.times.Set(sysId, recordTime)
+}
+
+// annotateChanges adds _change_type to the records, "update" if the record
+// was collected before at an earlier TimestampField, which is added as
+// _previous_record_time, "first_seen" otherwise. A record not in the cache,
+// for e.g. after a restart, is only "first_seen" if it hasn't been modified
+// since it was created by its sys_mod_count or sys_created_on
+func (snow *SnowDataReader) annotateChanges(records []interface{}) {
+	if snow.changes == nil {
+		return
+	}
+
+	timefield := snow.config[timestampFieldKey]
+	for _, record := range records {
+		r, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		sysId, _ := r["sys_id"].(string)
+		if previous, ok := snow.changes.get(sysId); ok {
+			r[changeTypeField] = changeUpdate
+			r[previousRecordTimeField] = previous
+		} else if isCreation(r, timefield) {
+			r[changeTypeField] = changeFirstSeen
+		} else {
+			r[changeTypeField] = changeUpdate
+		}
+	}
+}
+
+// rememberChanges adds the records to the cache once they are checkpointed
+func (snow *SnowDataReader) rememberChanges(records []interface{}) {
+	if snow.changes == nil {
+		return
+	}
+
+	timefield := snow.config[timestampFieldKey]
+	for _, record := range records {
+		r, _ := record.(map[string]interface{})
+		sysId, _ := r["sys_id"].(string)
+		recordTime, _ := r[timefield].(string)
+		if sysId != "" {
+			snow.changes.put(sysId, recordTime)
+		}
+	}
+}
+
+func isCreation(record map[string]interface{}, timefield string) bool {
+	if modCount, ok := record["sys_mod_count"]; ok {
+		return fmt.Sprint(modCount) == "0"
+	}
+
+	created, ok := record["sys_created_on"]
+	return ok && created == record[timefield]
+}
@@ -0,0 +1,237 @@
+package snow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OAuth2 of the instance, see oauthAuth
+	clientIdKey     = "ClientId"
+	clientSecretKey = "ClientSecret"
+	tokenURLKey     = "TokenURL"
+	refreshTokenKey = "RefreshToken"
+	// The token endpoint of the instances, relative to ServerURL
+	defaultTokenPath = "/oauth_token.do"
+	// Tokens are renewed this long before they expire
+	tokenExpiryMargin = 60 * time.Second
+)
+
+// authenticator authorizes the requests of the reader with a credential
+type authenticator interface {
+	// authorize sets the Authorization header of req for cred
+	authorize(req *http.Request, cred credential) error
+
+	// reject drops what is cached for cred after the instance rejected it,
+	// returns true if anything was dropped, so the request is worth sending
+	// again
+	reject(cred credential) bool
+}
+
+// basicAuth sends the username and the password of the credential with
+// every request
+type basicAuth struct{}
+
+func (basicAuth) authorize(req *http.Request, cred credential) error {
+	req.SetBasicAuth(cred.username, cred.password)
+	return nil
+}
+
+func (basicAuth) reject(cred credential) bool {
+	return false
+}
+
+// newAuthenticator returns an oauthAuth if ClientId is set, basicAuth
+// otherwise
+func newAuthenticator(config base.BaseConfig, client *http.Client) (authenticator, error) {
+	if config[clientIdKey] == "" {
+		if config[clientSecretKey] != "" || config[refreshTokenKey] != "" {
+			return nil, errors.New(fmt.Sprintf("%s is required by %s and %s", clientIdKey, clientSecretKey, refreshTokenKey))
+		}
+		return basicAuth{}, nil
+	}
+	return newOAuthAuth(config, client)
+}
+
+type oauthToken struct {
+	accessToken  string
+	refreshToken string
+	expiry       time.Time // zero if the token doesn't expire
+}
+
+func (token *oauthToken) valid(now time.Time) bool {
+	return token.expiry.IsZero() || now.Add(tokenExpiryMargin).Before(token.expiry)
+}
+
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	TokenType    string      `json:"token_type"`
+}
+
+// oauthAuth sends the OAuth2 bearer tokens of the credentials. A token is
+// obtained from TokenURL ("<ServerURL>/oauth_token.do" by default) with the
+// ClientId and the ClientSecret on the first request of a credential, cached
+// until shortly before it expires, then renewed with the refresh token it
+// came with, or obtained again if the refresh token is rejected. The grant
+// of a credential is "refresh_token" for the primary one if RefreshToken is
+// set, "password" if the credential has a password, "client_credentials"
+// otherwise. The tokens are obtained one at a time, so the concurrent
+// requests of an expired credential don't all hit the token endpoint
+type oauthAuth struct {
+	tokenURL     string
+	clientId     string
+	clientSecret string
+	refreshToken string // RefreshToken of the primary credential
+	client       *http.Client
+	tokens       map[string]*oauthToken // credential name indexed
+	lockGuard    sync.Mutex
+}
+
+func newOAuthAuth(config base.BaseConfig, client *http.Client) (*oauthAuth, error) {
+	clientSecret, err := base.ResolveSecret(config[clientSecretKey])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve %s, error=%s", clientSecretKey, err))
+	}
+
+	refreshToken, err := base.ResolveSecret(config[refreshTokenKey])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve %s, error=%s", refreshTokenKey, err))
+	}
+
+	tokenURL := config[tokenURLKey]
+	if tokenURL == "" {
+		tokenURL = strings.TrimRight(config[base.ServerURL], "/") + defaultTokenPath
+	}
+
+	if _, err := url.ParseRequestURI(tokenURL); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid %s=%s, error=%s", tokenURLKey, tokenURL, err))
+	}
+
+	return &oauthAuth{
+		tokenURL:     tokenURL,
+		clientId:     config[clientIdKey],
+		clientSecret: clientSecret,
+		refreshToken: refreshToken,
+		client:       client,
+		tokens:       make(map[string]*oauthToken),
+	}, nil
+}
+
+func (auth *oauthAuth) authorize(req *http.Request, cred credential) error {
+	auth.lockGuard.Lock()
+	defer auth.lockGuard.Unlock()
+
+	token := auth.tokens[cred.name]
+	if token == nil || !token.valid(time.Now()) {
+		var err error
+		token, err = auth.obtain(cred, token)
+		if err != nil {
+			return err
+		}
+		auth.tokens[cred.name] = token
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.accessToken)
+	return nil
+}
+
+func (auth *oauthAuth) reject(cred credential) bool {
+	auth.lockGuard.Lock()
+	defer auth.lockGuard.Unlock()
+
+	if _, ok := auth.tokens[cred.name]; !ok {
+		return false
+	}
+	delete(auth.tokens, cred.name)
+	return true
+}
+
+// obtain renews expired with its refresh token if it has one, otherwise
+// requests a token with the grant of cred
+func (auth *oauthAuth) obtain(cred credential, expired *oauthToken) (*oauthToken, error) {
+	if expired != nil && expired.refreshToken != "" {
+		token, err := auth.requestToken(cred, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {expired.refreshToken},
+		})
+		if err == nil {
+			return token, nil
+		}
+		glog.Warningf("Failed to refresh the token of the %s credential, obtain a new one, error=%s", cred.name, err)
+	}
+	return auth.requestToken(cred, auth.grant(cred))
+}
+
+func (auth *oauthAuth) grant(cred credential) url.Values {
+	switch {
+	case cred.name == base.PrimaryCredential && auth.refreshToken != "":
+		return url.Values{"grant_type": {"refresh_token"}, "refresh_token": {auth.refreshToken}}
+	case cred.password != "":
+		return url.Values{"grant_type": {"password"}, "username": {cred.username}, "password": {cred.password}}
+	}
+	return url.Values{"grant_type": {"client_credentials"}}
+}
+
+// requestToken returns a config error if the token endpoint rejects the
+// client or the grant, retrying doesn't help until the task is fixed
+func (auth *oauthAuth) requestToken(cred credential, form url.Values) (*oauthToken, error) {
+	form.Set("client_id", auth.clientId)
+	form.Set("client_secret", auth.clientSecret)
+
+	req, err := http.NewRequest("POST", auth.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		glog.Errorf("Failed to create token request, error=%s", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := auth.client.Do(req)
+	if err != nil {
+		glog.Errorf("Failed to request token from %s, error=%s", auth.tokenURL, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		glog.Errorf("Failed to read token response from %s, error=%s", auth.tokenURL, err)
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		glog.Errorf("Alert: %s rejected the %s grant of the %s credential, status=%s",
+			auth.tokenURL, form.Get("grant_type"), cred.name, resp.Status)
+		return nil, base.NewConfigError(fmt.Sprintf("%s rejected the %s grant, status=%s", auth.tokenURL, form.Get("grant_type"), resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New(fmt.Sprintf("Failed to request token from %s, status=%s", auth.tokenURL, resp.Status))
+	}
+
+	var result tokenResponse
+	if err := json.Unmarshal(body, &result); err != nil || result.AccessToken == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid token response from %s, error=%v", auth.tokenURL, err))
+	}
+
+	if result.TokenType != "" && !strings.EqualFold(result.TokenType, "bearer") {
+		return nil, errors.New(fmt.Sprintf("Unsupported token_type=%s from %s", result.TokenType, auth.tokenURL))
+	}
+
+	token := &oauthToken{accessToken: result.AccessToken, refreshToken: result.RefreshToken}
+	if seconds, err := result.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	glog.V(1).Infof("Obtained token of the %s credential from %s, expiry=%s", cred.name, auth.tokenURL, token.expiry)
+	return token, nil
+}
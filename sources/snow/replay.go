@@ -0,0 +1,108 @@
+package snow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// Record and replay of the responses, see responseTape
+	recordDirKey = "RecordDir"
+	replayDirKey = "ReplayDir"
+)
+
+var errReplayExhausted = errors.New("no more recorded responses to replay")
+
+type recordedResponse struct {
+	URL  string
+	Body string
+}
+
+// responseTape saves the bodies of the responses to a dir in the order they
+// were received, one "<seq>.json" file each, or feeds them back in the same
+// order instead of requesting the instance. Replaying a dir recorded by a
+// task with the same config, checkpoint included, goes through the same
+// parsing and dedupe, so the issues reported by the users can be reproduced
+// offline
+type responseTape struct {
+	dir       string
+	replay    bool
+	seq       int
+	lockGuard sync.Mutex
+}
+
+// newResponseTape returns nil if neither RecordDir nor ReplayDir is set
+func newResponseTape(config base.BaseConfig) (*responseTape, error) {
+	if config[recordDirKey] != "" && config[replayDirKey] != "" {
+		return nil, fmt.Errorf("%s and %s are exclusive", recordDirKey, replayDirKey)
+	}
+
+	if dir := config[replayDirKey]; dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		return &responseTape{dir: dir, replay: true}, nil
+	}
+
+	if dir := config[recordDirKey]; dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return &responseTape{dir: dir}, nil
+	}
+	return nil, nil
+}
+
+func (tape *responseTape) fileName(seq int) string {
+	return filepath.Join(tape.dir, fmt.Sprintf("%08d.json", seq))
+}
+
+// record saves the body of the response of url
+func (tape *responseTape) record(url string, body []byte) error {
+	tape.lockGuard.Lock()
+	defer tape.lockGuard.Unlock()
+
+	content, err := json.MarshalIndent(&recordedResponse{URL: url, Body: string(body)}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(tape.fileName(tape.seq), content, 0600); err != nil {
+		return err
+	}
+	tape.seq++
+	return nil
+}
+
+// next returns the body of the next recorded response. The URL requested is
+// only compared with the recorded one, a different URL hints at a config or
+// a checkpoint which differs from the recording
+func (tape *responseTape) next(url string) ([]byte, error) {
+	tape.lockGuard.Lock()
+	defer tape.lockGuard.Unlock()
+
+	content, err := ioutil.ReadFile(tape.fileName(tape.seq))
+	if os.IsNotExist(err) {
+		return nil, errReplayExhausted
+	} else if err != nil {
+		return nil, err
+	}
+
+	var resp recordedResponse
+	if err := json.Unmarshal(content, &resp); err != nil {
+		return nil, fmt.Errorf("invalid recorded response %s, error=%s", tape.fileName(tape.seq), err)
+	}
+
+	if resp.URL != url {
+		glog.Warningf("Replay response %d recorded for %s instead of %s", tape.seq, resp.URL, url)
+	}
+	tape.seq++
+	return []byte(resp.Body), nil
+}
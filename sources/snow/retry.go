@@ -0,0 +1,147 @@
+package snow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Retries of the transient request failures, see retryPolicy
+	retryAttemptsKey   = "RetryAttempts"
+	retryBackoffKey    = "RetryBackoff"
+	retryMaxBackoffKey = "RetryMaxBackoff"
+	retryJitterKey     = "RetryJitter"
+
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultRetryJitter     = 0.2
+)
+
+// retryPolicy retries the requests which fail transiently, for e.g. a 502 of
+// the load balancer or a connection reset, so that a blip doesn't fail the
+// collection cycle. A request is attempted at most "RetryAttempts" (3 by
+// default, 1 doesn't retry) times. The delay before the nth retry is
+// "RetryBackoff" ("1s" by default) doubled n-1 times, up to "RetryMaxBackoff"
+// ("30s" by default), randomized by +/- "RetryJitter" (0.2 by default) of it,
+// so that the readers of an instance don't retry in lockstep. The Retry-After
+// of the instance is respected up to RetryMaxBackoff. The zero value doesn't
+// retry
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+}
+
+func parseRetryPolicy(config base.BaseConfig) (retryPolicy, error) {
+	policy := retryPolicy{
+		attempts:   defaultRetryAttempts,
+		backoff:    defaultRetryBackoff,
+		maxBackoff: defaultRetryMaxBackoff,
+		jitter:     defaultRetryJitter,
+	}
+
+	if config[retryAttemptsKey] != "" {
+		attempts, err := strconv.Atoi(config[retryAttemptsKey])
+		if err != nil || attempts <= 0 {
+			return policy, errors.New(fmt.Sprintf("Invalid %s=%s, expect a positive number", retryAttemptsKey, config[retryAttemptsKey]))
+		}
+		policy.attempts = attempts
+	}
+
+	for key, duration := range map[string]*time.Duration{retryBackoffKey: &policy.backoff, retryMaxBackoffKey: &policy.maxBackoff} {
+		if config[key] == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(config[key])
+		if err != nil || d <= 0 {
+			return policy, errors.New(fmt.Sprintf("Invalid %s=%s, expect a positive duration", key, config[key]))
+		}
+		*duration = d
+	}
+
+	if policy.maxBackoff < policy.backoff {
+		return policy, errors.New(fmt.Sprintf("%s=%s is shorter than %s=%s", retryMaxBackoffKey, policy.maxBackoff, retryBackoffKey, policy.backoff))
+	}
+
+	if config[retryJitterKey] != "" {
+		jitter, err := strconv.ParseFloat(config[retryJitterKey], 64)
+		if err != nil || jitter < 0 || jitter > 1 {
+			return policy, errors.New(fmt.Sprintf("Invalid %s=%s, expect a ratio between 0 and 1", retryJitterKey, config[retryJitterKey]))
+		}
+		policy.jitter = jitter
+	}
+	return policy, nil
+}
+
+// delay returns how long to wait before the retry after the attempt, at
+// least retryAfter if the instance asked for it
+func (policy retryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := policy.backoff
+	for i := 1; i < attempt && delay < policy.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if policy.jitter > 0 {
+		delay += time.Duration((2*rand.Float64() - 1) * policy.jitter * float64(delay))
+	}
+
+	if delay < retryAfter {
+		delay = retryAfter
+	}
+
+	if delay > policy.maxBackoff {
+		delay = policy.maxBackoff
+	}
+	return delay
+}
+
+// transientError is a request failure which is worth retrying
+type transientError struct {
+	err        error
+	retryAfter time.Duration // Retry-After of the response, 0 if none
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+func isTransient(err error) bool {
+	var transient *transientError
+	return errors.As(err, &transient)
+}
+
+func retryAfterOf(err error) time.Duration {
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return transient.retryAfter
+	}
+	return 0
+}
+
+// transientStatus returns true for the statuses of the overloaded or the
+// failing instances and their proxies
+func transientStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// parseRetryAfter returns the Retry-After header in seconds as a duration, 0
+// if it is not set or a date
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
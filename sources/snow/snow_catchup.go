@@ -0,0 +1,96 @@
+package snow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// checkLag starts catching up when a full page is collected while
+// NextRecordTime is behind the snow clock by more than CatchUpLag, and stops
+// once a page is not full, the table is caught up then. The handler of
+// OnCatchUp is notified of both
+func (snow *SnowDataReader) checkLag(more bool) {
+	if snow.catchUpLag <= 0 {
+		return
+	}
+
+	var lag time.Duration
+	if more {
+		next, err := time.Parse(timeTemplate, snow.state.NextRecordTime)
+		if err != nil {
+			return
+		}
+
+		now := time.Now()
+		if snow.config[base.ClockSkewCompensate] == "1" {
+			now = now.Add(snow.ClockSkew())
+		}
+		lag = now.UTC().Sub(next)
+	}
+
+	catchingUp := snow.CatchingUp()
+	switch {
+	case !catchingUp && lag > snow.catchUpLag:
+		atomic.StoreInt32(&snow.catchingUp, 1)
+		glog.Warningf("%s/%s lags behind by %s, beyond %s=%s, request %d records per request until it catches up",
+			snow.config[base.ServerURL], snow.config[base.Metric], lag, base.CatchUpLag, snow.catchUpLag, snow.recordCount())
+	case catchingUp && !more:
+		atomic.StoreInt32(&snow.catchingUp, 0)
+		glog.Infof("%s/%s caught up, request %d records per request again",
+			snow.config[base.ServerURL], snow.config[base.Metric], snow.recordCount())
+	default:
+		return
+	}
+
+	if snow.onCatchUp != nil {
+		snow.onCatchUp(&base.CatchUp{
+			Key:         snow.config[base.Key],
+			ServerURL:   snow.config[base.ServerURL],
+			Metric:      snow.config[base.Metric],
+			CatchingUp:  !catchingUp,
+			Lag:         lag,
+			RecordCount: snow.recordCount(),
+		})
+	}
+}
+
+// CatchingUp returns true while the table lags behind by more than
+// CatchUpLag, see checkLag
+func (snow *SnowDataReader) CatchingUp() bool {
+	return atomic.LoadInt32(&snow.catchingUp) == 1
+}
+
+// parseCatchUp returns CatchUpLag, 0 if it is not set, and
+// CatchUpRecordCount, 4 times RecordCount by default
+func parseCatchUp(config base.BaseConfig) (time.Duration, int, error) {
+	if config[base.CatchUpLag] == "" {
+		return 0, 0, nil
+	}
+
+	seconds, err := strconv.Atoi(config[base.CatchUpLag])
+	if err != nil || seconds <= 0 {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid %s=%s, expect positive seconds", base.CatchUpLag, config[base.CatchUpLag]))
+	}
+
+	recordCount, _ := strconv.Atoi(config[recordCountKey])
+	catchUpCount := 4 * recordCount
+	if config[base.CatchUpRecordCount] != "" {
+		catchUpCount, err = strconv.Atoi(config[base.CatchUpRecordCount])
+		if err != nil || catchUpCount <= recordCount {
+			return 0, 0, errors.New(fmt.Sprintf("Invalid %s=%s, expect more than %s=%d",
+				base.CatchUpRecordCount, config[base.CatchUpRecordCount], recordCountKey, recordCount))
+		}
+	}
+	return time.Duration(seconds) * time.Second, catchUpCount, nil
+}
+
+// OnCatchUp calls handler when the reader starts or stops catching up, it
+// shall be called before the reader is started
+func (snow *SnowDataReader) OnCatchUp(handler func(catchUp *base.CatchUp)) {
+	snow.onCatchUp = handler
+}
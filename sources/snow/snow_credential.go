@@ -0,0 +1,160 @@
+package snow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Credential rotation, the secondary credential is tried when the
+	// instance rejects the one in use, see doRequest
+	secondaryUsernameKey = "SecondaryUsername"
+	secondaryPasswordKey = "SecondaryPassword"
+)
+
+type credential struct {
+	name     string
+	username string
+	password string
+}
+
+func (snow *SnowDataReader) authenticator() authenticator {
+	if snow.auth == nil {
+		return basicAuth{}
+	}
+	return snow.auth
+}
+
+// secondaryCredential returns nil if SecondaryPassword is not set
+func secondaryCredential(config base.BaseConfig) *credential {
+	if config[secondaryPasswordKey] == "" {
+		return nil
+	}
+
+	return &credential{
+		name:     base.SecondaryCredential,
+		username: configOr(config, secondaryUsernameKey, config[base.Username]),
+		password: config[secondaryPasswordKey],
+	}
+}
+
+// credentialOf returns the primary credential for index 0, the secondary
+// one for 1
+func (snow *SnowDataReader) credentialOf(index int) credential {
+	if index == 1 && snow.secondary != nil {
+		return *snow.secondary
+	}
+	return credential{name: base.PrimaryCredential, username: snow.config[base.Username], password: snow.config[base.Password]}
+}
+
+// setCredentialHealth switches to the credential of index if it is accepted,
+// the handler of OnCredentialHealth is notified when its health changes
+func (snow *SnowDataReader) setCredentialHealth(index int, accepted bool, status string) {
+	cred := snow.credentialOf(index)
+	if accepted && atomic.SwapInt32(&snow.active, int32(index)) != int32(index) {
+		glog.Warningf("Alert: switched to the %s credential of %s, username=%s", cred.name, snow.config[base.ServerURL], cred.username)
+	}
+
+	rejected := int32(0)
+	if !accepted {
+		rejected = 1
+	}
+	if atomic.SwapInt32(&snow.rejected[index], rejected) == rejected {
+		return
+	}
+
+	if accepted {
+		glog.Infof("The %s credential of %s is accepted again, username=%s", cred.name, snow.config[base.ServerURL], cred.username)
+	} else {
+		glog.Errorf("Alert: the %s credential of %s is rejected, username=%s, status=%s", cred.name, snow.config[base.ServerURL], cred.username, status)
+	}
+
+	if snow.onCredential != nil {
+		snow.onCredential(&base.CredentialHealth{
+			Key:        snow.config[base.Key],
+			ServerURL:  snow.config[base.ServerURL],
+			Username:   cred.username,
+			Credential: cred.name,
+			Active:     snow.credentialOf(int(atomic.LoadInt32(&snow.active))).name,
+			Healthy:    accepted,
+			Status:     status,
+		})
+	}
+}
+
+// OnCredentialHealth calls handler when a credential is rejected or accepted
+// again, it shall be called before the reader is started
+func (snow *SnowDataReader) OnCredentialHealth(handler func(health *base.CredentialHealth)) {
+	snow.onCredential = handler
+}
+
+// ProbeAuth verifies the snow instance is reachable with the credentials in
+// config by reading at most one record of the Metric table. It succeeds if
+// the primary or the secondary credential is accepted, the rejected one is
+// logged since it is expected while the password is being rotated
+// @config: shall contain snow "ServerURL", "Username", "Password" "Metric"
+func ProbeAuth(config base.BaseConfig) error {
+	headers, err := parseRequestHeaders(config)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", headersKey, err)
+		return err
+	}
+
+	client, err := base.NewHTTPClient(config, 30*time.Second)
+	if err != nil {
+		glog.Errorf("Failed to create http client for %s, error=%s", config[base.ServerURL], err)
+		return err
+	}
+
+	creds := []credential{{name: base.PrimaryCredential, username: config[base.Username], password: config[base.Password]}}
+	if secondary := secondaryCredential(config); secondary != nil {
+		creds = append(creds, *secondary)
+	}
+
+	auth, err := newAuthenticator(config, client)
+	if err != nil {
+		glog.Errorf("Failed to create the authenticator of %s, error=%s", config[base.ServerURL], err)
+		return err
+	}
+
+	for _, cred := range creds {
+		if err = probeCredential(config, client, headers, auth, cred); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func probeCredential(config base.BaseConfig, client *http.Client, headers http.Header, auth authenticator, cred credential) error {
+	uri := config[base.ServerURL] + "/" + config[base.Metric] + ".do?JSONv2&sysparm_record_count=1"
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		glog.Errorf("Failed to create request, error=%s", err)
+		return err
+	}
+
+	addHeaders(req, headers)
+	req.Header.Add("Accept", "application/json")
+	if err := auth.authorize(req, cred); err != nil {
+		glog.Errorf("Failed to authorize with the %s credential of %s, error=%s", cred.name, config[base.ServerURL], err)
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		glog.Errorf("Failed to do request for %s, error=%s", uri, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		glog.Errorf("Failed to authenticate to %s with the %s credential, status=%s", uri, cred.name, resp.Status)
+		return errors.New(fmt.Sprintf("Failed to authenticate to %s, status=%s", config[base.ServerURL], resp.Status))
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package snow
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"github.com/golang/glog"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -20,58 +22,286 @@ type collectionState struct {
 	Version         string
 	NextRecordTime  string
 	LastTimeRecords []string
+	// The records being written after NextRecordTime, see markEmitted
+	Emitted *base.BloomFilter `json:",omitempty"`
 }
 
 type SnowDataReader struct {
-	config      base.BaseConfig
-	writer      base.DataWriter
-	checkpoint  base.Checkpointer
-	http_client *http.Client
-	state       collectionState
-	collecting  int32
-	started     int32
+	config       base.BaseConfig
+	writer       base.DataWriter
+	checkpoint   base.Checkpointer
+	http_client  *http.Client
+	writeTimeout time.Duration
+	workingHours *base.WorkingHours
+	state        collectionState
+	domains      []string
+	domain       string                     // domain being collected
+	domainStates map[string]collectionState // domain indexed
+	nextDomain   int                        // index of the domain the next cycle starts from
+	budget       time.Duration              // CycleBudget, 0 if a cycle collects one page
+	paginate     bool                       // Paginate, see nextPage
+	pageBase     string                     // NextRecordTime the offset of the page is relative to
+	pageOffset   int                        // records before the next page, 0 if it is the first one
+	pageLast     string                     // sys_id of the last record of the page before
+	format       base.Format
+	skewLimit    time.Duration
+	clockSkew    int64                  // nano seconds the server clock is ahead of local
+	pageCap      int64                  // records per request enforced by the instance, 0 if unknown
+	catchUpLag   time.Duration          // CatchUpLag, 0 if the reader doesn't catch up
+	catchUpCount int                    // CatchUpRecordCount
+	catchingUp   int32                  // 1 if collecting catchUpCount records per request
+	nodes        *base.EndpointSelector // nil if ServerNodes is not set
+	headers      http.Header            // RequestHeaders with the secrets resolved
+	hints        url.Values             // QueryHints, nil if none
+	orderBy      string                 // QueryOrder as sysparm_query clauses
+	fields       []string               // Fields with the ones the reader relies on, nil if all
+	missing      map[string]bool        // Fields the instance didn't return, see checkFields
+	displayValue string                 // DisplayValue, empty if the raw values are collected
+	quota        *base.RequestQuota     // nil if the requests are not tracked
+	limits       *base.QuotaLimits      // QuotaHourly and QuotaDaily, nil if not set
+	priority     string                 // Priority, which throttles the reader by the quota
+	retry        retryPolicy            // of the transient request failures, see doRequest
+	gaps         []*base.TimeGap
+	onGap        func(gap *base.TimeGap) // nil if the suspected gaps are only logged
+	secondary    *credential             // nil if SecondaryPassword is not set
+	auth         authenticator           // basic auth if nil, see newAuthenticator
+	active       int32                   // index of the credential in use, see credentialOf
+	rejected     [2]int32                // 1 if the credential of the index was rejected
+	onCredential func(health *base.CredentialHealth)
+	onCatchUp    func(catchUp *base.CatchUp)
+	changes      *changeCache    // nil if ChangeAnnotation is not set
+	tape         *responseTape   // nil if the responses are not recorded or replayed
+	ctx          context.Context // of the requests, canceled by Cancel
+	cancel       context.CancelFunc
+	collecting   int32
+	indexing     int32
+	lifecycle    base.Lifecycle
 }
 
 const (
-	timestampFieldKey = "TimestampField"
-	nextRecordTimeKey = "NextRecordTime"
-	recordCountKey    = "RecordCount"
-	timeTemplate      = "2006-01-02 15:04:05"
+	timestampFieldKey  = "TimestampField"
+	nextRecordTimeKey  = "NextRecordTime"
+	endRecordTimeKey   = "EndRecordTime"
+	recordCountKey     = "RecordCount"
+	timeTemplate       = "2006-01-02 15:04:05"
+	defaultDomainField = "sys_domain"
+
+	// Scripted REST API mode, the API shall return the records whose
+	// TimestampField is at or after CursorParam, ordered by it, at most
+	// LimitParam of them, in the array at the "." separated RecordsPath
+	endpointKey        = "Endpoint"
+	cursorParamKey     = "CursorParam"
+	limitParamKey      = "LimitParam"
+	recordsPathKey     = "RecordsPath"
+	defaultCursorParam = "since"
+	defaultLimitParam  = "limit"
+	defaultRecordsPath = "result"
 )
 
 // NewSnowDataReader
 // @config: shall contain snow "ServerURL", "Username", "Password" "Metric", "TimestampField"
-// "NextRecordTime", "RecordCount" key/values
+// "NextRecordTime", "RecordCount" key/values. "Domains", "," separated domain
+// sys_ids, are collected with a checkpoint each, see domainKeyInfo, and
+// "Endpoint" collects from a Scripted REST API instead of the Metric table.
+// The optional configs are documented with the features they tune, for e.g.
+// Paginate in snow_paging.go
 func NewSnowDataReader(
 	config base.BaseConfig, writer base.DataWriter, checkpoint base.Checkpointer) *SnowDataReader {
 	acquiredConfigs := []string{base.ServerURL, base.Username, base.Password,
 		base.Metric, timestampFieldKey, nextRecordTimeKey, recordCountKey}
 	for _, key := range acquiredConfigs {
+		if key == base.Password && config[clientIdKey] != "" {
+			continue
+		}
+
 		if _, ok := config[key]; !ok {
 			glog.Errorf("%s is missing. It is required by Snow data collection", key)
 			return nil
 		}
 	}
 
+	if config[endpointKey] != "" && strings.TrimSpace(config[base.Domains]) != "" {
+		glog.Errorf("%s and %s are exclusive, the Scripted REST API shall filter the domains itself", endpointKey, base.Domains)
+		return nil
+	}
+
+	if config[endpointKey] != "" && config[paginateKey] == "1" {
+		glog.Errorf("%s and %s are exclusive, the Scripted REST APIs don't support sysparm_offset", endpointKey, paginateKey)
+		return nil
+	}
+
+	bound, err := base.ResumeBound(config, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to apply the resume policy, error=%s", err)
+		return nil
+	}
+
+	var gaps []*base.TimeGap
 	state := getCheckpoint(checkpoint, config)
 	if state == nil {
 		return nil
 	}
 
+	if gap := applyResumeBound(config, config[base.Key], state, bound); gap != nil {
+		gaps = append(gaps, gap)
+	}
+
+	var domains []string
+	domainStates := make(map[string]collectionState)
+	for _, domain := range strings.Split(config[base.Domains], ",") {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+
+		domainConfig := domainKeyInfo(config, domain)
+		domainState := getCheckpoint(checkpoint, domainConfig)
+		if domainState == nil {
+			return nil
+		}
+
+		if gap := applyResumeBound(config, domainConfig[base.Key], domainState, bound); gap != nil {
+			gaps = append(gaps, gap)
+		}
+		domains = append(domains, domain)
+		domainStates[domain] = *domainState
+	}
+
+	var workingHours *base.WorkingHours
+	if config[base.ScheduleWindows] != "" {
+		workingHours, err = base.ParseWorkingHours(config[base.ScheduleWindows], config[base.ScheduleTimezone])
+		if err != nil {
+			glog.Errorf("Failed to parse schedule windows=%s, error=%s", config[base.ScheduleWindows], err)
+			return nil
+		}
+	}
+
+	format, err := base.NewFormat(config, base.FormatKV)
+	if err != nil {
+		glog.Errorf("Failed to create the record format, error=%s", err)
+		return nil
+	}
+
+	var nodes *base.EndpointSelector
+	if config[base.ServerNodes] != "" {
+		nodes, err = base.NewEndpointSelector(config[base.ServerNodes], config)
+		if err != nil {
+			glog.Errorf("Failed to select from %s=%s, error=%s", base.ServerNodes, config[base.ServerNodes], err)
+			return nil
+		}
+	}
+
+	headers, err := parseRequestHeaders(config)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", headersKey, err)
+		return nil
+	}
+
+	hints, orderBy, err := parseQueryHints(config)
+	if err != nil {
+		glog.Errorf("Failed to parse the query hints, error=%s", err)
+		return nil
+	}
+
+	fields, err := parseFields(config)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", fieldsKey, err)
+		return nil
+	}
+
+	displayValue, err := parseDisplayValue(config)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", displayValueKey, err)
+		return nil
+	}
+
+	retry, err := parseRetryPolicy(config)
+	if err != nil {
+		glog.Errorf("Failed to parse the retry policy, error=%s", err)
+		return nil
+	}
+
+	catchUpLag, catchUpCount, err := parseCatchUp(config)
+	if err != nil {
+		glog.Errorf("Failed to parse the catch up configs, error=%s", err)
+		return nil
+	}
+
+	limits, err := base.ParseQuotaLimits(config)
+	if err != nil {
+		glog.Errorf("Failed to parse the quota of %s, error=%s", config[base.ServerURL], err)
+		return nil
+	}
+
+	priority, err := base.GetPriority(config)
+	if err != nil {
+		glog.Errorf("Failed to parse the priority, error=%s", err)
+		return nil
+	}
+
+	budget, err := parseCycleBudget(config)
+	if err != nil {
+		glog.Errorf("Failed to parse %s, error=%s", cycleBudgetKey, err)
+		return nil
+	}
+
+	tape, err := newResponseTape(config)
+	if err != nil {
+		glog.Errorf("Failed to record or replay the responses, error=%s", err)
+		return nil
+	}
+
+	client, err := base.NewHTTPClient(config, 120*time.Second)
+	if err != nil {
+		glog.Errorf("Failed to create http client for %s, error=%s", config[base.ServerURL], err)
+		return nil
+	}
+
+	auth, err := newAuthenticator(config, client)
+	if err != nil {
+		glog.Errorf("Failed to create the authenticator of %s, error=%s", config[base.ServerURL], err)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &SnowDataReader{
-		config:      config,
-		writer:      writer,
-		checkpoint:  checkpoint,
-		http_client: &http.Client{Timeout: 120 * time.Second},
-		state:       *state,
-		collecting:  0,
-		started:     0,
+		config:       config,
+		writer:       writer,
+		checkpoint:   checkpoint,
+		http_client:  client,
+		writeTimeout: base.GetWriteTimeout(config),
+		workingHours: workingHours,
+		state:        *state,
+		domains:      domains,
+		domainStates: domainStates,
+		budget:       budget,
+		paginate:     config[paginateKey] == "1",
+		catchUpLag:   catchUpLag,
+		catchUpCount: catchUpCount,
+		format:       format,
+		skewLimit:    base.GetClockSkewThreshold(config),
+		gaps:         gaps,
+		nodes:        nodes,
+		headers:      headers,
+		hints:        hints,
+		orderBy:      orderBy,
+		fields:       fields,
+		displayValue: displayValue,
+		limits:       limits,
+		priority:     priority,
+		retry:        retry,
+		secondary:    secondaryCredential(config),
+		auth:         auth,
+		changes:      newChangeCacheOf(config),
+		tape:         tape,
+		ctx:          ctx,
+		cancel:       cancel,
+		collecting:   0,
 	}
 }
 
 func (snow *SnowDataReader) Start() {
-	if !atomic.CompareAndSwapInt32(&snow.started, 0, 1) {
-		glog.Infof("SnowDataReader already started")
+	if snow.lifecycle.Start("SnowDataReader") != nil {
 		return
 	}
 
@@ -81,8 +311,7 @@ func (snow *SnowDataReader) Start() {
 }
 
 func (snow *SnowDataReader) Stop() {
-	if !atomic.CompareAndSwapInt32(&snow.started, 1, 0) {
-		glog.Infof("SnowDataReader already stopped")
+	if snow.lifecycle.Stop("SnowDataReader") != nil {
 		return
 	}
 
@@ -91,49 +320,266 @@ func (snow *SnowDataReader) Stop() {
 	glog.Infof("SnowDataReader stopped...")
 }
 
+func (snow *SnowDataReader) Status() string {
+	return snow.lifecycle.Status()
+}
+
+// Cancel aborts the request in progress, if any, and fails the requests
+// after it. The collection cycle in progress fails without checkpointing
+func (snow *SnowDataReader) Cancel() {
+	if snow.cancel != nil {
+		snow.cancel()
+	}
+}
+
+func (snow *SnowDataReader) requestContext() context.Context {
+	if snow.ctx == nil {
+		return context.Background()
+	}
+	return snow.ctx
+}
+
 func (snow *SnowDataReader) getURL() string {
-	nextRecordTime := snow.getNextRecordTime()
+	recordCount := snow.config[recordCountKey]
+	if atomic.LoadInt64(&snow.pageCap) > 0 || snow.CatchingUp() {
+		recordCount = strconv.Itoa(snow.recordCount())
+	}
+
+	if snow.pageOffset > 0 {
+		// The last record of the page before comes first, see dropOverlap
+		return snow.queryURL(">=", snow.pageBase, recordCount) + "&sysparm_offset=" + strconv.Itoa(snow.pageOffset-1)
+	}
+	return snow.queryURL(">=", snow.getNextRecordTime(), recordCount)
+}
+
+// queryURL returns the URL of the records whose timestamp compares with
+// recordTime by op, ordered by the timestamp. Scripted REST APIs only
+// support ">="
+func (snow *SnowDataReader) queryURL(op, recordTime, recordCount string) string {
+	return snow.queryWindowURL(op, recordTime, snow.config[endRecordTimeKey], recordCount)
+}
+
+// queryWindowURL is queryURL of the records changed before the time before
+// too, which doesn't apply to the Scripted REST APIs
+func (snow *SnowDataReader) queryWindowURL(op, recordTime, before, recordCount string) string {
+	if endpoint := snow.config[endpointKey]; endpoint != "" {
+		params := url.Values{}
+		params.Set(configOr(snow.config, cursorParamKey, defaultCursorParam), strings.Replace(recordTime, "+", " ", 1))
+		params.Set(configOr(snow.config, limitParamKey, defaultLimitParam), recordCount)
+		for name, values := range snow.hints {
+			params[name] = values
+		}
+
+		sep := "?"
+		if strings.Contains(endpoint, "?") {
+			sep = "&"
+		}
+		return strings.TrimRight(snow.serverURL(), "/") + "/" + strings.TrimLeft(endpoint, "/") + sep + params.Encode()
+	}
+
 	var buffer bytes.Buffer
-	buffer.WriteString(snow.config[base.ServerURL])
+	buffer.WriteString(snow.serverURL())
 	buffer.WriteString("/")
 	buffer.WriteString(snow.config[base.Metric])
 	buffer.WriteString(".do?JSONv2&sysparm_query=")
 	buffer.WriteString(snow.config[timestampFieldKey])
-	buffer.WriteString(">=")
-	buffer.WriteString(nextRecordTime)
+	buffer.WriteString(op)
+	buffer.WriteString(recordTime)
+	if before != "" {
+		buffer.WriteString("^")
+		buffer.WriteString(snow.config[timestampFieldKey])
+		buffer.WriteString("<")
+		buffer.WriteString(strings.Replace(before, " ", "+", 1))
+	}
+	if snow.domain != "" {
+		buffer.WriteString("^")
+		buffer.WriteString(snow.domainField())
+		buffer.WriteString("=")
+		buffer.WriteString(snow.domain)
+	}
 	buffer.WriteString("^ORDERBY")
 	buffer.WriteString(snow.config[timestampFieldKey])
-	buffer.WriteString("&sysparm_record_count=" + snow.config[recordCountKey])
+	buffer.WriteString(snow.orderBy)
+	buffer.WriteString("&sysparm_record_count=" + recordCount)
+	if len(snow.fields) > 0 {
+		buffer.WriteString("&sysparm_fields=")
+		buffer.WriteString(url.QueryEscape(strings.Join(snow.fields, ",")))
+	}
+	if snow.displayValue != "" {
+		// The raw values are kept for the checkpoint either way
+		buffer.WriteString("&sysparm_display_value=" + displayValueAll)
+	}
+	if len(snow.hints) > 0 {
+		buffer.WriteString("&")
+		buffer.WriteString(snow.hints.Encode())
+	}
 	return buffer.String()
 }
 
+// serverURL returns the healthiest of ServerNodes, ServerURL if it is not set
+func (snow *SnowDataReader) serverURL() string {
+	if snow.nodes == nil {
+		return snow.config[base.ServerURL]
+	}
+	return snow.nodes.Select()
+}
+
+func (snow *SnowDataReader) observeNode(url string, requestStart time.Time, failed bool) {
+	if snow.nodes != nil {
+		snow.nodes.Observe(url, time.Since(requestStart), failed)
+	}
+}
+
+// recordsOf returns the records in the response, at RecordsPath for the
+// Scripted REST APIs. The records of the tables are shaped by DisplayValue
+// and Fields
+func (snow *SnowDataReader) recordsOf(jobj map[string]interface{}) ([]interface{}, bool) {
+	if snow.config[endpointKey] == "" {
+		records, ok := jobj["records"].([]interface{})
+		if ok {
+			snow.applyDisplayValues(records)
+			snow.checkFields(records)
+		}
+		return records, ok
+	}
+
+	path := strings.Split(configOr(snow.config, recordsPathKey, defaultRecordsPath), ".")
+	for i, field := range path {
+		if i == len(path)-1 {
+			records, ok := jobj[field].([]interface{})
+			return records, ok
+		}
+
+		if jobj, _ = jobj[field].(map[string]interface{}); jobj == nil {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func configOr(config base.BaseConfig, key, defaultValue string) string {
+	if config[key] != "" {
+		return config[key]
+	}
+	return defaultValue
+}
+
+// recordCount returns RecordCount, CatchUpRecordCount while catching up, or
+// the page cap of the instance if it is smaller
+func (snow *SnowDataReader) recordCount() int {
+	recordCount, _ := strconv.Atoi(snow.config[recordCountKey])
+	if snow.CatchingUp() {
+		recordCount = snow.catchUpCount
+	}
+	if pageCap := int(atomic.LoadInt64(&snow.pageCap)); pageCap > 0 && pageCap < recordCount {
+		return pageCap
+	}
+	return recordCount
+}
+
 func (snow *SnowDataReader) ReadData() ([]byte, error) {
 	if !atomic.CompareAndSwapInt32(&snow.collecting, 0, 1) {
 		glog.Infof("Last data collection for %s has not been done", snow.getURL())
-		return nil, nil
+		return nil, base.ErrSkipped
 	}
 	defer atomic.StoreInt32(&snow.collecting, 0)
 
-	req, err := http.NewRequest("GET", snow.getURL(), nil)
-	if err != nil {
-		glog.Errorf("Failed to create request, error=%s", err)
-		return nil, err
+	return snow.readData()
+}
+
+// readData shall be called with the collecting guard held
+func (snow *SnowDataReader) readData() ([]byte, error) {
+	return snow.doRequest(snow.getURL())
+}
+
+// doRequest requests url, the transient failures are retried by the retry
+// policy until the attempts run out or the reader is canceled
+func (snow *SnowDataReader) doRequest(url string) ([]byte, error) {
+	if snow.tape != nil && snow.tape.replay {
+		return snow.tape.next(url)
 	}
 
-	req.Header.Add("Accept-Encoding", "gzip")
-	req.Header.Add("Accept", "application/json")
-	req.SetBasicAuth(snow.config[base.Username], snow.config[base.Password])
+	for attempt := 1; ; attempt++ {
+		body, err := snow.doRequestOnce(url)
+		if err == nil || !isTransient(err) || attempt >= snow.retry.attempts {
+			return body, err
+		}
 
-	resp, err := snow.http_client.Do(req)
-	if err != nil {
-		glog.Errorf("Failed to do request for %s, error=%s", snow.getURL(), err)
-		return nil, err
+		delay := snow.retry.delay(attempt, retryAfterOf(err))
+		glog.Warningf("Request for %s failed, retry %d/%d in %s, error=%s",
+			url, attempt, snow.retry.attempts-1, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-snow.requestContext().Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// doRequestOnce requests url with the credential in use. When it is
+// rejected, the other credential is tried and used from then on if it is
+// accepted
+func (snow *SnowDataReader) doRequestOnce(url string) ([]byte, error) {
+	count := 1
+	if snow.secondary != nil {
+		count = 2
+	}
+
+	var resp *http.Response
+	var rejected []int
+	first := int(atomic.LoadInt32(&snow.active))
+	for i := 0; i < count; i++ {
+		index := (first + i) % count
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		var err error
+		resp, err = snow.send(url, snow.credentialOf(index))
+		if err != nil {
+			if snow.requestContext().Err() != nil || base.IsConfigError(err) {
+				return nil, err
+			}
+			// For e.g. a connection reset or a timeout
+			return nil, &transientError{err: err}
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			snow.setCredentialHealth(index, true, resp.Status)
+			break
+		}
+		rejected = append(rejected, index)
 	}
 	defer resp.Body.Close()
 
+	// Notified once the credential in use is settled
+	for _, index := range rejected {
+		snow.setCredentialHealth(index, false, http.StatusText(http.StatusUnauthorized))
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		// Retrying doesn't help until the task or the ACL is fixed
+		glog.Errorf("Failed to do request for %s, status=%s", url, resp.Status)
+		return nil, base.NewConfigError(fmt.Sprintf("%s/%s returned status=%s",
+			snow.config[base.ServerURL], snow.config[base.Metric], resp.Status))
+	}
+
+	if transientStatus(resp.StatusCode) {
+		glog.Errorf("Failed to do request for %s, status=%s", url, resp.Status)
+		return nil, &transientError{
+			err: errors.New(fmt.Sprintf("%s/%s returned status=%s",
+				snow.config[base.ServerURL], snow.config[base.Metric], resp.Status)),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
 	reader, err := gzip.NewReader(resp.Body)
 	if err != nil {
-		glog.Errorf("Failed to create gzip reader for %s, error=%s", snow.getURL(), err)
+		glog.Errorf("Failed to create gzip reader for %s, error=%s", url, err)
 		return nil, err
 	}
 	defer reader.Close()
@@ -141,53 +587,314 @@ func (snow *SnowDataReader) ReadData() ([]byte, error) {
 	body, err := ioutil.ReadAll(reader)
 	if err != nil {
 		glog.Errorf("Failed to read uncompressed data, error=%s", err)
-		return nil, err
+		// The connection is broken in the middle of the response
+		return nil, &transientError{err: err}
+	}
+
+	if snow.tape != nil {
+		if err := snow.tape.record(url, body); err != nil {
+			glog.Errorf("Failed to record the response of %s, error=%s", url, err)
+		}
 	}
 	return body, nil
 }
 
+// send requests url with cred. A request rejected with a cached token, for
+// e.g. revoked before it expires, is sent again once with a new token
+func (snow *SnowDataReader) send(url string, cred credential) (*http.Response, error) {
+	auth := snow.authenticator()
+	resp, err := snow.sendOnce(url, cred, auth)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && auth.reject(cred) {
+		resp.Body.Close()
+		resp, err = snow.sendOnce(url, cred, auth)
+	}
+	return resp, err
+}
+
+func (snow *SnowDataReader) sendOnce(url string, cred credential, auth authenticator) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(snow.requestContext(), "GET", url, nil)
+	if err != nil {
+		glog.Errorf("Failed to create request, error=%s", err)
+		return nil, err
+	}
+
+	addHeaders(req, snow.headers)
+	req.Header.Add("Accept-Encoding", "gzip")
+	req.Header.Add("Accept", "application/json")
+	if err := auth.authorize(req, cred); err != nil {
+		glog.Errorf("Failed to authorize request for %s with the %s credential, error=%s", url, cred.name, err)
+		return nil, err
+	}
+
+	requestStart := time.Now()
+	if snow.quota != nil {
+		snow.quota.Record(snow.config[base.ServerURL], requestStart)
+	}
+
+	resp, err := snow.http_client.Do(req)
+	if err != nil {
+		snow.observeNode(url, requestStart, true)
+		glog.Errorf("Failed to do request for %s, error=%s", url, err)
+		return nil, err
+	}
+	snow.observeNode(url, requestStart, resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests)
+	snow.checkClockSkew(resp.Header.Get("Date"), requestStart, time.Now())
+	return resp, nil
+}
+
+// checkClockSkew warns when the skew between the snow and the local clock
+// crosses ClockSkewThreshold. Skew only matters where the local clock is
+// compared with record timestamps, for e.g. the "skip" schedule catch-up
+func (snow *SnowDataReader) checkClockSkew(date string, requestStart, responseEnd time.Time) {
+	if date == "" {
+		return
+	}
+
+	skew, err := base.ClockSkew(date, requestStart, responseEnd)
+	if err != nil {
+		glog.V(1).Infof("Failed to parse Date header=%s from %s, error=%s", date, snow.config[base.ServerURL], err)
+		return
+	}
+
+	lastSkew := time.Duration(atomic.SwapInt64(&snow.clockSkew, int64(skew)))
+	exceeded := skew > snow.skewLimit || skew < -snow.skewLimit
+	lastExceeded := lastSkew > snow.skewLimit || lastSkew < -snow.skewLimit
+	if exceeded && !lastExceeded {
+		glog.Warningf("Clock skew of %s is %s against local clock, beyond threshold=%s, compensate=%v",
+			snow.config[base.ServerURL], skew, snow.skewLimit, snow.config[base.ClockSkewCompensate] == "1")
+	} else if !exceeded && lastExceeded {
+		glog.Infof("Clock skew of %s is back to %s", snow.config[base.ServerURL], skew)
+	}
+}
+
+// ClockSkew returns how far the snow clock was ahead of the local clock at
+// the last request
+func (snow *SnowDataReader) ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&snow.clockSkew))
+}
+
 func (snow *SnowDataReader) IndexData() error {
-	data, err := snow.ReadData()
+	var deadline time.Time
+	if snow.budget > 0 {
+		deadline = time.Now().Add(snow.budget)
+	}
+
+	if len(snow.domains) == 0 {
+		return snow.indexData(deadline)
+	}
+
+	if !atomic.CompareAndSwapInt32(&snow.indexing, 0, 1) {
+		glog.Infof("Last data collection for domains of %s has not been done", snow.config[base.Metric])
+		return base.ErrSkipped
+	}
+	defer atomic.StoreInt32(&snow.indexing, 0)
+
+	// Each domain progresses independently, a failed domain doesn't hold
+	// back the others. The domains left when the budget is spent are
+	// collected first next cycle
+	var lastErr error
+	skipped, visited := 0, 0
+	for visited < len(snow.domains) {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			glog.Warningf("Cycle budget=%s of %s is spent, collect the other %d domains next cycle",
+				snow.budget, snow.config[base.Metric], len(snow.domains)-visited)
+			break
+		}
+
+		domain := snow.domains[(snow.nextDomain+visited)%len(snow.domains)]
+		visited++
+		snow.domain = domain
+		snow.state = snow.domainStates[domain]
+		if err := snow.indexData(deadline); err == base.ErrSkipped {
+			skipped++
+		} else if err != nil {
+			glog.Errorf("Failed to collect domain=%s of %s, error=%s", domain, snow.config[base.Metric], err)
+			lastErr = err
+		}
+		snow.domainStates[domain] = snow.state
+	}
+	snow.domain = ""
+	snow.nextDomain = (snow.nextDomain + visited) % len(snow.domains)
+
+	if lastErr == nil && skipped == visited {
+		return base.ErrSkipped
+	}
+	return lastErr
+}
+
+// indexData collects a page of the records changed since the checkpoint.
+// Before the deadline, if any, or with Paginate, it keeps collecting the next
+// pages while the pages are full. Each page is checkpointed once written, so
+// when the budget is spent or the reader crashes, the next cycle continues
+// from the last page, and a giant table doesn't hold the collector for hours
+func (snow *SnowDataReader) indexData(deadline time.Time) error {
+	// The guard covers the state, which the schedule window check and the
+	// checkpoint update modify, besides the request
+	if !atomic.CompareAndSwapInt32(&snow.collecting, 0, 1) {
+		glog.Infof("Last data collection for %s has not been done", snow.getURL())
+		return base.ErrSkipped
+	}
+	defer atomic.StoreInt32(&snow.collecting, 0)
+
+	if !snow.inScheduleWindow() || !snow.allowedByQuota() {
+		return base.ErrSkipped
+	}
+
+	// Every cycle pages from its checkpoint
+	defer snow.nextPage(nil, false)
+	for pages := 1; ; pages++ {
+		more, err := snow.indexPage()
+		if err == nil {
+			snow.checkLag(more)
+		}
+
+		if err != nil || !more || (deadline.IsZero() && !snow.paginate) {
+			return err
+		}
+
+		if err := snow.requestContext().Err(); err != nil {
+			return err
+		}
+
+		if !snow.allowedByQuota() {
+			glog.Warningf("Quota of %s runs out after %d pages of %s, continue from %s when it is back",
+				snow.config[base.ServerURL], pages, snow.config[base.Metric], snow.state.NextRecordTime)
+			return nil
+		}
+
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			glog.Warningf("Cycle budget=%s of %s is spent after %d pages, continue from %s next cycle",
+				snow.budget, snow.config[base.Metric], pages, snow.state.NextRecordTime)
+			return nil
+		}
+	}
+}
+
+// indexPage collects a page, and returns true if the page was full and
+// advanced the checkpoint, or the next page is requested by offset, more
+// records are likely pending then
+func (snow *SnowDataReader) indexPage() (bool, error) {
+	if snow.pageOffset == 0 {
+		snow.pageBase = snow.getNextRecordTime()
+	}
+
+	requestStart := time.Now()
+	data, err := snow.readData()
 	if data == nil || err != nil {
-		return err
+		return false, err
 	}
 
 	jobj, err := base.ToJsonObject(data)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if records, ok := jobj["records"].([]interface{}); ok {
+	if records, ok := snow.recordsOf(jobj); ok {
+		snow.detectPageCap(records, requestStart)
+		page := records
+		if snow.pageOffset == 0 {
+			records = snow.detectGap(records)
+		} else if records, ok = snow.dropOverlap(records); !ok {
+			return true, nil
+		}
+		full := len(page) >= snow.recordCount()
 		metaInfo := map[string]string{
-			base.ServerURL: snow.config[base.ServerURL],
-			base.Username:  snow.config[base.Username],
-			base.Metric:    snow.config[base.Metric],
+			base.ServerURL:     snow.config[base.ServerURL],
+			base.Username:      snow.config[base.Username],
+			base.Metric:        snow.config[base.Metric],
+			base.Serialization: snow.format.Name(),
 		}
-		records, refreshed := snow.removeCollectedRecords(records)
-		allData := base.NewData(metaInfo, make([][]byte, 1))
-		var record []string
-		for i := 0; i < len(records); i++ {
-			record = record[:0]
-			for k, v := range records[i].(map[string]interface{}) {
-				record = append(record, fmt.Sprintf(`%s="%s"`, k, v))
+		if snow.domain != "" {
+			metaInfo[base.Domain] = snow.domain
+		}
+		checkpointed := snow.state
+		fetched, refreshed := snow.removeCollectedRecords(records)
+		// The suppressed records are still checkpointed
+		records = snow.suppressEmitted(fetched)
+		snow.annotateChanges(records)
+		if snow.config[base.DedupeFilter] == "1" && len(records) > 0 {
+			if err = snow.markEmitted(checkpointed, records); err != nil {
+				return false, err
 			}
+		}
+
+		allData := base.NewData(metaInfo, make([][]byte, 0, 1))
+		for i := 0; i < len(records); i++ {
 			// FIXME line breaker
-			allData.RawData = append(allData.RawData, []byte(strings.Join(record, ",")))
-			err := snow.writer.WriteData(allData)
+			raw, err := snow.format.Encode(records[i].(map[string]interface{}))
+			if err != nil {
+				glog.Errorf("Failed to encode record in format=%s, error=%s", snow.format.Name(), err)
+				return false, err
+			}
+			allData.RawData = append(allData.RawData, raw)
+			// On write timeout, fail this cycle without checkpointing, the
+			// next cycle re-collects from the last checkpoint
+			err = base.WriteDataTimeout(snow.writer, allData, snow.writeTimeout)
 			if err != nil {
-				return err
+				if snow.config[base.DedupeFilter] == "1" {
+					// The records not written shall not be suppressed
+					if rerr := snow.markEmitted(checkpointed, records[:i]); rerr != nil {
+						// At least the next cycles write them, the checkpoint
+						// suppresses them after a restart though
+						glog.Errorf("Alert: failed to roll back the emitted records of %s/%s, error=%s",
+							snow.config[base.ServerURL], snow.config[base.Metric], rerr)
+						snow.state.Emitted = checkpointed.Emitted
+					}
+				}
+				return false, err
 			}
 			allData.RawData = allData.RawData[:0]
 		}
 
-		if len(records) > 0 {
-			return snow.writeCheckpoint(records, refreshed)
+		if len(fetched) > 0 {
+			if err = snow.writeCheckpoint(fetched, refreshed); err != nil {
+				return false, err
+			}
+			snow.state.Emitted = nil
+			snow.rememberChanges(records)
 		}
+
+		if snow.paginate {
+			snow.nextPage(page, full)
+			return full && (len(fetched) > 0 || snow.pageOffset > 0), nil
+		}
+		return full && len(fetched) > 0, nil
 	} else if errDesc, ok := jobj["error"]; ok {
 		glog.Errorf("Failed to get data from %s, error=%s", snow.getURL(), errDesc)
-		return errors.New(fmt.Sprintf("%+v", errDesc))
+		return false, errors.New(fmt.Sprintf("%+v", errDesc))
 	}
-	return nil
+	return false, nil
+}
+
+// inScheduleWindow returns false if now is out of the working hours of
+// ScheduleWindows in ScheduleTimezone, see base.ParseWorkingHours. When
+// ScheduleCatchUp is "skip", the changes made before the current window
+// opened are not collected
+func (snow *SnowDataReader) inScheduleWindow() bool {
+	if snow.workingHours == nil {
+		return true
+	}
+
+	start, ok := snow.workingHours.WindowStart(time.Now())
+	if !ok {
+		return false
+	}
+
+	if snow.config[base.ScheduleCatchUp] != base.CatchUpSkip {
+		return true
+	}
+
+	// Snow timestamps are in UTC and by the snow clock
+	if snow.config[base.ClockSkewCompensate] == "1" {
+		start = start.Add(snow.ClockSkew())
+	}
+	windowStart := start.UTC().Format(timeTemplate)
+	if strings.Replace(snow.state.NextRecordTime, "+", " ", 1) < windowStart {
+		glog.Warningf("Skip the changes before schedule window started at %s for %s", windowStart, snow.config[base.Metric])
+		snow.state.NextRecordTime = windowStart
+		snow.state.LastTimeRecords = snow.state.LastTimeRecords[:0]
+	}
+	return true
 }
 
 func (snow *SnowDataReader) doRemoveRecords(records []interface{}, lastTimeRecords map[string]bool,
@@ -237,7 +944,7 @@ func (snow *SnowDataReader) removeCollectedRecords(records []interface{}) ([]int
 	recordsToBeIndexed := snow.doRemoveRecords(records, lastTimeRecords, lastRecordTime)
 
 	refreshed := false
-	recordCount, _ := strconv.Atoi(snow.config[recordCountKey])
+	recordCount := snow.recordCount()
 
 	if len(records) == recordCount {
 		firstRecord := records[0].(map[string]interface{})
@@ -265,6 +972,13 @@ func (snow *SnowDataReader) removeCollectedRecords(records []interface{}) ([]int
 	return recordsToBeIndexed, refreshed
 }
 
+func (snow *SnowDataReader) checkpointKeyInfo() base.BaseConfig {
+	if snow.domain != "" {
+		return domainKeyInfo(snow.config, snow.domain)
+	}
+	return snow.config
+}
+
 func (snow *SnowDataReader) writeCheckpoint(records []interface{}, refreshed bool) error {
 	if len(records) == 0 {
 		return nil
@@ -295,7 +1009,7 @@ func (snow *SnowDataReader) writeCheckpoint(records []interface{}, refreshed boo
 		return err
 	}
 
-	err = snow.checkpoint.WriteCheckpoint(snow.config, data)
+	err = snow.checkpoint.WriteCheckpoint(snow.checkpointKeyInfo(), data)
 	if err != nil {
 		return err
 	}
@@ -310,6 +1024,73 @@ func (snow *SnowDataReader) getNextRecordTime() string {
 	return strings.Replace(snow.state.NextRecordTime, " ", "+", 1)
 }
 
+// domainField returns DomainField, the domain field of the Metric table
+func (snow *SnowDataReader) domainField() string {
+	if snow.config[base.DomainField] != "" {
+		return snow.config[base.DomainField]
+	}
+	return defaultDomainField
+}
+
+// domainKeyInfo returns the checkpoint key info of the sub-checkpoint of domain
+func domainKeyInfo(config base.BaseConfig, domain string) base.BaseConfig {
+	keyInfo := make(base.BaseConfig, len(config))
+	for k, v := range config {
+		keyInfo[k] = v
+	}
+
+	if keyInfo[base.Key] != "" {
+		keyInfo[base.Key] += "_" + domain
+	}
+
+	if keyInfo[base.CheckpointKey] != "" {
+		keyInfo[base.CheckpointKey] += "_" + domain
+	}
+	return keyInfo
+}
+
+// EffectiveConfig returns the config of the reader completed with the
+// defaults in use, for e.g. Serialization and DomainField
+func (snow *SnowDataReader) EffectiveConfig() base.BaseConfig {
+	config := make(base.BaseConfig, len(snow.config)+8)
+	for k, v := range snow.config {
+		config[k] = v
+	}
+
+	config[base.Serialization] = snow.format.Name()
+	config[base.ClockSkewThreshold] = strconv.Itoa(int(snow.skewLimit / time.Second))
+	if len(snow.domains) > 0 {
+		config[base.DomainField] = snow.domainField()
+	}
+
+	if config[endpointKey] != "" {
+		config[cursorParamKey] = configOr(config, cursorParamKey, defaultCursorParam)
+		config[limitParamKey] = configOr(config, limitParamKey, defaultLimitParam)
+		config[recordsPathKey] = configOr(config, recordsPathKey, defaultRecordsPath)
+	}
+
+	if snow.catchUpLag > 0 {
+		config[base.CatchUpRecordCount] = strconv.Itoa(snow.catchUpCount)
+	}
+
+	if len(snow.fields) > 0 {
+		config[fieldsKey] = strings.Join(snow.fields, ",")
+	}
+
+	if snow.retry.attempts > 0 {
+		config[retryAttemptsKey] = strconv.Itoa(snow.retry.attempts)
+		config[retryBackoffKey] = snow.retry.backoff.String()
+		config[retryMaxBackoffKey] = snow.retry.maxBackoff.String()
+		config[retryJitterKey] = strconv.FormatFloat(snow.retry.jitter, 'f', -1, 64)
+	}
+
+	if snow.secondary != nil {
+		config[secondaryUsernameKey] = snow.secondary.username
+		config["ActiveCredential"] = snow.credentialOf(int(atomic.LoadInt32(&snow.active))).name
+	}
+	return config
+}
+
 func getCheckpoint(checkpoint base.Checkpointer, config base.BaseConfig) *collectionState {
 	glog.Infof("State is not in cache, reload from checkpoint")
 	data, err := checkpoint.GetCheckpoint(config)
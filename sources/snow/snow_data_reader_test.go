@@ -2,9 +2,18 @@ package snow
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/chenziliang/descartes/base"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -51,3 +60,1279 @@ func TestSnowDataReader(t *testing.T) {
 	writer.Stop()
 	time.Sleep(time.Second)
 }
+
+func TestSnowDomainSeparation(t *testing.T) {
+	config := base.BaseConfig{
+		base.ServerURL:     "https://msp.service-now.com",
+		base.Metric:        "incident",
+		base.Key:           "/snow/incident",
+		base.CheckpointKey: "incident",
+		timestampFieldKey:  "sys_updated_on",
+		recordCountKey:     "5",
+	}
+
+	snow := &SnowDataReader{
+		config: config,
+		state:  collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		domain: "c90d4b084a362312013398f051272c0d",
+	}
+
+	expected := "https://msp.service-now.com/incident.do?JSONv2&sysparm_query=sys_updated_on>=2015-06-01+08:00:00" +
+		"^sys_domain=c90d4b084a362312013398f051272c0d^ORDERBYsys_updated_on&sysparm_record_count=5"
+	if url := snow.getURL(); url != expected {
+		t.Errorf("Expect url=%s, got=%s", expected, url)
+	}
+
+	keyInfo := domainKeyInfo(config, snow.domain)
+	if keyInfo[base.Key] != "/snow/incident_"+snow.domain || keyInfo[base.CheckpointKey] != "incident_"+snow.domain {
+		t.Errorf("Expect per domain checkpoint keys, got=%s", keyInfo)
+	}
+
+	if config[base.Key] != "/snow/incident" {
+		t.Errorf("Task config should not be changed, got=%s", config[base.Key])
+	}
+}
+
+func TestSnowPageCap(t *testing.T) {
+	// The instance returns at most 3 records per request
+	records := []string{"2015-06-01 08:00:00", "2015-06-01 08:00:01", "2015-06-01 08:00:02", "2015-06-01 08:00:03"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var res []string
+		for _, ts := range records {
+			if strings.Contains(r.URL.RawQuery, ">"+strings.Replace(ts, " ", "+", 1)) {
+				res = nil
+				continue
+			}
+			res = append(res, fmt.Sprintf(`{"sys_id":"%s","sys_updated_on":"%s"}`, ts[len(ts)-2:], ts))
+		}
+		if len(res) > 3 {
+			res = res[:3]
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `{"records":[%s]}`, strings.Join(res, ","))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	snow := &SnowDataReader{
+		config: base.BaseConfig{
+			base.ServerURL:    server.URL,
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+			recordCountKey:    "5",
+		},
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: records[0]},
+	}
+
+	body, err := snow.readData()
+	if err != nil {
+		t.Fatalf("Failed to read data, error=%s", err)
+	}
+	jobj, _ := base.ToJsonObject(body)
+	page, _ := jobj["records"].([]interface{})
+
+	// The records which changed later are not truncated
+	snow.detectPageCap(page, time.Date(2015, 6, 1, 8, 0, 2, 0, time.UTC))
+	if snow.recordCount() != 5 {
+		t.Errorf("Expect RecordCount=5 kept, got %d", snow.recordCount())
+	}
+
+	snow.detectPageCap(page, time.Now())
+	if snow.recordCount() != 3 || !strings.HasSuffix(snow.getURL(), "sysparm_record_count=3") {
+		t.Errorf("Expect records per request capped to 3, got %d, url=%s", snow.recordCount(), snow.getURL())
+	}
+}
+
+func TestSnowCatchUp(t *testing.T) {
+	config := base.BaseConfig{
+		base.ServerURL:    "https://acme.service-now.com",
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "100",
+		base.CatchUpLag:   "3600",
+	}
+
+	lag, count, err := parseCatchUp(config)
+	if err != nil || lag != time.Hour || count != 400 {
+		t.Fatalf("Expect CatchUpRecordCount defaults to 4 times RecordCount, got lag=%s, count=%d, error=%v", lag, count, err)
+	}
+
+	var changes []*base.CatchUp
+	snow := &SnowDataReader{
+		config:       config,
+		catchUpLag:   lag,
+		catchUpCount: count,
+		state:        collectionState{NextRecordTime: time.Now().UTC().Add(-2 * time.Hour).Format(timeTemplate)},
+	}
+	snow.OnCatchUp(func(catchUp *base.CatchUp) {
+		changes = append(changes, catchUp)
+	})
+
+	// A table without changes is not behind however old NextRecordTime is
+	snow.checkLag(false)
+	if snow.CatchingUp() || len(changes) != 0 {
+		t.Errorf("Expect no catch up after a page which is not full")
+	}
+
+	snow.checkLag(true)
+	if !snow.CatchingUp() || snow.recordCount() != 400 || !strings.HasSuffix(snow.getURL(), "sysparm_record_count=400") {
+		t.Errorf("Expect 400 records per request while catching up, got %d, url=%s", snow.recordCount(), snow.getURL())
+	}
+
+	snow.state.NextRecordTime = time.Now().UTC().Add(-time.Minute).Format(timeTemplate)
+	snow.checkLag(true)
+	if !snow.CatchingUp() {
+		t.Errorf("Expect catching up until a page is not full")
+	}
+
+	snow.checkLag(false)
+	if snow.CatchingUp() || snow.recordCount() != 100 {
+		t.Errorf("Expect RecordCount once caught up, got %d", snow.recordCount())
+	}
+
+	if len(changes) != 2 || !changes[0].CatchingUp || changes[0].Lag < time.Hour || changes[1].CatchingUp || changes[1].RecordCount != 100 {
+		t.Errorf("Expect the start and the end of the catch up notified, got=%+v", changes)
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{recordCountKey: "100", base.CatchUpLag: "-1"},
+		{recordCountKey: "100", base.CatchUpLag: "3600", base.CatchUpRecordCount: "50"},
+	} {
+		if _, _, err := parseCatchUp(bad); err == nil {
+			t.Errorf("Expect the catch up configs %v rejected", bad)
+		}
+	}
+}
+
+func TestSnowResumePolicy(t *testing.T) {
+	config := base.BaseConfig{base.ResumePolicy: base.ResumeFromTimestamp, base.ResumeFrom: "2015-06-02 00:00:00"}
+	bound, err := base.ResumeBound(config, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to get resume bound, error=%s", err)
+	}
+
+	state := &collectionState{NextRecordTime: "2015-06-01 08:00:00", LastTimeRecords: []string{"a"}}
+	gap := applyResumeBound(config, "/snow/incident", state, bound)
+	if gap == nil || gap.From != "2015-06-01 08:00:00" || gap.To != "2015-06-02 00:00:00" {
+		t.Fatalf("Expect gap from 2015-06-01 08:00:00 to 2015-06-02 00:00:00, got %+v", gap)
+	}
+
+	if state.NextRecordTime != "2015-06-02 00:00:00" || len(state.LastTimeRecords) != 0 {
+		t.Errorf("Expect state moved to the bound, got %+v", state)
+	}
+
+	// The checkpoint past the bound is kept
+	state = &collectionState{NextRecordTime: "2015-06-03 00:00:00"}
+	if gap := applyResumeBound(config, "/snow/incident", state, bound); gap != nil || state.NextRecordTime != "2015-06-03 00:00:00" {
+		t.Errorf("Expect no gap, got %+v, state=%+v", gap, state)
+	}
+
+	if gap := applyResumeBound(base.BaseConfig{}, "/snow/incident", state, time.Time{}); gap != nil {
+		t.Errorf("Expect no gap resuming from checkpoint, got %+v", gap)
+	}
+}
+
+func TestSnowScriptedREST(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/x_acme_app/v1/incidents" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"data":{"items":[{"sys_id":"1","sys_updated_on":"2015-06-01 08:00:00"}]}}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	snow := &SnowDataReader{
+		config: base.BaseConfig{
+			base.ServerURL:    server.URL + "/",
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+			recordCountKey:    "5",
+			endpointKey:       "/api/x_acme_app/v1/incidents?active=true",
+			cursorParamKey:    "updated_after",
+			recordsPathKey:    "data.items",
+		},
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+
+	body, err := snow.readData()
+	if err != nil {
+		t.Fatalf("Failed to read data, error=%s", err)
+	}
+
+	if query != "active=true&limit=5&updated_after=2015-06-01+08%3A00%3A00" {
+		t.Errorf("Unexpected query=%s", query)
+	}
+
+	jobj, _ := base.ToJsonObject(body)
+	records, ok := snow.recordsOf(jobj)
+	if !ok || len(records) != 1 {
+		t.Errorf("Expect 1 record at data.items, got %v", records)
+	}
+
+	if _, ok := snow.recordsOf(map[string]interface{}{"data": "x"}); ok {
+		t.Errorf("Expect no records if the path is not an object")
+	}
+}
+
+func TestSnowRequestHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	os.Setenv("DESCARTES_TEST_API_KEY", "k3y")
+	defer os.Unsetenv("DESCARTES_TEST_API_KEY")
+
+	config := base.BaseConfig{
+		base.ServerURL:    server.URL,
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "5",
+		headersKey:        `{"X-Api-Key": "env:DESCARTES_TEST_API_KEY", "X-Route": "east"}`,
+	}
+	headers, err := parseRequestHeaders(config)
+	if err != nil {
+		t.Fatalf("Failed to parse headers, error=%s", err)
+	}
+
+	snow := &SnowDataReader{
+		config:      config,
+		http_client: &http.Client{},
+		headers:     headers,
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+	if _, err = snow.readData(); err != nil {
+		t.Fatalf("Failed to read data, error=%s", err)
+	}
+
+	if received.Get("X-Api-Key") != "k3y" || received.Get("X-Route") != "east" {
+		t.Errorf("Expect the custom headers injected, got=%v", received)
+	}
+
+	if received.Get("Authorization") == "" {
+		t.Errorf("Expect basic auth kept along with the custom headers")
+	}
+
+	invalids := []string{`["X-Api-Key"]`, `{"authorization": "Bearer x"}`, `{"X-Api-Key": "env:DESCARTES_TEST_MISSING"}`}
+	for _, invalid := range invalids {
+		if _, err := parseRequestHeaders(base.BaseConfig{headersKey: invalid}); err == nil {
+			t.Errorf("Expect %s=%s rejected", headersKey, invalid)
+		}
+	}
+}
+
+func TestSnowCredentialRotation(t *testing.T) {
+	password := "old"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.ServerURL:       server.URL,
+		base.Username:        "admin",
+		base.Password:        "old",
+		base.Metric:          "incident",
+		timestampFieldKey:    "sys_updated_on",
+		recordCountKey:       "5",
+		secondaryPasswordKey: "new",
+	}
+
+	var healths []*base.CredentialHealth
+	snow := &SnowDataReader{
+		config:      config,
+		http_client: &http.Client{},
+		secondary:   secondaryCredential(config),
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+	snow.OnCredentialHealth(func(health *base.CredentialHealth) {
+		healths = append(healths, health)
+	})
+
+	if _, err := snow.readData(); err != nil || len(healths) != 0 {
+		t.Fatalf("Expect the primary credential accepted, error=%v, healths=%d", err, len(healths))
+	}
+
+	// The password is rotated on the snow side
+	password = "new"
+	for i := 0; i < 2; i++ {
+		if _, err := snow.readData(); err != nil {
+			t.Fatalf("Expect the secondary credential used, error=%s", err)
+		}
+	}
+
+	if len(healths) != 1 || healths[0].Credential != base.PrimaryCredential || healths[0].Healthy || healths[0].Active != base.SecondaryCredential {
+		t.Errorf("Expect one event of the rejected primary credential, got=%+v", healths)
+	}
+
+	if snow.credentialOf(int(snow.active)).username != "admin" {
+		t.Errorf("Expect SecondaryUsername defaults to Username")
+	}
+
+	// Both are rejected
+	password = "newer"
+	if _, err := snow.readData(); !base.IsConfigError(err) {
+		t.Errorf("Expect a config error when all credentials are rejected, got=%v", err)
+	}
+
+	if len(healths) != 2 || healths[1].Credential != base.SecondaryCredential || healths[1].Healthy {
+		t.Errorf("Expect the rejected secondary credential notified, got=%+v", healths)
+	}
+}
+
+func TestSnowOAuth(t *testing.T) {
+	var grants []string
+	issued := 0
+	revoked := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth_token.do" {
+			r.ParseForm()
+			if r.Form.Get("client_id") != "cid" || r.Form.Get("client_secret") != "csecret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			grants = append(grants, r.Form.Get("grant_type"))
+			issued++
+			fmt.Fprintf(w, `{"access_token":"t%d","refresh_token":"r%d","expires_in":1800,"token_type":"Bearer"}`, issued, issued)
+			return
+		}
+
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "Bearer t") || auth == "Bearer "+revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.ServerURL:    server.URL,
+		base.Username:     "admin",
+		base.Password:     "secret",
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "5",
+		clientIdKey:       "cid",
+		clientSecretKey:   "csecret",
+	}
+
+	auth, err := newAuthenticator(config, &http.Client{})
+	if err != nil {
+		t.Fatalf("Failed to create the authenticator, error=%s", err)
+	}
+
+	snow := &SnowDataReader{
+		config:      config,
+		http_client: &http.Client{},
+		auth:        auth,
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := snow.readData(); err != nil {
+			t.Fatalf("Failed to read data with the token, error=%s", err)
+		}
+	}
+
+	if len(grants) != 1 || grants[0] != "password" {
+		t.Errorf("Expect one password grant cached, got=%v", grants)
+	}
+
+	// The token expires, it is renewed with its refresh token
+	oauth := auth.(*oauthAuth)
+	oauth.tokens[base.PrimaryCredential].expiry = time.Now()
+	if _, err := snow.readData(); err != nil || len(grants) != 2 || grants[1] != "refresh_token" {
+		t.Errorf("Expect the token refreshed, grants=%v, error=%v", grants, err)
+	}
+
+	// The token is revoked before it expires
+	revoked = oauth.tokens[base.PrimaryCredential].accessToken
+	if _, err := snow.readData(); err != nil || len(grants) != 3 {
+		t.Errorf("Expect a new token obtained on rejection, grants=%v, error=%v", grants, err)
+	}
+
+	// client_credentials without a password, and the rejected client
+	delete(config, base.Password)
+	config[clientSecretKey] = "wrong"
+	auth, _ = newAuthenticator(config, &http.Client{})
+	snow.auth = auth
+	if _, err := snow.readData(); !base.IsConfigError(err) {
+		t.Errorf("Expect a config error when the client is rejected, got=%v", err)
+	}
+
+	if grant := auth.(*oauthAuth).grant(snow.credentialOf(0)); grant.Get("grant_type") != "client_credentials" {
+		t.Errorf("Expect client_credentials without a password, got=%v", grant)
+	}
+
+	if _, err := newAuthenticator(base.BaseConfig{clientSecretKey: "csecret"}, &http.Client{}); err == nil {
+		t.Errorf("Expect %s without %s rejected", clientSecretKey, clientIdKey)
+	}
+}
+
+func TestSnowDataGap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := `{"records":[{"sys_id":"2","sys_updated_on":"2015-06-01 09:00:00"},{"sys_id":"3","sys_updated_on":"2015-06-01 09:00:01"}]}`
+		if strings.Contains(r.URL.RawQuery, "sys_updated_on<") {
+			page = `{"records":[{"sys_id":"1","sys_updated_on":"2015-06-01 08:30:00"}]}`
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, page)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	var gaps []*base.TimeGap
+	snow := &SnowDataReader{
+		config: base.BaseConfig{
+			base.ServerURL:    server.URL,
+			base.Key:          "/snow/incident",
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+			recordCountKey:    "2",
+			gapToleranceKey:   "600",
+		},
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+	snow.OnGap(func(gap *base.TimeGap) { gaps = append(gaps, gap) })
+
+	body, _ := snow.readData()
+	jobj, _ := base.ToJsonObject(body)
+	page, _ := snow.recordsOf(jobj)
+	if records := snow.detectGap(page); len(records) != 2 || len(gaps) != 1 {
+		t.Fatalf("Expect the page kept and a gap flagged, got %d records and %d gaps", len(records), len(gaps))
+	}
+
+	if gaps[0].Key != "/snow/incident" || gaps[0].From != "2015-06-01 08:00:00" || gaps[0].To != "2015-06-01 09:00:00" {
+		t.Errorf("Unexpected gap=%+v", gaps[0])
+	}
+
+	if event := gaps[0].Event(); event["Reason"] == "" {
+		t.Errorf("Expect the reason of the suspected gap in its event, got=%v", event)
+	}
+
+	snow.config[gapRequeryKey] = "1"
+	records := snow.detectGap(page)
+	if len(records) != 1 || records[0].(map[string]interface{})["sys_id"] != "1" {
+		t.Errorf("Expect the records of the re-queried window collected instead of the page, got=%v", records)
+	}
+
+	// Within the tolerance or a partial page
+	snow.state.NextRecordTime = "2015-06-01 08:55:00"
+	snow.detectGap(page)
+	snow.state.NextRecordTime = "2015-06-01 08:00:00"
+	snow.detectGap(page[:1])
+	if len(gaps) != 2 {
+		t.Errorf("Expect no gap flagged within the tolerance or for a partial page, got %d gaps", len(gaps))
+	}
+}
+
+type dedupeCheckpointer struct {
+	base.NullCheckpointer
+	value    []byte
+	writes   int
+	failFrom int // the write failing from on, 0 if none
+}
+
+func (ck *dedupeCheckpointer) GetCheckpoint(keyInfo map[string]string) ([]byte, error) {
+	return ck.value, nil
+}
+
+func (ck *dedupeCheckpointer) WriteCheckpoint(keyInfo map[string]string, value []byte) error {
+	ck.writes++
+	if ck.failFrom > 0 && ck.writes >= ck.failFrom {
+		return errors.New("checkpoint failed")
+	}
+	ck.value = value
+	return nil
+}
+
+type dedupeWriter struct {
+	base.StdoutDataWriter
+	written []string
+	failAt  int
+}
+
+func (writer *dedupeWriter) WriteDataContext(ctx context.Context, data *base.Data) error {
+	if len(writer.written)+1 == writer.failAt {
+		return errors.New("write failed")
+	}
+	writer.written = append(writer.written, string(data.RawData[0]))
+	return nil
+}
+
+func TestSnowDedupeFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[{"sys_id":"1","sys_updated_on":"2015-06-01 08:00:01"},`+
+			`{"sys_id":"2","sys_updated_on":"2015-06-01 08:00:02"},{"sys_id":"3","sys_updated_on":"2015-06-01 08:00:03"}]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.ServerURL:    server.URL,
+		base.Metric:       "incident",
+		base.DedupeFilter: "1",
+		timestampFieldKey: "sys_updated_on",
+		nextRecordTimeKey: "2015-06-01 08:00:00",
+		recordCountKey:    "3",
+	}
+	format, _ := base.NewFormat(config, base.FormatKV)
+	ck := &dedupeCheckpointer{}
+
+	newReader := func(writer base.DataWriter) *SnowDataReader {
+		return &SnowDataReader{
+			config:      config,
+			writer:      writer,
+			checkpoint:  ck,
+			http_client: &http.Client{},
+			state:       *getCheckpoint(ck, config),
+			format:      format,
+		}
+	}
+
+	// Fails after 2 records are written, they are not checkpointed
+	writer := &dedupeWriter{failAt: 3}
+	if err := newReader(writer).indexData(time.Time{}); err == nil || len(writer.written) != 2 {
+		t.Fatalf("Expect the write failed after 2 records, error=%v, written=%d", err, len(writer.written))
+	}
+
+	// After a restart only the record not written is
+	writer = &dedupeWriter{}
+	snow := newReader(writer)
+	if snow.state.NextRecordTime != "2015-06-01 08:00:00" || snow.state.Emitted == nil {
+		t.Fatalf("Expect the emitted records in the checkpoint, got %+v", snow.state)
+	}
+
+	if err := snow.indexData(time.Time{}); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	if len(writer.written) != 1 || !strings.Contains(writer.written[0], `sys_id="3"`) {
+		t.Errorf("Expect only record 3 written, got %s", writer.written)
+	}
+
+	state := getCheckpoint(ck, config)
+	if state.NextRecordTime != "2015-06-01 08:00:03" || state.Emitted != nil || snow.state.Emitted != nil {
+		t.Errorf("Expect the checkpoint moved past the records without filter, got %+v", state)
+	}
+
+	// The rollback of the filter fails with the write, the records not
+	// written are not suppressed by the next cycle
+	ck = &dedupeCheckpointer{failFrom: 2}
+	writer = &dedupeWriter{failAt: 2}
+	snow = newReader(writer)
+	if err := snow.indexData(time.Time{}); err == nil || len(writer.written) != 1 || snow.state.Emitted != nil {
+		t.Fatalf("Expect the filter of the page dropped, error=%v, written=%d", err, len(writer.written))
+	}
+
+	ck.failFrom = 0
+	writer = &dedupeWriter{}
+	snow.writer = writer
+	if err := snow.indexData(time.Time{}); err != nil || len(writer.written) != 3 {
+		t.Errorf("Expect the records not written collected again, got %s, error=%v", writer.written, err)
+	}
+}
+
+func TestSnowCancel(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	snow := &SnowDataReader{
+		config: base.BaseConfig{
+			base.ServerURL:    server.URL,
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+		},
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := snow.readData()
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	snow.Cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expect the canceled request failed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expect the request in progress aborted by Cancel")
+	}
+
+	if _, err := snow.readData(); err == nil {
+		t.Errorf("Expect the requests after Cancel failed")
+	}
+}
+
+func TestSnowChangeAnnotation(t *testing.T) {
+	page := `{"records":[{"sys_id":"1","sys_mod_count":"0","sys_updated_on":"2015-06-01 08:00:01"},` +
+		`{"sys_id":"2","sys_mod_count":"3","sys_updated_on":"2015-06-01 08:00:02"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, page)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.ServerURL:      server.URL,
+		base.Metric:         "incident",
+		changeAnnotationKey: "1",
+		timestampFieldKey:   "sys_updated_on",
+		nextRecordTimeKey:   "2015-06-01 08:00:00",
+		recordCountKey:      "5",
+	}
+	format, _ := base.NewFormat(config, base.FormatKV)
+	writer := &dedupeWriter{}
+	snow := &SnowDataReader{
+		config:      config,
+		writer:      writer,
+		checkpoint:  &dedupeCheckpointer{},
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		format:      format,
+		changes:     newChangeCacheOf(config),
+	}
+
+	if err := snow.indexData(time.Time{}); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	if len(writer.written) != 2 || !strings.Contains(writer.written[0], `_change_type="first_seen"`) ||
+		!strings.Contains(writer.written[1], `_change_type="update"`) || strings.Contains(writer.written[1], "_previous_record_time") {
+		t.Fatalf("Expect record 1 first seen and record 2 updated before collected, got %s", writer.written)
+	}
+
+	// Record 1 is updated after it was collected
+	page = `{"records":[{"sys_id":"1","sys_mod_count":"1","sys_updated_on":"2015-06-01 08:00:05"}]}`
+	writer.written = nil
+	if err := snow.indexData(time.Time{}); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	if len(writer.written) != 1 || !strings.Contains(writer.written[0], `_change_type="update"`) ||
+		!strings.Contains(writer.written[0], `_previous_record_time="2015-06-01 08:00:01"`) {
+		t.Errorf("Expect record 1 updated with its previous record time, got %s", writer.written)
+	}
+
+	cache := newChangeCache(2)
+	cache.put("1", "a")
+	cache.put("2", "b")
+	cache.put("3", "c")
+	if _, ok := cache.get("1"); ok || cache.times.Len() != 2 {
+		t.Errorf("Expect the least recently used record evicted, got %d records", cache.times.Len())
+	}
+}
+
+func TestSnowRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[{"sys_id":"1","sys_updated_on":"2015-06-01 08:00:01"}]}`)
+		gz.Close()
+	}))
+
+	dir, err := ioutil.TempDir("", "snow_tape")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir, error=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := base.BaseConfig{
+		base.ServerURL:    server.URL,
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "5",
+		recordDirKey:      dir,
+	}
+	tape, err := newResponseTape(config)
+	if err != nil {
+		t.Fatalf("Failed to create the tape, error=%s", err)
+	}
+
+	snow := &SnowDataReader{
+		config:      config,
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		tape:        tape,
+	}
+	recorded, err := snow.readData()
+	server.Close()
+	if err != nil {
+		t.Fatalf("Failed to read data, error=%s", err)
+	}
+
+	delete(config, recordDirKey)
+	config[replayDirKey] = dir
+	snow.tape, err = newResponseTape(config)
+	if err != nil {
+		t.Fatalf("Failed to create the tape, error=%s", err)
+	}
+
+	replayed, err := snow.readData()
+	if err != nil || string(replayed) != string(recorded) {
+		t.Errorf("Expect the recorded response replayed, got %s, error=%v", replayed, err)
+	}
+
+	if _, err := snow.readData(); err != errReplayExhausted {
+		t.Errorf("Expect the replay exhausted, got error=%v", err)
+	}
+
+	config[recordDirKey] = dir
+	if _, err := newResponseTape(config); err == nil {
+		t.Errorf("Expect RecordDir and ReplayDir exclusive")
+	}
+}
+
+func TestSnowCycleBudget(t *testing.T) {
+	records := []string{"2015-06-01 08:00:01", "2015-06-01 08:00:02", "2015-06-01 08:00:03", "2015-06-01 08:00:04", "2015-06-01 08:00:05"}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The pages are queried by ">=", the page cap probe by ">"
+		inclusive := strings.Contains(r.URL.RawQuery, ">=")
+		cursor := strings.TrimPrefix(strings.SplitN(r.URL.RawQuery, ">", 2)[1], "=")
+		var res []string
+		for _, ts := range records {
+			ts := strings.Replace(ts, " ", "+", 1)
+			if (ts > cursor[:len(ts)] || inclusive && ts == cursor[:len(ts)]) && len(res) < 2 {
+				res = append(res, fmt.Sprintf(`{"sys_id":"%s","sys_updated_on":"%s"}`, ts[len(ts)-2:], strings.Replace(ts, "+", " ", 1)))
+			}
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `{"records":[%s]}`, strings.Join(res, ","))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	newReader := func(writer base.DataWriter) *SnowDataReader {
+		config := base.BaseConfig{
+			base.ServerURL:    server.URL,
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+			nextRecordTimeKey: "2015-06-01 08:00:00",
+			recordCountKey:    "2",
+		}
+		format, _ := base.NewFormat(config, base.FormatKV)
+		return &SnowDataReader{
+			config:      config,
+			writer:      writer,
+			checkpoint:  &dedupeCheckpointer{},
+			http_client: &http.Client{},
+			state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+			format:      format,
+			budget:      time.Minute,
+		}
+	}
+
+	// Within the budget, the pages are collected until the table is caught up
+	writer := &dedupeWriter{}
+	snow := newReader(writer)
+	if err := snow.indexData(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	// The last page isn't full, the page cap probe finds nothing after it
+	if len(writer.written) != len(records) || requests != 6 || snow.state.NextRecordTime != records[4] {
+		t.Errorf("Expect %d records in 6 requests, got %d in %d, checkpoint=%s",
+			len(records), len(writer.written), requests, snow.state.NextRecordTime)
+	}
+
+	// Once the budget is spent, the cycle stops after the page in progress
+	// and the next cycle continues from its checkpoint
+	writer = &dedupeWriter{}
+	snow = newReader(writer)
+	requests = 0
+	if err := snow.indexData(time.Now()); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	if len(writer.written) != 2 || requests != 1 || snow.state.NextRecordTime != records[1] {
+		t.Errorf("Expect 2 records in 1 request, got %d in %d, checkpoint=%s", len(writer.written), requests, snow.state.NextRecordTime)
+	}
+}
+
+func TestSnowPaginate(t *testing.T) {
+	type record struct{ id, ts string }
+	var records []record
+	var offsets []string
+	var onRequest func()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		cursor := strings.SplitN(strings.SplitN(query.Get("sysparm_query"), ">=", 2)[1], "^", 2)[0]
+		offset, _ := strconv.Atoi(query.Get("sysparm_offset"))
+		count, _ := strconv.Atoi(query.Get("sysparm_record_count"))
+		offsets = append(offsets, query.Get("sysparm_offset"))
+
+		var res []string
+		for _, rec := range records {
+			if rec.ts < cursor {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if len(res) < count {
+				res = append(res, fmt.Sprintf(`{"sys_id":"%s","sys_updated_on":"%s"}`, rec.id, rec.ts))
+			}
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `{"records":[%s]}`, strings.Join(res, ","))
+		gz.Close()
+		if onRequest != nil {
+			onRequest()
+			onRequest = nil
+		}
+	}))
+	defer server.Close()
+
+	newReader := func(writer base.DataWriter, checkpoint base.Checkpointer) *SnowDataReader {
+		config := base.BaseConfig{
+			base.ServerURL:    server.URL,
+			base.Metric:       "incident",
+			timestampFieldKey: "sys_updated_on",
+			nextRecordTimeKey: "2015-06-01 08:00:00",
+			recordCountKey:    "2",
+			paginateKey:       "1",
+		}
+		format, _ := base.NewFormat(config, base.FormatKV)
+		return &SnowDataReader{
+			config:      config,
+			writer:      writer,
+			checkpoint:  checkpoint,
+			http_client: &http.Client{},
+			state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+			format:      format,
+			paginate:    true,
+		}
+	}
+
+	// The records sharing a timestamp across the pages are all collected in
+	// one cycle, each page checkpointed
+	records = []record{
+		{"r1", "2015-06-01 08:00:01"}, {"r2", "2015-06-01 08:00:01"}, {"r3", "2015-06-01 08:00:01"},
+		{"r4", "2015-06-01 08:00:02"}, {"r5", "2015-06-01 08:00:03"},
+	}
+	writer, checkpoint := &dedupeWriter{}, &dedupeCheckpointer{}
+	snow := newReader(writer, checkpoint)
+	if err := snow.IndexData(); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	if len(writer.written) != 5 || strings.Join(offsets, ",") != ",1,2,3,4" || snow.state.NextRecordTime != "2015-06-01 08:00:03" {
+		t.Errorf("Expect 5 records in pages at offsets 0 to 4, got %d at offsets=%v, checkpoint=%s",
+			len(writer.written), offsets, snow.state.NextRecordTime)
+	}
+
+	if !strings.Contains(string(checkpoint.value), "2015-06-01 08:00:03") || snow.pageOffset != 0 {
+		t.Errorf("Expect the last page checkpointed and the offset reset, got checkpoint=%s, offset=%d", checkpoint.value, snow.pageOffset)
+	}
+
+	// When a record of a page changes, the records after it move ahead of
+	// the offset, the next page starts from the checkpoint again instead of
+	// skipping them
+	records = []record{
+		{"r1", "2015-06-01 08:00:01"}, {"r2", "2015-06-01 08:00:01"}, {"r3", "2015-06-01 08:00:01"},
+		{"r4", "2015-06-01 08:00:02"}, {"r5", "2015-06-01 08:00:03"},
+	}
+	onRequest = func() {
+		records = append(records[1:], record{"r1", "2015-06-01 08:00:04"})
+	}
+	offsets = nil
+	writer = &dedupeWriter{}
+	snow = newReader(writer, &dedupeCheckpointer{})
+	if err := snow.IndexData(); err != nil {
+		t.Fatalf("Failed to index data, error=%s", err)
+	}
+
+	collected := strings.Join(writer.written, ",")
+	for _, id := range []string{"r2", "r3", "r4", "r5"} {
+		if !strings.Contains(collected, `sys_id="`+id+`"`) {
+			t.Errorf("Expect %s collected after the records moved, got offsets=%v, records=%s", id, offsets, collected)
+		}
+	}
+
+	if snow.state.NextRecordTime != "2015-06-01 08:00:04" {
+		t.Errorf("Expect the changed record collected again, got checkpoint=%s", snow.state.NextRecordTime)
+	}
+}
+
+func TestSnowFields(t *testing.T) {
+	config := base.BaseConfig{
+		base.ServerURL:    "https://acme.service-now.com",
+		base.Metric:       "sys_audit",
+		timestampFieldKey: "sys_created_on",
+		recordCountKey:    "100",
+		fieldsKey:         "tablename, fieldname,newvalue,sys_id",
+	}
+
+	fields, err := parseFields(config)
+	if err != nil || strings.Join(fields, ",") != "tablename,fieldname,newvalue,sys_id,sys_created_on" {
+		t.Fatalf("Expect the TimestampField added to Fields, got %v, error=%v", fields, err)
+	}
+
+	snow := &SnowDataReader{
+		config: config,
+		fields: fields,
+		state:  collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+	if !strings.Contains(snow.getURL(), "&sysparm_fields=tablename%2Cfieldname%2Cnewvalue%2Csys_id%2Csys_created_on") {
+		t.Errorf("Expect the fields requested, got url=%s", snow.getURL())
+	}
+
+	// The fields not requested are removed, the ones not returned flagged
+	records := []interface{}{
+		map[string]interface{}{"sys_id": "1", "sys_created_on": "2015-06-01 08:00:01", "tablename": "incident", "fieldname": "state", "oldvalue": "1"},
+		map[string]interface{}{"sys_id": "2", "sys_created_on": "2015-06-01 08:00:02", "tablename": "incident"},
+	}
+	snow.checkFields(records)
+	if _, ok := records[0].(map[string]interface{})["oldvalue"]; ok {
+		t.Errorf("Expect the field not requested removed, got %v", records[0])
+	}
+
+	if !snow.missing["newvalue"] || snow.missing["fieldname"] || len(snow.missing) != 1 {
+		t.Errorf("Expect newvalue flagged as not returned, got %v", snow.missing)
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{fieldsKey: "number", endpointKey: "/api/x_acme_app/v1/incidents"},
+		{fieldsKey: "number,sys_id^ORDERBYnumber"},
+	} {
+		if _, err := parseFields(bad); err == nil {
+			t.Errorf("Expect Fields of %v rejected", bad)
+		}
+	}
+
+	if _, _, err := parseQueryHints(base.BaseConfig{fieldsKey: "number", queryHintsKey: "sysparm_fields=number"}); err == nil {
+		t.Errorf("Expect sysparm_fields reserved by Fields")
+	}
+}
+
+func TestSnowRequestQuota(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `{"records":[]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	newReader := func(priority string, quota *base.RequestQuota) *SnowDataReader {
+		config := base.BaseConfig{
+			base.ServerURL:      server.URL,
+			base.Metric:         "incident",
+			timestampFieldKey:   "sys_updated_on",
+			recordCountKey:      "100",
+			base.QuotaHourly:    "2",
+			base.QuotaWarnRatio: "0.5",
+		}
+		limits, _ := base.ParseQuotaLimits(config)
+		format, _ := base.NewFormat(config, base.FormatKV)
+		snow := &SnowDataReader{
+			config:      config,
+			http_client: &http.Client{},
+			state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+			format:      format,
+			limits:      limits,
+			priority:    priority,
+		}
+		snow.SetRequestQuota(quota)
+		return snow
+	}
+
+	quota := base.NewRequestQuota()
+	low, high := newReader(base.PriorityLow, quota), newReader(base.PriorityHigh, quota)
+	if err := low.indexData(time.Time{}); err != nil || requests != 1 {
+		t.Fatalf("Expect the request allowed, got %d requests, error=%v", requests, err)
+	}
+
+	// The quota of the instance is at its warn ratio after the request
+	if err := low.indexData(time.Time{}); err != base.ErrSkipped || requests != 1 {
+		t.Errorf("Expect the low priority reader throttled, got %d requests, error=%v", requests, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := high.indexData(time.Time{}); err != nil {
+			t.Errorf("Expect the high priority reader never throttled, error=%s", err)
+		}
+	}
+
+	if requests != 3 || quota.Level(server.URL) != base.QuotaExceeded {
+		t.Errorf("Expect the requests of both readers counted, got %d, level=%s", requests, quota.Level(server.URL))
+	}
+}
+
+func TestSnowDisplayValue(t *testing.T) {
+	config := base.BaseConfig{
+		base.ServerURL:    "https://acme.service-now.com",
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "100",
+		fieldsKey:         "assigned_to",
+		displayValueKey:   "all",
+	}
+
+	displayValue, err := parseDisplayValue(config)
+	if err != nil || displayValue != displayValueAll {
+		t.Fatalf("Expect DisplayValue=all, got %s, error=%v", displayValue, err)
+	}
+
+	fields, _ := parseFields(config)
+	snow := &SnowDataReader{
+		config:       config,
+		fields:       fields,
+		displayValue: displayValue,
+		state:        collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+	}
+	if !strings.Contains(snow.getURL(), "&sysparm_display_value=all") {
+		t.Errorf("Expect the display values requested, got url=%s", snow.getURL())
+	}
+
+	// Both shapes of the display values
+	body := []byte(`{"records":[
+		{"sys_id":{"value":"1","display_value":"1"},"sys_updated_on":{"value":"2015-06-01 08:00:01","display_value":"06/01/2015 01:00:01"},
+		 "assigned_to":{"value":"6816f79cc0a8016401c5a33be04be441","display_value":"Beth Anglin"}},
+		{"sys_id":"2","sys_updated_on":"2015-06-01 08:00:02","dv_sys_updated_on":"06/01/2015 01:00:02",
+		 "assigned_to":"46d44a23a9fe19810012d100cca80666","dv_assigned_to":"Fred Luddy","dv_other":"x"}]}`)
+	jobj, _ := base.ToJsonObject(body)
+	records, _ := snow.recordsOf(jobj)
+	for i, name := range []string{"Beth Anglin", "Fred Luddy"} {
+		record := records[i].(map[string]interface{})
+		if record["dv_assigned_to"] != name || len(record["assigned_to"].(string)) != 32 || len(record["sys_updated_on"].(string)) != 19 {
+			t.Errorf("Expect both the raw and the display values, got %v", record)
+		}
+
+		if _, ok := record["dv_other"]; ok {
+			t.Errorf("Expect the display values of the fields not requested removed, got %v", record)
+		}
+	}
+
+	// The display values replace the raw ones, except of the fields the
+	// reader relies on
+	snow.displayValue = displayValueTrue
+	jobj, _ = base.ToJsonObject(body)
+	records, _ = snow.recordsOf(jobj)
+	for i, name := range []string{"Beth Anglin", "Fred Luddy"} {
+		record := records[i].(map[string]interface{})
+		if record["assigned_to"] != name || len(record["sys_updated_on"].(string)) != 19 || len(record) != 3 {
+			t.Errorf("Expect the display values but of TimestampField, got %v", record)
+		}
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{displayValueKey: "yes"},
+		{displayValueKey: "all", endpointKey: "/api/x_acme_app/v1/incidents"},
+	} {
+		if _, err := parseDisplayValue(bad); err == nil {
+			t.Errorf("Expect DisplayValue of %v rejected", bad)
+		}
+	}
+}
+
+func TestSnowQueryHints(t *testing.T) {
+	config := base.BaseConfig{
+		base.ServerURL:    "https://acme.service-now.com",
+		base.Metric:       "incident",
+		timestampFieldKey: "sys_updated_on",
+		recordCountKey:    "5",
+		queryHintsKey:     "sysparm_suppress_pagination_header=true&sysparm_no_count=true",
+		queryOrderKey:     "-sys_created_on, sys_id",
+	}
+
+	hints, orderBy, err := parseQueryHints(config)
+	if err != nil {
+		t.Fatalf("Failed to parse the query hints, error=%s", err)
+	}
+
+	snow := &SnowDataReader{
+		config:  config,
+		state:   collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		hints:   hints,
+		orderBy: orderBy,
+	}
+
+	expected := "https://acme.service-now.com/incident.do?JSONv2&sysparm_query=sys_updated_on>=2015-06-01+08:00:00" +
+		"^ORDERBYsys_updated_on^ORDERBYDESCsys_created_on^ORDERBYsys_id&sysparm_record_count=5" +
+		"&sysparm_no_count=true&sysparm_suppress_pagination_header=true"
+	if url := snow.getURL(); url != expected {
+		t.Errorf("Expect url=%s, got=%s", expected, url)
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{queryHintsKey: "sysparm_record_count=10000"},
+		{queryOrderKey: "sys_id^ORDERBYnumber"},
+		{queryOrderKey: "sys_id", endpointKey: "/api/x_acme_app/v1/incidents"},
+		{queryHintsKey: "since=2015-06-01", endpointKey: "/api/x_acme_app/v1/incidents"},
+	} {
+		if _, _, err := parseQueryHints(bad); err == nil {
+			t.Errorf("Expect the query hints %v rejected", bad)
+		}
+	}
+}
+
+func TestSnowBootstrapCheckpoint(t *testing.T) {
+	config := base.BaseConfig{
+		base.Key:          "/snow/incident",
+		timestampFieldKey: "sys_updated_on",
+		nextRecordTimeKey: "2015-06-01+00:00:00",
+	}
+	records := []map[string]interface{}{
+		{"sys_id": "1", "sys_updated_on": "2015-06-01 08:00:02"},
+		{"sys_id": "2", "sys_updated_on": "2015-06-01 08:00:03"},
+		{"sys_id": "3", "sys_updated_on": "2015-06-01 08:00:03"},
+		{"sys_id": "4", "sys_updated_on": "2015-06-01 08:00:01"},
+		{"sys_id": "5", "sys_updated_on": "2015-05-31 23:59:59"},
+	}
+
+	checkpoint := &dedupeCheckpointer{}
+	next, err := BootstrapCheckpoint(config, checkpoint, records)
+	if err != nil || next != "2015-06-01 08:00:03" {
+		t.Fatalf("Expect NextRecordTime=2015-06-01 08:00:03, got %s, error=%v", next, err)
+	}
+
+	state := getCheckpoint(checkpoint, config)
+	if state == nil || state.NextRecordTime != next || strings.Join(state.LastTimeRecords, ",") != "2,3" {
+		t.Errorf("Expect the checkpoint after records 2 and 3, got %+v", state)
+	}
+
+	// The existing checkpoint is kept
+	if next, err := BootstrapCheckpoint(config, checkpoint, []map[string]interface{}{{"sys_id": "6", "sys_updated_on": "2015-06-02 00:00:00"}}); err != nil || next != "" {
+		t.Errorf("Expect the checkpoint kept, got %s, error=%v", next, err)
+	}
+
+	// The records before NextRecordTime don't initialize the checkpoint
+	checkpoint = &dedupeCheckpointer{}
+	if next, err := BootstrapCheckpoint(config, checkpoint, records[4:]); err != nil || next != "" || checkpoint.value != nil {
+		t.Errorf("Expect no checkpoint, got %s, error=%v", next, err)
+	}
+}
+
+func TestSnowRetry(t *testing.T) {
+	statuses := []int{http.StatusBadGateway, http.StatusServiceUnavailable}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"records":[]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	config := base.BaseConfig{
+		base.ServerURL:     server.URL,
+		base.Metric:        "incident",
+		timestampFieldKey:  "sys_updated_on",
+		recordCountKey:     "100",
+		retryBackoffKey:    "10ms",
+		retryMaxBackoffKey: "20ms",
+	}
+
+	retry, err := parseRetryPolicy(config)
+	if err != nil || retry.attempts != defaultRetryAttempts || retry.jitter != defaultRetryJitter {
+		t.Fatalf("Expect the default attempts and jitter, got %+v, error=%v", retry, err)
+	}
+
+	snow := &SnowDataReader{
+		config:      config,
+		http_client: &http.Client{},
+		state:       collectionState{NextRecordTime: "2015-06-01 08:00:00"},
+		retry:       retry,
+	}
+
+	// The transient failures are retried until the request succeeds
+	if body, err := snow.doRequest(snow.getURL()); err != nil || string(body) != `{"records":[]}` || requests != 3 {
+		t.Errorf("Expect the request retried twice, got %d requests, error=%v", requests, err)
+	}
+
+	// Until the attempts run out
+	statuses, requests = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, 0
+	if _, err := snow.doRequest(snow.getURL()); err == nil || !strings.Contains(err.Error(), "502") || requests != 3 {
+		t.Errorf("Expect the last failure after 3 attempts, got %d requests, error=%v", requests, err)
+	}
+
+	// The rejected credentials are not
+	statuses, requests = []int{http.StatusUnauthorized, http.StatusUnauthorized}, 0
+	if _, err := snow.doRequest(snow.getURL()); !base.IsConfigError(err) || requests != 1 {
+		t.Errorf("Expect the configuration error without retry, got %d requests, error=%v", requests, err)
+	}
+
+	if delay := (retryPolicy{backoff: time.Second, maxBackoff: 5 * time.Second}).delay(5, 0); delay != 5*time.Second {
+		t.Errorf("Expect the delay capped at RetryMaxBackoff, got %s", delay)
+	}
+
+	if delay := (retryPolicy{backoff: time.Second, maxBackoff: time.Minute}).delay(1, 10*time.Second); delay != 10*time.Second {
+		t.Errorf("Expect Retry-After respected, got %s", delay)
+	}
+
+	for _, bad := range []base.BaseConfig{
+		{retryAttemptsKey: "0"},
+		{retryBackoffKey: "soon"},
+		{retryBackoffKey: "1m", retryMaxBackoffKey: "1s"},
+		{retryJitterKey: "2"},
+	} {
+		if _, err := parseRetryPolicy(bad); err == nil {
+			t.Errorf("Expect the retry policy %v rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package snow
+
+import (
+	"encoding/json"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+)
+
+const (
+	// Of the duplicate suppression after a crash with "DedupeFilter" "1",
+	// see markEmitted
+	dedupeFalsePositiveRate = 0.001
+)
+
+func (snow *SnowDataReader) emittedKey(record interface{}) string {
+	r, _ := record.(map[string]interface{})
+	sysId, _ := r["sys_id"].(string)
+	recordTime, _ := r[snow.config[timestampFieldKey]].(string)
+	return sysId + "|" + recordTime
+}
+
+// suppressEmitted removes the records which may have been written before the
+// reader crashed or failed to checkpoint them, see markEmitted
+func (snow *SnowDataReader) suppressEmitted(records []interface{}) []interface{} {
+	if snow.state.Emitted == nil {
+		return records
+	}
+
+	var recordsToBeIndexed []interface{}
+	for _, r := range records {
+		if !snow.state.Emitted.Test(snow.emittedKey(r)) {
+			recordsToBeIndexed = append(recordsToBeIndexed, r)
+		}
+	}
+
+	if suppressed := len(records) - len(recordsToBeIndexed); suppressed > 0 {
+		glog.Warningf("Suppressed %d records of %s/%s which were written before the last checkpoint",
+			suppressed, snow.config[base.ServerURL], snow.config[base.Metric])
+	}
+	return recordsToBeIndexed
+}
+
+// markEmitted checkpoints state, the one the records were queried by, with
+// the (sys_id, TimestampField) pairs of records added to its bloom filter
+// before they are written. If the reader crashes before the checkpoint moves
+// past them, the next cycle suppresses them instead of writing the page
+// again. False positives suppress a record never written at
+// dedupeFalsePositiveRate, and the filter only exists until the records are
+// checkpointed
+func (snow *SnowDataReader) markEmitted(state collectionState, records []interface{}) error {
+	filter := base.NewBloomFilter(2*snow.recordCount(), dedupeFalsePositiveRate)
+	if state.Emitted != nil {
+		filter = state.Emitted.Clone()
+	}
+
+	for _, r := range records {
+		filter.Add(snow.emittedKey(r))
+	}
+	state.Emitted = filter
+
+	data, err := json.Marshal(&state)
+	if err != nil {
+		glog.Errorf("Failed to marhsal checkpoint, error=%s", err)
+		return err
+	}
+
+	err = snow.checkpoint.WriteCheckpoint(snow.checkpointKeyInfo(), data)
+	if err != nil {
+		return err
+	}
+	snow.state.Emitted = filter
+	return nil
+}
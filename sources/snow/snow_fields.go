@@ -0,0 +1,174 @@
+package snow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strings"
+)
+
+const (
+	// Fields of the records requested, see parseFields
+	fieldsKey = "Fields"
+
+	// Display values of the fields, see applyDisplayValues
+	displayValueKey    = "DisplayValue"
+	displayValueTrue   = "true"
+	displayValueAll    = "all"
+	displayValuePrefix = "dv_"
+)
+
+// parseFields returns the "," separated fields of "Fields", nil if it is not
+// set, with sys_id, TimestampField and DomainField of the Domains added, the
+// reader relies on them. The instance returns these fields of the records
+// only, for e.g. 6 of the columns of sys_audit instead of all of them
+func parseFields(config base.BaseConfig) ([]string, error) {
+	if strings.TrimSpace(config[fieldsKey]) == "" {
+		return nil, nil
+	}
+
+	if config[endpointKey] != "" {
+		return nil, errors.New(fmt.Sprintf("%s doesn't apply to %s, the Scripted REST API shall select the fields itself", fieldsKey, endpointKey))
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(config[fieldsKey], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+
+		if strings.ContainsAny(field, "^&=") {
+			return nil, errors.New(fmt.Sprintf("invalid field %q in %s", field, fieldsKey))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+
+	required := []string{"sys_id", config[timestampFieldKey]}
+	if strings.TrimSpace(config[base.Domains]) != "" {
+		required = append(required, configOr(config, base.DomainField, defaultDomainField))
+	}
+	for _, field := range required {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// checkFields validates the records returned against Fields. The fields
+// none of the records has are warned about once, the instance drops the
+// fields which are not columns of the table or not readable by the user
+// silently. The fields which were not requested are removed, in case the
+// instance ignored sysparm_fields
+func (snow *SnowDataReader) checkFields(records []interface{}) {
+	if len(snow.fields) == 0 || len(records) == 0 {
+		return
+	}
+
+	requested := make(map[string]bool, len(snow.fields))
+	returned := make(map[string]bool, len(snow.fields))
+	unrequested := 0
+	for _, field := range snow.fields {
+		requested[field] = true
+	}
+
+	for _, r := range records {
+		record, _ := r.(map[string]interface{})
+		for field := range record {
+			switch {
+			case requested[field]:
+				returned[field] = true
+			case snow.displayValue == displayValueAll && strings.HasPrefix(field, displayValuePrefix) &&
+				requested[strings.TrimPrefix(field, displayValuePrefix)]:
+				// The display value of a requested field
+			default:
+				delete(record, field)
+				unrequested++
+			}
+		}
+	}
+
+	if unrequested > 0 {
+		glog.V(1).Infof("Removed %d fields not in %s from the records of %s/%s",
+			unrequested, fieldsKey, snow.config[base.ServerURL], snow.config[base.Metric])
+	}
+
+	for _, field := range snow.fields {
+		if returned[field] || snow.missing[field] {
+			continue
+		}
+
+		if snow.missing == nil {
+			snow.missing = make(map[string]bool)
+		}
+		snow.missing[field] = true
+		glog.Warningf("Alert: field=%s of %s is not returned by %s/%s, it is not a column of the table or not readable by username=%s",
+			field, fieldsKey, snow.config[base.ServerURL], snow.config[base.Metric], snow.config[base.Username])
+	}
+}
+
+// parseDisplayValue returns "DisplayValue", "true" or "all", empty if it is
+// not set or "false"
+func parseDisplayValue(config base.BaseConfig) (string, error) {
+	switch config[displayValueKey] {
+	case "", "false":
+		return "", nil
+	case displayValueTrue, displayValueAll:
+		if config[endpointKey] != "" {
+			return "", errors.New(fmt.Sprintf("%s doesn't apply to %s, the Scripted REST API shall return the display values itself", displayValueKey, endpointKey))
+		}
+		return config[displayValueKey], nil
+	}
+	return "", errors.New(fmt.Sprintf("Invalid %s=%s, expect true, false or all", displayValueKey, config[displayValueKey]))
+}
+
+// applyDisplayValues shapes the records by DisplayValue. The records are
+// requested with sysparm_display_value=all, the instance returns a field
+// either as an object of its "value" and its "display_value", or as the raw
+// field along with its display value in the "dv_" prefixed one. With "all"
+// the records have both, the display value in the "dv_" prefixed field. With
+// "true" the display values replace the raw ones, except of sys_id,
+// TimestampField and DomainField, the reader relies on their raw values, for
+// e.g. TimestampField is displayed in the time zone and the format of the
+// user
+func (snow *SnowDataReader) applyDisplayValues(records []interface{}) {
+	if snow.displayValue == "" {
+		return
+	}
+
+	raw := map[string]bool{"sys_id": true, snow.config[timestampFieldKey]: true}
+	if len(snow.domains) > 0 {
+		raw[snow.domainField()] = true
+	}
+
+	for _, r := range records {
+		record, _ := r.(map[string]interface{})
+		display := make(map[string]interface{})
+		for field, value := range record {
+			if pair, ok := value.(map[string]interface{}); ok {
+				if rawValue, ok := pair["value"]; ok {
+					record[field] = rawValue
+					display[field] = pair["display_value"]
+				}
+			} else if strings.HasPrefix(field, displayValuePrefix) {
+				if _, ok := record[strings.TrimPrefix(field, displayValuePrefix)]; ok {
+					display[strings.TrimPrefix(field, displayValuePrefix)] = value
+					delete(record, field)
+				}
+			}
+		}
+
+		for field, value := range display {
+			if snow.displayValue == displayValueAll {
+				record[displayValuePrefix+field] = value
+			} else if !raw[field] {
+				record[field] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package snow
+
+import (
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strconv"
+	"time"
+)
+
+const (
+	// Data gap detection, "GapTolerance" in seconds, "GapRequery" "1"
+	// re-queries the window of a gap, see detectGap
+	gapToleranceKey = "GapTolerance"
+	gapRequeryKey   = "GapRequery"
+)
+
+// detectGap flags a suspected gap when a full page starts later than
+// NextRecordTime by more than GapTolerance. A busy table without changes in
+// the window hints at purged records or records hidden by an ACL change.
+// With GapRequery, the window is queried again and the records found there,
+// for e.g. missing from a lagging node, are collected instead of the page,
+// which is collected again by the next cycles
+func (snow *SnowDataReader) detectGap(records []interface{}) []interface{} {
+	tolerance, err := strconv.Atoi(snow.config[gapToleranceKey])
+	if err != nil || tolerance <= 0 || len(records) == 0 || len(records) < snow.recordCount() {
+		return records
+	}
+
+	first, _ := records[0].(map[string]interface{})
+	firstRecordTime, _ := first[snow.config[timestampFieldKey]].(string)
+	from, err := time.Parse(timeTemplate, snow.state.NextRecordTime)
+	to, terr := time.Parse(timeTemplate, firstRecordTime)
+	if err != nil || terr != nil || to.Sub(from) <= time.Duration(tolerance)*time.Second {
+		return records
+	}
+
+	gap := &base.TimeGap{
+		Key:    snow.checkpointKeyInfo()[base.Key],
+		From:   snow.state.NextRecordTime,
+		To:     firstRecordTime,
+		Reason: fmt.Sprintf("a full page of %d records started %s after the cursor", len(records), to.Sub(from)),
+	}
+
+	var missed []interface{}
+	if snow.config[gapRequeryKey] == "1" && snow.config[endpointKey] == "" {
+		body, err := snow.doRequest(snow.queryWindowURL(">=", snow.getNextRecordTime(), firstRecordTime, strconv.Itoa(snow.recordCount())))
+		if err == nil {
+			if jobj, err := base.ToJsonObject(body); err == nil {
+				missed, _ = snow.recordsOf(jobj)
+			}
+		}
+
+		if len(missed) > 0 {
+			gap.Reason += fmt.Sprintf(", the re-query recovered %d records", len(missed))
+		}
+	}
+
+	glog.Warningf("Alert: suspected data gap of key=%s from %s to %s, %s", gap.Key, gap.From, gap.To, gap.Reason)
+	if snow.onGap != nil {
+		snow.onGap(gap)
+	}
+
+	if len(missed) == 0 {
+		return records
+	}
+	return missed
+}
+
+// OnGap calls handler with the gaps suspected while collecting, it shall be
+// called before the reader is started
+func (snow *SnowDataReader) OnGap(handler func(gap *base.TimeGap)) {
+	snow.onGap = handler
+}
+
+// Gaps returns the ranges skipped by the resume policy on start
+func (snow *SnowDataReader) Gaps() []*base.TimeGap {
+	return snow.gaps
+}
+
+// applyResumeBound moves state forward to bound if it is behind, the skipped
+// range is reported as a data gap audit event. The state is checkpointed
+// when the next records are collected
+func applyResumeBound(config base.BaseConfig, key string, state *collectionState, bound time.Time) *base.TimeGap {
+	if bound.IsZero() {
+		return nil
+	}
+
+	from, err := time.Parse(timeTemplate, state.NextRecordTime)
+	if err == nil && !from.Before(bound) {
+		return nil
+	}
+
+	gap := &base.TimeGap{
+		Key:    key,
+		From:   state.NextRecordTime,
+		To:     bound.Format(timeTemplate),
+		Policy: config[base.ResumePolicy],
+	}
+	glog.Warningf("Audit: data gap, %s=%s skips the records of key=%s from %s to %s",
+		base.ResumePolicy, gap.Policy, key, gap.From, gap.To)
+
+	state.NextRecordTime = gap.To
+	state.LastTimeRecords = []string{}
+	return gap
+}
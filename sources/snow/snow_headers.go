@@ -0,0 +1,56 @@
+package snow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Static headers of every request, a JSON object whose values may refer
+	// to secrets, see parseRequestHeaders
+	headersKey = "RequestHeaders"
+)
+
+// reservedHeaders are set by the reader itself and can't be RequestHeaders
+var reservedHeaders = []string{"Accept", "Accept-Encoding", "Authorization", "Content-Length", "Host"}
+
+// parseRequestHeaders returns the RequestHeaders of config with the secrets
+// resolved, nil if it is not set
+func parseRequestHeaders(config base.BaseConfig) (http.Header, error) {
+	if config[headersKey] == "" {
+		return nil, nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(config[headersKey]), &values); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid %s, expect a JSON object of header values, error=%s", headersKey, err))
+	}
+
+	headers := make(http.Header, len(values))
+	for name, value := range values {
+		for _, reserved := range reservedHeaders {
+			if strings.EqualFold(name, reserved) {
+				return nil, errors.New(fmt.Sprintf("Header=%s is reserved, it can't be in %s", name, headersKey))
+			}
+		}
+
+		secret, err := base.ResolveSecret(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to resolve header=%s, error=%s", name, err))
+		}
+		headers.Set(name, secret)
+	}
+	return headers, nil
+}
+
+func addHeaders(req *http.Request, headers http.Header) {
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package snow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Paging of a cycle, "Paginate" "1" keeps collecting the next pages by
+	// sysparm_offset, within "CycleBudget", for e.g. "10m", if it is set
+	paginateKey    = "Paginate"
+	cycleBudgetKey = "CycleBudget"
+)
+
+// nextPage moves the offset past page if it is full, otherwise the next page
+// starts from the checkpoint again. With Paginate, the pages of a cycle are
+// requested by their offset in the records changed since the checkpoint the
+// cycle started from, so the records sharing a timestamp across the pages
+// are neither stalled on nor skipped. Each page starts with the last record
+// of the page before, see dropOverlap
+func (snow *SnowDataReader) nextPage(page []interface{}, full bool) {
+	if !full || len(page) == 0 {
+		snow.pageOffset = 0
+		snow.pageLast = ""
+		return
+	}
+
+	lastRecord, _ := page[len(page)-1].(map[string]interface{})
+	sysId, _ := lastRecord["sys_id"].(string)
+	if sysId == "" {
+		// The overlap can't be verified without it
+		snow.nextPage(nil, false)
+		return
+	}
+
+	if snow.pageOffset > 0 {
+		snow.pageOffset--
+	}
+	snow.pageOffset += len(page)
+	snow.pageLast = sysId
+}
+
+// dropOverlap removes the last record of the page before from the head of
+// page. It returns false if page doesn't start with it, the records before
+// the offset changed and moved to the end then, and the records which took
+// their places would be skipped. The next page starts from the checkpoint
+// again in that case
+func (snow *SnowDataReader) dropOverlap(page []interface{}) ([]interface{}, bool) {
+	if len(page) > 0 {
+		firstRecord, _ := page[0].(map[string]interface{})
+		if sysId, _ := firstRecord["sys_id"].(string); sysId != "" && sysId == snow.pageLast {
+			return page[1:], true
+		}
+	}
+
+	glog.Warningf("Records of %s/%s changed while paging at offset=%d, continue from the checkpoint=%s",
+		snow.config[base.ServerURL], snow.config[base.Metric], snow.pageOffset, snow.state.NextRecordTime)
+	snow.nextPage(nil, false)
+	return nil, false
+}
+
+// detectPageCap caps the records per request when the instance returned
+// fewer records than requested while more of them had changed before the
+// request, for e.g. when RecordCount is above glide.processor.json.row_limit.
+// Otherwise pages truncated by the instance are not recognized as full, and a
+// full page of records with the same timestamp stalls the collection
+func (snow *SnowDataReader) detectPageCap(records []interface{}, requestStart time.Time) {
+	// The probe needs a ">" query which Scripted REST APIs don't support
+	if len(records) == 0 || len(records) >= snow.recordCount() || snow.config[endpointKey] != "" {
+		return
+	}
+
+	timefield := snow.config[timestampFieldKey]
+	lastRecord, _ := records[len(records)-1].(map[string]interface{})
+	lastRecordTime, _ := lastRecord[timefield].(string)
+	if lastRecordTime == "" {
+		return
+	}
+
+	body, err := snow.doRequest(snow.queryURL(">", strings.Replace(lastRecordTime, " ", "+", 1), "1"))
+	if err != nil {
+		return
+	}
+
+	jobj, err := base.ToJsonObject(body)
+	if err != nil {
+		return
+	}
+
+	next, _ := jobj["records"].([]interface{})
+	if len(next) == 0 {
+		return
+	}
+	nextRecord, _ := next[0].(map[string]interface{})
+	nextRecordTime, _ := nextRecord[timefield].(string)
+
+	// The records changed after the request started were not truncated.
+	// Snow timestamps are in UTC and by the snow clock
+	if snow.config[base.ClockSkewCompensate] == "1" {
+		requestStart = requestStart.Add(snow.ClockSkew())
+	}
+	if nextRecordTime == "" || nextRecordTime > requestStart.UTC().Format(timeTemplate) {
+		return
+	}
+
+	glog.Warningf("%s/%s returned %d records for RecordCount=%s while more were available, cap the records per request to %d",
+		snow.config[base.ServerURL], snow.config[base.Metric], len(records), snow.config[recordCountKey], len(records))
+	atomic.StoreInt64(&snow.pageCap, int64(len(records)))
+}
+
+// parseCycleBudget returns CycleBudget, 0 if a cycle collects one page
+func parseCycleBudget(config base.BaseConfig) (time.Duration, error) {
+	if config[cycleBudgetKey] == "" {
+		return 0, nil
+	}
+
+	budget, err := time.ParseDuration(config[cycleBudgetKey])
+	if err != nil || budget <= 0 {
+		return 0, errors.New(fmt.Sprintf("Invalid %s=%s, expect a positive duration", cycleBudgetKey, config[cycleBudgetKey]))
+	}
+	return budget, nil
+}
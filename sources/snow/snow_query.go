@@ -0,0 +1,75 @@
+package snow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Server side query shape, see parseQueryHints
+	queryHintsKey = "QueryHints"
+	queryOrderKey = "QueryOrder"
+)
+
+// parseQueryHints returns the query parameters of "QueryHints", in URL query
+// format, for e.g. "sysparm_suppress_pagination_header=true&sysparm_no_count=true",
+// which are added to every request, and the sysparm_query clauses of
+// "QueryOrder", "," separated fields ordering the records of the same
+// TimestampField, each of them descending if prefixed by "-", for e.g.
+// "-sys_created_on,sys_id". The records are always ordered by TimestampField
+// ascending first, the checkpoint relies on it. The parameters set by the
+// reader itself can't be hints
+func parseQueryHints(config base.BaseConfig) (url.Values, string, error) {
+	hints, err := url.ParseQuery(config[queryHintsKey])
+	if err != nil {
+		return nil, "", err
+	}
+
+	reserved := []string{"JSONv2", "sysparm_query", "sysparm_record_count"}
+	if config[fieldsKey] != "" {
+		reserved = append(reserved, "sysparm_fields")
+	}
+	if config[displayValueKey] != "" {
+		reserved = append(reserved, "sysparm_display_value")
+	}
+	if config[endpointKey] != "" {
+		reserved = []string{configOr(config, cursorParamKey, defaultCursorParam), configOr(config, limitParamKey, defaultLimitParam)}
+	}
+	for _, name := range reserved {
+		if _, ok := hints[name]; ok {
+			return nil, "", errors.New(fmt.Sprintf("%s is set by the reader, it can't be in %s", name, queryHintsKey))
+		}
+	}
+
+	if len(hints) == 0 {
+		hints = nil
+	}
+
+	if config[queryOrderKey] != "" && config[endpointKey] != "" {
+		return nil, "", errors.New(fmt.Sprintf("%s doesn't apply to %s", queryOrderKey, endpointKey))
+	}
+
+	var orderBy bytes.Buffer
+	for _, field := range strings.Split(config[queryOrderKey], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		orderBy.WriteString("^ORDERBY")
+		if strings.HasPrefix(field, "-") {
+			orderBy.WriteString("DESC")
+			field = field[1:]
+		}
+
+		if field == "" || strings.ContainsAny(field, "^&=") {
+			return nil, "", errors.New(fmt.Sprintf("invalid field %q in %s", field, queryOrderKey))
+		}
+		orderBy.WriteString(field)
+	}
+	return hints, orderBy.String(), nil
+}
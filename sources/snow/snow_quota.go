@@ -0,0 +1,30 @@
+package snow
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"time"
+)
+
+// SetRequestQuota counts the requests of the reader in quota, shared by the
+// readers of the instances, with the QuotaHourly and QuotaDaily of the reader
+// as the limits of its instance if they are set. A cycle is skipped, or ends
+// after the page in progress, while the quota doesn't allow the Priority of
+// the reader, see base.RequestQuota.Allow. It shall be called before the
+// reader is started
+func (snow *SnowDataReader) SetRequestQuota(quota *base.RequestQuota) {
+	snow.quota = quota
+	if quota != nil && snow.limits != nil {
+		quota.SetLimits(snow.config[base.ServerURL], snow.limits)
+	}
+}
+
+func (snow *SnowDataReader) allowedByQuota() bool {
+	if snow.quota == nil || snow.quota.Allow(snow.config[base.ServerURL], snow.priority, time.Now()) {
+		return true
+	}
+
+	glog.V(1).Infof("Throttled %s/%s of priority=%s by the quota of the instance",
+		snow.config[base.ServerURL], snow.config[base.Metric], snow.priority)
+	return false
+}
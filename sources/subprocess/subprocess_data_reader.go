@@ -0,0 +1,394 @@
+// Package subprocess collects data from a source which runs as a child
+// process, so custom sources can be written in any language.
+//
+// The protocol is line delimited JSON-RPC 2.0 over stdio. For each collection
+// cycle descartes writes a request to the stdin of the source
+//
+//	{"jsonrpc":"2.0","id":1,"method":"collect","params":{"config":{...},"checkpoint":<JSON or null>}}
+//
+// The source streams zero or more notifications to its stdout. Each record is
+// either a JSON string which is taken as the raw record, or any other JSON
+// value which is the record as is. A checkpoint in a notification is committed
+// after its records are written
+//
+//	{"jsonrpc":"2.0","method":"data","params":{"records":[...],"checkpoint":<JSON>}}
+//
+// and ends the cycle with a response, the checkpoint is optional
+//
+//	{"jsonrpc":"2.0","id":1,"result":{"checkpoint":<JSON>}}
+//	{"jsonrpc":"2.0","id":1,"error":{"code":-1,"message":"..."}}
+//
+// Whatever the source writes to stderr is logged. When stdin is closed, the
+// source shall exit. A source which fails or times out is killed and
+// relaunched in the next cycle
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chenziliang/descartes/base"
+	"github.com/golang/glog"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jsonRPCVersion       = "2.0"
+	methodCollect        = "collect"
+	methodData           = "data"
+	defaultSourceTimeout = 300 * time.Second
+	shutdownTimeout      = 5 * time.Second
+	maxLineSize          = 16 * 1024 * 1024
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type collectParams struct {
+	Config     base.BaseConfig `json:"config"`
+	Checkpoint json.RawMessage `json:"checkpoint"`
+}
+
+type dataParams struct {
+	Records    []json.RawMessage `json:"records"`
+	Checkpoint json.RawMessage   `json:"checkpoint,omitempty"`
+}
+
+type collectResult struct {
+	Checkpoint json.RawMessage `json:"checkpoint,omitempty"`
+}
+
+// sourceProcess is a running source
+type sourceProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte // closed when stdout is closed
+}
+
+type SubprocessDataReader struct {
+	config       base.BaseConfig
+	writer       base.DataWriter
+	checkpoint   base.Checkpointer
+	command      []string
+	timeout      time.Duration
+	writeTimeout time.Duration
+	process      *sourceProcess
+	state        json.RawMessage
+	nextID       int64
+	collecting   int32
+	lifecycle    base.Lifecycle
+}
+
+// NewSubprocessDataReader
+// @config: shall contain "SourceCommand" which is the command line of the
+// source, and optionally "SourceTimeout" in seconds for each collection
+// cycle, default to 300 seconds
+func NewSubprocessDataReader(
+	config base.BaseConfig, writer base.DataWriter, checkpoint base.Checkpointer) *SubprocessDataReader {
+	command := strings.Fields(config[base.SourceCommand])
+	if len(command) == 0 {
+		glog.Errorf("%s is missing. It is required by subprocess data collection", base.SourceCommand)
+		return nil
+	}
+
+	timeout := defaultSourceTimeout
+	if config[base.SourceTimeout] != "" {
+		seconds, err := strconv.Atoi(config[base.SourceTimeout])
+		if err != nil {
+			glog.Errorf("Failed to convert %s to integer, error=%s", config[base.SourceTimeout], err)
+			return nil
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	state, err := checkpoint.GetCheckpoint(config)
+	if err != nil {
+		return nil
+	}
+
+	if state != nil && !json.Valid(state) {
+		glog.Errorf("Checkpoint=%s of source=%s is not JSON", string(state), command[0])
+		return nil
+	}
+
+	return &SubprocessDataReader{
+		config:       config,
+		writer:       writer,
+		checkpoint:   checkpoint,
+		command:      command,
+		timeout:      timeout,
+		writeTimeout: base.GetWriteTimeout(config),
+		state:        state,
+	}
+}
+
+func (reader *SubprocessDataReader) Start() {
+	if reader.lifecycle.Start("SubprocessDataReader") != nil {
+		return
+	}
+
+	reader.writer.Start()
+	reader.checkpoint.Start()
+	glog.Infof("SubprocessDataReader started...")
+}
+
+func (reader *SubprocessDataReader) Stop() {
+	if reader.lifecycle.Stop("SubprocessDataReader") != nil {
+		return
+	}
+
+	// Wait for the running cycle, if any, before shutting down the source
+	for !atomic.CompareAndSwapInt32(&reader.collecting, 0, 1) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	reader.shutdown()
+	atomic.StoreInt32(&reader.collecting, 0)
+
+	reader.writer.Stop()
+	reader.checkpoint.Stop()
+	glog.Infof("SubprocessDataReader stopped...")
+}
+
+func (reader *SubprocessDataReader) Status() string {
+	return reader.lifecycle.Status()
+}
+
+func (reader *SubprocessDataReader) ReadData() ([]byte, error) {
+	return nil, nil
+}
+
+func (reader *SubprocessDataReader) IndexData() error {
+	if !atomic.CompareAndSwapInt32(&reader.collecting, 0, 1) {
+		glog.Infof("Last data collection for source=%s has not been done", reader.command[0])
+		return base.ErrSkipped
+	}
+	defer atomic.StoreInt32(&reader.collecting, 0)
+
+	if !reader.lifecycle.Running() {
+		return nil
+	}
+
+	err := reader.collect()
+	if err != nil {
+		// The source may be in the middle of the cycle, relaunch it next time
+		glog.Errorf("Failed to collect data from source=%s, error=%s", reader.command[0], err)
+		reader.kill()
+	}
+	return err
+}
+
+func (reader *SubprocessDataReader) collect() error {
+	if reader.process == nil {
+		if err := reader.launch(); err != nil {
+			return err
+		}
+	}
+
+	reader.nextID++
+	id := reader.nextID
+	params, _ := json.Marshal(&collectParams{Config: reader.config, Checkpoint: reader.state})
+	request, _ := json.Marshal(&rpcMessage{JSONRPC: jsonRPCVersion, ID: &id, Method: methodCollect, Params: params})
+	if _, err := reader.process.stdin.Write(append(request, '\n')); err != nil {
+		return err
+	}
+
+	deadline := time.After(reader.timeout)
+	for {
+		var line []byte
+		var ok bool
+		select {
+		case line, ok = <-reader.process.lines:
+			if !ok {
+				return errors.New("Source exited in the middle of the collection")
+			}
+		case <-deadline:
+			return errors.New(fmt.Sprintf("Source didn't respond in %s", reader.timeout))
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return errors.New(fmt.Sprintf("Invalid message=%s, error=%s", string(line), err))
+		}
+
+		if msg.Method == methodData {
+			if err := reader.handleData(msg.Params); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.ID == nil || *msg.ID != id {
+			glog.Warningf("Ignore unexpected message=%s from source=%s", string(line), reader.command[0])
+			continue
+		}
+
+		if msg.Error != nil {
+			return errors.New(fmt.Sprintf("Source failed, code=%d, message=%s", msg.Error.Code, msg.Error.Message))
+		}
+
+		var result collectResult
+		if len(msg.Result) > 0 {
+			if err := json.Unmarshal(msg.Result, &result); err != nil {
+				return err
+			}
+		}
+		return reader.writeCheckpoint(result.Checkpoint)
+	}
+}
+
+func (reader *SubprocessDataReader) handleData(rawParams json.RawMessage) error {
+	var params dataParams
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return err
+	}
+
+	if len(params.Records) > 0 {
+		metaInfo := map[string]string{
+			base.ServerURL:     reader.config[base.ServerURL],
+			base.Username:      reader.config[base.Username],
+			base.Metric:        reader.config[base.Metric],
+			base.TaskConfigKey: reader.config[base.TaskConfigKey],
+		}
+
+		data := base.NewData(metaInfo, make([][]byte, 0, len(params.Records)))
+		for _, record := range params.Records {
+			var raw string
+			if len(record) > 0 && record[0] == '"' && json.Unmarshal(record, &raw) == nil {
+				data.RawData = append(data.RawData, []byte(raw))
+			} else {
+				data.RawData = append(data.RawData, []byte(record))
+			}
+		}
+
+		// On write timeout, fail this cycle without checkpointing
+		if err := base.WriteDataTimeout(reader.writer, data, reader.writeTimeout); err != nil {
+			return err
+		}
+	}
+	return reader.writeCheckpoint(params.Checkpoint)
+}
+
+func (reader *SubprocessDataReader) writeCheckpoint(state json.RawMessage) error {
+	if len(state) == 0 || bytes.Equal(state, []byte("null")) {
+		return nil
+	}
+
+	if err := reader.checkpoint.WriteCheckpoint(reader.config, state); err != nil {
+		return err
+	}
+	reader.state = state
+	return nil
+}
+
+func (reader *SubprocessDataReader) launch() error {
+	cmd := exec.Command(reader.command[0], reader.command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		glog.Errorf("Failed to launch source=%s, error=%s", reader.config[base.SourceCommand], err)
+		return err
+	}
+	glog.Infof("Launched source=%s, pid=%d", reader.config[base.SourceCommand], cmd.Process.Pid)
+
+	process := &sourceProcess{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan []byte, 16),
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			if len(bytes.TrimSpace(line)) > 0 {
+				process.lines <- line
+			}
+		}
+		close(process.lines)
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			glog.Infof("Source=%s: %s", reader.command[0], scanner.Text())
+		}
+	}()
+
+	reader.process = process
+	return nil
+}
+
+// shutdown closes the stdin of the source and kills it if it doesn't exit
+func (reader *SubprocessDataReader) shutdown() {
+	if reader.process == nil {
+		return
+	}
+
+	process := reader.process
+	reader.process = nil
+	process.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		// Drain stdout so that the source doesn't block on writing
+		for range process.lines {
+		}
+		done <- process.cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		glog.Warningf("Source=%s didn't exit in %s, kill it", reader.command[0], shutdownTimeout)
+		process.cmd.Process.Kill()
+		<-done
+	}
+}
+
+func (reader *SubprocessDataReader) kill() {
+	if reader.process == nil {
+		return
+	}
+
+	process := reader.process
+	reader.process = nil
+	process.stdin.Close()
+	process.cmd.Process.Kill()
+	go func() {
+		for range process.lines {
+		}
+		process.cmd.Wait()
+	}()
+}
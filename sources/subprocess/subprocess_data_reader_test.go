@@ -0,0 +1,73 @@
+package subprocess
+
+import (
+	"github.com/chenziliang/descartes/base"
+	"github.com/chenziliang/descartes/sinks/memory"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The source echoes the checkpoint it got, 2 records and a checkpoint
+const testSource = `#!/bin/sh
+while read line; do
+	id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+	echo "collecting $id" >&2
+	echo '{"jsonrpc":"2.0","method":"data","params":{"records":["raw line",{"number":"INC1"}]}}'
+	echo '{"jsonrpc":"2.0","id":'$id',"result":{"checkpoint":{"Cycle":'$id'}}}'
+done
+`
+
+func TestSubprocessDataReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subprocess")
+	if err != nil {
+		t.Errorf("Failed to create temp dir, error=%s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "source.sh")
+	ioutil.WriteFile(script, []byte(testSource), 0755)
+
+	config := base.BaseConfig{
+		base.SourceCommand:       "/bin/sh " + script,
+		base.CheckpointDir:       dir,
+		base.CheckpointNamespace: "subprocess",
+		base.CheckpointKey:       "test",
+	}
+
+	writer := memory.NewMemoryDataWriter()
+	ck := base.NewFileCheckpointer()
+	reader := NewSubprocessDataReader(config, writer, ck)
+	if reader == nil {
+		t.Errorf("Failed to create subprocess data reader")
+		return
+	}
+	reader.Start()
+	defer reader.Stop()
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		if err := reader.IndexData(); err != nil {
+			t.Errorf("Failed to collect data, error=%s", err)
+			return
+		}
+
+		data := <-writer.Data()
+		if len(data.RawData) != 2 || string(data.RawData[0]) != "raw line" || string(data.RawData[1]) != `{"number":"INC1"}` {
+			t.Errorf("Unexpected records=%s", data.RawData)
+		}
+	}
+
+	state, _ := ck.GetCheckpoint(config)
+	if string(state) != `{"Cycle":2}` {
+		t.Errorf("Expect checkpoint of the 2nd cycle, got=%s", state)
+	}
+
+	failing := NewSubprocessDataReader(base.BaseConfig{base.SourceCommand: "/bin/sh -c exit"}, writer, base.NewNullCheckpointer())
+	failing.Start()
+	defer failing.Stop()
+	if err := failing.IndexData(); err == nil {
+		t.Errorf("Expect error when the source exits")
+	}
+}